@@ -97,7 +97,7 @@ func (ims *inMemoryStream) Validate(_ context.Context, _ *pubSubConfig) error {
 	return nil // no config defined in pubSubConfig to validate
 }
 
-func (ims *inMemoryStream) Run(_ context.Context, _ *eventstreams.EventStreamSpec[pubSubConfig], checkpointSequenceID string, deliver eventstreams.Deliver[pubSubMessage]) (err error) {
+func (ims *inMemoryStream) Run(_ context.Context, _ *eventstreams.EventStreamSpec[pubSubConfig], checkpointSequenceID string, _ eventstreams.SubSourceCheckpoints, deliver eventstreams.Deliver[pubSubMessage]) (err error) {
 	var index int
 	if checkpointSequenceID != "" {
 		index, err = strconv.Atoi(checkpointSequenceID)
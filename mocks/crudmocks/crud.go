@@ -46,6 +46,36 @@ func (_m *CRUD[T]) Count(ctx context.Context, filter ffapi.Filter) (int64, error
 	return r0, r1
 }
 
+// CountBy provides a mock function with given fields: ctx, filter, groupColumn
+func (_m *CRUD[T]) CountBy(ctx context.Context, filter ffapi.Filter, groupColumn string) (map[string]int64, error) {
+	ret := _m.Called(ctx, filter, groupColumn)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountBy")
+	}
+
+	var r0 map[string]int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, ffapi.Filter, string) (map[string]int64, error)); ok {
+		return rf(ctx, filter, groupColumn)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, ffapi.Filter, string) map[string]int64); ok {
+		r0 = rf(ctx, filter, groupColumn)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int64)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, ffapi.Filter, string) error); ok {
+		r1 = rf(ctx, filter, groupColumn)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: ctx, id, hooks
 func (_m *CRUD[T]) Delete(ctx context.Context, id string, hooks ...dbsql.PostCompletionHook) error {
 	_va := make([]interface{}, len(hooks))
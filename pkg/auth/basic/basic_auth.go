@@ -73,6 +73,7 @@ func (a *Auth) Authorize(ctx context.Context, req *fftypes.AuthReq) error {
 				if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
 					log.L(ctx).Warnf("user authentication failed: %s", err.Error())
 				} else {
+					req.Principal = username
 					return nil
 				}
 			}
@@ -54,6 +54,7 @@ func TestAuthorize(t *testing.T) {
 	assert.NoError(t, err)
 	err = a.Authorize(context.Background(), authReq)
 	assert.NoError(t, err)
+	assert.Equal(t, "firefly", authReq.Principal)
 
 	authReq = &fftypes.AuthReq{
 		URL: url,
@@ -24,6 +24,14 @@ import (
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 )
 
+type CtxPrincipalKey struct{}
+
+// GetPrincipal returns the principal set by the auth plugin for the request, or "" if none was set
+func GetPrincipal(ctx context.Context) string {
+	principal, _ := ctx.Value(CtxPrincipalKey{}).(string)
+	return principal
+}
+
 type Handler struct {
 	plugin Plugin
 }
@@ -47,6 +55,9 @@ func (h *Handler) Handler(chain http.Handler) http.Handler {
 			// Error is unchecked here because it is not possible to error when encoding a string to JSON
 			_ = encoder.Encode(map[string]interface{}{"error": err.Error()})
 		} else {
+			if authReq.Principal != "" {
+				req = req.WithContext(context.WithValue(req.Context(), CtxPrincipalKey{}, authReq.Principal))
+			}
 			chain.ServeHTTP(res, req)
 		}
 	})
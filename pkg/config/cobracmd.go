@@ -35,7 +35,7 @@ func ShowConfigCommand(initConf func() error) *cobra.Command {
 			fmt.Printf("%-64s %v\n", "Key", "Value")
 			fmt.Print("-----------------------------------------------------------------------------------\n")
 			for _, k := range GetKnownKeys() {
-				fmt.Printf("%-64s %v\n", k, Get(RootKey(k)))
+				fmt.Printf("%-64s %v\n", k, getRedacted(k))
 			}
 			return nil
 		},
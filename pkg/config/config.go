@@ -24,6 +24,7 @@ import (
 	"math"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -83,6 +84,13 @@ var (
 
 type KeySet interface {
 	AddKnownKey(key string, defValue ...interface{})
+	// MarkSensitive marks a key, or a whole sub-section, as containing secrets that must
+	// be masked whenever the configuration is output - such as by GetRedactedConfig or showconfig
+	MarkSensitive(key string)
+	// SetDurationUnit makes a duration key accept either a duration string such as "30s", or a bare
+	// number in the given unit, and reject negative values. Otherwise a bare number is milliseconds,
+	// so a warning is logged for a bare number of 1000 or more in a larger unit, in case it was written as milliseconds
+	SetDurationUnit(key string, unit time.Duration)
 }
 
 type sectionParent interface {
@@ -109,6 +117,7 @@ type Section interface {
 	GetUint(key string) uint
 	GetUint64(key string) uint64
 	GetDuration(key string) time.Duration
+	ParseDuration(key string) (time.Duration, error)
 	GetStringSlice(key string) []string
 	GetObject(key string) fftypes.JSONObject
 	GetObjectArray(key string) fftypes.JSONObjectArray
@@ -122,6 +131,7 @@ type ArraySection interface {
 	KeySet
 	ArraySize() int
 	ArrayEntry(i int) Section
+	ForEach(ctx context.Context, fn func(i int, entry Section) error) error
 	SubSection(name string) Section
 	SubArray(name string) ArraySection
 	SetDefault(key string, defValue interface{})
@@ -138,6 +148,7 @@ func RootConfigReset(setServiceDefaults ...func()) {
 	oldCfgFile := viper.ConfigFileUsed()
 	viper.Reset()
 	viper.SetConfigFile(oldCfgFile)
+	resolvedSecrets = map[string]resolvedSecret{}
 
 	viper.SetDefault(string(Lang), "en")
 	viper.SetDefault(string(LogLevel), "info")
@@ -162,7 +173,8 @@ func RootConfigReset(setServiceDefaults ...func()) {
 	i18n.SetLang(viper.GetString(string(Lang)))
 }
 
-// ReadConfig initializes the config
+// ReadConfig initializes the config, resolving any references to secrets held outside of the
+// configuration in string values - such as `{{file:/run/secrets/db}}` or `{{env:DB_PASSWORD}}`
 func ReadConfig(cfgSuffix, cfgFile string) error {
 	keysMutex.Lock() // must only call viper directly here (as we already hold the lock)
 	defer keysMutex.Unlock()
@@ -179,7 +191,10 @@ func ReadConfig(cfgSuffix, cfgFile string) error {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
 	}
-	return viper.ReadInConfig()
+	if err := viper.ReadInConfig(); err != nil {
+		return err
+	}
+	return resolveSecrets(context.Background())
 }
 
 // Listens for changes to the configuration file configured in Viper.
@@ -230,11 +245,23 @@ func MergeConfig(configRecords []*fftypes.ConfigRecord) error {
 			viper.Set(c.Key, v)
 		}
 	}
-	return nil
+	return resolveSecrets(context.Background())
 }
 
-var knownKeys = map[string]bool{} // All config keys go here, including those defined in sub-sections
+var knownKeys = map[string]bool{}     // All config keys go here, including those defined in sub-sections
+var sensitiveKeys = map[string]bool{} // Lower-case, as viper is case insensitive, with "[]" in place of array indexes
 var keysMutex sync.Mutex
+
+// durationUnits are the units of a bare number for duration keys, keyed as for sensitiveKeys
+var durationUnits = map[string]time.Duration{}
+
+// Bare numbers of at least this many units, for keys with a unit larger than a millisecond, are
+// likely to have been written as milliseconds - which was the unit before SetDurationUnit existed
+const largeBareDuration = 1000
+
+// RedactedValue replaces the value of sensitive keys, when the configuration is output
+const RedactedValue = "***"
+
 var root = &configSection{}
 
 // AddRootKey adds a root key, used to define the keys that are used within the core
@@ -243,6 +270,104 @@ func AddRootKey(k string) RootKey {
 	return RootKey(k)
 }
 
+// MarkSensitive marks a root key, or a whole section by its prefix, as sensitive
+func MarkSensitive(key RootKey) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	sensitiveKeys[strings.ToLower(string(key))] = true
+}
+
+// SetDurationUnit sets the unit of a bare number for a root duration key, such as time.Second
+func SetDurationUnit(key RootKey, unit time.Duration) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	durationUnits[strings.ToLower(string(key))] = unit
+}
+
+// durationUnit returns the unit set for a duration key, which can include array indexes
+func durationUnit(key string) (time.Duration, bool) {
+	// Caller responsible for holding lock when calling
+	if len(durationUnits) == 0 {
+		return 0, false
+	}
+	path := ""
+	for _, segment := range strings.Split(strings.ToLower(key), ".") {
+		if _, err := strconv.Atoi(segment); err == nil && path != "" {
+			path += "[]"
+		} else {
+			path = keyName(path, segment)
+		}
+	}
+	unit, ok := durationUnits[path]
+	return unit, ok
+}
+
+// isLargeBareDuration checks for a bare number that is likely to be in milliseconds, rather than the unit of the key
+func isLargeBareDuration(value string, unit time.Duration) bool {
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return err == nil && unit > time.Millisecond && number >= largeBareDuration
+}
+
+func parseDurationWithUnit(fullKey string, unit time.Duration) (time.Duration, error) {
+	// Caller responsible for holding lock when calling
+	value := viper.GetString(fullKey)
+	duration, err := fftypes.ParseDurationWithUnit(context.Background(), value, unit)
+	if err == nil && isLargeBareDuration(value, unit) {
+		log.L(context.Background()).Warnf("Value %s for '%s' is interpreted as %s - use a duration string such as '%sms' if milliseconds were intended", value, fullKey, duration, value)
+	}
+	return duration, err
+}
+
+// IsSensitive returns true if the key, or any section containing it, has been marked sensitive.
+// The key can include array indexes, such as "plugins.0.auth.password".
+func IsSensitive(key string) bool {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	return isSensitive(key)
+}
+
+func isSensitive(key string) bool {
+	// Caller responsible for holding lock when calling
+	if len(sensitiveKeys) == 0 {
+		return false
+	}
+	path := ""
+	for _, segment := range strings.Split(strings.ToLower(key), ".") {
+		if _, err := strconv.Atoi(segment); err == nil && path != "" {
+			path += "[]"
+		} else {
+			path = keyName(path, segment)
+		}
+		if sensitiveKeys[path] {
+			return true
+		}
+	}
+	return false
+}
+
+// redact returns a copy of the value found at the path, with any sensitive values masked
+func redact(path string, value interface{}) interface{} {
+	if value != nil && isSensitive(path) {
+		return RedactedValue
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			redacted[k] = redact(keyName(path, k), child)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, child := range v {
+			redacted[i] = redact(keyName(path, strconv.Itoa(i)), child)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
 // GetKnownKeys gets the known keys
 func GetKnownKeys() []string {
 	keysMutex.Lock()
@@ -261,6 +386,7 @@ type configSection struct {
 	prefix     string
 	parent     sectionParent
 	arrayEntry bool
+	entryPath  string
 }
 
 // configArray is a point in the config that supports an array
@@ -370,12 +496,23 @@ func (c *configArray) ArraySize() int {
 	return 0
 }
 
+// arrayPath returns the location of an array in the config for errors, including the index of any enclosing array entry
+func arrayPath(base string, p sectionParent) string {
+	for s, ok := p.(*configSection); ok; s, ok = s.parent.(*configSection) {
+		if s.arrayEntry {
+			return s.entryPath + strings.TrimPrefix(base, s.prefix)
+		}
+	}
+	return base
+}
+
 // ArrayEntry must only be called after the config has been loaded
 func (c *configArray) ArrayEntry(i int) Section {
 	cp := &configSection{
 		prefix:     keyName(c.base, fmt.Sprintf("%d", i)),
 		parent:     c,
 		arrayEntry: true,
+		entryPath:  fmt.Sprintf("%s[%d]", arrayPath(c.base, c.parent), i),
 	}
 	for knownKey, defValue := range c.defaults {
 		cp.AddKnownKey(knownKey, defValue...)
@@ -392,6 +529,25 @@ func (c *configArray) ArrayEntry(i int) Section {
 	return cp
 }
 
+// ForEach calls the function with each entry in the array, with defaults applied, stopping on the first error.
+// It must only be called after the config has been loaded. Errors are wrapped with the path of the entry,
+// including its index, such as "plugins[1].headers[0]".
+func (c *configArray) ForEach(ctx context.Context, fn func(i int, entry Section) error) error {
+	// The size must be read before the defaults of any entry are set
+	size := c.ArraySize()
+	for i := 0; i < size; i++ {
+		entry := c.ArrayEntry(i)
+		if err := fn(i, entry); err != nil {
+			if ffErr, ok := err.(i18n.FFError); ok && ffErr.MessageKey() == i18n.MsgConfigArrayEntryInvalid {
+				// already wrapped with the path of a nested array entry
+				return err
+			}
+			return i18n.WrapError(ctx, err, i18n.MsgConfigArrayEntryInvalid, entry.(*configSection).entryPath)
+		}
+	}
+	return nil
+}
+
 func (c *configArray) AddKnownKey(k string, defValue ...interface{}) {
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
@@ -419,6 +575,30 @@ func (c *configSection) AddKnownKey(k string, defValue ...interface{}) {
 	}
 }
 
+func (c *configArray) MarkSensitive(k string) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	sensitiveKeys[strings.ToLower(keyName(c.base+"[]", k))] = true
+}
+
+func (c *configSection) MarkSensitive(k string) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	sensitiveKeys[strings.ToLower(keyName(c.prefix, k))] = true
+}
+
+func (c *configArray) SetDurationUnit(k string, unit time.Duration) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	durationUnits[strings.ToLower(keyName(c.base+"[]", k))] = unit
+}
+
+func (c *configSection) SetDurationUnit(k string, unit time.Duration) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	durationUnits[strings.ToLower(keyName(c.prefix, k))] = unit
+}
+
 func (c *configArray) AddChild(k string, defValue ...interface{}) {
 	// When a child is added anywhere below this array, add it to the defaults map
 	prefix := c.base + "[]."
@@ -460,7 +640,17 @@ func GetConfig() fftypes.JSONObject {
 	return conf
 }
 
-// GetString gets a configuration string
+// GetRedactedConfig returns the effective configuration for output, with the values of sensitive keys masked
+func GetRedactedConfig() fftypes.JSONObject {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	conf := map[string]interface{}{}
+	_ = viper.Unmarshal(&conf)
+	return redact("", conf).(map[string]interface{})
+}
+
+// GetString gets a configuration string, with any references to secrets resolved
 func GetString(key RootKey) string {
 	return root.GetString(string(key))
 }
@@ -468,7 +658,7 @@ func (c *configSection) GetString(key string) string {
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
-	return viper.GetString(c.prefixKey(key))
+	return getResolvedString(c.prefixKey(key))
 }
 
 // GetStringSlice gets a configuration string array
@@ -501,7 +691,39 @@ func (c *configSection) GetDuration(key string) time.Duration {
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
-	return fftypes.ParseToDuration(viper.GetString(c.prefixKey(key)))
+	fullKey := c.prefixKey(key)
+	if unit, ok := durationUnit(fullKey); ok {
+		duration, err := parseDurationWithUnit(fullKey, unit)
+		if err != nil {
+			log.L(context.Background()).Errorf("Invalid value for '%s': %s", fullKey, err)
+		}
+		return duration
+	}
+	return fftypes.ParseToDuration(viper.GetString(fullKey))
+}
+
+// ParseDuration gets a configuration time duration, returning an error if the value is invalid
+func ParseDuration(key RootKey) (time.Duration, error) {
+	return root.ParseDuration(string(key))
+}
+func (c *configSection) ParseDuration(key string) (time.Duration, error) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	fullKey := c.prefixKey(key)
+	var duration time.Duration
+	var err error
+	if unit, ok := durationUnit(fullKey); ok {
+		duration, err = parseDurationWithUnit(fullKey, unit)
+	} else {
+		var ffd fftypes.FFDuration
+		ffd, err = fftypes.ParseDurationString(viper.GetString(fullKey), time.Millisecond)
+		duration = time.Duration(ffd)
+	}
+	if err != nil {
+		return 0, i18n.WrapError(context.Background(), err, i18n.MsgInvalidConfigValue, fullKey)
+	}
+	return duration, nil
 }
 
 // GetByteSize get a size in bytes
@@ -604,6 +826,14 @@ func (c *configSection) Get(key string) interface{} {
 	return viper.Get(c.prefixKey(key))
 }
 
+// getRedacted gets the value of a fully qualified key for output, masked if the key is sensitive
+func getRedacted(key string) interface{} {
+	value := Get(RootKey(key))
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+	return redact(key, value)
+}
+
 // Set allows runtime setting of config (used in unit tests)
 func Set(key RootKey, value interface{}) {
 	root.Set(string(key), value)
@@ -696,7 +926,7 @@ func GenerateConfigMarkdown(ctx context.Context, header string, keys []string) (
 			fullKey := fmt.Sprintf("%s.%s", configObjectName, key)
 			description, fieldType := getDescriptionForConfigKey(ctx, fullKey)
 			if fieldType != i18n.IgnoredType {
-				row := fmt.Sprintf("\n|%s|%s|%s|`%v`", key, description, fieldType, Get(RootKey(fullKey)))
+				row := fmt.Sprintf("\n|%s|%s|%s|`%v`", key, description, fieldType, getRedacted(fullKey))
 				rowsInTable = append(rowsInTable, row)
 			}
 		}
@@ -713,16 +943,20 @@ func GenerateConfigMarkdown(ctx context.Context, header string, keys []string) (
 }
 
 func getDescriptionForConfigKey(ctx context.Context, key string) (string, string) {
+	description, fieldType, ok := lookupDescriptionForConfigKey(ctx, key)
+	if !ok {
+		panic(fmt.Sprintf("Translation for config key '%s' was not found", key))
+	}
+	return description, fieldType
+}
+
+func lookupDescriptionForConfigKey(ctx context.Context, key string) (string, string, bool) {
 	configDescriptionKey := "config." + key
 	description := i18n.Expand(ctx, i18n.MessageKey(configDescriptionKey))
 	fieldType, ok := i18n.GetFieldType(configDescriptionKey)
 	if description != configDescriptionKey && ok {
-		return description, fieldType
+		return description, fieldType, true
 	}
-	return getGlobalDescriptionforConfigKey(ctx, key)
-}
-
-func getGlobalDescriptionforConfigKey(ctx context.Context, key string) (string, string) {
 	// No specific description was found, look for a global
 	splitKey := strings.Split(key, ".")
 	// Walk through the key structure starting with the most specific key possible, working to the most generic
@@ -731,8 +965,8 @@ func getGlobalDescriptionforConfigKey(ctx context.Context, key string) (string,
 		description := i18n.Expand(ctx, i18n.MessageKey(configDescriptionKey))
 		fieldType, ok := i18n.GetFieldType(configDescriptionKey)
 		if description != configDescriptionKey && ok {
-			return description, fieldType
+			return description, fieldType, true
 		}
 	}
-	panic(fmt.Sprintf("Translation for config key '%s' was not found", key))
+	return "", "", false
 }
@@ -139,6 +139,73 @@ func TestGetBadDurationZero(t *testing.T) {
 	assert.Equal(t, time.Duration(0), GetDuration(key1))
 }
 
+func TestGetDurationWithUnit(t *testing.T) {
+	defer RootConfigReset()
+	key1 := AddRootKey("durationunit.key1")
+	SetDurationUnit(key1, time.Second)
+	section := RootSection("durationunit")
+	section.AddKnownKey("key2", "10s")
+	section.SetDurationUnit("key2", time.Minute)
+	array := section.SubArray("entries")
+	array.AddKnownKey("timeout")
+	array.SetDurationUnit("timeout", time.Second)
+
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+durationunit:
+  key1: 30
+  entries:
+  - timeout: 1.5
+  - timeout: 2m
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, GetDuration(key1))
+	assert.Equal(t, 10*time.Second, section.GetDuration("key2"))
+	assert.Equal(t, 1500*time.Millisecond, array.ArrayEntry(0).GetDuration("timeout"))
+	d, err := array.ArrayEntry(1).ParseDuration("timeout")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, d)
+
+	section.Set("key2", 2)
+	assert.Equal(t, 2*time.Minute, section.GetDuration("key2"))
+
+	// Both forms are strict, and report the key
+	Set(key1, -30)
+	assert.Zero(t, GetDuration(key1))
+	_, err = ParseDuration(key1)
+	assert.Regexp(t, "FF00293.*durationunit.key1.*FF00292", err)
+	Set(key1, "1m30")
+	_, err = ParseDuration(key1)
+	assert.Regexp(t, "FF00293.*durationunit.key1.*FF00291", err)
+}
+
+func TestLargeBareDuration(t *testing.T) {
+	defer RootConfigReset()
+	key1 := AddRootKey("durationunit.key1")
+	SetDurationUnit(key1, time.Second)
+	Set(key1, 30000)
+	d, err := ParseDuration(key1)
+	assert.NoError(t, err)
+	assert.Equal(t, 30000*time.Second, d)
+
+	assert.True(t, isLargeBareDuration("30000", time.Second))
+	assert.False(t, isLargeBareDuration("30", time.Second))
+	assert.False(t, isLargeBareDuration("30000ms", time.Second))
+	assert.False(t, isLargeBareDuration("30000", time.Millisecond))
+}
+
+func TestParseDurationMillisDefault(t *testing.T) {
+	defer RootConfigReset()
+	key1 := AddRootKey("key1")
+	Set(key1, "12345")
+	d, err := ParseDuration(key1)
+	assert.NoError(t, err)
+	assert.Equal(t, 12345*time.Millisecond, d)
+	Set(key1, "!a number or duration")
+	_, err = ParseDuration(key1)
+	assert.Regexp(t, "FF00293.*key1.*FF00137", err)
+}
+
 func TestPluginConfig(t *testing.T) {
 	pic := RootSection("my")
 	pic.AddKnownKey("special.config", 12345)
@@ -198,6 +265,65 @@ plugins:
 	assert.Equal(t, "defname", bobheaders.ArrayEntry(1).GetString("name"))
 }
 
+func TestArrayForEach(t *testing.T) {
+	defer RootConfigReset()
+	ctx := context.Background()
+
+	targets := RootSection("webhooks").SubArray("targets")
+	targets.AddKnownKey("url")
+	targets.AddKnownKey("timeout", "30s")
+	headers := targets.SubArray("headers")
+	headers.AddKnownKey("name")
+	headers.AddKnownKey("value", "default")
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+webhooks:
+  targets:
+  - url: http://first
+    headers:
+    - name: header1
+  - url: http://second
+    timeout: 5s
+    headers:
+    - name: header2
+      value: set
+    - value: noname
+`))
+	assert.NoError(t, err)
+
+	var urls []string
+	var timeouts []time.Duration
+	var headerValues []string
+	err = targets.ForEach(ctx, func(i int, target Section) error {
+		urls = append(urls, target.GetString("url"))
+		timeouts = append(timeouts, target.GetDuration("timeout"))
+		return target.SubArray("headers").ForEach(ctx, func(j int, header Section) error {
+			headerValues = append(headerValues, header.GetString("value"))
+			if header.GetString("name") == "" {
+				return fmt.Errorf("name missing")
+			}
+			return nil
+		})
+	})
+	assert.Regexp(t, "FF00276.*'webhooks.targets\\[1\\].headers\\[1\\]'.*name missing", err)
+	assert.NotRegexp(t, "FF00276.*FF00276", err)
+	assert.Equal(t, []string{"http://first", "http://second"}, urls)
+	assert.Equal(t, []time.Duration{30 * time.Second, 5 * time.Second}, timeouts)
+	assert.Equal(t, []string{"default", "set", "noname"}, headerValues)
+
+	err = targets.ForEach(ctx, func(i int, target Section) error {
+		if i == 0 {
+			return fmt.Errorf("pop")
+		}
+		return nil
+	})
+	assert.Regexp(t, "FF00276.*'webhooks.targets\\[0\\]'.*pop", err)
+
+	assert.NoError(t, RootArray("nonexistent").ForEach(ctx, func(i int, entry Section) error {
+		return fmt.Errorf("not called")
+	}))
+}
+
 func TestNestedArrays(t *testing.T) {
 	defer RootConfigReset()
 
@@ -408,12 +534,63 @@ func TestGetConfig(t *testing.T) {
 	assert.Equal(t, "info", conf.GetObject("log").GetString("level"))
 }
 
+func TestGetConfigSensitive(t *testing.T) {
+	RootConfigReset()
+	pluginsRoot := RootSection("sensitivetest")
+	plugins := pluginsRoot.SubArray("plugins")
+	plugins.AddKnownKey("name")
+	plugins.AddKnownKey("password")
+	plugins.MarkSensitive("password")
+	headers := pluginsRoot.SubSection("headers")
+	headers.AddKnownKey("custom")
+	pluginsRoot.MarkSensitive("headers")
+	secretKey := AddRootKey("sensitivetest.secret")
+	MarkSensitive(secretKey)
+
+	viper.SetConfigType("yaml")
+	err := viper.ReadConfig(strings.NewReader(`
+sensitivetest:
+  secret: shh
+  headers:
+    custom: token
+    other:
+      nested: token
+  plugins:
+  - name: plugin1
+    password: pass1
+  - name: plugin2
+`))
+	assert.NoError(t, err)
+
+	assert.True(t, IsSensitive("sensitivetest.secret"))
+	assert.True(t, IsSensitive("sensitiveTest.Headers.other.nested"))
+	assert.True(t, IsSensitive("sensitivetest.plugins.1.password"))
+	assert.True(t, IsSensitive("sensitivetest.plugins[].password"))
+	assert.False(t, IsSensitive("sensitivetest.plugins.1.name"))
+	assert.False(t, IsSensitive("sensitivetest.headersother"))
+
+	conf := GetRedactedConfig().GetObject("sensitivetest")
+	assert.Equal(t, RedactedValue, conf.GetString("secret"))
+	assert.Equal(t, RedactedValue, conf.GetString("headers"))
+	plugin1 := conf.GetObjectArray("plugins")[0]
+	assert.Equal(t, "plugin1", plugin1.GetString("name"))
+	assert.Equal(t, RedactedValue, plugin1.GetString("password"))
+	_, hasPassword := conf.GetObjectArray("plugins")[1]["password"]
+	assert.False(t, hasPassword)
+
+	// The values themselves are unaffected
+	assert.Equal(t, "shh", GetConfig().GetObject("sensitivetest").GetString("secret"))
+	assert.Equal(t, "shh", GetString(secretKey))
+	assert.Equal(t, "pass1", plugins.ArrayEntry(0).GetString("password"))
+}
+
 func TestGenerateConfigMarkdown(t *testing.T) {
 
 	key1 := AddRootKey("level1_1.level2_1.level3_1")
 	key2 := AddRootKey("level1_1.level2_1.level3_2")
 	key3 := AddRootKey("level1_1.level2_2.level3")
 	key4 := AddRootKey("level1_2.level2.level3")
+	MarkSensitive(key4)
 
 	i18n.FFC(language.AmericanEnglish, fmt.Sprintf("config.%s", key1), "Description 1", "Type 1")
 	i18n.FFC(language.AmericanEnglish, fmt.Sprintf("config.%s", key2), "Description 2", "Type 2")
@@ -427,10 +604,12 @@ func TestGenerateConfigMarkdown(t *testing.T) {
 		viper.SetDefault(string(key4), "val4")
 	})
 
-	_, err := GenerateConfigMarkdown(context.Background(), "", []string{
+	md, err := GenerateConfigMarkdown(context.Background(), "", []string{
 		string(key1), string(key2), string(key3), string(key4),
 	})
 	assert.NoError(t, err)
+	assert.Contains(t, string(md), "|level3|Description 4|Type 4|`***`")
+	assert.NotContains(t, string(md), "val4")
 
 }
 
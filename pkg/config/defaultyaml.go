@@ -0,0 +1,155 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+type yamlNode struct {
+	name     string
+	key      string // set for leaf keys
+	isArray  bool
+	children map[string]*yamlNode
+}
+
+func (n *yamlNode) child(name string) *yamlNode {
+	c := n.children[name]
+	if c == nil {
+		c = &yamlNode{name: name, children: map[string]*yamlNode{}}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *yamlNode) sortedChildren() []*yamlNode {
+	children := make([]*yamlNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].name < children[j].name })
+	return children
+}
+
+// hasDefaults is true if any key in this subtree has a default value, so will not be commented out
+func (n *yamlNode) hasDefaults() bool {
+	if n.isArray {
+		return false
+	}
+	if n.key != "" {
+		return Get(RootKey(n.key)) != nil
+	}
+	for _, c := range n.children {
+		if c.hasDefaults() {
+			return true
+		}
+	}
+	return false
+}
+
+type yamlWriter struct {
+	ctx context.Context
+	b   *bytes.Buffer
+}
+
+func (yw *yamlWriter) line(indent int, commented bool, text string) {
+	yw.b.WriteString(strings.Repeat("  ", indent))
+	if commented {
+		yw.b.WriteString("# ")
+	}
+	yw.b.WriteString(text)
+	yw.b.WriteString("\n")
+}
+
+func (yw *yamlWriter) writeLeaf(n *yamlNode, indent int, commented bool, itemPrefix string) {
+	description, fieldType, ok := lookupDescriptionForConfigKey(yw.ctx, n.key)
+	if ok && fieldType == i18n.IgnoredType {
+		return
+	}
+	comment := n.key
+	if ok {
+		comment = fmt.Sprintf("%s - %s", n.key, description)
+	}
+	for _, l := range strings.Split(comment, "\n") {
+		yw.line(indent, true, l)
+	}
+	value := Get(RootKey(n.key))
+	if value == nil {
+		yw.line(indent, true, fmt.Sprintf("%s%s:", itemPrefix, n.name))
+		return
+	}
+	if IsSensitive(n.key) {
+		// The masked value must not be loaded back as the real value
+		commented = true
+		value = RedactedValue
+	}
+	// JSON is valid YAML, and unambiguously quotes strings that YAML might otherwise re-type
+	b, _ := json.Marshal(value)
+	yw.line(indent, commented, fmt.Sprintf("%s%s: %s", itemPrefix, n.name, b))
+}
+
+func (yw *yamlWriter) writeNodes(nodes []*yamlNode, indent int, commented bool, firstItemPrefix string) {
+	itemPrefix := firstItemPrefix
+	for _, n := range nodes {
+		switch {
+		case n.key != "":
+			yw.writeLeaf(n, indent, commented, itemPrefix)
+		case n.isArray:
+			// Arrays have no defaults, so an example entry is written commented out
+			yw.line(indent, true, fmt.Sprintf("%s%s:", itemPrefix, n.name))
+			yw.writeNodes(n.sortedChildren(), indent+1, true, "- ")
+		default:
+			childCommented := commented || !n.hasDefaults()
+			yw.line(indent, childCommented, fmt.Sprintf("%s%s:", itemPrefix, n.name))
+			yw.writeNodes(n.sortedChildren(), indent+1, childCommented, "")
+		}
+		if itemPrefix != "" {
+			// Subsequent keys in an array entry align with the first
+			itemPrefix = ""
+			indent++
+		}
+	}
+}
+
+// GenerateDefaultYAML writes a sample YAML configuration file, containing every registered
+// key with its default value, and its description as a comment. Keys without a default
+// (and arrays) are included commented out, so the output can be loaded back as-is.
+func GenerateDefaultYAML(w io.Writer) error {
+	root := &yamlNode{children: map[string]*yamlNode{}}
+	for _, key := range GetKnownKeys() {
+		n := root
+		for _, segment := range strings.Split(key, ".") {
+			isArray := strings.HasSuffix(segment, "[]")
+			n = n.child(strings.TrimSuffix(segment, "[]"))
+			n.isArray = n.isArray || isArray
+		}
+		n.key = key
+	}
+
+	yw := &yamlWriter{ctx: context.Background(), b: &bytes.Buffer{}}
+	yw.writeNodes(root.sortedChildren(), 0, false, "")
+	_, err := w.Write(yw.b.Bytes())
+	return err
+}
@@ -0,0 +1,108 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestGenerateDefaultYAMLRoundTrip(t *testing.T) {
+	i18n.FFC(language.AmericanEnglish, "config.yamltest.str", "A string\nover two lines", i18n.StringType)
+	i18n.FFC(language.AmericanEnglish, "config.yamltest.sub.int", "An int", i18n.IntType)
+	i18n.FFC(language.AmericanEnglish, "config.global.ignoreme", "Ignored", i18n.IgnoredType)
+
+	RootConfigReset()
+	conf := RootSection("yamltest")
+	conf.AddKnownKey("str", "yes")
+	conf.AddKnownKey("ignoreme", "ignored")
+	conf.AddKnownKey("nodefault")
+	conf.AddKnownKey("list", "a", "b")
+	conf.AddKnownKey("obj", map[string]interface{}{"k": "v"})
+	conf.AddKnownKey("secret", "changeme")
+	conf.MarkSensitive("secret")
+	conf.SubSection("sub").AddKnownKey("int", 12345)
+	conf.SubSection("empty").AddKnownKey("nodefault")
+	arr := conf.SubArray("arr")
+	arr.AddKnownKey("name")
+	arr.AddKnownKey("enabled", true)
+	arr.SubSection("nested").AddKnownKey("val")
+
+	b := &bytes.Buffer{}
+	err := GenerateDefaultYAML(b)
+	assert.NoError(t, err)
+	yaml := b.String()
+	assert.Contains(t, yaml, `yamltest:
+  # arr:
+    # yamltest.arr[].enabled
+    # - enabled:
+      # yamltest.arr[].name
+      # name:
+      # nested:
+        # yamltest.arr[].nested.val
+        # val:
+`)
+	assert.Contains(t, yaml, `  # yamltest.str - A string
+  # over two lines
+  str: "yes"
+`)
+	assert.Contains(t, yaml, `  # empty:
+    # yamltest.empty.nodefault
+    # nodefault:
+`)
+	assert.Contains(t, yaml, `  sub:
+    # yamltest.sub.int - An int
+    int: 12345
+`)
+	assert.Contains(t, yaml, `  list: ["a","b"]`)
+	assert.NotContains(t, yaml, `ignoreme`)
+	assert.Contains(t, yaml, `  # secret: "***"`)
+	assert.NotContains(t, yaml, `changeme`)
+
+	// Write it out, and load it back
+	cfgFile := path.Join(t.TempDir(), "default.yaml")
+	err = os.WriteFile(cfgFile, b.Bytes(), 0664)
+	assert.NoError(t, err)
+	RootConfigReset()
+	err = ReadConfig("yamltest", cfgFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "yes", conf.GetString("str"))
+	assert.Equal(t, 12345, conf.GetInt("sub.int"))
+	assert.Equal(t, []string{"a", "b"}, conf.GetStringSlice("list"))
+	assert.Equal(t, "v", conf.GetObject("obj").GetString("k"))
+	assert.Equal(t, "info", GetString(LogLevel))
+	assert.Equal(t, 0, arr.ArraySize())
+	assert.Empty(t, conf.GetString("nodefault"))
+	assert.Empty(t, conf.GetString("secret")) // the masked value is not loaded back
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, fmt.Errorf("pop") }
+
+func TestGenerateDefaultYAMLWriteFail(t *testing.T) {
+	RootConfigReset()
+	err := GenerateDefaultYAML(errWriter{})
+	assert.Regexp(t, "pop", err)
+}
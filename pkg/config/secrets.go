@@ -0,0 +1,166 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/spf13/viper"
+)
+
+// SecretResolver resolves a reference to a secret held outside of the configuration,
+// such as `{{file:/run/secrets/db}}` where the provider is "file" and the reference is "/run/secrets/db"
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref string) (string, error)
+}
+
+// SecretResolverFunc allows a function to be used as a SecretResolver
+type SecretResolverFunc func(ctx context.Context, ref string) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+var secretRefRegexp = regexp.MustCompile(`\{\{([a-zA-Z0-9_-]+):([^}]*)\}\}`)
+
+var secretResolvers = map[string]SecretResolver{
+	"file": SecretResolverFunc(resolveFileSecret),
+	"env":  SecretResolverFunc(resolveEnvSecret),
+}
+
+// RegisterSecretResolver adds (or replaces) the resolver for secret references using the given provider name.
+// The "file" and "env" providers are built in.
+func RegisterSecretResolver(provider string, resolver SecretResolver) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	secretResolvers[provider] = resolver
+}
+
+// resolveFileSecret reads the secret from a file, such as those mounted by Docker and Kubernetes,
+// ignoring any trailing newline
+func resolveFileSecret(_ context.Context, ref string) (string, error) {
+	b, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+func resolveEnvSecret(_ context.Context, ref string) (string, error) {
+	v, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable not set")
+	}
+	return v, nil
+}
+
+// Resolved secrets, keyed by the raw configuration value containing the references, so that changes
+// to the raw value (such as reloading the configuration) are always reflected
+var resolvedSecrets = map[string]resolvedSecret{}
+
+type resolvedSecret struct {
+	secret     string
+	resolvedAt time.Time
+}
+
+// How long a resolved secret is used before it is resolved again, with zero meaning until the configuration is reloaded
+var secretCacheTTL time.Duration
+
+// SetSecretCacheTTL sets how long a resolved secret is used before it is resolved again on the next read,
+// so that secrets rotated outside of the configuration are picked up. Zero (the default) only resolves
+// secrets when the configuration is loaded, or a value set afterwards is first read.
+// If a secret cannot be resolved again, the last resolved secret continues to be used.
+func SetSecretCacheTTL(ttl time.Duration) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	secretCacheTTL = ttl
+}
+
+func resolveSecretRefs(ctx context.Context, key, value string) (string, error) {
+	var resolveErr error
+	resolved := secretRefRegexp.ReplaceAllStringFunc(value, func(ref string) string {
+		match := secretRefRegexp.FindStringSubmatch(ref)
+		provider, secretRef := match[1], match[2]
+		resolver, ok := secretResolvers[provider]
+		if !ok {
+			resolveErr = i18n.NewError(ctx, i18n.MsgConfigSecretProviderUnknown, provider, key)
+			return ref
+		}
+		secret, err := resolver.ResolveSecret(ctx, secretRef)
+		if err != nil {
+			resolveErr = i18n.NewError(ctx, i18n.MsgConfigSecretUnresolved, provider, secretRef, key, err)
+			return ref
+		}
+		return secret
+	})
+	return resolved, resolveErr
+}
+
+// resolveSecrets resolves the secret references in every string value in the configuration,
+// so that any that cannot be resolved are reported when the configuration is loaded.
+// Caller responsible for holding lock when calling
+func resolveSecrets(ctx context.Context) error {
+	resolved := make(map[string]resolvedSecret)
+	for _, key := range viper.AllKeys() {
+		value, isString := viper.Get(key).(string)
+		if !isString || !secretRefRegexp.MatchString(value) {
+			continue
+		}
+		secret, err := resolveSecretRefs(ctx, key, value)
+		if err != nil {
+			return err
+		}
+		resolved[value] = resolvedSecret{secret: secret, resolvedAt: time.Now()}
+	}
+	resolvedSecrets = resolved
+	return nil
+}
+
+// getResolvedString returns a string configuration value, with any secret references resolved.
+// Values set after the configuration was loaded are resolved on first use, and all values are
+// resolved again once they are older than the secret cache TTL.
+// Caller responsible for holding lock when calling
+func getResolvedString(key string) string {
+	value := viper.GetString(key)
+	cached, isCached := resolvedSecrets[value]
+	if isCached && (secretCacheTTL <= 0 || time.Since(cached.resolvedAt) < secretCacheTTL) {
+		return cached.secret
+	}
+	if !isCached && !secretRefRegexp.MatchString(value) {
+		return value
+	}
+	secret, err := resolveSecretRefs(context.Background(), key, value)
+	if err != nil {
+		log.L(context.Background()).Errorf("%s", err)
+		if !isCached {
+			return value
+		}
+		// Keep using the last resolved secret, until the next attempt after the TTL
+		secret = cached.secret
+	}
+	resolvedSecrets[value] = resolvedSecret{secret: secret, resolvedAt: time.Now()}
+	return secret
+}
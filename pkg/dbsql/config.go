@@ -37,10 +37,22 @@ const (
 	SQLConfMaxIdleConns = "maxIdleConns"
 	// SQLConfMaxConnLifetime maximum connections to the database
 	SQLConfMaxConnLifetime = "maxConnLifetime"
+	// SQLConfStatementTimeout the maximum time any individual statement can run for, which can be overridden per call with WithStatementTimeout
+	SQLConfStatementTimeout = "statementTimeout"
+	// SQLConfSlowQueryThreshold statements that take longer than this are logged at warn level
+	SQLConfSlowQueryThreshold = "slowQueryThreshold"
+	// SQLConfHealthCheckTimeout the maximum time the lightweight query run by Health can take
+	SQLConfHealthCheckTimeout = "healthCheckTimeout"
+	// SQLConfCountCacheTTL if set, exact counts are cached for this long - keyed by the query - so are not re-run on each page of results
+	SQLConfCountCacheTTL = "countCache.ttl"
+	// SQLConfCountCacheSize the maximum number of counts held in the count cache
+	SQLConfCountCacheSize = "countCache.size"
 )
 
 const (
 	defaultMigrationsDirectoryTemplate = "./db/migrations/%s"
+	defaultHealthCheckTimeout          = "5s"
+	defaultCountCacheSize              = 1000
 )
 
 func (s *Database) InitConfig(provider Provider, config config.Section) {
@@ -51,4 +63,9 @@ func (s *Database) InitConfig(provider Provider, config config.Section) {
 	config.AddKnownKey(SQLConfMaxConnIdleTime, "1m")
 	config.AddKnownKey(SQLConfMaxIdleConns) // defaults to the max connections
 	config.AddKnownKey(SQLConfMaxConnLifetime)
+	config.AddKnownKey(SQLConfStatementTimeout)   // unlimited by default
+	config.AddKnownKey(SQLConfSlowQueryThreshold) // disabled by default
+	config.AddKnownKey(SQLConfHealthCheckTimeout, defaultHealthCheckTimeout)
+	config.AddKnownKey(SQLConfCountCacheTTL) // disabled by default
+	config.AddKnownKey(SQLConfCountCacheSize, defaultCountCacheSize)
 }
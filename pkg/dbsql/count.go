@@ -0,0 +1,149 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// PostgresCountEstimate uses EXPLAIN to return the planner's estimate of the rows a query returns, in JSON
+func PostgresCountEstimate(selectQuery string) string {
+	return "EXPLAIN (FORMAT JSON) " + selectQuery
+}
+
+type postgresExplainPlan []struct {
+	Plan struct {
+		PlanRows float64 `json:"Plan Rows"`
+	} `json:"Plan"`
+}
+
+// countCache holds exact counts for a short TTL, keyed by the table and the SQL of the count query
+type countCache struct {
+	mux     sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	entries map[string]*countCacheEntry
+}
+
+type countCacheEntry struct {
+	count   int64
+	expires time.Time
+}
+
+func newCountCache(ttl time.Duration, maxSize int) *countCache {
+	if ttl <= 0 || maxSize <= 0 {
+		return nil
+	}
+	return &countCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[string]*countCacheEntry),
+	}
+}
+
+func countCacheKey(table, sqlQuery string, args []interface{}) string {
+	return fmt.Sprintf("%s|%s|%v", table, sqlQuery, args)
+}
+
+func (cc *countCache) get(key string) (int64, bool) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	entry := cc.entries[key]
+	if entry == nil || time.Now().After(entry.expires) {
+		delete(cc.entries, key)
+		return -1, false
+	}
+	return entry.count, true
+}
+
+func (cc *countCache) set(key string, count int64) {
+	cc.mux.Lock()
+	defer cc.mux.Unlock()
+	now := time.Now()
+	if len(cc.entries) >= cc.maxSize {
+		for k, entry := range cc.entries {
+			if now.After(entry.expires) {
+				delete(cc.entries, k)
+			}
+		}
+		if len(cc.entries) >= cc.maxSize {
+			// all current, so start again rather than tracking usage
+			cc.entries = make(map[string]*countCacheEntry)
+		}
+	}
+	cc.entries[key] = &countCacheEntry{count: count, expires: now.Add(cc.ttl)}
+}
+
+// EstimateCountQuery returns an estimate of the rows matching the query, where the provider supports it with
+// SQLFeatures.CountEstimate. Otherwise, or if there is a countExpr, the exact count is returned.
+func (s *Database) EstimateCountQuery(ctx context.Context, table string, tx *TXWrapper, fop sq.Sqlizer, qm QueryModifier, countExpr string) (count int64, approximate bool, err error) {
+	if s.features.CountEstimate == nil || (countExpr != "" && countExpr != "*") {
+		count, err = s.CountQuery(ctx, table, tx, fop, qm, countExpr)
+		return count, false, err
+	}
+	count = -1
+	l := log.L(ctx)
+	if tx == nil {
+		tx = GetTXFromContext(ctx)
+	}
+	q := sq.Select("*").From(table).Where(fop)
+	if qm != nil {
+		if q, err = qm(q); err != nil {
+			return count, false, err
+		}
+	}
+	selectQuery, args, err := q.PlaceholderFormat(s.features.PlaceholderFormat).ToSql()
+	if err != nil {
+		return count, false, i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
+	}
+	sqlQuery := s.features.CountEstimate(selectQuery)
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return count, false, err
+	}
+	defer cancel()
+	before := time.Now()
+	l.Tracef(`SQL-> count estimate: %s (args: %+v)`, sqlQuery, args)
+	var row *sql.Row
+	if tx != nil {
+		row = tx.sqlTX.QueryRowContext(stmtCtx, sqlQuery, args...)
+	} else {
+		row = s.db.QueryRowContext(stmtCtx, sqlQuery, args...)
+	}
+	s.logIfSlow(ctx, "count estimate", table, sqlQuery, before)
+	var planJSON []byte
+	if err = row.Scan(&planJSON); err != nil {
+		l.Errorf(`SQL count estimate failed: %s sql=[ %s ]`, err, sqlQuery)
+		return count, false, i18n.WrapError(ctx, err, i18n.MsgDBQueryFailed)
+	}
+	var plan postgresExplainPlan
+	if err = json.Unmarshal(planJSON, &plan); err != nil || len(plan) == 0 {
+		return count, false, i18n.WrapError(ctx, err, i18n.MsgDBReadErr, table)
+	}
+	count = int64(plan[0].Plan.PlanRows)
+	l.Debugf(`SQL<- count estimate %s: %d (%.2fms)`, table, count, floatMillisSince(before))
+	return count, true, nil
+}
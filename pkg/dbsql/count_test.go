@@ -0,0 +1,197 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryResApproximate(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery(`^EXPLAIN \(FORMAT JSON\) SELECT \* FROM table1 WHERE col1 = \$1`).
+		WithArgs("val1").
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan":{"Node Type":"Seq Scan","Plan Rows":12345}}]`))
+	res := s.QueryRes(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, &ffapi.FilterInfo{
+		Count:       true,
+		Approximate: true,
+	})
+	assert.Equal(t, int64(12345), *res.TotalCount)
+	assert.True(t, res.Approximate)
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestQueryResApproximateUnsupported(t *testing.T) {
+	s, mdb := NewMockProvider().UTInit()
+	mdb.ExpectQuery(`^SELECT COUNT\(\*\)`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	res := s.QueryRes(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, &ffapi.FilterInfo{
+		Count:       true,
+		Approximate: true,
+	})
+	assert.Equal(t, int64(10), *res.TotalCount)
+	assert.False(t, res.Approximate)
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestQueryResApproximateSwallowError(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery(`^EXPLAIN`).WillReturnError(fmt.Errorf("pop"))
+	res := s.QueryRes(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, &ffapi.FilterInfo{
+		Count:       true,
+		Approximate: true,
+	})
+	assert.Equal(t, int64(-1), *res.TotalCount)
+	assert.False(t, res.Approximate)
+}
+
+func TestEstimateCountQueryWithExprIsExact(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery(`^SELECT COUNT\(DISTINCT key\)`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	count, approximate, err := s.EstimateCountQuery(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, "DISTINCT key")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), count)
+	assert.False(t, approximate)
+}
+
+func TestEstimateCountQueryInTx(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, mdb := mp.UTInit()
+	mdb.ExpectBegin()
+	mdb.ExpectQuery(`^EXPLAIN \(FORMAT JSON\) SELECT \* FROM table1 WHERE col1 = \$1 AND col2 = \$2`).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan":{"Plan Rows":5}}]`))
+	ctx, tx, _, err := s.BeginOrUseTx(context.Background())
+	assert.NoError(t, err)
+	qm := func(sb sq.SelectBuilder) (sq.SelectBuilder, error) {
+		return sb.Where(sq.Eq{"col2": "val2"}), nil
+	}
+	count, approximate, err := s.EstimateCountQuery(ctx, "table1", tx, sq.Eq{"col1": "val1"}, qm, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+	assert.True(t, approximate)
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestEstimateCountQueryBadPlan(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery(`^EXPLAIN`).WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[]`))
+	_, _, err := s.EstimateCountQuery(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, "")
+	assert.Regexp(t, "FF00182", err)
+}
+
+func TestEstimateCountQueryBadSQL(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, _ := mp.UTInit()
+	_, _, err := s.EstimateCountQuery(context.Background(), "table1", nil, sq.Insert("wrong"), nil, "")
+	assert.Regexp(t, "FF00174", err)
+}
+
+func TestEstimateCountQueryModifierErr(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	s, _ := mp.UTInit()
+	qm := func(sb sq.SelectBuilder) (sq.SelectBuilder, error) {
+		return sb, fmt.Errorf("pop")
+	}
+	_, _, err := s.EstimateCountQuery(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, qm, "")
+	assert.Regexp(t, "pop", err)
+}
+
+func TestEstimateCountQueryStatementTimeoutFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.CountEstimate = true
+	mp.StatementTimeout = true
+	mp.config.Set(SQLConfStatementTimeout, "5s")
+	s, mdb := mp.UTInit()
+	mdb.ExpectBegin()
+	mdb.ExpectExec("SET LOCAL statement_timeout").WillReturnError(fmt.Errorf("pop"))
+	ctx, tx, _, err := s.BeginOrUseTx(context.Background())
+	assert.NoError(t, err)
+	_, _, err = s.EstimateCountQuery(ctx, "table1", tx, sq.Eq{"col1": "val1"}, nil, "")
+	assert.Regexp(t, "FF00176.*pop", err)
+}
+
+func TestCountQueryCached(t *testing.T) {
+	mp := NewMockProvider()
+	mp.config.Set(SQLConfCountCacheTTL, "1m")
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery(`^SELECT COUNT\(\*\)`).WithArgs("val1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mdb.ExpectQuery(`^SELECT COUNT\(\*\)`).WithArgs("val2").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(20))
+	mdb.ExpectBegin()
+	mdb.ExpectQuery(`^SELECT COUNT\(\*\)`).WithArgs("val1").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		count, err := s.CountQuery(ctx, "table1", nil, sq.Eq{"col1": "val1"}, nil, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), count)
+	}
+	count, err := s.CountQuery(ctx, "table1", nil, sq.Eq{"col1": "val2"}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), count)
+
+	// counts in a transaction are never cached
+	ctx, tx, _, err := s.BeginOrUseTx(ctx)
+	assert.NoError(t, err)
+	count, err = s.CountQuery(ctx, "table1", tx, sq.Eq{"col1": "val1"}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), count)
+
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestCountCacheExpiryAndSize(t *testing.T) {
+	assert.Nil(t, newCountCache(0, 10))
+
+	cc := newCountCache(1*time.Minute, 2)
+	cc.set("a", 1)
+	cc.set("b", 2)
+	cc.entries["b"].expires = time.Now().Add(-1 * time.Second)
+	_, ok := cc.get("b")
+	assert.False(t, ok)
+
+	// an expired entry is pruned to make space
+	cc.set("b", 2)
+	cc.entries["b"].expires = time.Now().Add(-1 * time.Second)
+	cc.set("c", 3)
+	assert.Len(t, cc.entries, 2)
+	count, ok := cc.get("a")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), count)
+
+	// when all are current, the cache is cleared
+	cc.set("d", 4)
+	assert.Len(t, cc.entries, 1)
+	_, ok = cc.get("a")
+	assert.False(t, ok)
+}
@@ -21,6 +21,7 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
@@ -99,6 +100,7 @@ type CRUDQuery[T Resource] interface {
 	GetSequenceForID(ctx context.Context, id string) (seq int64, err error)
 	GetMany(ctx context.Context, filter ffapi.Filter) (instances []T, fr *ffapi.FilterResult, err error)
 	Count(ctx context.Context, filter ffapi.Filter) (count int64, err error)
+	CountBy(ctx context.Context, filter ffapi.Filter, groupColumn string) (counts map[string]int64, err error)
 	ModifyQuery(modifier QueryModifier) CRUDQuery[T]
 }
 
@@ -126,12 +128,14 @@ type CrudBase[T Resource] struct {
 	Columns          []string
 	FilterFieldMap   map[string]string
 	TimesDisabled    bool // no management of the time columns
+	DBTimestamps     bool // the time columns are set from the clock of the database rather than each instance (requires the CurrentTimestamp feature), and read back on write
 	PatchDisabled    bool // allows non-pointer fields, but prevents UpdateSparse function
 	ImmutableColumns []string
 	NameField        string                                        // If supporting name semantics
 	QueryFactory     ffapi.QueryFactory                            // Must be set when name is set
 	DefaultSort      func() []interface{}                          // optionally override the default sort - array of *ffapi.SortField or string
 	IDValidator      func(ctx context.Context, idStr string) error // if IDs must conform to a pattern, such as a UUID (prebuilt UUIDValidator provided for that)
+	IDType           IDType                                        // the type the ID is bound as in queries, to match the type of the id column (default string)
 
 	NilValue     func() T // nil value typed to T
 	NewInstance  func() T
@@ -143,6 +147,16 @@ type CrudBase[T Resource] struct {
 	ReadTableAlias    string
 	ReadOnlyColumns   []string
 	ReadQueryModifier QueryModifier
+
+	// ContextScope derives mandatory predicates from the context, such as the tenant of the request, that are
+	// applied to every read, update and delete - and set into the matching columns of every insert, overriding
+	// the value in the instance. Returning an error, or an empty scope, fails the operation.
+	ContextScope func(ctx context.Context) (sq.Eq, error)
+
+	// NotifyChanges publishes the change events of each Insert, Upsert, Replace, UpdateSparse and Delete to
+	// the other instances sharing the database, where it has the NotifyChange feature (see Database.ListenChanges).
+	// As with the EventHandler, filter based updates and deletes do not publish change events.
+	NotifyChanges bool
 }
 
 func (c *CrudBase[T]) Scoped(scope sq.Eq) CRUD[T] {
@@ -184,6 +198,39 @@ func (c *CrudBase[T]) ModifyQuery(newModifier QueryModifier) CRUDQuery[T] {
 	return &cModified
 }
 
+// IDType is the type of the id column of a collection, which determines how IDs are bound in the queries
+// generated for GetByID, Delete and updates. Binding the same type as the column avoids implicit casts
+// in the comparison, which can prevent the database using the index on the column.
+type IDType int
+
+const (
+	// IDTypeString binds the ID as a string (the default)
+	IDTypeString IDType = iota
+	// IDTypeUUID parses the ID and binds it as a UUID
+	IDTypeUUID
+	// IDTypeInt64 parses the ID and binds it as an int64
+	IDTypeInt64
+)
+
+func (t IDType) bindValue(ctx context.Context, id string) (interface{}, error) {
+	switch t {
+	case IDTypeUUID:
+		u, err := fftypes.ParseUUID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	case IDTypeInt64:
+		i, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, i18n.NewError(ctx, i18n.MsgDBInvalidInt64ID, id)
+		}
+		return i, nil
+	default:
+		return id, nil
+	}
+}
+
 func UUIDValidator(ctx context.Context, idStr string) error {
 	_, err := fftypes.ParseUUID(ctx, idStr)
 	return err
@@ -244,22 +291,107 @@ func (c *CrudBase[T]) Validate() {
 	}
 }
 
-func (c *CrudBase[T]) idFilter(id string) sq.Eq {
-	var filter sq.Eq
-	if c.ScopedFilter != nil {
-		filter = c.ScopedFilter()
-	} else {
+func (c *CrudBase[T]) idFilter(ctx context.Context, id string) (sq.Eq, error) {
+	idValue, err := c.IDType.bindValue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := c.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if filter == nil {
 		filter = sq.Eq{}
 	}
 	if c.ReadTableAlias != "" {
-		filter[fmt.Sprintf("%s.id", c.ReadTableAlias)] = id
+		filter[fmt.Sprintf("%s.id", c.ReadTableAlias)] = idValue
 	} else {
-		filter["id"] = id
+		filter["id"] = idValue
+	}
+	return filter, nil
+}
+
+// contextScope returns the predicates derived from the context by the ContextScope hook, if set
+func (c *CrudBase[T]) contextScope(ctx context.Context) (sq.Eq, error) {
+	if c.ContextScope == nil {
+		return nil, nil
+	}
+	scope, err := c.ContextScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(scope) == 0 {
+		return nil, i18n.NewError(ctx, i18n.MsgDBMissingContextScope, c.Table)
+	}
+	return scope, nil
+}
+
+// scope returns the predicates every query must match, combining the ScopedFilter and ContextScope (nil if neither is set)
+func (c *CrudBase[T]) scope(ctx context.Context) (sq.Eq, error) {
+	if c.ScopedFilter == nil && c.ContextScope == nil {
+		return nil, nil
+	}
+	scope := sq.Eq{}
+	if c.ScopedFilter != nil {
+		for k, v := range c.ScopedFilter() {
+			scope[k] = v
+		}
+	}
+	ctxScope, err := c.contextScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ctxScope {
+		scope[k] = v
+	}
+	return scope, nil
+}
+
+// scopeColumn returns the column a ContextScope predicate applies to, without any table alias
+func (c *CrudBase[T]) scopeColumn(key string) string {
+	if c.ReadTableAlias != "" {
+		return strings.TrimPrefix(key, c.ReadTableAlias+".")
+	}
+	return key
+}
+
+// now returns the value to write to a time column, which is an expression evaluated by the database with DBTimestamps
+func (c *CrudBase[T]) now(ctx context.Context) (interface{}, error) {
+	if !c.DBTimestamps {
+		return fftypes.Now(), nil
+	}
+	currentTimestamp := c.DB.Features().CurrentTimestamp
+	if currentTimestamp == "" {
+		return nil, i18n.NewError(ctx, i18n.MsgDBTimestampsUnsupported, c.Table, c.DB.provider.Name())
+	}
+	return sq.Expr(currentTimestamp), nil
+}
+
+// readTimestamps reads back the time columns set by the database with DBTimestamps, within the
+// transaction of the write, so the instance has the values that are committed
+func (c *CrudBase[T]) readTimestamps(ctx context.Context, tx *TXWrapper, inst T) error {
+	if !c.DBTimestamps {
+		return nil
 	}
-	return filter
+	idFilter, err := c.idFilter(ctx, inst.GetID())
+	if err != nil {
+		return err
+	}
+	rows, _, err := c.DB.QueryTx(ctx, c.Table, tx, sq.Select(ColumnCreated, ColumnUpdated).From(c.Table).Where(idFilter))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return i18n.NewError(ctx, i18n.MsgDBNoRowsAffected)
+	}
+	if err := rows.Scan(c.GetFieldPtr(inst, ColumnCreated), c.GetFieldPtr(inst, ColumnUpdated)); err != nil {
+		return i18n.WrapError(ctx, err, i18n.MsgDBReadErr, c.Table)
+	}
+	return nil
 }
 
-func (c *CrudBase[T]) buildUpdateList(_ context.Context, update sq.UpdateBuilder, inst T, includeNil bool) sq.UpdateBuilder {
+func (c *CrudBase[T]) buildUpdateList(_ context.Context, update sq.UpdateBuilder, inst T, includeNil bool, now interface{}, ctxScope sq.Eq) sq.UpdateBuilder {
 colLoop:
 	for _, col := range c.Columns {
 		for _, immutable := range append(c.ImmutableColumns, ColumnID, ColumnCreated, ColumnUpdated, c.DB.sequenceColumn) {
@@ -267,31 +399,67 @@ colLoop:
 				continue colLoop
 			}
 		}
+		// The scope columns of a row cannot be changed, as the update must match them
+		for key := range ctxScope {
+			if col == c.scopeColumn(key) {
+				continue colLoop
+			}
+		}
 		value := c.getFieldValue(inst, col)
 		if includeNil || !isNil(value) {
 			update = update.Set(col, value)
 		}
 	}
 	if !c.TimesDisabled {
-		update = update.Set(ColumnUpdated, fftypes.Now())
+		update = update.Set(ColumnUpdated, now)
 	}
 	return update
 }
 
 func (c *CrudBase[T]) updateFromInstance(ctx context.Context, tx *TXWrapper, inst T, includeNil bool) (int64, error) {
 	update := sq.Update(c.Table)
+	var now interface{}
 	if !c.TimesDisabled {
-		inst.SetUpdated(fftypes.Now())
+		var err error
+		if now, err = c.now(ctx); err != nil {
+			return -1, err
+		}
+		if !c.DBTimestamps {
+			inst.SetUpdated(now.(*fftypes.FFTime))
+		}
 	}
-	update = c.buildUpdateList(ctx, update, inst, includeNil)
-	update = update.Where(c.idFilter(inst.GetID()))
-	return c.DB.UpdateTx(ctx, c.Table, tx,
+	ctxScope, err := c.contextScope(ctx)
+	if err != nil {
+		return -1, err
+	}
+	update = c.buildUpdateList(ctx, update, inst, includeNil, now, ctxScope)
+	idFilter, err := c.idFilter(ctx, inst.GetID())
+	if err != nil {
+		return -1, err
+	}
+	update = update.Where(idFilter)
+	rowsAffected, err := c.DB.UpdateTx(ctx, c.Table, tx,
 		update,
 		func() {
 			if c.EventHandler != nil {
 				c.EventHandler(inst.GetID(), Updated)
 			}
 		})
+	if err == nil && rowsAffected > 0 {
+		err = c.notifyChange(ctx, tx, inst.GetID(), Updated)
+	}
+	if err == nil && rowsAffected > 0 {
+		err = c.readTimestamps(ctx, tx, inst)
+	}
+	return rowsAffected, err
+}
+
+// notifyChange publishes the change event to other instances, if enabled for the collection
+func (c *CrudBase[T]) notifyChange(ctx context.Context, tx *TXWrapper, id string, eventType ChangeEventType) error {
+	if !c.NotifyChanges {
+		return nil
+	}
+	return c.DB.NotifyChangeTx(ctx, tx, c.Table, id, eventType)
 }
 
 func (c *CrudBase[T]) getFieldValue(inst T, col string) interface{} {
@@ -315,12 +483,42 @@ func (c *CrudBase[T]) getFieldValue(inst T, col string) interface{} {
 	return val
 }
 
-func (c *CrudBase[T]) setInsertTimestamps(inst T) {
+// insertValues sets the time columns of the instance, and returns the values to insert - with the values of the
+// ContextScope in place of those of the instance
+func (c *CrudBase[T]) insertValues(ctx context.Context, inst T) ([]interface{}, error) {
+	ctxScope, err := c.contextScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var now interface{}
 	if !c.TimesDisabled {
-		now := fftypes.Now()
-		inst.SetCreated(now)
-		inst.SetUpdated(now)
+		if now, err = c.now(ctx); err != nil {
+			return nil, err
+		}
+		if !c.DBTimestamps {
+			inst.SetCreated(now.(*fftypes.FFTime))
+			inst.SetUpdated(now.(*fftypes.FFTime))
+		}
 	}
+	values := make([]interface{}, len(c.Columns))
+	for i, col := range c.Columns {
+		if c.DBTimestamps && (col == ColumnCreated || col == ColumnUpdated) {
+			values[i] = now
+		} else {
+			values[i] = c.getFieldValue(inst, col)
+		}
+	}
+scopeLoop:
+	for key, value := range ctxScope {
+		for i, col := range c.Columns {
+			if col == c.scopeColumn(key) {
+				values[i] = value
+				continue scopeLoop
+			}
+		}
+		return nil, i18n.NewError(ctx, i18n.MsgDBContextScopeColumn, key, c.Table)
+	}
+	return values, nil
 }
 
 func (c *CrudBase[T]) attemptSetSequence(inst interface{}, seq int64) {
@@ -336,23 +534,25 @@ func (c *CrudBase[T]) attemptInsert(ctx context.Context, tx *TXWrapper, inst T,
 		}
 	}
 
-	c.setInsertTimestamps(inst)
-	insert := sq.Insert(c.Table).Columns(c.Columns...)
-	values := make([]interface{}, len(c.Columns))
-	for i, col := range c.Columns {
-		values[i] = c.getFieldValue(inst, col)
+	values, err := c.insertValues(ctx, inst)
+	if err != nil {
+		return err
 	}
-	insert = insert.Values(values...)
+	insert := sq.Insert(c.Table).Columns(c.Columns...).Values(values...)
 	seq, err := c.DB.InsertTxExt(ctx, c.Table, tx, insert,
 		func() {
 			if c.EventHandler != nil {
 				c.EventHandler(inst.GetID(), Created)
 			}
 		}, requestConflictEmptyResult)
-	if err == nil {
-		c.attemptSetSequence(inst, seq)
+	if err != nil {
+		return err
 	}
-	return err
+	if err := c.notifyChange(ctx, tx, inst.GetID(), Created); err != nil {
+		return err
+	}
+	c.attemptSetSequence(inst, seq)
+	return c.readTimestamps(ctx, tx, inst)
 }
 
 func (c *CrudBase[T]) Upsert(ctx context.Context, inst T, optimization UpsertOptimization, hooks ...PostCompletionHook) (created bool, err error) {
@@ -377,10 +577,14 @@ func (c *CrudBase[T]) Upsert(ctx context.Context, inst T, optimization UpsertOpt
 
 	if !optimized {
 		// Do a select within the transaction to determine if the UUID already exists
+		idFilter, err := c.idFilter(ctx, inst.GetID())
+		if err != nil {
+			return false, err
+		}
 		msgRows, _, err := c.DB.QueryTx(ctx, c.Table, tx,
 			sq.Select(c.DB.sequenceColumn).
 				From(c.Table).
-				Where(c.idFilter(inst.GetID())),
+				Where(idFilter),
 		)
 		if err != nil {
 			return false, err
@@ -419,10 +623,9 @@ func (c *CrudBase[T]) InsertMany(ctx context.Context, instances []T, allowPartia
 	if c.DB.Features().MultiRowInsert {
 		insert := sq.Insert(c.Table).Columns(c.Columns...)
 		for _, inst := range instances {
-			c.setInsertTimestamps(inst)
-			values := make([]interface{}, len(c.Columns))
-			for i, col := range c.Columns {
-				values[i] = c.getFieldValue(inst, col)
+			values, err := c.insertValues(ctx, inst)
+			if err != nil {
+				return err
 			}
 			insert = insert.Values(values...)
 		}
@@ -439,11 +642,23 @@ func (c *CrudBase[T]) InsertMany(ctx context.Context, instances []T, allowPartia
 		if err != nil {
 			return err
 		}
+		for _, inst := range instances {
+			if err := c.notifyChange(ctx, tx, inst.GetID(), Created); err != nil {
+				return err
+			}
+		}
 		if len(sequences) == len(instances) {
 			for i, seq := range sequences {
 				c.attemptSetSequence(instances[i], seq)
 			}
 		}
+		if c.DBTimestamps {
+			for _, inst := range instances {
+				if err := c.readTimestamps(ctx, tx, inst); err != nil {
+					return err
+				}
+			}
+		}
 	} else {
 		// Fall back to individual inserts grouped in a TX
 		for _, inst := range instances {
@@ -556,7 +771,11 @@ func (c *CrudBase[T]) getReadCols(f *ffapi.FilterInfo) (tableFrom string, cols,
 }
 
 func (c *CrudBase[T]) GetSequenceForID(ctx context.Context, id string) (seq int64, err error) {
-	query := sq.Select(c.DB.SequenceColumn()).From(c.Table).Where(c.idFilter(id))
+	idFilter, err := c.idFilter(ctx, id)
+	if err != nil {
+		return -1, err
+	}
+	query := sq.Select(c.DB.SequenceColumn()).From(c.Table).Where(idFilter)
 	rows, _, err := c.DB.Query(ctx, c.Table, query)
 	if err != nil {
 		return -1, err
@@ -590,10 +809,14 @@ func (c *CrudBase[T]) GetByID(ctx context.Context, id string, getOpts ...GetOpti
 		return c.NilValue(), err
 	}
 
+	idFilter, err := c.idFilter(ctx, id)
+	if err != nil {
+		return c.NilValue(), err
+	}
 	tableFrom, cols, readCols := c.getReadCols(nil)
 	query := sq.Select(readCols...).
 		From(tableFrom).
-		Where(c.idFilter(id))
+		Where(idFilter)
 	if c.ReadQueryModifier != nil {
 		if query, err = c.ReadQueryModifier(query); err != nil {
 			return c.NilValue(), err
@@ -627,9 +850,13 @@ func (c *CrudBase[T]) GetMany(ctx context.Context, filter ffapi.Filter) (instanc
 		return nil, nil, err
 	}
 	tableFrom, cols, readCols := c.getReadCols(fi)
+	scope, err := c.scope(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
 	var preconditions []sq.Sqlizer
-	if c.ScopedFilter != nil {
-		preconditions = []sq.Sqlizer{c.ScopedFilter()}
+	if scope != nil {
+		preconditions = []sq.Sqlizer{scope}
 	}
 	return c.getManyScoped(ctx, tableFrom, fi, cols, readCols, preconditions)
 }
@@ -736,18 +963,90 @@ func (c *CrudBase[T]) Count(ctx context.Context, filter ffapi.Filter) (count int
 		return -1, err
 	}
 
-	if c.ScopedFilter != nil {
+	scope, err := c.scope(ctx)
+	if err != nil {
+		return -1, err
+	}
+	if scope != nil {
 		fop = sq.And{
-			c.ScopedFilter(),
+			scope,
 			fop,
 		}
 	}
 	return c.DB.CountQuery(ctx, c.Table, nil, fop, c.ReadQueryModifier, "*")
 }
 
+// CountBy returns the count of resources matching the filter, for each distinct value of the group column.
+// The group column can be a column name, or a field name in the FilterFieldMap. Values are returned in their
+// string form, with NULL values counted under an empty string.
+func (c *CrudBase[T]) CountBy(ctx context.Context, filter ffapi.Filter, groupColumn string) (counts map[string]int64, err error) {
+	column := c.DB.mapFieldName("", groupColumn, c.FilterFieldMap)
+	if !c.isGroupableColumn(column) {
+		return nil, i18n.NewError(ctx, i18n.MsgDBInvalidGroupColumn, groupColumn, c.Table)
+	}
+
+	var fop sq.Sqlizer
+	fi, err := filter.Finalize()
+	if err == nil {
+		fop, err = c.DB.filterOp(ctx, c.Table, fi, c.FilterFieldMap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	scope, err := c.scope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if scope != nil {
+		fop = sq.And{
+			scope,
+			fop,
+		}
+	}
+
+	groupBy := fmt.Sprintf("%s.%s", c.Table, column)
+	query := sq.Select(groupBy, "COUNT(*)").From(c.Table).Where(fop).GroupBy(groupBy)
+	if c.ReadQueryModifier != nil {
+		if query, err = c.ReadQueryModifier(query); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, _, err := c.DB.Query(ctx, c.Table, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts = map[string]int64{}
+	for rows.Next() {
+		var value sql.NullString
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgDBReadErr, c.Table)
+		}
+		counts[value.String] += count
+	}
+	log.L(ctx).Debugf("SQL<- CountBy(%s,%s): %d groups", c.Table, column, len(counts))
+	return counts, nil
+}
+
+func (c *CrudBase[T]) isGroupableColumn(column string) bool {
+	for _, col := range c.Columns {
+		if col == column {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *CrudBase[T]) Update(ctx context.Context, id string, update ffapi.Update, hooks ...PostCompletionHook) (err error) {
 	return c.attemptUpdate(ctx, func(query sq.UpdateBuilder) (sq.UpdateBuilder, error) {
-		return query.Where(sq.Eq{"id": id}), nil
+		idValue, err := c.IDType.bindValue(ctx, id)
+		if err != nil {
+			return query, err
+		}
+		return query.Where(sq.Eq{"id": idValue}), nil
 	}, update, true, hooks...)
 }
 
@@ -822,19 +1121,27 @@ func (c *CrudBase[T]) attemptUpdate(ctx context.Context, filterFn func(sq.Update
 	defer c.DB.RollbackTx(ctx, tx, autoCommit)
 
 	baseQuery := sq.Update(c.Table)
-	if c.ScopedFilter != nil {
-		baseQuery = baseQuery.Where(c.ScopedFilter())
+	scope, err := c.scope(ctx)
+	if err != nil {
+		return err
+	}
+	if scope != nil {
+		baseQuery = baseQuery.Where(scope)
 	}
 	query, err := c.DB.BuildUpdate(baseQuery, update, c.FilterFieldMap)
 	if err == nil {
 		query, err = filterFn(query)
 	}
-	if !c.TimesDisabled {
-		query = query.Set(ColumnUpdated, fftypes.Now())
-	}
 	if err != nil {
 		return err
 	}
+	if !c.TimesDisabled {
+		now, err := c.now(ctx)
+		if err != nil {
+			return err
+		}
+		query = query.Set(ColumnUpdated, now)
+	}
 
 	updateCount, err := c.DB.UpdateTx(ctx, c.Table, tx, query, nil /* no change events filter based update */)
 	if err != nil {
@@ -854,6 +1161,11 @@ func (c *CrudBase[T]) attemptUpdate(ctx context.Context, filterFn func(sq.Update
 
 func (c *CrudBase[T]) Delete(ctx context.Context, id string, hooks ...PostCompletionHook) (err error) {
 
+	idFilter, err := c.idFilter(ctx, id)
+	if err != nil {
+		return err
+	}
+
 	ctx, tx, autoCommit, err := c.DB.BeginOrUseTx(ctx)
 	if err != nil {
 		return err
@@ -861,12 +1173,15 @@ func (c *CrudBase[T]) Delete(ctx context.Context, id string, hooks ...PostComple
 	defer c.DB.RollbackTx(ctx, tx, autoCommit)
 
 	err = c.DB.DeleteTx(ctx, c.Table, tx, sq.Delete(c.Table).Where(
-		c.idFilter(id),
+		idFilter,
 	), func() {
 		if c.EventHandler != nil {
 			c.EventHandler(id, Deleted)
 		}
 	})
+	if err == nil {
+		err = c.notifyChange(ctx, tx, id, Deleted)
+	}
 	if err != nil {
 		return err
 	}
@@ -896,9 +1211,13 @@ func (c *CrudBase[T]) DeleteMany(ctx context.Context, filter ffapi.Filter, hooks
 		return err
 	}
 
-	if c.ScopedFilter != nil {
+	scope, err := c.scope(ctx)
+	if err != nil {
+		return err
+	}
+	if scope != nil {
 		fop = sq.And{
-			c.ScopedFilter(),
+			scope,
 			fop,
 		}
 	}
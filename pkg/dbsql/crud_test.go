@@ -22,7 +22,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/Masterminds/squirrel"
@@ -626,6 +629,14 @@ func TestHistoryExampleNoNSOrUpdateColumn(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(len(sub1Entries)), count)
 
+	// Count grouped by subject, for all and for a filtered subset
+	counts, err := iCrud.CountBy(ctx, HistoryQueryFactory.NewFilter(ctx).And(), "subject")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"sub1": int64(len(sub1Entries)), "sub2": int64(len(sub2Entries))}, counts)
+	counts, err = iCrud.CountBy(ctx, HistoryQueryFactory.NewFilter(ctx).Neq("subject", "sub1"), "subject")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"sub2": int64(len(sub2Entries))}, counts)
+
 	// Delete all the sub1 entries
 	postDeleteMany := make(chan struct{})
 	err = iCrud.DeleteMany(ctx, HistoryQueryFactory.NewFilter(ctx).Eq("subject", "sub1"), func() {
@@ -1136,6 +1147,64 @@ func TestCountBadFilter(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestCountByScopedNullGroup(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	mock.ExpectQuery("SELECT crudables.field1, COUNT\\(\\*\\) FROM crudables WHERE \\(ns = .* GROUP BY crudables.field1").
+		WillReturnRows(sqlmock.NewRows([]string{"field1", "count"}).AddRow("a", 2).AddRow(nil, 3))
+	counts, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).And(), "f1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"a": 2, "": 3}, counts)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByBadColumn(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	_, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).And(), "f1; DROP TABLE crudables")
+	assert.Regexp(t, "FF00264", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByBadFilter(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	_, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).Eq(
+		"wrong", "anything",
+	), "f1")
+	assert.Regexp(t, "FF00142", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByQueryModifierFail(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.ReadQueryModifier = func(sb sq.SelectBuilder) (sq.SelectBuilder, error) {
+		return sb, fmt.Errorf("pop")
+	}
+	_, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).And(), "f1")
+	assert.Regexp(t, "pop", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByQueryFail(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	mock.ExpectQuery("SELECT.*").WillReturnError(fmt.Errorf("pop"))
+	_, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).And(), "f1")
+	assert.Regexp(t, "FF00176", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountByScanFail(t *testing.T) {
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	mock.ExpectQuery("SELECT.*").WillReturnRows(sqlmock.NewRows([]string{"field1", "count"}).AddRow("a", "not a number"))
+	_, err := tc.CountBy(context.Background(), CRUDableQueryFactory.NewFilter(context.Background()).And(), "f1")
+	assert.Regexp(t, "FF00182", err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetSequenceForIDFail(t *testing.T) {
 	db, mock := NewMockProvider().UTInit()
 	tc := newCRUDCollection(&db.Database, "ns1")
@@ -1288,3 +1357,313 @@ func TestValidateNameSemanticsWithoutQueryFactory(t *testing.T) {
 		tc.Validate()
 	})
 }
+
+func TestIDTypeBinding(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+
+	// Strings are bound as-is by default
+	mock.ExpectQuery("SELECT.*").WithArgs("id12345", "ns1").WillReturnRows(sqlmock.NewRows([]string{}))
+	_, err := tc.GetByID(ctx, "id12345")
+	assert.NoError(t, err)
+
+	tc.IDType = IDTypeInt64
+	mock.ExpectQuery("SELECT.*").WithArgs(int64(12345), "ns1").WillReturnRows(sqlmock.NewRows([]string{}))
+	_, err = tc.GetByID(ctx, "12345")
+	assert.NoError(t, err)
+
+	tc.IDType = IDTypeUUID
+	id := fftypes.NewUUID()
+	mock.ExpectQuery("SELECT.*").WithArgs(id.String(), "ns1").WillReturnRows(sqlmock.NewRows([]string{}))
+	_, err = tc.GetByID(ctx, strings.ToUpper(id.String()))
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIDTypeInvalid(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.IDType = IDTypeInt64
+
+	_, err := tc.GetByID(ctx, "not a number")
+	assert.Regexp(t, "FF00279", err)
+	_, err = tc.GetSequenceForID(ctx, "not a number")
+	assert.Regexp(t, "FF00279", err)
+	err = tc.Delete(ctx, "not a number")
+	assert.Regexp(t, "FF00279", err)
+
+	mock.ExpectBegin()
+	err = tc.Update(ctx, "not a number", CRUDableQueryFactory.NewUpdate(ctx).Set("f1", "hello"))
+	assert.Regexp(t, "FF00279", err)
+
+	inst := &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}
+	mock.ExpectBegin()
+	err = tc.UpdateSparse(ctx, inst)
+	assert.Regexp(t, "FF00279", err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT.*").WillReturnError(fmt.Errorf("pop"))
+	_, err = tc.Upsert(ctx, inst, UpsertOptimizationNew)
+	assert.Regexp(t, "FF00279", err)
+
+	tc.IDType = IDTypeUUID
+	_, err = tc.GetByID(ctx, "not a uuid")
+	assert.Regexp(t, "FF00138", err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCRUDDBTimestampsEnd2End(t *testing.T) {
+	sql, done := newSQLiteTestProvider(t)
+	defer done()
+	ctx := context.Background()
+
+	collection := newCRUDCollection(sql.db, "ns1")
+	collection.DBTimestamps = true
+
+	// The timestamps are set by the database, and read back
+	c1 := &TestCRUDable{
+		ResourceBase: ResourceBase{ID: fftypes.NewUUID()},
+		Name:         ptrTo("bob"),
+		NS:           ptrTo("ns1"),
+	}
+	err := collection.Insert(ctx, c1)
+	assert.NoError(t, err)
+	assert.NotNil(t, c1.Created)
+	assert.WithinDuration(t, time.Now(), *c1.Created.Time(), 1*time.Minute)
+	assert.Equal(t, c1.Created, c1.Updated)
+	stored, err := collection.GetByID(ctx, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, c1.Created.UnixNano(), stored.Created.UnixNano())
+
+	// Updates from an instance read back the new updated time
+	time.Sleep(2 * time.Millisecond) // the precision of SQLite is milliseconds
+	c1.Field1 = ptrTo("hello")
+	err = collection.Replace(ctx, c1)
+	assert.NoError(t, err)
+	assert.Greater(t, c1.Updated.UnixNano(), c1.Created.UnixNano())
+	stored, err = collection.GetByID(ctx, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, c1.Updated.UnixNano(), stored.Updated.UnixNano())
+	assert.Equal(t, c1.Created.UnixNano(), stored.Created.UnixNano())
+
+	// Filter based updates set the updated time on the database
+	time.Sleep(2 * time.Millisecond)
+	err = collection.Update(ctx, c1.ID.String(), CRUDableQueryFactory.NewUpdate(ctx).Set("f1", "world"))
+	assert.NoError(t, err)
+	stored, err = collection.GetByID(ctx, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Greater(t, stored.Updated.UnixNano(), c1.Updated.UnixNano())
+
+	// Each of many inserts is read back
+	many := []*TestCRUDable{
+		{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}, NS: ptrTo("ns1")},
+		{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}, NS: ptrTo("ns1")},
+	}
+	err = collection.InsertMany(ctx, many, false)
+	assert.NoError(t, err)
+	for _, inst := range many {
+		assert.NotNil(t, inst.Created)
+		assert.NotNil(t, inst.Updated)
+	}
+}
+
+func TestCRUDDBTimestampsUnsupported(t *testing.T) {
+	ctx := context.Background()
+	db, mock := NewMockProvider().UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.DBTimestamps = true
+	inst := &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}
+
+	mock.ExpectBegin()
+	err := tc.Insert(ctx, inst)
+	assert.Regexp(t, "FF00301.*crudables.*mockdb", err)
+
+	mock.ExpectBegin()
+	err = tc.UpdateSparse(ctx, inst)
+	assert.Regexp(t, "FF00301", err)
+
+	mock.ExpectBegin()
+	err = tc.Update(ctx, inst.ID.String(), CRUDableQueryFactory.NewUpdate(ctx).Set("f1", "hello"))
+	assert.Regexp(t, "FF00301", err)
+
+	db.features.MultiRowInsert = true
+	mock.ExpectBegin()
+	err = tc.InsertMany(ctx, []*TestCRUDable{inst}, false)
+	assert.Regexp(t, "FF00301", err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCRUDDBTimestampsMock(t *testing.T) {
+	ctx := context.Background()
+	mp := NewMockProvider()
+	mp.CurrentTimestamp = true
+	db, mock := mp.UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.DBTimestamps = true
+	inst := &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}
+	now := fftypes.Now()
+
+	// The expression is evaluated by the database, rather than bound as a value
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO crudables \(id,created,updated,.*\) VALUES \(\$1,` + regexp.QuoteMeta(PostgresCurrentTimestamp) + `,` + regexp.QuoteMeta(PostgresCurrentTimestamp) + `,`).
+		WillReturnResult(driver.ResultNoRows)
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{ColumnCreated, ColumnUpdated}).AddRow(now.UnixNano(), now.UnixNano()))
+	mock.ExpectCommit()
+	err := tc.Insert(ctx, inst)
+	assert.NoError(t, err)
+	assert.Equal(t, now.UnixNano(), inst.Created.UnixNano())
+	assert.Equal(t, now.UnixNano(), inst.Updated.UnixNano())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE crudables SET .*updated = ` + regexp.QuoteMeta(PostgresCurrentTimestamp)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).WillReturnError(fmt.Errorf("pop"))
+	err = tc.UpdateSparse(ctx, inst)
+	assert.Regexp(t, "FF00176", err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE crudables`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).WillReturnRows(sqlmock.NewRows([]string{ColumnCreated, ColumnUpdated}))
+	err = tc.UpdateSparse(ctx, inst)
+	assert.Regexp(t, "FF00205", err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE crudables`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{ColumnCreated, ColumnUpdated}).AddRow("not a time", now.UnixNano()))
+	err = tc.UpdateSparse(ctx, inst)
+	assert.Regexp(t, "FF00182", err)
+
+	// Each row of a multi-row insert is read back
+	db.FakePSQLInsert = true
+	db.features.MultiRowInsert = true
+	inst2 := &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO crudables.*VALUES \(.*\),\(.*\)`).WillReturnRows(
+		sqlmock.NewRows([]string{db.sequenceColumn}).AddRow(123).AddRow(234),
+	)
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).
+		WillReturnRows(sqlmock.NewRows([]string{ColumnCreated, ColumnUpdated}).AddRow(now.UnixNano(), now.UnixNano()))
+	mock.ExpectQuery(`SELECT created, updated FROM crudables WHERE`).WillReturnError(fmt.Errorf("pop"))
+	err = tc.InsertMany(ctx, []*TestCRUDable{inst, inst2}, false)
+	assert.Regexp(t, "FF00176", err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+type testNSContextKey struct{}
+
+func TestCRUDContextScopeEnd2End(t *testing.T) {
+	sql, done := newSQLiteTestProvider(t)
+	defer done()
+
+	collection := newCRUDCollection(sql.db, "")
+	collection.ScopedFilter = nil
+	collection.ContextScope = func(ctx context.Context) (sq.Eq, error) {
+		ns, ok := ctx.Value(testNSContextKey{}).(string)
+		if !ok {
+			return nil, nil
+		}
+		return sq.Eq{"ns": ns}, nil
+	}
+	ctx1 := context.WithValue(context.Background(), testNSContextKey{}, "ns1")
+	ctx2 := context.WithValue(context.Background(), testNSContextKey{}, "ns2")
+
+	// The scope column is populated on insert, overriding the instance
+	c1 := &TestCRUDable{
+		ResourceBase: ResourceBase{ID: fftypes.NewUUID()},
+		Name:         ptrTo("bob"),
+		NS:           ptrTo("ns2"),
+	}
+	err := collection.Insert(ctx1, c1)
+	assert.NoError(t, err)
+	stored, err := collection.GetByID(ctx1, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "ns1", *stored.NS)
+	err = collection.InsertMany(ctx1, []*TestCRUDable{{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}}, false)
+	assert.NoError(t, err)
+
+	// Rows in other scopes are not read
+	stored, err = collection.GetByID(ctx2, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	results, _, err := collection.GetMany(ctx2, CRUDableQueryFactory.NewFilter(ctx2).And())
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	count, err := collection.Count(ctx1, CRUDableQueryFactory.NewFilter(ctx1).And())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	counts, err := collection.CountBy(ctx2, CRUDableQueryFactory.NewFilter(ctx2).And(), "ns")
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	// Rows in other scopes are not updated or deleted
+	err = collection.Update(ctx2, c1.ID.String(), CRUDableQueryFactory.NewUpdate(ctx2).Set("f1", "hello"))
+	assert.Regexp(t, "FF00205", err)
+	err = collection.Replace(ctx2, c1)
+	assert.Regexp(t, "FF00205", err)
+	err = collection.DeleteMany(ctx2, CRUDableQueryFactory.NewFilter(ctx2).And())
+	assert.NoError(t, err)
+	err = collection.Delete(ctx2, c1.ID.String())
+	assert.Regexp(t, "FF00167", err)
+
+	// The scope column of a row is not changed by an update
+	c1.Field1 = ptrTo("hello")
+	err = collection.Replace(ctx1, c1)
+	assert.NoError(t, err)
+	stored, err = collection.GetByID(ctx1, c1.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "ns1", *stored.NS)
+	assert.Equal(t, "hello", *stored.Field1)
+	err = collection.Delete(ctx1, c1.ID.String())
+	assert.NoError(t, err)
+}
+
+func TestCRUDContextScopeMissing(t *testing.T) {
+	sql, done := newSQLiteTestProvider(t)
+	defer done()
+	ctx := context.Background()
+
+	collection := newCRUDCollection(sql.db, "ns1")
+	collection.ContextScope = func(ctx context.Context) (sq.Eq, error) { return nil, nil }
+
+	c1 := &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}
+	err := collection.Insert(ctx, c1)
+	assert.Regexp(t, "FF00313", err)
+	_, err = collection.GetByID(ctx, c1.ID.String())
+	assert.Regexp(t, "FF00313", err)
+	_, _, err = collection.GetMany(ctx, CRUDableQueryFactory.NewFilter(ctx).And())
+	assert.Regexp(t, "FF00313", err)
+	_, err = collection.Count(ctx, CRUDableQueryFactory.NewFilter(ctx).And())
+	assert.Regexp(t, "FF00313", err)
+	_, err = collection.CountBy(ctx, CRUDableQueryFactory.NewFilter(ctx).And(), "ns")
+	assert.Regexp(t, "FF00313", err)
+	err = collection.Replace(ctx, c1)
+	assert.Regexp(t, "FF00313", err)
+	err = collection.UpdateMany(ctx, CRUDableQueryFactory.NewFilter(ctx).And(), CRUDableQueryFactory.NewUpdate(ctx).Set("f1", "hello"))
+	assert.Regexp(t, "FF00313", err)
+	err = collection.DeleteMany(ctx, CRUDableQueryFactory.NewFilter(ctx).And())
+	assert.Regexp(t, "FF00313", err)
+
+	collection.ContextScope = func(ctx context.Context) (sq.Eq, error) { return nil, fmt.Errorf("pop") }
+	err = collection.Delete(ctx, c1.ID.String())
+	assert.Regexp(t, "pop", err)
+	err = collection.Replace(ctx, c1)
+	assert.Regexp(t, "pop", err)
+
+	collection.ContextScope = func(ctx context.Context) (sq.Eq, error) { return sq.Eq{"tenant": "t1"}, nil }
+	err = collection.Insert(ctx, c1)
+	assert.Regexp(t, "FF00314.*tenant", err)
+}
+
+func TestCRUDContextScopeColumnAlias(t *testing.T) {
+	tc := &CrudBase[*TestCRUDable]{ReadTableAlias: "c"}
+	assert.Equal(t, "ns", tc.scopeColumn("c.ns"))
+	assert.Equal(t, "ns", tc.scopeColumn("ns"))
+}
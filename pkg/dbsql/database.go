@@ -23,7 +23,6 @@ import (
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
-	"github.com/golang-migrate/migrate/v4"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
@@ -35,11 +34,18 @@ import (
 )
 
 type Database struct {
-	db             *sql.DB
-	provider       Provider
-	features       SQLFeatures
-	connLimit      int
-	sequenceColumn string
+	db                  *sql.DB
+	provider            Provider
+	features            SQLFeatures
+	connLimit           int
+	sequenceColumn      string
+	statementTimeout    time.Duration
+	slowQueryThreshold  time.Duration
+	healthCheckTimeout  time.Duration
+	countCache          *countCache // nil unless enabled
+	migrationsDirectory string
+	url                 string // passed to a ChangeListener, which needs a dedicated connection
+	instanceID          string // identifies the change notifications published by this instance
 }
 
 type QueryModifier = func(sq.SelectBuilder) (sq.SelectBuilder, error)
@@ -52,10 +58,19 @@ type PreCommitAccumulator interface {
 
 type txContextKey struct{}
 
+type statementTimeoutContextKey struct{}
+
 type TXWrapper struct {
 	sqlTX                *sql.Tx
 	preCommitAccumulator PreCommitAccumulator
 	postCommit           []func()
+	statementTimeout     time.Duration // the timeout last applied to the transaction on the server
+}
+
+// WithStatementTimeout overrides the configured statement timeout, for database operations
+// performed with the returned context. A zero duration means unlimited.
+func WithStatementTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, statementTimeoutContextKey{}, timeout)
 }
 
 func (tx *TXWrapper) AddPostCommitHook(fn func()) {
@@ -83,9 +98,16 @@ func (s *Database) Init(ctx context.Context, provider Provider, config config.Se
 		return i18n.NewError(ctx, i18n.MsgMissingConfig, "url", fmt.Sprintf("database.%s", s.provider.Name()))
 	}
 
-	if s.db, err = provider.Open(config.GetString(SQLConfDatasourceURL)); err != nil {
+	s.url = config.GetString(SQLConfDatasourceURL)
+	s.instanceID = fftypes.NewUUID().String()
+	if s.db, err = provider.Open(s.url); err != nil {
 		return i18n.WrapError(ctx, err, i18n.MsgDBInitFailed)
 	}
+	s.statementTimeout = config.GetDuration(SQLConfStatementTimeout)
+	s.slowQueryThreshold = config.GetDuration(SQLConfSlowQueryThreshold)
+	s.healthCheckTimeout = config.GetDuration(SQLConfHealthCheckTimeout)
+	s.countCache = newCountCache(config.GetDuration(SQLConfCountCacheTTL), config.GetInt(SQLConfCountCacheSize))
+	s.migrationsDirectory = config.GetString(SQLConfMigrationsDirectory)
 	s.connLimit = config.GetInt(SQLConfMaxConnections)
 	if s.connLimit > 0 {
 		s.db.SetMaxOpenConns(s.connLimit)
@@ -100,8 +122,8 @@ func (s *Database) Init(ctx context.Context, provider Provider, config config.Se
 	}
 
 	if config.GetBool(SQLConfMigrationsAuto) {
-		if err = s.applyDBMigrations(ctx, config, provider); err != nil {
-			return i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
+		if _, err = s.Migrate(ctx, false); err != nil {
+			return err
 		}
 	}
 
@@ -139,27 +161,6 @@ func (s *Database) RunAsGroup(ctx context.Context, fn func(ctx context.Context)
 	return s.CommitTx(ctx, tx, false /* we _are_ the auto-committer */)
 }
 
-func (s *Database) applyDBMigrations(ctx context.Context, config config.Section, provider Provider) error {
-	driver, err := provider.GetMigrationDriver(s.db)
-	if err == nil {
-		fileURL := "file://" + config.GetString(SQLConfMigrationsDirectory)
-		log.L(ctx).Infof("Running migrations in: %s", fileURL)
-		var m *migrate.Migrate
-		m, err = migrate.NewWithDatabaseInstance(
-			fileURL,
-			provider.MigrationsDir(), driver)
-		if err == nil {
-			err = m.Up()
-		}
-		version, dirty, _ := m.Version()
-		log.L(ctx).Infof("Migrations now at: v=%d dirty=%t", version, dirty)
-	}
-	if err != nil && err != migrate.ErrNoChange {
-		return i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
-	}
-	return nil
-}
-
 func GetTXFromContext(ctx context.Context) *TXWrapper {
 	ctxKey := txContextKey{}
 	txi := ctx.Value(ctxKey)
@@ -196,6 +197,37 @@ func (s *Database) BeginOrUseTx(ctx context.Context) (ctx1 context.Context, tx *
 	return ctx1, tx, false, err
 }
 
+// statementContext applies the statement timeout to the context, and where supported by
+// the provider sets it on the server for the transaction.
+func (s *Database) statementContext(ctx context.Context, tx *TXWrapper) (context.Context, context.CancelFunc, error) {
+	timeout := s.statementTimeout
+	if override, ok := ctx.Value(statementTimeoutContextKey{}).(time.Duration); ok {
+		timeout = override
+	}
+	if tx != nil && s.features.StatementTimeout != nil && timeout != tx.statementTimeout {
+		sqlQuery := s.features.StatementTimeout(timeout)
+		log.L(ctx).Tracef(`SQL-> statement timeout: %s`, sqlQuery)
+		if _, err := tx.sqlTX.ExecContext(ctx, sqlQuery); err != nil {
+			log.L(ctx).Errorf(`SQL statement timeout failed: %s sql=[ %s ]`, err, sqlQuery)
+			return ctx, func() {}, i18n.WrapError(ctx, err, i18n.MsgDBQueryFailed)
+		}
+		tx.statementTimeout = timeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, nil
+}
+
+// logIfSlow logs the SQL (which contains placeholders rather than the parameter values) at warn
+// level if the statement exceeded the slow query threshold
+func (s *Database) logIfSlow(ctx context.Context, op, table, sqlQuery string, before time.Time) {
+	if s.slowQueryThreshold > 0 && time.Since(before) > s.slowQueryThreshold {
+		log.L(ctx).Warnf(`SQL slow %s %s (%.2fms): %s`, op, table, floatMillisSince(before), sqlQuery)
+	}
+}
+
 func (s *Database) QueryTx(ctx context.Context, table string, tx *TXWrapper, q sq.SelectBuilder) (*sql.Rows, *TXWrapper, error) {
 	if tx == nil {
 		// If there is a transaction in the context, we should use it to provide consistency
@@ -208,14 +240,26 @@ func (s *Database) QueryTx(ctx context.Context, table string, tx *TXWrapper, q s
 	if err != nil {
 		return nil, tx, i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
 	}
+	// The deadline must also bound reading the returned rows, and cancelling the context closes
+	// them, so on success the context is released when its deadline expires rather than when we return
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return nil, tx, err
+	}
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
 	before := time.Now()
 	l.Tracef(`SQL-> query: %s (args: %+v)`, sqlQuery, args)
 	var rows *sql.Rows
 	if tx != nil {
-		rows, err = tx.sqlTX.QueryContext(ctx, sqlQuery, args...)
+		rows, err = tx.sqlTX.QueryContext(stmtCtx, sqlQuery, args...)
 	} else {
-		rows, err = s.db.QueryContext(ctx, sqlQuery, args...)
+		rows, err = s.db.QueryContext(stmtCtx, sqlQuery, args...)
 	}
+	s.logIfSlow(ctx, "query", table, sqlQuery, before)
 	if err != nil {
 		l.Errorf(`SQL query failed: %s sql=[ %s ]`, err, sqlQuery)
 		return nil, tx, i18n.WrapError(ctx, err, i18n.MsgDBQueryFailed)
@@ -249,14 +293,29 @@ func (s *Database) CountQuery(ctx context.Context, table string, tx *TXWrapper,
 	if err != nil {
 		return count, i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
 	}
+	// counts within a transaction must be consistent with it, so are never cached
+	cacheKey := ""
+	if s.countCache != nil && tx == nil {
+		cacheKey = countCacheKey(table, sqlQuery, args)
+		if cached, ok := s.countCache.get(cacheKey); ok {
+			l.Debugf(`SQL<- count query %s: %d (cached)`, table, cached)
+			return cached, nil
+		}
+	}
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return count, err
+	}
+	defer cancel()
 	before := time.Now()
 	l.Tracef(`SQL-> count query: %s (args: %+v)`, sqlQuery, args)
 	var rows *sql.Rows
 	if tx != nil {
-		rows, err = tx.sqlTX.QueryContext(ctx, sqlQuery, args...)
+		rows, err = tx.sqlTX.QueryContext(stmtCtx, sqlQuery, args...)
 	} else {
-		rows, err = s.db.QueryContext(ctx, sqlQuery, args...)
+		rows, err = s.db.QueryContext(stmtCtx, sqlQuery, args...)
 	}
+	s.logIfSlow(ctx, "count query", table, sqlQuery, before)
 	if err != nil {
 		l.Errorf(`SQL count query failed: %s sql=[ %s ]`, err, sqlQuery)
 		return count, i18n.WrapError(ctx, err, i18n.MsgDBQueryFailed)
@@ -268,12 +327,22 @@ func (s *Database) CountQuery(ctx context.Context, table string, tx *TXWrapper,
 		}
 	}
 	l.Debugf(`SQL<- count query %s: %d (%.2fms)`, table, count, floatMillisSince(before))
+	if cacheKey != "" && count >= 0 {
+		s.countCache.set(cacheKey, count)
+	}
 	return count, nil
 }
 
 func (s *Database) QueryRes(ctx context.Context, table string, tx *TXWrapper, fop sq.Sqlizer, qm QueryModifier, fi *ffapi.FilterInfo) *ffapi.FilterResult {
 	fr := &ffapi.FilterResult{}
-	if fi.Count {
+	if fi.Count && fi.Approximate {
+		count, approximate, err := s.EstimateCountQuery(ctx, table, tx, fop, qm, fi.CountExpr)
+		if err != nil {
+			log.L(ctx).Warnf("Unable to return count for query: %s", err)
+		}
+		fr.TotalCount = &count
+		fr.Approximate = approximate
+	} else if fi.Count {
 		count, err := s.CountQuery(ctx, table, tx, fop, qm, fi.CountExpr)
 		if err != nil {
 			// Log, but continue
@@ -302,11 +371,17 @@ func (s *Database) InsertTxRows(ctx context.Context, table string, tx *TXWrapper
 	if err != nil {
 		return i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
 	}
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
 	before := time.Now()
 	l.Tracef(`SQL-> insert query: %s (args: %+v)`, sqlQuery, args)
+	defer s.logIfSlow(ctx, "insert", table, sqlQuery, before)
 	if useQuery {
 		noInsert := false
-		result, err := tx.sqlTX.QueryContext(ctx, sqlQuery, args...)
+		result, err := tx.sqlTX.QueryContext(stmtCtx, sqlQuery, args...)
 		for i := 0; i < len(sequences) && err == nil; i++ {
 			if result.Next() {
 				err = result.Scan(&sequences[i])
@@ -330,7 +405,7 @@ func (s *Database) InsertTxRows(ctx context.Context, table string, tx *TXWrapper
 		if len(sequences) > 1 {
 			return i18n.WrapError(ctx, err, i18n.MsgDBMultiRowConfigError)
 		}
-		res, err := tx.sqlTX.ExecContext(ctx, sqlQuery, args...)
+		res, err := tx.sqlTX.ExecContext(stmtCtx, sqlQuery, args...)
 		if err != nil {
 			l.Errorf(`SQL insert failed: %s sql=[ %s ]: %s`, err, sqlQuery, err)
 			return i18n.WrapError(ctx, err, i18n.MsgDBInsertFailed)
@@ -351,9 +426,15 @@ func (s *Database) DeleteTx(ctx context.Context, table string, tx *TXWrapper, q
 	if err != nil {
 		return i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
 	}
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
 	before := time.Now()
 	l.Tracef(`SQL-> delete query: %s args: %+v`, sqlQuery, args)
-	res, err := tx.sqlTX.ExecContext(ctx, sqlQuery, args...)
+	res, err := tx.sqlTX.ExecContext(stmtCtx, sqlQuery, args...)
+	s.logIfSlow(ctx, "delete", table, sqlQuery, before)
 	if err != nil {
 		l.Errorf(`SQL delete failed: %s sql=[ %s ]: %s`, err, sqlQuery, err)
 		return i18n.WrapError(ctx, err, i18n.MsgDBDeleteFailed)
@@ -376,9 +457,15 @@ func (s *Database) UpdateTx(ctx context.Context, table string, tx *TXWrapper, q
 	if err != nil {
 		return -1, i18n.WrapError(ctx, err, i18n.MsgDBQueryBuildFailed)
 	}
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return -1, err
+	}
+	defer cancel()
 	before := time.Now()
 	l.Tracef(`SQL-> update query: %s (args: %+v)`, sqlQuery, args)
-	res, err := tx.sqlTX.ExecContext(ctx, sqlQuery, args...)
+	res, err := tx.sqlTX.ExecContext(stmtCtx, sqlQuery, args...)
+	s.logIfSlow(ctx, "update", table, sqlQuery, before)
 	if err != nil {
 		l.Errorf(`SQL update failed: %s sql=[ %s ]`, err, sqlQuery)
 		return -1, i18n.WrapError(ctx, err, i18n.MsgDBUpdateFailed)
@@ -392,14 +479,44 @@ func (s *Database) UpdateTx(ctx context.Context, table string, tx *TXWrapper, q
 	return ra, nil
 }
 
+// Health runs a lightweight query against the database, to check it is reachable and a connection
+// can be obtained from the pool. It returns as soon as the health check timeout, or any deadline
+// on the supplied context, is reached - so it does not block shutdown.
+func (s *Database) Health(ctx context.Context) error {
+	timeout := s.healthCheckTimeout
+	if timeout <= 0 {
+		timeout, _ = time.ParseDuration(defaultHealthCheckTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var result int
+	if err := s.db.QueryRowContext(ctx, "SELECT 1").Scan(&result); err != nil {
+		log.L(ctx).Errorf(`SQL health check failed: %s`, err)
+		return i18n.WrapError(ctx, err, i18n.MsgDBQueryFailed)
+	}
+	return nil
+}
+
+// Stats returns the connection pool statistics, including the in-use and idle connection
+// counts, and the total number and duration of waits for a connection
+func (s *Database) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
 func (s *Database) AcquireLockTx(ctx context.Context, lockName string, tx *TXWrapper) error {
 	l := log.L(ctx)
 	if s.features.AcquireLock != nil {
 		sqlQuery := s.features.AcquireLock(lockName)
 
+		stmtCtx, cancel, err := s.statementContext(ctx, tx)
+		if err != nil {
+			return err
+		}
+		defer cancel()
 		before := time.Now()
 		l.Tracef(`SQL-> lock %s`, lockName)
-		_, err := tx.sqlTX.ExecContext(ctx, sqlQuery)
+		_, err = tx.sqlTX.ExecContext(stmtCtx, sqlQuery)
+		s.logIfSlow(ctx, "lock", lockName, sqlQuery, before)
 		if err != nil {
 			l.Errorf(`SQL lock failed: %s sql=[ %s ]`, err, sqlQuery)
 			return i18n.WrapError(ctx, err, i18n.MsgDBLockFailed)
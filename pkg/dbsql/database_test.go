@@ -21,6 +21,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	sq "github.com/Masterminds/squirrel"
@@ -87,6 +88,7 @@ func TestInitDatabaseOpenFailed(t *testing.T) {
 func TestInitDatabaseMigrationOpenFailed(t *testing.T) {
 	mp := NewMockProvider()
 	mp.config.Set(SQLConfMigrationsAuto, true)
+	mp.config.Set(SQLConfMigrationsDirectory, "../../test/dbmigrations")
 	mp.GetMigrationDriverError = fmt.Errorf("pop")
 	err := mp.Database.Init(context.Background(), mp, mp.config)
 	assert.Regexp(t, "FF00184.*pop", err)
@@ -593,3 +595,128 @@ func TestInsertTxRowsIncompleteReturn(t *testing.T) {
 	err = s.InsertTxRows(ctx, "table1", tx, sb, nil, []int64{1, 2}, false)
 	assert.Regexp(t, "FF00177", err)
 }
+
+func TestStatementTimeoutSetInTx(t *testing.T) {
+	mp := NewMockProvider()
+	mp.StatementTimeout = true
+	mp.config.Set(SQLConfStatementTimeout, "5s")
+	s, mdb := mp.UTInit()
+	mdb.ExpectBegin()
+	mdb.ExpectExec("SET LOCAL statement_timeout = 5000").WillReturnResult(driver.ResultNoRows)
+	mdb.ExpectExec("UPDATE table1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mdb.ExpectExec("UPDATE table1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mdb.ExpectExec("SET LOCAL statement_timeout = 0").WillReturnResult(driver.ResultNoRows)
+	mdb.ExpectExec("DELETE FROM table1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mdb.ExpectCommit()
+
+	ctx, tx, autoCommit, err := s.BeginOrUseTx(context.Background())
+	assert.NoError(t, err)
+
+	_, err = s.UpdateTx(ctx, "table1", tx, sq.Update("table1").Set("col1", "val1"), nil)
+	assert.NoError(t, err)
+	_, err = s.UpdateTx(ctx, "table1", tx, sq.Update("table1").Set("col1", "val2"), nil)
+	assert.NoError(t, err)
+	err = s.DeleteTx(WithStatementTimeout(ctx, 0), "table1", tx, sq.Delete("table1"), nil)
+	assert.NoError(t, err)
+
+	err = s.CommitTx(ctx, tx, autoCommit)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestStatementTimeoutSetFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.StatementTimeout = true
+	mp.config.Set(SQLConfStatementTimeout, "5s")
+	s, mdb := mp.UTInit()
+	mdb.ExpectBegin()
+	mdb.ExpectExec("SET LOCAL statement_timeout").WillReturnError(fmt.Errorf("pop"))
+
+	ctx, tx, _, err := s.BeginOrUseTx(context.Background())
+	assert.NoError(t, err)
+
+	_, err = s.UpdateTx(ctx, "table1", tx, sq.Update("table1").Set("col1", "val1"), nil)
+	assert.Regexp(t, "FF00176.*pop", err)
+	err = s.DeleteTx(ctx, "table1", tx, sq.Delete("table1"), nil)
+	assert.Regexp(t, "FF00176", err)
+	err = s.InsertTxRows(ctx, "table1", tx, sq.Insert("table1").Columns("col1").Values("val1"), nil, []int64{-1}, false)
+	assert.Regexp(t, "FF00176", err)
+	err = s.AcquireLockTx(ctx, "table1", tx)
+	assert.Regexp(t, "FF00176", err)
+	_, _, err = s.QueryTx(ctx, "table1", tx, sq.Select("*").From("table1"))
+	assert.Regexp(t, "FF00176", err)
+	_, err = s.CountQuery(ctx, "table1", tx, sq.Eq{"col1": "val1"}, nil, "")
+	assert.Regexp(t, "FF00176", err)
+}
+
+func TestStatementTimeoutExceeded(t *testing.T) {
+	mp := NewMockProvider()
+	mp.config.Set(SQLConfStatementTimeout, "1ms")
+	mp.config.Set(SQLConfSlowQueryThreshold, "1ns")
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery("SELECT.*").WillDelayFor(1 * time.Second).WillReturnRows(sqlmock.NewRows([]string{"col1"}))
+
+	_, _, err := s.Query(context.Background(), "table1", sq.Select("col1").From("table1"))
+	assert.Regexp(t, "FF00176", err)
+}
+
+func TestSlowQueryLogged(t *testing.T) {
+	mp := NewMockProvider()
+	mp.config.Set(SQLConfSlowQueryThreshold, "1ns")
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery("SELECT COUNT.*").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+
+	count, err := s.CountQuery(context.Background(), "table1", nil, sq.Eq{"col1": "val1"}, nil, "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), count)
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestPostgresStatementTimeout(t *testing.T) {
+	assert.Equal(t, "SET LOCAL statement_timeout = 1500", PostgresStatementTimeout(1500*time.Millisecond))
+}
+
+func TestHealthOK(t *testing.T) {
+	s, mdb := NewMockProvider().UTInit()
+	mdb.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	err := s.Health(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, mdb.ExpectationsWereMet())
+}
+
+func TestHealthTimeout(t *testing.T) {
+	mp := NewMockProvider()
+	mp.config.Set(SQLConfHealthCheckTimeout, "1ms")
+	s, mdb := mp.UTInit()
+	mdb.ExpectQuery("SELECT 1").WillDelayFor(1 * time.Second).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	err := s.Health(context.Background())
+	assert.Regexp(t, "FF00176", err)
+}
+
+func TestHealthContextCancelled(t *testing.T) {
+	s, mdb := NewMockProvider().UTInit()
+	mdb.ExpectQuery("SELECT 1").WillDelayFor(1 * time.Second).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := s.Health(ctx)
+	assert.Regexp(t, "FF00176", err)
+}
+
+func TestHealthDefaultTimeout(t *testing.T) {
+	s, mdb := NewMockProvider().UTInit()
+	s.healthCheckTimeout = 0
+	mdb.ExpectQuery("SELECT 1").WillReturnError(fmt.Errorf("pop"))
+
+	err := s.Health(context.Background())
+	assert.Regexp(t, "FF00176.*pop", err)
+}
+
+func TestStats(t *testing.T) {
+	s, _ := NewMockProvider().UTInit()
+	stats := s.Stats()
+	assert.Equal(t, 1, stats.OpenConnections)
+}
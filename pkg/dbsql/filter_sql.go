@@ -18,6 +18,7 @@ package dbsql
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -84,6 +85,10 @@ func (lk NotILikeEscape) ToSql() (sql string, args []interface{}, err error) {
 func (s *Database) escapeLike(value ffapi.FieldSerialization) string {
 	v, _ := value.Value()
 	vs, _ := v.(string)
+	return s.escapeLikeString(vs)
+}
+
+func (s *Database) escapeLikeString(vs string) string {
 	vs = strings.ReplaceAll(vs, escapeChar, escapeChar+escapeChar)
 	vs = strings.ReplaceAll(vs, "%", escapeChar+"%")
 	vs = strings.ReplaceAll(vs, "_", escapeChar+"_")
@@ -238,7 +243,42 @@ func (s *Database) newNotILike(field, value string) sq.Sqlizer {
 	return NotLikeEscape{fmt.Sprintf("lower(%s)", field): strings.ToLower(value)}
 }
 
+// filterMapKey matches a key/value pair within a map field, stored as a JSON object in a text column.
+// This relies on the compact serialization of the JSON, and values that need no escaping.
+func (s *Database) filterMapKey(ctx context.Context, tableName string, op *ffapi.FilterInfo, tm map[string]string) (sq.Sqlizer, error) {
+	field := s.mapField(tableName, op, tm)
+	pattern := func(value ffapi.FieldSerialization) string {
+		k, _ := json.Marshal(op.MapKey)
+		sv, _ := value.Value()
+		v, _ := json.Marshal(sv)
+		return fmt.Sprintf("%%%s%%", s.escapeLikeString(fmt.Sprintf("%s:%s", k, v)))
+	}
+	switch op.Op {
+	case ffapi.FilterOpEq:
+		return LikeEscape{field: pattern(op.Value)}, nil
+	case ffapi.FilterOpNeq:
+		return NotLikeEscape{field: pattern(op.Value)}, nil
+	case ffapi.FilterOpIn:
+		or := make(sq.Or, len(op.Values))
+		for i, v := range op.Values {
+			or[i] = LikeEscape{field: pattern(v)}
+		}
+		return or, nil
+	case ffapi.FilterOpNotIn:
+		and := make(sq.And, len(op.Values))
+		for i, v := range op.Values {
+			and[i] = NotLikeEscape{field: pattern(v)}
+		}
+		return and, nil
+	default:
+		return nil, i18n.NewError(ctx, i18n.MsgUnsupportedSQLOpInFilter, op.Op)
+	}
+}
+
 func (s *Database) filterOp(ctx context.Context, tableName string, op *ffapi.FilterInfo, tm map[string]string) (sq.Sqlizer, error) {
+	if op.MapKey != "" {
+		return s.filterMapKey(ctx, tableName, op, tm)
+	}
 	switch op.Op {
 	case ffapi.FilterOpOr:
 		return s.filterOr(ctx, tableName, op, tm)
@@ -41,6 +41,7 @@ var TestQueryFactory = &ffapi.QueryFields{
 	"topics":   &ffapi.FFStringArrayField{},
 	"type":     &ffapi.StringField{},
 	"address":  &ffapi.StringFieldLower{},
+	"labels":   &ffapi.MapField{},
 }
 
 func TestSQLQueryFactoryIgnoreInvalidFilterFields(t *testing.T) {
@@ -50,8 +51,6 @@ func TestSQLQueryFactoryIgnoreInvalidFilterFields(t *testing.T) {
 	f := fb.And(
 		fb.Eq("tag", "tag1"),
 	).
-		Sort("-notvalid").
-		Sort("notvalid").
 		GroupBy("notvalid")
 
 	sel := squirrel.Select("*").From("mytable")
@@ -66,6 +65,41 @@ func TestSQLQueryFactoryIgnoreInvalidFilterFields(t *testing.T) {
 	assert.Equal(t, "tag1", args[0])
 }
 
+func TestSQLQueryFactoryInvalidSortFields(t *testing.T) {
+	s, _ := NewMockProvider().UTInit()
+	fb := TestQueryFactory.NewFilter(context.Background())
+	f := fb.And(
+		fb.Eq("tag", "tag1"),
+	).
+		Sort("-notvalid").
+		Sort("tag", "alsonotvalid")
+
+	sel := squirrel.Select("*").From("mytable")
+	_, _, _, err := s.FilterSelect(context.Background(), "", sel, f, nil, []interface{}{"sequence"})
+	assert.Regexp(t, "FF00244.*notvalid,alsonotvalid", err)
+}
+
+func TestSQLQueryFactoryMultiColumnSort(t *testing.T) {
+	s, _ := NewMockProvider().UTInit()
+	fb := TestQueryFactory.NewFilter(context.Background())
+	f := fb.And(
+		fb.Eq("tag", "tag1"),
+	).
+		SortFields(
+			&ffapi.SortField{Field: "Created"},
+			&ffapi.SortField{Field: "tag", Descending: true, Nulls: ffapi.NullsLast},
+		).
+		Sort("-id")
+
+	sel := squirrel.Select("*").From("mytable")
+	sel, _, _, err := s.FilterSelect(context.Background(), "", sel, f, nil, []interface{}{"sequence"})
+	assert.NoError(t, err)
+
+	sqlFilter, _, err := sel.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM mytable WHERE (tag = ?) ORDER BY created, tag DESC NULLS LAST, id DESC", sqlFilter)
+}
+
 func TestSQLQueryFactory(t *testing.T) {
 	s, _ := NewMockProvider().UTInit()
 	s.IndividualSort = true
@@ -209,6 +243,37 @@ func TestSQLQueryFactoryEscapeLike(t *testing.T) {
 	assert.Equal(t, []interface{}{1, 1, 1, 1, 2, 2, 2, 2}, args)
 }
 
+func TestSQLQueryFactoryMapField(t *testing.T) {
+	s, _ := NewMockProvider().UTInit()
+	fb := TestQueryFactory.NewFilter(context.Background())
+	f := fb.And(
+		fb.Eq("labels.team", "pay_ments"),
+		fb.Neq("labels.env", "prod"),
+		fb.In("labels.purpose", []driver.Value{"a", "b"}),
+		fb.NotIn("labels.purpose", []driver.Value{"c"}),
+	)
+
+	sel := squirrel.Select("*").From("mytable")
+	sel, _, _, err := s.FilterSelect(context.Background(), "", sel, f, map[string]string{"labels": "label_json"}, []interface{}{"sequence"})
+	assert.NoError(t, err)
+
+	sqlFilter, args, err := sel.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM mytable WHERE (label_json LIKE ? ESCAPE '[' AND label_json NOT LIKE ? ESCAPE '[' AND (label_json LIKE ? ESCAPE '[' OR label_json LIKE ? ESCAPE '[') AND (label_json NOT LIKE ? ESCAPE '[')) ORDER BY seq DESC", sqlFilter)
+	assert.Equal(t, []interface{}{`%"team":"pay[_ments"%`, `%"env":"prod"%`, `%"purpose":"a"%`, `%"purpose":"b"%`, `%"purpose":"c"%`}, args)
+}
+
+func TestSQLQueryFactoryMapFieldBadOp(t *testing.T) {
+
+	s, _ := NewMockProvider().UTInit()
+	_, err := s.refineQuery(context.Background(), "", &ffapi.FilterInfo{
+		Op:     ffapi.FilterOpCont,
+		Field:  "labels",
+		MapKey: "team",
+	}, nil)
+	assert.Regexp(t, "FF00190", err)
+}
+
 func TestSQLQueryFactoryFinalizeFail(t *testing.T) {
 	s, _ := NewMockProvider().UTInit()
 	fb := TestQueryFactory.NewFilter(context.Background())
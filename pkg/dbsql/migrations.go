@@ -0,0 +1,162 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// MigrationStatus is the version of the schema of the database, and the migrations that are yet to be applied
+type MigrationStatus struct {
+	CurrentVersion uint                `json:"currentVersion"` // zero if no migrations have been applied
+	TargetVersion  uint                `json:"targetVersion"`  // the latest migration in the migrations directory
+	Dirty          bool                `json:"dirty"`          // a migration failed part way through, and the schema must be repaired manually
+	Pending        []*PendingMigration `json:"pending,omitempty"`
+}
+
+// PendingMigration is a migration that has not been applied to the database
+type PendingMigration struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationStatus reports the current and target versions of the schema, and the migrations that
+// Migrate would apply, without applying them. It is suitable for health reporting.
+func (s *Database) MigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	return s.Migrate(ctx, true)
+}
+
+// Migrate applies the pending migrations in the configured migrations directory in version order,
+// recording the version in the schema_migrations table, and returns the resulting status.
+// Concurrent instances are serialized by the lock of the migration driver of the provider (such as
+// an advisory lock on PostgreSQL), so each migration is only applied once.
+// A dry run returns the status with the migrations that would be applied, without applying them.
+// This is called by Init when migrations.auto is enabled.
+func (s *Database) Migrate(ctx context.Context, dryRun bool) (*MigrationStatus, error) {
+	if s.provider == nil {
+		return nil, i18n.NewError(ctx, i18n.MsgDBInitFailed)
+	}
+	fileURL := "file://" + s.migrationsDirectory
+	m, closeMigrate, err := s.newMigrate(ctx, fileURL)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
+	}
+	defer closeMigrate()
+
+	if !dryRun {
+		log.L(ctx).Infof("Running migrations in: %s", fileURL)
+		err = m.Up()
+		version, dirty, _ := m.Version()
+		log.L(ctx).Infof("Migrations now at: v=%d dirty=%t", version, dirty)
+		if err != nil && err != migrate.ErrNoChange {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
+		}
+	}
+
+	status := &MigrationStatus{}
+	version, dirty, err := m.Version()
+	if err != nil && err != migrate.ErrNilVersion {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
+	}
+	status.CurrentVersion, status.Dirty = version, dirty
+	if err := s.listMigrations(fileURL, status); err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgDBMigrationFailed)
+	}
+	if dryRun {
+		log.L(ctx).Infof("Migrations at: v=%d dirty=%t with %d pending", status.CurrentVersion, status.Dirty, len(status.Pending))
+	}
+	return status, nil
+}
+
+// newMigrate returns a migrate instance for the migrations in the directory, and a function to release
+// the source and connection it holds once the migrations are complete - but never the database itself
+func (s *Database) newMigrate(ctx context.Context, fileURL string) (m *migrate.Migrate, closeMigrate func(), err error) {
+	src, err := source.Open(fileURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeSource := func() { _ = src.Close() }
+
+	cp, ok := s.provider.(MigrationConnProvider)
+	if !ok {
+		// the driver is over the database, so closing it would close the database
+		driver, err := s.provider.GetMigrationDriver(s.db)
+		if err != nil {
+			closeSource()
+			return nil, nil, err
+		}
+		m, err = migrate.NewWithInstance("file", src, s.provider.MigrationsDir(), driver)
+		if err != nil {
+			closeSource()
+			return nil, nil, err
+		}
+		return m, closeSource, nil
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		closeSource()
+		return nil, nil, err
+	}
+	driver, err := cp.GetMigrationDriverForConn(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		closeSource()
+		return nil, nil, err
+	}
+	m, err = migrate.NewWithInstance("file", src, s.provider.MigrationsDir(), driver)
+	if err != nil {
+		_ = conn.Close()
+		closeSource()
+		return nil, nil, err
+	}
+	// closing the instance closes the source, and the driver which closes the connection
+	return m, func() { _, _ = m.Close() }, nil
+}
+
+// listMigrations sets the target version, and the migrations after the current version
+func (s *Database) listMigrations(fileURL string, status *MigrationStatus) error {
+	src, err := source.Open(fileURL)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	version, err := src.First()
+	for err == nil {
+		status.TargetVersion = version
+		if version > status.CurrentVersion {
+			r, name, readErr := src.ReadUp(version)
+			if readErr != nil {
+				return readErr
+			}
+			r.Close()
+			status.Pending = append(status.Pending, &PendingMigration{Version: version, Name: name})
+		}
+		version, err = src.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
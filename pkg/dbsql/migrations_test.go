@@ -0,0 +1,147 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSQLiteMigrationsTestDB(t *testing.T, dir string) *Database {
+	conf := config.RootSection("unittest.migrations")
+	InitSQLiteConfig(conf)
+	conf.Set(SQLConfDatasourceURL, "file::memory:")
+	conf.Set(SQLConfMigrationsAuto, false)
+	conf.Set(SQLConfMigrationsDirectory, dir)
+	conf.Set(SQLConfMaxConnections, 1)
+	db, err := NewSQLiteProvider(context.Background(), conf)
+	assert.NoError(t, err)
+	return db
+}
+
+func TestMigrateDryRunThenApply(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteMigrationsTestDB(t, "../../test/dbmigrations")
+	defer db.Close()
+
+	status, err := db.MigrationStatus(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), status.CurrentVersion)
+	assert.Equal(t, uint(3), status.TargetVersion)
+	assert.False(t, status.Dirty)
+	assert.Len(t, status.Pending, 3)
+	assert.Equal(t, uint(1), status.Pending[0].Version)
+	assert.NotEmpty(t, status.Pending[0].Name)
+
+	// The dry run did not apply anything
+	status, err = db.Migrate(ctx, true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), status.CurrentVersion)
+	assert.Len(t, status.Pending, 3)
+
+	status, err = db.Migrate(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), status.CurrentVersion)
+	assert.Equal(t, uint(3), status.TargetVersion)
+	assert.Empty(t, status.Pending)
+
+	// Running again is a no-op
+	status, err = db.Migrate(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), status.CurrentVersion)
+	assert.Empty(t, status.Pending)
+}
+
+func TestMigrateBadDirectory(t *testing.T) {
+	db := newSQLiteMigrationsTestDB(t, "../../test/does-not-exist")
+	defer db.Close()
+	_, err := db.MigrationStatus(context.Background())
+	assert.Regexp(t, "FF00184", err)
+}
+
+func TestMigrateNotInitialized(t *testing.T) {
+	_, err := (&Database{}).Migrate(context.Background(), false)
+	assert.Regexp(t, "FF00173", err)
+}
+
+func TestMigrateGetDriverFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.Database.provider = mp
+	mp.migrationsDirectory = "../../test/dbmigrations"
+	mp.GetMigrationDriverError = fmt.Errorf("pop")
+	_, err := mp.Migrate(context.Background(), true)
+	assert.Regexp(t, "FF00184.*pop", err)
+}
+
+func TestMigrateVersionFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.Database.provider = mp
+	mp.migrationsDirectory = "../../test/dbmigrations"
+	mp.mmg.On("Version").Return(0, false, fmt.Errorf("pop"))
+	_, err := mp.Migrate(context.Background(), true)
+	assert.Regexp(t, "FF00184.*pop", err)
+}
+
+type testMigrationConnProvider struct {
+	*MockProvider
+	conn *sql.Conn
+}
+
+func (p *testMigrationConnProvider) GetMigrationDriverForConn(_ context.Context, conn *sql.Conn) (migratedb.Driver, error) {
+	p.conn = conn
+	return p.mmg, p.GetMigrationDriverError
+}
+
+func TestMigrateDedicatedConnClosed(t *testing.T) {
+	mp := NewMockProvider()
+	p := &testMigrationConnProvider{MockProvider: mp}
+	mp.Database.provider = p
+	mp.Database.db = mp.mockDB
+	mp.migrationsDirectory = "../../test/dbmigrations"
+
+	// The driver, and so the connection, is closed after a failure
+	mp.mmg.On("Version").Return(0, false, fmt.Errorf("pop")).Once()
+	mp.mmg.On("Close").Return(nil).Once()
+	_, err := mp.Migrate(context.Background(), true)
+	assert.Regexp(t, "FF00184.*pop", err)
+	assert.NotNil(t, p.conn)
+
+	// And after success
+	mp.mmg.On("Version").Return(1, false, nil).Once()
+	mp.mmg.On("Close").Return(nil).Once()
+	status, err := mp.Migrate(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), status.CurrentVersion)
+	mp.mmg.AssertExpectations(t)
+
+	// The connection is closed if the driver cannot be created
+	mp.GetMigrationDriverError = fmt.Errorf("pop")
+	_, err = mp.Migrate(context.Background(), true)
+	assert.Regexp(t, "FF00184.*pop", err)
+	assert.ErrorIs(t, p.conn.PingContext(context.Background()), sql.ErrConnDone)
+
+	// Or cannot be obtained
+	mp.mockDB.Close()
+	_, err = mp.Migrate(context.Background(), true)
+	assert.Regexp(t, "FF00184", err)
+}
@@ -46,6 +46,10 @@ type MockProviderConfig struct {
 	GetMigrationDriverError error
 	IndividualSort          bool
 	MultiRowInsert          bool
+	StatementTimeout        bool
+	CountEstimate           bool
+	CurrentTimestamp        bool
+	NotifyChange            bool
 }
 
 func NewMockProvider() *MockProvider {
@@ -87,6 +91,18 @@ func (mp *MockProvider) Features() SQLFeatures {
 		return fmt.Sprintf(`<acquire lock %s>`, lockName)
 	}
 	features.MultiRowInsert = mp.MultiRowInsert
+	if mp.StatementTimeout {
+		features.StatementTimeout = PostgresStatementTimeout
+	}
+	if mp.CountEstimate {
+		features.CountEstimate = PostgresCountEstimate
+	}
+	if mp.CurrentTimestamp {
+		features.CurrentTimestamp = PostgresCurrentTimestamp
+	}
+	if mp.NotifyChange {
+		features.NotifyChange = PostgresNotifyChange
+	}
 	return features
 }
 
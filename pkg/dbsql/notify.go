@@ -0,0 +1,100 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// ChangeListener is an optional interface of a Provider, that receives the notifications published with the
+// NotifyChange feature - such as with PostgreSQL LISTEN. Listening requires a dedicated connection, so the
+// implementation is specific to the driver (for example pq.NewListener with lib/pq).
+type ChangeListener interface {
+	// Listen calls the callback with the payload of each notification on the channel, until the context is
+	// cancelled. It returns once listening has started, and must re-establish the connection if it is lost.
+	Listen(ctx context.Context, url string, channel string, callback func(payload string)) error
+}
+
+// PostgresNotifyChange uses pg_notify to publish the payload on the channel, which PostgreSQL delivers to
+// the listeners when the transaction commits (or discards if it rolls back)
+func PostgresNotifyChange(channel, payload string) (string, []interface{}) {
+	return "SELECT pg_notify($1, $2)", []interface{}{channel, payload}
+}
+
+// changeNotification is the payload of a notification published for a change event
+type changeNotification struct {
+	Origin string          `json:"origin"` // the Database that made the change, so it does not process its own changes
+	ID     string          `json:"id"`
+	Type   ChangeEventType `json:"type"`
+}
+
+// NotifyChangeTx publishes a change to a row of the table, to the instances sharing the database that listen with
+// ListenChanges. The notification is only delivered if the transaction commits. A no-op if the database does not
+// have the NotifyChange feature.
+func (s *Database) NotifyChangeTx(ctx context.Context, tx *TXWrapper, table string, id string, eventType ChangeEventType) error {
+	if s.features.NotifyChange == nil {
+		return nil
+	}
+	l := log.L(ctx)
+	payload, _ := json.Marshal(&changeNotification{Origin: s.instanceID, ID: id, Type: eventType})
+	sqlQuery, args := s.features.NotifyChange(table, string(payload))
+
+	stmtCtx, cancel, err := s.statementContext(ctx, tx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	before := time.Now()
+	l.Tracef(`SQL-> notify %s: %s`, table, payload)
+	_, err = tx.sqlTX.ExecContext(stmtCtx, sqlQuery, args...)
+	s.logIfSlow(ctx, "notify", table, sqlQuery, before)
+	if err != nil {
+		l.Errorf(`SQL notify failed: %s sql=[ %s ]`, err, sqlQuery)
+		return i18n.WrapError(ctx, err, i18n.MsgDBNotifyFailed)
+	}
+	l.Debugf(`SQL<- notify %s (%.2fms)`, table, floatMillisSince(before))
+	return nil
+}
+
+// ListenChanges calls the handler for each change made to the table by another instance sharing the database,
+// by a collection with NotifyChanges set, until the context is cancelled. Returns false if the database does not
+// support change notifications (such as SQLite), in which case the handler is never called.
+func (s *Database) ListenChanges(ctx context.Context, table string, handler func(id string, eventType ChangeEventType)) (bool, error) {
+	cl, ok := s.provider.(ChangeListener)
+	if !ok || s.features.NotifyChange == nil {
+		log.L(ctx).Debugf("Database '%s' does not support change notifications", s.provider.Name())
+		return false, nil
+	}
+	err := cl.Listen(ctx, s.url, table, func(payload string) {
+		var n changeNotification
+		if err := json.Unmarshal([]byte(payload), &n); err != nil {
+			log.L(ctx).Warnf("Invalid change notification on '%s': %s", table, err)
+			return
+		}
+		if n.Origin == s.instanceID {
+			return
+		}
+		log.L(ctx).Debugf("Change notification on '%s': %s (%d)", table, n.ID, n.Type)
+		handler(n.ID, n.Type)
+	})
+	return err == nil, err
+}
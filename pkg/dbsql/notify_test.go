@@ -0,0 +1,202 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbsql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockListenerProvider struct {
+	*MockProvider
+	listenErr error
+	url       string
+	channel   string
+	callback  func(payload string)
+}
+
+func (lp *mockListenerProvider) Listen(ctx context.Context, url string, channel string, callback func(payload string)) error {
+	lp.url = url
+	lp.channel = channel
+	lp.callback = callback
+	return lp.listenErr
+}
+
+type notifyPayload struct{ id string }
+
+func (np *notifyPayload) Match(v driver.Value) bool {
+	var n changeNotification
+	return json.Unmarshal([]byte(v.(string)), &n) == nil && n.ID == np.id
+}
+
+func TestNotifyChangesCRUD(t *testing.T) {
+	mp := NewMockProvider()
+	mp.NotifyChange = true
+	db, mock := mp.UTInit()
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.NotifyChanges = true
+	ctx := context.Background()
+	id := fftypes.NewUUID()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT.*").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("SELECT pg_notify").WithArgs("crudables", &notifyPayload{id: id.String()}).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectCommit()
+	err := tc.Insert(ctx, &TestCRUDable{ResourceBase: ResourceBase{ID: id}})
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE.*").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("SELECT pg_notify").WithArgs("crudables", &notifyPayload{id: id.String()}).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectCommit()
+	err = tc.Replace(ctx, &TestCRUDable{ResourceBase: ResourceBase{ID: id}})
+	assert.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE.*").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("SELECT pg_notify").WithArgs("crudables", &notifyPayload{id: id.String()}).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectCommit()
+	err = tc.Delete(ctx, id.String())
+	assert.NoError(t, err)
+
+	db.FakePSQLInsert = true
+	db.features.MultiRowInsert = true
+	id2 := fftypes.NewUUID()
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO crudables.*`).WillReturnRows(sqlmock.NewRows([]string{db.sequenceColumn}).AddRow(123).AddRow(234))
+	mock.ExpectExec("SELECT pg_notify").WithArgs("crudables", &notifyPayload{id: id.String()}).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectExec("SELECT pg_notify").WithArgs("crudables", &notifyPayload{id: id2.String()}).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectCommit()
+	err = tc.InsertMany(ctx, []*TestCRUDable{
+		{ResourceBase: ResourceBase{ID: id}},
+		{ResourceBase: ResourceBase{ID: id2}},
+	}, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotifyChangesFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.NotifyChange = true
+	db, mock := mp.UTInit()
+	db.FakePSQLInsert = true
+	db.features.MultiRowInsert = true
+	tc := newCRUDCollection(&db.Database, "ns1")
+	tc.NotifyChanges = true
+	ctx := context.Background()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE.*").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("SELECT pg_notify").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	err := tc.Replace(ctx, &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}})
+	assert.Regexp(t, "FF00317", err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE.*").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("SELECT pg_notify").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	err = tc.Delete(ctx, fftypes.NewUUID().String())
+	assert.Regexp(t, "FF00317", err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO crudables.*`).WillReturnRows(sqlmock.NewRows([]string{db.sequenceColumn}).AddRow(123))
+	mock.ExpectExec("SELECT pg_notify").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	err = tc.InsertMany(ctx, []*TestCRUDable{{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}}}, false)
+	assert.Regexp(t, "FF00317", err)
+
+	db.features.MultiRowInsert = false
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO crudables.*`).WillReturnRows(sqlmock.NewRows([]string{db.sequenceColumn}).AddRow(123))
+	mock.ExpectExec("SELECT pg_notify").WillReturnError(fmt.Errorf("pop"))
+	mock.ExpectRollback()
+	err = tc.Insert(ctx, &TestCRUDable{ResourceBase: ResourceBase{ID: fftypes.NewUUID()}})
+	assert.Regexp(t, "FF00317", err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestNotifyChangeTxStatementTimeoutFail(t *testing.T) {
+	mp := NewMockProvider()
+	mp.NotifyChange = true
+	mp.StatementTimeout = true
+	mp.config.Set(SQLConfStatementTimeout, "5s")
+	db, mock := mp.UTInit()
+	mock.ExpectBegin()
+	mock.ExpectExec("SET LOCAL statement_timeout.*").WillReturnError(fmt.Errorf("pop"))
+	ctx, tx, _, err := db.BeginOrUseTx(context.Background())
+	assert.NoError(t, err)
+	err = db.NotifyChangeTx(ctx, tx, "table1", "id1", Created)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListenChanges(t *testing.T) {
+	lp := &mockListenerProvider{MockProvider: NewMockProvider()}
+	lp.NotifyChange = true
+	err := lp.Init(context.Background(), lp, lp.config)
+	assert.NoError(t, err)
+
+	type change struct {
+		id        string
+		eventType ChangeEventType
+	}
+	var changes []change
+	ok, err := lp.ListenChanges(context.Background(), "table1", func(id string, eventType ChangeEventType) {
+		changes = append(changes, change{id, eventType})
+	})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "test", lp.url)
+	assert.Equal(t, "table1", lp.channel)
+
+	// Changes made by this instance are not passed to the handler
+	own, _ := json.Marshal(&changeNotification{Origin: lp.instanceID, ID: "id1", Type: Created})
+	lp.callback(string(own))
+	other, _ := json.Marshal(&changeNotification{Origin: fftypes.NewUUID().String(), ID: "id2", Type: Deleted})
+	lp.callback(string(other))
+	lp.callback("!json")
+	assert.Equal(t, []change{{"id2", Deleted}}, changes)
+
+	lp.listenErr = fmt.Errorf("pop")
+	ok, err = lp.ListenChanges(context.Background(), "table1", func(id string, eventType ChangeEventType) {})
+	assert.Regexp(t, "pop", err)
+	assert.False(t, ok)
+}
+
+func TestListenChangesUnsupported(t *testing.T) {
+	lp := &mockListenerProvider{MockProvider: NewMockProvider()}
+	err := lp.Init(context.Background(), lp, lp.config)
+	assert.NoError(t, err)
+	ok, err := lp.ListenChanges(context.Background(), "table1", func(id string, eventType ChangeEventType) {})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	db, _ := NewMockProvider().UTInit()
+	ok, err = db.ListenChanges(context.Background(), "table1", func(id string, eventType ChangeEventType) {})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -17,7 +17,10 @@
 package dbsql
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	migratedb "github.com/golang-migrate/migrate/v4/database"
@@ -28,6 +31,32 @@ type SQLFeatures struct {
 	MultiRowInsert    bool
 	PlaceholderFormat sq.PlaceholderFormat
 	AcquireLock       func(lockName string) string
+	// StatementTimeout if set returns a statement that sets the timeout for the remainder of the current
+	// transaction on the server, such as PostgresStatementTimeout. A zero duration means unlimited.
+	StatementTimeout func(timeout time.Duration) string
+	// CountEstimate if set wraps a SELECT query in a statement returning the planner's estimate of the rows it
+	// returns, as a single JSON value in the format of a Postgres plan - such as PostgresCountEstimate.
+	// Without it, approximate counts requested on a filter are exact.
+	CountEstimate func(selectQuery string) string
+	// CurrentTimestamp if set is an SQL expression for the current time on the database, in the unix nanoseconds
+	// that fftypes.FFTime columns are stored as - such as PostgresCurrentTimestamp. Required by collections with DBTimestamps.
+	CurrentTimestamp string
+	// NotifyChange if set returns a statement (and its arguments) that publishes a payload to the listeners on a
+	// channel when the transaction commits - such as PostgresNotifyChange. The notifications are received with
+	// Database.ListenChanges, where the Provider is also a ChangeListener.
+	NotifyChange func(channel, payload string) (string, []interface{})
+}
+
+const (
+	// PostgresCurrentTimestamp is the start time of the transaction (microsecond precision), so is the same for all rows it writes
+	PostgresCurrentTimestamp = "(EXTRACT(EPOCH FROM now()) * 1000000)::BIGINT * 1000"
+	// SQLiteCurrentTimestamp is the current time (millisecond precision)
+	SQLiteCurrentTimestamp = "CAST((julianday('now') - 2440587.5) * 86400000 AS INTEGER) * 1000000"
+)
+
+// PostgresStatementTimeout uses SET LOCAL to apply a statement_timeout for the remainder of the transaction
+func PostgresStatementTimeout(timeout time.Duration) string {
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())
 }
 
 func DefaultSQLProviderFeatures() SQLFeatures {
@@ -62,3 +91,11 @@ type Provider interface {
 	// ApplyInsertQueryCustomizations updates the INSERT query for returning the Sequence, and returns whether it needs to be run as a query to return the Sequence field
 	ApplyInsertQueryCustomizations(insert sq.InsertBuilder, requestConflictEmptyResult bool) (updatedInsert sq.InsertBuilder, runAsQuery bool)
 }
+
+// MigrationConnProvider can be implemented by a Provider to run migrations on a dedicated connection from the
+// pool, such as with postgres.WithConnection, rather than a driver created with GetMigrationDriver - which holds
+// a connection for the life of the database, and closes the database when it is closed. Closing the returned
+// driver must only close the connection, which is then returned to the pool once the migrations complete.
+type MigrationConnProvider interface {
+	GetMigrationDriverForConn(ctx context.Context, conn *sql.Conn) (migratedb.Driver, error)
+}
@@ -60,6 +60,7 @@ func (p *sqLiteProvider) Features() SQLFeatures {
 	features := DefaultSQLProviderFeatures()
 	features.PlaceholderFormat = sq.Dollar
 	features.UseILIKE = false // Not supported
+	features.CurrentTimestamp = SQLiteCurrentTimestamp
 	return features
 }
 
@@ -18,7 +18,9 @@ package eventstreams
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/dbsql"
@@ -30,7 +32,21 @@ import (
 type eventStreamBatch[DataType any] struct {
 	number     int64
 	events     []*Event[DataType]
+	maxEvents  int
+	sizeBytes  int64
 	batchTimer *time.Timer
+	keys       map[string]int // index of the event for each compaction key in the batch
+
+	orderingKeys map[string]bool // the ordering keys of the events in the batch
+}
+
+// inFlightBatch is a batch being delivered in the background, when more than one batch can be in flight
+type inFlightBatch[DataType any] struct {
+	batch      *eventStreamBatch[DataType]
+	checkpoint *streamCheckpoint // covers the batch, and is stored once it and all the batches before it complete
+	done       chan struct{}
+	delivered  bool
+	err        error
 }
 
 type activeStream[CT any, DT any] struct {
@@ -40,13 +56,31 @@ type activeStream[CT any, DT any] struct {
 	batchNumber   int64
 	filterSkipped int64
 	EventStreamStatistics
-	eventLoopDone chan struct{}
-	batchLoopDone chan struct{}
-	events        chan *Event[DT]
+	eventLoopDone   chan struct{}
+	batchLoopDone   chan struct{}
+	metricsLoopDone chan struct{}
+	events          chan *Event[DT]
+
+	drainOnce      sync.Once
+	drainRequested chan struct{}
+	drained        chan struct{}
 
 	checkpointLock       sync.Mutex
-	dispatchedCheckpoint string
-	queuedCheckpoint     string
+	detectedCheckpoint   streamCheckpoint
+	dispatchedCheckpoint *streamCheckpoint
+	queuedCheckpoint     *streamCheckpoint
+
+	statsMux    sync.Mutex     // guards the statistics, updated by the batch loop, the checkpoint routine and batches delivered in parallel
+	dispatchers sync.WaitGroup // batches being delivered in the background
+}
+
+// streamCheckpoint is the position of the unnamed source, and of each named sub-source,
+// along with the last event delivered that is stored alongside it
+type streamCheckpoint struct {
+	sequenceID    string
+	subSources    SubSourceCheckpoints
+	lastDelivered *LastDeliveredEvent
+	delivered     int64 // the delivered count of the stream when the checkpoint was taken
 }
 
 func (es *eventStream[CT, DT]) newActiveStream() *activeStream[CT, DT] {
@@ -57,39 +91,114 @@ func (es *eventStream[CT, DT]) newActiveStream() *activeStream[CT, DT] {
 		cancelCtx:   cancelCtx,
 		EventStreamStatistics: EventStreamStatistics{
 			StartTime: fftypes.Now(),
+			backlog:   &streamBacklog{},
 		},
-		eventLoopDone: make(chan struct{}),
-		batchLoopDone: make(chan struct{}),
-		events:        make(chan *Event[DT], *es.spec.BatchSize),
+		eventLoopDone:   make(chan struct{}),
+		batchLoopDone:   make(chan struct{}),
+		metricsLoopDone: make(chan struct{}),
+		events:          make(chan *Event[DT], es.maxBatchSize()),
+		drainRequested:  make(chan struct{}),
+		drained:         make(chan struct{}),
 	}
 	go as.runEventLoop()
 	go as.runBatchLoop()
+	if es.esm.config.MetricsManager != nil {
+		go as.runBacklogMetricsLoop()
+	} else {
+		close(as.metricsLoopDone)
+	}
 	return as
 }
 
 func (as *activeStream[CT, DT]) runEventLoop() {
 	defer close(as.eventLoopDone)
 
+	// Wait for a slot, if the number of streams starting concurrently is limited.
+	// The slot is released once the stream has loaded its checkpoint and joined its source.
+	if !as.esm.streamLimiter.acquire(as.ctx) {
+		log.L(as.ctx).Debugf("event loop exiting before start")
+		return
+	}
+	started := false
+	releaseStartSlot := func() {
+		if !started {
+			started = true
+			as.esm.streamLimiter.release()
+		}
+	}
+	defer releaseStartSlot()
+
 	// Read the last checkpoint for this stream
-	checkpointSequenceID, err := as.loadCheckpoint()
+	checkpoint, err := as.loadCheckpoint()
 	if err == nil {
+		// Sub-sources that do not deliver events before the next checkpoint must retain their position
+		as.detectedCheckpoint = streamCheckpoint{
+			sequenceID:    checkpoint.sequenceID,
+			subSources:    checkpoint.subSources.copy(),
+			lastDelivered: checkpoint.lastDelivered,
+		}
+		var tip *catchupTip
+		if as.spec.catchupOnly() {
+			if tip, err = as.loadCatchupTip(); err != nil {
+				log.L(as.ctx).Debugf("event loop exiting (%v)", err)
+				return
+			}
+			if tip.sequenceID == "" || (checkpoint.sequenceID != "" && tip.passed(checkpoint.sequenceID)) {
+				// there is nothing to deliver, such as when restarted after catching up but before completing
+				as.completeCatchup(tip)
+				return
+			}
+		}
+		if as.spec.SharedSource != nil {
+			// The shared source delivers to this stream until it stops
+			ss := as.esm.getSharedSource(*as.spec.SharedSource)
+			ss.join(as, checkpoint)
+			releaseStartSlot()
+			<-as.ctx.Done()
+			ss.leave(as)
+			log.L(as.ctx).Debugf("event loop exiting shared source '%s'", ss.name)
+			return
+		}
 		// Run the inner source read loop until it exits
-		err = as.retry.Do(as.ctx, "source run loop", func(attempt int) (retry bool, err error) {
-			if err = as.runSourceLoop(checkpointSequenceID); err != nil {
-				log.L(as.ctx).Errorf("source loop error: %s", err)
-				return true, err
+		releaseStartSlot()
+		caughtUp := false
+		err = as.esm.config.RestartRetry.Do(as.ctx, "source run loop", func(attempt int) (retry bool, err error) {
+			caughtUp, err = as.runSourceLoop(checkpoint, tip)
+			if caughtUp {
+				return false, nil
 			}
-			// the Run loop must only exit with nil error if the context is closed
-			// (which we also signal with an Exit instruction)
-			return false, nil
+			if as.ctx.Err() != nil {
+				// the Run loop must only exit with nil error if the context is closed
+				// (which we also signal with an Exit instruction)
+				return false, err
+			}
+			if err == nil {
+				err = i18n.NewError(as.ctx, i18n.MsgESSourceRunExited)
+			}
+			log.L(as.ctx).Errorf("source loop error: %s", err)
+			as.recordRestart(err)
+			return true, err
 		})
-
+		if caughtUp {
+			as.completeCatchup(tip)
+			return
+		}
 	}
 	// Retry will only return an error if the context is cancelled
 	log.L(as.ctx).Debugf("event loop exiting (%v)", err)
 }
 
-func (as *activeStream[CT, DT]) loadCheckpoint() (sequencedID string, err error) {
+// recordRestart updates the statistics each time the source run loop is restarted from the checkpoint,
+// so that a stream that is flapping does not look like a healthy started stream
+func (as *activeStream[CT, DT]) recordRestart(err error) {
+	as.updateStats(func(stats *EventStreamStatistics) {
+		stats.Restarts++
+		stats.LastRestartTime = fftypes.Now()
+		stats.LastRestartError = err.Error()
+	})
+}
+
+func (as *activeStream[CT, DT]) loadCheckpoint() (checkpoint streamCheckpoint, err error) {
 	err = as.retry.Do(as.ctx, "load checkpoint", func(attempt int) (retry bool, err error) {
 		log.L(as.ctx).Debugf("Loading checkpoint: %s", as.spec.GetID())
 		cp, err := as.persistence.Checkpoints().GetByID(as.ctx, as.spec.GetID())
@@ -97,13 +206,17 @@ func (as *activeStream[CT, DT]) loadCheckpoint() (sequencedID string, err error)
 			return true, err
 		}
 		if cp != nil && cp.SequenceID != nil {
-			sequencedID = *cp.SequenceID
+			checkpoint.sequenceID = *cp.SequenceID
 		} else if as.spec.InitialSequenceID != nil {
-			sequencedID = *as.spec.InitialSequenceID
+			checkpoint.sequenceID = *as.spec.InitialSequenceID
+		}
+		if cp != nil {
+			checkpoint.subSources = cp.SubSources
+			checkpoint.lastDelivered = cp.LastDelivered
 		}
 		return true, err
 	})
-	return sequencedID, err
+	return checkpoint, err
 }
 
 func (as *activeStream[CT, DT]) checkFilter(event *Event[DT]) bool {
@@ -113,23 +226,46 @@ func (as *activeStream[CT, DT]) checkFilter(event *Event[DT]) bool {
 	return true
 }
 
-func (as *activeStream[CT, DT]) runSourceLoop(initialCheckpointSequenceID string) error {
+// runSourceLoop runs the source until it exits, or for a catchupOnly stream until the tip is reached - in which
+// case it returns true
+func (as *activeStream[CT, DT]) runSourceLoop(initialCheckpoint streamCheckpoint, tip *catchupTip) (caughtUp bool, err error) {
 	// Responsibility of the source to block until events are available, or the context is closed.
-	log.L(as.ctx).Infof("Initiating source with checkpoint: %s", initialCheckpointSequenceID)
-	return as.esm.runtime.Run(as.ctx, as.spec, initialCheckpointSequenceID, func(events []*Event[DT]) SourceInstruction {
+	log.L(as.ctx).Infof("Initiating source with checkpoint: %s subSources=%v", initialCheckpoint.sequenceID, initialCheckpoint.subSources)
+	// checkTip returns whether the sequence can be queued, and records when the tip is reached
+	checkTip := func(sequenceID string) bool {
+		if tip == nil {
+			return true
+		}
+		atTip, beyondTip := tip.reached(sequenceID)
+		caughtUp = caughtUp || atTip || beyondTip
+		return !beyondTip
+	}
+	runCtx := withProgress(as.ctx, func(sequenceID, subSource string) SourceInstruction {
+		if !checkTip(sequenceID) || !as.queueProgress(as.ctx, sequenceID, subSource) || caughtUp {
+			return Exit
+		}
+		return Continue
+	})
+	err = as.esm.runtime.Run(runCtx, as.spec, initialCheckpoint.sequenceID, initialCheckpoint.subSources.copy(), func(events []*Event[DT]) SourceInstruction {
 		log.L(as.ctx).Debugf("Received batch of %d events from source", len(events))
 
 		// There's no direct connection between any batching used in the source routine,
 		// and our batch based delivery. This is intentional - allowing separate optimization
 		// of each routine for the source data store/stream.
 		for _, event := range events {
-			if event != nil {
-				select {
-				case as.events <- event:
-				case <-as.ctx.Done():
-					// Event stream has has shut down
-					return Exit
-				}
+			if event == nil {
+				continue
+			}
+			if !checkTip(event.SequenceID) {
+				// Events after the tip of a catchupOnly stream are never delivered
+				return Exit
+			}
+			if !as.queueEvent(as.ctx, event) {
+				// Event stream has has shut down
+				return Exit
+			}
+			if caughtUp {
+				return Exit
 			}
 		}
 
@@ -143,59 +279,244 @@ func (as *activeStream[CT, DT]) runSourceLoop(initialCheckpointSequenceID string
 		// Instruct the run loop to continue
 		return Continue
 	})
+	return caughtUp && as.ctx.Err() == nil, err
+}
 
+// queueEvent pushes an event to the batch loop, returning false if the stream or the supplied run context closes first
+func (as *activeStream[CT, DT]) queueEvent(runCtx context.Context, event *Event[DT]) bool {
+	// counted before the push, as the batch loop might consume it immediately
+	as.backlog.queue(1)
+	as.backlog.sourceActive()
+	select {
+	case as.events <- event:
+		return true
+	case <-as.ctx.Done():
+	case <-runCtx.Done():
+	}
+	as.backlog.queue(-1)
+	return false
 }
 
 func (as *activeStream[CT, DT]) runBatchLoop() {
 	defer close(as.batchLoopDone)
+	defer as.dispatchers.Wait() // nothing is delivered once the batch loop is done
 
 	var batch *eventStreamBatch[DT]
-	batchTimeout := time.Duration(*as.spec.BatchTimeout)
 	var noBatchActive <-chan time.Time = make(chan time.Time) // never pops
 	batchTimedOut := noBatchActive
+	drainRequested := as.drainRequested
+	maxInFlight := as.maxInFlightBatches()
+	var inFlight []*inFlightBatch[DT]
+	var noneInFlight <-chan struct{} = make(chan struct{}) // never closes
+	oldestInFlightDone := func() <-chan struct{} {
+		if len(inFlight) == 0 {
+			return noneInFlight
+		}
+		return inFlight[0].done
+	}
+	// completeOldest waits for the oldest batch in flight, then records its delivery and checkpoints it,
+	// so batches are checkpointed in order whatever order they are delivered in. Returns false if the
+	// batch loop must exit
+	completeOldest := func() bool {
+		f := inFlight[0]
+		select {
+		case <-f.done:
+		case <-as.ctx.Done():
+			log.L(as.ctx).Debugf("batch loop done with %d batches in flight", len(inFlight))
+			return false
+		}
+		inFlight = inFlight[1:]
+		if f.err != nil {
+			log.L(as.ctx).Debugf("batch loop done: %s", f.err)
+			return false
+		}
+		if f.delivered {
+			as.recordDelivered(f.batch.events[len(f.batch.events)-1])
+		}
+		if batch == nil && len(inFlight) == 0 {
+			as.backlog.batchDelivered(len(f.batch.events))
+		} else {
+			as.backlog.queue(-int64(len(f.batch.events))) // later events are still pending
+		}
+		if !as.atMostOnce() {
+			as.backlog.eventsDelivered(len(f.batch.events))
+			f.checkpoint.lastDelivered = as.detectedCheckpoint.lastDelivered
+			f.checkpoint.delivered = as.backlog.deliveredCount()
+			as.dispatchCheckpointSnap(f.checkpoint)
+		}
+		return true
+	}
+	flushBatch := func() bool {
+		if as.atMostOnce() {
+			// the checkpoint must be stored before we attempt delivery, and covers the batch
+			as.backlog.eventsDelivered(len(batch.events))
+			as.dispatchCheckpoint()
+			if as.ctx.Err() != nil {
+				log.L(as.ctx).Debugf("batch loop done before dispatch")
+				return false
+			}
+		}
+		if maxInFlight > 1 {
+			// wait for a slot, then deliver the batch in the background - it is completed by completeOldest
+			for len(inFlight) >= maxInFlight {
+				if !completeOldest() {
+					return false
+				}
+			}
+			// events with the same ordering key are delivered in order, so wait for the batches in flight that
+			// share a key with this one - they are still checkpointed in order by completeOldest
+			for _, f := range inFlight {
+				if f.batch.sharesOrderingKey(batch) {
+					select {
+					case <-f.done:
+					case <-as.ctx.Done():
+						log.L(as.ctx).Debugf("batch loop done waiting for ordering key")
+						return false
+					}
+				}
+			}
+			inFlight = append(inFlight, as.dispatchInBackground(batch))
+			batch.batchTimer.Stop()
+			batchTimedOut = noBatchActive
+			batch = nil
+			return true
+		}
+		// attempt dispatch (only returns err on exit)
+		if err := as.dispatchBatch(batch); err != nil {
+			log.L(as.ctx).Debugf("batch loop done: %s", err)
+			return false
+		}
+		// reset batch
+		if !as.atMostOnce() {
+			as.backlog.eventsDelivered(len(batch.events))
+		}
+		as.backlog.batchDelivered(len(batch.events))
+		batch.batchTimer.Stop()
+		batchTimedOut = noBatchActive
+		batch = nil
+		return true
+	}
+	// addEvent adds an event to the batch, returning false if the batch loop must exit
+	addEvent := func(event *Event[DT]) bool {
+		if event.progress {
+			as.detectProgress(event, batch != nil || len(inFlight) > 0)
+			return true
+		}
+		matched := as.checkFilter(event)
+		var eventSize int64
+		if matched {
+			eventSize = as.eventSize(event)
+			if batch != nil && as.spec.MaxBatchSizeBytes != nil && batch.sizeBytes+eventSize > int64(*as.spec.MaxBatchSizeBytes) {
+				// This event would take the batch over the size limit, so it goes in the next one.
+				// We dispatch the current batch before detecting this event, so it is not checkpointed with it.
+				if !flushBatch() {
+					return false
+				}
+				as.batchCheckpoint()
+			}
+		}
+		as.updateStats(func(stats *EventStreamStatistics) { stats.HighestDetected = event.SequenceID })
+		as.detectEvent(event)
+		if !matched {
+			as.filterSkipped++
+			as.backlog.queue(-1)
+		} else {
+			if batch == nil {
+				as.backlog.batchStarted(eventTime(event))
+				as.batchNumber++
+				maxEvents := as.capBatchSize(as.nextBatchSize(event.SequenceID))
+				_, batchTimeout := as.batchSettings()
+				batch = &eventStreamBatch[DT]{
+					number:     as.batchNumber,
+					batchTimer: time.NewTimer(batchTimeout),
+					events:     make([]*Event[DT], 0, maxEvents),
+					maxEvents:  maxEvents,
+				}
+				batchTimedOut = batch.batchTimer.C
+			}
+			if key, ok := as.compactionKey(event); ok {
+				if removed := batch.compact(key); removed != nil {
+					// only the latest event for the key is delivered, and the checkpoint includes both
+					log.L(as.ctx).Tracef("Event %s replaced by %s for compaction key %s", removed.SequenceID, event.SequenceID, key)
+					batch.sizeBytes -= as.eventSize(removed)
+					as.updateStats(func(stats *EventStreamStatistics) { stats.CompactedEvents++ })
+					as.backlog.queue(-1)
+				}
+			}
+			if key, ok := as.orderingKey(event); ok {
+				batch.addOrderingKey(key)
+			}
+			batch.events = append(batch.events, event)
+			batch.sizeBytes += eventSize
+		}
+		return true
+	}
+	batchFull := func() bool {
+		return batch != nil && (len(batch.events) >= batch.maxEvents ||
+			(as.spec.MaxBatchSizeBytes != nil && batch.sizeBytes >= int64(*as.spec.MaxBatchSizeBytes)))
+	}
 	for {
 
-		// Pull events out of the event loop, and assemble them into batches with a max + timeout
+		// Pull events out of the event loop, and assemble them into batches with a max + timeout,
+		// and optionally a maximum accumulated size in bytes - whichever is hit first
 		var timedOut = false
+		batchDispatched := false
 		select {
 		case <-as.ctx.Done():
 			log.L(as.ctx).Debugf("batch loop done")
 			return
 		case <-batchTimedOut:
 			timedOut = true
-		case event := <-as.events:
-			as.HighestDetected = event.SequenceID
-			if !as.checkFilter(event) {
-				as.filterSkipped++
-			} else {
-				if batch == nil {
-					as.batchNumber++
-					batch = &eventStreamBatch[DT]{
-						number:     as.batchNumber,
-						batchTimer: time.NewTimer(batchTimeout),
-						events:     make([]*Event[DT], 0, *as.spec.BatchSize),
+		case <-oldestInFlightDone():
+			if !completeOldest() {
+				return
+			}
+			continue
+		case <-drainRequested:
+			// deliver the events already queued, and the batch being assembled, and store the
+			// checkpoint - before the stream is stopped
+			drainRequested = nil
+			for queued := len(as.events); queued > 0; queued-- {
+				if !addEvent(<-as.events) {
+					return
+				}
+				if batchFull() {
+					if !flushBatch() {
+						return
 					}
-					batchTimedOut = batch.batchTimer.C
+					as.batchCheckpoint()
+				}
+			}
+			if batch != nil {
+				if !flushBatch() {
+					return
 				}
-				batch.events = append(batch.events, event)
+				as.batchCheckpoint()
+			}
+			for len(inFlight) > 0 {
+				if !completeOldest() {
+					return
+				}
+			}
+			as.waitCheckpointsIdle()
+			close(as.drained)
+			continue
+		case event := <-as.events:
+			if !addEvent(event) {
+				return
 			}
 		}
-		batchDispatched := false
-		if batch != nil && (len(batch.events) >= *as.spec.BatchSize || timedOut) {
-			// attempt dispatch (only returns err on exit)
-			if err := as.dispatchBatch(batch); err != nil {
-				log.L(as.ctx).Debugf("batch loop done: %s", err)
+		if batchFull() || (batch != nil && timedOut) {
+			if !flushBatch() {
 				return
 			}
 			batchDispatched = true
-			// reset batch
-			batch.batchTimer.Stop()
-			batchTimedOut = noBatchActive
-			batch = nil
 		}
-		if batchDispatched || as.filterSkipped > as.esm.config.Checkpoints.UnmatchedEventThreshold {
+		if batchDispatched {
+			as.batchCheckpoint()
+		} else if as.filterSkipped > as.esm.config.Checkpoints.UnmatchedEventThreshold && len(inFlight) == 0 {
 			// At this point we are sure that the highest detected event, is above the highest
-			// acknowledged event.
+			// acknowledged event - and there are no batches in flight that it would also cover.
 			as.dispatchCheckpoint()
 			// Reset our skip tracker
 			as.filterSkipped = 0
@@ -204,9 +525,140 @@ func (as *activeStream[CT, DT]) runBatchLoop() {
 	}
 }
 
+// maxInFlightBatches is the number of batches that can be dispatched but not yet acknowledged at once,
+// which is one unless set on the stream
+func (es *eventStream[CT, DT]) maxInFlightBatches() int {
+	if es.spec.MaxInFlightBatches == nil {
+		return 1
+	}
+	return *es.spec.MaxInFlightBatches
+}
+
+// dispatchInBackground starts delivery of a batch in parallel with the batch loop, taking the checkpoint
+// that covers the batch before the batch loop detects any more events
+func (as *activeStream[CT, DT]) dispatchInBackground(batch *eventStreamBatch[DT]) *inFlightBatch[DT] {
+	f := &inFlightBatch[DT]{
+		batch:      batch,
+		checkpoint: as.snapCheckpoint(),
+		done:       make(chan struct{}),
+	}
+	as.dispatchers.Add(1)
+	go func() {
+		defer as.dispatchers.Done()
+		defer close(f.done)
+		f.delivered, f.err = as.deliverBatch(batch)
+	}()
+	return f
+}
+
+// maxBatchSize is the largest batch the stream might assemble
+func (es *eventStream[CT, DT]) maxBatchSize() int {
+	if es.spec.CatchupBatchSize != nil && *es.spec.CatchupBatchSize > *es.spec.BatchSize {
+		return *es.spec.CatchupBatchSize
+	}
+	return *es.spec.BatchSize
+}
+
+// nextBatchSize is the catchupBatchSize while the source has more than that many events after the first
+// event of the batch, and the batchSize once near the tip. The size is fixed when each batch is started,
+// so switching between them only moves the boundaries between batches.
+func (as *activeStream[CT, DT]) nextBatchSize(sequenceID string) int {
+	batchSize, _ := as.batchSettings()
+	if as.spec.CatchupBatchSize == nil {
+		return batchSize
+	}
+	resolver, ok := as.esm.runtime.(SequenceLagResolver)
+	if !ok {
+		return batchSize
+	}
+	lag, err := resolver.SequenceLag(as.ctx, sequenceID)
+	if err != nil {
+		log.L(as.ctx).Warnf("Failed to get lag after sequence '%s', using batchSize: %s", sequenceID, err)
+		return batchSize
+	}
+	if lag > int64(*as.spec.CatchupBatchSize) {
+		log.L(as.ctx).Debugf("Catching up with lag %d after sequence '%s'", lag, sequenceID)
+		return *as.spec.CatchupBatchSize
+	}
+	return batchSize
+}
+
+// capacityReporter is implemented by actions whose consumer can advertise how many events it can accept
+type capacityReporter interface {
+	capacity() (events int, advertised bool)
+}
+
+// capBatchSize limits the batch to the capacity the consumer advertises, so it can be sent in one go.
+// The action holds back any events beyond the capacity at the time it is sent.
+func (as *activeStream[CT, DT]) capBatchSize(batchSize int) int {
+	cr, ok := as.action.(capacityReporter)
+	if !ok {
+		return batchSize
+	}
+	if capacity, advertised := cr.capacity(); advertised && capacity > 0 && capacity < batchSize {
+		log.L(as.ctx).Debugf("Limiting batch to the capacity %d of the consumer", capacity)
+		return capacity
+	}
+	return batchSize
+}
+
+// eventTime is the time the event occurred if provided by the source, otherwise the time it was received
+func eventTime[DT any](event *Event[DT]) time.Time {
+	if event.Timestamp != nil {
+		return *event.Timestamp.Time()
+	}
+	return time.Now()
+}
+
+// runBacklogMetricsLoop periodically emits the delivery backlog of the stream, until it is stopped.
+// This is separate to the batch loop, so the metrics continue to climb while it is blocked on a slow consumer.
+func (as *activeStream[CT, DT]) runBacklogMetricsLoop() {
+	defer close(as.metricsLoopDone)
+	labels := as.esm.streamMetricLabels(as.spec)
+	if len(as.esm.config.MetricsLabels) > 0 {
+		// the labels of the stream might have changed since it last ran
+		as.esm.deleteStreamMetrics(as.ctx, as.spec.GetID())
+	}
+	ticker := time.NewTicker(as.esm.backlogMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			as.esm.emitBacklogMetrics(as.ctx, labels, as.backlog.queueDepth(), as.backlog.oldestPendingAge(), as.sourceIdle())
+			as.esm.emitConsumerMetrics(as.ctx, as.spec, labels, false)
+		case <-as.ctx.Done():
+			// the stream is no longer delivering, so it has no backlog
+			as.esm.emitBacklogMetrics(as.ctx, labels, 0, 0, 0)
+			as.esm.emitConsumerMetrics(as.ctx, as.spec, labels, true)
+			return
+		}
+	}
+}
+
+func (as *activeStream[CT, DT]) atMostOnce() bool {
+	return as.spec.DeliveryMode != nil && *as.spec.DeliveryMode == DeliveryModeAtMostOnce
+}
+
+// batchCheckpoint is called after a batch is dispatched. For at-least-once delivery this checkpoints
+// the batch, whereas for at-most-once the batch was checkpointed before dispatch. Batches delivered in
+// the background are checkpointed as they complete instead.
+func (as *activeStream[CT, DT]) batchCheckpoint() {
+	if !as.atMostOnce() && as.maxInFlightBatches() == 1 {
+		as.dispatchCheckpoint()
+	}
+	// Reset our skip tracker
+	as.filterSkipped = 0
+}
+
 func (as *activeStream[CT, DT]) dispatchCheckpoint() {
-	if as.pushCheckpoint() {
-		if as.esm.config.Checkpoints.Asynchronous {
+	as.dispatchCheckpointSnap(as.snapCheckpoint())
+}
+
+func (as *activeStream[CT, DT]) dispatchCheckpointSnap(cp *streamCheckpoint) {
+	if as.pushCheckpoint(cp) {
+		// For at-most-once delivery, checkpoints are always written in-line, so that each one is stored
+		// before the batch is dispatched
+		if as.esm.config.Checkpoints.Asynchronous && !as.atMostOnce() {
 			go as.checkpointRoutine() // async
 		} else {
 			as.checkpointRoutine() // in-line
@@ -214,37 +666,95 @@ func (as *activeStream[CT, DT]) dispatchCheckpoint() {
 	}
 }
 
-func (as *activeStream[CT, DT]) pushCheckpoint() bool {
+// eventSize returns the serialized size of an event, for enforcing the maximum batch size in bytes.
+// It is only calculated when a limit is set on the stream.
+func (as *activeStream[CT, DT]) eventSize(event *Event[DT]) int64 {
+	if as.spec.MaxBatchSizeBytes == nil {
+		return 0
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		log.L(as.ctx).Warnf("Unable to calculate size of event %s: %s", event.SequenceID, err)
+		return 0
+	}
+	return int64(len(b))
+}
+
+// detectEvent is only called from the batch loop, which owns detectedCheckpoint
+func (as *activeStream[CT, DT]) detectEvent(event *Event[DT]) {
+	if event.SubSource == "" {
+		as.detectedCheckpoint.sequenceID = event.SequenceID
+		return
+	}
+	if as.detectedCheckpoint.subSources == nil {
+		as.detectedCheckpoint.subSources = SubSourceCheckpoints{}
+	}
+	as.detectedCheckpoint.subSources[event.SubSource] = event.SequenceID
+}
+
+// snapCheckpoint takes a copy of the detected checkpoint, as the batch loop continues to update the detected sub-sources
+func (as *activeStream[CT, DT]) snapCheckpoint() *streamCheckpoint {
+	return &streamCheckpoint{
+		sequenceID:    as.detectedCheckpoint.sequenceID,
+		subSources:    as.detectedCheckpoint.subSources.copy(),
+		lastDelivered: as.detectedCheckpoint.lastDelivered,
+		delivered:     as.backlog.deliveredCount(),
+	}
+}
+
+func (as *activeStream[CT, DT]) pushCheckpoint(cp *streamCheckpoint) bool {
 	as.checkpointLock.Lock()
 	defer as.checkpointLock.Unlock()
-	if as.dispatchedCheckpoint == "" {
-		as.dispatchedCheckpoint = as.HighestDetected
+	if as.dispatchedCheckpoint == nil {
+		as.dispatchedCheckpoint = cp
 		return true // we need to run the checkpoint worker
 	}
-	as.queuedCheckpoint = as.HighestDetected
+	as.queuedCheckpoint = cp
 	return false // it'll be picked up before the existing worker ends
 }
 
-func (as *activeStream[CT, DT]) popCheckpoint() string {
+func (as *activeStream[CT, DT]) popCheckpoint() *streamCheckpoint {
 	as.checkpointLock.Lock()
 	defer as.checkpointLock.Unlock()
-	checkpointSequenceID := as.dispatchedCheckpoint
+	cp := as.dispatchedCheckpoint
 	as.dispatchedCheckpoint = as.queuedCheckpoint
-	as.queuedCheckpoint = ""
-	return checkpointSequenceID
+	as.queuedCheckpoint = nil
+	return cp
+}
+
+// waitCheckpointsIdle waits for any asynchronous checkpoint write to complete, or the stream to stop
+func (as *activeStream[CT, DT]) waitCheckpointsIdle() {
+	for {
+		as.checkpointLock.Lock()
+		idle := as.dispatchedCheckpoint == nil
+		as.checkpointLock.Unlock()
+		if idle {
+			return
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-as.ctx.Done():
+			return
+		}
+	}
 }
 
 func (as *activeStream[CT, DT]) checkpointRoutine() {
 	for {
-		checkpointSequenceID := as.popCheckpoint()
-		if checkpointSequenceID == "" {
+		cp := as.popCheckpoint()
+		if cp == nil {
 			return // We're done
 		}
+		checkpoint := &EventStreamCheckpoint{
+			ID:            ptrTo(as.spec.GetID()), // the ID of the stream is the ID of the checkpoint
+			SubSources:    cp.subSources,
+			LastDelivered: cp.lastDelivered,
+		}
+		if cp.sequenceID != "" {
+			checkpoint.SequenceID = &cp.sequenceID
+		}
 		err := as.retry.Do(as.ctx, "checkpoint", func(attempt int) (retry bool, err error) {
-			_, err = as.esm.persistence.Checkpoints().Upsert(as.ctx, &EventStreamCheckpoint{
-				ID:         ptrTo(as.spec.GetID()), // the ID of the stream is the ID of the checkpoint
-				SequenceID: &checkpointSequenceID,
-			}, dbsql.UpsertOptimizationExisting)
+			_, err = as.esm.persistence.Checkpoints().Upsert(as.ctx, checkpoint, dbsql.UpsertOptimizationExisting)
 			return true, err
 		})
 		if err != nil {
@@ -253,56 +763,154 @@ func (as *activeStream[CT, DT]) checkpointRoutine() {
 			return
 		}
 		// lazy write of stored checkpoint back to stats
-		as.Checkpoint = checkpointSequenceID
+		as.updateStats(func(stats *EventStreamStatistics) {
+			stats.Checkpoint = cp.sequenceID
+			stats.SubSourceCheckpoints = cp.subSources
+		})
+		as.backlog.checkpointStored(cp.delivered)
 	}
 }
 
-// performActionWithRetry performs an action, with exponential back-off retry up
-// to a given threshold. Only returns error in the case that the context is closed.
-func (as *activeStream[CT, DT]) dispatchBatch(batch *eventStreamBatch[DT]) (err error) {
-	as.LastDispatchNumber = batch.number
-	as.LastDispatchTime = fftypes.Now()
-	as.LastDispatchFailure = ""
-	as.LastDispatchAttempts = 0
-	as.LastDispatchStatus = DispatchStatusDispatching
-	as.HighestDispatched = batch.events[len(batch.events)-1].SequenceID
+// startBlockedAlert arms a timer that alerts if the dispatch of the current batch is still
+// outstanding after the configured threshold. The returned function must be called once
+// the dispatch returns, and reports the resumption of delivery if the alert fired.
+func (as *activeStream[CT, DT]) startBlockedAlert(batchNumber int64, dispatchStart time.Time) func() {
+	threshold := time.Duration(as.esm.config.BlockedAlertThreshold)
+	if threshold <= 0 {
+		return func() {}
+	}
+	alerter, _ := as.esm.runtime.(BlockedAlerter[CT])
+	var alerted atomic.Bool
+	timer := time.AfterFunc(threshold, func() {
+		alerted.Store(true)
+		log.L(as.ctx).Warnf("Event stream blocked: batch %d has been undelivered for %.2fs", batchNumber, time.Since(dispatchStart).Seconds())
+		if alerter != nil {
+			alerter.StreamBlocked(as.ctx, as.spec, dispatchStart)
+		}
+	})
+	return func() {
+		if !timer.Stop() && alerted.Load() {
+			blockedFor := time.Since(dispatchStart)
+			log.L(as.ctx).Infof("Event stream unblocked after %.2fs", blockedFor.Seconds())
+			if alerter != nil {
+				alerter.StreamUnblocked(as.ctx, as.spec, blockedFor)
+			}
+		}
+	}
+}
+
+// recordDelivered is called on the batch loop after a successful dispatch, so the last delivered
+// event is stored with the next checkpoint and is immediately visible in the status of the stream
+func (as *activeStream[CT, DT]) recordDelivered(event *Event[DT]) {
+	lastDelivered := &LastDeliveredEvent{
+		SequenceID:  event.SequenceID,
+		SubSource:   event.SubSource,
+		Timestamp:   event.Timestamp,
+		DeliveredAt: fftypes.Now(),
+	}
+	as.detectedCheckpoint.lastDelivered = lastDelivered
+	as.setLastDelivered(lastDelivered)
+}
+
+// dispatchBatch delivers a batch on the batch loop, recording the last event delivered if successful.
+// Only returns error in the case that the context is closed.
+func (as *activeStream[CT, DT]) dispatchBatch(batch *eventStreamBatch[DT]) error {
+	delivered, err := as.deliverBatch(batch)
+	if delivered {
+		as.recordDelivered(batch.events[len(batch.events)-1])
+	}
+	return err
+}
+
+// updateStats updates the statistics under the lock shared with Status. When batches are delivered
+// in parallel, the dispatch statistics reflect the batch that was updated most recently.
+func (as *activeStream[CT, DT]) updateStats(update func(stats *EventStreamStatistics)) {
+	as.statsMux.Lock()
+	defer as.statsMux.Unlock()
+	update(&as.EventStreamStatistics)
+}
+
+// statsSnapshot returns a copy of the statistics, taken under the same lock that every writer
+// updates them with, so the blocked state calculated from the copy is consistent.
+func (as *activeStream[CT, DT]) statsSnapshot() *EventStreamStatistics {
+	as.statsMux.Lock()
+	defer as.statsMux.Unlock()
+	statsCopy := as.EventStreamStatistics
+	return &statsCopy
+}
+
+// deliverBatch performs the action, with exponential back-off retry up to a given threshold, returning
+// whether the batch was delivered rather than skipped. Only returns error in the case that the context
+// is closed. It is safe to call in parallel for different batches.
+func (as *activeStream[CT, DT]) deliverBatch(batch *eventStreamBatch[DT]) (delivered bool, err error) {
+	dispatchTime := fftypes.Now()
+	attempts := 0
+	as.updateStats(func(stats *EventStreamStatistics) {
+		stats.LastDispatchNumber = batch.number
+		stats.LastDispatchTime = dispatchTime
+		stats.LastDispatchFailure = ""
+		stats.LastDispatchAttempts = 0
+		stats.LastDispatchStatus = DispatchStatusDispatching
+		stats.HighestDispatched = batch.events[len(batch.events)-1].SequenceID
+	})
+	setStatus := func(status DispatchStatus) {
+		as.updateStats(func(stats *EventStreamStatistics) { stats.LastDispatchStatus = status })
+	}
+	stopAlert := as.startBlockedAlert(batch.number, *dispatchTime.Time())
+	defer stopAlert()
 	for {
 		// Short exponential back-off retry
 		err := as.retry.Do(as.ctx, "action", func(_ int) (retry bool, err error) {
-			err = as.action.AttemptDispatch(as.ctx, as.LastDispatchAttempts, &EventBatch[DT]{
+			eventBatch := &EventBatch[DT]{
 				Type:        MessageTypeEventBatch,
 				StreamID:    as.spec.GetID(),
 				BatchNumber: batch.number,
 				Events:      batch.events,
-			})
+			}
+			if transformer, ok := as.esm.runtime.(BatchTransformer[CT, DT]); ok {
+				eventBatch.Payload, err = transformer.TransformBatch(as.ctx, as.spec, batch.events)
+			}
+			if err == nil {
+				err = as.action.AttemptDispatch(as.ctx, attempts, eventBatch)
+			}
 			if err != nil {
 				log.L(as.ctx).Errorf("Batch %d attempt %d failed. err=%s",
-					batch.number, as.LastDispatchAttempts, err)
-				as.LastDispatchAttempts++
-				as.LastDispatchFailure = err.Error()
-				as.LastDispatchStatus = DispatchStatusRetrying
-				return time.Since(*as.LastDispatchTime.Time()) < time.Duration(*as.spec.RetryTimeout), err
+					batch.number, attempts, err)
+				attempts++
+				as.updateStats(func(stats *EventStreamStatistics) {
+					stats.LastDispatchAttempts = attempts
+					stats.LastDispatchFailure = err.Error()
+					stats.LastDispatchStatus = DispatchStatusRetrying
+				})
+				return !as.atMostOnce() && time.Since(*dispatchTime.Time()) < time.Duration(*as.spec.RetryTimeout), err
 			}
-			as.LastDispatchStatus = DispatchStatusComplete
+			setStatus(DispatchStatusComplete)
 			return false, nil
 		})
 		if err == nil {
-			return nil
+			as.esm.deliveryTimer.ObserveSince(*dispatchTime.Time())
+			return true, nil
+		}
+		if as.atMostOnce() {
+			// The batch is already checkpointed, so we drop it rather than risk a duplicate
+			log.L(as.ctx).Errorf("Batch %d dropped after failed delivery (at-most-once): %s", batch.number, err)
+			setStatus(DispatchStatusSkipped)
+			return false, nil
 		}
 		// We're in blocked retry delay
-		as.LastDispatchStatus = DispatchStatusBlocked
+		setStatus(DispatchStatusBlocked)
 		log.L(as.ctx).Errorf("Batch failed short retry after %.2fs secs. ErrorHandling=%s BlockedRetryDelay=%.2fs ",
-			time.Since(*as.LastDispatchTime.Time()).Seconds(), *as.spec.ErrorHandling, time.Duration(*as.spec.BlockedRetryDelay).Seconds())
+			time.Since(*dispatchTime.Time()).Seconds(), *as.spec.ErrorHandling, time.Duration(*as.spec.BlockedRetryDelay).Seconds())
 		if *as.spec.ErrorHandling == ErrorHandlingTypeSkip {
 			// Swallow the error now we have logged it
-			as.LastDispatchStatus = DispatchStatusSkipped
-			return nil
+			setStatus(DispatchStatusSkipped)
+			return false, nil
 		}
 		select {
 		case <-time.After(time.Duration(*as.spec.BlockedRetryDelay)):
 		case <-as.ctx.Done():
 			// Only way we exit with error, is if the context is cancelled
-			return i18n.NewError(as.ctx, i18n.MsgContextCanceled)
+			return false, i18n.NewError(as.ctx, i18n.MsgContextCanceled)
 		}
 	}
 }
@@ -18,11 +18,18 @@ package eventstreams
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -52,13 +59,13 @@ func TestRunSourceLoopDone(t *testing.T) {
 	}
 	as.ctx, as.cancelCtx = context.WithCancel(ctx)
 
-	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error {
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
 		deliver(nil)
 		return nil
 	}
 
 	as.cancelCtx()
-	err := as.runSourceLoop("")
+	_, err := as.runSourceLoop(streamCheckpoint{}, nil)
 	assert.NoError(t, err)
 }
 
@@ -72,13 +79,13 @@ func TestRunSourceEventsBlockedExit(t *testing.T) {
 	as.ctx, as.cancelCtx = context.WithCancel(ctx)
 
 	as.events = make(chan *Event[testData])
-	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error {
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
 		deliver([]*Event[testData]{{ /* will block */ }})
 		return nil
 	}
 
 	as.cancelCtx()
-	err := as.runSourceLoop("")
+	_, err := as.runSourceLoop(streamCheckpoint{}, nil)
 	assert.NoError(t, err)
 }
 
@@ -92,7 +99,7 @@ func TestBatchTimeout(t *testing.T) {
 	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(1 * time.Millisecond))
 
 	delivered := false
-	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error {
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
 		if delivered {
 			<-ctx.Done()
 		} else {
@@ -141,10 +148,10 @@ func TestQueuedCheckpointAsync(t *testing.T) {
 	as.ctx, as.cancelCtx = context.WithCancel(ctx)
 
 	as.esm.config.Checkpoints.Asynchronous = true
-	as.HighestDetected = "11111"
+	as.detectedCheckpoint.sequenceID = "11111"
 	as.dispatchCheckpoint()
-	as.HighestDetected = "22222"
-	as.pushCheckpoint()
+	as.detectedCheckpoint.sequenceID = "22222"
+	as.pushCheckpoint(as.snapCheckpoint())
 
 	<-checkpointed
 	<-checkpointed
@@ -162,8 +169,8 @@ func TestQueuedCheckpointCancel(t *testing.T) {
 	as.ctx, as.cancelCtx = context.WithCancel(ctx)
 	as.cancelCtx()
 
-	as.HighestDetected = "11111"
-	as.pushCheckpoint()
+	as.detectedCheckpoint.sequenceID = "11111"
+	as.pushCheckpoint(as.snapCheckpoint())
 	as.checkpointRoutine()
 
 }
@@ -207,12 +214,17 @@ func TestDispatchBlockError(t *testing.T) {
 	calls := make(chan bool)
 	as.action = &mockAction{
 		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
-			calls <- true
+			select {
+			case calls <- true:
+			case <-ctx.Done():
+			}
 			return fmt.Errorf("pop")
 		},
 	}
 
+	dispatched := make(chan struct{})
 	go func() {
+		defer close(dispatched)
 		err := as.dispatchBatch(&eventStreamBatch[testData]{
 			events: []*Event[testData]{{}},
 		})
@@ -222,5 +234,864 @@ func TestDispatchBlockError(t *testing.T) {
 	<-calls
 	<-calls
 	as.cancelCtx()
+	<-dispatched
+
+}
+
+type mockTransformingEventSource struct {
+	*mockEventSource
+	transform func(ctx context.Context, spec *EventStreamSpec[testESConfig], events []*Event[testData]) (interface{}, error)
+}
+
+func (mts *mockTransformingEventSource) TransformBatch(ctx context.Context, spec *EventStreamSpec[testESConfig], events []*Event[testData]) (interface{}, error) {
+	return mts.transform(ctx, spec, events)
+}
+
+func TestDispatchTransformBatch(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+
+	transformCalls := 0
+	as.esm.runtime = &mockTransformingEventSource{
+		mockEventSource: mes,
+		transform: func(ctx context.Context, spec *EventStreamSpec[testESConfig], events []*Event[testData]) (interface{}, error) {
+			transformCalls++
+			if transformCalls == 1 {
+				return nil, fmt.Errorf("pop")
+			}
+			return []int{events[0].Data.Field1}, nil
+		},
+	}
+	var dispatched *EventBatch[testData]
+	as.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, batch *EventBatch[testData]) error {
+			dispatched = batch
+			return nil
+		},
+	}
+
+	event := &Event[testData]{Data: &testData{Field1: 12345}}
+	err := as.dispatchBatch(&eventStreamBatch[testData]{
+		events: []*Event[testData]{event},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, transformCalls)
+	assert.Equal(t, 1, as.LastDispatchAttempts)
+	assert.Equal(t, "pop", as.LastDispatchFailure)
+	assert.Equal(t, []int{12345}, dispatched.Payload)
+	assert.Equal(t, []*Event[testData]{event}, dispatched.Events)
+}
+
+func TestSubSourceCheckpoints(t *testing.T) {
+	checkpointed := make(chan *EventStreamCheckpoint)
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return(&EventStreamCheckpoint{
+			SequenceID: ptrTo("000"),
+			SubSources: SubSourceCheckpoints{"source1": "100", "source2": "200"},
+		}, nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpointed <- args[1].(*EventStreamCheckpoint)
+		})
+	})
+	defer done()
+
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(1 * time.Millisecond))
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			assert.Equal(t, "000", checkpointSequenceId)
+			assert.Equal(t, SubSourceCheckpoints{"source1": "100", "source2": "200"}, subSourceCheckpoints)
+			deliver([]*Event[testData]{
+				{EventCommon: EventCommon{SequenceID: "101", SubSource: "source1"}, Data: &testData{Field1: 1}},
+				{EventCommon: EventCommon{SequenceID: "301", SubSource: "source3"}, Data: &testData{Field1: 2}},
+			})
+			delivered = true
+		}
+		return nil
+	}
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	cp := <-checkpointed
+	assert.Equal(t, "000", *cp.SequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"source1": "101", "source2": "200", "source3": "301"}, cp.SubSources)
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+}
+
+func TestSubSourceOnlyCheckpoint(t *testing.T) {
+	checkpointed := make(chan *EventStreamCheckpoint, 1)
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpointed <- args[1].(*EventStreamCheckpoint)
+		})
+	})
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+
+	as.detectEvent(&Event[testData]{EventCommon: EventCommon{SequenceID: "111", SubSource: "source1"}})
+	as.dispatchCheckpoint()
+	cp := <-checkpointed
+	assert.Nil(t, cp.SequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"source1": "111"}, cp.SubSources)
+	assert.Equal(t, SubSourceCheckpoints{"source1": "111"}, as.SubSourceCheckpoints)
+}
+
+type mockBlockedAlerter struct {
+	*mockEventSource
+	blocked   chan time.Time
+	unblocked chan time.Duration
+}
+
+func (mba *mockBlockedAlerter) StreamBlocked(ctx context.Context, spec *EventStreamSpec[testESConfig], blockedSince time.Time) {
+	mba.blocked <- blockedSince
+}
+
+func (mba *mockBlockedAlerter) StreamUnblocked(ctx context.Context, spec *EventStreamSpec[testESConfig], blockedFor time.Duration) {
+	mba.unblocked <- blockedFor
+}
+
+func TestDispatchBlockedAlert(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+	as.esm.config.BlockedAlertThreshold = fftypes.FFDuration(1 * time.Millisecond)
+	alerter := &mockBlockedAlerter{
+		mockEventSource: mes,
+		blocked:         make(chan time.Time, 1),
+		unblocked:       make(chan time.Duration, 1),
+	}
+	as.esm.runtime = alerter
+
+	release := make(chan struct{})
+	as.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			<-release
+			return nil
+		},
+	}
+
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- as.dispatchBatch(&eventStreamBatch[testData]{
+			number: 1,
+			events: []*Event[testData]{{}},
+		})
+	}()
+
+	blockedSince := <-alerter.blocked
+	close(release)
+	assert.NoError(t, <-dispatched)
+	blockedFor := <-alerter.unblocked
+	assert.False(t, blockedSince.IsZero())
+	assert.Greater(t, blockedFor, time.Duration(0))
+	assert.Equal(t, DispatchStatusComplete, as.LastDispatchStatus)
+}
+
+func TestDispatchBlockedAlertDisabled(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+	as.esm.config.BlockedAlertThreshold = 0
+	as.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			return nil
+		},
+	}
+
+	err := as.dispatchBatch(&eventStreamBatch[testData]{
+		events: []*Event[testData]{{}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestDispatchBlockedAlertNoAlerter(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+	as.esm.config.BlockedAlertThreshold = fftypes.FFDuration(1 * time.Microsecond)
+	as.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+	}
+
+	err := as.dispatchBatch(&eventStreamBatch[testData]{
+		events: []*Event[testData]{{}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestBatchMaxSizeBytes(t *testing.T) {
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	})
+	defer done()
+
+	newEvent := func(seq string, topic string) *Event[testData] {
+		return &Event[testData]{
+			EventCommon: EventCommon{Topic: topic, SequenceID: seq},
+			Data:        &testData{Field1: 1},
+		}
+	}
+	smallEventBytes, err := json.Marshal(newEvent("000001", "topic1"))
+	assert.NoError(t, err)
+
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(10 * time.Millisecond))
+	es.spec.MaxBatchSizeBytes = ptrTo(fftypes.ByteSize(2 * len(smallEventBytes)))
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			deliver([]*Event[testData]{
+				newEvent("000001", "topic1"),
+				newEvent("000002", "topic1"),
+				newEvent("000003", "topic1"),
+				newEvent("000004", strings.Repeat("x", 3*len(smallEventBytes))), // larger than the limit on its own
+				newEvent("000005", "topic1"),
+			})
+			delivered = true
+		}
+		return nil
+	}
+
+	dispatched := make(chan []string, 4)
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			seqs := make([]string, len(events.Events))
+			for i, e := range events.Events {
+				seqs[i] = e.SequenceID
+			}
+			dispatched <- seqs
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	assert.Equal(t, []string{"000001", "000002"}, <-dispatched) // size limit reached
+	assert.Equal(t, []string{"000003"}, <-dispatched)           // next event would exceed the limit
+	assert.Equal(t, []string{"000004"}, <-dispatched)           // oversized event delivered alone
+	assert.Equal(t, []string{"000005"}, <-dispatched)           // timeout
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+}
+
+func TestAtMostOnceCheckpointsBeforeDispatchAndDrops(t *testing.T) {
+	var order []string
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			order = append(order, "checkpoint:"+*args[1].(*EventStreamCheckpoint).SequenceID)
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(1)
+	es.spec.DeliveryMode = ptrTo(DeliveryModeAtMostOnce)
+	es.esm.config.Checkpoints.Asynchronous = true // ignored for at-most-once
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			deliver([]*Event[testData]{
+				{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001"}, Data: &testData{Field1: 1}},
+				{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000002"}, Data: &testData{Field1: 2}},
+			})
+			delivered = true
+		}
+		return nil
+	}
+
+	dispatched := make(chan struct{})
+	attempts := 0
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			attempts++
+			order = append(order, "dispatch:"+events.Events[0].SequenceID)
+			if events.Events[0].SequenceID == "000001" {
+				return fmt.Errorf("pop")
+			}
+			close(dispatched)
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	<-dispatched
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+
+	// The first batch is dropped after a single failed attempt
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []string{
+		"checkpoint:000001",
+		"dispatch:000001",
+		"checkpoint:000002",
+		"dispatch:000002",
+	}, order)
+}
+
+func TestBacklogSlowConsumer(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	})
+	defer done()
+
+	registry := prometheus.NewRegistry()
+	mm, err := metric.NewPrometheusMetricsRegistryWithOptions("ut", metric.PrometheusRegistryOptions{Registry: registry}).
+		NewMetricsManagerForSubsystem(ctx, "es")
+	assert.NoError(t, err)
+	es.esm.config.MetricsManager = mm
+	es.esm.backlogMetricsInterval = 1 * time.Millisecond
+	es.esm.initMetrics(ctx)
+	gaugeValue := func(name string) float64 {
+		families, err := registry.Gather()
+		assert.NoError(t, err)
+		for _, f := range families {
+			if strings.HasSuffix(f.GetName(), name) {
+				for _, m := range f.GetMetric() {
+					for _, l := range m.GetLabel() {
+						if l.GetName() == metricLabelStream && l.GetValue() == es.spec.GetID() {
+							return m.GetGauge().GetValue()
+						}
+					}
+				}
+			}
+		}
+		return -1
+	}
+
+	es.spec.BatchSize = ptrTo(2)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(10 * time.Millisecond))
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			events := make([]*Event[testData], 5)
+			for i := range events {
+				events[i] = &Event[testData]{
+					EventCommon: EventCommon{
+						Topic:      "topic1",
+						SequenceID: fmt.Sprintf("%.6d", i+1),
+						Timestamp:  ptrTo(fftypes.FFTime(time.Now().Add(-1 * time.Minute))),
+					},
+					Data: &testData{Field1: i},
+				}
+			}
+			deliver(events)
+			delivered = true
+		}
+		return nil
+	}
+
+	release := make(chan struct{})
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			<-release
+			return nil
+		},
+	}
+
+	es.ensureActive()
+	as := es.activeState
+
+	// The first batch is stuck with the consumer, the next two events are buffered, and the last is waiting to be buffered
+	assert.Eventually(t, func() bool { return es.Status(ctx).Statistics.QueueDepth == 5 }, 5*time.Second, 1*time.Millisecond)
+	age1 := es.Status(ctx).Statistics.OldestPendingEventAge
+	assert.GreaterOrEqual(t, time.Duration(age1), 1*time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	age2 := es.Status(ctx).Statistics.OldestPendingEventAge
+	assert.Greater(t, age2, age1)
+
+	assert.Eventually(t, func() bool {
+		return gaugeValue(metricQueueDepth) == 5 && gaugeValue(metricOldestPendingEventAge) >= time.Duration(age2).Seconds()
+	}, 5*time.Second, 1*time.Millisecond)
+
+	// Once the consumer catches up, the backlog clears
+	close(release)
+	assert.Eventually(t, func() bool {
+		stats := es.Status(ctx).Statistics
+		return stats.QueueDepth == 0 && stats.OldestPendingEventAge == 0 && stats.HighestDispatched == "000005"
+	}, 5*time.Second, 1*time.Millisecond)
+	assert.Eventually(t, func() bool { return gaugeValue(metricQueueDepth) == 0 }, 5*time.Second, 1*time.Millisecond)
+
+	// The source has gone quiet since passing the events
+	assert.Eventually(t, func() bool { return gaugeValue(metricSourceIdle) > 0 }, 5*time.Second, 1*time.Millisecond)
+
+	// Each of the three batches has its delivery time recorded
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	var deliveries uint64
+	for _, f := range families {
+		if strings.HasSuffix(f.GetName(), metricDeliveryDuration) {
+			deliveries = f.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	assert.Equal(t, uint64(3), deliveries)
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+	<-as.metricsLoopDone
+
+	// The series of a deleted stream are removed, leaving the delivery times across all streams
+	es.esm.deleteStreamMetrics(ctx, es.spec.GetID())
+	families, err = registry.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 1)
+	assert.True(t, strings.HasSuffix(families[0].GetName(), metricDeliveryDuration))
+}
+
+func TestBacklogMetricsStreamLabels(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	done()
+
+	registry := prometheus.NewRegistry()
+	mm, err := metric.NewPrometheusMetricsRegistryWithOptions("ut", metric.PrometheusRegistryOptions{Registry: registry}).
+		NewMetricsManagerForSubsystem(ctx, "es")
+	assert.NoError(t, err)
+	es.esm.config.MetricsManager = mm
+	es.esm.config.MetricsLabels = []string{"team", "app.kubernetes.io-name"}
+	es.esm.initMetrics(ctx)
+	es.spec.Labels = Labels{"team": "payments", "other": "ignored"}
+
+	es.esm.emitBacklogMetrics(ctx, es.esm.streamMetricLabels(es.spec), 5, 0, 0)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	found := false
+	for _, f := range families {
+		if strings.HasSuffix(f.GetName(), metricQueueDepth) {
+			labels := map[string]string{}
+			for _, l := range f.GetMetric()[0].GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			assert.Equal(t, map[string]string{
+				"ff_component":                 "ut",
+				metricLabelStream:              es.spec.GetID(),
+				"label_team":                   "payments",
+				"label_app_kubernetes_io_name": "",
+			}, labels)
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestDeliveredSinceCheckpoint(t *testing.T) {
+	releaseCheckpoint := make(chan struct{})
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			<-releaseCheckpoint
+		}).Return(false, nil)
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(3)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(10 * time.Millisecond))
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			events := make([]*Event[testData], 3)
+			for i := range events {
+				events[i] = &Event[testData]{
+					EventCommon: EventCommon{
+						Topic:      "topic1",
+						SequenceID: fmt.Sprintf("%.6d", i+1),
+					},
+					Data: &testData{Field1: i},
+				}
+			}
+			deliver(events)
+			delivered = true
+		}
+		return nil
+	}
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			return nil
+		},
+	}
+
+	assert.Zero(t, es.Status(ctx).DeliveredSinceCheckpoint)
+	es.ensureActive()
+	as := es.activeState
+
+	// The batch is delivered, but the checkpoint is still being written
+	assert.Eventually(t, func() bool { return es.Status(ctx).DeliveredSinceCheckpoint == 3 }, 5*time.Second, 1*time.Millisecond)
+
+	close(releaseCheckpoint)
+	assert.Eventually(t, func() bool { return es.Status(ctx).DeliveredSinceCheckpoint == 0 }, 5*time.Second, 1*time.Millisecond)
+	assert.Equal(t, "000003", es.Status(ctx).Statistics.Checkpoint)
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+}
+
+func TestDeliveredSinceCheckpointNilBacklog(t *testing.T) {
+	var b *streamBacklog
+	b.eventsDelivered(1)
+	b.checkpointStored(1)
+	assert.Zero(t, b.deliveredCount())
+	assert.Zero(t, b.sinceCheckpoint())
+}
+
+func TestSourceRunRestartStatistics(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		RetrySection.Set(retry.ConfigMaximumDelay, "1ms" /* spin quickly */)
+		RestartRetrySection.Set(retry.ConfigMaximumDelay, "1ms")
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+
+	var runs atomic.Int32
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		switch runs.Add(1) {
+		case 1, 2:
+			return fmt.Errorf("pop")
+		case 3:
+			// Returning without an error, while the stream is still running, is also a restart
+			return nil
+		default:
+			<-ctx.Done()
+			return nil
+		}
+	}
+
+	es.ensureActive()
+	assert.Eventually(t, func() bool { return runs.Load() == 4 }, 5*time.Second, 1*time.Millisecond)
+	stats := es.Status(ctx).Statistics
+	assert.Equal(t, 3, stats.Restarts)
+	assert.NotNil(t, stats.LastRestartTime)
+	assert.Regexp(t, "FF00275", stats.LastRestartError)
+
+	// Stopping the stream does not count as a restart
+	as := es.activeState
+	<-es.requestStop(ctx)
+	assert.Equal(t, 3, as.Restarts)
+
+	// A new run of the stream starts with fresh statistics
+	runs.Store(3)
+	es.ensureActive()
+	assert.Eventually(t, func() bool { return runs.Load() == 4 }, 5*time.Second, 1*time.Millisecond)
+	stats = es.Status(ctx).Statistics
+	assert.Zero(t, stats.Restarts)
+	assert.Nil(t, stats.LastRestartTime)
+	assert.Empty(t, stats.LastRestartError)
+}
+
+type mockSequenceLagResolver struct {
+	*mockEventSource
+	lag func(ctx context.Context, sequenceID string) (int64, error)
+}
+
+func (mlr *mockSequenceLagResolver) SequenceLag(ctx context.Context, sequenceID string) (int64, error) {
+	return mlr.lag(ctx, sequenceID)
+}
+
+func TestCatchupBatchSize(t *testing.T) {
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(2)
+	es.spec.CatchupBatchSize = ptrTo(10)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(100 * time.Millisecond))
+
+	const total = 25
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if !delivered {
+			events := make([]*Event[testData], total)
+			for i := range events {
+				events[i] = &Event[testData]{
+					EventCommon: EventCommon{Topic: "topic1", SequenceID: fmt.Sprintf("%.6d", i)},
+					Data:        &testData{Field1: i},
+				}
+			}
+			deliver(events)
+			delivered = true
+		}
+		<-ctx.Done()
+		return nil
+	}
+	es.esm.runtime = &mockSequenceLagResolver{
+		mockEventSource: mes,
+		lag: func(ctx context.Context, sequenceID string) (int64, error) {
+			seq, err := strconv.Atoi(sequenceID)
+			assert.NoError(t, err)
+			return int64(total - seq - 1), nil
+		},
+	}
+
+	dispatched := make(chan []int, total)
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			fields := make([]int, len(events.Events))
+			for i, e := range events.Events {
+				fields[i] = e.Data.Field1
+			}
+			dispatched <- fields
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, <-dispatched)           // 24 behind
+	assert.Equal(t, []int{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, <-dispatched) // 14 behind
+	assert.Equal(t, []int{20, 21}, <-dispatched)                                 // within a catchup batch of the tip
+	assert.Equal(t, []int{22, 23}, <-dispatched)
+	assert.Equal(t, []int{24}, <-dispatched) // timeout
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+}
+
+func TestCatchupBatchSizeFallback(t *testing.T) {
+	_, es, mes, done := newTestEventStream(t)
+	defer done()
+
+	es.spec.BatchSize = ptrTo(2)
+	as := &activeStream[testESConfig, testData]{
+		eventStream: es,
+		ctx:         context.Background(),
+	}
+
+	// Only one batch size set
+	assert.Equal(t, 2, es.maxBatchSize())
+	assert.Equal(t, 2, as.nextBatchSize("000001"))
+
+	// The runtime cannot calculate the lag
+	es.spec.CatchupBatchSize = ptrTo(10)
+	assert.Equal(t, 10, es.maxBatchSize())
+	assert.Equal(t, 2, as.nextBatchSize("000001"))
+
+	// The lag cannot be calculated for this sequence
+	es.esm.runtime = &mockSequenceLagResolver{
+		mockEventSource: mes,
+		lag: func(ctx context.Context, sequenceID string) (int64, error) {
+			return -1, fmt.Errorf("pop")
+		},
+	}
+	assert.Equal(t, 2, as.nextBatchSize("000001"))
+}
+
+func TestMaxInFlightBatches(t *testing.T) {
+	checkpoints := make(chan string, 10)
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- *args[1].(*EventStreamCheckpoint).SequenceID
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(1)
+	es.spec.MaxInFlightBatches = ptrTo(2)
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			events := make([]*Event[testData], 4)
+			for i := range events {
+				events[i] = &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: fmt.Sprintf("%.6d", i+1)}, Data: &testData{Field1: i}}
+			}
+			deliver(events)
+			delivered = true
+		}
+		return nil
+	}
+
+	started := make(chan string, 4)
+	acks := map[string]chan struct{}{}
+	for i := 1; i <= 4; i++ {
+		acks[fmt.Sprintf("%.6d", i)] = make(chan struct{})
+	}
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			seq := events.Events[0].SequenceID
+			started <- seq
+			<-acks[seq]
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	defer func() {
+		as.cancelCtx()
+		<-as.eventLoopDone
+		<-as.batchLoopDone
+	}()
+
+	// Two batches are delivered in parallel, and the third waits for a slot
+	assert.ElementsMatch(t, []string{"000001", "000002"}, []string{<-started, <-started})
+	close(acks["000002"])
+	select {
+	case seq := <-started:
+		assert.Fail(t, "dispatched past the limit", seq)
+	case cp := <-checkpoints:
+		assert.Fail(t, "checkpointed before the earlier batch completed", cp)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Once the oldest completes, both are checkpointed in order, and the next batches dispatched
+	close(acks["000001"])
+	assert.Equal(t, "000001", <-checkpoints)
+	assert.Equal(t, "000002", <-checkpoints)
+	assert.ElementsMatch(t, []string{"000003", "000004"}, []string{<-started, <-started})
+	close(acks["000003"])
+	close(acks["000004"])
+	assert.Equal(t, "000003", <-checkpoints)
+	assert.Equal(t, "000004", <-checkpoints)
+	assert.Equal(t, int64(4), as.backlog.deliveredCount())
+	assert.Equal(t, "000004", as.detectedCheckpoint.lastDelivered.SequenceID)
+}
+
+func TestMaxInFlightBatchesDrain(t *testing.T) {
+	checkpoints := make(chan string, 10)
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- *args[1].(*EventStreamCheckpoint).SequenceID
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(2)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(1 * time.Hour))
+	es.spec.MaxInFlightBatches = ptrTo(3)
+	es.spec.ErrorHandling = ptrTo(ErrorHandlingTypeSkip)
+	es.spec.RetryTimeout = ptrTo(fftypes.FFDuration(1 * time.Millisecond))
+
+	queued := make(chan struct{})
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		events := make([]*Event[testData], 5)
+		for i := range events {
+			events[i] = &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: fmt.Sprintf("%.6d", i+1)}, Data: &testData{Field1: i}}
+		}
+		deliver(events)
+		close(queued)
+		<-ctx.Done()
+		return nil
+	}
+
+	release := make(chan struct{})
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			<-release
+			if events.Events[0].SequenceID == "000003" {
+				return fmt.Errorf("pop") // skipped, but still checkpointed
+			}
+			return nil
+		},
+	}
 
+	es.activeState = es.newActiveStream()
+	<-queued
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	// The partial batch is dispatched, and all the batches in flight complete before the drain
+	es.drain(ctx)
+	assert.Equal(t, []string{"000002", "000004", "000005"}, []string{<-checkpoints, <-checkpoints, <-checkpoints})
+	assert.Equal(t, "000005", es.activeState.Checkpoint)
+	assert.Equal(t, "000005", es.activeState.detectedCheckpoint.lastDelivered.SequenceID)
+
+	es.activeState.cancelCtx()
+	<-es.activeState.batchLoopDone
+}
+
+func TestMaxInFlightBatchesStop(t *testing.T) {
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(1)
+	es.spec.MaxInFlightBatches = ptrTo(2)
+
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		deliver([]*Event[testData]{
+			{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001"}, Data: &testData{Field1: 1}},
+			{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000002"}, Data: &testData{Field1: 2}},
+			{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000003"}, Data: &testData{Field1: 3}},
+		})
+		<-ctx.Done()
+		return nil
+	}
+
+	started := make(chan struct{}, 3)
+	var dispatching atomic.Int32
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			dispatching.Add(1)
+			defer dispatching.Add(-1)
+			started <- struct{}{}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	as := es.newActiveStream()
+	<-started
+	<-started
+
+	// Stopping waits for the deliveries in flight to end
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+	assert.Zero(t, dispatching.Load())
 }
@@ -0,0 +1,99 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// catchupTip is the sequence a catchupOnly stream delivers up to, which is captured from the runtime and
+// stored the first time the stream starts - so events that arrive after that are never delivered, even
+// if the stream is restarted before it completes
+type catchupTip struct {
+	sequenceID string
+	comparer   SequenceComparer
+}
+
+func (as *activeStream[CT, DT]) loadCatchupTip() (tip *catchupTip, err error) {
+	as.mux.Lock()
+	captured := as.spec.CatchupTip
+	as.mux.Unlock()
+	tip = &catchupTip{comparer: as.esm.runtime.(SequenceComparer)} // checked when validating the stream
+	if captured != nil {
+		tip.sequenceID = *captured
+		return tip, nil
+	}
+	err = as.retry.Do(as.ctx, "capture catchup tip", func(attempt int) (retry bool, err error) {
+		tip.sequenceID, err = as.esm.runtime.(LatestSequenceResolver).LatestSequence(as.ctx)
+		if err == nil {
+			err = as.persistence.EventStreams().Update(as.ctx, as.spec.GetID(), EventStreamFilters.NewUpdate(as.ctx).Set("catchuptip", tip.sequenceID))
+		}
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.L(as.ctx).Infof("Catching up to sequence '%s'", tip.sequenceID)
+	as.mux.Lock()
+	as.spec.CatchupTip = &tip.sequenceID
+	as.mux.Unlock()
+	return tip, nil
+}
+
+// reached checks whether the sequence is at the tip, or beyond it in which case it must not be delivered
+func (tip *catchupTip) reached(sequenceID string) (atTip, beyondTip bool) {
+	cmp := tip.comparer.CompareSequences(sequenceID, tip.sequenceID)
+	return cmp == 0, cmp > 0
+}
+
+func (tip *catchupTip) passed(sequenceID string) bool {
+	atTip, beyondTip := tip.reached(sequenceID)
+	return atTip || beyondTip
+}
+
+// completeCatchup delivers and checkpoints everything queued up to the tip, then moves the stream to the
+// completed status. A stream stopped before then resumes catching up to the same tip when it is started.
+func (as *activeStream[CT, DT]) completeCatchup(tip *catchupTip) {
+	as.drainOnce.Do(func() { close(as.drainRequested) })
+	select {
+	case <-as.drained:
+	case <-as.batchLoopDone:
+		return
+	}
+	log.L(as.ctx).Infof("Caught up to sequence '%s'", tip.sequenceID)
+	// the stream is stopped from outside the event loop, as stopping waits for the event loop to exit
+	go func() {
+		if err := as.eventStream.complete(as.bgCtx); err != nil {
+			log.L(as.bgCtx).Errorf("Failed to complete event stream: %s", err)
+		}
+	}()
+}
+
+func (es *eventStream[CT, DT]) complete(ctx context.Context) error {
+	_, newPersistedStatus, _, err := es.checkSetStatus(ctx, &EventStreamStatusCompleted)
+	if err == nil && newPersistedStatus != nil {
+		err = es.retry.Do(ctx, "persist completed status", func(attempt int) (retry bool, err error) {
+			return true, es.persistStatus(ctx, *newPersistedStatus, nil)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	return es.suspend(ctx)
+}
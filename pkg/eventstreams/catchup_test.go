@@ -0,0 +1,297 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// catchupSource delivers an endless sequence of events after the checkpoint, one on each of two topics in turn
+type catchupSource struct {
+	testSource
+	latest     atomic.Pointer[string]
+	latestErr  error
+	latestReqs atomic.Int32
+}
+
+func (cs *catchupSource) Run(ctx context.Context, spec *EventStreamSpec[testESConfig], checkpointSequenceID string, _ SubSourceCheckpoints, deliver Deliver[testData]) error {
+	var i int
+	fmt.Sscanf(checkpointSequenceID, "%d", &i)
+	for i++; ; i++ {
+		event := &Event[testData]{
+			EventCommon: EventCommon{Topic: fmt.Sprintf("topic_%d", i%2), SequenceID: fmt.Sprintf("%.12d", i)},
+			Data:        &testData{Field1: i},
+		}
+		if deliver([]*Event[testData]{nil, event}) == Exit {
+			return nil
+		}
+	}
+}
+
+func (cs *catchupSource) LatestSequence(ctx context.Context) (string, error) {
+	cs.latestReqs.Add(1)
+	return *cs.latest.Load(), cs.latestErr
+}
+
+func (cs *catchupSource) CompareSequences(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+func newCatchupSource(latest string) *catchupSource {
+	cs := &catchupSource{}
+	cs.latest.Store(&latest)
+	return cs
+}
+
+func TestE2E_CatchupOnly(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t)
+	defer done()
+
+	cs := newCatchupSource("000000000025")
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, cs)
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		Status:      &EventStreamStatusStopped,
+		TopicFilter: ptrTo("topic_1"),
+		Type:        &EventStreamTypeInProcess,
+		BatchSize:   ptrTo(5),
+		CatchupOnly: ptrTo(true),
+		CatchupTip:  ptrTo("ignored"),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	assert.Nil(t, es1.CatchupTip)
+	batches, cancel, err := mgr.(Subscriber[testData]).Subscribe(ctx, es1.GetID())
+	assert.NoError(t, err)
+	defer cancel()
+	assert.NoError(t, mgr.StartStream(ctx, es1.GetID()))
+
+	// Events that arrive after the stream starts are not delivered
+	var delivered []int
+	for len(delivered) < 13 {
+		batch := <-batches
+		for _, e := range batch.Events {
+			delivered = append(delivered, e.Data.Field1)
+		}
+		cs.latest.Store(ptrTo("000000000099"))
+		batch.Ack()
+	}
+	assert.Equal(t, []int{1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 21, 23, 25}, delivered)
+
+	var ess *EventStreamWithStatus[testESConfig]
+	assert.Eventually(t, func() bool {
+		ess, err = mgr.GetStreamByID(ctx, es1.GetID())
+		return err == nil && ess.Status == EventStreamStatusCompleted
+	}, 5*time.Second, 1*time.Millisecond)
+	assert.Equal(t, "000000000025", *ess.CatchupTip)
+	assert.Empty(t, ess.StoppedReason)
+	assert.Equal(t, int32(1), cs.latestReqs.Load())
+	select {
+	case batch := <-batches:
+		assert.Fail(t, "unexpected batch", batch.Events[0].SequenceID)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// A completed stream is not started again, but keeps its status and tip when stopped or updated
+	err = mgr.StartStream(ctx, es1.GetID())
+	assert.Regexp(t, "FF00321", err)
+	assert.NoError(t, mgr.StopStream(ctx, es1.GetID()))
+	_, err = mgr.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		ID:          es1.ID,
+		Name:        ptrTo("stream1"),
+		Type:        &EventStreamTypeInProcess,
+		CatchupOnly: ptrTo(true),
+		Config:      &testESConfig{Config1: "2222"},
+	})
+	assert.NoError(t, err)
+	ess, err = mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusCompleted, ess.Status)
+	assert.Equal(t, "000000000025", *ess.CatchupTip)
+
+	assert.NoError(t, mgr.DeleteStream(ctx, es1.GetID()))
+}
+
+func TestE2E_CatchupOnlyResumesToCapturedTip(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t)
+	defer done()
+
+	cs := newCatchupSource("000000000010")
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, cs)
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		Type:        &EventStreamTypeInProcess,
+		BatchSize:   ptrTo(4),
+		CatchupOnly: ptrTo(true),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	batches, cancel, err := mgr.(Subscriber[testData]).Subscribe(ctx, es1.GetID())
+	assert.NoError(t, err)
+	defer cancel()
+
+	// Stopped part way through, after the tip is captured
+	batch := <-batches
+	assert.Equal(t, "000000000001", batch.Events[0].SequenceID)
+	batch.Ack()
+	assert.NoError(t, mgr.StopStream(ctx, es1.GetID()))
+	ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusStopped, ess.Status)
+	assert.Equal(t, "000000000010", *ess.CatchupTip)
+
+	// Started again, it delivers up to the same tip
+	cs.latest.Store(ptrTo("000000000099"))
+	assert.NoError(t, mgr.StartStream(ctx, es1.GetID()))
+	var last string
+	for last != "000000000010" {
+		batch = <-batches
+		last = batch.Events[len(batch.Events)-1].SequenceID
+		assert.LessOrEqual(t, last, "000000000010")
+		batch.Ack()
+	}
+	assert.Eventually(t, func() bool {
+		ess, err = mgr.GetStreamByID(ctx, es1.GetID())
+		return err == nil && ess.Status == EventStreamStatusCompleted
+	}, 5*time.Second, 1*time.Millisecond)
+	assert.Equal(t, int32(1), cs.latestReqs.Load())
+}
+
+func TestCatchupOnlyEmptySource(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t)
+	defer done()
+
+	cs := newCatchupSource("")
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, cs)
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		Type:        &EventStreamTypeInProcess,
+		CatchupOnly: ptrTo(true),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+		return err == nil && ess.Status == EventStreamStatusCompleted
+	}, 5*time.Second, 1*time.Millisecond)
+}
+
+func TestCatchupOnlyCheckpointAtTip(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return(&EventStreamCheckpoint{SequenceID: ptrTo("000000000005")}, nil)
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	})
+	defer done()
+	es.esm.runtime = newCatchupSource("")
+	es.spec.CatchupOnly = ptrTo(true)
+	es.spec.CatchupTip = ptrTo("000000000005")
+
+	// Restarted after catching up, but before completing
+	assert.NoError(t, es.start(ctx))
+	assert.Eventually(t, func() bool {
+		return es.Status(ctx).Status == EventStreamStatusCompleted
+	}, 5*time.Second, 1*time.Millisecond)
+}
+
+func TestCatchupOnlyCaptureTipFail(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		RetrySection.Set(retry.ConfigMaximumDelay, "1ms")
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	})
+	defer done()
+	cs := newCatchupSource("")
+	cs.latestErr = fmt.Errorf("pop")
+	es.esm.runtime = cs
+	es.spec.CatchupOnly = ptrTo(true)
+
+	assert.NoError(t, es.start(ctx))
+	assert.Eventually(t, func() bool { return cs.latestReqs.Load() > 1 }, 5*time.Second, 1*time.Millisecond)
+	assert.NoError(t, es.stop(ctx, ""))
+	assert.Equal(t, EventStreamStatusStopped, es.Status(ctx).Status)
+	assert.Nil(t, es.spec.CatchupTip)
+}
+
+func TestCatchupOnlyValidation(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, nil, nil)
+	})
+	defer done()
+
+	spec := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		CatchupOnly: ptrTo(true),
+	}
+	err := esm.validateStream(ctx, spec, false)
+	assert.Regexp(t, "FF00319", err)
+
+	esm.runtime = &mockSequenceComparer{mockEventSource: esm.runtime.(*mockEventSource)}
+	err = esm.validateStream(ctx, spec, false)
+	assert.Regexp(t, "FF00319", err)
+
+	esm.runtime = newCatchupSource("")
+	spec.SharedSource = ptrTo("shared1")
+	err = esm.validateStream(ctx, spec, false)
+	assert.Regexp(t, "FF00320", err)
+}
+
+func TestCompletedStatusTransitions(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+	es.spec.Status = &EventStreamStatusCompleted
+
+	status, change, _, err := es.checkSetStatus(ctx, &EventStreamStatusStopped)
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusCompleted, status)
+	assert.Nil(t, change)
+
+	_, _, _, err = es.checkSetStatus(ctx, &EventStreamStatusStarted)
+	assert.Regexp(t, "FF00321", err)
+
+	es.stopping = make(chan struct{})
+	status, change, _, err = es.checkSetStatus(ctx, &EventStreamStatusDeleted)
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusStoppingDeleted, status)
+	assert.Equal(t, EventStreamStatusDeleted, *change)
+	es.stopping = nil
+
+	// A stopped stream does not complete
+	es.spec.Status = &EventStreamStatusStopped
+	err = es.complete(ctx)
+	assert.Regexp(t, "FF00230", err)
+}
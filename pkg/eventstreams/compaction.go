@@ -0,0 +1,89 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// compactionKey returns the value of the compactionKey field of the event, as it would be delivered,
+// or false if compaction is not enabled or the event does not have the field
+func (as *activeStream[CT, DT]) compactionKey(event *Event[DT]) (string, bool) {
+	if as.spec.CompactionKey == nil {
+		return "", false
+	}
+	return as.eventFieldKey(event, *as.spec.CompactionKey)
+}
+
+// eventFieldKey returns the JSON of the field of the event at the dot separated path, as it would be
+// delivered, or false if the event does not have the field
+func (as *activeStream[CT, DT]) eventFieldKey(event *Event[DT], path string) (string, bool) {
+	fields := map[string]interface{}{}
+	if event.Data != nil {
+		b, err := json.Marshal(event.Data)
+		if err == nil {
+			err = json.Unmarshal(b, &fields)
+		}
+		if err != nil {
+			log.L(as.ctx).Warnf("Unable to read field '%s' of event %s: %s", path, event.SequenceID, err)
+			return "", false
+		}
+	}
+	fields["topic"] = event.Topic
+	fields["sequenceId"] = event.SequenceID
+	if event.SubSource != "" {
+		fields["subSource"] = event.SubSource
+	}
+	var value interface{} = fields
+	for _, name := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		value = obj[name]
+	}
+	if value == nil {
+		return "", false
+	}
+	// the JSON of the value is the key, so values of different types are never equal
+	b, _ := json.Marshal(value)
+	return string(b), true
+}
+
+// compact removes any earlier event in the batch with the same key, before the event with that key
+// is appended to the batch. It returns the event removed, or nil.
+func (batch *eventStreamBatch[DT]) compact(key string) *Event[DT] {
+	if batch.keys == nil {
+		batch.keys = map[string]int{}
+	}
+	idx, ok := batch.keys[key]
+	batch.keys[key] = len(batch.events)
+	if !ok {
+		return nil
+	}
+	removed := batch.events[idx]
+	batch.events = append(batch.events[:idx], batch.events[idx+1:]...)
+	for k, i := range batch.keys {
+		if i > idx {
+			batch.keys[k] = i - 1
+		}
+	}
+	return removed
+}
@@ -0,0 +1,128 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCompactionByKey(t *testing.T) {
+	checkpoints := make(chan string, 10)
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- *args[1].(*EventStreamCheckpoint).SequenceID
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(3)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(10 * time.Millisecond))
+	es.spec.CompactionKey = ptrTo("topic")
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			deliver([]*Event[testData]{
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000001"}, Data: &testData{Field1: 1}},
+				{EventCommon: EventCommon{Topic: "b", SequenceID: "000002"}, Data: &testData{Field1: 2}},
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000003"}, Data: &testData{Field1: 3}},
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000004"}, Data: &testData{Field1: 4}},
+				{EventCommon: EventCommon{Topic: "c", SequenceID: "000005"}, Data: &testData{Field1: 5}},
+				{EventCommon: EventCommon{Topic: "b", SequenceID: "000006"}, Data: &testData{Field1: 6}},
+				{EventCommon: EventCommon{Topic: "b", SequenceID: "000007"}, Data: &testData{Field1: 7}},
+			})
+			delivered = true
+		}
+		return nil
+	}
+
+	dispatched := make(chan []string, 2)
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			seqs := make([]string, len(events.Events))
+			for i, e := range events.Events {
+				seqs[i] = e.SequenceID
+			}
+			dispatched <- seqs
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	// The batch size applies after compaction, and the latest event for each key keeps its place in the sequence
+	assert.Equal(t, []string{"000002", "000004", "000005"}, <-dispatched)
+	assert.Equal(t, "000005", <-checkpoints)
+	assert.Equal(t, []string{"000007"}, <-dispatched) // timeout
+	assert.Equal(t, "000007", <-checkpoints)
+
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+	assert.Equal(t, int64(3), as.CompactedEvents)
+	assert.Zero(t, as.backlog.queueDepth())
+}
+
+func TestCompactionKeyFields(t *testing.T) {
+	_, es, _, done := newTestEventStream(t)
+	defer done()
+	as := &activeStream[testESConfig, testData]{eventStream: es, ctx: context.Background()}
+	event := &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001", SubSource: "a"}, Data: &testData{Field1: 12345}}
+
+	_, ok := as.compactionKey(event)
+	assert.False(t, ok) // not enabled
+
+	for key, expected := range map[string]string{
+		"field1":    "12345",
+		"topic":     `"topic1"`,
+		"subSource": `"a"`,
+	} {
+		es.spec.CompactionKey = ptrTo(key)
+		value, ok := as.compactionKey(event)
+		assert.True(t, ok)
+		assert.Equal(t, expected, value)
+	}
+
+	for _, key := range []string{"missing", "field1.nested"} {
+		es.spec.CompactionKey = ptrTo(key)
+		_, ok = as.compactionKey(event)
+		assert.False(t, ok)
+	}
+
+	// Events without data are keyed on the common fields
+	es.spec.CompactionKey = ptrTo("topic")
+	value, ok := as.compactionKey(&Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001"}})
+	assert.True(t, ok)
+	assert.Equal(t, `"topic1"`, value)
+}
+
+func TestCompactionKeyNotObject(t *testing.T) {
+	as := &activeStream[testESConfig, string]{
+		eventStream: &eventStream[testESConfig, string]{spec: &EventStreamSpec[testESConfig]{CompactionKey: ptrTo("topic")}},
+		ctx:         context.Background(),
+	}
+	_, ok := as.compactionKey(&Event[string]{Data: ptrTo("not an object")})
+	assert.False(t, ok)
+}
@@ -0,0 +1,90 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// streamLimiter caps how many streams start concurrently, with the rest waiting for a slot.
+// Starting streams are counted even when unlimited, so that a limit can be applied at runtime.
+type streamLimiter struct {
+	mux     sync.Mutex
+	limit   int // zero is unlimited
+	active  int
+	changed chan struct{} // closed and replaced each time a slot is released, or the limit changes
+}
+
+func newStreamLimiter(limit int) *streamLimiter {
+	return &streamLimiter{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire blocks until a slot is available, returning false if the context is cancelled first
+func (sl *streamLimiter) acquire(ctx context.Context) bool {
+	logged := false
+	for {
+		sl.mux.Lock()
+		if sl.limit <= 0 || sl.active < sl.limit {
+			sl.active++
+			sl.mux.Unlock()
+			return true
+		}
+		changed := sl.changed
+		if !logged {
+			log.L(ctx).Infof("Waiting to start, as %d streams are starting (maxConcurrentStreams=%d)", sl.active, sl.limit)
+			logged = true
+		}
+		sl.mux.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (sl *streamLimiter) release() {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	sl.active--
+	sl.notify()
+}
+
+func (sl *streamLimiter) setLimit(limit int) {
+	sl.mux.Lock()
+	defer sl.mux.Unlock()
+	sl.limit = limit
+	sl.notify()
+}
+
+func (sl *streamLimiter) notify() {
+	close(sl.changed)
+	sl.changed = make(chan struct{})
+}
+
+// SetMaxConcurrentStreams changes how many streams can be starting at once, such as after the
+// configuration is reloaded. Zero is unlimited. Lowering the limit does not affect streams that are
+// already starting, but no more start until the number starting is below the new limit.
+func (esm *esManager[CT, DT]) SetMaxConcurrentStreams(limit int) {
+	esm.streamLimiter.setLimit(limit)
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestStreamLimiter(t *testing.T) {
+	ctx := context.Background()
+	sl := newStreamLimiter(1)
+
+	assert.True(t, sl.acquire(ctx))
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- sl.acquire(ctx)
+	}()
+	go func() {
+		acquired <- sl.acquire(ctx)
+	}()
+	sl.release()
+	assert.True(t, <-acquired)
+
+	// raising the limit at runtime releases the other waiter
+	sl.setLimit(2)
+	assert.True(t, <-acquired)
+	assert.Equal(t, 2, sl.active)
+
+	// zero is unlimited
+	sl.setLimit(0)
+	assert.True(t, sl.acquire(ctx))
+	assert.Equal(t, 3, sl.active)
+}
+
+func TestStreamLimiterCancelled(t *testing.T) {
+	sl := newStreamLimiter(1)
+	assert.True(t, sl.acquire(context.Background()))
+
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	assert.False(t, sl.acquire(ctx))
+	assert.Equal(t, 1, sl.active)
+}
+
+func TestMaxConcurrentStreams(t *testing.T) {
+	loading := make(chan struct{})
+	loaded := make(chan struct{})
+	ctx, es1, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Run(func(args mock.Arguments) {
+			close(loading)
+			<-loaded
+		}).Once()
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+	esm := es1.esm
+	esm.SetMaxConcurrentStreams(1)
+
+	running := make(chan string, 2)
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		running <- *es.Name
+		<-ctx.Done()
+		return nil
+	}
+	es2, err := esm.initEventStream(ctx, &EventStreamSpec[testESConfig]{
+		ID:     ptrTo(fftypes.NewUUID().String()),
+		Name:   ptrTo("stream2"),
+		Status: ptrTo(EventStreamStatusStopped),
+	})
+	assert.NoError(t, err)
+
+	es1.ensureActive()
+	<-loading
+	es2.ensureActive()
+
+	// the second stream only starts once the first has started, and both then run
+	close(loaded)
+	assert.ElementsMatch(t, []string{*es1.spec.Name, "stream2"}, []string{<-running, <-running})
+	assert.Equal(t, 0, esm.streamLimiter.active)
+	err = es1.suspend(ctx)
+	assert.NoError(t, err)
+	err = es2.suspend(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, esm.streamLimiter.active)
+}
@@ -23,15 +23,32 @@ import (
 	"github.com/hyperledger/firefly-common/pkg/ffresty"
 	"github.com/hyperledger/firefly-common/pkg/fftls"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
 	"github.com/hyperledger/firefly-common/pkg/retry"
 )
 
 type Config struct {
-	TLSConfigs        map[string]*fftls.Config `ffstruct:"EventStreamConfig" json:"tlsConfigs,omitempty"`
-	Retry             *retry.Retry             `ffstruct:"EventStreamConfig" json:"retry,omitempty"`
-	DisablePrivateIPs bool                     `ffstruct:"EventStreamConfig" json:"disabledPrivateIPs"`
-	Checkpoints       CheckpointsTuningConfig  `ffstruct:"EventStreamConfig" json:"checkpoints"`
-	Defaults          EventStreamDefaults      `ffstruct:"EventStreamConfig" json:"defaults,omitempty"`
+	TLSConfigs map[string]*fftls.Config `ffstruct:"EventStreamConfig" json:"tlsConfigs,omitempty"`
+	Retry      *retry.Retry             `ffstruct:"EventStreamConfig" json:"retry,omitempty"`
+	// RestartRetry is the back-off for restarting the source run loop of a stream after it fails, which defaults to
+	// Retry with jitter - so streams reading a shared upstream do not all restart against it in lockstep
+	RestartRetry          *retry.Retry            `ffstruct:"EventStreamConfig" json:"restartRetry,omitempty"`
+	DisablePrivateIPs     bool                    `ffstruct:"EventStreamConfig" json:"disabledPrivateIPs"`
+	BlockedAlertThreshold fftypes.FFDuration      `ffstruct:"EventStreamConfig" json:"blockedAlertThreshold"`
+	ShutdownTimeout       fftypes.FFDuration      `ffstruct:"EventStreamConfig" json:"shutdownTimeout"`
+	MaxConcurrentStreams  int                     `ffstruct:"EventStreamConfig" json:"maxConcurrentStreams"`
+	Checkpoints           CheckpointsTuningConfig `ffstruct:"EventStreamConfig" json:"checkpoints"`
+	Defaults              EventStreamDefaults     `ffstruct:"EventStreamConfig" json:"defaults,omitempty"`
+	// WarnExclusiveSourceConflicts logs a warning for a started stream that reads the same exclusive source as
+	// another started stream, rather than rejecting it - see ExclusiveSourceKeyer
+	WarnExclusiveSourceConflicts bool `ffstruct:"EventStreamConfig" json:"warnExclusiveSourceConflicts"`
+	// MetricsManager is optional, and if set is used to emit the delivery backlog of each started stream
+	MetricsManager metric.MetricsManager `json:"-"`
+	// BacklogMetricsInterval is how often the delivery backlog of each started stream is emitted to the MetricsManager
+	BacklogMetricsInterval fftypes.FFDuration `ffstruct:"EventStreamConfig" json:"backlogMetricsInterval"`
+	// MetricsLabels are the keys of stream labels that are added to the per-stream metrics, as "label_<key>".
+	// Every distinct value is a separate series of each metric, so only include keys with a small number of values.
+	MetricsLabels []string `ffstruct:"EventStreamConfig" json:"metricsLabels,omitempty"`
 }
 
 type CheckpointsTuningConfig struct {
@@ -51,6 +68,7 @@ type EventStreamDefaults struct {
 
 type ConfigWebsocketDefaults struct {
 	DefaultDistributionMode DistributionMode `ffstruct:"EventStreamConfig" json:"distributionMode"`
+	AllowResume             bool             `ffstruct:"EventStreamConfig" json:"allowResume"`
 }
 
 type ConfigWebhookDefaults struct {
@@ -65,9 +83,21 @@ const (
 
 	ConfigDisablePrivateIPs = "disablePrivateIPs"
 
+	ConfigBlockedAlertThreshold = "blockedAlertThreshold"
+
+	ConfigShutdownTimeout = "shutdownTimeout"
+
+	ConfigMaxConcurrentStreams = "maxConcurrentStreams"
+
+	ConfigWarnExclusiveSourceConflicts = "warnExclusiveSourceConflicts"
+
+	ConfigBacklogMetricsInterval = "backlogMetricsInterval"
+	ConfigMetricsLabels          = "metricsLabels"
+
 	ConfigWebhooksDefaultTLSConfig = "tlsConfigName"
 
 	ConfigWebSocketsDistributionMode = "distributionMode"
+	ConfigWebSocketsAllowResume      = "allowResume"
 
 	ConfigDefaultsErrorHandling     = "errorHandling"
 	ConfigDefaultsBatchSize         = "batchSize"
@@ -81,6 +111,7 @@ var TLSConfigs config.ArraySection
 var WebhookDefaultsConfig config.Section
 var WebSocketsDefaultsConfig config.Section
 var RetrySection config.Section
+var RestartRetrySection config.Section
 var CheckpointsConfig config.Section
 var DefaultsConfig config.Section
 
@@ -96,6 +127,12 @@ func InitConfig(conf config.Section) {
 	tlsSubSection.SetDefault(fftls.HTTPConfTLSEnabled, true) // as it's a TLS config
 
 	conf.AddKnownKey(ConfigDisablePrivateIPs)
+	conf.AddKnownKey(ConfigBlockedAlertThreshold, "5m")
+	conf.AddKnownKey(ConfigShutdownTimeout, "30s")
+	conf.AddKnownKey(ConfigMaxConcurrentStreams, 0)
+	conf.AddKnownKey(ConfigWarnExclusiveSourceConflicts, false)
+	conf.AddKnownKey(ConfigBacklogMetricsInterval, "1s")
+	conf.AddKnownKey(ConfigMetricsLabels)
 
 	DefaultsConfig = conf.SubSection("defaults")
 
@@ -114,9 +151,14 @@ func InitConfig(conf config.Section) {
 
 	WebSocketsDefaultsConfig = DefaultsConfig.SubSection("websockets")
 	WebSocketsDefaultsConfig.AddKnownKey(ConfigWebSocketsDistributionMode, DistributionModeLoadBalance)
+	WebSocketsDefaultsConfig.AddKnownKey(ConfigWebSocketsAllowResume, false)
 
 	RetrySection = conf.SubSection("retry")
 	retry.InitConfig(RetrySection)
+
+	RestartRetrySection = conf.SubSection("restartRetry")
+	retry.InitConfig(RestartRetrySection)
+	RestartRetrySection.SetDefault(retry.ConfigJitter, true)
 }
 
 // Optional function to generate config directly from YAML configuration using the config package.
@@ -124,14 +166,21 @@ func InitConfig(conf config.Section) {
 func GenerateConfig(ctx context.Context) *Config {
 	httpDefaults, _ := ffresty.GenerateConfig(ctx, WebhookDefaultsConfig)
 	tlsConfigs := map[string]*fftls.Config{}
-	for i := 0; i < TLSConfigs.ArraySize(); i++ {
-		tlsConf := TLSConfigs.ArrayEntry(i)
+	_ = TLSConfigs.ForEach(ctx, func(_ int, tlsConf config.Section) error {
 		name := tlsConf.GetString(ConfigTLSConfigName)
 		tlsConfigs[name] = fftls.GenerateConfig(tlsConf.SubSection("tls"))
-	}
+		return nil
+	})
 	return &Config{
-		TLSConfigs:        tlsConfigs,
-		DisablePrivateIPs: RootConfig.GetBool(ConfigDisablePrivateIPs),
+		TLSConfigs:            tlsConfigs,
+		DisablePrivateIPs:     RootConfig.GetBool(ConfigDisablePrivateIPs),
+		BlockedAlertThreshold: fftypes.FFDuration(RootConfig.GetDuration(ConfigBlockedAlertThreshold)),
+		ShutdownTimeout:       fftypes.FFDuration(RootConfig.GetDuration(ConfigShutdownTimeout)),
+		MaxConcurrentStreams:  RootConfig.GetInt(ConfigMaxConcurrentStreams),
+
+		WarnExclusiveSourceConflicts: RootConfig.GetBool(ConfigWarnExclusiveSourceConflicts),
+		BacklogMetricsInterval:       fftypes.FFDuration(RootConfig.GetDuration(ConfigBacklogMetricsInterval)),
+		MetricsLabels:                RootConfig.GetStringSlice(ConfigMetricsLabels),
 		Checkpoints: CheckpointsTuningConfig{
 			Asynchronous:            CheckpointsConfig.GetBool(ConfigCheckpointsAsynchronous),
 			UnmatchedEventThreshold: CheckpointsConfig.GetInt64(ConfigCheckpointsUnmatchedEventThreshold),
@@ -144,11 +193,13 @@ func GenerateConfig(ctx context.Context) *Config {
 			BlockedRetryDelay: fftypes.FFDuration(DefaultsConfig.GetDuration(ConfigDefaultsBlockedRetryDelay)),
 			WebSocketDefaults: ConfigWebsocketDefaults{
 				DefaultDistributionMode: fftypes.FFEnum(WebSocketsDefaultsConfig.GetString(ConfigWebSocketsDistributionMode)),
+				AllowResume:             WebSocketsDefaultsConfig.GetBool(ConfigWebSocketsAllowResume),
 			},
 			WebhookDefaults: ConfigWebhookDefaults{
 				HTTPConfig: httpDefaults.HTTPConfig,
 			},
 		},
-		Retry: retry.NewFromConfig(RetrySection),
+		Retry:        retry.NewFromConfig(RetrySection),
+		RestartRetry: retry.NewFromConfig(RestartRetrySection),
 	}
 }
@@ -66,7 +66,7 @@ func (ts *testSource) Validate(ctx context.Context, config *testESConfig) error
 	return nil
 }
 
-func (ts *testSource) Run(ctx context.Context, spec *EventStreamSpec[testESConfig], checkpointSequenceID string, deliver Deliver[testData]) error {
+func (ts *testSource) Run(ctx context.Context, spec *EventStreamSpec[testESConfig], checkpointSequenceID string, _ SubSourceCheckpoints, deliver Deliver[testData]) error {
 	msgNumber := 0
 	ts.startCount++
 	ts.sequenceStartedWith = checkpointSequenceID
@@ -154,6 +154,97 @@ func TestE2E_DeliveryWebSockets(t *testing.T) {
 	assert.Equal(t, 1, ts.startCount)
 }
 
+func TestE2E_DeliveryWebSocketsByTopic(t *testing.T) {
+	ctx, p, wss, wsc, done := setupE2ETest(t)
+	defer done()
+
+	ts := &testSource{started: make(chan struct{})}
+	close(ts.started)
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, ts)
+	assert.NoError(t, err)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:      ptrTo("stream1"),
+		WSTopic:   ptrTo("orders"),
+		Type:      &EventStreamTypeWebSocket,
+		BatchSize: ptrTo(10),
+		Config:    &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+
+	stored, err := mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, "orders", *stored.WSTopic)
+
+	// Consumers start the stream by its topic, rather than its name
+	err = wsc.Connect()
+	assert.NoError(t, err)
+	err = wsc.Send(ctx, []byte(`{"type":"start","stream":"orders"}`))
+	assert.NoError(t, err)
+	wsReceiveAck(ctx, t, wsc, func(batch *EventBatch[testData]) {
+		assert.Len(t, batch.Events, 10)
+	})
+}
+
+func TestE2E_DeliveryWebSocketsBatchSizeUpdate(t *testing.T) {
+	ctx, p, wss, wsc, done := setupE2ETest(t)
+
+	ts := &testSource{started: make(chan struct{})}
+	close(ts.started)
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, ts)
+	assert.NoError(t, err)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		TopicFilter: ptrTo("topic_1"),
+		Type:        &EventStreamTypeWebSocket,
+		BatchSize:   ptrTo(10),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+
+	err = wsc.Connect()
+	assert.NoError(t, err)
+	err = wsc.Send(ctx, []byte(`{"type":"start","stream":"stream1"}`))
+	assert.NoError(t, err)
+
+	wsReceiveAck(ctx, t, wsc, func(batch *EventBatch[testData]) {
+		assert.Len(t, batch.Events, 10)
+	})
+
+	// Change the batch size of the running stream
+	_, err = mgr.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		ID:          es1.ID,
+		Name:        ptrTo("stream1"),
+		TopicFilter: ptrTo("topic_1"),
+		Type:        &EventStreamTypeWebSocket,
+		BatchSize:   ptrTo(5),
+		Config:      &testESConfig{Config1: "1111"},
+	})
+	assert.NoError(t, err)
+
+	// The same connection receives the smaller batches, once any batch already assembled is delivered,
+	// without the consumer starting the stream again
+	resized := false
+	for i := 0; i < 3 && !resized; i++ {
+		wsReceiveAck(ctx, t, wsc, func(batch *EventBatch[testData]) {
+			resized = len(batch.Events) == 5
+		})
+	}
+	assert.True(t, resized)
+	status, err := mgr.GetStreamByID(ctx, *es1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, *status.BatchSize)
+
+	// The source was never restarted
+	done()
+	assert.Equal(t, 1, ts.startCount)
+}
+
 func TestE2E_DeliveryWebSocketsNack(t *testing.T) {
 	ctx, p, wss, wsc, done := setupE2ETest(t, func() {
 		RetrySection.Set(retry.ConfigMaximumDelay, "1ms" /* spin quickly */)
@@ -201,6 +292,68 @@ func TestE2E_DeliveryWebSocketsNack(t *testing.T) {
 	assert.Equal(t, 1, ts.startCount)
 }
 
+func TestE2E_DeliveryWebSocketsAckTimeout(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t, func() {
+		RetrySection.Set(retry.ConfigMaximumDelay, "1ms" /* spin quickly */)
+	})
+	defer done()
+
+	ts := &testSource{started: make(chan struct{})}
+	close(ts.started) // start delivery immediately - will block as no WS connected
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, ts)
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		TopicFilter: ptrTo("topic_1"), // only one of the topics
+		Type:        &EventStreamTypeWebSocket,
+		BatchSize:   ptrTo(10),
+		AckTimeout:  ptrTo(fftypes.FFDuration(100 * time.Millisecond)),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+
+	// Two consumers on the same server
+	server := httptest.NewServer(http.HandlerFunc(wss.(wsserver.WebSocketServer).Handler))
+	defer server.Close()
+	newConsumer := func() wsclient.WSClient {
+		wsc, err := wsclient.New(ctx, &wsclient.WSConfig{HTTPURL: server.URL}, nil, nil)
+		assert.NoError(t, err)
+		err = wsc.Connect()
+		assert.NoError(t, err)
+		err = wsc.Send(ctx, []byte(`{"type":"start","stream":"stream1"}`))
+		assert.NoError(t, err)
+		return wsc
+	}
+
+	// The first consumer takes the batch, but never acknowledges it
+	stuck := newConsumer()
+	defer stuck.Close()
+	var batch EventBatch[testData]
+	err = json.Unmarshal(<-stuck.Receive(), &batch)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, batch.Events[0].Data.Field1)
+
+	// The second consumer gets the same batch, once the first is disconnected
+	healthy := newConsumer()
+	defer healthy.Close()
+	time.Sleep(200 * time.Millisecond)
+	ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.True(t, ess.Statistics == nil || ess.Statistics.Checkpoint == "") // not advanced
+
+	wsReceiveAck(ctx, t, healthy, func(batch *EventBatch[testData]) {
+		assert.Equal(t, 1, batch.Events[0].Data.Field1)
+	})
+	assert.Eventually(t, func() bool {
+		ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+		return err == nil && ess.Statistics != nil && ess.Statistics.Checkpoint >= "000000000091"
+	}, 5*time.Second, 1*time.Millisecond)
+}
+
 func TestE2E_WebsocketDeliveryRestartReset(t *testing.T) {
 	ctx, p, wss, wsc, done := setupE2ETest(t)
 	defer done()
@@ -242,6 +395,13 @@ func TestE2E_WebsocketDeliveryRestartReset(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
+	// The last delivered event is stored with the checkpoint
+	assert.Equal(t, "000000000091", ess.LastDelivered.SequenceID)
+	assert.NotNil(t, ess.LastDelivered.DeliveredAt)
+	cp, err := p.Checkpoints().GetByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, "000000000091", cp.LastDelivered.SequenceID)
+
 	// Restart and check we get called with the checkpoint - note we don't reconnect the
 	// websocket or restart that - it remains "started" from the websocket protocol
 	// perspective throughout
@@ -262,6 +422,60 @@ func TestE2E_WebsocketDeliveryRestartReset(t *testing.T) {
 
 }
 
+func TestE2E_LastDeliveredOnInit(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t)
+	defer done()
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, &testSource{started: make(chan struct{})})
+	assert.NoError(t, err)
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStopped),
+		Type:   &EventStreamTypeWebSocket,
+		Config: &testESConfig{Config1: "1111"},
+		// unset durations are read back as zero from SQLite, so cannot be re-loaded
+		BatchTimeout:      ptrTo(fftypes.FFDuration(100 * time.Millisecond)),
+		RetryTimeout:      ptrTo(fftypes.FFDuration(100 * time.Millisecond)),
+		BlockedRetryDelay: ptrTo(fftypes.FFDuration(100 * time.Millisecond)),
+		AckTimeout:        ptrTo(fftypes.FFDuration(100 * time.Millisecond)),
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	lastDelivered := &LastDeliveredEvent{
+		SequenceID:  "000000000042",
+		Timestamp:   fftypes.Now(),
+		DeliveredAt: fftypes.Now(),
+	}
+	_, err = p.Checkpoints().Upsert(ctx, &EventStreamCheckpoint{
+		ID:            es1.ID,
+		SequenceID:    ptrTo("000000000050"),
+		LastDelivered: lastDelivered,
+	}, dbsql.UpsertOptimizationNew)
+	assert.NoError(t, err)
+
+	// The last delivered event is available as soon as the manager starts, without starting the stream
+	mgr, err = NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, &testSource{started: make(chan struct{})})
+	assert.NoError(t, err)
+	ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusStopped, ess.Status)
+	assert.Equal(t, "000000000042", ess.LastDelivered.SequenceID)
+	assert.True(t, lastDelivered.Timestamp.Equal(ess.LastDelivered.Timestamp))
+
+	// Updating the stream retains it, and resetting the stream clears it
+	es1.Name = ptrTo("stream1b")
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	ess, err = mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, "000000000042", ess.LastDelivered.SequenceID)
+	err = mgr.ResetStream(ctx, es1.GetID(), "")
+	assert.NoError(t, err)
+	ess, err = mgr.GetStreamByID(ctx, es1.GetID())
+	assert.NoError(t, err)
+	assert.Nil(t, ess.LastDelivered)
+}
+
 func TestE2E_DeliveryWebHooks200(t *testing.T) {
 	ctx, p, wss, wsc, done := setupE2ETest(t)
 	defer done()
@@ -401,6 +615,52 @@ func TestE2E_DeliveryWebHooks500Retry(t *testing.T) {
 	assert.Equal(t, 1, ts.startCount)
 }
 
+func TestE2E_CreateWithIdempotencyKey(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t)
+	defer done()
+
+	ts := &testSource{
+		started: make(chan struct{}), // we never start it
+	}
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, ts)
+	assert.NoError(t, err)
+
+	newSpec := func() *EventStreamSpec[testESConfig] {
+		return &EventStreamSpec[testESConfig]{
+			Name:           ptrTo("stream1"),
+			IdempotencyKey: ptrTo("create-request-1"),
+			Type:           &EventStreamTypeWebSocket,
+			Config: &testESConfig{
+				Config1: "confValue1",
+			},
+		}
+	}
+	es1 := newSpec()
+	created, err := mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	// A retry of the create returns the existing stream
+	es1retry := newSpec()
+	created, err = mgr.UpsertStream(ctx, es1retry)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, es1.GetID(), es1retry.GetID())
+	assert.Equal(t, "create-request-1", *es1retry.IdempotencyKey)
+
+	esList, _, err := mgr.ListStreams(ctx, EventStreamFilters.NewFilter(ctx).Eq("idempotencykey", "create-request-1"))
+	assert.NoError(t, err)
+	assert.Len(t, esList, 1)
+
+	// The key is unique in the DB, even when an ID is supplied
+	es2 := newSpec()
+	es2.ID = ptrTo(fftypes.NewUUID().String())
+	es2.Name = ptrTo("stream2")
+	_, err = mgr.UpsertStream(ctx, es2)
+	assert.Error(t, err)
+}
+
 // This test demonstrates the CRUD features
 func TestE2E_CRUDLifecycle(t *testing.T) {
 	ctx, p, wss, _, done := setupE2ETest(t)
@@ -432,6 +692,7 @@ func TestE2E_CRUDLifecycle(t *testing.T) {
 		TopicFilter: ptrTo("topic2"), // only one of the topics
 		Type:        &EventStreamTypeWebSocket,
 		Status:      &EventStreamStatusStopped,
+		Labels:      Labels{"team": "payments", "env": "dev"},
 		Config: &testESConfig{
 			Config1: "confValue2",
 		},
@@ -449,6 +710,17 @@ func TestE2E_CRUDLifecycle(t *testing.T) {
 	assert.Equal(t, 50, *esList[0].BatchSize) // picked up default when it was loaded
 	assert.Equal(t, "confValue2", esList[0].Config.Config1)
 	assert.Equal(t, EventStreamStatusStopped, esList[0].Status)
+	assert.Equal(t, Labels{"team": "payments", "env": "dev"}, esList[0].Labels)
+
+	// Find the second one by label
+	fb := EventStreamFilters.NewFilter(ctx)
+	esList, _, err = mgr.ListStreams(ctx, fb.And(fb.Eq("labels.team", "payments"), fb.Neq("labels.env", "prod")))
+	assert.NoError(t, err)
+	assert.Len(t, esList, 1)
+	assert.Equal(t, "stream2", *esList[0].Name)
+	esList, _, err = mgr.ListStreams(ctx, fb.Eq("labels.team", "pay"))
+	assert.NoError(t, err)
+	assert.Empty(t, esList)
 
 	// Get the first by ID
 	es1c, err := mgr.GetStreamByID(ctx, es1.GetID(), dbsql.FailIfNotFound)
@@ -469,11 +741,37 @@ func TestE2E_CRUDLifecycle(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, EventStreamStatusStarted, es2c.Status)
 	assert.Equal(t, "stream2a", *es2c.Name)
+	assert.Empty(t, es2c.StoppedReason)
 	err = mgr.StopStream(ctx, es2.GetID())
 	assert.NoError(t, err)
 	es2c, err = mgr.GetStreamByID(ctx, es2.GetID(), dbsql.FailIfNotFound)
 	assert.NoError(t, err)
 	assert.Equal(t, EventStreamStatusStopped, es2c.Status)
+	assert.Equal(t, StopReasonRequested, es2c.StoppedReason)
+
+	// The reason is persisted, and cleared when the stream is started again
+	err = mgr.StartStream(ctx, es2.GetID())
+	assert.NoError(t, err)
+	persisted, err := p.EventStreams().GetByID(ctx, es2.GetID())
+	assert.NoError(t, err)
+	assert.Empty(t, persisted.StoppedReason)
+	err = mgr.StopStreamWithReason(ctx, es2.GetID(), "maintenance")
+	assert.NoError(t, err)
+	persisted, err = p.EventStreams().GetByID(ctx, es2.GetID())
+	assert.NoError(t, err)
+	assert.Equal(t, "maintenance", *persisted.StoppedReason)
+	es2c, err = mgr.GetStreamByID(ctx, es2.GetID(), dbsql.FailIfNotFound)
+	assert.NoError(t, err)
+	assert.Equal(t, "maintenance", es2c.StoppedReason)
+
+	// An upsert of the stopped stream keeps the reason
+	es2.Status = &EventStreamStatusStopped
+	_, err = mgr.UpsertStream(ctx, es2)
+	assert.NoError(t, err)
+	es2c, err = mgr.GetStreamByID(ctx, es2.GetID(), dbsql.FailIfNotFound)
+	assert.NoError(t, err)
+	assert.Equal(t, "maintenance", es2c.StoppedReason)
+
 	err = mgr.DeleteStream(ctx, es2.GetID())
 	assert.NoError(t, err)
 
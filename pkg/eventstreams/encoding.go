@@ -0,0 +1,76 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type PayloadEncoding = fftypes.FFEnum
+
+var (
+	PayloadEncodingJSON    = fftypes.FFEnumValue("payloadencoding", "json")
+	PayloadEncodingCBOR    = fftypes.FFEnumValue("payloadencoding", "cbor")
+	PayloadEncodingMsgpack = fftypes.FFEnumValue("payloadencoding", "msgpack")
+)
+
+// PayloadEncoder serializes the generic document model produced from the JSON of a batch,
+// so the structure (field names, custom marshaling etc.) is identical across encodings
+type PayloadEncoder func(v interface{}) ([]byte, error)
+
+var binaryEncodersMux sync.RWMutex
+
+var binaryEncoders = map[PayloadEncoding]PayloadEncoder{
+	PayloadEncodingCBOR:    cbor.Marshal,
+	PayloadEncodingMsgpack: msgpack.Marshal,
+}
+
+// RegisterPayloadEncoding adds (or replaces) a binary encoding that WebSocket streams can select with
+// payloadEncoding, returning the enum value to use in the spec. The "cbor" and "msgpack" encodings are built in.
+// The name must be registered before any stream that uses it is created or loaded.
+func RegisterPayloadEncoding(name string, encoder PayloadEncoder) PayloadEncoding {
+	binaryEncodersMux.Lock()
+	defer binaryEncodersMux.Unlock()
+
+	encoding := PayloadEncoding(name)
+	if _, exists := binaryEncoders[encoding]; !exists {
+		encoding = fftypes.FFEnumValue("payloadencoding", name)
+	}
+	binaryEncoders[encoding] = encoder
+	return encoding
+}
+
+// encodePayload serializes the batch in a non-JSON encoding
+func encodePayload(ctx context.Context, encoding PayloadEncoding, batch interface{}) ([]byte, error) {
+	binaryEncodersMux.RLock()
+	encoder, ok := binaryEncoders[encoding]
+	binaryEncodersMux.RUnlock()
+	if !ok {
+		return nil, i18n.NewError(ctx, i18n.MsgInvalidEnumValue, encoding, "payloadencoding", fftypes.FFEnumValues("payloadencoding"))
+	}
+	doc, err := fftypes.JSONGenericDocument(batch)
+	if err != nil {
+		return nil, err
+	}
+	return encoder(doc)
+}
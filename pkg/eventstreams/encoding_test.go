@@ -0,0 +1,123 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func testEncodingBatch() *EventBatch[testData] {
+	return &EventBatch[testData]{
+		Type:        MessageTypeEventBatch,
+		StreamID:    "stream1",
+		BatchNumber: 12345,
+		Events: []*Event[testData]{
+			{Data: &testData{Field1: 42}},
+		},
+	}
+}
+
+func TestEncodePayloadCBOR(t *testing.T) {
+	b, err := encodePayload(context.Background(), PayloadEncodingCBOR, testEncodingBatch())
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = cbor.Unmarshal(b, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "stream1", decoded["stream"])
+	assert.Equal(t, uint64(12345), decoded["batchNumber"])
+	events := decoded["events"].([]interface{})
+	assert.Len(t, events, 1)
+	assert.Equal(t, uint64(42), events[0].(map[interface{}]interface{})["field1"])
+}
+
+func TestEncodePayloadMsgpack(t *testing.T) {
+	b, err := encodePayload(context.Background(), PayloadEncodingMsgpack, testEncodingBatch())
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = msgpack.Unmarshal(b, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, "stream1", decoded["stream"])
+	assert.EqualValues(t, 12345, decoded["batchNumber"])
+	events := decoded["events"].([]interface{})
+	assert.Len(t, events, 1)
+	assert.EqualValues(t, 42, events[0].(map[string]interface{})["field1"])
+}
+
+func TestEncodePayloadNumbers(t *testing.T) {
+	b, err := encodePayload(context.Background(), PayloadEncodingMsgpack, map[string]interface{}{
+		"int":   -5,
+		"float": 1.5,
+		"big":   map[string]interface{}{"value": []interface{}{json.Number("115792089237316195423570985008687907853269984665640564039457584007913129639935")}},
+	})
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = msgpack.Unmarshal(b, &decoded)
+	assert.NoError(t, err)
+	assert.EqualValues(t, -5, decoded["int"])
+	assert.Equal(t, 1.5, decoded["float"])
+	assert.Equal(t, "115792089237316195423570985008687907853269984665640564039457584007913129639935", decoded["big"].(map[string]interface{})["value"].([]interface{})[0])
+}
+
+func TestEncodePayloadBadEncoding(t *testing.T) {
+	_, err := encodePayload(context.Background(), PayloadEncodingJSON, testEncodingBatch())
+	assert.Regexp(t, "FF00172", err)
+}
+
+func TestEncodePayloadBadJSON(t *testing.T) {
+	_, err := encodePayload(context.Background(), PayloadEncodingCBOR, map[string]interface{}{"bad": map[bool]bool{true: false}})
+	assert.Error(t, err)
+}
+
+func TestRegisterPayloadEncoding(t *testing.T) {
+	encoding := RegisterPayloadEncoding("ut_custom", func(v interface{}) ([]byte, error) {
+		return json.Marshal(map[string]interface{}{"wrapped": v})
+	})
+	assert.Equal(t, PayloadEncoding("ut_custom"), encoding)
+
+	// The registered encoding can be selected by a stream
+	wc := &WebSocketConfig{PayloadEncoding: &encoding}
+	assert.NoError(t, wc.validate(context.Background(), &ConfigWebsocketDefaults{DefaultDistributionMode: DistributionModeLoadBalance}, false))
+
+	b, err := encodePayload(context.Background(), encoding, map[string]interface{}{"value": 42})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"wrapped":{"value":42}}`, string(b))
+
+	// Replacing an encoding does not register the enum value again
+	RegisterPayloadEncoding("ut_custom", func(v interface{}) ([]byte, error) {
+		return []byte("replaced"), nil
+	})
+	b, err = encodePayload(context.Background(), encoding, map[string]interface{}{})
+	assert.NoError(t, err)
+	assert.Equal(t, "replaced", string(b))
+	count := 0
+	for _, v := range fftypes.FFEnumValues("payloadencoding") {
+		if v == "ut_custom" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+}
@@ -18,6 +18,8 @@ package eventstreams
 
 import (
 	"encoding/json"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 )
 
 const MessageTypeEventBatch = "event_batch"
@@ -27,6 +29,25 @@ type EventBatch[DataType any] struct {
 	StreamID    string             `json:"stream"`      // the ID of the event stream for this event
 	BatchNumber int64              `json:"batchNumber"` // should be provided back in the ack
 	Events      []*Event[DataType] `json:"events"`      // an array of events allows efficient batch acknowledgment
+	Payload     interface{}        `json:"-"`           // set if the runtime transformed the events, and serialized in place of them
+}
+
+func (eb EventBatch[DataType]) MarshalJSON() ([]byte, error) {
+	var events interface{} = eb.Events
+	if eb.Payload != nil {
+		events = eb.Payload
+	}
+	return json.Marshal(&struct {
+		Type        string      `json:"type"`
+		StreamID    string      `json:"stream"`
+		BatchNumber int64       `json:"batchNumber"`
+		Events      interface{} `json:"events"`
+	}{
+		Type:        eb.Type,
+		StreamID:    eb.StreamID,
+		BatchNumber: eb.BatchNumber,
+		Events:      events,
+	})
 }
 
 type Event[DataType any] struct {
@@ -35,11 +56,15 @@ type Event[DataType any] struct {
 	// Will be flattened into the struct.
 	// Can define topic and/or sequenceId, but these will overridden with EventCommon strings in the JSON serialization.
 	Data *DataType `json:"-"`
+
+	progress bool // marks progress reported by the source, passed to the batch loop in order with the events
 }
 
 type EventCommon struct {
-	Topic      string `json:"topic,omitempty"` // describes the sub-stream of events (optional) allowing sever-side event filtering (regexp)
-	SequenceID string `json:"sequenceId"`      // deterministic ID for the event, that must be alpha-numerically orderable within the stream (numbers must be left-padded hex/decimal strings for ordering)
+	Topic      string          `json:"topic,omitempty"`     // describes the sub-stream of events (optional) allowing sever-side event filtering (regexp)
+	SequenceID string          `json:"sequenceId"`          // deterministic ID for the event, that must be alpha-numerically orderable within the stream (numbers must be left-padded hex/decimal strings for ordering)
+	SubSource  string          `json:"subSource,omitempty"` // for runtimes with multiple upstream sources, the name of the source the SequenceID is ordered within (checkpointed separately)
+	Timestamp  *fftypes.FFTime `json:"-"`                   // when the event occurred in the source (optional) used to report the age of undelivered events, rather than the time it was read. Not delivered - include it in Data if required
 }
 
 func (e *Event[DataType]) UnmarshalJSON(b []byte) error {
@@ -60,5 +85,8 @@ func (e Event[DataType]) MarshalJSON() ([]byte, error) {
 	_ = json.Unmarshal(dataJSON, &m)
 	m["topic"] = e.Topic
 	m["sequenceId"] = e.SequenceID
+	if e.SubSource != "" {
+		m["subSource"] = e.SubSource
+	}
 	return json.Marshal(m)
 }
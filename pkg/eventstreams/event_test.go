@@ -68,3 +68,60 @@ func TestUnmarshalFlatteningFail(t *testing.T) {
 	err := json.Unmarshal([]byte(`{"topic":false}`), &e)
 	assert.Error(t, err)
 }
+
+func TestMarshalEventBatchPayload(t *testing.T) {
+	type myEvent struct {
+		Field1 string `json:"field1"`
+	}
+	batch := &EventBatch[myEvent]{
+		Type:        MessageTypeEventBatch,
+		StreamID:    "stream1",
+		BatchNumber: 12345,
+		Events: []*Event[myEvent]{{
+			EventCommon: EventCommon{SequenceID: "11111"},
+			Data:        &myEvent{Field1: "val1111"},
+		}},
+	}
+	d, err := json.Marshal(batch)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "event_batch",
+		"stream": "stream1",
+		"batchNumber": 12345,
+		"events": [{"sequenceId": "11111", "topic": "", "field1": "val1111"}]
+	}`, string(d))
+
+	batch.Payload = []string{"projected"}
+	d, err = json.Marshal(batch)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "event_batch",
+		"stream": "stream1",
+		"batchNumber": 12345,
+		"events": ["projected"]
+	}`, string(d))
+}
+
+func TestMarshalSubSource(t *testing.T) {
+	e := Event[testData]{
+		EventCommon: EventCommon{
+			Topic:      "topic1",
+			SequenceID: "11111",
+			SubSource:  "source1",
+		},
+		Data: &testData{Field1: 12345},
+	}
+	d, err := json.Marshal(&e)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"topic": "topic1",
+		"sequenceId": "11111",
+		"subSource": "source1",
+		"field1": 12345
+	}`, string(d))
+
+	var e2 Event[testData]
+	err = json.Unmarshal(d, &e2)
+	assert.NoError(t, err)
+	assert.Equal(t, e, e2)
+}
@@ -17,17 +17,24 @@
 package eventstreams
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/hyperledger/firefly-common/pkg/wsserver"
 )
 
 type EventStreamType = fftypes.FFEnum
@@ -35,6 +42,7 @@ type EventStreamType = fftypes.FFEnum
 var (
 	EventStreamTypeWebhook   = fftypes.FFEnumValue("estype", "webhook")
 	EventStreamTypeWebSocket = fftypes.FFEnumValue("estype", "websocket")
+	EventStreamTypeInProcess = fftypes.FFEnumValue("estype", "inprocess")
 )
 
 type ErrorHandlingType = fftypes.FFEnum
@@ -44,6 +52,19 @@ var (
 	ErrorHandlingTypeSkip  = fftypes.FFEnumValue("ehtype", "skip")
 )
 
+// DeliveryModeType determines when the checkpoint is advanced, relative to delivery of a batch
+type DeliveryModeType = fftypes.FFEnum
+
+var (
+	// DeliveryModeAtLeastOnce (the default) checkpoints after each batch is delivered, and retries delivery
+	// according to the error handling of the stream. After a restart, any batches that were delivered but
+	// not checkpointed are delivered again - so consumers must tolerate duplicates.
+	DeliveryModeAtLeastOnce = fftypes.FFEnumValue("deliverymode", "at_least_once")
+	// DeliveryModeAtMostOnce checkpoints each batch before a single delivery attempt, and drops the batch
+	// if that attempt fails. Consumers never receive duplicates, but a failure or restart can lose a batch.
+	DeliveryModeAtMostOnce = fftypes.FFEnumValue("deliverymode", "at_most_once")
+)
+
 type DispatchStatus = fftypes.FFEnum
 
 var (
@@ -60,9 +81,20 @@ var (
 	EventStreamStatusStarted         = fftypes.FFEnumValue("esstatus", "started")
 	EventStreamStatusStopped         = fftypes.FFEnumValue("esstatus", "stopped")
 	EventStreamStatusDeleted         = fftypes.FFEnumValue("esstatus", "deleted")
+	EventStreamStatusCompleted       = fftypes.FFEnumValue("esstatus", "completed")        // a catchupOnly stream that has delivered every event up to its catchupTip
 	EventStreamStatusStopping        = fftypes.FFEnumValue("esstatus", "stopping")         // not persisted
 	EventStreamStatusStoppingDeleted = fftypes.FFEnumValue("esstatus", "stopping_deleted") // not persisted
 	EventStreamStatusUnknown         = fftypes.FFEnumValue("esstatus", "unknown")          // not persisted
+	EventStreamStatusOutsideSchedule = fftypes.FFEnumValue("esstatus", "outside_schedule") // not persisted - started, but suspended until the next active schedule window
+	EventStreamStatusScheduled       = fftypes.FFEnumValue("esstatus", "scheduled")        // not persisted - stopped, until it is started automatically at its startAt time
+)
+
+const (
+	// StopReasonRequested is the stopped reason of a stream stopped without a reason
+	StopReasonRequested = "requested"
+	// StopReasonSchedule is the stopped reason of a started stream suspended outside of its active schedule,
+	// or of a stream waiting to be started at its startAt time
+	StopReasonSchedule = "schedule"
 )
 
 // Let's us check that the config serializes
@@ -76,20 +108,37 @@ type EventStreamSpec[CT any] struct {
 	Created           *fftypes.FFTime    `ffstruct:"eventstream" json:"created"`
 	Updated           *fftypes.FFTime    `ffstruct:"eventstream" json:"updated"`
 	Name              *string            `ffstruct:"eventstream" json:"name,omitempty"`
-	Status            *EventStreamStatus `ffstruct:"eventstream" json:"status,omitempty"`
+	IdempotencyKey    *string            `ffstruct:"eventstream" json:"idempotencyKey,omitempty"` // a create without an ID that repeats the key of an existing stream returns that stream
+	Status            *EventStreamStatus `ffstruct:"eventstream" json:"status,omitempty" ffenum:"esstatus"`
 	Type              *EventStreamType   `ffstruct:"eventstream" json:"type,omitempty" ffenum:"estype"`
-	InitialSequenceID *string            `ffstruct:"eventstream" json:"initialSequenceID,omitempty" ffenum:"estype"`
-	TopicFilter       *string            `ffstruct:"eventstream" json:"topicFilter,omitempty" ffenum:"estype"`
+	InitialSequenceID *string            `ffstruct:"eventstream" json:"initialSequenceID,omitempty"`
+	InitialTimestamp  *fftypes.FFTime    `ffstruct:"eventstream" json:"initialTimestamp,omitempty"` // resolved into InitialSequenceID on upsert, so never persisted
+	TopicFilter       *string            `ffstruct:"eventstream" json:"topicFilter,omitempty"`
+	CompactionKey     *string            `ffstruct:"eventstream" json:"compactionKey,omitempty"` // opt-in: only the latest event in each batch with the same value of this field (dot separated for nested fields) is delivered
+	SharedSource      *string            `ffstruct:"eventstream" json:"sharedSource,omitempty"`  // streams with the same name share one Run loop, if the runtime is a SequenceComparer
+	Labels            Labels             `ffstruct:"eventstream" json:"labels,omitempty"`
 	Config            *CT                `ffstruct:"eventstream" json:"config,omitempty"`
 
-	ErrorHandling     *ErrorHandlingType  `ffstruct:"eventstream" json:"errorHandling"`
-	BatchSize         *int                `ffstruct:"eventstream" json:"batchSize"`
-	BatchTimeout      *fftypes.FFDuration `ffstruct:"eventstream" json:"batchTimeout"`
-	RetryTimeout      *fftypes.FFDuration `ffstruct:"eventstream" json:"retryTimeout"`
-	BlockedRetryDelay *fftypes.FFDuration `ffstruct:"eventstream" json:"blockedRetryDelay"`
+	ErrorHandling      *ErrorHandlingType  `ffstruct:"eventstream" json:"errorHandling" ffenum:"ehtype"`
+	DeliveryMode       *DeliveryModeType   `ffstruct:"eventstream" json:"deliveryMode" ffenum:"deliverymode"`
+	BatchSize          *int                `ffstruct:"eventstream" json:"batchSize"`
+	CatchupBatchSize   *int                `ffstruct:"eventstream" json:"catchupBatchSize,omitempty"` // used instead of batchSize while more than this many events behind, if the runtime is a SequenceLagResolver
+	BatchTimeout       *fftypes.FFDuration `ffstruct:"eventstream" json:"batchTimeout"`
+	MaxBatchSizeBytes  *fftypes.ByteSize   `ffstruct:"eventstream" json:"maxBatchSizeBytes,omitempty"`
+	MaxInFlightBatches *int                `ffstruct:"eventstream" json:"maxInFlightBatches,omitempty"` // batches dispatched but not yet acknowledged at once, delivered in parallel when more than 1 - nil is 1
+	OrderingKey        *string             `ffstruct:"eventstream" json:"orderingKey,omitempty"`        // opt-in: batches in flight in parallel never share a value of this field (dot separated for nested fields), so events with the same value are delivered in order
+	RetryTimeout       *fftypes.FFDuration `ffstruct:"eventstream" json:"retryTimeout"`
+	BlockedRetryDelay  *fftypes.FFDuration `ffstruct:"eventstream" json:"blockedRetryDelay"`
+	AckTimeout         *fftypes.FFDuration `ffstruct:"eventstream" json:"ackTimeout,omitempty"` // fail delivery to a WebSocket consumer that does not acknowledge in time, and disconnect it - nil waits forever
+	ActiveSchedule     *ActiveSchedule     `ffstruct:"eventstream" json:"activeSchedule,omitempty"`
+	StartAt            *fftypes.FFTime     `ffstruct:"eventstream" json:"startAt,omitempty"`     // the stream is kept stopped until this time, then started once - cleared when the stream starts
+	CatchupOnly        *bool               `ffstruct:"eventstream" json:"catchupOnly,omitempty"` // deliver the events up to the latest sequence when the stream first starts, then complete - if the runtime is a LatestSequenceResolver
+	CatchupTip         *string             `ffstruct:"eventstream" json:"catchupTip,omitempty"`  // set by the manager to the latest sequence when a catchupOnly stream first starts
+	StoppedReason      *string             `json:"-"`                                            // persisted on stop, and reported in EventStreamWithStatus
 
 	Webhook   *WebhookConfig   `ffstruct:"eventstream" json:"webhook,omitempty"`
 	WebSocket *WebSocketConfig `ffstruct:"eventstream" json:"websocket,omitempty"`
+	WSTopic   *string          `ffstruct:"eventstream" json:"wsTopic,omitempty"` // the stream consumers start on the WebSocket server - defaults to the name
 
 	topicFilterRegexp *regexp.Regexp
 }
@@ -101,6 +150,21 @@ func (esc *EventStreamSpec[CT]) GetID() string {
 	return *esc.ID
 }
 
+func (esc *EventStreamSpec[CT]) catchupOnly() bool {
+	return esc.CatchupOnly != nil && *esc.CatchupOnly
+}
+
+// wsTopic is the stream WebSocket consumers start, to listen to this event stream
+func (esc *EventStreamSpec[CT]) wsTopic() string {
+	if esc.WSTopic != nil {
+		return *esc.WSTopic
+	}
+	if esc.Name == nil {
+		return ""
+	}
+	return *esc.Name
+}
+
 func (esc *EventStreamSpec[CT]) SetCreated(t *fftypes.FFTime) {
 	esc.Created = t
 }
@@ -110,28 +174,266 @@ func (esc *EventStreamSpec[CT]) SetUpdated(t *fftypes.FFTime) {
 }
 
 type EventStreamStatistics struct {
-	StartTime            *fftypes.FFTime `ffstruct:"EventStreamStatistics" json:"startTime"`
-	LastDispatchTime     *fftypes.FFTime `ffstruct:"EventStreamStatistics" json:"lastDispatchTime"`
-	LastDispatchNumber   int64           `ffstruct:"EventStreamStatistics" json:"lastDispatchBatch"`
-	LastDispatchAttempts int             `ffstruct:"EventStreamStatistics" json:"lastDispatchAttempts,omitempty"`
-	LastDispatchFailure  string          `ffstruct:"EventStreamStatistics" json:"lastDispatchFailure,omitempty"`
-	LastDispatchStatus   DispatchStatus  `ffstruct:"EventStreamStatistics" json:"lastDispatchComplete"`
-	HighestDetected      string          `ffstruct:"EventStreamStatistics" json:"highestDetected"`
-	HighestDispatched    string          `ffstruct:"EventStreamStatistics" json:"highestDispatched"`
-	Checkpoint           string          `ffstruct:"EventStreamStatistics" json:"checkpoint"`
+	StartTime             *fftypes.FFTime      `ffstruct:"EventStreamStatistics" json:"startTime"`
+	LastDispatchTime      *fftypes.FFTime      `ffstruct:"EventStreamStatistics" json:"lastDispatchTime"`
+	LastDispatchNumber    int64                `ffstruct:"EventStreamStatistics" json:"lastDispatchBatch"`
+	LastDispatchAttempts  int                  `ffstruct:"EventStreamStatistics" json:"lastDispatchAttempts,omitempty"`
+	LastDispatchFailure   string               `ffstruct:"EventStreamStatistics" json:"lastDispatchFailure,omitempty"`
+	LastDispatchStatus    DispatchStatus       `ffstruct:"EventStreamStatistics" json:"lastDispatchComplete" ffenum:"edstatus"`
+	HighestDetected       string               `ffstruct:"EventStreamStatistics" json:"highestDetected"`
+	HighestDispatched     string               `ffstruct:"EventStreamStatistics" json:"highestDispatched"`
+	Checkpoint            string               `ffstruct:"EventStreamStatistics" json:"checkpoint"`
+	SubSourceCheckpoints  SubSourceCheckpoints `ffstruct:"EventStreamStatistics" json:"subSourceCheckpoints,omitempty"`
+	Blocked               bool                 `ffstruct:"EventStreamStatistics" json:"blocked"`
+	BlockedSince          *fftypes.FFTime      `ffstruct:"EventStreamStatistics" json:"blockedSince,omitempty"`
+	BlockedDuration       fftypes.FFDuration   `ffstruct:"EventStreamStatistics" json:"blockedDuration,omitempty"`
+	QueueDepth            int64                `ffstruct:"EventStreamStatistics" json:"queueDepth"`
+	OldestPendingEventAge fftypes.FFDuration   `ffstruct:"EventStreamStatistics" json:"oldestPendingEventAge,omitempty"`
+	Restarts              int                  `ffstruct:"EventStreamStatistics" json:"restarts"`
+	LastRestartTime       *fftypes.FFTime      `ffstruct:"EventStreamStatistics" json:"lastRestartTime,omitempty"`
+	LastRestartError      string               `ffstruct:"EventStreamStatistics" json:"lastRestartError,omitempty"`
+	LastActivityTime      *fftypes.FFTime      `ffstruct:"EventStreamStatistics" json:"lastActivityTime,omitempty"`
+	CompactedEvents       int64                `ffstruct:"EventStreamStatistics" json:"compactedEvents,omitempty"`
+
+	backlog *streamBacklog
+}
+
+// streamBacklog tracks the events read from the source that have not yet been delivered.
+// It is updated by the source and batch loops, and read concurrently for status and metrics.
+type streamBacklog struct {
+	queued        atomic.Int64 // events in the buffer between the source and the batch loop, or in the current batch
+	oldestPending atomic.Int64 // unix nanos timestamp of the first event in the current batch, or zero
+	lastActivity  atomic.Int64 // unix nanos timestamp the source last passed events or reported progress, or zero
+	delivered     atomic.Int64 // events delivered since the stream started
+	checkpointed  atomic.Int64 // events delivered since the stream started, that are covered by the last stored checkpoint
+}
+
+// The backlog methods are safe to call on a nil backlog, in which case nothing is tracked
+
+func (b *streamBacklog) queue(delta int64) {
+	if b != nil {
+		b.queued.Add(delta)
+	}
+}
+
+func (b *streamBacklog) batchStarted(oldest time.Time) {
+	if b != nil {
+		b.oldestPending.Store(oldest.UnixNano())
+	}
+}
+
+func (b *streamBacklog) batchDelivered(count int) {
+	if b != nil {
+		b.queued.Add(-int64(count))
+		b.oldestPending.Store(0)
+	}
+}
+
+func (b *streamBacklog) eventsDelivered(count int) {
+	if b != nil {
+		b.delivered.Add(int64(count))
+	}
+}
+
+func (b *streamBacklog) deliveredCount() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.delivered.Load()
+}
+
+// checkpointStored is called with the delivered count captured when the checkpoint was taken
+func (b *streamBacklog) checkpointStored(delivered int64) {
+	if b != nil {
+		b.checkpointed.Store(delivered)
+	}
+}
+
+// sinceCheckpoint is the number of events delivered that would be redelivered after a crash
+func (b *streamBacklog) sinceCheckpoint() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.delivered.Load() - b.checkpointed.Load()
+}
+
+func (b *streamBacklog) queueDepth() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.queued.Load()
+}
+
+func (b *streamBacklog) oldestPendingAge() time.Duration {
+	if b == nil {
+		return 0
+	}
+	oldest := b.oldestPending.Load()
+	if oldest == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, oldest))
+}
+
+func (b *streamBacklog) sourceActive() {
+	if b != nil {
+		b.lastActivity.Store(time.Now().UnixNano())
+	}
+}
+
+func (b *streamBacklog) lastSourceActivity() *fftypes.FFTime {
+	if b == nil {
+		return nil
+	}
+	lastActivity := b.lastActivity.Load()
+	if lastActivity == 0 {
+		return nil
+	}
+	return fftypes.UnixTime(lastActivity)
+}
+
+// updateBacklog calculates the delivery backlog at the point of the call
+func (s *EventStreamStatistics) updateBacklog() {
+	s.QueueDepth = s.backlog.queueDepth()
+	s.OldestPendingEventAge = fftypes.FFDuration(s.backlog.oldestPendingAge())
+	s.LastActivityTime = s.backlog.lastSourceActivity()
+}
+
+// sourceIdle is the time since the source last passed events or reported progress,
+// or since the stream started if it has not yet done either
+func (s *EventStreamStatistics) sourceIdle() time.Duration {
+	since := s.backlog.lastSourceActivity()
+	if since == nil {
+		since = s.StartTime
+	}
+	return time.Since(*since.Time())
+}
+
+// updateBlocked calculates whether delivery is currently blocked, because the in-flight batch
+// has failed at least once, or has been waiting on the consumer for longer than the threshold.
+func (s *EventStreamStatistics) updateBlocked(threshold time.Duration) {
+	s.Blocked = false
+	s.BlockedSince = nil
+	s.BlockedDuration = 0
+	if s.LastDispatchTime == nil {
+		return
+	}
+	waiting := time.Since(*s.LastDispatchTime.Time())
+	switch s.LastDispatchStatus {
+	case DispatchStatusRetrying, DispatchStatusBlocked:
+		s.Blocked = true
+	case DispatchStatusDispatching:
+		s.Blocked = threshold > 0 && waiting >= threshold
+	}
+	if s.Blocked {
+		s.BlockedSince = s.LastDispatchTime
+		s.BlockedDuration = fftypes.FFDuration(waiting)
+	}
 }
 
 type EventStreamWithStatus[CT any] struct {
 	*EventStreamSpec[CT]
-	Status     EventStreamStatus      `ffstruct:"EventStream" json:"status"`
+	Status     EventStreamStatus      `ffstruct:"EventStream" json:"status" ffenum:"esstatus"`
 	Statistics *EventStreamStatistics `ffstruct:"EventStream" json:"statistics,omitempty"`
+	// the last delivered event is available whether or not the stream is running, including after a restart
+	LastDelivered *LastDeliveredEvent `ffstruct:"EventStream" json:"lastDelivered,omitempty"`
+	// the events delivered but not yet covered by a stored checkpoint, which are at risk of redelivery on a crash
+	DeliveredSinceCheckpoint int64 `ffstruct:"EventStream" json:"deliveredSinceCheckpoint"`
+	// why the stream is not delivering, when it is stopped or outside its active schedule
+	StoppedReason string `ffstruct:"EventStream" json:"stoppedReason,omitempty"`
+	// the WebSocket connections consuming a websocket stream, so it is clear whether a stalled stream has no consumer
+	Consumers *ConsumerStatus `ffstruct:"EventStream" json:"consumers,omitempty"`
+}
+
+// ConsumerStatus is the state of the WebSocket connections consuming a websocket stream
+type ConsumerStatus struct {
+	Connected       bool                       `ffstruct:"ConsumerStatus" json:"connected"`
+	Count           int                        `ffstruct:"ConsumerStatus" json:"count"`
+	ConnectedSince  *fftypes.FFTime            `ffstruct:"ConsumerStatus" json:"connectedSince,omitempty"` // when the longest running consumer started the stream
+	PayloadEncoding *PayloadEncoding           `ffstruct:"ConsumerStatus" json:"payloadEncoding,omitempty"`
+	Connections     []*wsserver.StreamConsumer `ffstruct:"ConsumerStatus" json:"connections"`
 }
 
 type EventStreamCheckpoint struct {
-	ID         *string         `ffstruct:"EventStreamCheckpoint" json:"id"`
-	Created    *fftypes.FFTime `ffstruct:"EventStreamCheckpoint" json:"created"`
-	Updated    *fftypes.FFTime `ffstruct:"EventStreamCheckpoint" json:"updated"`
-	SequenceID *string         `ffstruct:"EventStreamCheckpoint" json:"sequenceId,omitempty"`
+	ID         *string              `ffstruct:"EventStreamCheckpoint" json:"id"`
+	Created    *fftypes.FFTime      `ffstruct:"EventStreamCheckpoint" json:"created"`
+	Updated    *fftypes.FFTime      `ffstruct:"EventStreamCheckpoint" json:"updated"`
+	SequenceID *string              `ffstruct:"EventStreamCheckpoint" json:"sequenceId,omitempty"`
+	SubSources SubSourceCheckpoints `ffstruct:"EventStreamCheckpoint" json:"subSources,omitempty"`
+	// LastDelivered is stored with each checkpoint, and can be behind the sequenceId where later
+	// events were filtered out, or for at-most-once delivery where the checkpoint precedes delivery
+	LastDelivered *LastDeliveredEvent `ffstruct:"EventStreamCheckpoint" json:"lastDelivered,omitempty"`
+}
+
+// LastDeliveredEvent records the last event in a batch that was successfully delivered to the consumer
+type LastDeliveredEvent struct {
+	SequenceID  string          `ffstruct:"LastDeliveredEvent" json:"sequenceId"`
+	SubSource   string          `ffstruct:"LastDeliveredEvent" json:"subSource,omitempty"`
+	Timestamp   *fftypes.FFTime `ffstruct:"LastDeliveredEvent" json:"timestamp,omitempty"` // only set if provided by the source
+	DeliveredAt *fftypes.FFTime `ffstruct:"LastDeliveredEvent" json:"deliveredAt"`
+}
+
+// Store in DB as JSON
+func (ld *LastDeliveredEvent) Scan(src interface{}) error {
+	return fftypes.JSONScan(src, ld)
+}
+
+// Store in DB as JSON
+func (ld *LastDeliveredEvent) Value() (driver.Value, error) {
+	return fftypes.JSONValue(ld)
+}
+
+// SubSourceCheckpoints holds the checkpoint of each named sub-source, for runtimes that
+// fan in events from multiple upstream sources that each have their own sequence.
+// The map is keyed by the SubSource name set on events, with the sequence ID as the value.
+type SubSourceCheckpoints map[string]string
+
+// Store in DB as JSON
+func (sc *SubSourceCheckpoints) Scan(src interface{}) error {
+	return fftypes.JSONScan(src, sc)
+}
+
+// Store in DB as JSON
+func (sc SubSourceCheckpoints) Value() (driver.Value, error) {
+	return fftypes.JSONValue(sc)
+}
+
+// Labels are free-form key/value pairs for organizing streams, filterable by key as "labels.key"
+type Labels map[string]string
+
+// Store in DB as JSON
+func (l *Labels) Scan(src interface{}) error {
+	return fftypes.JSONScan(src, l)
+}
+
+// Store in DB as JSON
+func (l Labels) Value() (driver.Value, error) {
+	return fftypes.JSONValue(l)
+}
+
+// validate restricts keys and values to the characters of a name, which also ensures they
+// can be matched reliably within the stored JSON when filtering
+func (l Labels) validate(ctx context.Context) error {
+	for k, v := range l {
+		if err := fftypes.ValidateFFNameField(ctx, k, "labels"); err != nil {
+			return err
+		}
+		if err := fftypes.ValidateFFNameField(ctx, v, fmt.Sprintf("labels.%s", k)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc SubSourceCheckpoints) copy() SubSourceCheckpoints {
+	if len(sc) == 0 {
+		return nil
+	}
+	c := make(SubSourceCheckpoints, len(sc))
+	for k, v := range sc {
+		c[k] = v
+	}
+	return c
 }
 
 func (esc *EventStreamCheckpoint) GetID() string {
@@ -170,6 +472,15 @@ func checkSet[T any](ctx context.Context, storeDefaults bool, fieldName string,
 	return nil
 }
 
+// checkSetEnum is checkSet for enum fields, returning an error listing the valid options on failure
+func checkSetEnum(ctx context.Context, storeDefaults bool, fieldName string, fieldPtr **fftypes.FFEnum, defValue fftypes.FFEnum, enumType string) (err error) {
+	_ = checkSet(ctx, storeDefaults, fieldName, fieldPtr, defValue, func(v fftypes.FFEnum) bool {
+		err = v.Validate(ctx, enumType)
+		return err == nil
+	})
+	return err
+}
+
 // validate checks all the field values, once combined with defaults.
 // Optionally it stores the defaults back on the structure, to ensure no nil fields.
 // - When using at runtime: true, so later code doesn't need to worry about nil checks / defaults
@@ -189,7 +500,23 @@ func (esc *EventStreamSpec[CT]) validate(ctx context.Context, tlsConfigs map[str
 	}
 	err = fftypes.ValidateFFNameField(ctx, *esc.Name, "name")
 	if err == nil {
-		err = checkSet(ctx, setDefaults, "status", &esc.Status, EventStreamStatusStarted, func(v fftypes.FFEnum) bool { return fftypes.FFEnumValid(ctx, "esstatus", v) })
+		err = esc.Labels.validate(ctx)
+	}
+	if err == nil && esc.SharedSource != nil {
+		err = fftypes.ValidateFFNameField(ctx, *esc.SharedSource, "sharedSource")
+	}
+	if err == nil && esc.WSTopic != nil {
+		// consumers might address the stream by its topic in a URL, so it is restricted in the same way as a name
+		err = fftypes.ValidateFFNameField(ctx, *esc.WSTopic, "wsTopic")
+	}
+	if err == nil && esc.CompactionKey != nil && strings.Contains("."+*esc.CompactionKey+".", "..") {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.CompactionKey, "compactionKey")
+	}
+	if err == nil && esc.OrderingKey != nil && strings.Contains("."+*esc.OrderingKey+".", "..") {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.OrderingKey, "orderingKey")
+	}
+	if err == nil {
+		err = checkSetEnum(ctx, setDefaults, "status", &esc.Status, EventStreamStatusStarted, "esstatus")
 	}
 	if err == nil {
 		err = checkSet(ctx, setDefaults, "batchSize", &esc.BatchSize, defaults.BatchSize, func(v int) bool { return v > 0 })
@@ -197,23 +524,44 @@ func (esc *EventStreamSpec[CT]) validate(ctx context.Context, tlsConfigs map[str
 	if err == nil {
 		err = checkSet(ctx, setDefaults, "batchTimeout", &esc.BatchTimeout, defaults.BatchTimeout, func(v fftypes.FFDuration) bool { return v > 0 })
 	}
+	if err == nil && esc.CatchupBatchSize != nil && *esc.CatchupBatchSize <= 0 {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.CatchupBatchSize, "catchupBatchSize")
+	}
+	if err == nil && esc.MaxBatchSizeBytes != nil && *esc.MaxBatchSizeBytes <= 0 {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.MaxBatchSizeBytes, "maxBatchSizeBytes")
+	}
+	if err == nil && esc.MaxInFlightBatches != nil && *esc.MaxInFlightBatches <= 0 {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.MaxInFlightBatches, "maxInFlightBatches")
+	}
 	if err == nil {
 		err = checkSet(ctx, setDefaults, "retryTimeout", &esc.RetryTimeout, defaults.RetryTimeout, func(v fftypes.FFDuration) bool { return v > 0 })
 	}
 	if err == nil {
 		err = checkSet(ctx, setDefaults, "blockedRetryDelay", &esc.BlockedRetryDelay, defaults.BlockedRetryDelay, func(v fftypes.FFDuration) bool { return v > 0 })
 	}
+	if err == nil && esc.AckTimeout != nil && *esc.AckTimeout <= 0 {
+		err = i18n.NewError(ctx, i18n.MsgInvalidValue, *esc.AckTimeout, "ackTimeout")
+	}
 	if err == nil {
-		err = checkSet(ctx, setDefaults, "errorHandling", &esc.ErrorHandling, defaults.ErrorHandling, func(v fftypes.FFEnum) bool { return fftypes.FFEnumValid(ctx, "ehtype", v) })
+		err = checkSetEnum(ctx, setDefaults, "errorHandling", &esc.ErrorHandling, defaults.ErrorHandling, "ehtype")
 	}
 	if err == nil {
-		err = checkSet(ctx, true /* type always applied */, "type", &esc.Type, EventStreamTypeWebSocket, func(v fftypes.FFEnum) bool { return fftypes.FFEnumValid(ctx, "estype", v) })
+		err = checkSetEnum(ctx, setDefaults, "deliveryMode", &esc.DeliveryMode, DeliveryModeAtLeastOnce, "deliverymode")
+	}
+	if err == nil && esc.ActiveSchedule != nil {
+		err = esc.ActiveSchedule.validate(ctx)
+	}
+	if err == nil {
+		err = checkSetEnum(ctx, true /* type always applied */, "type", &esc.Type, EventStreamTypeWebSocket, "estype")
 	}
 	if err != nil {
 		return err
 	}
 	switch *esc.Type {
 	case EventStreamTypeWebSocket:
+		if esc.MaxInFlightBatches != nil && *esc.MaxInFlightBatches > 1 {
+			return i18n.NewError(ctx, i18n.MsgESMaxInFlightUnsupported)
+		}
 		if esc.WebSocket == nil {
 			esc.WebSocket = &WebSocketConfig{}
 		}
@@ -241,6 +589,9 @@ type eventStream[CT any, DT any] struct {
 	retry       *retry.Retry
 	persistence Persistence[CT]
 	stopping    chan struct{}
+
+	outsideSchedule bool
+	lastDelivered   *LastDeliveredEvent
 }
 
 type EventStreamActions[CT any] interface {
@@ -270,9 +621,16 @@ func (esm *esManager[CT, DT]) initEventStream(
 	case EventStreamTypeWebhook:
 		es.action = esm.newWebhookAction(es.bgCtx, spec.Webhook)
 	case EventStreamTypeWebSocket:
-		es.action = newWebSocketAction[DT](esm.wsChannels, spec.WebSocket, *spec.Name)
+		wsa := newWebSocketAction[DT](esm.wsChannels, spec.WebSocket, spec.wsTopic(), spec.AckTimeout)
+		wsa.comparer, _ = esm.runtime.(SequenceComparer)
+		es.action = wsa
+		esm.setResumeHandler(spec, es.resume)
+	case EventStreamTypeInProcess:
+		es.action = esm.newInProcessAction(spec.GetID())
 	}
 
+	es.outsideSchedule = spec.ActiveSchedule != nil && !spec.ActiveSchedule.isActive(time.Now())
+
 	log.L(es.bgCtx).Infof("Initialized Event Stream")
 	if *spec.Status == EventStreamStatusStarted {
 		// Start up the stream
@@ -282,7 +640,59 @@ func (esm *esManager[CT, DT]) initEventStream(
 }
 
 func (esm *esManager[CT, DT]) validateStream(ctx context.Context, esSpec *EventStreamSpec[CT], setDefaults bool) error {
-	return esSpec.validate(ctx, esm.tlsConfigs, &esm.config.Defaults, esm.runtime.Validate, setDefaults)
+	if esSpec.catchupOnly() {
+		if esSpec.SharedSource != nil {
+			return i18n.NewError(ctx, i18n.MsgESCatchupOnlySharedSource)
+		}
+		_, isResolver := esm.runtime.(LatestSequenceResolver)
+		_, isComparer := esm.runtime.(SequenceComparer)
+		if !isResolver || !isComparer {
+			return i18n.NewError(ctx, i18n.MsgESCatchupOnlyUnsupported)
+		}
+	}
+	if esSpec.SharedSource != nil {
+		if _, ok := esm.runtime.(SequenceComparer); !ok {
+			return i18n.NewError(ctx, i18n.MsgESSharedSourceUnsupported)
+		}
+	}
+	if err := esSpec.validate(ctx, esm.tlsConfigs, &esm.config.Defaults, esm.runtime.Validate, setDefaults); err != nil {
+		return err
+	}
+	if esSpec.WebSocket != nil && esSpec.WebSocket.AllowResume != nil && *esSpec.WebSocket.AllowResume {
+		if _, ok := esm.runtime.(SequenceComparer); !ok {
+			return i18n.NewError(ctx, i18n.MsgESResumeUnsupported)
+		}
+	}
+	return nil
+}
+
+// setResumeHandler registers the handler for resumeFrom offsets supplied by consumers of a WebSocket
+// stream, if the WebSocket server supports them. A nil handler removes it.
+func (esm *esManager[CT, DT]) setResumeHandler(spec *EventStreamSpec[CT], handler wsserver.StreamResumeHandler) {
+	registrar, ok := esm.wsChannels.(wsserver.StreamResumeRegistrar)
+	if ok && *spec.Type == EventStreamTypeWebSocket {
+		registrar.SetStreamResumeHandler(spec.wsTopic(), handler)
+	}
+}
+
+// resume is called when a consumer starts listening on the stream with the sequence of the last event it
+// has processed, so that events up to that point are not re-delivered after replaying from the checkpoint.
+// The offset cannot be behind the committed checkpoint, as those events have already been acknowledged.
+func (es *eventStream[CT, DT]) resume(ctx context.Context, consumerID, resumeFrom string) error {
+	wsa, ok := es.action.(*webSocketAction[DT])
+	if !ok || wsa.comparer == nil || wsa.spec.AllowResume == nil || !*wsa.spec.AllowResume {
+		return i18n.NewError(ctx, i18n.MsgESResumeNotAllowed, *es.spec.Name)
+	}
+	cp, err := es.persistence.Checkpoints().GetByID(ctx, es.spec.GetID())
+	if err != nil {
+		return err
+	}
+	if cp != nil && cp.SequenceID != nil && wsa.comparer.CompareSequences(resumeFrom, *cp.SequenceID) < 0 {
+		return i18n.NewError(ctx, i18n.MsgESResumeBehindCheckpoint, resumeFrom, *cp.SequenceID, *es.spec.Name)
+	}
+	log.L(ctx).Infof("Consumer of event stream '%s' resuming after '%s'", *es.spec.Name, resumeFrom)
+	wsa.resume(consumerID, resumeFrom)
+	return nil
 }
 
 func (es *eventStream[CT, DT]) requestStop(ctx context.Context) chan struct{} {
@@ -297,7 +707,7 @@ func (es *eventStream[CT, DT]) requestStop(ctx context.Context) chan struct{} {
 	if es.stopping != nil {
 		return es.stopping
 	}
-	persistedStatus := *es.spec.Status
+	persistedStatus, stoppedReason := *es.spec.Status, es.spec.StoppedReason
 	// Cancel the active context, and create the stopping task
 	activeState.cancelCtx()
 	closedWhenStopped := make(chan struct{})
@@ -305,10 +715,11 @@ func (es *eventStream[CT, DT]) requestStop(ctx context.Context) chan struct{} {
 	go func() {
 		<-activeState.eventLoopDone
 		<-activeState.batchLoopDone
+		<-activeState.metricsLoopDone
 
 		// Complete an in-process delete
 		if persistedStatus == EventStreamStatusDeleted {
-			if err := es.persistStatus(ctx, persistedStatus); err != nil {
+			if err := es.persistStatus(ctx, persistedStatus, stoppedReason); err != nil {
 				log.L(ctx).Errorf("Failed to delete: %s", err)
 			}
 		}
@@ -332,9 +743,9 @@ func (es *eventStream[CT, DT]) checkSetStatus(ctx context.Context, targetStatus
 		changeToPersist = &persited
 	}
 
-	// We snap a pointer to any stats under the lock here
+	// We snap a copy of any stats under the lock here
 	if es.activeState != nil {
-		statistics = &es.activeState.EventStreamStatistics
+		statistics = es.activeState.statsSnapshot()
 	}
 
 	// Check valid state transitions based on the persisted status, and whether we are stopping
@@ -352,6 +763,8 @@ func (es *eventStream[CT, DT]) checkSetStatus(ctx context.Context, targetStatus
 		newRuntimeStatus = EventStreamStatusStopped
 		if es.stopping != nil {
 			newRuntimeStatus = EventStreamStatusStopping
+		} else if es.spec.StartAt != nil {
+			newRuntimeStatus = EventStreamStatusScheduled
 		}
 		// We can only stay in stopped, or go to deleted
 		if targetStatus != nil {
@@ -368,6 +781,9 @@ func (es *eventStream[CT, DT]) checkSetStatus(ctx context.Context, targetStatus
 		}
 	case EventStreamStatusStarted:
 		newRuntimeStatus = EventStreamStatusStarted
+		if es.outsideSchedule {
+			newRuntimeStatus = EventStreamStatusOutsideSchedule
+		}
 		// We can go anywhere
 		if targetStatus != nil {
 			switch *targetStatus {
@@ -377,6 +793,24 @@ func (es *eventStream[CT, DT]) checkSetStatus(ctx context.Context, targetStatus
 				transition(EventStreamStatusStopping, EventStreamStatusStopped)
 			case EventStreamStatusDeleted:
 				transition(EventStreamStatusStoppingDeleted, EventStreamStatusDeleted)
+			case EventStreamStatusCompleted:
+				transition(EventStreamStatusStopping, EventStreamStatusCompleted)
+			}
+		}
+	case EventStreamStatusCompleted:
+		newRuntimeStatus = EventStreamStatusCompleted
+		if es.stopping != nil {
+			newRuntimeStatus = EventStreamStatusStopping
+		}
+		// A completed stream is never restarted, so can only stay completed or be deleted
+		if targetStatus != nil {
+			switch *targetStatus {
+			case EventStreamStatusCompleted, EventStreamStatusStopped:
+				// no change
+			case EventStreamStatusDeleted:
+				transition(EventStreamStatusStoppingDeleted, EventStreamStatusDeleted)
+			default:
+				err = i18n.NewError(ctx, i18n.MsgESCompleted)
 			}
 		}
 	default:
@@ -386,18 +820,39 @@ func (es *eventStream[CT, DT]) checkSetStatus(ctx context.Context, targetStatus
 	return newRuntimeStatus, changeToPersist, statistics, err
 }
 
-func (es *eventStream[CT, DT]) persistStatus(ctx context.Context, targetStatus EventStreamStatus) error {
-	fb := EventStreamFilters.NewUpdate(ctx)
-	return es.esm.persistence.EventStreams().Update(ctx, es.spec.GetID(), fb.Set("status", targetStatus))
+// persistStatus stores the status along with the stopped reason, which is cleared when the stream is started
+func (es *eventStream[CT, DT]) persistStatus(ctx context.Context, targetStatus EventStreamStatus, stoppedReason *string) error {
+	reason := "" // clears the reason
+	if stoppedReason != nil {
+		reason = *stoppedReason
+	}
+	es.mux.Lock()
+	clearStartAt := es.spec.StartAt != nil && targetStatus == EventStreamStatusStarted
+	es.mux.Unlock()
+	update := EventStreamFilters.NewUpdate(ctx).Set("status", targetStatus).Set("stoppedreason", reason)
+	if clearStartAt {
+		// the scheduled start is one-shot, so does not apply to any later stop
+		update = update.Set("startat", nil)
+	}
+	if err := es.esm.persistence.EventStreams().Update(ctx, es.spec.GetID(), update); err != nil {
+		return err
+	}
+	es.mux.Lock()
+	es.spec.StoppedReason = stoppedReason
+	if clearStartAt {
+		es.spec.StartAt = nil
+	}
+	es.mux.Unlock()
+	return nil
 }
 
-func (es *eventStream[CT, DT]) stopOrDelete(ctx context.Context, targetStatus EventStreamStatus) error {
+func (es *eventStream[CT, DT]) stopOrDelete(ctx context.Context, targetStatus EventStreamStatus, stoppedReason string) error {
 	_, newPersistedStatus, _, err := es.checkSetStatus(ctx, &targetStatus)
 	if err != nil {
 		return err
 	}
 	if newPersistedStatus != nil {
-		if err := es.persistStatus(ctx, *newPersistedStatus); err != nil {
+		if err := es.persistStatus(ctx, *newPersistedStatus, &stoppedReason); err != nil {
 			return err
 		}
 	}
@@ -418,21 +873,66 @@ func (es *eventStream[CT, DT]) suspend(ctx context.Context) error {
 	return nil
 }
 
+// drain asks a running stream to deliver and checkpoint the batch it is assembling (after
+// any dispatch in progress), and waits for it to do so - or for the context to end
+func (es *eventStream[CT, DT]) drain(ctx context.Context) {
+	es.mux.Lock()
+	as := es.activeState
+	stopping := es.stopping
+	es.mux.Unlock()
+	if as == nil || stopping != nil {
+		return
+	}
+	as.drainOnce.Do(func() { close(as.drainRequested) })
+	select {
+	case <-as.drained:
+	case <-as.batchLoopDone:
+	case <-ctx.Done():
+		log.L(ctx).Warnf("Timed out draining event stream %s", es.spec.GetID())
+	}
+}
+
 func (es *eventStream[CT, DT]) ensureActive() {
 	// Caller responsible for checking state transitions before invoking
 	es.mux.Lock()
 	defer es.mux.Unlock()
-	if es.stopping == nil && es.activeState == nil {
+	if es.stopping == nil && es.activeState == nil && !es.outsideSchedule {
 		es.activeState = es.newActiveStream()
 	}
 }
 
-func (es *eventStream[CT, DT]) stop(ctx context.Context) error {
-	return es.stopOrDelete(ctx, EventStreamStatusStopped)
+func (es *eventStream[CT, DT]) stop(ctx context.Context, reason string) error {
+	if reason == "" {
+		reason = StopReasonRequested
+	}
+	if err := es.cancelStartAt(ctx, reason); err != nil {
+		return err
+	}
+	return es.stopOrDelete(ctx, EventStreamStatusStopped, reason)
+}
+
+// cancelStartAt clears the startAt time of a stream waiting to be started, so an explicit stop keeps it stopped.
+// The stream is already stopped, so the reason is stored here as it is not changed by stopOrDelete.
+func (es *eventStream[CT, DT]) cancelStartAt(ctx context.Context, reason string) error {
+	es.mux.Lock()
+	scheduled := es.spec.StartAt != nil
+	es.mux.Unlock()
+	if !scheduled {
+		return nil
+	}
+	update := EventStreamFilters.NewUpdate(ctx).Set("startat", nil).Set("stoppedreason", reason)
+	if err := es.esm.persistence.EventStreams().Update(ctx, es.spec.GetID(), update); err != nil {
+		return err
+	}
+	es.mux.Lock()
+	es.spec.StartAt = nil
+	es.spec.StoppedReason = &reason
+	es.mux.Unlock()
+	return nil
 }
 
 func (es *eventStream[CT, DT]) delete(ctx context.Context) error {
-	return es.stopOrDelete(ctx, EventStreamStatusDeleted)
+	return es.stopOrDelete(ctx, EventStreamStatusDeleted, StopReasonRequested)
 }
 
 func (es *eventStream[CT, DT]) start(ctx context.Context) error {
@@ -442,7 +942,7 @@ func (es *eventStream[CT, DT]) start(ctx context.Context) error {
 		return err
 	}
 	if newPersistedStatus != nil {
-		if err := es.persistStatus(ctx, *newPersistedStatus); err != nil {
+		if err := es.persistStatus(ctx, *newPersistedStatus, nil); err != nil {
 			return err
 		}
 	}
@@ -452,9 +952,97 @@ func (es *eventStream[CT, DT]) start(ctx context.Context) error {
 
 func (es *eventStream[CT, DT]) Status(ctx context.Context) *EventStreamWithStatus[CT] {
 	status, _, statistics, _ := es.checkSetStatus(ctx, nil)
+	var deliveredSinceCheckpoint int64
+	if statistics != nil {
+		// The copy has the blocked state calculated at the point of the call
+		statistics.updateBlocked(time.Duration(es.esm.config.BlockedAlertThreshold))
+		statistics.updateBacklog()
+		deliveredSinceCheckpoint = statistics.backlog.sinceCheckpoint()
+	}
 	return &EventStreamWithStatus[CT]{
-		EventStreamSpec: es.spec,
-		Status:          status,
-		Statistics:      statistics,
+		EventStreamSpec:          es.spec,
+		Status:                   status,
+		Statistics:               statistics,
+		LastDelivered:            es.getLastDelivered(),
+		DeliveredSinceCheckpoint: deliveredSinceCheckpoint,
+		StoppedReason:            es.stoppedReason(status),
+		Consumers:                es.consumerStatus(),
 	}
 }
+
+func (es *eventStream[CT, DT]) stoppedReason(status EventStreamStatus) string {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	switch status {
+	case EventStreamStatusStopped, EventStreamStatusStopping, EventStreamStatusScheduled:
+		if es.spec.StoppedReason != nil {
+			return *es.spec.StoppedReason
+		}
+	case EventStreamStatusOutsideSchedule:
+		return StopReasonSchedule
+	}
+	return ""
+}
+
+// consumerStatus is only available for websocket streams, where the WebSocket server can report its connections
+func (es *eventStream[CT, DT]) consumerStatus() *ConsumerStatus {
+	consumers, ok := es.esm.webSocketConsumers(es.spec)
+	if !ok {
+		return nil
+	}
+	cs := &ConsumerStatus{
+		Connected:   len(consumers) > 0,
+		Count:       len(consumers),
+		Connections: consumers,
+	}
+	if len(consumers) > 0 {
+		cs.ConnectedSince = consumers[0].StartedAt
+	}
+	if es.spec.WebSocket != nil {
+		cs.PayloadEncoding = es.spec.WebSocket.PayloadEncoding
+	}
+	return cs
+}
+
+func (es *eventStream[CT, DT]) getLastDelivered() *LastDeliveredEvent {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	return es.lastDelivered
+}
+
+// batchSettings returns the batch size and timeout, which can be updated while the stream is running
+func (es *eventStream[CT, DT]) batchSettings() (int, time.Duration) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	return *es.spec.BatchSize, time.Duration(*es.spec.BatchTimeout)
+}
+
+// updateBatchSettings applies an updated spec in place, if it differs only in the batch size and timeout,
+// returning false if the stream must be re-initialized. The batch being assembled keeps its size and timer.
+func (es *eventStream[CT, DT]) updateBatchSettings(ctx context.Context, spec *EventStreamSpec[CT]) bool {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	if es.spec == nil {
+		return false
+	}
+	current, updated := *es.spec, *spec
+	for _, s := range []*EventStreamSpec[CT]{&current, &updated} {
+		s.Created, s.Updated, s.BatchSize, s.BatchTimeout = nil, nil, nil, nil
+	}
+	currentJSON, err1 := json.Marshal(&current)
+	updatedJSON, err2 := json.Marshal(&updated)
+	if err1 != nil || err2 != nil || !bytes.Equal(currentJSON, updatedJSON) {
+		return false
+	}
+	log.L(ctx).Infof("Updating event stream '%s' in place with batchSize=%d batchTimeout=%s", es.spec.GetID(), *spec.BatchSize, spec.BatchTimeout)
+	es.spec.BatchSize = spec.BatchSize
+	es.spec.BatchTimeout = spec.BatchTimeout
+	es.spec.Updated = spec.Updated
+	return true
+}
+
+func (es *eventStream[CT, DT]) setLastDelivered(lastDelivered *LastDeliveredEvent) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	es.lastDelivered = lastDelivered
+}
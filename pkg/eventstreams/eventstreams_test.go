@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
@@ -138,6 +139,58 @@ func TestValidate(t *testing.T) {
 	assert.Regexp(t, "pop", err)
 	es.esm.runtime.(*mockEventSource).validate = func(ctx context.Context, conf *testESConfig) error { return nil }
 
+	es.spec.Labels = Labels{"bad key": "value"}
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00140.*labels", err)
+
+	es.spec.Labels = Labels{"team": "bad\"value"}
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00140.*labels.team", err)
+	es.spec.Labels = Labels{"team": "payments"}
+
+	es.spec.CatchupBatchSize = ptrTo(0)
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*catchupBatchSize", err)
+	es.spec.CatchupBatchSize = nil
+
+	es.spec.MaxBatchSizeBytes = ptrTo(fftypes.ByteSize(0))
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*maxBatchSizeBytes", err)
+	es.spec.MaxBatchSizeBytes = ptrTo(fftypes.ByteSize(1024))
+
+	es.spec.MaxInFlightBatches = ptrTo(0)
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*maxInFlightBatches", err)
+	es.spec.MaxInFlightBatches = nil
+
+	es.spec.OrderingKey = ptrTo("data..key")
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*orderingKey", err)
+	es.spec.OrderingKey = nil
+
+	es.spec.CompactionKey = ptrTo("data..key")
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*compactionKey", err)
+	es.spec.CompactionKey = ptrTo("")
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*compactionKey", err)
+	es.spec.CompactionKey = ptrTo("data.key")
+
+	es.spec.AckTimeout = ptrTo(fftypes.FFDuration(0))
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00.*ackTimeout", err)
+	es.spec.AckTimeout = nil
+
+	es.spec.WSTopic = ptrTo("orders/v1")
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00140.*wsTopic", err)
+	es.spec.WSTopic = ptrTo("orders-v1")
+
+	es.spec.DeliveryMode = ptrTo(fftypes.FFEnum("wrong"))
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00172.*deliverymode", err)
+	es.spec.DeliveryMode = nil
+
 	es.spec.TopicFilter = ptrTo("((((!Bad Regexp[")
 	err = es.esm.validateStream(ctx, es.spec, false)
 	assert.Regexp(t, "FF00235", err)
@@ -145,14 +198,20 @@ func TestValidate(t *testing.T) {
 	es.spec.TopicFilter = nil
 	es.spec.Type = ptrTo(fftypes.FFEnum("wrong"))
 	err = es.esm.validateStream(ctx, es.spec, false)
-	assert.Regexp(t, "FF00234", err)
+	assert.Regexp(t, "FF00172", err)
+
+	es.spec.Type = ptrTo(EventStreamTypeWebSocket)
+	es.spec.MaxInFlightBatches = ptrTo(2)
+	err = es.esm.validateStream(ctx, es.spec, false)
+	assert.Regexp(t, "FF00318", err)
+	es.spec.MaxInFlightBatches = nil
 
 	es.spec.Type = ptrTo(EventStreamTypeWebSocket)
 	es.spec.WebSocket = &WebSocketConfig{
 		DistributionMode: ptrTo(fftypes.FFEnum("wrong")),
 	}
 	err = es.esm.validateStream(ctx, es.spec, false)
-	assert.Regexp(t, "FF00234", err)
+	assert.Regexp(t, "FF00172", err)
 
 	es.spec.Type = ptrTo(EventStreamTypeWebhook)
 	err = es.esm.validateStream(ctx, es.spec, false)
@@ -182,13 +241,15 @@ func TestRequestStopPersistFail(t *testing.T) {
 
 	es.spec.Status = ptrTo(EventStreamStatusDeleted)
 	as := &activeStream[testESConfig, testData]{
-		eventLoopDone: make(chan struct{}),
-		batchLoopDone: make(chan struct{}),
+		eventLoopDone:   make(chan struct{}),
+		batchLoopDone:   make(chan struct{}),
+		metricsLoopDone: make(chan struct{}),
 	}
 	as.ctx, as.cancelCtx = context.WithCancel(ctx)
 	as.cancelCtx()
 	close(as.eventLoopDone)
 	close(as.batchLoopDone)
+	close(as.metricsLoopDone)
 	es.activeState = as
 	s := es.requestStop(ctx)
 	<-s
@@ -236,7 +297,7 @@ func TestStopFailBadStatus(t *testing.T) {
 
 	// FAIL: Deleting -> Stopped
 	es.spec.Status = ptrTo(EventStreamStatusDeleted)
-	err := es.stop(ctx)
+	err := es.stop(ctx, "")
 	assert.Regexp(t, "FF00231", err)
 
 }
@@ -249,7 +310,7 @@ func TestStopFailPersistFail(t *testing.T) {
 
 	// OK: Started -> Stopping
 	es.spec.Status = ptrTo(EventStreamStatusStarted)
-	err := es.stop(ctx)
+	err := es.stop(ctx, "")
 	assert.Regexp(t, "pop", err)
 
 }
@@ -293,3 +354,70 @@ func TestGetIDNil(t *testing.T) {
 	assert.Empty(t, (&EventStreamSpec[testESConfig]{}).GetID())
 	assert.Empty(t, (&EventStreamCheckpoint{}).GetID())
 }
+
+func TestSubSourceCheckpointsScanValue(t *testing.T) {
+	sc := SubSourceCheckpoints{"source1": "111", "source2": "222"}
+	v, err := sc.Value()
+	assert.NoError(t, err)
+
+	var sc2 SubSourceCheckpoints
+	err = sc2.Scan(v)
+	assert.NoError(t, err)
+	assert.Equal(t, sc, sc2)
+
+	v, err = SubSourceCheckpoints(nil).Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	assert.Nil(t, SubSourceCheckpoints{}.copy())
+
+	err = sc2.Scan(12345)
+	assert.Regexp(t, "FF00215", err)
+}
+
+func TestStatisticsBlocked(t *testing.T) {
+	dispatchTime := fftypes.FFTime(time.Now().Add(-1 * time.Minute))
+	stats := &EventStreamStatistics{
+		LastDispatchTime:   &dispatchTime,
+		LastDispatchStatus: DispatchStatusRetrying,
+	}
+	stats.updateBlocked(5 * time.Minute)
+	assert.True(t, stats.Blocked)
+	assert.Equal(t, &dispatchTime, stats.BlockedSince)
+	assert.GreaterOrEqual(t, time.Duration(stats.BlockedDuration), 1*time.Minute)
+
+	stats.LastDispatchStatus = DispatchStatusDispatching
+	stats.updateBlocked(5 * time.Minute)
+	assert.False(t, stats.Blocked)
+	assert.Nil(t, stats.BlockedSince)
+	assert.Zero(t, stats.BlockedDuration)
+
+	stats.updateBlocked(30 * time.Second)
+	assert.True(t, stats.Blocked)
+
+	stats.LastDispatchStatus = DispatchStatusComplete
+	stats.updateBlocked(30 * time.Second)
+	assert.False(t, stats.Blocked)
+
+	stats.LastDispatchTime = nil
+	stats.LastDispatchStatus = DispatchStatusBlocked
+	stats.updateBlocked(30 * time.Second)
+	assert.False(t, stats.Blocked)
+}
+
+func TestStatusBlockedCopy(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	dispatchTime := fftypes.FFTime(time.Now().Add(-1 * time.Minute))
+	es.activeState = &activeStream[testESConfig, testData]{
+		EventStreamStatistics: EventStreamStatistics{
+			LastDispatchTime:   &dispatchTime,
+			LastDispatchStatus: DispatchStatusBlocked,
+		},
+	}
+	status := es.Status(ctx)
+	assert.True(t, status.Statistics.Blocked)
+	assert.Equal(t, &dispatchTime, status.Statistics.BlockedSince)
+	assert.False(t, es.activeState.Blocked)
+	es.activeState = nil
+}
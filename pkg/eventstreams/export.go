@@ -0,0 +1,135 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// EventStreamRecord is an event stream with its checkpoint, as exported for backup or migration.
+// The checkpoint is nil if the stream has not yet checkpointed.
+type EventStreamRecord[CT any] struct {
+	Stream     *EventStreamSpec[CT]   `json:"stream"`
+	Checkpoint *EventStreamCheckpoint `json:"checkpoint,omitempty"`
+}
+
+// ExportEventStreams calls the function with every event stream in the persistence, along with its checkpoint.
+// Streams are read a page at a time in order of ID, so only one page is held in memory, and a stream is
+// never missed or repeated if other streams are created or deleted during the export. Returning an error
+// from the function stops the export.
+func ExportEventStreams[CT any](ctx context.Context, p Persistence[CT], pageSize int, fn func(r *EventStreamRecord[CT]) error) error {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	lastID := ""
+	for {
+		fb := EventStreamFilters.NewFilterLimit(ctx, uint64(pageSize))
+		streams, _, err := p.EventStreams().GetMany(ctx, fb.Gt("id", lastID).Sort("id").Ascending())
+		if err != nil {
+			return err
+		}
+		if len(streams) == 0 {
+			return nil
+		}
+
+		ids := make([]driver.Value, len(streams))
+		for i, es := range streams {
+			ids[i] = es.GetID()
+		}
+		checkpoints, _, err := p.Checkpoints().GetMany(ctx, CheckpointFilters.NewFilter(ctx).In("id", ids))
+		if err != nil {
+			return err
+		}
+		cpByID := make(map[string]*EventStreamCheckpoint, len(checkpoints))
+		for _, cp := range checkpoints {
+			cpByID[*cp.ID] = cp
+		}
+
+		for _, es := range streams {
+			if err := fn(&EventStreamRecord[CT]{Stream: es, Checkpoint: cpByID[es.GetID()]}); err != nil {
+				return err
+			}
+		}
+		log.L(ctx).Debugf("Exported %d event streams", len(streams))
+		if len(streams) < pageSize {
+			return nil
+		}
+		lastID = streams[len(streams)-1].GetID()
+	}
+}
+
+// groupRunner is implemented by persistence that can run a set of writes in a single transaction
+type groupRunner interface {
+	RunAsGroup(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ImportEventStreams bulk inserts records previously returned by ExportEventStreams, keeping the
+// IDs of the streams so that checkpoints are restored. Large exports can be imported in chunks,
+// by calling this repeatedly. The streams must not already exist, and the import must be
+// completed before the event stream manager is started against the persistence.
+// Every record is validated before anything is written, in the same way as when the manager loads
+// the stream using the config and runtime supplied, and each call is a single transaction where
+// the persistence supports it - so a chunk is either imported in full or not at all.
+func ImportEventStreams[CT any, DT any](ctx context.Context, config *Config, p Persistence[CT], runtime Runtime[CT, DT], records []*EventStreamRecord[CT]) error {
+	tlsConfigs, err := parseTLSConfigs(ctx, config)
+	if err != nil {
+		return err
+	}
+	esm := &esManager[CT, DT]{config: *config, tlsConfigs: tlsConfigs, runtime: runtime}
+	streams := make([]*EventStreamSpec[CT], 0, len(records))
+	checkpoints := make([]*EventStreamCheckpoint, 0, len(records))
+	for i, r := range records {
+		if r.Stream == nil || r.Stream.ID == nil ||
+			(r.Checkpoint != nil && (r.Checkpoint.ID == nil || *r.Checkpoint.ID != *r.Stream.ID)) {
+			return i18n.NewError(ctx, i18n.MsgESImportInvalidRecord, i)
+		}
+		// Validate a copy with the defaults applied, so that the defaults are not persisted
+		specCopy := *r.Stream
+		if err := esm.validateStream(ctx, &specCopy, true); err != nil {
+			return err
+		}
+		streams = append(streams, r.Stream)
+		if r.Checkpoint != nil {
+			checkpoints = append(checkpoints, r.Checkpoint)
+		}
+	}
+	insert := func(ctx context.Context) error {
+		if len(streams) > 0 {
+			if err := p.EventStreams().InsertMany(ctx, streams, false); err != nil {
+				return err
+			}
+		}
+		if len(checkpoints) > 0 {
+			return p.Checkpoints().InsertMany(ctx, checkpoints, false)
+		}
+		return nil
+	}
+	if gr, ok := p.(groupRunner); ok {
+		err = gr.RunAsGroup(ctx, insert)
+	} else {
+		err = insert(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	log.L(ctx).Infof("Imported %d event streams with %d checkpoints", len(streams), len(checkpoints))
+	return nil
+}
@@ -0,0 +1,215 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/mocks/crudmocks"
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExportImportEventStreams(t *testing.T) {
+	ctx, src, _, _, srcDone := setupE2ETest(t)
+	defer srcDone()
+
+	for i := 0; i < 5; i++ {
+		es := &EventStreamSpec[testESConfig]{
+			ID:                ptrTo(fftypes.NewUUID().String()),
+			Name:              ptrTo(fmt.Sprintf("stream%d", i)),
+			Type:              &EventStreamTypeWebSocket,
+			Status:            ptrTo(EventStreamStatusStarted),
+			Config:            &testESConfig{Config1: fmt.Sprintf("conf%d", i)},
+			BatchTimeout:      ptrTo(fftypes.FFDuration(1 * time.Second)),
+			RetryTimeout:      ptrTo(fftypes.FFDuration(1 * time.Minute)),
+			BlockedRetryDelay: ptrTo(fftypes.FFDuration(1 * time.Minute)),
+			AckTimeout:        ptrTo(fftypes.FFDuration(1 * time.Minute)),
+		}
+		assert.NoError(t, src.EventStreams().Insert(ctx, es))
+		if i%2 == 0 {
+			assert.NoError(t, src.Checkpoints().Insert(ctx, &EventStreamCheckpoint{
+				ID:         es.ID,
+				SequenceID: ptrTo(fmt.Sprintf("%012d", i)),
+			}))
+		}
+	}
+
+	var records []*EventStreamRecord[testESConfig]
+	err := ExportEventStreams(ctx, src, 2, func(r *EventStreamRecord[testESConfig]) error {
+		records = append(records, r)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, records, 5)
+	names := map[string]bool{}
+	for i, r := range records {
+		if i > 0 {
+			assert.Greater(t, r.Stream.GetID(), records[i-1].Stream.GetID())
+		}
+		names[*r.Stream.Name] = true
+	}
+	assert.Len(t, names, 5)
+
+	ctx, dst, _, _, dstDone := setupE2ETest(t)
+	defer dstDone()
+	conf, runtime := GenerateConfig(ctx), newImportTestRuntime()
+	assert.NoError(t, ImportEventStreams(ctx, conf, dst, runtime, records[:3]))
+	assert.NoError(t, ImportEventStreams(ctx, conf, dst, runtime, records[3:]))
+	assert.NoError(t, ImportEventStreams(ctx, conf, dst, runtime, nil))
+
+	checkpoints := 0
+	for _, r := range records {
+		es, err := dst.EventStreams().GetByID(ctx, r.Stream.GetID())
+		assert.NoError(t, err)
+		assert.Equal(t, *r.Stream.Name, *es.Name)
+		assert.Equal(t, r.Stream.Config.Config1, es.Config.Config1)
+		cp, err := dst.Checkpoints().GetByID(ctx, r.Stream.GetID())
+		assert.NoError(t, err)
+		if r.Checkpoint == nil {
+			assert.Nil(t, cp)
+		} else {
+			checkpoints++
+			assert.Equal(t, *r.Checkpoint.SequenceID, *cp.SequenceID)
+		}
+	}
+	assert.Equal(t, 3, checkpoints)
+
+	// The defaults are not persisted
+	es, err := dst.EventStreams().GetByID(ctx, records[0].Stream.GetID())
+	assert.NoError(t, err)
+	assert.Nil(t, es.BatchSize)
+
+	// A record the manager could not load is rejected
+	invalid := *records[0].Stream
+	invalid.BatchTimeout = ptrTo(fftypes.FFDuration(0))
+	err = ImportEventStreams(ctx, conf, dst, runtime, []*EventStreamRecord[testESConfig]{{Stream: &invalid}})
+	assert.Regexp(t, "FF00234.*batchTimeout", err)
+
+	// The streams already exist
+	err = ImportEventStreams(ctx, conf, dst, runtime, records)
+	assert.Error(t, err)
+
+	// Nothing is imported if any of the writes fail
+	ctx, dst2, _, _, dst2Done := setupE2ETest(t)
+	defer dst2Done()
+	assert.NoError(t, dst2.Checkpoints().Insert(ctx, &EventStreamCheckpoint{ID: records[4].Stream.ID, SequenceID: ptrTo("000000000004")}))
+	records[4].Checkpoint = &EventStreamCheckpoint{ID: records[4].Stream.ID, SequenceID: ptrTo("000000000004")}
+	err = ImportEventStreams(ctx, conf, dst2, runtime, records)
+	assert.Error(t, err)
+	for _, r := range records {
+		es, err := dst2.EventStreams().GetByID(ctx, r.Stream.GetID())
+		assert.NoError(t, err)
+		assert.Nil(t, es)
+	}
+
+	// Stopping the export
+	err = ExportEventStreams(ctx, src, 0, func(r *EventStreamRecord[testESConfig]) error {
+		return fmt.Errorf("pop")
+	})
+	assert.Regexp(t, "pop", err)
+}
+
+func newImportTestRuntime() *mockEventSource {
+	return &mockEventSource{
+		validate: func(ctx context.Context, conf *testESConfig) error { return nil },
+	}
+}
+
+func newExportMockPersistence(t *testing.T) *mockPersistence {
+	return &mockPersistence{
+		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
+		checkpoints:  crudmocks.NewCRUD[*EventStreamCheckpoint](t),
+	}
+}
+
+func TestExportEventStreamsFail(t *testing.T) {
+	ctx := context.Background()
+	noop := func(r *EventStreamRecord[testESConfig]) error { return nil }
+
+	mp := newExportMockPersistence(t)
+	mp.eventStreams.On("GetMany", ctx, mock.Anything).Return(nil, nil, fmt.Errorf("pop"))
+	assert.Regexp(t, "pop", ExportEventStreams[testESConfig](ctx, mp, 10, noop))
+
+	mp = newExportMockPersistence(t)
+	mp.eventStreams.On("GetMany", ctx, mock.Anything).Return([]*EventStreamSpec[testESConfig]{{ID: ptrTo("es1")}}, &ffapi.FilterResult{}, nil)
+	mp.checkpoints.On("GetMany", ctx, mock.Anything).Return(nil, nil, fmt.Errorf("pop"))
+	assert.Regexp(t, "pop", ExportEventStreams[testESConfig](ctx, mp, 10, noop))
+}
+
+func TestImportEventStreamsCheckpointFail(t *testing.T) {
+	ctx := context.Background()
+	mp := newExportMockPersistence(t)
+	mp.eventStreams.On("InsertMany", ctx, mock.Anything, false).Return(nil)
+	mp.checkpoints.On("InsertMany", ctx, mock.Anything, false).Return(fmt.Errorf("pop"))
+	err := ImportEventStreams(ctx, GenerateConfig(ctx), mp, newImportTestRuntime(), []*EventStreamRecord[testESConfig]{
+		{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es1"), Name: ptrTo("stream1")}, Checkpoint: &EventStreamCheckpoint{ID: ptrTo("es1")}},
+	})
+	assert.Regexp(t, "pop", err)
+}
+
+func TestImportEventStreamsInvalidRecord(t *testing.T) {
+	ctx := context.Background()
+	mp := newExportMockPersistence(t)
+	for _, r := range []*EventStreamRecord[testESConfig]{
+		{},
+		{Stream: &EventStreamSpec[testESConfig]{}},
+		{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es2")}, Checkpoint: &EventStreamCheckpoint{}},
+		{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es2")}, Checkpoint: &EventStreamCheckpoint{ID: ptrTo("es3")}},
+	} {
+		err := ImportEventStreams(ctx, GenerateConfig(ctx), mp, newImportTestRuntime(), []*EventStreamRecord[testESConfig]{
+			{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es1"), Name: ptrTo("stream1")}}, r,
+		})
+		assert.Regexp(t, "FF00323.*1", err)
+	}
+}
+
+func TestImportEventStreamsInvalidSpec(t *testing.T) {
+	ctx := context.Background()
+	mp := newExportMockPersistence(t)
+	records := []*EventStreamRecord[testESConfig]{
+		{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es1"), Name: ptrTo("stream1")}},
+		{Stream: &EventStreamSpec[testESConfig]{ID: ptrTo("es2"), Name: ptrTo("stream2"), TopicFilter: ptrTo("(")}},
+	}
+	// Nothing is written, as the mock persistence has no expectations
+	err := ImportEventStreams(ctx, GenerateConfig(ctx), mp, newImportTestRuntime(), records)
+	assert.Regexp(t, "FF00235", err)
+
+	runtime := newImportTestRuntime()
+	runtime.validate = func(ctx context.Context, conf *testESConfig) error { return fmt.Errorf("pop") }
+	err = ImportEventStreams(ctx, GenerateConfig(ctx), mp, runtime, records[:1])
+	assert.Regexp(t, "pop", err)
+}
+
+func TestImportEventStreamsBadTLSConfig(t *testing.T) {
+	ctx := context.Background()
+	conf := GenerateConfig(ctx)
+	conf.TLSConfigs = map[string]*fftls.Config{
+		"tls0": {
+			Enabled: true,
+			CAFile:  t.TempDir(),
+		},
+	}
+	err := ImportEventStreams(ctx, conf, newExportMockPersistence(t), newImportTestRuntime(), nil)
+	assert.Regexp(t, "FF00153", err)
+}
@@ -0,0 +1,238 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// Subscriber is implemented by the Manager returned from NewEventStreamManager, for consumers
+// in the same process as the manager to receive the events of a stream without a WebSocket:
+//
+//	batches, cancel, err := mgr.(eventstreams.Subscriber[MyDataType]).Subscribe(ctx, streamID)
+//
+// It is a separate interface because Manager is only parameterized by the config type, so cannot
+// return the events of the data type.
+type Subscriber[DT any] interface {
+	// Subscribe attaches to a stream of type inprocess, which has at most one subscriber at a time.
+	// Each batch must be acknowledged before the next is delivered, and the checkpoint is advanced
+	// exactly as it is for a WebSocket. The channel is closed once the subscriber is detached,
+	// by calling the cancel function or cancelling the context.
+	Subscribe(ctx context.Context, streamID string) (batches <-chan *SubscriptionBatch[DT], cancel func(), err error)
+}
+
+// SubscriptionBatch is a batch of events delivered to an in-process subscriber. The batch is delivered
+// with its Ack and Nack, rather than as a bare slice of events, so a subscriber processing batches
+// on other goroutines cannot acknowledge the wrong batch.
+type SubscriptionBatch[DT any] struct {
+	*EventBatch[DT]
+	ack chan error
+}
+
+// Ack confirms the batch has been processed, allowing the stream to continue
+func (b *SubscriptionBatch[DT]) Ack() {
+	b.Nack(nil)
+}
+
+// Nack fails delivery of the batch, which is then handled according to the errorHandling of the stream
+func (b *SubscriptionBatch[DT]) Nack(err error) {
+	select {
+	case b.ack <- err:
+	default: // already acknowledged
+	}
+}
+
+// SSEEvents bridges the batches of a subscription to server-sent events, for an ffapi route with an SSEHandler:
+//
+//	batches, _, err := mgr.(eventstreams.Subscriber[MyDataType]).Subscribe(r.Req.Context(), streamID)
+//	return eventstreams.SSEEvents(r.Req.Context(), batches), err
+//
+// Subscribing with the context of the request detaches the subscription when the client disconnects.
+// The ID of each server-sent event is the sequence ID of the event, and each batch is acknowledged
+// once all of its events have been passed to the response.
+func SSEEvents[DT any](ctx context.Context, batches <-chan *SubscriptionBatch[DT]) <-chan *ffapi.SSEEvent {
+	events := make(chan *ffapi.SSEEvent)
+	if batches == nil {
+		// Subscribe failed
+		close(events)
+		return events
+	}
+	go func() {
+		defer close(events)
+		for batch := range batches {
+			for _, e := range batch.Events {
+				select {
+				case events <- &ffapi.SSEEvent{ID: e.SequenceID, Data: e}:
+				case <-ctx.Done():
+					// the batch is not acknowledged, so is redelivered to the next subscriber
+					return
+				}
+			}
+			batch.Ack()
+		}
+	}()
+	return events
+}
+
+type inProcessSubscription[DT any] struct {
+	deliver   chan *SubscriptionBatch[DT]
+	batches   chan *SubscriptionBatch[DT]
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (esm *esManager[CT, DT]) Subscribe(ctx context.Context, streamID string) (<-chan *SubscriptionBatch[DT], func(), error) {
+	es := esm.getStream(streamID)
+	if es == nil {
+		return nil, nil, i18n.NewError(ctx, i18n.Msg404NoResult)
+	}
+	if *es.spec.Type != EventStreamTypeInProcess {
+		return nil, nil, i18n.NewError(ctx, i18n.MsgESNotInProcessStream, streamID)
+	}
+
+	esm.mux.Lock()
+	defer esm.mux.Unlock()
+	if esm.subscriptions[streamID] != nil {
+		return nil, nil, i18n.NewError(ctx, i18n.MsgESAlreadySubscribed, streamID)
+	}
+	sub := &inProcessSubscription[DT]{
+		deliver: make(chan *SubscriptionBatch[DT]),
+		batches: make(chan *SubscriptionBatch[DT]),
+		closed:  make(chan struct{}),
+	}
+	esm.subscriptions[streamID] = sub
+	// Wake any dispatcher waiting for a subscriber
+	close(esm.subscribed)
+	esm.subscribed = make(chan struct{})
+
+	cancel := func() { esm.unsubscribe(streamID, sub) }
+	go sub.run(ctx, cancel)
+	log.L(ctx).Infof("In-process subscriber attached to event stream %s", streamID)
+	return sub.batches, cancel, nil
+}
+
+// run forwards batches to the subscriber, and is the only writer of the channel so it can close it safely
+func (sub *inProcessSubscription[DT]) run(ctx context.Context, cancel func()) {
+	defer close(sub.batches)
+	for {
+		select {
+		case batch := <-sub.deliver:
+			select {
+			case sub.batches <- batch:
+			case <-sub.closed:
+				return
+			case <-ctx.Done():
+				cancel()
+				return
+			}
+		case <-sub.closed:
+			return
+		case <-ctx.Done():
+			cancel()
+			return
+		}
+	}
+}
+
+func (esm *esManager[CT, DT]) unsubscribe(streamID string, sub *inProcessSubscription[DT]) {
+	sub.closeOnce.Do(func() {
+		esm.mux.Lock()
+		if esm.subscriptions[streamID] == sub {
+			delete(esm.subscriptions, streamID)
+		}
+		esm.mux.Unlock()
+		close(sub.closed)
+	})
+}
+
+// detachSubscriber removes any subscriber from a stream that is being deleted
+func (esm *esManager[CT, DT]) detachSubscriber(streamID string) {
+	esm.mux.Lock()
+	sub := esm.subscriptions[streamID]
+	esm.mux.Unlock()
+	if sub != nil {
+		esm.unsubscribe(streamID, sub)
+	}
+}
+
+func (esm *esManager[CT, DT]) waitForSubscriber(ctx context.Context, streamID string) (*inProcessSubscription[DT], error) {
+	for {
+		esm.mux.Lock()
+		sub, subscribed := esm.subscriptions[streamID], esm.subscribed
+		esm.mux.Unlock()
+		if sub != nil {
+			return sub, nil
+		}
+		select {
+		case <-subscribed:
+		case <-ctx.Done():
+			return nil, i18n.NewError(ctx, i18n.MsgESInProcessInterrupted)
+		}
+	}
+}
+
+type inProcessAction[CT any, DT any] struct {
+	esm      *esManager[CT, DT]
+	streamID string
+}
+
+func (esm *esManager[CT, DT]) newInProcessAction(streamID string) *inProcessAction[CT, DT] {
+	return &inProcessAction[CT, DT]{
+		esm:      esm,
+		streamID: streamID,
+	}
+}
+
+func (a *inProcessAction[CT, DT]) AttemptDispatch(ctx context.Context, attempt int, batch *EventBatch[DT]) error {
+	// Block until there is a subscriber, in the same way a WebSocket stream blocks until a connection
+	sub, err := a.esm.waitForSubscriber(ctx, a.streamID)
+	if err != nil {
+		return err
+	}
+
+	sb := &SubscriptionBatch[DT]{
+		EventBatch: batch,
+		ack:        make(chan error, 1),
+	}
+	select {
+	case sub.deliver <- sb:
+	case <-sub.closed:
+		return i18n.NewError(ctx, i18n.MsgESSubscriberDetached, batch.BatchNumber)
+	case <-ctx.Done():
+		return i18n.NewError(ctx, i18n.MsgESInProcessInterrupted)
+	}
+	log.L(ctx).Infof("Batch %d dispatched in-process (len=%d,attempt=%d)", batch.BatchNumber, len(batch.Events), attempt)
+
+	select {
+	case err = <-sb.ack:
+	case <-sub.closed:
+		err = i18n.NewError(ctx, i18n.MsgESSubscriberDetached, batch.BatchNumber)
+	case <-ctx.Done():
+		err = i18n.NewError(ctx, i18n.MsgESInProcessInterrupted)
+	}
+	if err != nil {
+		log.L(ctx).Infof("In-process event batch %d delivery failed (len=%d,attempt=%d): %s", batch.BatchNumber, len(batch.Events), attempt, err)
+		return err
+	}
+	log.L(ctx).Infof("In-process event batch %d complete (len=%d,attempt=%d)", batch.BatchNumber, len(batch.Events), attempt)
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestE2E_DeliveryInProcess(t *testing.T) {
+	ctx, p, wss, _, done := setupE2ETest(t, func() {
+		RetrySection.Set(retry.ConfigMaximumDelay, "1ms" /* spin quickly */)
+	})
+	defer done()
+
+	ts := &testSource{started: make(chan struct{})}
+	close(ts.started) // start delivery immediately - will block as there is no subscriber
+
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), p, wss, ts)
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+
+	es1 := &EventStreamSpec[testESConfig]{
+		Name:        ptrTo("stream1"),
+		TopicFilter: ptrTo("topic_1"), // only one of the topics
+		Type:        &EventStreamTypeInProcess,
+		BatchSize:   ptrTo(10),
+		Config:      &testESConfig{Config1: "1111"},
+	}
+	_, err = mgr.UpsertStream(ctx, es1)
+	assert.NoError(t, err)
+
+	batches, cancel, err := mgr.(Subscriber[testData]).Subscribe(ctx, es1.GetID())
+	assert.NoError(t, err)
+
+	// A nack results in redelivery of the same batch
+	batch := <-batches
+	assert.Len(t, batch.Events, 10)
+	assert.Equal(t, 1, batch.Events[0].Data.Field1)
+	batch.Nack(fmt.Errorf("pop"))
+	batch = <-batches
+	assert.Equal(t, 1, batch.Events[0].Data.Field1)
+	batch.Ack()
+	batch.Ack() // no-op
+
+	// Then delivery continues from the next batch
+	batch = <-batches
+	assert.Equal(t, 101, batch.Events[0].Data.Field1)
+	batch.Ack()
+
+	// The acknowledged batches are checkpointed
+	assert.Eventually(t, func() bool {
+		ess, err := mgr.GetStreamByID(ctx, es1.GetID())
+		return err == nil && ess.Statistics != nil && ess.Statistics.Checkpoint >= "000000000191"
+	}, 5*time.Second, 1*time.Millisecond)
+
+	// Only one subscriber at a time
+	_, _, err = mgr.(Subscriber[testData]).Subscribe(ctx, es1.GetID())
+	assert.Regexp(t, "FF00266", err)
+
+	// Detaching closes the channel, and a new subscriber can attach
+	cancel()
+	cancel() // no-op
+	for range batches {
+	}
+	batches, cancel, err = mgr.(Subscriber[testData]).Subscribe(ctx, es1.GetID())
+	assert.NoError(t, err)
+	batch = <-batches
+	assert.GreaterOrEqual(t, batch.Events[0].Data.Field1, 201)
+	batch.Ack()
+	cancel()
+
+	// The subscriber is detached when the stream is deleted
+	subCtx, cancelCtx := context.WithCancel(ctx)
+	defer cancelCtx()
+	batches, _, err = mgr.(Subscriber[testData]).Subscribe(subCtx, es1.GetID())
+	assert.NoError(t, err)
+	assert.NoError(t, mgr.DeleteStream(ctx, es1.GetID()))
+	for range batches {
+	}
+}
+
+func newInProcessTestManager(t *testing.T) (context.Context, *esManager[testESConfig, testData], func()) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+	})
+	return ctx, esm, func() {
+		esm.removeStream("stream1")
+		done()
+	}
+}
+
+func TestSubscribeErrors(t *testing.T) {
+	ctx, esm, done := newInProcessTestManager(t)
+	defer done()
+
+	_, _, err := esm.Subscribe(ctx, "unknown")
+	assert.Regexp(t, "FF00164", err)
+
+	es := &eventStream[testESConfig, testData]{
+		spec: &EventStreamSpec[testESConfig]{
+			ID:   ptrTo("stream1"),
+			Name: ptrTo("stream1"),
+			Type: &EventStreamTypeWebSocket,
+		},
+	}
+	esm.streams["stream1"] = es
+	_, _, err = esm.Subscribe(ctx, "stream1")
+	assert.Regexp(t, "FF00265", err)
+}
+
+func TestSubscribeContextCancelled(t *testing.T) {
+	ctx, esm, done := newInProcessTestManager(t)
+	defer done()
+
+	esm.streams["stream1"] = &eventStream[testESConfig, testData]{
+		spec: &EventStreamSpec[testESConfig]{ID: ptrTo("stream1"), Name: ptrTo("stream1"), Type: &EventStreamTypeInProcess},
+	}
+	action := esm.newInProcessAction("stream1")
+
+	// Cancelled before acknowledging the batch
+	subCtx, cancelSub := context.WithCancel(ctx)
+	batches, _, err := esm.Subscribe(subCtx, "stream1")
+	assert.NoError(t, err)
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- action.AttemptDispatch(ctx, 1, &EventBatch[testData]{BatchNumber: 1})
+	}()
+	<-batches
+	cancelSub()
+	assert.Regexp(t, "FF00268", <-dispatched)
+	for range batches {
+	}
+
+	// Cancelled while waiting for a batch
+	subCtx, cancelSub = context.WithCancel(ctx)
+	batches, _, err = esm.Subscribe(subCtx, "stream1")
+	assert.NoError(t, err)
+	cancelSub()
+	for range batches {
+	}
+	assert.Empty(t, esm.subscriptions)
+
+	// Dispatch to a detached subscriber
+	sub := &inProcessSubscription[testData]{closed: make(chan struct{})}
+	close(sub.closed)
+	esm.subscriptions["stream1"] = sub
+	err = action.AttemptDispatch(ctx, 1, &EventBatch[testData]{BatchNumber: 1})
+	assert.Regexp(t, "FF00268", err)
+}
+
+func TestInProcessDispatchInterrupted(t *testing.T) {
+	ctx, esm, done := newInProcessTestManager(t)
+	defer done()
+
+	action := esm.newInProcessAction("stream1")
+	cancelledCtx, cancelCtx := context.WithCancel(ctx)
+	cancelCtx()
+
+	// No subscriber
+	err := action.AttemptDispatch(cancelledCtx, 1, &EventBatch[testData]{BatchNumber: 1})
+	assert.Regexp(t, "FF00267", err)
+
+	// Subscriber not receiving
+	esm.subscriptions["stream1"] = &inProcessSubscription[testData]{closed: make(chan struct{})}
+	err = action.AttemptDispatch(cancelledCtx, 1, &EventBatch[testData]{BatchNumber: 1})
+	assert.Regexp(t, "FF00267", err)
+
+	// Subscriber not acknowledging
+	sub := &inProcessSubscription[testData]{deliver: make(chan *SubscriptionBatch[testData], 1), closed: make(chan struct{})}
+	esm.subscriptions["stream1"] = sub
+	dispatchCtx, cancelDispatch := context.WithCancel(ctx)
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- action.AttemptDispatch(dispatchCtx, 1, &EventBatch[testData]{BatchNumber: 1})
+	}()
+	<-sub.deliver
+	cancelDispatch()
+	assert.Regexp(t, "FF00267", <-dispatched)
+}
+
+func TestSSEEvents(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	defer cancelCtx()
+
+	newBatch := func(seqs ...string) *SubscriptionBatch[testData] {
+		b := &SubscriptionBatch[testData]{EventBatch: &EventBatch[testData]{}, ack: make(chan error, 1)}
+		for _, seq := range seqs {
+			b.Events = append(b.Events, &Event[testData]{EventCommon: EventCommon{SequenceID: seq, Topic: "topic1"}})
+		}
+		return b
+	}
+	batches := make(chan *SubscriptionBatch[testData], 2)
+	batch1, batch2 := newBatch("000001", "000002"), newBatch("000003", "000004")
+	batches <- batch1
+	batches <- batch2
+	events := SSEEvents(ctx, batches)
+
+	// Each batch is acknowledged once all its events are passed on
+	e := <-events
+	assert.Equal(t, "000001", e.ID)
+	assert.Equal(t, batch1.Events[0], e.Data)
+	assert.Equal(t, "000002", (<-events).ID)
+	assert.Equal(t, "000003", (<-events).ID)
+	assert.NoError(t, <-batch1.ack)
+	assert.Empty(t, batch2.ack)
+
+	// A batch that is not completely passed on is not acknowledged
+	cancelCtx()
+	for range events {
+	}
+	assert.Empty(t, batch2.ack)
+
+	// A failed subscription has no events
+	_, ok := <-SSEEvents[testData](ctx, nil)
+	assert.False(t, ok)
+}
@@ -19,26 +19,35 @@ package eventstreams
 import (
 	"context"
 	"crypto/tls"
+	"database/sql/driver"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/dbsql"
 	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/hyperledger/firefly-common/pkg/metric"
 	"github.com/hyperledger/firefly-common/pkg/wsserver"
 )
 
 type Manager[CT any] interface {
 	UpsertStream(ctx context.Context, esSpec *EventStreamSpec[CT]) (bool, error)
+	CloneStream(ctx context.Context, sourceID string, newName string) (*EventStreamSpec[CT], error)
 	GetStreamByID(ctx context.Context, id string, opts ...dbsql.GetOption) (*EventStreamWithStatus[CT], error)
 	ListStreams(ctx context.Context, filter ffapi.Filter) ([]*EventStreamWithStatus[CT], *ffapi.FilterResult, error)
 	StopStream(ctx context.Context, id string) error
+	StopStreamWithReason(ctx context.Context, id string, reason string) error
 	StartStream(ctx context.Context, id string) error
-	ResetStream(ctx context.Context, id string, sequenceID string) error
+	ResetStream(ctx context.Context, id string, sequenceID string, subSource ...string) error
 	DeleteStream(ctx context.Context, id string) error
 	Close(ctx context.Context)
+	HandleSignals(ctx context.Context) <-chan struct{}
+	SetMaxConcurrentStreams(limit int)
 }
 
 type SourceInstruction int
@@ -66,7 +75,61 @@ type Runtime[ConfigType any, DataType any] interface {
 	//   1. In any blocking i/o functions
 	//   2. To wake any sleeps early, such as batch polling scenarios
 	// - If the function returns without an Exit instruction, it will be restarted from the last checkpoint
-	Run(ctx context.Context, spec *EventStreamSpec[ConfigType], checkpointSequenceID string, deliver Deliver[DataType]) error
+	// - Runtimes with a single source use checkpointSequenceID, and leave SubSource empty on events
+	// - Runtimes that fan in from multiple sources set SubSource on each event, and are passed
+	//   the last checkpoint of each named sub-source in subSourceCheckpoints (nil for a new stream)
+	// - Runtimes that can go a long time without finding events can report progress with GetProgress(ctx)
+	Run(ctx context.Context, spec *EventStreamSpec[ConfigType], checkpointSequenceID string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[DataType]) error
+}
+
+// BatchTransformer is an optional interface a Runtime can implement, to map the events of each
+// batch to a different payload just before delivery - such as to strip internal fields, or enrich
+// with metadata. The stored events and checkpoints are unaffected. An error is handled as a
+// delivery failure, so is subject to the retry and error handling configuration of the stream.
+type BatchTransformer[ConfigType any, DataType any] interface {
+	TransformBatch(ctx context.Context, spec *EventStreamSpec[ConfigType], events []*Event[DataType]) (interface{}, error)
+}
+
+// TimestampResolver can optionally be implemented by the runtime, to allow streams to be
+// created with an InitialTimestamp that is resolved to the first sequence at or after that time.
+type TimestampResolver interface {
+	SequenceForTimestamp(ctx context.Context, t *fftypes.FFTime) (string, error)
+}
+
+// SequenceLagResolver can optionally be implemented by the runtime, to return how many events the source
+// currently has after the supplied sequence, based on the latest sequence it has recorded.
+// This allows streams with a catchupBatchSize to use larger batches while they are catching up.
+type SequenceLagResolver interface {
+	SequenceLag(ctx context.Context, sequenceID string) (int64, error)
+}
+
+// SequenceComparer can optionally be implemented by the runtime, to allow streams with the same sharedSource
+// to be fed from a single Run loop. It returns a negative number if sequence a is before b, zero if they
+// are the same, and a positive number if a is after b.
+type SequenceComparer interface {
+	CompareSequences(a, b string) int
+}
+
+// LatestSequenceResolver can optionally be implemented by the runtime, along with SequenceComparer, to allow
+// catchupOnly streams. It returns the sequence of the latest event the source currently has, or "" if it has none.
+type LatestSequenceResolver interface {
+	LatestSequence(ctx context.Context) (string, error)
+}
+
+// BlockedAlerter can optionally be implemented by the runtime, to be notified when delivery
+// of a batch has been outstanding for longer than the configured blockedAlertThreshold,
+// and again when delivery resumes after such an alert.
+type BlockedAlerter[ConfigType any] interface {
+	StreamBlocked(ctx context.Context, spec *EventStreamSpec[ConfigType], blockedSince time.Time)
+	StreamUnblocked(ctx context.Context, spec *EventStreamSpec[ConfigType], blockedFor time.Duration)
+}
+
+// ExclusiveSourceKeyer can optionally be implemented by the runtime, where a source can only have one reader
+// (such as an exclusive cursor). It returns a key identifying the source a stream reads, or "" if the source
+// of the stream can be shared. A stream cannot be started while another started stream has the same key,
+// unless warnExclusiveSourceConflicts is configured.
+type ExclusiveSourceKeyer[ConfigType any] interface {
+	ExclusiveSourceKey(spec *EventStreamSpec[ConfigType]) string
 }
 
 type esManager[CT any, DT any] struct {
@@ -77,6 +140,43 @@ type esManager[CT any, DT any] struct {
 	wsChannels  wsserver.WebSocketChannels
 	persistence Persistence[CT]
 	runtime     Runtime[CT, DT]
+
+	subscriptions map[string]*inProcessSubscription[DT]
+	subscribed    chan struct{} // closed and replaced each time an in-process subscriber attaches
+	sharedSources map[string]*sharedSource[CT, DT]
+	streamLimiter *streamLimiter
+
+	deliveryTimer          *metric.LatencyTimer // nil if there is no MetricsManager
+	backlogMetricsInterval time.Duration
+	scheduleInterval       time.Duration
+	cancelScheduler        context.CancelFunc
+	schedulerDone          chan struct{}
+	cancelChangeListener   context.CancelFunc
+
+	signalsOnce sync.Once
+	signalsDone chan struct{}
+}
+
+const (
+	metricQueueDepth            = "delivery_queue_depth"
+	metricOldestPendingEventAge = "oldest_pending_event_age_seconds"
+	metricDeliveryDuration      = "batch_delivery_duration_seconds"
+	metricSourceIdle            = "source_idle_seconds"
+	metricWebSocketConsumers    = "websocket_consumers"
+	metricLabelStream           = "stream"
+	metricLabelPrefix           = "label_"
+)
+
+func parseTLSConfigs(ctx context.Context, config *Config) (map[string]*tls.Config, error) {
+	tlsConfigs := make(map[string]*tls.Config)
+	for name, tlsJSONConf := range config.TLSConfigs {
+		tlsConf, err := fftls.NewTLSConfig(ctx, tlsJSONConf, fftls.ClientType)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfigs[name] = tlsConf
+	}
+	return tlsConfigs, nil
 }
 
 func NewEventStreamManager[CT any, DT any](ctx context.Context, config *Config, p Persistence[CT], wsChannels wsserver.WebSocketChannels, source Runtime[CT, DT]) (es Manager[CT], err error) {
@@ -90,12 +190,9 @@ func NewEventStreamManager[CT any, DT any](ctx context.Context, config *Config,
 	}
 
 	// Parse the TLS configs up front
-	tlsConfigs := make(map[string]*tls.Config)
-	for name, tlsJSONConf := range config.TLSConfigs {
-		tlsConfigs[name], err = fftls.NewTLSConfig(ctx, tlsJSONConf, fftls.ClientType)
-		if err != nil {
-			return nil, err
-		}
+	tlsConfigs, err := parseTLSConfigs(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 	esm := &esManager[CT, DT]{
 		config:      *config,
@@ -104,13 +201,160 @@ func NewEventStreamManager[CT any, DT any](ctx context.Context, config *Config,
 		persistence: p,
 		wsChannels:  wsChannels,
 		streams:     map[string]*eventStream[CT, DT]{},
+
+		subscriptions: map[string]*inProcessSubscription[DT]{},
+		sharedSources: map[string]*sharedSource[CT, DT]{},
+		subscribed:    make(chan struct{}),
+		streamLimiter: newStreamLimiter(config.MaxConcurrentStreams),
+
+		backlogMetricsInterval: 1 * time.Second,
+		scheduleInterval:       1 * time.Second,
+		schedulerDone:          make(chan struct{}),
+	}
+	if esm.config.BacklogMetricsInterval > 0 {
+		esm.backlogMetricsInterval = time.Duration(esm.config.BacklogMetricsInterval)
+	}
+	if esm.config.RestartRetry == nil {
+		restartRetry := *config.Retry
+		restartRetry.Jitter = true
+		esm.config.RestartRetry = &restartRetry
 	}
+	esm.initMetrics(ctx)
 	if err = esm.initialize(ctx); err != nil {
 		return nil, err
 	}
+	if err = esm.listenStreamChanges(ctx); err != nil {
+		return nil, err
+	}
+	var schedulerCtx context.Context
+	schedulerCtx, esm.cancelScheduler = context.WithCancel(ctx)
+	go esm.runScheduler(schedulerCtx)
 	return esm, nil
 }
 
+// listenStreamChanges keeps the streams in sync with the changes made by other instances sharing the
+// database, where the persistence supports it
+func (esm *esManager[CT, DT]) listenStreamChanges(ctx context.Context) error {
+	cl, ok := esm.persistence.(StreamChangeListener)
+	if !ok {
+		return nil
+	}
+	var listenerCtx context.Context
+	listenerCtx, esm.cancelChangeListener = context.WithCancel(ctx)
+	listening, err := cl.ListenStreamChanges(listenerCtx, func(id string, eventType dbsql.ChangeEventType) {
+		esm.applyStreamChange(listenerCtx, id, eventType)
+	})
+	if err != nil {
+		esm.cancelChangeListener()
+		return err
+	}
+	if listening {
+		log.L(ctx).Infof("Listening for changes to event streams made by other instances")
+	}
+	return nil
+}
+
+// applyStreamChange re-initializes a stream created or updated by another instance with the persisted spec,
+// or removes one it deleted
+func (esm *esManager[CT, DT]) applyStreamChange(ctx context.Context, id string, eventType dbsql.ChangeEventType) {
+	existing := esm.getStream(id)
+	if eventType == dbsql.Deleted {
+		if existing != nil {
+			log.L(ctx).Infof("Removing event stream '%s' deleted by another instance", id)
+			if err := existing.suspend(ctx); err != nil {
+				log.L(ctx).Errorf("Failed to stop event stream '%s' deleted by another instance: %s", id, err)
+			}
+			esm.removeStream(id)
+			esm.detachSubscriber(id)
+			esm.setResumeHandler(existing.spec, nil)
+		}
+		return
+	}
+	esSpec, err := esm.persistence.EventStreams().GetByID(ctx, id)
+	if err != nil || esSpec == nil {
+		log.L(ctx).Errorf("Failed to load event stream '%s' changed by another instance: %v", id, err)
+		return
+	}
+	log.L(ctx).Infof("Re-initializing event stream '%s' changed by another instance", id)
+	if err := esm.reInit(ctx, esSpec, existing); err != nil {
+		log.L(ctx).Errorf("Failed to re-initialize event stream '%s' changed by another instance: %s", id, err)
+	}
+}
+
+func (esm *esManager[CT, DT]) initMetrics(ctx context.Context) {
+	if mm := esm.config.MetricsManager; mm != nil {
+		labelNames := esm.streamMetricLabelNames()
+		mm.NewGaugeMetricWithLabels(ctx, metricQueueDepth, "Number of events read from the source, that are waiting to be delivered", labelNames, false)
+		mm.NewGaugeMetricWithLabels(ctx, metricOldestPendingEventAge, "Age of the oldest event in the batch waiting to be delivered", labelNames, false)
+		mm.NewGaugeMetricWithLabels(ctx, metricSourceIdle, "Time since the source last passed events or reported progress", labelNames, false)
+		mm.NewGaugeMetricWithLabels(ctx, metricWebSocketConsumers, "Number of WebSocket connections consuming a websocket stream", labelNames, false)
+		// Not labelled by stream, as a histogram for every stream would be a large number of series
+		esm.deliveryTimer = mm.NewLatencyHistogramMetric(ctx, metricDeliveryDuration, "Time taken to deliver each batch of any stream, including any retries", metric.LatencyHistogramOptions{}, false)
+	}
+}
+
+// metricLabelName is the name of the metric label for a stream label key, which can contain characters
+// that are not valid in the name of a metric label
+func metricLabelName(key string) string {
+	return metricLabelPrefix + strings.NewReplacer(".", "_", "-", "_").Replace(key)
+}
+
+// streamMetricLabelNames are the labels of the per-stream metrics - the stream ID, and each stream label in metricsLabels
+func (esm *esManager[CT, DT]) streamMetricLabelNames() []string {
+	labelNames := []string{metricLabelStream}
+	for _, key := range esm.config.MetricsLabels {
+		labelNames = append(labelNames, metricLabelName(key))
+	}
+	return labelNames
+}
+
+// streamMetricLabels are the label values of the per-stream metrics, which are empty for stream labels the stream does not have
+func (esm *esManager[CT, DT]) streamMetricLabels(spec *EventStreamSpec[CT]) map[string]string {
+	labels := map[string]string{metricLabelStream: spec.GetID()}
+	for _, key := range esm.config.MetricsLabels {
+		labels[metricLabelName(key)] = spec.Labels[key]
+	}
+	return labels
+}
+
+func (esm *esManager[CT, DT]) emitBacklogMetrics(ctx context.Context, labels map[string]string, queueDepth int64, oldestPendingAge, sourceIdle time.Duration) {
+	esm.config.MetricsManager.SetGaugeMetricWithLabels(ctx, metricQueueDepth, float64(queueDepth), labels, nil)
+	esm.config.MetricsManager.SetGaugeMetricWithLabels(ctx, metricOldestPendingEventAge, oldestPendingAge.Seconds(), labels, nil)
+	esm.config.MetricsManager.SetGaugeMetricWithLabels(ctx, metricSourceIdle, sourceIdle.Seconds(), labels, nil)
+}
+
+// deleteStreamMetrics removes the series of a deleted stream, once it has stopped emitting them
+func (esm *esManager[CT, DT]) deleteStreamMetrics(ctx context.Context, streamID string) {
+	if esm.config.MetricsManager != nil {
+		esm.config.MetricsManager.DeleteMetricsWithLabels(ctx, map[string]string{metricLabelStream: streamID})
+	}
+}
+
+// emitConsumerMetrics emits the number of WebSocket connections consuming the stream, if it is a websocket stream
+func (esm *esManager[CT, DT]) emitConsumerMetrics(ctx context.Context, spec *EventStreamSpec[CT], labels map[string]string, stopped bool) {
+	consumers, ok := esm.webSocketConsumers(spec)
+	if !ok {
+		return
+	}
+	count := len(consumers)
+	if stopped {
+		count = 0
+	}
+	esm.config.MetricsManager.SetGaugeMetricWithLabels(ctx, metricWebSocketConsumers, float64(count), labels, nil)
+}
+
+// webSocketConsumers returns the connections consuming a websocket stream, where the WebSocket server can report them
+func (esm *esManager[CT, DT]) webSocketConsumers(spec *EventStreamSpec[CT]) ([]*wsserver.StreamConsumer, bool) {
+	if spec.Type == nil || *spec.Type != EventStreamTypeWebSocket || spec.Name == nil {
+		return nil, false
+	}
+	lister, ok := esm.wsChannels.(wsserver.StreamConsumerLister)
+	if !ok {
+		return nil, false
+	}
+	return lister.StreamConsumers(spec.wsTopic()), true
+}
+
 func (esm *esManager[CT, DT]) addStream(ctx context.Context, es *eventStream[CT, DT]) {
 	log.L(ctx).Infof("Adding stream '%s' [%s] (%s)", *es.spec.Name, es.spec.GetID(), es.Status(ctx).Status)
 	esm.mux.Lock()
@@ -142,6 +386,10 @@ func (esm *esManager[CT, DT]) initialize(ctx context.Context) error {
 		if len(streams) == 0 {
 			break
 		}
+		lastDelivered, err := esm.loadLastDelivered(ctx, streams)
+		if err != nil {
+			return err
+		}
 		for _, esSpec := range streams {
 			if *esSpec.Status == EventStreamStatusDeleted {
 				if err := esm.persistence.EventStreams().Delete(ctx, esSpec.GetID()); err != nil {
@@ -152,6 +400,7 @@ func (esm *esManager[CT, DT]) initialize(ctx context.Context) error {
 				if err != nil {
 					return err
 				}
+				es.lastDelivered = lastDelivered[esSpec.GetID()]
 				esm.addStream(ctx, es)
 			}
 		}
@@ -160,9 +409,34 @@ func (esm *esManager[CT, DT]) initialize(ctx context.Context) error {
 	return nil
 }
 
+// loadLastDelivered reads the checkpoints for a page of streams, so the last delivered event
+// of each is available in its status before the stream is started
+func (esm *esManager[CT, DT]) loadLastDelivered(ctx context.Context, streams []*EventStreamSpec[CT]) (map[string]*LastDeliveredEvent, error) {
+	ids := make([]driver.Value, len(streams))
+	for i, es := range streams {
+		ids[i] = es.GetID()
+	}
+	checkpoints, _, err := esm.persistence.Checkpoints().GetMany(ctx, CheckpointFilters.NewFilter(ctx).In("id", ids))
+	if err != nil {
+		return nil, err
+	}
+	lastDelivered := make(map[string]*LastDeliveredEvent, len(checkpoints))
+	for _, cp := range checkpoints {
+		if cp.LastDelivered != nil {
+			lastDelivered[*cp.ID] = cp.LastDelivered
+		}
+	}
+	return lastDelivered, nil
+}
+
 func (esm *esManager[CT, DT]) UpsertStream(ctx context.Context, esSpec *EventStreamSpec[CT]) (bool, error) {
 	var existing *eventStream[CT, DT]
-	if esSpec.ID == nil || len(*esSpec.ID) == 0 {
+	isCreate := esSpec.ID == nil || len(*esSpec.ID) == 0
+	if isCreate {
+		// A retry of a create returns the stream created by the original request
+		if found, err := esm.getStreamByIdempotencyKey(ctx, esSpec); err != nil || found {
+			return false, err
+		}
 		esSpec.ID = ptrTo(esm.runtime.NewID())
 	} else {
 		existing = esm.getStream(esSpec.GetID())
@@ -175,6 +449,26 @@ func (esm *esManager[CT, DT]) UpsertStream(ctx context.Context, esSpec *EventStr
 	if *esSpec.Status != EventStreamStatusStarted && *esSpec.Status != EventStreamStatusStopped {
 		return false, i18n.NewError(ctx, i18n.MsgESStartedOrStopped)
 	}
+	// A stream with a start time is kept stopped until then, unless the time has already passed
+	if esSpec.StartAt != nil {
+		if time.Now().Before(*esSpec.StartAt.Time()) {
+			esSpec.Status = &EventStreamStatusStopped
+		} else {
+			esSpec.Status = &EventStreamStatusStarted
+			esSpec.StartAt = nil
+		}
+	}
+	// The tip of a catchupOnly stream is captured by the manager, and a completed stream stays completed
+	esSpec.CatchupTip = nil
+	if existing != nil {
+		existing.mux.Lock()
+		esSpec.CatchupTip = existing.spec.CatchupTip
+		if *existing.spec.Status == EventStreamStatusCompleted {
+			esSpec.Status = &EventStreamStatusCompleted
+		}
+		existing.mux.Unlock()
+	}
+	esSpec.StoppedReason = esm.upsertStoppedReason(esSpec, existing)
 
 	// Do a validation that does NOT update the defaults into the structure, so that
 	// the defaults are not persisted into the DB. This means that if the defaults are
@@ -182,25 +476,165 @@ func (esm *esManager[CT, DT]) UpsertStream(ctx context.Context, esSpec *EventStr
 	if err := esm.validateStream(ctx, esSpec, false); err != nil {
 		return false, err
 	}
+	if err := esm.checkWSTopicUnique(ctx, esSpec); err != nil {
+		return false, err
+	}
+	if err := esm.checkExclusiveSource(ctx, esSpec); err != nil {
+		return false, err
+	}
+	if err := esm.resolveInitialTimestamp(ctx, esSpec); err != nil {
+		return false, err
+	}
 
 	isNew, err := esm.persistence.EventStreams().Upsert(ctx, esSpec, dbsql.UpsertOptimizationExisting)
 	if err != nil {
+		// A concurrent create with the same idempotency key fails on the unique constraint in the DB
+		if isCreate {
+			if found, _ := esm.getStreamByIdempotencyKey(ctx, esSpec); found {
+				return false, nil
+			}
+		}
 		return false, err
 	}
 	return isNew, esm.reInit(ctx, esSpec, existing)
 }
 
+// checkWSTopicUnique ensures consumers starting the WebSocket topic of a stream cannot be routed to another
+// stream - including one that uses its name as its topic
+func (esm *esManager[CT, DT]) checkWSTopicUnique(ctx context.Context, esSpec *EventStreamSpec[CT]) error {
+	if *esSpec.Type != EventStreamTypeWebSocket {
+		return nil
+	}
+	topic := esSpec.wsTopic()
+	esm.mux.Lock()
+	streams := make([]*eventStream[CT, DT], 0, len(esm.streams))
+	for id, es := range esm.streams {
+		if id != esSpec.GetID() {
+			streams = append(streams, es)
+		}
+	}
+	esm.mux.Unlock()
+	for _, es := range streams {
+		es.mux.Lock()
+		other := es.spec
+		es.mux.Unlock()
+		if *other.Type == EventStreamTypeWebSocket && other.wsTopic() == topic {
+			return i18n.NewError(ctx, i18n.MsgESDuplicateWSTopic, topic, *other.Name)
+		}
+	}
+	return nil
+}
+
+// checkExclusiveSource ensures a started stream does not read an exclusive source that another started stream
+// is reading, as they would corrupt each other's progress
+func (esm *esManager[CT, DT]) checkExclusiveSource(ctx context.Context, esSpec *EventStreamSpec[CT]) error {
+	keyer, ok := esm.runtime.(ExclusiveSourceKeyer[CT])
+	if !ok || *esSpec.Status != EventStreamStatusStarted {
+		return nil
+	}
+	key := keyer.ExclusiveSourceKey(esSpec)
+	if key == "" {
+		return nil
+	}
+	esm.mux.Lock()
+	streams := make([]*eventStream[CT, DT], 0, len(esm.streams))
+	for id, es := range esm.streams {
+		if id != esSpec.GetID() {
+			streams = append(streams, es)
+		}
+	}
+	esm.mux.Unlock()
+	for _, es := range streams {
+		es.mux.Lock()
+		other := es.spec
+		started := *other.Status == EventStreamStatusStarted
+		es.mux.Unlock()
+		if started && keyer.ExclusiveSourceKey(other) == key {
+			err := i18n.NewError(ctx, i18n.MsgESExclusiveSourceConflict, other.GetID(), key)
+			if !esm.config.WarnExclusiveSourceConflicts {
+				return err
+			}
+			log.L(ctx).Warnf("Starting event stream '%s': %s", esSpec.GetID(), err)
+		}
+	}
+	return nil
+}
+
+// upsertStoppedReason keeps the reason of a stream that stays stopped, and records a stream stopped by the upsert as requested
+func (esm *esManager[CT, DT]) upsertStoppedReason(esSpec *EventStreamSpec[CT], existing *eventStream[CT, DT]) *string {
+	if *esSpec.Status != EventStreamStatusStopped {
+		return nil
+	}
+	if esSpec.StartAt != nil {
+		return ptrTo(StopReasonSchedule)
+	}
+	if existing != nil {
+		existing.mux.Lock()
+		defer existing.mux.Unlock()
+		if *existing.spec.Status == EventStreamStatusStopped && existing.spec.StoppedReason != nil {
+			return existing.spec.StoppedReason
+		}
+	}
+	return ptrTo(StopReasonRequested)
+}
+
+// getStreamByIdempotencyKey replaces the supplied spec with the persisted stream that has the same idempotency key, if one exists
+func (esm *esManager[CT, DT]) getStreamByIdempotencyKey(ctx context.Context, esSpec *EventStreamSpec[CT]) (bool, error) {
+	if esSpec.IdempotencyKey == nil || len(*esSpec.IdempotencyKey) == 0 {
+		return false, nil
+	}
+	matches, _, err := esm.persistence.EventStreams().GetMany(ctx, EventStreamFilters.NewFilterLimit(ctx, 1).Eq("idempotencykey", *esSpec.IdempotencyKey))
+	if err != nil || len(matches) == 0 {
+		return false, err
+	}
+	log.L(ctx).Infof("Returning existing event stream '%s' for idempotency key '%s'", matches[0].GetID(), *esSpec.IdempotencyKey)
+	*esSpec = *matches[0]
+	return true, nil
+}
+
+func (esm *esManager[CT, DT]) resolveInitialTimestamp(ctx context.Context, esSpec *EventStreamSpec[CT]) error {
+	if esSpec.InitialTimestamp == nil {
+		return nil
+	}
+	if esSpec.InitialSequenceID != nil {
+		return i18n.NewError(ctx, i18n.MsgESInitialTimestampAndSequence)
+	}
+	resolver, ok := esm.runtime.(TimestampResolver)
+	if !ok {
+		return i18n.NewError(ctx, i18n.MsgESInitialTimestampUnsupported)
+	}
+	sequenceID, err := resolver.SequenceForTimestamp(ctx, esSpec.InitialTimestamp)
+	if err != nil {
+		return err
+	}
+	log.L(ctx).Infof("Resolved initial timestamp %s to sequence '%s' for event stream '%s'", esSpec.InitialTimestamp, sequenceID, esSpec.GetID())
+	esSpec.InitialSequenceID = &sequenceID
+	esSpec.InitialTimestamp = nil
+	return nil
+}
+
 func (esm *esManager[CT, DT]) reInit(ctx context.Context, esSpec *EventStreamSpec[CT], existing *eventStream[CT, DT]) error {
 	// Runtime handling now the DB is updated
 	if existing != nil {
+		// Changes to only the batch settings are applied without suspending delivery
+		if err := esm.validateStream(ctx, esSpec, true); err != nil {
+			return err
+		}
+		if existing.updateBatchSettings(ctx, esSpec) {
+			return nil
+		}
 		if err := existing.suspend(ctx); err != nil {
 			return err
 		}
+		esm.setResumeHandler(existing.spec, nil)
 	}
 	es, err := esm.initEventStream(ctx, esSpec)
 	if err != nil {
 		return err
 	}
+	if existing != nil {
+		es.lastDelivered = existing.getLastDelivered()
+	}
 	esm.addStream(ctx, es)
 	if *es.spec.Status == EventStreamStatusStarted {
 		es.ensureActive()
@@ -221,18 +655,31 @@ func (esm *esManager[CT, DT]) DeleteStream(ctx context.Context, id string) error
 		return err
 	}
 	esm.removeStream(id)
+	esm.detachSubscriber(id)
+	esm.setResumeHandler(es.spec, nil)
+	esm.deleteStreamMetrics(ctx, id)
 	return nil
 }
 
 func (esm *esManager[CT, DT]) StopStream(ctx context.Context, id string) error {
+	return esm.StopStreamWithReason(ctx, id, "")
+}
+
+// StopStreamWithReason stops the stream, recording the reason to report in its status until it
+// is started again - so operators can tell why it was stopped. An empty reason is recorded as
+// StopReasonRequested.
+func (esm *esManager[CT, DT]) StopStreamWithReason(ctx context.Context, id string, reason string) error {
 	es := esm.getStream(id)
 	if es == nil {
 		return i18n.NewError(ctx, i18n.Msg404NoResult)
 	}
-	return es.stop(ctx)
+	return es.stop(ctx, reason)
 }
 
-func (esm *esManager[CT, DT]) ResetStream(ctx context.Context, id string, sequenceID string) error {
+// ResetStream resets the checkpoint of the stream to the supplied sequenceID, discarding
+// the checkpoints of all sub-sources. If a subSource is specified, only the checkpoint of
+// that sub-source is reset - with an empty sequenceID removing it.
+func (esm *esManager[CT, DT]) ResetStream(ctx context.Context, id string, sequenceID string, subSource ...string) error {
 	es := esm.getStream(id)
 	if es == nil {
 		return i18n.NewError(ctx, i18n.Msg404NoResult)
@@ -241,23 +688,54 @@ func (esm *esManager[CT, DT]) ResetStream(ctx context.Context, id string, sequen
 	if err := es.suspend(ctx); err != nil {
 		return err
 	}
+	if len(subSource) > 0 && subSource[0] != "" {
+		if err := esm.resetSubSourceCheckpoint(ctx, id, subSource[0], sequenceID); err != nil {
+			return err
+		}
+	} else if err := esm.resetCheckpoint(ctx, es, id, sequenceID); err != nil {
+		return err
+	}
+	// if the spec status is running, restart it
+	if *es.spec.Status == EventStreamStatusStarted {
+		return es.start(ctx)
+	}
+	return nil
+}
+
+func (esm *esManager[CT, DT]) resetCheckpoint(ctx context.Context, es *eventStream[CT, DT], id string, sequenceID string) error {
 	// delete any existing checkpoint
 	if err := esm.persistence.Checkpoints().DeleteMany(ctx, CheckpointFilters.NewFilter(ctx).Eq("id", id)); err != nil {
 		return err
 	}
 	// store the initial_sequence_id back to the object, and update our in-memory record
 	es.spec.InitialSequenceID = &sequenceID
-	if err := esm.persistence.EventStreams().UpdateSparse(ctx, &EventStreamSpec[CT]{
+	es.setLastDelivered(nil)
+	return esm.persistence.EventStreams().UpdateSparse(ctx, &EventStreamSpec[CT]{
 		ID:                &id,
 		InitialSequenceID: &sequenceID,
-	}); err != nil {
+	})
+}
+
+func (esm *esManager[CT, DT]) resetSubSourceCheckpoint(ctx context.Context, id string, subSource string, sequenceID string) error {
+	cp, err := esm.persistence.Checkpoints().GetByID(ctx, id)
+	if err != nil {
 		return err
 	}
-	// if the spec status is running, restart it
-	if *es.spec.Status == EventStreamStatusStarted {
-		return es.start(ctx)
+	if cp == nil {
+		cp = &EventStreamCheckpoint{ID: &id}
 	}
-	return nil
+	subSources := cp.SubSources.copy()
+	if subSources == nil {
+		subSources = SubSourceCheckpoints{}
+	}
+	if sequenceID == "" {
+		delete(subSources, subSource)
+	} else {
+		subSources[subSource] = sequenceID
+	}
+	cp.SubSources = subSources
+	_, err = esm.persistence.Checkpoints().Upsert(ctx, cp, dbsql.UpsertOptimizationExisting)
+	return err
 }
 
 func (esm *esManager[CT, DT]) StartStream(ctx context.Context, id string) error {
@@ -265,6 +743,13 @@ func (esm *esManager[CT, DT]) StartStream(ctx context.Context, id string) error
 	if es == nil {
 		return i18n.NewError(ctx, i18n.Msg404NoResult)
 	}
+	es.mux.Lock()
+	toStart := *es.spec
+	es.mux.Unlock()
+	toStart.Status = &EventStreamStatusStarted
+	if err := esm.checkExclusiveSource(ctx, &toStart); err != nil {
+		return err
+	}
 	return es.start(ctx)
 }
 
@@ -302,7 +787,38 @@ func (esm *esManager[CT, DT]) GetStreamByID(ctx context.Context, id string, opts
 	return esm.enrichGetStream(ctx, esSpec), nil
 }
 
+// CloneStream creates a new stream with the configuration of an existing one. The clone has its own ID and
+// checkpoint, so starts from the InitialSequenceID of the source (or the default), rather than from where
+// the source has got to. It is started, as for any new stream, and consumed on a WebSocket topic of its new name.
+func (esm *esManager[CT, DT]) CloneStream(ctx context.Context, sourceID string, newName string) (*EventStreamSpec[CT], error) {
+	esSpec, err := esm.persistence.EventStreams().GetByID(ctx, sourceID, dbsql.FailIfNotFound)
+	if err != nil {
+		return nil, err
+	}
+	esSpec.ID = nil
+	esSpec.Created = nil
+	esSpec.Updated = nil
+	esSpec.Name = &newName
+	esSpec.IdempotencyKey = nil
+	esSpec.Status = nil
+	esSpec.StoppedReason = nil
+	esSpec.StartAt = nil
+	esSpec.WSTopic = nil
+	if _, err := esm.UpsertStream(ctx, esSpec); err != nil {
+		return nil, err
+	}
+	log.L(ctx).Infof("Cloned event stream '%s' from '%s'", esSpec.GetID(), sourceID)
+	return esSpec, nil
+}
+
 func (esm *esManager[CT, DT]) Close(ctx context.Context) {
+	if esm.cancelChangeListener != nil {
+		esm.cancelChangeListener()
+	}
+	if esm.cancelScheduler != nil {
+		esm.cancelScheduler()
+		<-esm.schedulerDone
+	}
 	for _, es := range esm.streams {
 		if err := es.suspend(ctx); err != nil {
 			log.L(ctx).Warnf("Failed to stop event stream %s: %s", es.spec.GetID(), err)
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/firefly-common/mocks/crudmocks"
 	"github.com/hyperledger/firefly-common/pkg/config"
@@ -35,15 +36,15 @@ import (
 
 type mockEventSource struct {
 	validate func(ctx context.Context, conf *testESConfig) error
-	run      func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error
+	run      func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error
 }
 
 func (mes *mockEventSource) NewID() string {
 	return fftypes.NewUUID().String()
 }
 
-func (mes *mockEventSource) Run(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error {
-	return mes.run(ctx, es, checkpointSequenceId, deliver)
+func (mes *mockEventSource) Run(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+	return mes.run(ctx, es, checkpointSequenceId, subSourceCheckpoints, deliver)
 }
 
 func (mes *mockEventSource) Validate(ctx context.Context, conf *testESConfig) error {
@@ -94,7 +95,7 @@ func newMockESManager(t *testing.T, extraSetup ...func(mp *mockPersistence)) (co
 
 	mes := &mockEventSource{
 		validate: func(ctx context.Context, conf *testESConfig) error { return nil },
-		run: func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, deliver Deliver[testData]) error {
+		run: func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
 			<-ctx.Done()
 			return nil
 		},
@@ -141,6 +142,28 @@ func TestNewManagerBadConfState(t *testing.T) {
 	assert.Regexp(t, "FF00237", err)
 }
 
+func TestRestartRetryDefaultsToJitteredRetry(t *testing.T) {
+	ctx := context.Background()
+	config.RootConfigReset()
+	InitConfig(config.RootSection("ut"))
+	generated := GenerateConfig(ctx)
+	assert.True(t, generated.RestartRetry.Jitter)
+	assert.False(t, generated.Retry.Jitter)
+
+	mp := &mockPersistence{
+		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
+		checkpoints:  crudmocks.NewCRUD[*EventStreamCheckpoint](t),
+	}
+	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+	conf := &Config{Retry: &retry.Retry{InitialDelay: 1 * time.Second, MaximumDelay: 10 * time.Second}}
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, conf, mp, nil, &mockEventSource{})
+	assert.NoError(t, err)
+	defer mgr.Close(ctx)
+	restartRetry := mgr.(*esManager[testESConfig, testData]).config.RestartRetry
+	assert.Equal(t, retry.Retry{InitialDelay: 1 * time.Second, MaximumDelay: 10 * time.Second, Jitter: true}, *restartRetry)
+	assert.Nil(t, conf.RestartRetry)
+}
+
 func TestInitFail(t *testing.T) {
 	mp := &mockPersistence{
 		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
@@ -161,6 +184,7 @@ func TestInitWithStreams(t *testing.T) {
 	}
 	_, _, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 		mp.checkpoints.On("GetByID", mock.Anything, es.GetID()).Return((*EventStreamCheckpoint)(nil), nil)
 	})
@@ -181,11 +205,30 @@ func TestInitWithStreamsCleanupFail(t *testing.T) {
 		Status: ptrTo(EventStreamStatusDeleted),
 	}
 	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+	mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 	mp.eventStreams.On("Delete", mock.Anything, es.GetID()).Return(fmt.Errorf("pop"))
 	_, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), mp, nil, nil)
 	assert.Regexp(t, "pop", err)
 }
 
+func TestInitWithStreamsCheckpointsFail(t *testing.T) {
+	mp := &mockPersistence{
+		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
+		checkpoints:  crudmocks.NewCRUD[*EventStreamCheckpoint](t),
+	}
+	ctx := context.Background()
+	InitConfig(config.RootSection("ut"))
+	es := &EventStreamSpec[testESConfig]{
+		ID:     ptrTo(fftypes.NewUUID().String()),
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStarted),
+	}
+	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+	mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return(nil, nil, fmt.Errorf("pop")).Once()
+	_, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), mp, nil, nil)
+	assert.Regexp(t, "pop", err)
+}
+
 func TestInitWithStreamsInitFail(t *testing.T) {
 	mp := &mockPersistence{
 		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
@@ -199,6 +242,7 @@ func TestInitWithStreamsInitFail(t *testing.T) {
 		Status: ptrTo(EventStreamStatusStarted),
 	}
 	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+	mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 	_, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), mp, nil, &mockEventSource{
 		validate: func(ctx context.Context, conf *testESConfig) error {
 			return fmt.Errorf("pop")
@@ -215,6 +259,7 @@ func TestUpsertStreamDeleted(t *testing.T) {
 	}
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 	})
 	defer done()
@@ -233,6 +278,7 @@ func TestUpsertStreamBadUpdate(t *testing.T) {
 	}
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 	})
 	defer done()
@@ -252,6 +298,7 @@ func TestUpsertStreamUpsertFail(t *testing.T) {
 	}
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(false, fmt.Errorf("pop")).Once()
 	})
@@ -262,6 +309,158 @@ func TestUpsertStreamUpsertFail(t *testing.T) {
 
 }
 
+func TestUpsertStreamDuplicateWSTopic(t *testing.T) {
+	es := &EventStreamSpec[testESConfig]{
+		ID:     ptrTo(fftypes.NewUUID().String()),
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStopped),
+	}
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(false, fmt.Errorf("pop"))
+	})
+	defer done()
+
+	// The name of an existing stream is its topic
+	_, err := esm.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		Name:    ptrTo("stream2"),
+		WSTopic: ptrTo("stream1"),
+	})
+	assert.Regexp(t, "FF00307.*stream1", err)
+
+	// Other types of stream are not consumed on a topic
+	_, err = esm.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		Name:    ptrTo("stream2"),
+		Type:    &EventStreamTypeWebhook,
+		WSTopic: ptrTo("stream1"),
+		Webhook: &WebhookConfig{URL: ptrTo("http://localhost")},
+	})
+	assert.Regexp(t, "pop", err)
+
+	// A stream can update its own topic
+	updated := *es
+	updated.WSTopic = ptrTo("stream1")
+	_, err = esm.UpsertStream(ctx, &updated)
+	assert.Regexp(t, "pop", err)
+	assert.Equal(t, "stream1", updated.wsTopic())
+}
+
+type mockExclusiveSourceKeyer struct {
+	*mockEventSource
+}
+
+func (mesk *mockExclusiveSourceKeyer) ExclusiveSourceKey(spec *EventStreamSpec[testESConfig]) string {
+	if spec.Config == nil {
+		return ""
+	}
+	return spec.Config.Config1
+}
+
+func TestUpsertStreamExclusiveSource(t *testing.T) {
+	es1 := &EventStreamSpec[testESConfig]{
+		ID:     ptrTo(fftypes.NewUUID().String()),
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStopped),
+		Config: &testESConfig{Config1: "source1"},
+	}
+	es2 := &EventStreamSpec[testESConfig]{
+		ID:     ptrTo(fftypes.NewUUID().String()),
+		Name:   ptrTo("stream2"),
+		Status: ptrTo(EventStreamStatusStopped),
+		Config: &testESConfig{Config1: "source1"},
+	}
+	ctx, esm, mes, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es1, es2}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(false, fmt.Errorf("pop"))
+	})
+	defer done()
+	esm.runtime = &mockExclusiveSourceKeyer{mockEventSource: mes}
+	newStream := func(status EventStreamStatus, source string) *EventStreamSpec[testESConfig] {
+		return &EventStreamSpec[testESConfig]{
+			Name:   ptrTo("stream3"),
+			Status: &status,
+			Config: &testESConfig{Config1: source},
+		}
+	}
+
+	// Stopped streams do not conflict
+	_, err := esm.UpsertStream(ctx, newStream(EventStreamStatusStarted, "source1"))
+	assert.Regexp(t, "pop", err)
+
+	esm.getStream(es1.GetID()).spec.Status = ptrTo(EventStreamStatusStarted)
+	_, err = esm.UpsertStream(ctx, newStream(EventStreamStatusStarted, "source1"))
+	assert.Regexp(t, "FF00310.*"+es1.GetID(), err)
+	err = esm.StartStream(ctx, es2.GetID())
+	assert.Regexp(t, "FF00310.*"+es1.GetID(), err)
+
+	// A stream does not conflict with itself, or when it is not started, or its source can be shared
+	updated := *es1
+	updated.Status = ptrTo(EventStreamStatusStarted)
+	_, err = esm.UpsertStream(ctx, &updated)
+	assert.Regexp(t, "pop", err)
+	_, err = esm.UpsertStream(ctx, newStream(EventStreamStatusStopped, "source1"))
+	assert.Regexp(t, "pop", err)
+	_, err = esm.UpsertStream(ctx, newStream(EventStreamStatusStarted, ""))
+	assert.Regexp(t, "pop", err)
+	_, err = esm.UpsertStream(ctx, newStream(EventStreamStatusStarted, "source2"))
+	assert.Regexp(t, "pop", err)
+
+	// Conflicts can be configured to only warn
+	esm.config.WarnExclusiveSourceConflicts = true
+	_, err = esm.UpsertStream(ctx, newStream(EventStreamStatusStarted, "source1"))
+	assert.Regexp(t, "pop", err)
+}
+
+func TestUpsertStreamIdempotencyKeyLookupFail(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return(nil, nil, fmt.Errorf("pop")).Once()
+	})
+	defer done()
+
+	_, err := esm.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		Name:           ptrTo("stream1"),
+		IdempotencyKey: ptrTo("key1"),
+	})
+	assert.Regexp(t, "pop", err)
+}
+
+func TestUpsertStreamIdempotencyKeyConcurrentCreate(t *testing.T) {
+	existing := &EventStreamSpec[testESConfig]{
+		ID:             ptrTo(fftypes.NewUUID().String()),
+		Name:           ptrTo("stream1"),
+		IdempotencyKey: ptrTo("key1"),
+	}
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Twice()
+		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(false, fmt.Errorf("unique constraint")).Twice()
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{existing}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Twice()
+	})
+	defer done()
+
+	// The other create won the race, so we return the stream it created
+	es := &EventStreamSpec[testESConfig]{
+		Name:           ptrTo("stream1"),
+		IdempotencyKey: ptrTo("key1"),
+	}
+	isNew, err := esm.UpsertStream(ctx, es)
+	assert.NoError(t, err)
+	assert.False(t, isNew)
+	assert.Equal(t, existing.GetID(), es.GetID())
+
+	// A failure for another reason is returned
+	_, err = esm.UpsertStream(ctx, &EventStreamSpec[testESConfig]{
+		Name:           ptrTo("stream1"),
+		IdempotencyKey: ptrTo("key1"),
+	})
+	assert.Regexp(t, "unique constraint", err)
+}
+
 func TestUpsertReInitExistingFailTimeout(t *testing.T) {
 	es := &EventStreamSpec[testESConfig]{
 		ID:     ptrTo(fftypes.NewUUID().String()),
@@ -274,6 +473,7 @@ func TestUpsertReInitExistingFailTimeout(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm:         esm,
 		activeState: &activeStream[testESConfig, testData]{},
 		stopping:    make(chan struct{}),
 	}
@@ -294,7 +494,7 @@ func TestUpsertReInitExistingFailInit(t *testing.T) {
 	done()
 
 	err := esm.reInit(ctx, es, nil)
-	assert.Regexp(t, "FF00234", err)
+	assert.Regexp(t, "FF00172", err)
 
 }
 
@@ -309,6 +509,16 @@ func TestDeleteStreamNotKnown(t *testing.T) {
 
 }
 
+func TestBacklogMetricsIntervalConfig(t *testing.T) {
+	_, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		RootConfig.Set(ConfigBacklogMetricsInterval, "5s")
+	})
+	defer done()
+
+	assert.Equal(t, 5*time.Second, esm.backlogMetricsInterval)
+}
+
 func TestResetStreamNotKnown(t *testing.T) {
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
@@ -364,6 +574,7 @@ func TestDeleteStreamFail(t *testing.T) {
 	}
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("pop")).Once()
 	})
@@ -382,6 +593,7 @@ func TestDeleteStreamFailDelete(t *testing.T) {
 	}
 	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{es}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamCheckpoint{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
 		mp.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
 		mp.eventStreams.On("Delete", mock.Anything, mock.Anything).Return(fmt.Errorf("pop")).Once()
@@ -400,6 +612,7 @@ func TestResetStreamStopFailTimeout(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm:         esm,
 		activeState: &activeStream[testESConfig, testData]{},
 		stopping:    make(chan struct{}),
 		spec: &EventStreamSpec[testESConfig]{
@@ -422,6 +635,7 @@ func TestResetStreamStopFailDeleteCheckpoint(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
 		spec: &EventStreamSpec[testESConfig]{
 			ID:     ptrTo(fftypes.NewUUID().String()),
 			Name:   ptrTo("stream1"),
@@ -443,6 +657,7 @@ func TestResetStreamStopFailUpdateSequence(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
 		spec: &EventStreamSpec[testESConfig]{
 			ID:     ptrTo(fftypes.NewUUID().String()),
 			Name:   ptrTo("stream1"),
@@ -464,6 +679,7 @@ func TestResetStreamNoOp(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
 		spec: &EventStreamSpec[testESConfig]{
 			ID:     ptrTo(fftypes.NewUUID().String()),
 			Name:   ptrTo("stream1"),
@@ -507,6 +723,7 @@ func TestCloseSuspendFail(t *testing.T) {
 	done()
 
 	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
 		spec: &EventStreamSpec[testESConfig]{
 			ID:     ptrTo(fftypes.NewUUID().String()),
 			Name:   ptrTo("stream1"),
@@ -519,3 +736,308 @@ func TestCloseSuspendFail(t *testing.T) {
 	esm.Close(ctx)
 
 }
+
+func TestResetStreamSubSource(t *testing.T) {
+	var upserted *EventStreamCheckpoint
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return(&EventStreamCheckpoint{
+			SequenceID: ptrTo("000"),
+			SubSources: SubSourceCheckpoints{"source1": "100", "source2": "200"},
+		}, nil).Once()
+		mp.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Once()
+		mp.checkpoints.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(false, nil).Run(func(args mock.Arguments) {
+			upserted = args[1].(*EventStreamCheckpoint)
+		})
+	})
+	done()
+
+	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
+		spec: &EventStreamSpec[testESConfig]{
+			ID:     ptrTo(fftypes.NewUUID().String()),
+			Name:   ptrTo("stream1"),
+			Status: ptrTo(EventStreamStatusStopped),
+		},
+	}
+	esm.addStream(ctx, existing)
+
+	err := esm.ResetStream(ctx, existing.spec.GetID(), "", "source2")
+	assert.NoError(t, err)
+	assert.Equal(t, "000", *upserted.SequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"source1": "100"}, upserted.SubSources)
+	assert.Nil(t, existing.spec.InitialSequenceID)
+
+	err = esm.ResetStream(ctx, existing.spec.GetID(), "12345", "source1")
+	assert.NoError(t, err)
+	assert.Equal(t, existing.spec.GetID(), *upserted.ID)
+	assert.Nil(t, upserted.SequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"source1": "12345"}, upserted.SubSources)
+}
+
+func TestResetStreamSubSourceGetFail(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), fmt.Errorf("pop")).Once()
+	})
+	done()
+
+	existing := &eventStream[testESConfig, testData]{
+		esm: esm,
+		spec: &EventStreamSpec[testESConfig]{
+			ID:     ptrTo(fftypes.NewUUID().String()),
+			Name:   ptrTo("stream1"),
+			Status: ptrTo(EventStreamStatusStopped),
+		},
+	}
+	esm.addStream(ctx, existing)
+	err := esm.ResetStream(ctx, existing.spec.GetID(), "12345", "source1")
+	assert.Regexp(t, "pop", err)
+}
+
+type mockTimestampResolver struct {
+	*mockEventSource
+	resolve func(ctx context.Context, t *fftypes.FFTime) (string, error)
+}
+
+func (mtr *mockTimestampResolver) SequenceForTimestamp(ctx context.Context, t *fftypes.FFTime) (string, error) {
+	return mtr.resolve(ctx, t)
+}
+
+func TestUpsertStreamInitialTimestamp(t *testing.T) {
+	initialTime := fftypes.Now()
+	es := &EventStreamSpec[testESConfig]{
+		Name:             ptrTo("stream1"),
+		Status:           ptrTo(EventStreamStatusStopped),
+		InitialTimestamp: initialTime,
+	}
+	ctx, esm, mes, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+		mp.eventStreams.On("Upsert", mock.Anything, mock.MatchedBy(func(es *EventStreamSpec[testESConfig]) bool {
+			return *es.InitialSequenceID == "12345" && es.InitialTimestamp == nil
+		}), dbsql.UpsertOptimizationExisting).Return(true, nil).Once()
+	})
+	defer done()
+	esm.runtime = &mockTimestampResolver{
+		mockEventSource: mes,
+		resolve: func(ctx context.Context, ts *fftypes.FFTime) (string, error) {
+			assert.Equal(t, initialTime, ts)
+			return "12345", nil
+		},
+	}
+
+	isNew, err := esm.UpsertStream(ctx, es)
+	assert.NoError(t, err)
+	assert.True(t, isNew)
+	assert.Equal(t, "12345", *esm.getStream(es.GetID()).spec.InitialSequenceID)
+}
+
+func TestUpsertStreamStartAt(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Return(true, nil)
+		mp.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Maybe()
+	})
+	defer done()
+
+	// A future start time keeps the stream stopped, even if it is asked to start
+	scheduled := &EventStreamSpec[testESConfig]{
+		Name:    ptrTo("scheduled"),
+		Status:  ptrTo(EventStreamStatusStarted),
+		StartAt: ptrTo(fftypes.FFTime(time.Now().Add(time.Hour))),
+	}
+	_, err := esm.UpsertStream(ctx, scheduled)
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusStopped, *scheduled.Status)
+	status := esm.getStream(scheduled.GetID()).Status(ctx)
+	assert.Equal(t, EventStreamStatusScheduled, status.Status)
+	assert.Equal(t, StopReasonSchedule, status.StoppedReason)
+
+	// A start time that has passed starts the stream immediately
+	past := &EventStreamSpec[testESConfig]{
+		Name:    ptrTo("past"),
+		Status:  ptrTo(EventStreamStatusStopped),
+		StartAt: ptrTo(fftypes.FFTime(time.Now().Add(-time.Hour))),
+	}
+	_, err = esm.UpsertStream(ctx, past)
+	assert.NoError(t, err)
+	assert.Equal(t, EventStreamStatusStarted, *past.Status)
+	assert.Nil(t, past.StartAt)
+	assert.Nil(t, past.StoppedReason)
+	assert.NoError(t, esm.getStream(past.GetID()).suspend(ctx))
+}
+
+func TestUpsertStreamInitialTimestampErrors(t *testing.T) {
+	ctx, esm, mes, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil).Once()
+	})
+	defer done()
+
+	newSpec := func() *EventStreamSpec[testESConfig] {
+		return &EventStreamSpec[testESConfig]{
+			Name:             ptrTo("stream1"),
+			InitialTimestamp: fftypes.Now(),
+		}
+	}
+
+	_, err := esm.UpsertStream(ctx, newSpec())
+	assert.Regexp(t, "FF00249", err)
+
+	esm.runtime = &mockTimestampResolver{
+		mockEventSource: mes,
+		resolve: func(ctx context.Context, t *fftypes.FFTime) (string, error) {
+			return "", fmt.Errorf("pop")
+		},
+	}
+	_, err = esm.UpsertStream(ctx, newSpec())
+	assert.Regexp(t, "pop", err)
+
+	es := newSpec()
+	es.InitialSequenceID = ptrTo("12345")
+	_, err = esm.UpsertStream(ctx, es)
+	assert.Regexp(t, "FF00250", err)
+}
+
+func TestCloneStream(t *testing.T) {
+	source := &EventStreamSpec[testESConfig]{
+		ID:                ptrTo(fftypes.NewUUID().String()),
+		Created:           fftypes.Now(),
+		Name:              ptrTo("stream1"),
+		IdempotencyKey:    ptrTo("key1"),
+		Status:            ptrTo(EventStreamStatusStopped),
+		StoppedReason:     ptrTo("paused by operator"),
+		InitialSequenceID: ptrTo("12345"),
+		WSTopic:           ptrTo("topic1"),
+		StartAt:           ptrTo(fftypes.FFTime(time.Now().Add(time.Hour))),
+		BatchSize:         ptrTo(10),
+		Config:            &testESConfig{Config1: "source1"},
+	}
+	var upserted *EventStreamSpec[testESConfig]
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+		mp.eventStreams.On("GetByID", mock.Anything, source.GetID(), dbsql.FailIfNotFound).Return(source, nil)
+		mp.eventStreams.On("Upsert", mock.Anything, mock.Anything, dbsql.UpsertOptimizationExisting).Run(func(args mock.Arguments) {
+			upserted = args[1].(*EventStreamSpec[testESConfig])
+		}).Return(false, fmt.Errorf("pop"))
+	})
+	defer done()
+
+	sourceID := source.GetID()
+	_, err := esm.CloneStream(ctx, sourceID, "stream2")
+	assert.Regexp(t, "pop", err)
+	assert.NotEqual(t, sourceID, upserted.GetID())
+	assert.NotEmpty(t, upserted.GetID())
+	assert.Nil(t, upserted.Created)
+	assert.Equal(t, "stream2", *upserted.Name)
+	assert.Nil(t, upserted.IdempotencyKey)
+	assert.Equal(t, EventStreamStatusStarted, *upserted.Status)
+	assert.Nil(t, upserted.StoppedReason)
+	assert.Nil(t, upserted.StartAt)
+	assert.Equal(t, "stream2", upserted.wsTopic())
+	assert.Equal(t, "12345", *upserted.InitialSequenceID)
+	assert.Equal(t, 10, *upserted.BatchSize)
+	assert.Equal(t, "source1", upserted.Config.Config1)
+}
+
+func TestCloneStreamValidateFail(t *testing.T) {
+	source := &EventStreamSpec[testESConfig]{
+		ID:   ptrTo(fftypes.NewUUID().String()),
+		Name: ptrTo("stream1"),
+	}
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+		mp.eventStreams.On("GetByID", mock.Anything, source.GetID(), dbsql.FailIfNotFound).Return(source, nil)
+	})
+	defer done()
+
+	_, err := esm.CloneStream(ctx, source.GetID(), "bad name!")
+	assert.Regexp(t, "FF00140", err)
+}
+
+func TestCloneStreamNotFound(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+		mp.eventStreams.On("GetByID", mock.Anything, "missing", dbsql.FailIfNotFound).Return((*EventStreamSpec[testESConfig])(nil), fmt.Errorf("FF00164: not found"))
+	})
+	defer done()
+
+	_, err := esm.CloneStream(ctx, "missing", "stream2")
+	assert.Regexp(t, "FF00164", err)
+}
+
+type mockListeningPersistence struct {
+	*mockPersistence
+	listenErr error
+	handler   func(id string, eventType dbsql.ChangeEventType)
+}
+
+func (mlp *mockListeningPersistence) ListenStreamChanges(ctx context.Context, handler func(id string, eventType dbsql.ChangeEventType)) (bool, error) {
+	mlp.handler = handler
+	return mlp.listenErr == nil, mlp.listenErr
+}
+
+func TestStreamChangesFromOtherInstances(t *testing.T) {
+	mp := &mockListeningPersistence{mockPersistence: &mockPersistence{
+		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
+		checkpoints:  crudmocks.NewCRUD[*EventStreamCheckpoint](t),
+	}}
+	id := fftypes.NewUUID().String()
+	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+	mp.eventStreams.On("GetByID", mock.Anything, id).Return(&EventStreamSpec[testESConfig]{
+		ID:     ptrTo(id),
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStopped),
+	}, nil).Once()
+	mp.eventStreams.On("GetByID", mock.Anything, id).Return(&EventStreamSpec[testESConfig]{
+		ID:     ptrTo(id),
+		Name:   ptrTo("stream1"),
+		Status: ptrTo(EventStreamStatusStopped),
+		Labels: Labels{"env": "test"},
+	}, nil).Once()
+	mp.eventStreams.On("GetByID", mock.Anything, id).Return((*EventStreamSpec[testESConfig])(nil), fmt.Errorf("pop")).Once()
+	mp.eventStreams.On("GetByID", mock.Anything, id).Return(&EventStreamSpec[testESConfig]{
+		ID:     ptrTo(id),
+		Status: ptrTo(EventStreamStatusStopped),
+		Type:   ptrTo(fftypes.FFEnum("wrong")),
+	}, nil).Once()
+
+	ctx := context.Background()
+	config.RootConfigReset()
+	InitConfig(config.RootSection("ut").SubSection("eventstreams"))
+	mgr, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), mp, nil, &mockEventSource{
+		validate: func(ctx context.Context, conf *testESConfig) error { return nil },
+	})
+	assert.NoError(t, err)
+	esm := mgr.(*esManager[testESConfig, testData])
+	defer esm.Close(ctx)
+
+	// A stream created elsewhere is added, and re-initialized when it is updated
+	mp.handler(id, dbsql.Created)
+	assert.Equal(t, "stream1", *esm.getStream(id).spec.Name)
+	mp.handler(id, dbsql.Updated)
+	assert.Equal(t, "test", esm.getStream(id).spec.Labels["env"])
+
+	// Failures to load or re-initialize keep the existing stream
+	mp.handler(id, dbsql.Updated)
+	mp.handler(id, dbsql.Updated)
+	assert.Equal(t, "test", esm.getStream(id).spec.Labels["env"])
+
+	// A stream deleted elsewhere is removed
+	mp.handler(id, dbsql.Deleted)
+	assert.Nil(t, esm.getStream(id))
+	mp.handler(id, dbsql.Deleted)
+}
+
+func TestStreamChangesListenFail(t *testing.T) {
+	mp := &mockListeningPersistence{mockPersistence: &mockPersistence{
+		eventStreams: crudmocks.NewCRUD[*EventStreamSpec[testESConfig]](t),
+		checkpoints:  crudmocks.NewCRUD[*EventStreamCheckpoint](t),
+	}, listenErr: fmt.Errorf("pop")}
+	mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+
+	ctx := context.Background()
+	config.RootConfigReset()
+	InitConfig(config.RootSection("ut").SubSection("eventstreams"))
+	_, err := NewEventStreamManager[testESConfig, testData](ctx, GenerateConfig(ctx), mp, nil, &mockEventSource{})
+	assert.Regexp(t, "pop", err)
+}
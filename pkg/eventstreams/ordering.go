@@ -0,0 +1,44 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+// orderingKey returns the value of the orderingKey field of the event, as it would be delivered,
+// or false if ordering by key is not enabled or the event does not have the field
+func (as *activeStream[CT, DT]) orderingKey(event *Event[DT]) (string, bool) {
+	if as.spec.OrderingKey == nil {
+		return "", false
+	}
+	return as.eventFieldKey(event, *as.spec.OrderingKey)
+}
+
+// addOrderingKey records that the batch contains an event with the ordering key
+func (batch *eventStreamBatch[DT]) addOrderingKey(key string) {
+	if batch.orderingKeys == nil {
+		batch.orderingKeys = map[string]bool{}
+	}
+	batch.orderingKeys[key] = true
+}
+
+// sharesOrderingKey checks whether any event of the batch has the same ordering key as an event of the other batch
+func (batch *eventStreamBatch[DT]) sharesOrderingKey(other *eventStreamBatch[DT]) bool {
+	for key := range other.orderingKeys {
+		if batch.orderingKeys[key] {
+			return true
+		}
+	}
+	return false
+}
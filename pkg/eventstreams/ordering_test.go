@@ -0,0 +1,169 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMaxInFlightBatchesOrderingKey(t *testing.T) {
+	checkpoints := make(chan string, 10)
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- *args[1].(*EventStreamCheckpoint).SequenceID
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(1)
+	es.spec.MaxInFlightBatches = ptrTo(3)
+	es.spec.OrderingKey = ptrTo("topic")
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			deliver([]*Event[testData]{
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000001"}, Data: &testData{Field1: 1}},
+				{EventCommon: EventCommon{Topic: "b", SequenceID: "000002"}, Data: &testData{Field1: 2}},
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000003"}, Data: &testData{Field1: 3}},
+			})
+			delivered = true
+		}
+		return nil
+	}
+
+	started := make(chan string, 3)
+	acks := map[string]chan struct{}{}
+	for i := 1; i <= 3; i++ {
+		acks[fmt.Sprintf("%.6d", i)] = make(chan struct{})
+	}
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			seq := events.Events[0].SequenceID
+			started <- seq
+			<-acks[seq]
+			return nil
+		},
+	}
+
+	as := es.newActiveStream()
+	defer func() {
+		as.cancelCtx()
+		<-as.eventLoopDone
+		<-as.batchLoopDone
+	}()
+
+	// The batches of different keys are delivered in parallel, but the second batch of a key waits for the first
+	assert.ElementsMatch(t, []string{"000001", "000002"}, []string{<-started, <-started})
+	select {
+	case seq := <-started:
+		assert.Fail(t, "dispatched before the earlier batch with the same key completed", seq)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(acks["000001"])
+	assert.Equal(t, "000003", <-started)
+	assert.Equal(t, "000001", <-checkpoints)
+
+	// Checkpoints are still in order
+	close(acks["000003"])
+	select {
+	case cp := <-checkpoints:
+		assert.Fail(t, "checkpointed before the earlier batch completed", cp)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(acks["000002"])
+	assert.Equal(t, "000002", <-checkpoints)
+	assert.Equal(t, "000003", <-checkpoints)
+}
+
+func TestMaxInFlightBatchesOrderingKeyStop(t *testing.T) {
+	_, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(1)
+	es.spec.MaxInFlightBatches = ptrTo(2)
+	es.spec.OrderingKey = ptrTo("topic")
+
+	delivered := false
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		if delivered {
+			<-ctx.Done()
+		} else {
+			deliver([]*Event[testData]{
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000001"}},
+				{EventCommon: EventCommon{Topic: "a", SequenceID: "000002"}},
+			})
+			delivered = true
+		}
+		return nil
+	}
+
+	started := make(chan string, 2)
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, events *EventBatch[testData]) error {
+			started <- events.Events[0].SequenceID
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	as := es.newActiveStream()
+	assert.Equal(t, "000001", <-started)
+	// The batch loop exits while the second batch waits for the first
+	time.Sleep(10 * time.Millisecond)
+	as.cancelCtx()
+	<-as.eventLoopDone
+	<-as.batchLoopDone
+	assert.Empty(t, started)
+}
+
+func TestOrderingKeys(t *testing.T) {
+	_, es, _, done := newTestEventStream(t)
+	defer done()
+	as := &activeStream[testESConfig, testData]{eventStream: es, ctx: context.Background()}
+	event := &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001"}, Data: &testData{Field1: 12345}}
+
+	_, ok := as.orderingKey(event)
+	assert.False(t, ok) // not enabled
+
+	es.spec.OrderingKey = ptrTo("field1")
+	key, ok := as.orderingKey(event)
+	assert.True(t, ok)
+	assert.Equal(t, "12345", key)
+
+	batch1 := &eventStreamBatch[testData]{}
+	batch2 := &eventStreamBatch[testData]{}
+	assert.False(t, batch1.sharesOrderingKey(batch2))
+	batch1.addOrderingKey("a")
+	batch1.addOrderingKey("b")
+	batch2.addOrderingKey("c")
+	assert.False(t, batch1.sharesOrderingKey(batch2))
+	batch2.addOrderingKey("b")
+	assert.True(t, batch1.sharesOrderingKey(batch2))
+}
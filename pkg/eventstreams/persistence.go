@@ -30,14 +30,30 @@ type Persistence[CT any] interface {
 	Close()
 }
 
+// StreamChangeListener is an optional interface of the Persistence, for a database shared by multiple instances of
+// the manager, that notifies each instance of the event streams created, updated and deleted by the others
+type StreamChangeListener interface {
+	// ListenStreamChanges calls the handler with each stream changed by another instance, until the context is cancelled.
+	// Returns false if the database does not support change notifications.
+	ListenStreamChanges(ctx context.Context, handler func(id string, eventType dbsql.ChangeEventType)) (bool, error)
+}
+
 var EventStreamFilters = &ffapi.QueryFields{
-	"id":          &ffapi.StringField{},
-	"created":     &ffapi.TimeField{},
-	"updated":     &ffapi.TimeField{},
-	"name":        &ffapi.StringField{},
-	"status":      &ffapi.StringField{},
-	"type":        &ffapi.StringField{},
-	"topicfilter": &ffapi.StringField{},
+	"id":             &ffapi.StringField{},
+	"created":        &ffapi.TimeField{},
+	"updated":        &ffapi.TimeField{},
+	"name":           &ffapi.StringField{},
+	"idempotencykey": &ffapi.StringField{},
+	"status":         &ffapi.StringField{},
+	"type":           &ffapi.StringField{},
+	"topicfilter":    &ffapi.StringField{},
+	"sharedsource":   &ffapi.StringField{},
+	"stoppedreason":  &ffapi.StringField{},
+	"startat":        &ffapi.TimeField{},
+	"catchuponly":    &ffapi.BoolField{},
+	"catchuptip":     &ffapi.StringField{},
+	"wstopic":        &ffapi.StringField{},
+	"labels":         &ffapi.MapField{},
 }
 
 var CheckpointFilters = &ffapi.QueryFields{
@@ -70,29 +86,53 @@ func (p *esPersistence[CT]) EventStreams() dbsql.CRUD[*EventStreamSpec[CT]] {
 			dbsql.ColumnCreated,
 			dbsql.ColumnUpdated,
 			"name",
+			"idempotency_key",
 			"status",
 			"type",
 			"initial_sequence_id",
 			"topic_filter",
+			"compaction_key",
+			"shared_source",
 			"config",
 			"error_handling",
+			"delivery_mode",
 			"batch_size",
+			"catchup_batch_size",
 			"batch_timeout",
+			"max_batch_size_bytes",
+			"max_in_flight_batches",
+			"ordering_key",
 			"retry_timeout",
 			"blocked_retry_delay",
+			"ack_timeout",
+			"active_schedule",
+			"stopped_reason",
+			"start_at",
+			"catchup_only",
+			"catchup_tip",
 			"webhook_config",
 			"websocket_config",
+			"ws_topic",
+			"labels",
 		},
 		FilterFieldMap: map[string]string{
-			"topicfilter": "topic_filter",
+			"topicfilter":    "topic_filter",
+			"idempotencykey": "idempotency_key",
+			"sharedsource":   "shared_source",
+			"stoppedreason":  "stopped_reason",
+			"startat":        "start_at",
+			"catchuponly":    "catchup_only",
+			"catchuptip":     "catchup_tip",
+			"wstopic":        "ws_topic",
 		},
-		NilValue:     func() *EventStreamSpec[CT] { return nil },
-		NewInstance:  func() *EventStreamSpec[CT] { return &EventStreamSpec[CT]{} },
-		ScopedFilter: func() sq.Eq { return sq.Eq{} },
-		EventHandler: nil, // set below
-		NameField:    "name",
-		QueryFactory: EventStreamFilters,
-		IDValidator:  p.idValidator,
+		NilValue:      func() *EventStreamSpec[CT] { return nil },
+		NewInstance:   func() *EventStreamSpec[CT] { return &EventStreamSpec[CT]{} },
+		ScopedFilter:  func() sq.Eq { return sq.Eq{} },
+		EventHandler:  nil,  // set below
+		NotifyChanges: true, // a no-op unless the database supports it
+		NameField:     "name",
+		QueryFactory:  EventStreamFilters,
+		IDValidator:   p.idValidator,
 		GetFieldPtr: func(inst *EventStreamSpec[CT], col string) interface{} {
 			switch col {
 			case dbsql.ColumnID:
@@ -103,6 +143,8 @@ func (p *esPersistence[CT]) EventStreams() dbsql.CRUD[*EventStreamSpec[CT]] {
 				return &inst.Updated
 			case "name":
 				return &inst.Name
+			case "idempotency_key":
+				return &inst.IdempotencyKey
 			case "status":
 				return &inst.Status
 			case "type":
@@ -111,22 +153,52 @@ func (p *esPersistence[CT]) EventStreams() dbsql.CRUD[*EventStreamSpec[CT]] {
 				return &inst.InitialSequenceID
 			case "topic_filter":
 				return &inst.TopicFilter
+			case "compaction_key":
+				return &inst.CompactionKey
+			case "shared_source":
+				return &inst.SharedSource
 			case "config":
 				return &inst.Config
 			case "error_handling":
 				return &inst.ErrorHandling
+			case "delivery_mode":
+				return &inst.DeliveryMode
 			case "batch_size":
 				return &inst.BatchSize
+			case "catchup_batch_size":
+				return &inst.CatchupBatchSize
 			case "batch_timeout":
 				return &inst.BatchTimeout
+			case "max_batch_size_bytes":
+				return &inst.MaxBatchSizeBytes
+			case "max_in_flight_batches":
+				return &inst.MaxInFlightBatches
+			case "ordering_key":
+				return &inst.OrderingKey
 			case "retry_timeout":
 				return &inst.RetryTimeout
 			case "blocked_retry_delay":
 				return &inst.BlockedRetryDelay
+			case "ack_timeout":
+				return &inst.AckTimeout
+			case "active_schedule":
+				return &inst.ActiveSchedule
+			case "stopped_reason":
+				return &inst.StoppedReason
+			case "start_at":
+				return &inst.StartAt
+			case "catchup_only":
+				return &inst.CatchupOnly
+			case "catchup_tip":
+				return &inst.CatchupTip
 			case "webhook_config":
 				return &inst.Webhook
 			case "websocket_config":
 				return &inst.WebSocket
+			case "ws_topic":
+				return &inst.WSTopic
+			case "labels":
+				return &inst.Labels
 			}
 			return nil
 		},
@@ -142,6 +214,8 @@ func (p *esPersistence[CT]) Checkpoints() dbsql.CRUD[*EventStreamCheckpoint] {
 			dbsql.ColumnCreated,
 			dbsql.ColumnUpdated,
 			"sequence_id",
+			"sub_sources",
+			"last_delivered",
 		},
 		FilterFieldMap: map[string]string{
 			"sequenceid": "sequence_id",
@@ -162,12 +236,24 @@ func (p *esPersistence[CT]) Checkpoints() dbsql.CRUD[*EventStreamCheckpoint] {
 				return &inst.Updated
 			case "sequence_id":
 				return &inst.SequenceID
+			case "sub_sources":
+				return &inst.SubSources
+			case "last_delivered":
+				return &inst.LastDelivered
 			}
 			return nil
 		},
 	}
 }
 
+func (p *esPersistence[CT]) ListenStreamChanges(ctx context.Context, handler func(id string, eventType dbsql.ChangeEventType)) (bool, error) {
+	return p.db.ListenChanges(ctx, "eventstreams", handler)
+}
+
+func (p *esPersistence[CT]) RunAsGroup(ctx context.Context, fn func(ctx context.Context) error) error {
+	return p.db.RunAsGroup(ctx, fn)
+}
+
 func (p *esPersistence[CT]) Close() {
 	p.db.Close()
 }
@@ -0,0 +1,82 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+)
+
+// Progress reports that the source has read up to and including the sequenceID, of the named
+// subSource or the unnamed source if empty, without finding any more events to deliver.
+// Like Deliver, it blocks while the stream is blocked, and returns Exit if the stream stops.
+type Progress func(sequenceID string, subSource string) SourceInstruction
+
+type ctxProgressKey struct{}
+
+// GetProgress returns the Progress function for the stream, from the context passed to Run.
+//
+// A source that polls for long periods without finding matching events can report progress
+// after each poll, so the stream shows it is idle but healthy rather than stuck, and the
+// checkpoint advances while there are no events waiting to be delivered. The sequenceID
+// must not be before any event already delivered, and each report that moves the position
+// forward is checkpointed, so progress should be reported at a modest interval.
+//
+// Outside of Run, the function returned does nothing.
+func GetProgress(ctx context.Context) Progress {
+	if progress, ok := ctx.Value(ctxProgressKey{}).(Progress); ok {
+		return progress
+	}
+	return func(_, _ string) SourceInstruction { return Continue }
+}
+
+func withProgress(ctx context.Context, progress Progress) context.Context {
+	return context.WithValue(ctx, ctxProgressKey{}, progress)
+}
+
+// queueProgress pushes a progress marker to the batch loop, in order with the events,
+// returning false if the stream or the supplied run context closes first
+func (as *activeStream[CT, DT]) queueProgress(runCtx context.Context, sequenceID, subSource string) bool {
+	as.backlog.sourceActive()
+	if as.ctx.Err() != nil || runCtx.Err() != nil {
+		return false
+	}
+	select {
+	case as.events <- &Event[DT]{EventCommon: EventCommon{SequenceID: sequenceID, SubSource: subSource}, progress: true}:
+		return true
+	case <-as.ctx.Done():
+	case <-runCtx.Done():
+	}
+	return false
+}
+
+// detectProgress is called on the batch loop, and checkpoints the position reported by the source
+// if it has moved, and nothing is waiting to be delivered
+func (as *activeStream[CT, DT]) detectProgress(progress *Event[DT], batchActive bool) {
+	previous := as.detectedCheckpoint.sequenceID
+	if progress.SubSource != "" {
+		previous = as.detectedCheckpoint.subSources[progress.SubSource]
+	}
+	if previous == progress.SequenceID {
+		return
+	}
+	as.detectEvent(progress)
+	if !batchActive {
+		// any events skipped by the filter are included in this checkpoint
+		as.dispatchCheckpoint()
+		as.filterSkipped = 0
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProgressIdleSource(t *testing.T) {
+	checkpoints := make(chan *EventStreamCheckpoint, 10)
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- args[1].(*EventStreamCheckpoint)
+		})
+	})
+	defer done()
+
+	reported := make(chan struct{})
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		progress := GetProgress(ctx)
+		assert.Equal(t, Continue, progress("000005", ""))
+		assert.Equal(t, Continue, progress("000005", "")) // no change, so not checkpointed again
+		assert.Equal(t, Continue, progress("000002", "a"))
+		assert.Equal(t, Continue, progress("000010", ""))
+		close(reported)
+		<-ctx.Done()
+		assert.Equal(t, Exit, progress("000011", ""))
+		return nil
+	}
+
+	es.ensureActive()
+	<-reported
+	cp := <-checkpoints
+	assert.Equal(t, "000005", *cp.SequenceID)
+	cp = <-checkpoints
+	assert.Equal(t, "000005", *cp.SequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"a": "000002"}, cp.SubSources)
+	cp = <-checkpoints
+	assert.Equal(t, "000010", *cp.SequenceID)
+	assert.Nil(t, cp.LastDelivered)
+
+	// Progress is activity, but not a delivery
+	status := es.Status(ctx)
+	assert.NotNil(t, status.Statistics.LastActivityTime)
+	assert.Nil(t, status.Statistics.LastDispatchTime)
+	assert.Zero(t, status.Statistics.QueueDepth)
+
+	assert.NoError(t, es.stop(ctx, ""))
+	assert.Empty(t, checkpoints)
+}
+
+func TestProgressBatchActive(t *testing.T) {
+	_, es, _, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{eventStream: es}
+	as.filterSkipped = 5
+
+	// Not checkpointed while a batch is waiting to be delivered, but included with the checkpoint of that batch
+	as.detectProgress(&Event[testData]{EventCommon: EventCommon{SequenceID: "000005"}, progress: true}, true)
+	assert.Equal(t, streamCheckpoint{sequenceID: "000005"}, as.detectedCheckpoint)
+	assert.Equal(t, int64(5), as.filterSkipped)
+}
+
+func TestGetProgressOutsideRun(t *testing.T) {
+	assert.Equal(t, Continue, GetProgress(context.Background())("000001", ""))
+}
+
+func TestSharedSourceProgress(t *testing.T) {
+	checkpoints := make(chan *EventStreamCheckpoint, 10)
+	ctx, esm, mes, done := newSharedSourceTestManager(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, "es1").Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoints <- args[1].(*EventStreamCheckpoint)
+		})
+	})
+	defer done()
+
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		progress := GetProgress(ctx)
+		progress("000003", "")
+		progress("000001", "") // before the position of the stream
+		progress("000002", "a")
+		<-ctx.Done()
+		assert.Equal(t, Exit, progress("000004", ""))
+		return nil
+	}
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	es1, _ := newSharedSourceTestStream(t, ctx, esm, "es1")
+	as1 := es1.newActiveStream()
+	cp := <-checkpoints
+	assert.Equal(t, "000003", *cp.SequenceID)
+	cp = <-checkpoints
+	assert.Equal(t, SubSourceCheckpoints{"a": "000002"}, cp.SubSources)
+
+	as1.cancelCtx()
+	<-as1.eventLoopDone
+	<-as1.batchLoopDone
+	ss := esm.getSharedSource("shared1")
+	assert.Eventually(t, func() bool {
+		ss.mux.Lock()
+		defer ss.mux.Unlock()
+		return !ss.running
+	}, 5*time.Second, 1*time.Millisecond)
+	assert.Empty(t, checkpoints)
+}
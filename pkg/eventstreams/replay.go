@@ -0,0 +1,106 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// Replayer is implemented by the Manager returned from NewEventStreamManager, to deliver a historical range
+// of the events of a stream to an ad-hoc consumer, such as for debugging:
+//
+//	err := mgr.(eventstreams.Replayer[MyDataType]).ReplayRange(ctx, streamID, fromSeq, toSeq, deliver)
+type Replayer[DT any] interface {
+	// ReplayRange runs a temporary read of the source of the stream, from fromSeq (exclusive, in the same way
+	// as a checkpoint) to toSeq (inclusive), passing the events that match the topic filter of the stream to
+	// the deliver function. It returns once toSeq has been passed, the deliver function returns Exit, or the
+	// context is cancelled. The stream itself, its checkpoint, and any consumers are unaffected.
+	// The runtime must implement SequenceComparer, and the range applies to the SequenceID of every event
+	// regardless of its SubSource. Streams on an exclusive source (see ExclusiveSourceKeyer) cannot be replayed.
+	ReplayRange(ctx context.Context, streamID string, fromSeq, toSeq string, deliver Deliver[DT]) error
+}
+
+func (esm *esManager[CT, DT]) ReplayRange(ctx context.Context, streamID string, fromSeq, toSeq string, deliver Deliver[DT]) error {
+	es := esm.getStream(streamID)
+	if es == nil {
+		return i18n.NewError(ctx, i18n.Msg404NoResult)
+	}
+	comparer, ok := esm.runtime.(SequenceComparer)
+	if !ok {
+		return i18n.NewError(ctx, i18n.MsgESReplayUnsupported)
+	}
+	if toSeq == "" || (fromSeq != "" && comparer.CompareSequences(fromSeq, toSeq) >= 0) {
+		return i18n.NewError(ctx, i18n.MsgESInvalidReplayRange, fromSeq, toSeq)
+	}
+	// A second reader cannot be run on a source that only allows one
+	if keyer, ok := esm.runtime.(ExclusiveSourceKeyer[CT]); ok {
+		if key := keyer.ExclusiveSourceKey(es.spec); key != "" {
+			return i18n.NewError(ctx, i18n.MsgESReplayExclusiveSource, key)
+		}
+	}
+
+	ctx = log.WithLogField(ctx, "replay", streamID)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	complete := false
+	log.L(ctx).Infof("Replaying events from %s to %s", fromSeq, toSeq)
+	err := esm.runtime.Run(runCtx, es.spec, fromSeq, nil, func(events []*Event[DT]) SourceInstruction {
+		inRange := make([]*Event[DT], 0, len(events))
+		for _, event := range events {
+			if event == nil {
+				continue
+			}
+			cmp := comparer.CompareSequences(event.SequenceID, toSeq)
+			if cmp > 0 {
+				complete = true
+				break
+			}
+			if es.spec.topicFilterRegexp == nil || es.spec.topicFilterRegexp.MatchString(event.Topic) {
+				inRange = append(inRange, event)
+			}
+			if cmp == 0 {
+				complete = true
+				break
+			}
+		}
+		if len(inRange) > 0 && deliver(inRange) == Exit {
+			complete = true
+		}
+		if complete {
+			cancelRun()
+			return Exit
+		}
+		if runCtx.Err() != nil {
+			return Exit
+		}
+		return Continue
+	})
+	switch {
+	case complete:
+		log.L(ctx).Infof("Replay complete")
+		return nil
+	case ctx.Err() != nil:
+		return i18n.NewError(ctx, i18n.MsgContextCanceled)
+	case err != nil:
+		return err
+	default:
+		return i18n.NewError(ctx, i18n.MsgESSourceRunExited)
+	}
+}
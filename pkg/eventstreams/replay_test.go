@@ -0,0 +1,159 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newReplayTestStream(t *testing.T) (context.Context, *esManager[testESConfig, testData], *mockEventSource, func()) {
+	ctx, es, mes, done := newTestEventStream(t)
+	es.esm.streams[es.spec.GetID()] = es
+	es.esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		// deliver in batches of 3, starting after the checkpoint
+		var i int
+		fmt.Sscanf(checkpointSequenceId, "%d", &i)
+		for ; ; i += 3 {
+			batch := []*Event[testData]{nil}
+			for j := i + 1; j <= i+3; j++ {
+				batch = append(batch, &Event[testData]{EventCommon: EventCommon{Topic: fmt.Sprintf("topic%d", j%2), SequenceID: fmt.Sprintf("%.6d", j)}})
+			}
+			if deliver(batch) == Exit {
+				return nil
+			}
+		}
+	}
+	return ctx, es.esm, mes, done
+}
+
+func replayedSequences(t *testing.T, esm *esManager[testESConfig, testData], id, fromSeq, toSeq string) []string {
+	var seqs []string
+	err := esm.ReplayRange(context.Background(), id, fromSeq, toSeq, func(events []*Event[testData]) SourceInstruction {
+		for _, e := range events {
+			seqs = append(seqs, e.SequenceID)
+		}
+		return Continue
+	})
+	assert.NoError(t, err)
+	return seqs
+}
+
+func TestReplayRange(t *testing.T) {
+	_, esm, _, done := newReplayTestStream(t)
+	defer done()
+	var id string
+	for id = range esm.streams {
+	}
+
+	assert.Equal(t, []string{"000003", "000004", "000005", "000006", "000007"}, replayedSequences(t, esm, id, "000002", "000007"))
+	assert.Equal(t, []string{"000001", "000002", "000003"}, replayedSequences(t, esm, id, "", "000003"))
+	// The end of the range does not need to be the sequence of an event
+	assert.Equal(t, []string{"000005", "000006", "000007"}, replayedSequences(t, esm, id, "000004", "000007a"))
+
+	// The topic filter of the stream applies
+	esm.streams[id].spec.topicFilterRegexp = regexp.MustCompile("^topic1$")
+	assert.Equal(t, []string{"000003", "000005", "000007"}, replayedSequences(t, esm, id, "000002", "000008"))
+}
+
+func TestReplayRangeDeliverExit(t *testing.T) {
+	_, esm, _, done := newReplayTestStream(t)
+	defer done()
+	var id string
+	for id = range esm.streams {
+	}
+
+	calls := 0
+	err := esm.ReplayRange(context.Background(), id, "", "000100", func(events []*Event[testData]) SourceInstruction {
+		calls++
+		return Exit
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReplayRangeErrors(t *testing.T) {
+	ctx, esm, mes, done := newReplayTestStream(t)
+	defer done()
+	var id string
+	for id = range esm.streams {
+	}
+	noop := func(events []*Event[testData]) SourceInstruction { return Continue }
+
+	err := esm.ReplayRange(ctx, "unknown", "", "000001", noop)
+	assert.Regexp(t, "FF00164", err)
+
+	err = esm.ReplayRange(ctx, id, "000002", "000001", noop)
+	assert.Regexp(t, "FF00282", err)
+	err = esm.ReplayRange(ctx, id, "000001", "", noop)
+	assert.Regexp(t, "FF00282", err)
+
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		return fmt.Errorf("pop")
+	}
+	err = esm.ReplayRange(ctx, id, "", "000001", noop)
+	assert.Regexp(t, "pop", err)
+
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		return nil
+	}
+	err = esm.ReplayRange(ctx, id, "", "000001", noop)
+	assert.Regexp(t, "FF00275", err)
+
+	cancelledCtx, cancelCtx := context.WithCancel(ctx)
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		assert.Equal(t, Continue, deliver([]*Event[testData]{}))
+		cancelCtx()
+		assert.Equal(t, Exit, deliver([]*Event[testData]{}))
+		return nil
+	}
+	err = esm.ReplayRange(cancelledCtx, id, "", "000001", noop)
+	assert.Regexp(t, "FF00154", err)
+
+	esm.runtime = mes
+	err = esm.ReplayRange(ctx, id, "", "000001", noop)
+	assert.Regexp(t, "FF00281", err)
+}
+
+type mockExclusiveSequenceComparer struct {
+	*mockSequenceComparer
+}
+
+func (mesc *mockExclusiveSequenceComparer) ExclusiveSourceKey(spec *EventStreamSpec[testESConfig]) string {
+	return spec.Config.Config1
+}
+
+func TestReplayRangeExclusiveSource(t *testing.T) {
+	ctx, esm, mes, done := newReplayTestStream(t)
+	defer done()
+	var id string
+	for id = range esm.streams {
+	}
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		assert.Fail(t, "a second reader must not be run on an exclusive source")
+		return nil
+	}
+	esm.runtime = &mockExclusiveSequenceComparer{mockSequenceComparer: &mockSequenceComparer{mockEventSource: mes}}
+	esm.streams[id].spec.Config = &testESConfig{Config1: "cursor1"}
+	err := esm.ReplayRange(ctx, id, "", "000001", func(events []*Event[testData]) SourceInstruction { return Continue })
+	assert.Regexp(t, "FF00325.*cursor1", err)
+}
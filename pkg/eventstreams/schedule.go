@@ -0,0 +1,182 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"github.com/robfig/cron/v3"
+)
+
+// ActiveSchedule restricts a started stream to only deliver events during one or more recurring windows.
+// Outside of the windows the stream is suspended, and reports a status of outside_schedule.
+type ActiveSchedule struct {
+	Timezone *string         `ffstruct:"ActiveSchedule" json:"timezone,omitempty"` // IANA timezone the window start times are evaluated in (including daylight saving changes) - defaults to UTC
+	Windows  []*ActiveWindow `ffstruct:"ActiveSchedule" json:"windows"`
+
+	location *time.Location
+}
+
+// ActiveWindow is a window that starts at each time matching a standard 5 field cron expression
+// (minute, hour, day of month, month, day of week), and lasts for the duration.
+// For example, business hours are "0 9 * * MON-FRI" with a duration of "8h".
+type ActiveWindow struct {
+	Start    string             `ffstruct:"ActiveWindow" json:"start"`
+	Duration fftypes.FFDuration `ffstruct:"ActiveWindow" json:"duration"`
+
+	schedule cron.Schedule
+}
+
+// Store in DB as JSON
+func (as *ActiveSchedule) Scan(src interface{}) error {
+	return fftypes.JSONScan(src, as)
+}
+
+// Store in DB as JSON
+func (as *ActiveSchedule) Value() (driver.Value, error) {
+	return fftypes.JSONValue(as)
+}
+
+var scheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+func (as *ActiveSchedule) validate(ctx context.Context) (err error) {
+	tz := "UTC"
+	if as.Timezone != nil && *as.Timezone != "" {
+		tz = *as.Timezone
+	}
+	// "Local" would depend on the environment of the server
+	if tz == "Local" {
+		return i18n.NewError(ctx, i18n.MsgESInvalidScheduleTimezone, tz, "timezone must be explicit")
+	}
+	if as.location, err = time.LoadLocation(tz); err != nil {
+		return i18n.NewError(ctx, i18n.MsgESInvalidScheduleTimezone, tz, err)
+	}
+	if len(as.Windows) == 0 {
+		return i18n.NewError(ctx, i18n.MsgESScheduleNoWindows)
+	}
+	for _, w := range as.Windows {
+		if w == nil {
+			return i18n.NewError(ctx, i18n.MsgESScheduleNoWindows)
+		}
+		if err := w.validate(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *ActiveWindow) validate(ctx context.Context) (err error) {
+	// The timezone is set on the schedule, and fixed-interval schedules do not define windows
+	if strings.Contains(w.Start, "TZ=") || strings.HasPrefix(w.Start, "@every") {
+		return i18n.NewError(ctx, i18n.MsgESInvalidScheduleWindow, w.Start, "unsupported expression")
+	}
+	if w.schedule, err = scheduleParser.Parse(w.Start); err != nil {
+		return i18n.NewError(ctx, i18n.MsgESInvalidScheduleWindow, w.Start, err)
+	}
+	if w.Duration <= 0 {
+		return i18n.NewError(ctx, i18n.MsgESInvalidScheduleWindow, w.Start, "duration must be greater than zero")
+	}
+	return nil
+}
+
+// isActive returns true if the time falls within any of the windows. Must be validated first.
+func (as *ActiveSchedule) isActive(t time.Time) bool {
+	t = t.In(as.location)
+	for _, w := range as.Windows {
+		// The window is open if it started within the last duration
+		if !w.schedule.Next(t.Add(-time.Duration(w.Duration))).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// runScheduler applies the active schedule of each stream, until the manager is closed
+func (esm *esManager[CT, DT]) runScheduler(ctx context.Context) {
+	defer close(esm.schedulerDone)
+	ticker := time.NewTicker(esm.scheduleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			esm.mux.Lock()
+			streams := make([]*eventStream[CT, DT], 0, len(esm.streams))
+			for _, es := range esm.streams {
+				streams = append(streams, es)
+			}
+			esm.mux.Unlock()
+			for _, es := range streams {
+				es.applyStartAt(ctx, now)
+				es.applySchedule(ctx, now)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// applySchedule starts or suspends the stream when it enters or leaves its active schedule.
+// A stream that has been stopped stays stopped, until it is started again - at which point
+// it follows the schedule.
+func (es *eventStream[CT, DT]) applySchedule(ctx context.Context, now time.Time) {
+	if es.spec.ActiveSchedule == nil {
+		return
+	}
+	inSchedule := es.spec.ActiveSchedule.isActive(now)
+	es.mux.Lock()
+	if inSchedule != es.outsideSchedule || (inSchedule && es.stopping != nil) {
+		// no change, or we wait for the stop to complete before we start again
+		es.mux.Unlock()
+		return
+	}
+	es.outsideSchedule = !inSchedule
+	started := *es.spec.Status == EventStreamStatusStarted
+	es.mux.Unlock()
+
+	if !started {
+		return
+	}
+	if inSchedule {
+		log.L(es.bgCtx).Infof("Starting event stream for active schedule window")
+		es.ensureActive()
+	} else {
+		log.L(es.bgCtx).Infof("Suspending event stream outside of active schedule")
+		_ = es.requestStop(ctx)
+	}
+}
+
+// applyStartAt starts a stream that is waiting for its startAt time, once that time has arrived.
+// The start is retried on the next tick if it fails, such as when another stream holds an exclusive source.
+func (es *eventStream[CT, DT]) applyStartAt(ctx context.Context, now time.Time) {
+	es.mux.Lock()
+	startAt := es.spec.StartAt
+	due := startAt != nil && *es.spec.Status == EventStreamStatusStopped && es.stopping == nil && !now.Before(*startAt.Time())
+	es.mux.Unlock()
+	if !due {
+		return
+	}
+	log.L(es.bgCtx).Infof("Starting event stream scheduled to start at %s", startAt)
+	if err := es.esm.StartStream(ctx, es.spec.GetID()); err != nil {
+		log.L(es.bgCtx).Errorf("Failed to start event stream scheduled to start at %s: %s", startAt, err)
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func businessHours(tz string) *ActiveSchedule {
+	return &ActiveSchedule{
+		Timezone: &tz,
+		Windows: []*ActiveWindow{
+			{Start: "0 9 * * MON-FRI", Duration: fftypes.FFDuration(8 * time.Hour)},
+		},
+	}
+}
+
+func TestActiveScheduleValidate(t *testing.T) {
+	ctx := context.Background()
+
+	assert.NoError(t, (&ActiveSchedule{Windows: []*ActiveWindow{{Start: "@daily", Duration: fftypes.FFDuration(time.Hour)}}}).validate(ctx))
+	assert.NoError(t, businessHours("Europe/London").validate(ctx))
+
+	assert.Regexp(t, "FF00261.*Local", businessHours("Local").validate(ctx))
+	assert.Regexp(t, "FF00261.*Not/AZone", businessHours("Not/AZone").validate(ctx))
+	assert.Regexp(t, "FF00263", (&ActiveSchedule{}).validate(ctx))
+	assert.Regexp(t, "FF00263", (&ActiveSchedule{Windows: []*ActiveWindow{nil}}).validate(ctx))
+
+	for _, w := range []*ActiveWindow{
+		{Start: "wrong", Duration: fftypes.FFDuration(time.Hour)},
+		{Start: "0 9 * * * *", Duration: fftypes.FFDuration(time.Hour)},
+		{Start: "@every 1h", Duration: fftypes.FFDuration(time.Hour)},
+		{Start: "CRON_TZ=Asia/Tokyo 0 9 * * *", Duration: fftypes.FFDuration(time.Hour)},
+		{Start: "0 9 * * *"},
+	} {
+		err := (&ActiveSchedule{Windows: []*ActiveWindow{w}}).validate(ctx)
+		assert.Regexp(t, "FF00262", err, w.Start)
+	}
+}
+
+func TestActiveScheduleIsActive(t *testing.T) {
+	as := businessHours("America/New_York")
+	assert.NoError(t, as.validate(context.Background()))
+
+	ny, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	// Monday 3rd June 2024
+	assert.False(t, as.isActive(time.Date(2024, 6, 3, 8, 59, 0, 0, ny)))
+	assert.True(t, as.isActive(time.Date(2024, 6, 3, 9, 0, 0, 0, ny)))
+	assert.True(t, as.isActive(time.Date(2024, 6, 3, 16, 59, 0, 0, ny)))
+	assert.False(t, as.isActive(time.Date(2024, 6, 3, 17, 0, 0, 0, ny)))
+	// Saturday
+	assert.False(t, as.isActive(time.Date(2024, 6, 8, 10, 0, 0, 0, ny)))
+	// Evaluated in the schedule timezone, regardless of the zone of the time
+	assert.True(t, as.isActive(time.Date(2024, 6, 3, 14, 0, 0, 0, time.UTC)))
+	assert.False(t, as.isActive(time.Date(2024, 6, 3, 22, 0, 0, 0, time.UTC)))
+	// Daylight saving - 10am local in January is 15:00 UTC, rather than 14:00 in June
+	assert.False(t, as.isActive(time.Date(2024, 1, 8, 13, 30, 0, 0, time.UTC)))
+	assert.True(t, as.isActive(time.Date(2024, 1, 8, 14, 30, 0, 0, time.UTC)))
+}
+
+func TestActiveScheduleSerialization(t *testing.T) {
+	as := businessHours("UTC")
+	v, err := as.Value()
+	assert.NoError(t, err)
+
+	as2 := &ActiveSchedule{}
+	assert.NoError(t, as2.Scan(v))
+	assert.Equal(t, "UTC", *as2.Timezone)
+	assert.Equal(t, "0 9 * * MON-FRI", as2.Windows[0].Start)
+	assert.Equal(t, fftypes.FFDuration(8*time.Hour), as2.Windows[0].Duration)
+}
+
+func TestApplySchedule(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Maybe()
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	})
+	defer done()
+
+	es.spec.ActiveSchedule = businessHours("UTC")
+	assert.NoError(t, es.spec.ActiveSchedule.validate(ctx))
+	inWindow := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	outsideWindow := time.Date(2024, 6, 3, 18, 0, 0, 0, time.UTC)
+	isActive := func() bool {
+		es.mux.Lock()
+		defer es.mux.Unlock()
+		return es.activeState != nil
+	}
+	waitStopped := func() {
+		for es.Status(ctx).Status == EventStreamStatusStopping || isActive() {
+			time.Sleep(1 * time.Millisecond)
+		}
+	}
+
+	// Starting outside of the schedule does not activate the stream
+	es.applySchedule(ctx, outsideWindow)
+	assert.NoError(t, es.start(ctx))
+	assert.Nil(t, es.activeState)
+	assert.Equal(t, EventStreamStatusOutsideSchedule, es.Status(ctx).Status)
+
+	// Entering the window starts it
+	es.applySchedule(ctx, inWindow)
+	assert.NotNil(t, es.activeState)
+	assert.Equal(t, EventStreamStatusStarted, es.Status(ctx).Status)
+
+	// Leaving the window suspends it
+	es.applySchedule(ctx, outsideWindow)
+	waitStopped()
+	assert.Equal(t, EventStreamStatusOutsideSchedule, es.Status(ctx).Status)
+	assert.Equal(t, StopReasonSchedule, es.Status(ctx).StoppedReason)
+
+	// A manual stop wins over the schedule
+	assert.NoError(t, es.stop(ctx, ""))
+	es.applySchedule(ctx, inWindow)
+	assert.Nil(t, es.activeState)
+	assert.Equal(t, EventStreamStatusStopped, es.Status(ctx).Status)
+	assert.Equal(t, StopReasonRequested, es.Status(ctx).StoppedReason)
+
+	// ... until the stream is started again
+	assert.NoError(t, es.start(ctx))
+	assert.NotNil(t, es.activeState)
+	assert.Equal(t, EventStreamStatusStarted, es.Status(ctx).Status)
+	assert.Empty(t, es.Status(ctx).StoppedReason)
+	assert.NoError(t, es.suspend(ctx))
+}
+
+func TestApplyScheduleWaitsForStop(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	es.spec.ActiveSchedule = businessHours("UTC")
+	assert.NoError(t, es.spec.ActiveSchedule.validate(ctx))
+	es.spec.Status = ptrTo(EventStreamStatusStarted)
+	es.outsideSchedule = true
+	es.stopping = make(chan struct{})
+
+	es.applySchedule(ctx, time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC))
+	assert.True(t, es.outsideSchedule)
+
+	es.spec.ActiveSchedule = nil
+	es.applySchedule(ctx, time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC))
+	assert.True(t, es.outsideSchedule)
+}
+
+func TestApplyStartAt(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Maybe()
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.MatchedBy(func(u ffapi.Update) bool {
+			info, _ := u.Finalize()
+			for _, su := range info.SetOperations {
+				if su.Field == "startat" {
+					return true
+				}
+			}
+			return false
+		})).Return(nil).Once()
+	})
+	defer done()
+
+	startAt := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	es.spec.StartAt = ptrTo(fftypes.FFTime(startAt))
+	es.spec.StoppedReason = ptrTo(StopReasonSchedule)
+	es.esm.addStream(ctx, es)
+	assert.Equal(t, EventStreamStatusScheduled, es.Status(ctx).Status)
+	assert.Equal(t, StopReasonSchedule, es.Status(ctx).StoppedReason)
+
+	// Nothing happens until the time arrives
+	es.applyStartAt(ctx, startAt.Add(-time.Second))
+	assert.Nil(t, es.activeState)
+
+	// Then the stream is started, and the start time cleared so it applies only once
+	es.applyStartAt(ctx, startAt)
+	assert.NotNil(t, es.activeState)
+	assert.Nil(t, es.spec.StartAt)
+	assert.Equal(t, EventStreamStatusStarted, es.Status(ctx).Status)
+	assert.Empty(t, es.Status(ctx).StoppedReason)
+	es.applyStartAt(ctx, startAt)
+	assert.NoError(t, es.suspend(ctx))
+}
+
+func TestApplyStartAtFail(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("pop"))
+	})
+	defer done()
+
+	es.spec.StartAt = fftypes.Now()
+	es.esm.addStream(ctx, es)
+	es.applyStartAt(ctx, time.Now())
+	assert.Nil(t, es.activeState)
+	assert.NotNil(t, es.spec.StartAt)
+}
+
+func TestStopCancelsStartAt(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	})
+	defer done()
+
+	startAt := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)
+	es.spec.StartAt = ptrTo(fftypes.FFTime(startAt))
+	es.spec.StoppedReason = ptrTo(StopReasonSchedule)
+	es.esm.addStream(ctx, es)
+
+	err := es.esm.StopStreamWithReason(ctx, es.spec.GetID(), "maintenance")
+	assert.NoError(t, err)
+	assert.Nil(t, es.spec.StartAt)
+	assert.Equal(t, EventStreamStatusStopped, es.Status(ctx).Status)
+	assert.Equal(t, "maintenance", es.Status(ctx).StoppedReason)
+
+	// The stream is no longer started when the time arrives
+	es.applyStartAt(ctx, startAt)
+	assert.Nil(t, es.activeState)
+}
+
+func TestStopCancelsStartAtFail(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.eventStreams.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("pop"))
+	})
+	defer done()
+
+	es.spec.StartAt = fftypes.Now()
+	es.esm.addStream(ctx, es)
+	err := es.esm.StopStream(ctx, es.spec.GetID())
+	assert.Regexp(t, "pop", err)
+	assert.NotNil(t, es.spec.StartAt)
+}
+
+func TestSchedulerLoop(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil).Maybe()
+	})
+	defer done()
+
+	// Always within the window
+	es.spec.ActiveSchedule = &ActiveSchedule{Windows: []*ActiveWindow{{Start: "* * * * *", Duration: fftypes.FFDuration(time.Hour)}}}
+	assert.NoError(t, es.spec.ActiveSchedule.validate(ctx))
+	es.mux.Lock()
+	es.spec.Status = ptrTo(EventStreamStatusStarted)
+	es.outsideSchedule = true
+	es.mux.Unlock()
+	es.esm.addStream(ctx, es)
+
+	assert.Eventually(t, func() bool {
+		return es.Status(ctx).Status == EventStreamStatusStarted
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, es.suspend(ctx))
+}
@@ -0,0 +1,259 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// sharedSource runs a single Run loop of the runtime for all the active streams with the same
+// sharedSource name, and delivers each event to every stream that has not already received it.
+//
+// The Run loop starts from the earliest position of all the streams. When a stream joins, the Run
+// loop is restarted so that it can include the position of that stream, and streams that are further
+// ahead skip the events they have already received. Each stream keeps its own checkpoint, filter and
+// consumer, but the Run loop only proceeds as fast as the slowest stream accepts events.
+//
+// The spec passed to Run is that of the stream with the lowest ID, so any configuration of the
+// source itself must be the same for all streams that share it.
+type sharedSource[CT any, DT any] struct {
+	name      string
+	esm       *esManager[CT, DT]
+	comparer  SequenceComparer
+	mux       sync.Mutex
+	members   map[string]*sharedSourceMember[CT, DT]
+	running   bool
+	cancelRun context.CancelFunc
+}
+
+type sharedSourceMember[CT any, DT any] struct {
+	as *activeStream[CT, DT]
+	// the last event queued to the stream, only updated by the run loop once the stream has joined
+	position streamCheckpoint
+}
+
+func (esm *esManager[CT, DT]) getSharedSource(name string) *sharedSource[CT, DT] {
+	esm.mux.Lock()
+	defer esm.mux.Unlock()
+	ss := esm.sharedSources[name]
+	if ss == nil {
+		ss = &sharedSource[CT, DT]{
+			name:     name,
+			esm:      esm,
+			comparer: esm.runtime.(SequenceComparer), // checked when validating the stream
+			members:  map[string]*sharedSourceMember[CT, DT]{},
+		}
+		esm.sharedSources[name] = ss
+	}
+	return ss
+}
+
+func (ss *sharedSource[CT, DT]) join(as *activeStream[CT, DT], checkpoint streamCheckpoint) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ss.members[as.spec.GetID()] = &sharedSourceMember[CT, DT]{
+		as: as,
+		position: streamCheckpoint{
+			sequenceID: checkpoint.sequenceID,
+			subSources: checkpoint.subSources.copy(),
+		},
+	}
+	log.L(as.ctx).Infof("Joined shared source '%s' with checkpoint: %s subSources=%v (members=%d)", ss.name, checkpoint.sequenceID, checkpoint.subSources, len(ss.members))
+	if !ss.running {
+		ss.running = true
+		go ss.runLoop(log.WithLogField(context.WithoutCancel(as.bgCtx), "sharedsource", ss.name))
+	} else if ss.cancelRun != nil {
+		// restart the run loop, so it can start from the position of this stream
+		ss.cancelRun()
+	}
+}
+
+func (ss *sharedSource[CT, DT]) leave(as *activeStream[CT, DT]) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	delete(ss.members, as.spec.GetID())
+	if len(ss.members) == 0 && ss.cancelRun != nil {
+		ss.cancelRun()
+	}
+}
+
+func (ss *sharedSource[CT, DT]) runLoop(ctx context.Context) {
+	for {
+		stopped := false
+		// Retry will only return on a restart for a stream that joined, or when there are no streams left
+		_ = ss.esm.config.RestartRetry.Do(ctx, "shared source run loop", func(attempt int) (retry bool, err error) {
+			more, err := ss.runOnce(ctx)
+			if !more {
+				stopped = true
+				return false, nil
+			}
+			return true, err
+		})
+		if stopped {
+			log.L(ctx).Debugf("shared source run loop exiting")
+			return
+		}
+	}
+}
+
+// runOnce runs the source from the earliest position of the current streams, and returns a nil error
+// if the run loop was stopped by a stream joining or leaving
+func (ss *sharedSource[CT, DT]) runOnce(ctx context.Context) (more bool, err error) {
+	ss.mux.Lock()
+	if len(ss.members) == 0 {
+		ss.running = false
+		ss.cancelRun = nil
+		ss.mux.Unlock()
+		return false, nil
+	}
+	members := ss.memberList()
+	start := ss.startPosition(members)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+	ss.cancelRun = cancelRun
+	ss.mux.Unlock()
+
+	log.L(ctx).Infof("Initiating shared source for %d streams with checkpoint: %s subSources=%v", len(members), start.sequenceID, start.subSources)
+	progressCtx := withProgress(runCtx, func(sequenceID, subSource string) SourceInstruction {
+		return ss.progress(runCtx, sequenceID, subSource)
+	})
+	err = ss.esm.runtime.Run(progressCtx, members[0].as.spec, start.sequenceID, start.subSources, func(events []*Event[DT]) SourceInstruction {
+		return ss.deliver(runCtx, events)
+	})
+	if runCtx.Err() != nil {
+		return true, nil
+	}
+	if err == nil {
+		err = i18n.NewError(ctx, i18n.MsgESSourceRunExited)
+	}
+	return true, err
+}
+
+// memberList returns the current streams in order of ID, and must be called with the lock held
+func (ss *sharedSource[CT, DT]) memberList() []*sharedSourceMember[CT, DT] {
+	members := make([]*sharedSourceMember[CT, DT], 0, len(ss.members))
+	for _, m := range ss.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].as.spec.GetID() < members[j].as.spec.GetID() })
+	return members
+}
+
+// startPosition is the earliest position of all the streams. A named sub-source is only
+// included if every stream has a position for it, otherwise it starts from the beginning.
+func (ss *sharedSource[CT, DT]) startPosition(members []*sharedSourceMember[CT, DT]) (start streamCheckpoint) {
+	start.sequenceID = members[0].position.sequenceID
+	start.subSources = members[0].position.subSources.copy()
+	for _, m := range members[1:] {
+		if ss.before(m.position.sequenceID, start.sequenceID) {
+			start.sequenceID = m.position.sequenceID
+		}
+		for subSource, sequenceID := range start.subSources {
+			memberSequenceID, ok := m.position.subSources[subSource]
+			if !ok {
+				delete(start.subSources, subSource)
+			} else if ss.before(memberSequenceID, sequenceID) {
+				start.subSources[subSource] = memberSequenceID
+			}
+		}
+	}
+	return start
+}
+
+// before compares two sequences, where the empty sequence is before all others
+func (ss *sharedSource[CT, DT]) before(a, b string) bool {
+	if a == "" || b == "" {
+		return a == "" && b != ""
+	}
+	return ss.comparer.CompareSequences(a, b) < 0
+}
+
+func (ss *sharedSource[CT, DT]) deliver(runCtx context.Context, events []*Event[DT]) SourceInstruction {
+	log.L(runCtx).Debugf("Received batch of %d events from shared source", len(events))
+	ss.mux.Lock()
+	members := ss.memberList()
+	ss.mux.Unlock()
+
+	for _, m := range members {
+		ss.queueNewEvents(runCtx, m, events)
+	}
+
+	if runCtx.Err() != nil {
+		return Exit
+	}
+	return Continue
+}
+
+// progress is passed to each stream that is before the reported position
+func (ss *sharedSource[CT, DT]) progress(runCtx context.Context, sequenceID, subSource string) SourceInstruction {
+	ss.mux.Lock()
+	members := ss.memberList()
+	ss.mux.Unlock()
+
+	for _, m := range members {
+		if subSource == "" {
+			if ss.before(m.position.sequenceID, sequenceID) && m.as.queueProgress(runCtx, sequenceID, subSource) {
+				m.position.sequenceID = sequenceID
+			}
+		} else if ss.before(m.position.subSources[subSource], sequenceID) && m.as.queueProgress(runCtx, sequenceID, subSource) {
+			if m.position.subSources == nil {
+				m.position.subSources = SubSourceCheckpoints{}
+			}
+			m.position.subSources[subSource] = sequenceID
+		}
+	}
+
+	if runCtx.Err() != nil {
+		return Exit
+	}
+	return Continue
+}
+
+// queueNewEvents pushes the events that are after the position of the stream, and is
+// only called on the run loop so can update the position without a lock
+func (ss *sharedSource[CT, DT]) queueNewEvents(runCtx context.Context, m *sharedSourceMember[CT, DT], events []*Event[DT]) {
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+		if event.SubSource == "" {
+			if !ss.before(m.position.sequenceID, event.SequenceID) {
+				continue
+			}
+			if !m.as.queueEvent(runCtx, event) {
+				return
+			}
+			m.position.sequenceID = event.SequenceID
+		} else {
+			if !ss.before(m.position.subSources[event.SubSource], event.SequenceID) {
+				continue
+			}
+			if !m.as.queueEvent(runCtx, event) {
+				return
+			}
+			if m.position.subSources == nil {
+				m.position.subSources = SubSourceCheckpoints{}
+			}
+			m.position.subSources[event.SubSource] = event.SequenceID
+		}
+	}
+}
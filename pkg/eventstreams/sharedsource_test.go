@@ -0,0 +1,259 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockSequenceComparer struct {
+	*mockEventSource
+}
+
+func (msc *mockSequenceComparer) CompareSequences(a, b string) int {
+	return strings.Compare(a, b)
+}
+
+type sharedSourceRun struct {
+	specID     string
+	sequenceID string
+	subSources SubSourceCheckpoints
+}
+
+func newSharedSourceTestManager(t *testing.T, extraSetup ...func(mdb *mockPersistence)) (context.Context, *esManager[testESConfig, testData], *mockEventSource, func()) {
+	extraSetup = append(extraSetup, func(mdb *mockPersistence) {
+		mdb.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+	})
+	return newMockESManager(t, extraSetup...)
+}
+
+func newSharedSourceTestStream(t *testing.T, ctx context.Context, esm *esManager[testESConfig, testData], id string) (*eventStream[testESConfig, testData], chan string) {
+	es, err := esm.initEventStream(ctx, &EventStreamSpec[testESConfig]{
+		ID:           ptrTo(id),
+		Name:         ptrTo(id),
+		Status:       ptrTo(EventStreamStatusStopped),
+		SharedSource: ptrTo("shared1"),
+		BatchTimeout: ptrTo(fftypes.FFDuration(10 * time.Millisecond)),
+	})
+	assert.NoError(t, err)
+	delivered := make(chan string, 100)
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, batch *EventBatch[testData]) error {
+			for _, e := range batch.Events {
+				delivered <- fmt.Sprintf("%s%s", e.SubSource, e.SequenceID)
+			}
+			return nil
+		},
+	}
+	return es, delivered
+}
+
+func receiveN(t *testing.T, delivered chan string, n int) []string {
+	received := make([]string, n)
+	for i := range received {
+		select {
+		case received[i] = <-delivered:
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "timed out", "received %v", received[:i])
+			return received[:i]
+		}
+	}
+	return received
+}
+
+func TestSharedSourceStreams(t *testing.T) {
+	ctx, esm, mes, done := newSharedSourceTestManager(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, "es1").Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("GetByID", mock.Anything, "es2").Return(&EventStreamCheckpoint{
+			ID:         ptrTo("es2"),
+			SequenceID: ptrTo("000005"),
+			SubSources: SubSourceCheckpoints{"a": "000001"},
+		}, nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	})
+	defer done()
+
+	var runsLock sync.Mutex
+	var runs []sharedSourceRun
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		runsLock.Lock()
+		runs = append(runs, sharedSourceRun{es.GetID(), checkpointSequenceId, subSourceCheckpoints})
+		runsLock.Unlock()
+		var events []*Event[testData]
+		for i := 0; i < 10; i++ {
+			seq := fmt.Sprintf("%.6d", i)
+			if seq > checkpointSequenceId {
+				events = append(events, &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SequenceID: seq}, Data: &testData{Field1: i}})
+			}
+		}
+		for i := 0; i < 3; i++ {
+			seq := fmt.Sprintf("%.6d", i)
+			if seq > subSourceCheckpoints["a"] {
+				events = append(events, &Event[testData]{EventCommon: EventCommon{Topic: "topic1", SubSource: "a", SequenceID: seq}, Data: &testData{Field1: i}})
+			}
+		}
+		deliver(append(events, nil))
+		<-ctx.Done()
+		return nil
+	}
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	es1, delivered1 := newSharedSourceTestStream(t, ctx, esm, "es1")
+	es2, delivered2 := newSharedSourceTestStream(t, ctx, esm, "es2")
+
+	as1 := es1.newActiveStream()
+	assert.Equal(t, []string{
+		"000000", "000001", "000002", "000003", "000004", "000005", "000006", "000007", "000008", "000009",
+		"a000000", "a000001", "a000002",
+	}, receiveN(t, delivered1, 13))
+
+	// The second stream restarts the source from its earlier position, and only it receives the events again
+	as2 := es2.newActiveStream()
+	assert.Equal(t, []string{"000006", "000007", "000008", "000009", "a000002"}, receiveN(t, delivered2, 5))
+
+	runsLock.Lock()
+	assert.Len(t, runs, 2)
+	assert.Equal(t, sharedSourceRun{"es1", "", nil}, runs[0])
+	assert.Equal(t, sharedSourceRun{"es1", "000005", SubSourceCheckpoints{"a": "000001"}}, runs[1])
+	runsLock.Unlock()
+
+	as1.cancelCtx()
+	as2.cancelCtx()
+	for _, as := range []*activeStream[testESConfig, testData]{as1, as2} {
+		<-as.eventLoopDone
+		<-as.batchLoopDone
+	}
+	assert.Empty(t, delivered1)
+	assert.Empty(t, delivered2)
+
+	ss := esm.getSharedSource("shared1")
+	assert.Eventually(t, func() bool {
+		ss.mux.Lock()
+		defer ss.mux.Unlock()
+		return !ss.running
+	}, 5*time.Second, 1*time.Millisecond)
+}
+
+func TestSharedSourceRunRestart(t *testing.T) {
+	ctx, esm, mes, done := newSharedSourceTestManager(t, func(mdb *mockPersistence) {
+		RetrySection.Set(retry.ConfigMaximumDelay, "1ms")
+		RestartRetrySection.Set(retry.ConfigMaximumDelay, "1ms")
+		mdb.checkpoints.On("GetByID", mock.Anything, "es1").Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+
+	runs := make(chan bool, 3)
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		runs <- true
+		switch len(runs) {
+		case 1:
+			return fmt.Errorf("pop")
+		case 2:
+			return nil
+		}
+		<-ctx.Done()
+		return nil
+	}
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	es1, _ := newSharedSourceTestStream(t, ctx, esm, "es1")
+	as1 := es1.newActiveStream()
+	assert.Eventually(t, func() bool { return len(runs) == 3 }, 5*time.Second, 1*time.Millisecond)
+	as1.cancelCtx()
+	<-as1.eventLoopDone
+}
+
+func TestSharedSourceStartPosition(t *testing.T) {
+	_, esm, mes, done := newSharedSourceTestManager(t)
+	defer done()
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	ss := esm.getSharedSource("shared1")
+	member := func(id, seq string, subSources SubSourceCheckpoints) *sharedSourceMember[testESConfig, testData] {
+		return &sharedSourceMember[testESConfig, testData]{
+			as:       &activeStream[testESConfig, testData]{eventStream: &eventStream[testESConfig, testData]{spec: &EventStreamSpec[testESConfig]{ID: ptrTo(id)}}},
+			position: streamCheckpoint{sequenceID: seq, subSources: subSources},
+		}
+	}
+
+	start := ss.startPosition([]*sharedSourceMember[testESConfig, testData]{
+		member("es1", "000003", SubSourceCheckpoints{"a": "000002", "b": "000001"}),
+		member("es2", "000001", SubSourceCheckpoints{"a": "000003"}),
+		member("es3", "000002", SubSourceCheckpoints{"a": "000001"}),
+	})
+	assert.Equal(t, streamCheckpoint{sequenceID: "000001", subSources: SubSourceCheckpoints{"a": "000001"}}, start)
+
+	start = ss.startPosition([]*sharedSourceMember[testESConfig, testData]{
+		member("es1", "000003", nil),
+		member("es2", "", nil),
+	})
+	assert.Equal(t, streamCheckpoint{}, start)
+}
+
+func TestSharedSourceValidation(t *testing.T) {
+	ctx, esm, mes, done := newSharedSourceTestManager(t)
+	defer done()
+
+	spec := &EventStreamSpec[testESConfig]{
+		Name:         ptrTo("stream1"),
+		SharedSource: ptrTo("shared1"),
+	}
+	err := esm.validateStream(ctx, spec, true)
+	assert.Regexp(t, "FF00280", err)
+
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+	assert.NoError(t, esm.validateStream(ctx, spec, true))
+
+	spec.SharedSource = ptrTo("!bad")
+	err = esm.validateStream(ctx, spec, true)
+	assert.Regexp(t, "FF00140.*sharedSource", err)
+}
+
+func TestSharedSourceDeliverStopped(t *testing.T) {
+	_, esm, mes, done := newSharedSourceTestManager(t)
+	defer done()
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	ss := esm.getSharedSource("shared1")
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	ss.members["es1"] = &sharedSourceMember[testESConfig, testData]{
+		as: &activeStream[testESConfig, testData]{
+			eventStream: &eventStream[testESConfig, testData]{spec: &EventStreamSpec[testESConfig]{ID: ptrTo("es1")}},
+			ctx:         ctx,
+			events:      make(chan *Event[testData]),
+			EventStreamStatistics: EventStreamStatistics{
+				backlog: &streamBacklog{},
+			},
+		},
+	}
+
+	assert.Equal(t, Exit, ss.deliver(ctx, []*Event[testData]{{EventCommon: EventCommon{SequenceID: "000001"}}}))
+	assert.Equal(t, Exit, ss.deliver(ctx, []*Event[testData]{{EventCommon: EventCommon{SubSource: "a", SequenceID: "000001"}}}))
+	assert.Equal(t, streamCheckpoint{}, ss.members["es1"].position)
+}
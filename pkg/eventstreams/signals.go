@@ -0,0 +1,86 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// HandleSignals is an opt-in helper for applications that do not manage signals themselves.
+// It installs a handler for SIGTERM and SIGINT that drains all running streams - delivering
+// and checkpointing the batch each is assembling - then closes the manager, all within the
+// configured shutdownTimeout. The returned channel is closed once that is complete, or the
+// context is cancelled, and the application should exit when it is closed.
+//
+// Only the first call installs the handler, and later calls return the same channel.
+// The default handling of the signals is restored when the context is cancelled, or once
+// a signal has been received - so a second signal terminates the process immediately.
+func (esm *esManager[CT, DT]) HandleSignals(ctx context.Context) <-chan struct{} {
+	esm.signalsOnce.Do(func() {
+		esm.signalsDone = make(chan struct{})
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT)
+		go esm.signalHandler(ctx, sigs)
+	})
+	return esm.signalsDone
+}
+
+func (esm *esManager[CT, DT]) signalHandler(ctx context.Context, sigs chan os.Signal) {
+	defer close(esm.signalsDone)
+	select {
+	case <-ctx.Done():
+		signal.Stop(sigs)
+		log.L(ctx).Debugf("Event stream signal handler removed")
+	case sig := <-sigs:
+		signal.Stop(sigs)
+		log.L(ctx).Infof("Received %s signal - draining event streams", sig)
+		shutdownCtx, cancel := ctx, func() {}
+		if timeout := time.Duration(esm.config.ShutdownTimeout); timeout > 0 {
+			shutdownCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
+		defer cancel()
+		esm.drain(shutdownCtx)
+		esm.Close(shutdownCtx)
+		log.L(ctx).Infof("Event streams closed")
+	}
+}
+
+func (esm *esManager[CT, DT]) drain(ctx context.Context) {
+	esm.mux.Lock()
+	streams := make([]*eventStream[CT, DT], 0, len(esm.streams))
+	for _, es := range esm.streams {
+		streams = append(streams, es)
+	}
+	esm.mux.Unlock()
+	// streams drain in parallel, so one that is blocked does not use the time of the others
+	var wg sync.WaitGroup
+	for _, es := range streams {
+		wg.Add(1)
+		go func(es *eventStream[CT, DT]) {
+			defer wg.Done()
+			es.drain(ctx)
+		}(es)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,130 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestHandleSignalsDrain(t *testing.T) {
+	var checkpoint *EventStreamCheckpoint
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+		mdb.checkpoints.On("Upsert", mock.Anything, mock.Anything, mock.Anything).Return(false, nil).Run(func(args mock.Arguments) {
+			checkpoint = args[1].(*EventStreamCheckpoint)
+		})
+	})
+	defer done()
+
+	es.spec.BatchSize = ptrTo(10)
+	es.spec.BatchTimeout = ptrTo(fftypes.FFDuration(1 * time.Hour))
+	es.esm.config.ShutdownTimeout = fftypes.FFDuration(10 * time.Second)
+	sourceDelivered := make(chan struct{})
+	mes.run = func(ctx context.Context, es *EventStreamSpec[testESConfig], checkpointSequenceId string, subSourceCheckpoints SubSourceCheckpoints, deliver Deliver[testData]) error {
+		deliver([]*Event[testData]{
+			{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000001"}, Data: &testData{Field1: 1}},
+			{EventCommon: EventCommon{Topic: "topic1", SequenceID: "000002"}, Data: &testData{Field1: 2}},
+		})
+		close(sourceDelivered)
+		<-ctx.Done()
+		return nil
+	}
+	var dispatched []*Event[testData]
+	es.action = &mockAction{
+		attemptDispatch: func(ctx context.Context, attempt int, batch *EventBatch[testData]) error {
+			dispatched = append(dispatched, batch.Events...)
+			return nil
+		},
+	}
+
+	es.esm.addStream(ctx, es)
+	es.ensureActive()
+	<-sourceDelivered
+
+	signalsDone := es.esm.HandleSignals(ctx)
+	assert.Equal(t, signalsDone, es.esm.HandleSignals(ctx))
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	assert.NoError(t, err)
+	<-signalsDone
+
+	// the partial batch was delivered and checkpointed, rather than waiting for the batch timeout
+	assert.Len(t, dispatched, 2)
+	assert.Equal(t, "000002", *checkpoint.SequenceID)
+	assert.Nil(t, es.activeState)
+}
+
+func TestHandleSignalsContextCancelled(t *testing.T) {
+	_, es, _, done := newTestEventStream(t)
+	defer done()
+
+	esm := es.esm
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	signalsDone := esm.HandleSignals(ctx)
+	cancelCtx()
+	<-signalsDone
+}
+
+func TestDrainStoppedStream(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	es.drain(ctx)
+
+	es.activeState = &activeStream[testESConfig, testData]{}
+	es.stopping = make(chan struct{})
+	es.drain(ctx)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	es.activeState = &activeStream[testESConfig, testData]{
+		eventStream:    es,
+		drainRequested: make(chan struct{}),
+		drained:        make(chan struct{}),
+		batchLoopDone:  make(chan struct{}),
+	}
+	ctx, cancelCtx := context.WithCancel(ctx)
+	cancelCtx()
+	es.drain(ctx)
+	assert.NotPanics(t, func() { es.drain(ctx) })
+}
+
+func TestWaitCheckpointsIdleStopped(t *testing.T) {
+	ctx, es, _, done := newTestEventStream(t)
+	defer done()
+
+	as := &activeStream[testESConfig, testData]{
+		eventStream:          es,
+		dispatchedCheckpoint: &streamCheckpoint{},
+	}
+	as.ctx, as.cancelCtx = context.WithCancel(ctx)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		as.cancelCtx()
+	}()
+	as.waitCheckpointsIdle()
+}
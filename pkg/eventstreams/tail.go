@@ -0,0 +1,93 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// MaxTailEvents is the largest number of events that can be requested from TailStream
+const MaxTailEvents = 1000
+
+// ErrTailNotSupported is the cause of the error returned by TailStream when the runtime does not implement
+// EventTailer, and can be returned by an EventTailer that cannot read a particular stream. Check for it
+// with errors.Is
+var ErrTailNotSupported = errors.New("tail not supported")
+
+// Tailer is implemented by the Manager returned from NewEventStreamManager, to peek at the events
+// the source of a stream is producing without attaching a consumer, such as for debugging:
+//
+//	events, err := mgr.(eventstreams.Tailer[MyDataType]).TailStream(ctx, streamID, 10)
+type Tailer[DT any] interface {
+	// TailStream returns up to n of the most recent events of the source of the stream, around its stored
+	// checkpoint. It is read-only - nothing is delivered, and the checkpoint does not move. The runtime
+	// must implement EventTailer, otherwise an FF00294 error wrapping ErrTailNotSupported is returned.
+	TailStream(ctx context.Context, streamID string, n int) ([]*Event[DT], error)
+}
+
+// EventTailer can optionally be implemented by the runtime to support TailStream. It is passed the stored
+// checkpoint of the stream (empty if there is none), and returns up to n events at or near that position,
+// oldest first, without affecting the stream. Runtimes that cannot read at arbitrary positions should not
+// implement it, or return ErrTailNotSupported for the streams they cannot read.
+type EventTailer[ConfigType any, DataType any] interface {
+	TailEvents(ctx context.Context, spec *EventStreamSpec[ConfigType], checkpointSequenceID string, subSourceCheckpoints SubSourceCheckpoints, n int) ([]*Event[DataType], error)
+}
+
+func (esm *esManager[CT, DT]) TailStream(ctx context.Context, streamID string, n int) ([]*Event[DT], error) {
+	es := esm.getStream(streamID)
+	if es == nil {
+		return nil, i18n.NewError(ctx, i18n.Msg404NoResult)
+	}
+	tailer, ok := esm.runtime.(EventTailer[CT, DT])
+	if !ok {
+		return nil, i18n.WrapError(ctx, ErrTailNotSupported, i18n.MsgESTailUnsupported)
+	}
+	if n < 1 || n > MaxTailEvents {
+		return nil, i18n.NewError(ctx, i18n.MsgESInvalidTailCount, n, MaxTailEvents)
+	}
+
+	cp, err := esm.persistence.Checkpoints().GetByID(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+	es.mux.Lock()
+	spec := es.spec
+	es.mux.Unlock()
+	var checkpointSequenceID string
+	var subSources SubSourceCheckpoints
+	if cp != nil && cp.SequenceID != nil {
+		checkpointSequenceID = *cp.SequenceID
+	} else if spec.InitialSequenceID != nil {
+		checkpointSequenceID = *spec.InitialSequenceID
+	}
+	if cp != nil {
+		subSources = cp.SubSources.copy()
+	}
+	log.L(ctx).Debugf("Tailing %d events of stream '%s' at checkpoint '%s'", n, streamID, checkpointSequenceID)
+	events, err := tailer.TailEvents(ctx, spec, checkpointSequenceID, subSources, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > n {
+		events = events[len(events)-n:]
+	}
+	return events, nil
+}
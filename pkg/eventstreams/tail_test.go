@@ -0,0 +1,125 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstreams
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockEventTailer struct {
+	*mockEventSource
+	checkpointSequenceID string
+	subSources           SubSourceCheckpoints
+	count                int
+	err                  error
+}
+
+func (met *mockEventTailer) TailEvents(ctx context.Context, spec *EventStreamSpec[testESConfig], checkpointSequenceID string, subSourceCheckpoints SubSourceCheckpoints, n int) ([]*Event[testData], error) {
+	met.checkpointSequenceID, met.subSources = checkpointSequenceID, subSourceCheckpoints
+	var from int
+	fmt.Sscanf(checkpointSequenceID, "%d", &from)
+	events := make([]*Event[testData], 0, met.count)
+	for i := from - met.count + 1; i <= from; i++ {
+		events = append(events, &Event[testData]{EventCommon: EventCommon{SequenceID: fmt.Sprintf("%.6d", i)}})
+	}
+	return events, met.err
+}
+
+func TestTailStream(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return(&EventStreamCheckpoint{
+			SequenceID: ptrTo("000010"),
+			SubSources: SubSourceCheckpoints{"a": "000009"},
+		}, nil)
+	})
+	defer done()
+	esm := es.esm
+	esm.streams[es.spec.GetID()] = es
+	tailer := &mockEventTailer{mockEventSource: mes, count: 3}
+	esm.runtime = tailer
+
+	events, err := esm.TailStream(ctx, es.spec.GetID(), 3)
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+	assert.Equal(t, "000008", events[0].SequenceID)
+	assert.Equal(t, "000010", events[2].SequenceID)
+	assert.Equal(t, "000010", tailer.checkpointSequenceID)
+	assert.Equal(t, SubSourceCheckpoints{"a": "000009"}, tailer.subSources)
+
+	// No more than n are returned, even if the runtime returns more
+	tailer.count = 5
+	events, err = esm.TailStream(ctx, es.spec.GetID(), 2)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "000009", events[0].SequenceID)
+
+	tailer.err = fmt.Errorf("pop")
+	_, err = esm.TailStream(ctx, es.spec.GetID(), 2)
+	assert.Regexp(t, "pop", err)
+
+	// Runtimes can report streams they cannot read with the same error
+	tailer.err = ErrTailNotSupported
+	_, err = esm.TailStream(ctx, es.spec.GetID(), 2)
+	assert.ErrorIs(t, err, ErrTailNotSupported)
+}
+
+func TestTailStreamInitialSequence(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), nil)
+	})
+	defer done()
+	esm := es.esm
+	esm.streams[es.spec.GetID()] = es
+	es.spec.InitialSequenceID = ptrTo("000005")
+	tailer := &mockEventTailer{mockEventSource: mes, count: 1}
+	esm.runtime = tailer
+
+	events, err := esm.TailStream(ctx, es.spec.GetID(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "000005", events[0].SequenceID)
+	assert.Nil(t, tailer.subSources)
+}
+
+func TestTailStreamErrors(t *testing.T) {
+	ctx, es, mes, done := newTestEventStream(t, func(mdb *mockPersistence) {
+		mdb.checkpoints.On("GetByID", mock.Anything, mock.Anything).Return((*EventStreamCheckpoint)(nil), fmt.Errorf("pop"))
+	})
+	defer done()
+	esm := es.esm
+	esm.streams[es.spec.GetID()] = es
+
+	_, err := esm.TailStream(ctx, "unknown", 1)
+	assert.Regexp(t, "FF00164", err)
+
+	_, err = esm.TailStream(ctx, es.spec.GetID(), 1)
+	assert.Regexp(t, "FF00294", err)
+	assert.ErrorIs(t, err, ErrTailNotSupported)
+
+	esm.runtime = &mockEventTailer{mockEventSource: mes}
+	_, err = esm.TailStream(ctx, es.spec.GetID(), 0)
+	assert.Regexp(t, "FF00295", err)
+	_, err = esm.TailStream(ctx, es.spec.GetID(), MaxTailEvents+1)
+	assert.Regexp(t, "FF00295", err)
+
+	_, err = esm.TailStream(ctx, es.spec.GetID(), 1)
+	assert.Regexp(t, "pop", err)
+}
@@ -19,6 +19,8 @@ package eventstreams
 import (
 	"context"
 	"database/sql/driver"
+	"sync"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
@@ -34,7 +36,9 @@ var (
 )
 
 type WebSocketConfig struct {
-	DistributionMode *DistributionMode `ffstruct:"wsconfig" json:"distributionMode,omitempty"`
+	DistributionMode *DistributionMode `ffstruct:"wsconfig" json:"distributionMode,omitempty" ffenum:"distmode"`
+	PayloadEncoding  *PayloadEncoding  `ffstruct:"wsconfig" json:"payloadEncoding,omitempty" ffenum:"payloadencoding"`
+	AllowResume      *bool             `ffstruct:"wsconfig" json:"allowResume,omitempty"` // consumers can supply the last event they processed on start, to skip re-delivery of it
 }
 
 // Store in DB as JSON
@@ -51,21 +55,201 @@ func (wc *WebSocketConfig) Value() (driver.Value, error) {
 }
 
 func (wc *WebSocketConfig) validate(ctx context.Context, defaults *ConfigWebsocketDefaults, setDefaults bool) error {
-	return checkSet(ctx, setDefaults, "distributionMode", &wc.DistributionMode, defaults.DefaultDistributionMode, func(v fftypes.FFEnum) bool { return fftypes.FFEnumValid(ctx, "distmode", v) })
+	if err := checkSetEnum(ctx, setDefaults, "distributionMode", &wc.DistributionMode, defaults.DefaultDistributionMode, "distmode"); err != nil {
+		return err
+	}
+	if setDefaults && wc.AllowResume == nil {
+		allowResume := defaults.AllowResume
+		wc.AllowResume = &allowResume
+	}
+	return checkSetEnum(ctx, setDefaults, "payloadEncoding", &wc.PayloadEncoding, PayloadEncodingJSON, "payloadencoding")
 }
 
 type webSocketAction[DT any] struct {
 	topic      string
 	spec       *WebSocketConfig
 	wsChannels wsserver.WebSocketChannels
+	ackTimeout time.Duration
+
+	// the offsets consumers supplied with resumeFrom, which apply to the next batch sent to each of them
+	comparer  SequenceComparer
+	resumeMux sync.Mutex
+	resumes   map[string]*consumerResume
+
+	// how long to wait before offering a batch again, when it did not fit the credit of the consumer that took it
+	creditRetryDelay time.Duration
+}
+
+// consumerResume is the last event a consumer has processed. It only applies up to the next checkpoint
+// boundary - so to the first batch sent to the consumer after it resumes (and any retry of that batch),
+// which is the batch that was in flight when the consumer stopped. An offset beyond the end of that batch
+// is clamped to it, so a consumer can never skip events the stream has not yet sent it.
+type consumerResume struct {
+	resumeFrom  string
+	batchNumber int64 // the batch the offset applies to, once one has been sent to the consumer
 }
 
-func newWebSocketAction[DT any](wsChannels wsserver.WebSocketChannels, spec *WebSocketConfig, topic string) *webSocketAction[DT] {
-	return &webSocketAction[DT]{
+func newWebSocketAction[DT any](wsChannels wsserver.WebSocketChannels, spec *WebSocketConfig, topic string, ackTimeout *fftypes.FFDuration) *webSocketAction[DT] {
+	w := &webSocketAction[DT]{
 		spec:       spec,
 		wsChannels: wsChannels,
 		topic:      topic,
+		resumes:    make(map[string]*consumerResume),
+
+		creditRetryDelay: 100 * time.Millisecond,
+	}
+	if ackTimeout != nil {
+		w.ackTimeout = time.Duration(*ackTimeout)
+	}
+	return w
+}
+
+// resume records the sequence of the last event a consumer has processed, before it starts listening
+func (w *webSocketAction[DT]) resume(consumerID, resumeFrom string) {
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+	// consumers that have disconnected before being sent a batch no longer need their offsets
+	if lister, ok := w.wsChannels.(wsserver.StreamConsumerLister); ok {
+		connected := map[string]bool{}
+		for _, c := range lister.StreamConsumers(w.topic) {
+			connected[c.ID] = true
+		}
+		for id := range w.resumes {
+			if !connected[id] {
+				delete(w.resumes, id)
+			}
+		}
+	}
+	w.resumes[consumerID] = &consumerResume{resumeFrom: resumeFrom}
+}
+
+// skipProcessed returns the batch without the events up to the resumeFrom offset of the consumer,
+// or nil if the consumer has already processed the whole batch. Batches transformed by the runtime
+// cannot be trimmed, so are sent in full unless the consumer has processed all of the events.
+func (w *webSocketAction[DT]) skipProcessed(consumerID string, batch *EventBatch[DT]) *EventBatch[DT] {
+	w.resumeMux.Lock()
+	defer w.resumeMux.Unlock()
+	r := w.resumes[consumerID]
+	if r == nil || len(batch.Events) == 0 {
+		return batch
+	}
+	if r.batchNumber == 0 {
+		r.batchNumber = batch.BatchNumber
+	} else if r.batchNumber != batch.BatchNumber {
+		// the consumer has been sent the batch the offset applied to
+		delete(w.resumes, consumerID)
+		return batch
+	}
+	if w.comparer.CompareSequences(batch.Events[len(batch.Events)-1].SequenceID, r.resumeFrom) <= 0 {
+		return nil
+	}
+	if batch.Payload != nil {
+		return batch
+	}
+	trimmed := *batch
+	trimmed.Events = make([]*Event[DT], 0, len(batch.Events))
+	for _, event := range batch.Events {
+		if w.comparer.CompareSequences(event.SequenceID, r.resumeFrom) > 0 {
+			trimmed.Events = append(trimmed.Events, event)
+		}
+	}
+	return &trimmed
+}
+
+// consumerBatch is offered on the channels of the stream, and built for each consumer that takes it
+// from the events that consumer has not already processed
+type consumerBatch[DT any] struct {
+	ctx    context.Context
+	action *webSocketAction[DT]
+	batch  *EventBatch[DT]
+	msg    interface{} // the message for the whole batch, for consumers that have not resumed part way through it
+
+	// the result for the first consumer that took the batch
+	takeOnce sync.Once
+	taken    chan struct{}
+	sent     *EventBatch[DT] // the events sent, nil if the consumer had processed them all or the batch was declined
+	rest     *EventBatch[DT] // the events beyond the credit of the consumer, to send once it acknowledges the rest
+	declined bool            // the consumer did not have credit for any of the batch
+}
+
+func (w *webSocketAction[DT]) newConsumerBatch(ctx context.Context, batch *EventBatch[DT]) (cb *consumerBatch[DT], err error) {
+	cb = &consumerBatch[DT]{
+		ctx:    ctx,
+		action: w,
+		batch:  batch,
+		taken:  make(chan struct{}),
+	}
+	cb.msg, err = w.encode(ctx, batch)
+	return cb, err
+}
+
+// encode returns the message for a batch. JSON batches are marshaled by the WebSocket server, and other
+// encodings sent as binary.
+func (w *webSocketAction[DT]) encode(ctx context.Context, batch *EventBatch[DT]) (interface{}, error) {
+	if w.spec.PayloadEncoding == nil || *w.spec.PayloadEncoding == PayloadEncodingJSON {
+		return batch, nil
+	}
+	data, err := encodePayload(ctx, *w.spec.PayloadEncoding, batch)
+	if err != nil {
+		return nil, err
+	}
+	return &wsserver.WebSocketEncodedMessage{Binary: true, Data: data}, nil
+}
+
+// MessageFor is called by the WebSocket server for each consumer that takes the batch. The batch is limited
+// to the credit of the consumer if it advertises it. Batches transformed by the runtime cannot be split, so are
+// declined unless the consumer has credit for the whole batch.
+func (cb *consumerBatch[DT]) MessageFor(consumerID string, credit *int) (interface{}, int) {
+	toSend := cb.action.skipProcessed(consumerID, cb.batch)
+	var rest *EventBatch[DT]
+	declined := false
+	if toSend != nil && credit != nil && *credit < len(toSend.Events) {
+		if *credit <= 0 || toSend.Payload != nil {
+			toSend, declined = nil, true
+		} else {
+			part, remaining := *toSend, *toSend
+			part.Events = toSend.Events[:*credit]
+			remaining.Events = toSend.Events[*credit:]
+			toSend, rest = &part, &remaining
+		}
+	}
+	cb.takeOnce.Do(func() {
+		cb.sent, cb.rest, cb.declined = toSend, rest, declined
+		close(cb.taken)
+	})
+
+	switch {
+	case declined:
+		log.L(cb.ctx).Debugf("WebSocket event batch %d declined by consumer %s, as it has credit %d (len=%d)", cb.batch.BatchNumber, consumerID, *credit, len(cb.batch.Events))
+		return nil, 0
+	case toSend == nil:
+		log.L(cb.ctx).Infof("WebSocket event batch %d skipped for consumer %s, as already processed (len=%d)", cb.batch.BatchNumber, consumerID, len(cb.batch.Events))
+		return nil, 0
+	case toSend == cb.batch:
+		return cb.msg, len(toSend.Events)
+	default:
+		// the batch encoded without error, so the events within it do as well
+		msg, _ := cb.action.encode(cb.ctx, toSend)
+		return msg, len(toSend.Events)
+	}
+}
+
+// capacity returns the most events any consumer of the stream can accept now, if they all advertise it
+func (w *webSocketAction[DT]) capacity() (events int, advertised bool) {
+	lister, ok := w.wsChannels.(wsserver.StreamConsumerLister)
+	if !ok {
+		return 0, false
+	}
+	for _, c := range lister.StreamConsumers(w.topic) {
+		if c.Credit == nil {
+			return 0, false
+		}
+		if !advertised || *c.Credit > events {
+			events = *c.Credit
+		}
+		advertised = true
 	}
+	return events, advertised
 }
 
 func (w *webSocketAction[DT]) AttemptDispatch(ctx context.Context, attempt int, batch *EventBatch[DT]) error {
@@ -82,17 +266,42 @@ func (w *webSocketAction[DT]) AttemptDispatch(ctx context.Context, attempt int,
 		channel = sender
 	}
 
-	// Send the batch of events
-	select {
-	case channel <- batch:
-		break
-	case <-ctx.Done():
-		err = i18n.NewError(ctx, i18n.MsgWebSocketInterruptedSend)
-	}
-
-	if err == nil && !isBroadcast {
-		log.L(ctx).Infof("Batch %d dispatched (len=%d,attempt=%d)", batch.BatchNumber, len(batch.Events), attempt)
-		err = w.waitForAck(ctx, receiver, batch.BatchNumber)
+	// Send the batch of events, built for each consumer from the events it has not already processed.
+	// A load balanced batch is sent in parts, if the consumer advertises less credit than the batch.
+	for remaining := batch; remaining != nil && err == nil; {
+		var cb *consumerBatch[DT]
+		if cb, err = w.newConsumerBatch(ctx, remaining); err != nil {
+			return err
+		}
+		select {
+		case channel <- cb:
+		case <-ctx.Done():
+			return i18n.NewError(ctx, i18n.MsgWebSocketInterruptedSend)
+		}
+		if isBroadcast {
+			break
+		}
+		select {
+		case <-cb.taken:
+		case <-ctx.Done():
+			return i18n.NewError(ctx, i18n.MsgWebSocketInterruptedSend)
+		}
+		switch {
+		case cb.declined:
+			// offer the batch again, once a consumer might have more credit
+			select {
+			case <-time.After(w.creditRetryDelay):
+			case <-ctx.Done():
+				err = i18n.NewError(ctx, i18n.MsgWebSocketInterruptedSend)
+			}
+		case cb.sent == nil:
+			// the consumer that took the batch has already processed it, so will not acknowledge it
+			remaining = nil
+		default:
+			log.L(ctx).Infof("Batch %d dispatched (len=%d,attempt=%d)", batch.BatchNumber, len(cb.sent.Events), attempt)
+			err = w.waitForAck(ctx, receiver, batch.BatchNumber)
+			remaining = cb.rest
+		}
 	}
 
 	// Pass back any exception due
@@ -105,6 +314,12 @@ func (w *webSocketAction[DT]) AttemptDispatch(ctx context.Context, attempt int,
 }
 
 func (w *webSocketAction[DT]) waitForAck(ctx context.Context, receiver <-chan *wsserver.WebSocketCommandMessageOrError, batchNumber int64) error {
+	var timeout <-chan time.Time
+	if w.ackTimeout > 0 {
+		timer := time.NewTimer(w.ackTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 	// Wait for the next ack or exception
 	for {
 		select {
@@ -119,6 +334,13 @@ func (w *webSocketAction[DT]) waitForAck(ctx context.Context, receiver <-chan *w
 			}
 			log.L(ctx).Infof("Batch %d acknowledged", batchNumber)
 			return nil
+		case <-timeout:
+			// The consumer has the batch, but might be stuck. Disconnecting it means the batch
+			// is redelivered to the next consumer that is available, rather than the same one
+			if d, ok := w.wsChannels.(wsserver.StreamConsumerDisconnector); ok {
+				d.DisconnectStreamConsumer(w.topic)
+			}
+			return i18n.NewError(ctx, i18n.MsgWebSocketAckTimeout, w.ackTimeout, batchNumber)
 		case <-ctx.Done():
 			return i18n.NewError(ctx, i18n.MsgWebSocketInterruptedReceive)
 		}
@@ -19,12 +19,18 @@ package eventstreams
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/firefly-common/mocks/wsservermocks"
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/metric"
 	"github.com/hyperledger/firefly-common/pkg/wsserver"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func mockWSChannels(wsc *wsservermocks.WebSocketChannels) (chan interface{}, chan interface{}, chan *wsserver.WebSocketCommandMessageOrError) {
@@ -35,6 +41,12 @@ func mockWSChannels(wsc *wsservermocks.WebSocketChannels) (chan interface{}, cha
 	return senderChannel, broadcastChannel, receiverChannel
 }
 
+// receiveAs takes the next message from a channel, as the consumer with the supplied ID
+func receiveAs(ch chan interface{}, consumerID string) interface{} {
+	msg, _ := (<-ch).(wsserver.ConsumerMessage).MessageFor(consumerID, nil)
+	return msg
+}
+
 func TestWSAttemptIgnoreWrongAcks(t *testing.T) {
 
 	mws := &wsservermocks.WebSocketChannels{}
@@ -52,7 +64,7 @@ func TestWSAttemptIgnoreWrongAcks(t *testing.T) {
 	dmw := DistributionModeBroadcast
 	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
 		DistributionMode: &dmw,
-	}, "ut_stream")
+	}, "ut_stream", nil)
 
 	err := wsa.AttemptDispatch(context.Background(), 0, &EventBatch[testData]{
 		StreamID:    fftypes.NewUUID().String(),
@@ -76,7 +88,7 @@ func TestWSattemptDispatchExitPushingEvent(t *testing.T) {
 	dmw := DistributionModeBroadcast
 	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
 		DistributionMode: &dmw,
-	}, "ut_stream")
+	}, "ut_stream", nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -99,7 +111,7 @@ func TestWSattemptDispatchExitReceivingReply(t *testing.T) {
 	dmw := DistributionModeBroadcast
 	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
 		DistributionMode: &dmw,
-	}, "ut_stream")
+	}, "ut_stream", nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
@@ -108,6 +120,21 @@ func TestWSattemptDispatchExitReceivingReply(t *testing.T) {
 
 }
 
+func TestWSWaitForAckTimeout(t *testing.T) {
+
+	mws := &wsservermocks.WebSocketChannels{}
+	_, _, rc := mockWSChannels(mws)
+
+	dmw := DistributionModeLoadBalance
+	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
+		DistributionMode: &dmw,
+	}, "ut_stream", ptrTo(fftypes.FFDuration(1*time.Millisecond)))
+
+	err := wsa.waitForAck(context.Background(), rc, 1)
+	assert.Regexp(t, "FF00274", err)
+
+}
+
 func TestWSattemptDispatchNackFromClient(t *testing.T) {
 
 	mws := &wsservermocks.WebSocketChannels{}
@@ -119,9 +146,433 @@ func TestWSattemptDispatchNackFromClient(t *testing.T) {
 	dmw := DistributionModeBroadcast
 	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
 		DistributionMode: &dmw,
-	}, "ut_stream")
+	}, "ut_stream", nil)
 
 	err := wsa.waitForAck(context.Background(), rc, -1)
 	assert.Regexp(t, "pop", err)
 
 }
+
+func TestWSAttemptDispatchEncodedPayload(t *testing.T) {
+
+	mws := &wsservermocks.WebSocketChannels{}
+	sc, _, rc := mockWSChannels(mws)
+	rc <- &wsserver.WebSocketCommandMessageOrError{Msg: &wsserver.WebSocketCommandMessage{
+		BatchNumber: 1,
+	}}
+
+	dmw := DistributionModeLoadBalance
+	enc := PayloadEncodingCBOR
+	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
+		DistributionMode: &dmw,
+		PayloadEncoding:  &enc,
+	}, "ut_stream", nil)
+
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- wsa.AttemptDispatch(context.Background(), 0, &EventBatch[testData]{
+			StreamID:    fftypes.NewUUID().String(),
+			BatchNumber: 1,
+			Events: []*Event[testData]{
+				{Data: &testData{Field1: 12345}},
+			},
+		})
+	}()
+
+	msg := receiveAs(sc, "c1").(*wsserver.WebSocketEncodedMessage)
+	assert.True(t, msg.Binary)
+	assert.NotEmpty(t, msg.Data)
+	assert.NoError(t, <-dispatched)
+}
+
+func TestWSAttemptDispatchEncodeFail(t *testing.T) {
+
+	mws := &wsservermocks.WebSocketChannels{}
+	mockWSChannels(mws)
+
+	dmw := DistributionModeLoadBalance
+	enc := PayloadEncoding("unknown")
+	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
+		DistributionMode: &dmw,
+		PayloadEncoding:  &enc,
+	}, "ut_stream", nil)
+
+	err := wsa.AttemptDispatch(context.Background(), 0, &EventBatch[testData]{
+		StreamID:    fftypes.NewUUID().String(),
+		BatchNumber: 1,
+	})
+	assert.Regexp(t, "FF00172", err)
+}
+
+func TestWSConfigValidatePayloadEncoding(t *testing.T) {
+	defaults := &ConfigWebsocketDefaults{DefaultDistributionMode: DistributionModeLoadBalance}
+
+	wc := &WebSocketConfig{}
+	err := wc.validate(context.Background(), defaults, true)
+	assert.NoError(t, err)
+	assert.Equal(t, PayloadEncodingJSON, *wc.PayloadEncoding)
+
+	enc := PayloadEncoding("wrong")
+	wc = &WebSocketConfig{PayloadEncoding: &enc}
+	err = wc.validate(context.Background(), defaults, true)
+	assert.Regexp(t, "FF00172", err)
+}
+
+type testConsumerLister struct {
+	wsservermocks.WebSocketChannels
+	consumers map[string][]*wsserver.StreamConsumer
+}
+
+func (l *testConsumerLister) StreamConsumers(streamName string) []*wsserver.StreamConsumer {
+	return l.consumers[streamName]
+}
+
+func TestWebSocketConsumerStatus(t *testing.T) {
+	ctx, esm, _, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+	})
+	defer done()
+
+	started := fftypes.Now()
+	lister := &testConsumerLister{consumers: map[string][]*wsserver.StreamConsumer{
+		"stream1": {
+			{ID: "c1", RemoteAddr: "127.0.0.1:12345", StartedAt: started},
+			{ID: "c2", RemoteAddr: "127.0.0.1:12346", StartedAt: fftypes.Now()},
+		},
+	}}
+	esm.wsChannels = lister
+
+	registry := prometheus.NewRegistry()
+	mm, err := metric.NewPrometheusMetricsRegistryWithOptions("ut", metric.PrometheusRegistryOptions{Registry: registry}).
+		NewMetricsManagerForSubsystem(ctx, "es")
+	assert.NoError(t, err)
+	esm.config.MetricsManager = mm
+	esm.initMetrics(ctx)
+
+	es := &eventStream[testESConfig, testData]{
+		esm: esm,
+		spec: &EventStreamSpec[testESConfig]{
+			ID:        ptrTo("id1"),
+			Name:      ptrTo("stream1"),
+			Type:      &EventStreamTypeWebSocket,
+			Status:    ptrTo(EventStreamStatusStarted),
+			WebSocket: &WebSocketConfig{PayloadEncoding: &PayloadEncodingCBOR},
+		},
+	}
+	cs := es.Status(ctx).Consumers
+	assert.True(t, cs.Connected)
+	assert.Equal(t, 2, cs.Count)
+	assert.Equal(t, started, cs.ConnectedSince)
+	assert.Equal(t, PayloadEncodingCBOR, *cs.PayloadEncoding)
+	assert.Equal(t, "c1", cs.Connections[0].ID)
+
+	gaugeValue := func() float64 {
+		families, err := registry.Gather()
+		assert.NoError(t, err)
+		for _, f := range families {
+			if strings.HasSuffix(f.GetName(), metricWebSocketConsumers) {
+				return f.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		return -1
+	}
+	esm.emitConsumerMetrics(ctx, es.spec, esm.streamMetricLabels(es.spec), false)
+	assert.Equal(t, float64(2), gaugeValue())
+	esm.emitConsumerMetrics(ctx, es.spec, esm.streamMetricLabels(es.spec), true)
+	assert.Equal(t, float64(0), gaugeValue())
+
+	// No consumers
+	es.spec.Name = ptrTo("stream2")
+	cs = es.Status(ctx).Consumers
+	assert.False(t, cs.Connected)
+	assert.Zero(t, cs.Count)
+	assert.Nil(t, cs.ConnectedSince)
+
+	// Not available for other types of stream, or where the server cannot list its consumers
+	es.spec.Type = &EventStreamTypeWebhook
+	assert.Nil(t, es.Status(ctx).Consumers)
+	es.spec.Type = &EventStreamTypeWebSocket
+	esm.wsChannels = &wsservermocks.WebSocketChannels{}
+	assert.Nil(t, es.Status(ctx).Consumers)
+	esm.emitConsumerMetrics(ctx, es.spec, esm.streamMetricLabels(es.spec), false)
+}
+
+func TestWSAttemptDispatchResume(t *testing.T) {
+
+	lister := &testConsumerLister{consumers: map[string][]*wsserver.StreamConsumer{
+		"ut_stream": {{ID: "c1"}, {ID: "c2"}},
+	}}
+	_, bc, _ := mockWSChannels(&lister.WebSocketChannels)
+
+	dmw := DistributionModeBroadcast
+	wsa := newWebSocketAction[testData](lister, &WebSocketConfig{
+		DistributionMode: &dmw,
+	}, "ut_stream", nil)
+	wsa.comparer = &mockSequenceComparer{}
+	newBatch := func(batchNumber int64, seqs ...string) *EventBatch[testData] {
+		batch := &EventBatch[testData]{BatchNumber: batchNumber}
+		for _, seq := range seqs {
+			batch.Events = append(batch.Events, &Event[testData]{EventCommon: EventCommon{SequenceID: seq}})
+		}
+		return batch
+	}
+	dispatch := func(batch *EventBatch[testData]) {
+		err := wsa.AttemptDispatch(context.Background(), 0, batch)
+		assert.NoError(t, err)
+	}
+
+	// Batches a consumer has already processed are skipped for that consumer only
+	wsa.resume("c1", "003")
+	dispatch(newBatch(1, "001", "002", "003"))
+	cb := (<-bc).(wsserver.ConsumerMessage)
+	msg, _ := cb.MessageFor("c1", nil)
+	assert.Nil(t, msg)
+	msg, events := cb.MessageFor("c2", nil)
+	assert.Len(t, msg.(*EventBatch[testData]).Events, 3)
+	assert.Equal(t, 3, events)
+
+	// Partially processed batches are trimmed, including on retry, but not transformed batches that cannot be
+	wsa.resume("c1", "001")
+	dispatch(newBatch(2, "001", "002", "003"))
+	assert.Len(t, receiveAs(bc, "c1").(*EventBatch[testData]).Events, 2)
+	dispatch(newBatch(2, "001", "002", "003"))
+	assert.Len(t, receiveAs(bc, "c1").(*EventBatch[testData]).Events, 2)
+	wsa.resume("c2", "001")
+	transformed := newBatch(2, "001", "002")
+	transformed.Payload = "transformed"
+	dispatch(transformed)
+	assert.Len(t, receiveAs(bc, "c2").(*EventBatch[testData]).Events, 2)
+
+	// The offsets are discarded once the next batch is sent
+	dispatch(newBatch(3, "001"))
+	cb = (<-bc).(wsserver.ConsumerMessage)
+	msg, _ = cb.MessageFor("c1", nil)
+	assert.Len(t, msg.(*EventBatch[testData]).Events, 1)
+	msg, _ = cb.MessageFor("c2", nil)
+	assert.Len(t, msg.(*EventBatch[testData]).Events, 1)
+	assert.Empty(t, wsa.resumes)
+
+	// An offset beyond the batch in flight only applies to that batch
+	wsa.resume("c1", "009")
+	dispatch(newBatch(4, "004", "005"))
+	assert.Nil(t, receiveAs(bc, "c1"))
+	dispatch(newBatch(5, "006"))
+	assert.Len(t, receiveAs(bc, "c1").(*EventBatch[testData]).Events, 1)
+
+	// Offsets of consumers that have disconnected are removed when another consumer resumes
+	wsa.resume("c2", "001")
+	lister.consumers["ut_stream"] = []*wsserver.StreamConsumer{{ID: "c1"}}
+	wsa.resume("c3", "001")
+	assert.Len(t, wsa.resumes, 1)
+	assert.NotNil(t, wsa.resumes["c3"])
+}
+
+func TestWSAttemptDispatchLoadBalanceSkipped(t *testing.T) {
+
+	mws := &wsservermocks.WebSocketChannels{}
+	sc, _, _ := mockWSChannels(mws)
+
+	dmw := DistributionModeLoadBalance
+	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
+		DistributionMode: &dmw,
+	}, "ut_stream", nil)
+	wsa.comparer = &mockSequenceComparer{}
+
+	// A consumer that has already processed the batch does not acknowledge it
+	wsa.resume("c1", "002")
+	dispatched := make(chan error)
+	go func() {
+		dispatched <- wsa.AttemptDispatch(context.Background(), 0, &EventBatch[testData]{
+			BatchNumber: 1,
+			Events:      []*Event[testData]{{EventCommon: EventCommon{SequenceID: "001"}}},
+		})
+	}()
+	assert.Nil(t, receiveAs(sc, "c1"))
+	assert.NoError(t, <-dispatched)
+
+	// Waiting for a consumer to take the batch is interrupted if the stream stops
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		dispatched <- wsa.AttemptDispatch(ctx, 0, &EventBatch[testData]{BatchNumber: 2})
+	}()
+	<-sc
+	cancel()
+	assert.Regexp(t, "FF00225", <-dispatched)
+}
+
+type testResumeRegistrar struct {
+	wsservermocks.WebSocketChannels
+	handlers map[string]wsserver.StreamResumeHandler
+}
+
+func (r *testResumeRegistrar) SetStreamResumeHandler(streamName string, handler wsserver.StreamResumeHandler) {
+	if handler == nil {
+		delete(r.handlers, streamName)
+	} else {
+		r.handlers[streamName] = handler
+	}
+}
+
+func TestWebSocketResume(t *testing.T) {
+	ctx, esm, mes, done := newMockESManager(t, func(mp *mockPersistence) {
+		mp.eventStreams.On("GetMany", mock.Anything, mock.Anything).Return([]*EventStreamSpec[testESConfig]{}, &ffapi.FilterResult{}, nil)
+		mp.checkpoints.On("GetByID", mock.Anything, "id1").Return((*EventStreamCheckpoint)(nil), fmt.Errorf("pop")).Once()
+		mp.checkpoints.On("GetByID", mock.Anything, "id1").Return(&EventStreamCheckpoint{SequenceID: ptrTo("002")}, nil)
+	})
+	defer done()
+	registrar := &testResumeRegistrar{handlers: map[string]wsserver.StreamResumeHandler{}}
+	esm.wsChannels = registrar
+
+	spec := &EventStreamSpec[testESConfig]{
+		ID:        ptrTo("id1"),
+		Name:      ptrTo("stream1"),
+		Type:      &EventStreamTypeWebSocket,
+		Status:    ptrTo(EventStreamStatusStopped),
+		WebSocket: &WebSocketConfig{AllowResume: ptrTo(true)},
+	}
+
+	// The runtime must be able to compare sequences
+	err := esm.validateStream(ctx, spec, true)
+	assert.Regexp(t, "FF00302", err)
+	esm.runtime = &mockSequenceComparer{mockEventSource: mes}
+
+	es, err := esm.initEventStream(ctx, spec)
+	assert.NoError(t, err)
+	resume := registrar.handlers["stream1"]
+	assert.NotNil(t, resume)
+
+	err = resume(ctx, "c1", "003")
+	assert.Regexp(t, "pop", err)
+	err = resume(ctx, "c1", "001")
+	assert.Regexp(t, "FF00304", err)
+	err = resume(ctx, "c1", "003")
+	assert.NoError(t, err)
+	assert.Equal(t, "003", es.action.(*webSocketAction[testData]).resumes["c1"].resumeFrom)
+
+	// Consumers cannot resume unless the stream allows it
+	es.spec.WebSocket.AllowResume = ptrTo(false)
+	err = resume(ctx, "c1", "003")
+	assert.Regexp(t, "FF00303", err)
+
+	esm.setResumeHandler(es.spec, nil)
+	assert.Empty(t, registrar.handlers)
+}
+
+func TestWSAttemptDispatchCredit(t *testing.T) {
+
+	mws := &wsservermocks.WebSocketChannels{}
+	sc, _, rc := mockWSChannels(mws)
+
+	dmw := DistributionModeLoadBalance
+	wsa := newWebSocketAction[testData](mws, &WebSocketConfig{
+		DistributionMode: &dmw,
+	}, "ut_stream", nil)
+	wsa.creditRetryDelay = 1 * time.Millisecond
+	newBatch := func(size int) *EventBatch[testData] {
+		batch := &EventBatch[testData]{BatchNumber: 1}
+		for i := 0; i < size; i++ {
+			batch.Events = append(batch.Events, &Event[testData]{Data: &testData{Field1: i}})
+		}
+		return batch
+	}
+	ack := func() {
+		rc <- &wsserver.WebSocketCommandMessageOrError{Msg: &wsserver.WebSocketCommandMessage{
+			Type:        "ack",
+			BatchNumber: 1,
+		}}
+	}
+	receiveWithCredit := func(credit int) (*EventBatch[testData], int) {
+		msg, events := (<-sc).(wsserver.ConsumerMessage).MessageFor("c1", &credit)
+		if msg == nil {
+			return nil, events
+		}
+		return msg.(*EventBatch[testData]), events
+	}
+	dispatched := make(chan error)
+	dispatch := func(batch *EventBatch[testData]) {
+		go func() {
+			dispatched <- wsa.AttemptDispatch(context.Background(), 0, batch)
+		}()
+	}
+
+	// With credit for the batch, the whole batch is sent
+	dispatch(newBatch(3))
+	sent, events := receiveWithCredit(5)
+	assert.Len(t, sent.Events, 3)
+	assert.Equal(t, 3, events)
+	ack()
+	assert.NoError(t, <-dispatched)
+
+	// With less credit, the batch is sent in parts that fit, and offered again when a consumer has none
+	dispatch(newBatch(3))
+	sent, events = receiveWithCredit(2)
+	assert.Len(t, sent.Events, 2)
+	assert.Equal(t, 2, events)
+	ack()
+	sent, events = receiveWithCredit(0)
+	assert.Nil(t, sent)
+	assert.Zero(t, events)
+	sent, _ = receiveWithCredit(5)
+	assert.Len(t, sent.Events, 1)
+	ack()
+	assert.NoError(t, <-dispatched)
+
+	// Transformed batches cannot be split, so wait for a consumer with credit for the whole batch
+	transformed := newBatch(2)
+	transformed.Payload = "transformed"
+	dispatch(transformed)
+	sent, _ = receiveWithCredit(1)
+	assert.Nil(t, sent)
+	sent, _ = receiveWithCredit(2)
+	assert.Len(t, sent.Events, 2)
+	ack()
+	assert.NoError(t, <-dispatched)
+
+	// The wait to offer the batch again is interrupted if the stream stops
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		dispatched <- wsa.AttemptDispatch(ctx, 0, newBatch(1))
+	}()
+	sent, _ = receiveWithCredit(0)
+	assert.Nil(t, sent)
+	cancel()
+	assert.Regexp(t, "FF00225", <-dispatched)
+}
+
+func TestWSCapacity(t *testing.T) {
+	lister := &testConsumerLister{consumers: map[string][]*wsserver.StreamConsumer{}}
+	wsa := newWebSocketAction[testData](lister, &WebSocketConfig{}, "ut_stream", nil)
+
+	// Only advertised if every consumer advertises credit, and then the most any of them can accept
+	_, advertised := wsa.capacity()
+	assert.False(t, advertised)
+	lister.consumers["ut_stream"] = []*wsserver.StreamConsumer{{ID: "c1", Credit: ptrTo(2)}, {ID: "c2", Credit: ptrTo(5)}, {ID: "c3", Credit: ptrTo(0)}}
+	capacity, advertised := wsa.capacity()
+	assert.True(t, advertised)
+	assert.Equal(t, 5, capacity)
+	lister.consumers["ut_stream"] = append(lister.consumers["ut_stream"], &wsserver.StreamConsumer{ID: "c4"})
+	_, advertised = wsa.capacity()
+	assert.False(t, advertised)
+
+	wsa = newWebSocketAction[testData](&wsservermocks.WebSocketChannels{}, &WebSocketConfig{}, "ut_stream", nil)
+	_, advertised = wsa.capacity()
+	assert.False(t, advertised)
+}
+
+func TestCapBatchSizeToCapacity(t *testing.T) {
+	lister := &testConsumerLister{consumers: map[string][]*wsserver.StreamConsumer{}}
+	wsa := newWebSocketAction[testData](lister, &WebSocketConfig{}, "ut_stream", nil)
+	as := &activeStream[testESConfig, testData]{
+		eventStream: &eventStream[testESConfig, testData]{action: wsa},
+		ctx:         context.Background(),
+	}
+	assert.Equal(t, 10, as.capBatchSize(10))
+	lister.consumers["ut_stream"] = []*wsserver.StreamConsumer{{ID: "c1", Credit: ptrTo(0)}}
+	assert.Equal(t, 10, as.capBatchSize(10))
+	lister.consumers["ut_stream"] = []*wsserver.StreamConsumer{{ID: "c1", Credit: ptrTo(3)}}
+	assert.Equal(t, 3, as.capBatchSize(10))
+	assert.Equal(t, 2, as.capBatchSize(2))
+
+	as.action = &inProcessAction[testESConfig, testData]{}
+	assert.Equal(t, 10, as.capBatchSize(10))
+}
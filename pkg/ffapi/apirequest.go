@@ -33,6 +33,13 @@ type APIRequest struct {
 	SuccessStatus   int
 	ResponseHeaders http.Header
 	AlwaysPaginate  bool
+	// HeadOnly is set for HEAD requests, where the response body is discarded. Routes can check this to skip
+	// building an expensive body - returning any non-nil output, and setting Content-Length themselves if known
+	HeadOnly bool
+	// QueryParams are the typed values of the query parameters declared on the route, with defaults applied - see BindQueryParams
+	QueryParams map[string]interface{}
+	// LastEventID is the ID of the last server-sent event received by a client that is reconnecting, for a route with an SSEHandler to resume from
+	LastEventID string
 }
 
 // FilterResult is a helper to transform a filter result into a REST API standard payload
@@ -44,6 +51,7 @@ func (r *APIRequest) FilterResult(items interface{}, res *FilterResult, err erro
 		}
 		if res != nil {
 			response.Total = res.TotalCount
+			response.TotalApproximate = res.Approximate
 		}
 		if itemsVal.Kind() == reflect.Slice {
 			response.Count = int64(itemsVal.Len())
@@ -36,6 +36,22 @@ func TestFilterResultWithCount(t *testing.T) {
 	}, f)
 }
 
+func TestFilterResultWithApproximateCount(t *testing.T) {
+	r := &APIRequest{}
+	ten := int64(10)
+	f, err := r.FilterResult([]string{"test"}, &FilterResult{
+		TotalCount:  &ten,
+		Approximate: true,
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &FilterResultsWithCount{
+		Count:            1,
+		Total:            &ten,
+		TotalApproximate: true,
+		Items:            []string{"test"},
+	}, f)
+}
+
 func TestFilterResultPlain(t *testing.T) {
 	r := &APIRequest{}
 	f, err := r.FilterResult([]string{"test"}, &FilterResult{}, nil)
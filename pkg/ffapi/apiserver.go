@@ -60,10 +60,14 @@ type apiServer[T any] struct {
 	apiDynamicPublicURLHeader string
 	alwaysPaginate            bool
 	handleYAML                bool
+	maxBatchRequests          int
+	sseKeepAlive              time.Duration
 	metricsEnabled            bool
 	metricsPath               string
 	metricsPublicURL          string
+	rateLimiter               *RateLimiter
 	mux                       *mux.Router
+	batchHandler              http.Handler
 
 	APIServerOptions[T]
 }
@@ -81,11 +85,16 @@ type APIServerOptions[T any] struct {
 	PanicOnMissingDescription bool
 	SupportFieldRedaction     bool
 	HandleYAML                bool
+	ResponseEncoders          map[string]ResponseEncoder
+	Authorizer                Authorizer
+	RequestDurationBuckets    []float64 // upper bounds in seconds of the request duration histogram, such as metric.DefaultLatencyBuckets - prometheus.DefBuckets if nil
+	BatchEndpoint             bool      // adds a POST route to BatchPath, which calls multiple routes of the API in a single request - each passing through the auth plugin of the server started by Serve
 }
 
 type APIServerRouteExt[T any] struct {
 	JSONHandler   func(*APIRequest, T) (output interface{}, err error)
 	UploadHandler func(*APIRequest, T) (output interface{}, err error)
+	SSEHandler    func(*APIRequest, T) (events <-chan *SSEEvent, err error)
 }
 
 // NewAPIServer makes a new server, with the specified configuration, and
@@ -101,21 +110,32 @@ func NewAPIServer[T any](ctx context.Context, options APIServerOptions[T]) APISe
 		metricsPath:               options.MetricsConfig.GetString(ConfMetricsServerPath),
 		alwaysPaginate:            options.APIConfig.GetBool(ConfAPIAlwaysPaginate),
 		handleYAML:                options.HandleYAML,
+		maxBatchRequests:          options.APIConfig.GetInt(ConfAPIMaxBatchRequests),
+		sseKeepAlive:              options.APIConfig.GetDuration(ConfAPISSEKeepAlive),
 		apiDynamicPublicURLHeader: options.APIConfig.GetString(ConfAPIDynamicPublicURLHeader),
+		rateLimiter:               NewRateLimiterFromConfig(options.APIConfig.SubSection("rateLimit"), options.Routes...),
 		APIServerOptions:          options,
 		started:                   make(chan struct{}),
 	}
+	if as.BatchEndpoint {
+		// first, so the routes of the app do not match the batch path
+		as.Routes = append([]*Route{as.batchRoute()}, options.Routes...)
+	}
 	if as.FavIcon16 == nil {
 		as.FavIcon16 = ffLogo16
 	}
 	if as.FavIcon32 == nil {
 		as.FavIcon32 = ffLogo16
 	}
+	reqDurationBuckets := as.RequestDurationBuckets
+	if reqDurationBuckets == nil {
+		reqDurationBuckets = prometheus.DefBuckets
+	}
 	_ = as.MetricsRegistry.NewHTTPMetricsInstrumentationsForSubsystem(
 		ctx,
 		APIServerMetricsSubSystemName,
 		true,
-		prometheus.DefBuckets,
+		reqDurationBuckets,
 		map[string]string{},
 	)
 	return as
@@ -149,6 +169,7 @@ func (as *apiServer[T]) Serve(ctx context.Context) (err error) {
 		return err
 	}
 	as.apiPublicURL = buildPublicURL(as.APIConfig, apiHTTPServer.Addr())
+	as.batchHandler = apiHTTPServer.RouterHandler()
 	go apiHTTPServer.ServeHTTP(ctx)
 
 	if as.metricsEnabled {
@@ -221,6 +242,10 @@ func (as *apiServer[T]) handlerFactory() *HandlerFactory {
 		SupportFieldRedaction: as.SupportFieldRedaction,
 		AlwaysPaginate:        as.alwaysPaginate,
 		HandleYAML:            as.handleYAML,
+		RateLimiter:           as.rateLimiter,
+		ResponseEncoders:      as.ResponseEncoders,
+		Authorizer:            as.Authorizer,
+		SSEKeepAlive:          as.sseKeepAlive,
 	}
 }
 
@@ -230,7 +255,7 @@ func (as *apiServer[T]) createMuxRouter(ctx context.Context) *mux.Router {
 
 	if as.metricsEnabled {
 		h, _ := as.MetricsRegistry.GetHTTPMetricsInstrumentationsMiddlewareForSubsystem(ctx, APIServerMetricsSubSystemName)
-		r.Use(h)
+		r.Use(flushableMiddleware(h))
 	}
 
 	for _, route := range as.Routes {
@@ -247,10 +272,26 @@ func (as *apiServer[T]) createMuxRouter(ctx context.Context) *mux.Router {
 				return ce.UploadHandler(r, er)
 			}
 		}
-		if ce.JSONHandler != nil || ce.UploadHandler != nil {
+		if ce.SSEHandler != nil {
+			route.SSEHandler = func(r *APIRequest) (<-chan *SSEEvent, error) {
+				er, err := as.EnrichRequest(r)
+				if err != nil {
+					return nil, err
+				}
+				return ce.SSEHandler(r, er)
+			}
 			r.HandleFunc(fmt.Sprintf("/api/v1/%s", route.Path), as.routeHandler(hf, route)).
 				Methods(route.Method)
 		}
+		if ce.JSONHandler != nil || ce.UploadHandler != nil {
+			methods := []string{route.Method}
+			if route.Method == http.MethodGet {
+				// HEAD runs the same handler, allowing existence checks without transferring the body
+				methods = append(methods, http.MethodHead)
+			}
+			r.HandleFunc(fmt.Sprintf("/api/v1/%s", route.Path), as.routeHandler(hf, route)).
+				Methods(methods...)
+		}
 	}
 
 	oah := &OpenAPIHandlerFactory{
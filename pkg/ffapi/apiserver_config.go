@@ -32,6 +32,12 @@ var (
 	ConfAPIRequestMaxTimeout      = "requestMaxTimeout"
 	ConfAPIAlwaysPaginate         = "alwaysPaginate"
 	ConfAPIDynamicPublicURLHeader = "dynamicPublicURLHeader"
+	ConfAPIMaxBatchRequests       = "maxBatchRequests"
+	ConfAPISSEKeepAlive           = "sseKeepAlive"
+
+	ConfAPIRateLimitRequestsPerSecond = "requestsPerSecond"
+	ConfAPIRateLimitBurst             = "burst"
+	ConfAPIRateLimitMaxClients        = "maxClients"
 )
 
 func InitAPIServerConfig(apiConfig, metricsConfig, corsConfig config.Section) {
@@ -43,6 +49,13 @@ func InitAPIServerConfig(apiConfig, metricsConfig, corsConfig config.Section) {
 	apiConfig.AddKnownKey(ConfAPIRequestMaxTimeout, "10m")
 	apiConfig.AddKnownKey(ConfAPIAlwaysPaginate, false)
 	apiConfig.AddKnownKey(ConfAPIDynamicPublicURLHeader)
+	apiConfig.AddKnownKey(ConfAPIMaxBatchRequests, 100)
+	apiConfig.AddKnownKey(ConfAPISSEKeepAlive, "15s")
+
+	rateLimitConfig := apiConfig.SubSection("rateLimit")
+	rateLimitConfig.AddKnownKey(ConfAPIRateLimitRequestsPerSecond, 0)
+	rateLimitConfig.AddKnownKey(ConfAPIRateLimitBurst, 0)
+	rateLimitConfig.AddKnownKey(ConfAPIRateLimitMaxClients, 10000)
 
 	httpserver.InitCORSConfig(corsConfig)
 
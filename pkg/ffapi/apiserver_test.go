@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -28,6 +29,8 @@ import (
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
 	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -320,6 +323,48 @@ func TestAPIServer500(t *testing.T) {
 	assert.Equal(t, 500, res.StatusCode())
 }
 
+func TestAPIServerHEADFromGETRoute(t *testing.T) {
+	_, as, done := newTestAPIServer(t, false)
+	defer done()
+	as.Routes = append(as.Routes, &Route{
+		Name:            "utAPIRoute2",
+		Path:            "ut/utresource/{resourceid}",
+		Method:          http.MethodGet,
+		PathParams:      []*PathParam{{Name: "resourceid"}},
+		JSONOutputValue: func() interface{} { return &sampleOutput{} },
+		JSONOutputCodes: []int{http.StatusOK},
+		Extensions: &APIServerRouteExt[*utManager]{
+			JSONHandler: func(r *APIRequest, um *utManager) (output interface{}, err error) {
+				if r.PP["resourceid"] == "missing" {
+					return nil, nil
+				}
+				return &sampleOutput{Output1: "test_get_output"}, nil
+			},
+		},
+	})
+	r := as.createMuxRouter(context.Background())
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/v1/ut/utresource/id12345", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	getLength := res.Body.Len()
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodHead, "/api/v1/ut/utresource/id12345", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, fmt.Sprintf("%d", getLength), res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.Bytes())
+
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodHead, "/api/v1/ut/utresource/missing", nil))
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	// POST routes do not get a HEAD handler
+	res = httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodHead, "/api/v1/ut/utresource/id12345/postit", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+}
+
 func TestAPIServerFailServe(t *testing.T) {
 	_, as, done := newTestAPIServer(t, false)
 	defer done()
@@ -378,3 +423,28 @@ func TestBadMetrics(t *testing.T) {
 	as.MetricsRegistry = metric.NewPrometheusMetricsRegistry("wrong")
 	assert.Panics(t, func() { as.createMetricsMuxRouter(context.Background()) })
 }
+
+func TestAPIServerRequestDurationBuckets(t *testing.T) {
+	apiConfig, metricsConfig, corsConfig := initUTConfig()
+	registry := prometheus.NewRegistry()
+	as := NewAPIServer(context.Background(), APIServerOptions[*utManager]{
+		MetricsRegistry:        metric.NewPrometheusMetricsRegistryWithOptions("ut", metric.PrometheusRegistryOptions{Registry: registry}),
+		Routes:                 []*Route{},
+		APIConfig:              apiConfig,
+		MetricsConfig:          metricsConfig,
+		CORSConfig:             corsConfig,
+		RequestDurationBuckets: metric.ExponentialBuckets(0.01, 10, 3),
+	})
+	r := as.MuxRouter(context.Background())
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api", nil))
+
+	mfs, err := registry.Gather()
+	assert.NoError(t, err)
+	buckets := -1
+	for _, mf := range mfs {
+		if strings.HasSuffix(mf.GetName(), "_seconds") && mf.GetType() == dto.MetricType_HISTOGRAM {
+			buckets = len(mf.Metric[0].GetHistogram().Bucket)
+		}
+	}
+	assert.Equal(t, 3, buckets)
+}
@@ -0,0 +1,44 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"net/http"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// Authorizer decides if the principal that was authenticated for a request (see auth.GetPrincipal - empty if the
+// request is unauthenticated) can call a route, with the Permission declared on that route (empty if none).
+// Returning false fails the request with a 403. An error fails the request with the status of the error,
+// for example if the policy could not be loaded.
+type Authorizer func(req *http.Request, principal string, permission string) (allowed bool, err error)
+
+func (hs *HandlerFactory) checkAuthorization(req *http.Request, route *Route) (int, error) {
+	principal := auth.GetPrincipal(req.Context())
+	allowed, err := hs.Authorizer(req, principal, route.Permission)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !allowed {
+		log.L(req.Context()).Warnf("Principal '%s' denied permission '%s' for route '%s'", principal, route.Permission, route.Name)
+		return http.StatusForbidden, i18n.NewError(req.Context(), i18n.MsgForbidden)
+	}
+	return 0, nil
+}
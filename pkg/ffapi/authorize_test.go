@@ -0,0 +1,116 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAuthorizeTestRequest(principal string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	if principal != "" {
+		req = req.WithContext(context.WithValue(req.Context(), auth.CtxPrincipalKey{}, principal))
+	}
+	return req
+}
+
+func TestRouteHandlerAuthorizer(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	hf.Authorizer = func(req *http.Request, principal string, permission string) (bool, error) {
+		switch principal {
+		case "admin":
+			return true, nil
+		case "reader":
+			return permission == "things.read", nil
+		case "broken":
+			return false, fmt.Errorf("pop")
+		case "unavailable":
+			return false, i18n.NewError(req.Context(), i18n.MsgServerDraining, "API")
+		}
+		return false, nil
+	}
+	newRoute := func(permission string) http.HandlerFunc {
+		return hf.RouteHandler(&Route{
+			Name:       "testRoute",
+			Path:       "/test",
+			Method:     http.MethodGet,
+			Permission: permission,
+			JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+				return map[string]interface{}{}, nil
+			},
+		})
+	}
+	call := func(handler http.HandlerFunc, principal string) (int, string) {
+		res := httptest.NewRecorder()
+		handler(res, newAuthorizeTestRequest(principal))
+		var resErr fftypes.RESTError
+		if res.Code != http.StatusOK {
+			assert.NoError(t, json.NewDecoder(res.Body).Decode(&resErr))
+		}
+		return res.Code, resErr.Error
+	}
+
+	readRoute := newRoute("things.read")
+	writeRoute := newRoute("things.write")
+
+	status, _ := call(readRoute, "admin")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(writeRoute, "admin")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = call(readRoute, "reader")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, errMsg := call(writeRoute, "reader")
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Regexp(t, "FF00170", errMsg)
+	status, errMsg = call(readRoute, "")
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Regexp(t, "FF00170", errMsg)
+
+	status, errMsg = call(readRoute, "broken")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Regexp(t, "pop", errMsg)
+	status, errMsg = call(readRoute, "unavailable")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Regexp(t, "FF00254", errMsg)
+}
+
+func TestRouteHandlerNoAuthorizer(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	handler := hf.RouteHandler(&Route{
+		Name:       "testRoute",
+		Path:       "/test",
+		Method:     http.MethodGet,
+		Permission: "things.write",
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return map[string]interface{}{}, nil
+		},
+	})
+	res := httptest.NewRecorder()
+	handler(res, newAuthorizeTestRequest(""))
+	assert.Equal(t, http.StatusOK, res.Code)
+}
@@ -0,0 +1,191 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// BatchPath is the path of the batch route, relative to the base path of the API, when enabled with APIServerOptions.BatchEndpoint
+const BatchPath = "batch"
+
+// BatchRequest is the input to the batch route
+type BatchRequest struct {
+	Sequential bool               `ffstruct:"BatchRequest" json:"sequential,omitempty"`
+	Requests   []*BatchSubRequest `ffstruct:"BatchRequest" json:"requests"`
+}
+
+// BatchSubRequest is one request within a batch, made in-process with the headers of the batch request
+// (such as those used for authentication) plus any of its own
+type BatchSubRequest struct {
+	Method  string            `ffstruct:"BatchSubRequest" json:"method" ffvalidate:"required"`
+	Path    string            `ffstruct:"BatchSubRequest" json:"path" ffvalidate:"required"`
+	Headers map[string]string `ffstruct:"BatchSubRequest" json:"headers,omitempty"`
+	Body    *fftypes.JSONAny  `ffstruct:"BatchSubRequest" json:"body,omitempty"`
+}
+
+// BatchResponse is the output of the batch route, which returns 200 whether or not the requests within it succeed
+type BatchResponse struct {
+	Responses []*BatchSubResponse `ffstruct:"BatchResponse" json:"responses"`
+}
+
+// BatchSubResponse is the response to one request within a batch. The body of a failed request
+// is the standard error of the API, such as {"error":"FF00164: ..."}.
+type BatchSubResponse struct {
+	Status int              `ffstruct:"BatchSubResponse" json:"status"`
+	Body   *fftypes.JSONAny `ffstruct:"BatchSubResponse" json:"body,omitempty"`
+}
+
+// batchResponseWriter captures the response of a request within a batch
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *batchResponseWriter) response() *BatchSubResponse {
+	res := &BatchSubResponse{Status: w.status}
+	if w.status == 0 {
+		res.Status = http.StatusOK
+	}
+	switch {
+	case w.body.Len() == 0:
+	case json.Valid(w.body.Bytes()):
+		res.Body = fftypes.JSONAnyPtrBytes(bytes.TrimSpace(w.body.Bytes()))
+	default:
+		// any other content is returned as a JSON string
+		b, _ := json.Marshal(w.body.String())
+		res.Body = fftypes.JSONAnyPtrBytes(b)
+	}
+	return res
+}
+
+func batchErrorResponse(status int, err error) *BatchSubResponse {
+	b, _ := json.Marshal(&fftypes.RESTError{Error: err.Error()})
+	return &BatchSubResponse{Status: status, Body: fftypes.JSONAnyPtrBytes(b)}
+}
+
+func (as *apiServer[T]) batchRoute() *Route {
+	return &Route{
+		Name:            "batch",
+		Path:            BatchPath,
+		Method:          http.MethodPost,
+		Description:     i18n.APIBatchDesc,
+		JSONInputValue:  func() interface{} { return &BatchRequest{} },
+		JSONOutputValue: func() interface{} { return &BatchResponse{} },
+		JSONOutputCodes: []int{http.StatusOK},
+		Extensions: &APIServerRouteExt[T]{
+			JSONHandler: func(r *APIRequest, _ T) (output interface{}, err error) {
+				return as.runBatch(r.Req, r.Input.(*BatchRequest))
+			},
+		},
+	}
+}
+
+func (as *apiServer[T]) runBatch(req *http.Request, batch *BatchRequest) (*BatchResponse, error) {
+	if len(batch.Requests) == 0 || len(batch.Requests) > as.maxBatchRequests {
+		return nil, i18n.NewError(req.Context(), i18n.MsgBatchRequestCount, as.maxBatchRequests, len(batch.Requests))
+	}
+	responses := make([]*BatchSubResponse, len(batch.Requests))
+	if batch.Sequential {
+		for i, subReq := range batch.Requests {
+			if i > 0 && responses[i-1].Status >= 300 {
+				responses[i] = batchErrorResponse(http.StatusFailedDependency, i18n.NewError(req.Context(), i18n.MsgBatchRequestSkipped))
+				continue
+			}
+			responses[i] = as.runBatchEntry(req, subReq)
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, subReq := range batch.Requests {
+			wg.Add(1)
+			go func(i int, subReq *BatchSubRequest) {
+				defer wg.Done()
+				responses[i] = as.runBatchEntry(req, subReq)
+			}(i, subReq)
+		}
+		wg.Wait()
+	}
+	return &BatchResponse{Responses: responses}, nil
+}
+
+// runBatchEntry makes the request through the router of the server wrapped in its auth plugin, so it is
+// handled (including authentication, authorization and rate limiting) exactly as if it had been made as
+// a separate HTTP request. Where the router is served by the app rather than Serve, the request is made
+// to the router directly, so any middleware the app wraps around the router does not apply to it.
+func (as *apiServer[T]) runBatchEntry(req *http.Request, subReq *BatchSubRequest) *BatchSubResponse {
+	ctx := req.Context()
+	method := strings.ToUpper(subReq.Method)
+	u, err := url.Parse(subReq.Path)
+	if err != nil || u.Scheme != "" || u.Host != "" || path.Clean("/"+u.EscapedPath()) == "/"+BatchPath {
+		return batchErrorResponse(http.StatusBadRequest, i18n.NewError(ctx, i18n.MsgBatchRequestInvalid, subReq.Method, subReq.Path))
+	}
+	target := "/api/v1" + path.Clean("/"+u.EscapedPath())
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(subReq.Body.Bytes()))
+	if err != nil {
+		return batchErrorResponse(http.StatusBadRequest, i18n.NewError(ctx, i18n.MsgBatchRequestInvalid, subReq.Method, subReq.Path))
+	}
+	// the headers of the batch request apply to each request, so each is authorized as the same caller
+	for k, v := range req.Header {
+		switch http.CanonicalHeaderKey(k) {
+		case "Content-Type", "Content-Length", "Accept":
+		default:
+			httpReq.Header[k] = v
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	for k, v := range subReq.Headers {
+		httpReq.Header.Set(k, v)
+	}
+	httpReq.RemoteAddr = req.RemoteAddr
+
+	w := &batchResponseWriter{header: http.Header{}}
+	handler := as.batchHandler
+	if handler == nil {
+		handler = as.mux
+	}
+	handler.ServeHTTP(w, httpReq)
+	return w.response()
+}
@@ -0,0 +1,272 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/hyperledger/firefly-common/pkg/auth/basic"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+var utBatchGetRoute = &Route{
+	Name:            "utBatchGet",
+	Path:            "ut/things/{id}",
+	Method:          http.MethodGet,
+	PathParams:      []*PathParam{{Name: "id"}},
+	QueryParams:     []*QueryParam{{Name: "suffix"}},
+	JSONOutputValue: func() interface{} { return &sampleOutput{} },
+	JSONOutputCodes: []int{http.StatusOK},
+	Extensions: &APIServerRouteExt[*utManager]{
+		JSONHandler: func(r *APIRequest, um *utManager) (output interface{}, err error) {
+			if r.PP["id"] == "missing" {
+				return nil, i18n.NewError(r.Req.Context(), i18n.Msg404NoResult)
+			}
+			return &sampleOutput{Output1: r.PP["id"] + r.QP["suffix"]}, nil
+		},
+	},
+}
+
+var utBatchAdminRoute = &Route{
+	Name:            "utBatchAdmin",
+	Path:            "ut/admin",
+	Method:          http.MethodPost,
+	Permission:      "admin",
+	JSONInputValue:  func() interface{} { return &sampleInput{} },
+	JSONOutputValue: func() interface{} { return &sampleOutput{} },
+	JSONOutputCodes: []int{http.StatusCreated},
+	Extensions: &APIServerRouteExt[*utManager]{
+		JSONHandler: func(r *APIRequest, um *utManager) (output interface{}, err error) {
+			return &sampleOutput{Output1: r.Input.(*sampleInput).Input1}, nil
+		},
+	},
+}
+
+func newTestBatchServer(t *testing.T, maxRequests int) (string, func()) {
+	apiConfig, metricsConfig, corsConfig := initUTConfig()
+	apiConfig.Set(ConfAPIMaxBatchRequests, maxRequests)
+	um := &utManager{t: t}
+	as := NewAPIServer(context.Background(), APIServerOptions[*utManager]{
+		MetricsRegistry: metric.NewPrometheusMetricsRegistry("ut"),
+		Routes:          []*Route{utBatchGetRoute, utBatchAdminRoute},
+		EnrichRequest:   func(r *APIRequest) (*utManager, error) { return um, nil },
+		Description:     "unit testing",
+		APIConfig:       apiConfig,
+		MetricsConfig:   metricsConfig,
+		CORSConfig:      corsConfig,
+		BatchEndpoint:   true,
+		Authorizer: func(req *http.Request, principal, permission string) (bool, error) {
+			return permission == "" || req.Header.Get("X-Role") == permission, nil
+		},
+	})
+	server := httptest.NewServer(as.MuxRouter(context.Background()))
+	return server.URL + "/api/v1/batch", server.Close
+}
+
+func batchStatuses(res *BatchResponse) []int {
+	statuses := make([]int, len(res.Responses))
+	for i, r := range res.Responses {
+		statuses[i] = r.Status
+	}
+	return statuses
+}
+
+func TestBatchIndependent(t *testing.T) {
+	url, done := newTestBatchServer(t, 10)
+	defer done()
+
+	var res BatchResponse
+	httpRes, err := resty.New().R().
+		SetHeader("X-Role", "admin").
+		SetBody(&BatchRequest{
+			Requests: []*BatchSubRequest{
+				{Method: "get", Path: "/ut/things/1?suffix=a"},
+				{Method: http.MethodGet, Path: "ut/things/missing"},
+				{Method: http.MethodPost, Path: "ut/admin", Body: fftypes.JSONAnyPtr(`{"input1":"value1"}`)},
+				{Method: http.MethodPost, Path: "ut/admin", Headers: map[string]string{"X-Role": "user"}},
+			},
+		}).
+		SetResult(&res).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, httpRes.StatusCode())
+	assert.Equal(t, []int{200, 404, 201, 403}, batchStatuses(&res))
+	assert.JSONEq(t, `{"output1":"1a"}`, res.Responses[0].Body.String())
+	assert.Regexp(t, `^\{"error":"FF00164`, res.Responses[1].Body.String())
+	assert.JSONEq(t, `{"output1":"value1"}`, res.Responses[2].Body.String())
+	assert.Regexp(t, `^\{"error":"FF00`, res.Responses[3].Body.String())
+}
+
+func TestBatchAuthPluginPerRequest(t *testing.T) {
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	apiConfig, metricsConfig, corsConfig := initUTConfig()
+	apiConfig.Set(httpserver.HTTPAuthType, "basic")
+	apiConfig.SubSection("auth").SubSection("basic").Set(basic.PasswordFile, "../../test/data/test_users")
+	as := NewAPIServer(ctx, APIServerOptions[*utManager]{
+		MetricsRegistry: metric.NewPrometheusMetricsRegistry("ut"),
+		Routes:          []*Route{utBatchGetRoute},
+		EnrichRequest:   func(r *APIRequest) (*utManager, error) { return &utManager{t: t}, nil },
+		Description:     "unit testing",
+		APIConfig:       apiConfig,
+		MetricsConfig:   metricsConfig,
+		CORSConfig:      corsConfig,
+		BatchEndpoint:   true,
+	})
+	done := make(chan struct{})
+	go func() {
+		err := as.Serve(ctx)
+		assert.NoError(t, err)
+		close(done)
+	}()
+	defer func() {
+		cancelCtx()
+		<-done
+	}()
+	<-as.Started()
+
+	var res BatchResponse
+	httpRes, err := resty.New().R().
+		SetBasicAuth("firefly", "awesome").
+		SetBody(&BatchRequest{
+			Requests: []*BatchSubRequest{
+				{Method: http.MethodGet, Path: "ut/things/1"},
+				// each request is authorized by the auth plugin with its own headers
+				{Method: http.MethodGet, Path: "ut/things/2", Headers: map[string]string{"Authorization": "Basic bm9ib2R5Om5vcGU="}},
+			},
+		}).
+		SetResult(&res).
+		Post(as.APIPublicURL() + "/api/v1/batch")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, httpRes.StatusCode())
+	assert.Equal(t, []int{200, 403}, batchStatuses(&res))
+
+	httpRes, err = resty.New().R().
+		SetBody(&BatchRequest{Requests: []*BatchSubRequest{{Method: http.MethodGet, Path: "ut/things/1"}}}).
+		Post(as.APIPublicURL() + "/api/v1/batch")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, httpRes.StatusCode())
+}
+
+func TestBatchSequential(t *testing.T) {
+	url, done := newTestBatchServer(t, 10)
+	defer done()
+
+	var res BatchResponse
+	_, err := resty.New().R().
+		SetBody(&BatchRequest{
+			Sequential: true,
+			Requests: []*BatchSubRequest{
+				{Method: http.MethodGet, Path: "ut/things/1"},
+				{Method: http.MethodGet, Path: "ut/things/missing"},
+				{Method: http.MethodGet, Path: "ut/things/2"},
+			},
+		}).
+		SetResult(&res).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{200, 404, 424}, batchStatuses(&res))
+	assert.Regexp(t, "FF00285", res.Responses[2].Body.String())
+}
+
+func TestBatchInvalidRequests(t *testing.T) {
+	url, done := newTestBatchServer(t, 10)
+	defer done()
+
+	var res BatchResponse
+	_, err := resty.New().R().
+		SetBody(&BatchRequest{
+			Requests: []*BatchSubRequest{
+				{Method: http.MethodPost, Path: "batch"},
+				{Method: http.MethodPost, Path: "ut/../batch"},
+				{Method: http.MethodGet, Path: "http://example.com/ut/things/1"},
+				{Method: http.MethodGet, Path: "%zz"},
+				{Method: "BAD METHOD", Path: "ut/things/1"},
+				{Method: http.MethodGet, Path: "ut/unknown"},
+			},
+		}).
+		SetResult(&res).
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{400, 400, 400, 400, 400, 404}, batchStatuses(&res))
+	assert.Regexp(t, "FF00284", res.Responses[0].Body.String())
+}
+
+func TestBatchRequestCount(t *testing.T) {
+	url, done := newTestBatchServer(t, 1)
+	defer done()
+
+	for _, requests := range [][]*BatchSubRequest{
+		{},
+		{{Method: http.MethodGet, Path: "ut/things/1"}, {Method: http.MethodGet, Path: "ut/things/2"}},
+	} {
+		res, err := resty.New().R().
+			SetBody(&BatchRequest{Requests: requests}).
+			Post(url)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode())
+		assert.Regexp(t, "FF00283", res.String())
+	}
+
+	res, err := resty.New().R().
+		SetBody(`{"requests":[{"path":"ut/things/1"}]}`).
+		SetHeader("Content-Type", "application/json").
+		Post(url)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode())
+	assert.Regexp(t, "method", res.String())
+}
+
+func TestBatchResponseWriter(t *testing.T) {
+	w := &batchResponseWriter{header: http.Header{}}
+	assert.Equal(t, &BatchSubResponse{Status: http.StatusOK}, w.response())
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("some text"))
+	assert.Equal(t, &BatchSubResponse{Status: http.StatusAccepted, Body: fftypes.JSONAnyPtr(`"some text"`)}, w.response())
+}
+
+func TestBatchOpenAPI(t *testing.T) {
+	url, done := newTestBatchServer(t, 10)
+	defer done()
+
+	res, err := resty.New().R().Get(strings.Replace(url, "/v1/batch", "/openapi.yaml", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Contains(t, res.String(), "/batch:")
+	assert.Contains(t, res.String(), "sequential")
+
+	// All fields are documented
+	as := &apiServer[*utManager]{}
+	assert.NotPanics(t, func() {
+		_ = NewSwaggerGen(&SwaggerGenOptions{
+			Title:                     "UnitTest",
+			Version:                   "1.0",
+			BaseURL:                   "http://localhost:12345/api/v1",
+			PanicOnMissingDescription: true,
+		}).Generate(context.Background(), []*Route{as.batchRoute()})
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ghodss/yaml"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+)
+
+// ResponseEncoder serializes the output of a route, or an error, for a media type other than JSON.
+// Register encoders by media type in HandlerFactory.ResponseEncoders (or APIServerOptions.ResponseEncoders),
+// and they are used when preferred in the Accept header of a request.
+type ResponseEncoder func(v interface{}) ([]byte, error)
+
+// YAMLResponseEncoder converts the JSON of the output to YAML, so the structure is identical to the JSON response
+var YAMLResponseEncoder ResponseEncoder = yaml.Marshal
+
+// CBORResponseEncoder serializes the generic document model produced from the JSON of the output, so the
+// structure is identical to the JSON response. Integers too large for an int64 are encoded as strings.
+var CBORResponseEncoder ResponseEncoder = func(v interface{}) ([]byte, error) {
+	doc, err := fftypes.JSONGenericDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(doc)
+}
+
+// negotiateEncoder returns the registered encoder and media type with the highest quality in the Accept header.
+// A nil encoder means JSON, which is used if the header is absent, or prefers JSON, a wildcard, or no registered type.
+func (hs *HandlerFactory) negotiateEncoder(req *http.Request) (string, ResponseEncoder) {
+	accept := req.Header.Get("Accept")
+	if len(hs.ResponseEncoders) == 0 || accept == "" {
+		return "", nil
+	}
+	bestQ := 0.0
+	var bestType string
+	var bestEncoder ResponseEncoder
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			// earlier entries win on equal quality
+			continue
+		}
+		if encoder, ok := hs.ResponseEncoders[mediaType]; ok {
+			bestQ, bestType, bestEncoder = q, mediaType, encoder
+		} else if mediaType == "application/json" || mediaType == "*/*" || mediaType == "application/*" {
+			bestQ, bestType, bestEncoder = q, "", nil
+		}
+	}
+	return bestType, bestEncoder
+}
@@ -0,0 +1,163 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ghodss/yaml"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEncodedOutput struct {
+	Name    string           `json:"name"`
+	Created *fftypes.FFTime  `json:"created"`
+	Big     *fftypes.JSONAny `json:"big"`
+	Float   float64          `json:"float"`
+	Count   int              `json:"count"`
+}
+
+func newEncoderTestHandler(handler func(r *APIRequest) (output interface{}, err error)) http.HandlerFunc {
+	hs := newTestHandlerFactory("", nil)
+	hs.ResponseEncoders = map[string]ResponseEncoder{
+		"application/x-yaml": YAMLResponseEncoder,
+		"application/cbor":   CBORResponseEncoder,
+	}
+	return hs.RouteHandler(&Route{
+		Name:            "testRoute",
+		Path:            "/test",
+		Method:          http.MethodGet,
+		JSONOutputValue: func() interface{} { return &testEncodedOutput{} },
+		JSONOutputCodes: []int{200},
+		JSONHandler:     handler,
+	})
+}
+
+func TestResponseContentNegotiation(t *testing.T) {
+	created := fftypes.Now()
+	handler := newEncoderTestHandler(func(r *APIRequest) (output interface{}, err error) {
+		return &testEncodedOutput{
+			Name:    "test",
+			Created: created,
+			Big:     fftypes.JSONAnyPtr("9223372036854775808"),
+			Float:   1.5,
+			Count:   10,
+		}, nil
+	})
+	get := func(method, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/test", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res := httptest.NewRecorder()
+		handler(res, req)
+		assert.Equal(t, 200, res.Code)
+		assert.Equal(t, "Accept", res.Header().Get("Vary"))
+		return res
+	}
+
+	// JSON by default, for wildcards, and when nothing registered is acceptable
+	for _, accept := range []string{"", "*/*", "application/json", "text/html, application/*;q=0.5", "application/cbor;q=0.5, application/json", "not a media type"} {
+		res := get(http.MethodGet, accept)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"), accept)
+		var out map[string]interface{}
+		assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &out))
+		assert.Equal(t, "test", out["name"])
+	}
+
+	// YAML has the same structure as the JSON
+	res := get(http.MethodGet, "application/x-yaml")
+	assert.Equal(t, "application/x-yaml", res.Header().Get("Content-Type"))
+	var yamlOut map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(res.Body.Bytes(), &yamlOut))
+	assert.Equal(t, "test", yamlOut["name"])
+	assert.Equal(t, created.String(), yamlOut["created"])
+
+	// CBOR preferred by quality, with integers that do not fit in an int64 as strings
+	res = get(http.MethodGet, "application/json;q=0.9, application/cbor")
+	assert.Equal(t, "application/cbor", res.Header().Get("Content-Type"))
+	var cborOut map[string]interface{}
+	assert.NoError(t, cbor.Unmarshal(res.Body.Bytes(), &cborOut))
+	assert.Equal(t, "test", cborOut["name"])
+	assert.Equal(t, created.String(), cborOut["created"])
+	assert.Equal(t, "9223372036854775808", cborOut["big"])
+	assert.Equal(t, 1.5, cborOut["float"])
+	assert.Equal(t, uint64(10), cborOut["count"])
+
+	// HEAD sets the length without a body
+	res = get(http.MethodHead, "application/cbor")
+	assert.Equal(t, "application/cbor", res.Header().Get("Content-Type"))
+	assert.NotEmpty(t, res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.Bytes())
+
+	// Invalid quality values are ignored
+	res = get(http.MethodGet, "application/cbor;q=high")
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+}
+
+func TestResponseContentNegotiationErrors(t *testing.T) {
+	handler := newEncoderTestHandler(func(r *APIRequest) (output interface{}, err error) {
+		return nil, i18n.NewError(r.Req.Context(), i18n.Msg404NoResult)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Accept", "application/x-yaml")
+	res := httptest.NewRecorder()
+	handler(res, req)
+	assert.Equal(t, 404, res.Code)
+	assert.Equal(t, "application/x-yaml", res.Header().Get("Content-Type"))
+	var yamlOut map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal(res.Body.Bytes(), &yamlOut))
+	assert.Regexp(t, "FF00164", yamlOut["error"])
+
+	hs := newTestHandlerFactory("", nil)
+	hs.ResponseEncoders = map[string]ResponseEncoder{
+		"application/broken": func(v interface{}) ([]byte, error) { return nil, fmt.Errorf("pop") },
+	}
+	handler = hs.RouteHandler(&Route{
+		Name:            "testRoute",
+		Path:            "/test",
+		Method:          http.MethodGet,
+		JSONOutputCodes: []int{200},
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return map[string]interface{}{"some": "data"}, nil
+		},
+	})
+
+	// The encoder fails for the output, and the error falls back to JSON
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Accept", "application/broken")
+	res = httptest.NewRecorder()
+	handler(res, req)
+	assert.Equal(t, 400, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	var jsonOut map[string]interface{}
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &jsonOut))
+	assert.Regexp(t, "FF00165.*pop", jsonOut["error"])
+}
+
+func TestCBORResponseEncoderFail(t *testing.T) {
+	_, err := CBORResponseEncoder(map[bool]interface{}{true: "not in JSON"})
+	assert.Error(t, err)
+}
@@ -28,9 +28,12 @@ import (
 )
 
 type FilterModifiers[T any] interface {
-	// Sort adds a set of sort conditions (all in a single sort order)
+	// Sort adds a set of sort conditions, in priority order. A '-' prefix on a field sorts it descending
 	Sort(...string) T
 
+	// SortFields adds a set of sort conditions, in priority order, each with its own direction
+	SortFields(...*SortField) T
+
 	// GroupBy adds a set of fields to group rows that have the same values into summary rows. Not assured every persistence implementation will support this (doc DBs cannot)
 	GroupBy(...string) T
 
@@ -49,6 +52,9 @@ type FilterModifiers[T any] interface {
 	// Request a count to be returned on the total number that match the query
 	Count(c bool) T
 
+	// Allow the count to be an estimate, where the database can provide one more cheaply than an exact count
+	ApproximateCount(a bool) T
+
 	// Which fields we require to be returned. Only supported when using CRUD layer on top of underlying DB.
 	// Might allow optimization of the query (in the case of SQL DBs, where it can be combined with GroupBy), or request post-query redaction (in the case of document DBs).
 	RequiredFields(...string) T
@@ -161,6 +167,8 @@ type FilterBuilder interface {
 
 	// Fields is the list of available fields
 	Fields() []string
+	// MapFields is the subset of fields that are maps, which are filtered by key as "field.key"
+	MapFields() []string
 	// And requires all sub-filters to match
 	And(and ...Filter) AndFilter
 	// Or requires any of the sub-filters to match
@@ -237,7 +245,9 @@ type FilterInfo struct {
 	Limit          uint64
 	Count          bool
 	CountExpr      string
+	Approximate    bool // set if an approximate count is acceptable
 	Field          string
+	MapKey         string // set when filtering on a key within a MapField
 	FieldMods      []FieldMod
 	Op             FilterOp
 	Values         []FieldSerialization
@@ -247,7 +257,8 @@ type FilterInfo struct {
 
 // FilterResult is has additional info if requested on the query - currently only the total count
 type FilterResult struct {
-	TotalCount *int64
+	TotalCount  *int64
+	Approximate bool // set if the TotalCount is an estimate
 }
 
 func ValueString(f FieldSerialization) string {
@@ -268,6 +279,9 @@ func ValueString(f FieldSerialization) string {
 
 func (f *FilterInfo) filterString() string {
 	fieldName := f.Field
+	if f.MapKey != "" {
+		fieldName = fmt.Sprintf("%s.%s", fieldName, f.MapKey)
+	}
 	for _, fm := range f.FieldMods {
 		if fm == FieldModLower {
 			fieldName = fmt.Sprintf("lower(%s)", fieldName)
@@ -319,7 +333,9 @@ func (f *FilterInfo) String() string {
 	if f.Limit > 0 {
 		val.WriteString(fmt.Sprintf(" limit=%d", f.Limit))
 	}
-	if f.Count {
+	if f.Count && f.Approximate {
+		val.WriteString(" count=approximate")
+	} else if f.Count {
 		val.WriteString(" count=true")
 	}
 
@@ -336,15 +352,47 @@ func (fb *filterBuilder) Fields() []string {
 	return keys
 }
 
+func (fb *filterBuilder) MapFields() []string {
+	keys := make([]string, 0)
+	for k, f := range fb.queryFields {
+		if _, ok := f.(*MapField); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// resolveField finds the query field for a filter, where keys within map fields are addressed as "field.key".
+// Map fields cannot be filtered as a whole.
+func (fb *filterBuilder) resolveField(name string) (field Field, fieldName, mapKey string, err error) {
+	field, ok := fb.queryFields[strings.ToLower(name)]
+	if ok {
+		_, isMap := field.(*MapField)
+		ok = !isMap
+	} else if dot := strings.Index(name, "."); dot > 0 && dot < len(name)-1 {
+		field, ok = fb.queryFields[strings.ToLower(name[0:dot])]
+		if _, isMap := field.(*MapField); ok && isMap {
+			return field, name[0:dot], name[dot+1:], nil
+		}
+		ok = false
+	}
+	if !ok {
+		return nil, "", "", i18n.NewError(fb.ctx, i18n.MsgInvalidFilterField, strings.ToLower(name))
+	}
+	return field, name, "", nil
+}
+
 type filterBuilder struct {
 	ctx             context.Context
 	queryFields     QueryFields
 	sort            []*SortField
+	invalidSort     []string
 	groupBy         []string
 	requiredFields  []string
 	skip            uint64
 	limit           uint64
 	count           bool
+	approximate     bool
 	forceAscending  bool
 	forceDescending bool
 }
@@ -373,6 +421,8 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 	var value FieldSerialization
 	var values []FieldSerialization
 	var mods []FieldMod
+	fieldName := f.field
+	var mapKey string
 
 	switch f.op {
 	case FilterOpAnd, FilterOpOr:
@@ -386,9 +436,9 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 		fValues := f.value.([]driver.Value)
 		values = make([]FieldSerialization, len(fValues))
 		name := strings.ToLower(f.field)
-		field, ok := f.fb.queryFields[name]
-		if !ok {
-			return nil, i18n.NewError(f.fb.ctx, i18n.MsgInvalidFilterField, name)
+		var field Field
+		if field, fieldName, mapKey, err = f.fb.resolveField(f.field); err != nil {
+			return nil, err
 		}
 		mods = fieldMods(field)
 		for i, fv := range fValues {
@@ -399,9 +449,12 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 		}
 	default:
 		name := strings.ToLower(f.field)
-		field, ok := f.fb.queryFields[name]
-		if !ok {
-			return nil, i18n.NewError(f.fb.ctx, i18n.MsgInvalidFilterField, name)
+		var field Field
+		if field, fieldName, mapKey, err = f.fb.resolveField(f.field); err != nil {
+			return nil, err
+		}
+		if mapKey != "" && f.op != FilterOpEq && f.op != FilterOpNeq {
+			return nil, i18n.NewError(f.fb.ctx, i18n.MsgFilterMapFieldOpUnsupported, f.op, name)
 		}
 		mods = fieldMods(field)
 		skipScan := false
@@ -440,6 +493,10 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 		}
 	}
 
+	if len(f.fb.invalidSort) > 0 {
+		return nil, i18n.NewError(f.fb.ctx, i18n.MsgInvalidSortField, strings.Join(f.fb.invalidSort, ","))
+	}
+
 	if f.fb.forceDescending {
 		for _, sf := range f.fb.sort {
 			sf.Descending = true
@@ -453,7 +510,8 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 	return &FilterInfo{
 		Children:       children,
 		Op:             f.op,
-		Field:          f.field,
+		Field:          fieldName,
+		MapKey:         mapKey,
 		FieldMods:      mods,
 		Values:         values,
 		Value:          value,
@@ -463,6 +521,7 @@ func (f *baseFilter) Finalize() (fi *FilterInfo, err error) {
 		Skip:           f.fb.skip,
 		Limit:          f.fb.limit,
 		Count:          f.fb.count,
+		Approximate:    f.fb.approximate,
 	}, nil
 }
 
@@ -473,18 +532,37 @@ func (fb *filterBuilder) Sort(fields ...string) FilterBuilder {
 			field = strings.TrimPrefix(field, "-")
 			descending = true
 		}
+		_ = fb.SortFields(&SortField{
+			Field:      field,
+			Descending: descending,
+		})
+	}
+	return fb
+}
+
+func (f *baseFilter) Sort(fields ...string) Filter {
+	_ = f.fb.Sort(fields...)
+	return f
+}
+
+func (fb *filterBuilder) SortFields(fields ...*SortField) FilterBuilder {
+	for _, sf := range fields {
+		field := strings.ToLower(sf.Field)
 		if _, ok := fb.queryFields[field]; ok {
 			fb.sort = append(fb.sort, &SortField{
 				Field:      field,
-				Descending: descending,
+				Descending: sf.Descending,
+				Nulls:      sf.Nulls,
 			})
+		} else {
+			fb.invalidSort = append(fb.invalidSort, sf.Field)
 		}
 	}
 	return fb
 }
 
-func (f *baseFilter) Sort(fields ...string) Filter {
-	_ = f.fb.Sort(fields...)
+func (f *baseFilter) SortFields(fields ...*SortField) Filter {
+	_ = f.fb.SortFields(fields...)
 	return f
 }
 
@@ -546,6 +624,16 @@ func (f *baseFilter) Count(c bool) Filter {
 	return f
 }
 
+func (fb *filterBuilder) ApproximateCount(a bool) FilterBuilder {
+	fb.approximate = a
+	return fb
+}
+
+func (f *baseFilter) ApproximateCount(a bool) Filter {
+	_ = f.fb.ApproximateCount(a)
+	return f
+}
+
 func (fb *filterBuilder) Ascending() FilterBuilder {
 	fb.forceAscending = true
 	return fb
@@ -357,3 +357,37 @@ func TestStringsForTypes(t *testing.T) {
 	assert.Equal(t, "t1,t2", (&ffNameArrayField{na: fftypes.FFStringArray{"t1", "t2"}}).String())
 	assert.Equal(t, "true", (&boolField{b: true}).String())
 }
+
+func TestBuildMapFieldFilter(t *testing.T) {
+	fb := TestQueryFactory.NewFilter(context.Background())
+	f, err := fb.And(
+		fb.Eq("labels.team", "payments"),
+		fb.Neq("Labels.Env", "prod"),
+		fb.In("labels.purpose", []driver.Value{"a", "b"}),
+		fb.NotIn("labels.purpose", []driver.Value{"c"}),
+	).Finalize()
+	assert.NoError(t, err)
+	assert.Equal(t, "( labels.team == 'payments' ) && ( Labels.Env != 'prod' ) && ( labels.purpose IN ['a','b'] ) && ( labels.purpose NI ['c'] )", f.String())
+	assert.Equal(t, "labels", f.Children[0].Field)
+	assert.Equal(t, "team", f.Children[0].MapKey)
+	assert.Equal(t, "Env", f.Children[1].MapKey)
+	assert.ElementsMatch(t, []string{"labels"}, fb.MapFields())
+}
+
+func TestBuildMapFieldFilterFail(t *testing.T) {
+	fb := TestQueryFactory.NewFilter(context.Background())
+	_, err := fb.Eq("labels", "payments").Finalize()
+	assert.Regexp(t, "FF00142.*labels", err)
+
+	_, err = fb.Eq("labels.", "payments").Finalize()
+	assert.Regexp(t, "FF00142", err)
+
+	_, err = fb.Eq("tag.team", "payments").Finalize()
+	assert.Regexp(t, "FF00142", err)
+
+	_, err = fb.In("labels", []driver.Value{"a"}).Finalize()
+	assert.Regexp(t, "FF00142", err)
+
+	_, err = fb.Contains("labels.team", "pay").Finalize()
+	assert.Regexp(t, "FF00253", err)
+}
@@ -26,23 +26,24 @@ import (
 	"net/url"
 	"path"
 	"reflect"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/sirupsen/logrus"
 )
 
-const FFRequestIDHeader = "X-FireFly-Request-ID"
+const FFRequestIDHeader = httpserver.DefaultRequestIDHeader
 
 type (
 	CtxHeadersKey     struct{}
-	CtxFFRequestIDKey struct{}
+	CtxFFRequestIDKey = httpserver.CtxRequestIDKey
 )
 
 type HandlerFunction func(res http.ResponseWriter, req *http.Request) (status int, err error)
@@ -59,10 +60,12 @@ type HandlerFactory struct {
 	SupportFieldRedaction bool
 	BasePath              string
 	BasePathParams        []*PathParam
+	RateLimiter           *RateLimiter
+	Authorizer            Authorizer                 // called for every route after authentication - nil allows all requests
+	ResponseEncoders      map[string]ResponseEncoder // additional media types that can be negotiated with the Accept header, with JSON the default
+	SSEKeepAlive          time.Duration              // interval of keep-alive comments on idle server-sent events responses - DefaultSSEKeepAlive if zero
 }
 
-var ffMsgCodeExtractor = regexp.MustCompile(`^(FF\d+):`)
-
 type multipartState struct {
 	mpr        *multipart.Reader
 	formParams map[string]string
@@ -146,9 +149,37 @@ func (hs *HandlerFactory) RoutePath(route *Route) string {
 	return path.Join("/", hs.BasePath, route.Path)
 }
 
+// setDeprecationHeaders signals to clients that the route is deprecated, and when it might be removed
+func setDeprecationHeaders(res http.ResponseWriter, route *Route) {
+	res.Header().Set("Deprecation", "true")
+	if route.Sunset != nil {
+		res.Header().Set("Sunset", route.Sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
 func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 	// Check the mandatory parts are ok at startup time
-	return hs.APIWrapper(func(res http.ResponseWriter, req *http.Request) (int, error) {
+	// Server-sent events run until the client disconnects, so have no request timeout
+	return hs.apiWrapper(route.SSEHandler == nil, func(res http.ResponseWriter, req *http.Request) (int, error) {
+
+		if route.Deprecated {
+			setDeprecationHeaders(res, route)
+		}
+		if route.DisableCompression {
+			httpserver.DisableCompression(req.Context())
+		}
+
+		if hs.RateLimiter != nil {
+			if status, err := hs.RateLimiter.checkRequest(res, req, route); err != nil {
+				return status, err
+			}
+		}
+
+		if hs.Authorizer != nil {
+			if status, err := hs.checkAuthorization(req, route); err != nil {
+				return status, err
+			}
+		}
 
 		var jsonInput interface{}
 		if route.JSONInputValue != nil {
@@ -159,7 +190,7 @@ func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 		var multipart *multipartState
 		contentType := req.Header.Get("Content-Type")
 		var err error
-		if req.Method != http.MethodGet && req.Method != http.MethodDelete {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != http.MethodDelete {
 			switch {
 			case strings.HasPrefix(strings.ToLower(contentType), "multipart/form-data") && route.FormUploadHandler != nil:
 				multipart, err = hs.getFilePart(req)
@@ -191,9 +222,16 @@ func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 
 		var status = 400 // if fail parsing input
 		var output interface{}
+		if err == nil && jsonInput != nil {
+			err = ValidateInput(req.Context(), jsonInput)
+		}
 		if err == nil {
 			queryParams, pathParams, queryArrayParams = hs.getParams(req, route)
 		}
+		var boundQueryParams map[string]interface{}
+		if err == nil {
+			boundQueryParams, err = bindQueryParams(req.Context(), route, req.URL.Query())
+		}
 
 		var filter AndFilter
 		if err == nil && route.FilterFactory != nil {
@@ -211,6 +249,9 @@ func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 				SuccessStatus:   http.StatusOK,
 				ResponseHeaders: res.Header(),
 				AlwaysPaginate:  hs.AlwaysPaginate,
+				HeadOnly:        req.Method == http.MethodHead,
+				LastEventID:     req.Header.Get("Last-Event-ID"),
+				QueryParams:     boundQueryParams,
 			}
 			if len(route.JSONOutputCodes) > 0 {
 				r.SuccessStatus = route.JSONOutputCodes[0]
@@ -219,6 +260,11 @@ func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 				r.FP = multipart.formParams
 				r.Part = multipart.part
 				output, err = route.FormUploadHandler(r)
+			} else if route.SSEHandler != nil {
+				var events <-chan *SSEEvent
+				if events, err = route.SSEHandler(r); err == nil {
+					return hs.writeSSE(req, res, events)
+				}
 			} else {
 				output, err = route.JSONHandler(r)
 			}
@@ -233,14 +279,22 @@ func (hs *HandlerFactory) RouteHandler(route *Route) http.HandlerFunc {
 				err = i18n.NewError(req.Context(), i18n.MsgFieldsAfterFile, trailing.FormName())
 			}
 		}
+		if err == nil && len(route.Links) > 0 {
+			if output, err = hs.addLinks(route, pathParams, output); err != nil {
+				return 500, i18n.WrapError(req.Context(), err, i18n.MsgResponseMarshalError)
+			}
+		}
 		if err == nil {
-			status, err = hs.handleOutput(req.Context(), res, status, output)
+			status, err = hs.handleOutput(req, res, status, output)
 		}
 		return status, err
 	})
 }
 
-func (hs *HandlerFactory) handleOutput(ctx context.Context, res http.ResponseWriter, status int, output interface{}) (int, error) {
+func (hs *HandlerFactory) handleOutput(req *http.Request, res http.ResponseWriter, status int, output interface{}) (int, error) {
+	ctx := req.Context()
+	headOnly := req.Method == http.MethodHead
+	mediaType, encoder := hs.negotiateEncoder(req)
 	vOutput := reflect.ValueOf(output)
 	outputKind := vOutput.Kind()
 	isPointer := outputKind == reflect.Ptr
@@ -261,7 +315,34 @@ func (hs *HandlerFactory) handleOutput(ctx context.Context, res http.ResponseWri
 		defer reader.Close()
 		res.Header().Add("Content-Type", "application/octet-stream")
 		res.WriteHeader(status)
-		_, marshalErr = io.Copy(res, reader)
+		if !headOnly {
+			_, marshalErr = io.Copy(res, reader)
+		}
+	case encoder != nil:
+		var b []byte
+		b, marshalErr = encoder(output)
+		if marshalErr == nil {
+			res.Header().Add("Content-Type", mediaType)
+			if res.Header().Get("Content-Length") == "" {
+				res.Header().Set("Content-Length", strconv.Itoa(len(b)))
+			}
+			res.WriteHeader(status)
+			if !headOnly {
+				_, marshalErr = res.Write(b)
+			}
+		}
+	case headOnly:
+		// Marshal the output to calculate the Content-Length, but do not send the body
+		var b []byte
+		b, marshalErr = json.Marshal(output)
+		if marshalErr == nil {
+			res.Header().Add("Content-Type", "application/json")
+			if res.Header().Get("Content-Length") == "" {
+				// json.Encoder adds a trailing newline on the GET response
+				res.Header().Set("Content-Length", strconv.Itoa(len(b)+1))
+			}
+			res.WriteHeader(status)
+		}
 	default:
 		res.Header().Add("Content-Type", "application/json")
 		res.WriteHeader(status)
@@ -303,20 +384,36 @@ func (hs *HandlerFactory) getTimeout(req *http.Request) time.Duration {
 }
 
 func (hs *HandlerFactory) APIWrapper(handler HandlerFunction) http.HandlerFunc {
+	return hs.apiWrapper(true, handler)
+}
+
+func (hs *HandlerFactory) apiWrapper(withTimeout bool, handler HandlerFunction) http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 
-		reqTimeout := hs.getTimeout(req)
-		ctx, cancel := context.WithTimeout(req.Context(), reqTimeout)
-		httpReqID := req.Header.Get(FFRequestIDHeader)
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if withTimeout {
+			ctx, cancel = context.WithTimeout(req.Context(), hs.getTimeout(req))
+		} else {
+			ctx, cancel = context.WithCancel(req.Context())
+		}
+		// Use any ID already assigned to the request by the HTTP server
+		httpReqID := httpserver.GetRequestID(ctx)
 		if httpReqID == "" {
-			httpReqID = fftypes.ShortID()
+			httpReqID = req.Header.Get(FFRequestIDHeader)
+			if httpReqID == "" {
+				httpReqID = fftypes.ShortID()
+			}
+			ctx = httpserver.WithRequestID(ctx, httpReqID)
+			ctx = log.WithLogField(ctx, "httpreq", httpReqID)
 		}
-		ctx = withRequestID(ctx, httpReqID)
 		ctx = withPassthroughHeaders(ctx, req, hs.PassthroughHeaders)
-		ctx = log.WithLogField(ctx, "httpreq", httpReqID)
 
 		req = req.WithContext(ctx)
 		defer cancel()
+		if len(hs.ResponseEncoders) > 0 {
+			res.Header().Add("Vary", "Accept")
+		}
 
 		// Wrap the request itself in a log wrapper, that gives minimal request/response and timing info
 		l := log.L(ctx)
@@ -333,11 +430,10 @@ func (hs *HandlerFactory) APIWrapper(handler HandlerFunction) http.HandlerFunc {
 				status = ffe.HTTPStatus()
 			} else {
 				// Routers don't need to tweak the status code when sending errors.
-				// .. either the FF12345 error they raise is mapped to a status hint
-				ffMsgCodeExtract := ffMsgCodeExtractor.FindStringSubmatch(err.Error())
-				if len(ffMsgCodeExtract) >= 2 {
-					if statusHint, ok := i18n.GetStatusHint(ffMsgCodeExtract[1]); ok {
-						status = statusHint
+				// .. either the FF12345 error they raise is mapped to a status in the error code registry
+				if code, ok := i18n.ErrorCode(err); ok {
+					if info, ok := i18n.GetErrorCodeInfo(code); ok {
+						status = info.HTTPStatus
 					}
 				}
 			}
@@ -358,9 +454,7 @@ func (hs *HandlerFactory) APIWrapper(handler HandlerFunction) http.HandlerFunc {
 				status = 500
 			}
 			l.Infof("<-- %s %s [%d] (%.2fms): %s", req.Method, req.URL.Path, status, durationMS, err)
-			res.Header().Add("Content-Type", "application/json")
-			res.WriteHeader(status)
-			_ = json.NewEncoder(res).Encode(&fftypes.RESTError{
+			hs.writeError(req, res, status, &fftypes.RESTError{
 				Error: err.Error(),
 			})
 		} else {
@@ -369,6 +463,21 @@ func (hs *HandlerFactory) APIWrapper(handler HandlerFunction) http.HandlerFunc {
 	}
 }
 
+// writeError encodes the error in the negotiated format, falling back to JSON
+func (hs *HandlerFactory) writeError(req *http.Request, res http.ResponseWriter, status int, restErr *fftypes.RESTError) {
+	if mediaType, encoder := hs.negotiateEncoder(req); encoder != nil {
+		if b, err := encoder(restErr); err == nil {
+			res.Header().Set("Content-Type", mediaType)
+			res.WriteHeader(status)
+			_, _ = res.Write(b)
+			return
+		}
+	}
+	res.Header().Add("Content-Type", "application/json")
+	res.WriteHeader(status)
+	_ = json.NewEncoder(res).Encode(restErr)
+}
+
 func withPassthroughHeaders(ctx context.Context, req *http.Request, passthroughHeaders []string) context.Context {
 	headers := http.Header{}
 	for _, key := range passthroughHeaders {
@@ -376,7 +485,3 @@ func withPassthroughHeaders(ctx context.Context, req *http.Request, passthroughH
 	}
 	return context.WithValue(ctx, CtxHeadersKey{}, headers)
 }
-
-func withRequestID(ctx context.Context, requestID string) context.Context {
-	return context.WithValue(ctx, CtxFFRequestIDKey{}, requestID)
-}
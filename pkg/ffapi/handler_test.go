@@ -32,8 +32,10 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
 )
 
 const configDir = "../../test/data/config"
@@ -110,6 +112,76 @@ func TestRouteServePOST201WithParams(t *testing.T) {
 	assert.Equal(t, "value2", resJSON["output1"])
 }
 
+func TestRouteDeprecationHeaders(t *testing.T) {
+	sunset := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	handler := func(r *APIRequest) (output interface{}, err error) {
+		return map[string]interface{}{}, nil
+	}
+	s, _, done := newTestServer(t, []*Route{
+		{
+			Name:            "oldRoute",
+			Path:            "/old",
+			Method:          http.MethodGet,
+			JSONOutputCodes: []int{200},
+			JSONHandler:     handler,
+			Deprecated:      true,
+			Sunset:          &sunset,
+		},
+		{
+			Name:            "newRoute",
+			Path:            "/new",
+			Method:          http.MethodGet,
+			JSONOutputCodes: []int{200},
+			JSONHandler:     handler,
+		},
+	}, "", nil)
+	defer done()
+
+	res, err := http.Get(fmt.Sprintf("http://%s/old", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Equal(t, "true", res.Header.Get("Deprecation"))
+	assert.Equal(t, "Fri, 31 Jan 2025 00:00:00 GMT", res.Header.Get("Sunset"))
+
+	res, err = http.Get(fmt.Sprintf("http://%s/new", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.Empty(t, res.Header.Values("Deprecation"))
+	assert.Empty(t, res.Header.Values("Sunset"))
+}
+
+func TestRouteDisableCompression(t *testing.T) {
+	r := mux.NewRouter()
+	hs := newTestHandlerFactory("", nil)
+	handler := func(r *APIRequest) (output interface{}, err error) {
+		return map[string]interface{}{"data": strings.Repeat("a", 2048)}, nil
+	}
+	for _, route := range []*Route{
+		{Name: "compressed", Path: "/compressed", Method: http.MethodGet, JSONOutputCodes: []int{200}, JSONHandler: handler},
+		{Name: "uncompressed", Path: "/uncompressed", Method: http.MethodGet, JSONOutputCodes: []int{200}, JSONHandler: handler, DisableCompression: true},
+	} {
+		r.HandleFunc(hs.RoutePath(route), hs.RouteHandler(route)).Methods(route.Method)
+	}
+	config.RootConfigReset()
+	conf := config.RootSection("ut")
+	httpserver.InitHTTPConfig(conf, 0)
+	conf.Set(httpserver.HTTPConfCompressionEnabled, true)
+	compressing := httpserver.WrapCompressionIfEnabled(context.Background(), conf, r)
+
+	req := httptest.NewRequest(http.MethodGet, "/compressed", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	compressing.ServeHTTP(res, req)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+
+	req = httptest.NewRequest(http.MethodGet, "/uncompressed", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res = httptest.NewRecorder()
+	compressing.ServeHTTP(res, req)
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Contains(t, res.Body.String(), `"data":"aaa`)
+}
+
 func TestJSONHTTPResponseEncodeFail(t *testing.T) {
 	s, _, done := newTestServer(t, []*Route{{
 		Name:            "testRoute",
@@ -202,6 +274,66 @@ func TestStatusCodeHintMapping(t *testing.T) {
 	assert.Regexp(t, "FF00165", resJSON["error"])
 }
 
+var testAppErrorCode = func() i18n.ErrorMessageKey {
+	i18n.RegisterPrefix("TA01", "Test application")
+	key := i18n.FFE(language.AmericanEnglish, "TA01001", "Test application error")
+	i18n.RegisterErrorCode(key, http.StatusTooManyRequests, true)
+	return key
+}()
+
+func TestStatusCodeAppErrorRegistry(t *testing.T) {
+	s, _, done := newTestServer(t, []*Route{{
+		Name:            "testRoute",
+		Path:            "/test",
+		Method:          "GET",
+		JSONInputValue:  nil,
+		JSONOutputValue: func() interface{} { return make(map[string]interface{}) },
+		JSONOutputCodes: []int{200},
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			if r.QP["wrapped"] != "" {
+				return nil, fmt.Errorf("%s: raised by a library", testAppErrorCode)
+			}
+			return nil, i18n.NewError(r.Req.Context(), testAppErrorCode)
+		},
+	}}, "", nil)
+	defer done()
+
+	res, err := http.Get(fmt.Sprintf("http://%s/test", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+	res, err = http.Get(fmt.Sprintf("http://%s/test?wrapped=true", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+	var resJSON map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resJSON)
+	assert.Regexp(t, "TA01001", resJSON["error"])
+}
+
+func TestAPIWrapperRequestID(t *testing.T) {
+	hs := newTestHandlerFactory("", nil)
+	var seen string
+	handler := hs.APIWrapper(func(res http.ResponseWriter, req *http.Request) (int, error) {
+		seen = httpserver.GetRequestID(req.Context())
+		return 200, nil
+	})
+
+	// ID assigned by the HTTP server
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(FFRequestIDHeader, "header-id")
+	handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(httpserver.WithRequestID(req.Context(), "server-id")))
+	assert.Equal(t, "server-id", seen)
+
+	// Passed in the header
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "header-id", seen)
+
+	// Generated
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotEmpty(t, seen)
+	assert.NotEqual(t, "header-id", seen)
+}
+
 func TestFilter(t *testing.T) {
 	s, _, done := newTestServer(t, []*Route{{
 		Name:            "testRoute",
@@ -517,3 +649,145 @@ func TestBasePathParameters(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, 201, res.StatusCode)
 }
+
+func TestRouteServeHEAD(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	handler := hf.RouteHandler(&Route{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: http.MethodGet,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			assert.True(t, r.HeadOnly)
+			return map[string]interface{}{"some": "output"}, nil
+		},
+	})
+
+	res := httptest.NewRecorder()
+	handler(res, httptest.NewRequest(http.MethodHead, "/test", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprintf("%d", len("{\"some\":\"output\"}\n")), res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.Bytes())
+}
+
+func TestRouteServeHEADSkipBody(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	handler := hf.RouteHandler(&Route{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: http.MethodGet,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			if r.HeadOnly {
+				r.ResponseHeaders.Set("Content-Length", "12345")
+				return struct{}{}, nil
+			}
+			return nil, fmt.Errorf("expensive")
+		},
+	})
+
+	res := httptest.NewRecorder()
+	handler(res, httptest.NewRequest(http.MethodHead, "/test", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "12345", res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.Bytes())
+}
+
+func TestRouteServeHEADStream(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	handler := hf.RouteHandler(&Route{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: http.MethodGet,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return io.NopCloser(strings.NewReader("some stream")), nil
+		},
+	})
+
+	res := httptest.NewRecorder()
+	handler(res, httptest.NewRequest(http.MethodHead, "/test", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "application/octet-stream", res.Header().Get("Content-Type"))
+	assert.Empty(t, res.Body.Bytes())
+}
+
+func TestRouteServeHEADMarshalFail(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	handler := hf.RouteHandler(&Route{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: http.MethodGet,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return map[string]interface{}{"unserializable": map[bool]interface{}{true: "not in JSON"}}, nil
+		},
+	})
+
+	res := httptest.NewRecorder()
+	handler(res, httptest.NewRequest(http.MethodHead, "/test", nil))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestTypedQueryParams(t *testing.T) {
+	type queryParams struct {
+		Limit   int64    `json:"limit"`
+		Ratio   float64  `json:"ratio"`
+		Confirm bool     `json:"confirm"`
+		Strict  bool     `json:"strict"`
+		Sort    string   `json:"sort"`
+		Tags    []string `json:"tag"`
+	}
+	s, _, done := newTestServer(t, []*Route{{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: "GET",
+		QueryParams: []*QueryParam{
+			{Name: "limit", Type: QueryParamTypeInteger, Default: "25"},
+			{Name: "ratio", Type: QueryParamTypeNumber, Required: true},
+			{Name: "confirm", IsBool: true},
+			{Name: "strict", Type: QueryParamTypeBoolean},
+			{Name: "sort", Enum: []string{"asc", "desc"}},
+			{Name: "tag", IsArray: true},
+			{Name: "unset"},
+		},
+		JSONInputValue:  nil,
+		JSONOutputValue: func() interface{} { return &queryParams{} },
+		JSONOutputCodes: []int{200},
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			assert.NotContains(t, r.QueryParams, "unset")
+			var qp queryParams
+			err = r.BindQueryParams(&qp)
+			return &qp, err
+		},
+	}}, "", nil)
+	defer done()
+
+	res, err := http.Get(fmt.Sprintf("http://%s/test?ratio=0.5&confirm&sort=desc&tag=a&tag=b", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	var qp queryParams
+	json.NewDecoder(res.Body).Decode(&qp)
+	assert.Equal(t, queryParams{Limit: 25, Ratio: 0.5, Confirm: true, Sort: "desc", Tags: []string{"a", "b"}}, qp)
+
+	// Bool params that do not declare a type are lenient, as before typed params
+	res, err = http.Get(fmt.Sprintf("http://%s/test?ratio=0.5&confirm=maybe&strict=true", s.Addr()))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode)
+	qp = queryParams{}
+	json.NewDecoder(res.Body).Decode(&qp)
+	assert.False(t, qp.Confirm)
+	assert.True(t, qp.Strict)
+
+	for query, errMatch := range map[string]string{
+		"":                        "FF00312.*ratio",
+		"ratio=1&limit=ten":       "FF00311.*ten.*limit.*integer",
+		"ratio=1&strict=maybe":    "FF00311.*maybe.*strict.*boolean",
+		"ratio=1&sort=sideways":   "FF00311.*sideways.*sort.*\\[asc,desc\\]",
+		"ratio=one&sort=sideways": "FF00311.*one.*ratio.*number",
+	} {
+		res, err := http.Get(fmt.Sprintf("http://%s/test?%s", s.Addr(), query))
+		assert.NoError(t, err)
+		assert.Equal(t, 400, res.StatusCode)
+		var resJSON map[string]interface{}
+		json.NewDecoder(res.Body).Decode(&resJSON)
+		assert.Regexp(t, errMatch, resJSON["error"])
+	}
+}
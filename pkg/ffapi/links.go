@@ -0,0 +1,149 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// Link is an entry in the "_links" object added to resources, for routes that declare Links
+type Link struct {
+	Href string `json:"href"`
+}
+
+// matches {name} and {name:pattern} placeholders, as used in Gorilla mux paths
+var linkPlaceholder = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// addLinks returns the JSON of the output, with links added to the resource - or to each resource, if the
+// output is a list or a paginated result. The order of the fields of each resource is retained.
+func (hs *HandlerFactory) addLinks(route *Route, pathParams map[string]string, output interface{}) (interface{}, error) {
+	switch o := output.(type) {
+	case nil, io.ReadCloser:
+		return output, nil
+	case *FilterResultsWithCount:
+		items, err := hs.addLinks(route, pathParams, o.Items)
+		withLinks := *o
+		withLinks.Items = items
+		return &withLinks, err
+	}
+	b, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(b, []byte("{")):
+		return hs.linkResource(route, pathParams, b), nil
+	case bytes.HasPrefix(b, []byte("[")):
+		var resources []json.RawMessage
+		_ = json.Unmarshal(b, &resources) // valid, as produced by json.Marshal
+		for i, r := range resources {
+			resources[i] = hs.linkResource(route, pathParams, r)
+		}
+		return resources, nil
+	default:
+		return output, nil // a null output is still a 404
+	}
+}
+
+// linkResource adds the "_links" object to the JSON object of a resource, unless it already has one.
+// Links with placeholders that cannot be filled are omitted.
+func (hs *HandlerFactory) linkResource(route *Route, pathParams map[string]string, resource json.RawMessage) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(resource, &fields); err != nil || fields == nil || fields["_links"] != nil {
+		return resource
+	}
+	links := make(map[string]*Link, len(route.Links))
+	for rel, template := range route.Links {
+		if href, ok := fillLinkTemplate(path.Join("/", hs.BasePath, template), fields, pathParams); ok {
+			links[rel] = &Link{Href: href}
+		}
+	}
+	if len(links) == 0 {
+		return resource
+	}
+	linksJSON, _ := json.Marshal(links)
+	withLinks := bytes.TrimSuffix(bytes.TrimSpace(resource), []byte("}"))
+	if len(fields) > 0 {
+		withLinks = append(withLinks, ',')
+	}
+	withLinks = append(withLinks, `"_links":`...)
+	withLinks = append(withLinks, linksJSON...)
+	return append(withLinks, '}')
+}
+
+func fillLinkTemplate(template string, fields map[string]json.RawMessage, pathParams map[string]string) (string, bool) {
+	filled := true
+	href := linkPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		name := linkPlaceholder.FindStringSubmatch(placeholder)[1]
+		value := pathParams[name]
+		if raw, ok := fields[name]; ok {
+			var s string
+			var n json.Number
+			if json.Unmarshal(raw, &s) == nil {
+				value = s
+			} else if json.Unmarshal(raw, &n) == nil {
+				value = n.String()
+			}
+		}
+		if value == "" {
+			filled = false
+		}
+		return url.PathEscape(value)
+	})
+	return href, filled
+}
+
+// addLinksToSchema documents the "_links" object on the resource, or the items of a list of resources.
+// The schema is copied, as it might be shared with other routes.
+func addLinksToSchema(ctx context.Context, schemaRef *openapi3.SchemaRef) *openapi3.SchemaRef {
+	if schemaRef == nil || schemaRef.Value == nil {
+		return schemaRef
+	}
+	schema := *schemaRef.Value
+	switch schema.Type {
+	case openapi3.TypeArray:
+		schema.Items = addLinksToSchema(ctx, schema.Items)
+	case openapi3.TypeObject:
+		properties := make(openapi3.Schemas, len(schema.Properties)+1)
+		for name, property := range schema.Properties {
+			properties[name] = property
+		}
+		properties["_links"] = &openapi3.SchemaRef{Value: &openapi3.Schema{
+			Type:        openapi3.TypeObject,
+			Description: i18n.Expand(ctx, i18n.APILinksDesc),
+			AdditionalProperties: openapi3.AdditionalProperties{Schema: &openapi3.SchemaRef{Value: &openapi3.Schema{
+				Type: openapi3.TypeObject,
+				Properties: openapi3.Schemas{
+					"href": &openapi3.SchemaRef{Value: &openapi3.Schema{Type: openapi3.TypeString}},
+				},
+			}}},
+		}}
+		schema.Properties = properties
+	default:
+		return schemaRef
+	}
+	return &openapi3.SchemaRef{Value: &schema}
+}
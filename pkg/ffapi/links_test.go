@@ -0,0 +1,227 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+type linkedThing struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Count int    `json:"count"`
+	Owner string `json:"owner,omitempty"`
+}
+
+var thingLinks = map[string]string{
+	"self":   "/things/{id}",
+	"status": "/things/{id}/status",
+	"owner":  "/owners/{owner}",
+}
+
+func linksTestRequest(t *testing.T, hs *HandlerFactory, route *Route, url string) *httptest.ResponseRecorder {
+	r := mux.NewRouter()
+	r.HandleFunc(hs.RoutePath(route), hs.RouteHandler(route)).Methods(route.Method)
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, url, nil))
+	return res
+}
+
+func TestRouteLinksResource(t *testing.T) {
+	hs := newTestHandlerFactory("/api/v1/namespaces/{ns}", []*PathParam{{Name: "ns"}})
+	route := &Route{
+		Name:            "getThing",
+		Path:            "/things/{thingid}",
+		PathParams:      []*PathParam{{Name: "thingid"}},
+		Method:          http.MethodGet,
+		JSONOutputCodes: []int{http.StatusOK},
+		Links:           thingLinks,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			switch r.PP["thingid"] {
+			case "missing":
+				return (*linkedThing)(nil), nil
+			case "owned":
+				return &linkedThing{ID: "owned", Count: 2, Owner: "org/1"}, nil
+			}
+			return &linkedThing{ID: r.PP["thingid"], Name: "thing 1", Count: 1}, nil
+		},
+	}
+
+	// Links are added after the fields of the resource, and omitted if a placeholder cannot be filled
+	res := linksTestRequest(t, hs, route, "/api/v1/namespaces/ns1/things/t1")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{
+		"id": "t1",
+		"name": "thing 1",
+		"count": 1,
+		"_links": {
+			"self": {"href": "/api/v1/namespaces/ns1/things/t1"},
+			"status": {"href": "/api/v1/namespaces/ns1/things/t1/status"}
+		}
+	}`, res.Body.String())
+	assert.Regexp(t, `^\{"id":"t1","name":"thing 1","count":1,"_links":`, res.Body.String())
+
+	res = linksTestRequest(t, hs, route, "/api/v1/namespaces/ns1/things/owned")
+	assert.Contains(t, res.Body.String(), `"owner":{"href":"/api/v1/namespaces/ns1/owners/org%2F1"}`)
+
+	res = linksTestRequest(t, hs, route, "/api/v1/namespaces/ns1/things/missing")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestRouteLinksList(t *testing.T) {
+	hs := newTestHandlerFactory("", nil)
+	things := []*linkedThing{{ID: "t1"}, {ID: "t2", Owner: "o1"}}
+	route := &Route{
+		Name:            "getThings",
+		Path:            "/things",
+		Method:          http.MethodGet,
+		JSONOutputCodes: []int{http.StatusOK},
+		Links:           thingLinks,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return things, nil
+		},
+	}
+	res := linksTestRequest(t, hs, route, "/things")
+	assert.JSONEq(t, `[
+		{"id": "t1", "count": 0, "_links": {"self": {"href": "/things/t1"}, "status": {"href": "/things/t1/status"}}},
+		{"id": "t2", "count": 0, "owner": "o1", "_links": {"self": {"href": "/things/t2"}, "status": {"href": "/things/t2/status"}, "owner": {"href": "/owners/o1"}}}
+	]`, res.Body.String())
+
+	route.JSONHandler = func(r *APIRequest) (output interface{}, err error) {
+		r.AlwaysPaginate = true
+		return r.FilterResult(things, nil, nil)
+	}
+	res = linksTestRequest(t, hs, route, "/things")
+	assert.JSONEq(t, `{
+		"count": 2,
+		"items": [
+			{"id": "t1", "count": 0, "_links": {"self": {"href": "/things/t1"}, "status": {"href": "/things/t1/status"}}},
+			{"id": "t2", "count": 0, "owner": "o1", "_links": {"self": {"href": "/things/t2"}, "status": {"href": "/things/t2/status"}, "owner": {"href": "/owners/o1"}}}
+		]
+	}`, res.Body.String())
+}
+
+func TestRouteLinksUnchanged(t *testing.T) {
+	hs := newTestHandlerFactory("", nil)
+	route := &Route{
+		Name:            "getThings",
+		Path:            "/things",
+		Method:          http.MethodGet,
+		JSONOutputCodes: []int{http.StatusOK},
+		Links:           map[string]string{"self": "/things/{id}", "all": "/things"},
+	}
+	for output, expected := range map[string]string{
+		`{"id":1.5e3,"_links":{"custom":{}}}`: `{"id":1.5e3,"_links":{"custom":{}}}`,
+		`["not an object",{}]`:                `["not an object",{"_links":{"all":{"href":"/things"}}}]`,
+		`{"id":1500}`:                         `{"id":1500,"_links":{"all":{"href":"/things"},"self":{"href":"/things/1500"}}}`,
+		`"scalar"`:                            `"scalar"`,
+	} {
+		route.JSONHandler = func(r *APIRequest) (interface{}, error) {
+			return jsonRaw(output), nil
+		}
+		res := linksTestRequest(t, hs, route, "/things")
+		assert.JSONEq(t, expected, res.Body.String(), output)
+	}
+
+	route.Links = map[string]string{"self": "/things/{id}"}
+	route.JSONHandler = func(r *APIRequest) (interface{}, error) {
+		return map[string]interface{}{"id": map[string]string{"not": "scalar"}}, nil
+	}
+	res := linksTestRequest(t, hs, route, "/things")
+	assert.JSONEq(t, `{"id":{"not":"scalar"}}`, res.Body.String())
+
+	route.JSONHandler = func(r *APIRequest) (interface{}, error) {
+		return map[string]interface{}{"bad": make(chan struct{})}, nil
+	}
+	res = linksTestRequest(t, hs, route, "/things")
+	assert.Regexp(t, "FF00165", res.Body.String())
+}
+
+type jsonRaw string
+
+func (jr jsonRaw) MarshalJSON() ([]byte, error) {
+	return []byte(jr), nil
+}
+
+func TestRouteLinksSchema(t *testing.T) {
+	routes := []*Route{
+		{
+			Name:            "getThing",
+			Path:            "things/{id}",
+			PathParams:      []*PathParam{{Name: "id"}},
+			Method:          http.MethodGet,
+			JSONOutputValue: func() interface{} { return &TestStruct1{} },
+			JSONOutputCodes: []int{http.StatusOK},
+			Links:           thingLinks,
+		},
+		{
+			Name:            "getThings",
+			Path:            "things",
+			Method:          http.MethodGet,
+			JSONOutputValue: func() interface{} { return []*TestStruct1{} },
+			JSONOutputCodes: []int{http.StatusOK},
+			Links:           thingLinks,
+		},
+		{
+			Name:            "getThingName",
+			Path:            "things/{id}/name",
+			PathParams:      []*PathParam{{Name: "id"}},
+			Method:          http.MethodGet,
+			JSONOutputValue: func() interface{} { return "" },
+			JSONOutputCodes: []int{http.StatusOK},
+			Links:           thingLinks,
+		},
+		{
+			Name:            "getThingUnlinked",
+			Path:            "things/{id}/unlinked",
+			PathParams:      []*PathParam{{Name: "id"}},
+			Method:          http.MethodGet,
+			JSONOutputValue: func() interface{} { return &TestStruct1{} },
+			JSONOutputCodes: []int{http.StatusOK},
+		},
+		{
+			Name:            "deleteThing",
+			Path:            "things/{id}",
+			PathParams:      []*PathParam{{Name: "id"}},
+			Method:          http.MethodDelete,
+			JSONOutputCodes: []int{http.StatusNoContent},
+			Links:           thingLinks,
+		},
+	}
+	doc := NewSwaggerGen(&SwaggerGenOptions{
+		Title:   "UnitTest",
+		Version: "1.0",
+		BaseURL: "http://localhost:12345/api/v1",
+	}).Generate(context.Background(), routes)
+	assert.NoError(t, doc.Validate(context.Background()))
+
+	outputSchema := func(path, method string, status string) *openapi3.Schema {
+		return doc.Paths.Value(path).GetOperation(method).Responses.Value(status).Value.Content.Get("application/json").Schema.Value
+	}
+	assert.NotNil(t, outputSchema("/things/{id}", http.MethodGet, "200").Properties["_links"])
+	assert.NotNil(t, outputSchema("/things/{id}", http.MethodGet, "200").Properties["id"])
+	assert.NotNil(t, outputSchema("/things", http.MethodGet, "200").Items.Value.Properties["_links"])
+	assert.Nil(t, outputSchema("/things/{id}/unlinked", http.MethodGet, "200").Properties["_links"])
+	assert.Equal(t, openapi3.TypeString, outputSchema("/things/{id}/name", http.MethodGet, "200").Type)
+}
@@ -148,9 +148,25 @@ func (sg *SwaggerGen) ffInputTagHandler(ctx context.Context, route *Route, name
 			}
 		}
 	}
+	sg.addValidationToSchema(tag, schema)
 	return sg.ffTagHandler(ctx, route, name, tag, schema)
 }
 
+// addValidationToSchema documents the string length and pattern rules from any ffvalidate tag
+func (sg *SwaggerGen) addValidationToSchema(tag reflect.StructTag, schema *openapi3.Schema) {
+	for _, rule := range parseValidationTag(tag.Get("ffvalidate")) {
+		limit, err := strconv.ParseUint(rule.value, 10, 64)
+		switch {
+		case rule.name == "minlen" && err == nil:
+			schema.MinLength = limit
+		case rule.name == "maxlen" && err == nil:
+			schema.MaxLength = &limit
+		case rule.name == "pattern":
+			schema.Pattern = rule.value
+		}
+	}
+}
+
 func (sg *SwaggerGen) ffOutputTagHandler(ctx context.Context, route *Route, name string, tag reflect.StructTag, schema *openapi3.Schema) error {
 	if sg.isTrue(tag.Get("ffexcludeoutput")) {
 		return &openapi3gen.ExcludeSchemaSentinel{}
@@ -206,10 +222,32 @@ func (sg *SwaggerGen) addCustomType(t reflect.Type, schema *openapi3.Schema) {
 	}
 }
 
+// addOptionalType documents an Optional[T] field as a nullable T
+func (sg *SwaggerGen) addOptionalType(t reflect.Type, schema *openapi3.Schema, customizer openapi3gen.SchemaCustomizerFn) error {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	o, ok := reflect.Zero(t).Interface().(optionalField)
+	if !ok {
+		return nil
+	}
+	valueSchema, err := openapi3gen.NewSchemaRefForValue(o.optionalValue(), nil, openapi3gen.SchemaCustomizer(customizer))
+	if err != nil {
+		return err
+	}
+	*schema = *valueSchema.Value
+	schema.Nullable = true
+	return nil
+}
+
 func (sg *SwaggerGen) addInput(ctx context.Context, doc *openapi3.T, route *Route, op *openapi3.Operation) {
 	var schemaRef *openapi3.SchemaRef
 	var err error
-	schemaCustomizer := func(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	var schemaCustomizer openapi3gen.SchemaCustomizerFn
+	schemaCustomizer = func(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+		if err := sg.addOptionalType(t, schema, schemaCustomizer); err != nil {
+			return err
+		}
 		sg.addCustomType(t, schema)
 		return sg.ffInputTagHandler(ctx, route, name, tag, schema)
 	}
@@ -280,7 +318,11 @@ func (sg *SwaggerGen) addOutput(ctx context.Context, doc *openapi3.T, route *Rou
 	var schemaRef *openapi3.SchemaRef
 	var err error
 	s := i18n.Expand(ctx, i18n.APISuccessResponse)
-	schemaCustomizer := func(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	var schemaCustomizer openapi3gen.SchemaCustomizerFn
+	schemaCustomizer = func(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+		if err := sg.addOptionalType(t, schema, schemaCustomizer); err != nil {
+			return err
+		}
 		sg.addCustomType(t, schema)
 		return sg.ffOutputTagHandler(ctx, route, name, tag, schema)
 	}
@@ -301,12 +343,20 @@ func (sg *SwaggerGen) addOutput(ctx context.Context, doc *openapi3.T, route *Rou
 			}
 		}
 	}
+	if len(route.Links) > 0 {
+		schemaRef = addLinksToSchema(ctx, schemaRef)
+	}
+	// The output of a server-sent events route is the data of each event
+	mediaType := "application/json"
+	if route.SSEHandler != nil {
+		mediaType = "text/event-stream"
+	}
 	for _, code := range route.JSONOutputCodes {
 		op.Responses.Map()[strconv.FormatInt(int64(code), 10)] = &openapi3.ResponseRef{
 			Value: &openapi3.Response{
 				Description: &s,
 				Content: openapi3.Content{
-					"application/json": &openapi3.MediaType{
+					mediaType: &openapi3.MediaType{
 						Schema: schemaRef,
 					},
 				},
@@ -380,6 +430,17 @@ func (sg *SwaggerGen) addFilters(ctx context.Context, route *Route, op *openapi3
 	}
 }
 
+func (sg *SwaggerGen) addDeprecationNotes(ctx context.Context, description string, route *Route) string {
+	notes := []string{description}
+	if route.DeprecationMessage != "" {
+		notes = append(notes, i18n.Expand(ctx, i18n.APIDeprecatedDesc, route.DeprecationMessage))
+	}
+	if route.Sunset != nil {
+		notes = append(notes, i18n.Expand(ctx, i18n.APISunsetDesc, route.Sunset.UTC().Format(time.RFC3339)))
+	}
+	return strings.TrimSpace(strings.Join(notes, "\n\n"))
+}
+
 func (sg *SwaggerGen) addRoute(ctx context.Context, doc *openapi3.T, route *Route) {
 	var routeDescription string
 	pi := sg.getPathItem(doc, route.Path)
@@ -391,6 +452,9 @@ func (sg *SwaggerGen) addRoute(ctx context.Context, doc *openapi3.T, route *Rout
 			log.Panicf(i18n.NewError(ctx, i18n.MsgRouteDescriptionMissing, route.Name).Error())
 		}
 	}
+	if route.Deprecated {
+		routeDescription = sg.addDeprecationNotes(ctx, routeDescription, route)
+	}
 	op := &openapi3.Operation{
 		Description: routeDescription,
 		OperationID: route.Name,
@@ -419,8 +483,13 @@ func (sg *SwaggerGen) addRoute(ctx context.Context, doc *openapi3.T, route *Rout
 			example = config.GetString(q.ExampleFromConf)
 		}
 		sg.addParamInternal(ctx, op, "query", q.Name, q.Default, example, q.IsArray, q.Description, q.Deprecated)
+		documentQueryParam(q, op.Parameters[len(op.Parameters)-1].Value)
+	}
+	if route.SSEHandler != nil {
+		sg.AddParam(ctx, op, "header", "Last-Event-ID", "", "", i18n.APILastEventIDDesc, false)
+	} else {
+		sg.AddParam(ctx, op, "header", "Request-Timeout", sg.options.DefaultRequestTimeout.String(), "", i18n.APIRequestTimeoutDesc, false)
 	}
-	sg.AddParam(ctx, op, "header", "Request-Timeout", sg.options.DefaultRequestTimeout.String(), "", i18n.APIRequestTimeoutDesc, false)
 
 	sg.addFilters(ctx, route, op)
 
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/ghodss/yaml"
@@ -382,6 +383,42 @@ func TestPreTranslatedRouteDescription(t *testing.T) {
 	assert.Equal(t, "this is a description", description)
 }
 
+func TestDeprecatedRoute(t *testing.T) {
+	sunset := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	routes := []*Route{
+		{
+			Name:                     "GetOld",
+			Path:                     "old",
+			Method:                   http.MethodGet,
+			JSONOutputValue:          func() interface{} { return &TestInOutType{} },
+			JSONOutputCodes:          []int{http.StatusOK},
+			PreTranslatedDescription: "gets the old thing",
+			Deprecated:               true,
+			DeprecationMessage:       "use /new instead",
+			Sunset:                   &sunset,
+		},
+		{
+			Name:                     "GetNew",
+			Path:                     "new",
+			Method:                   http.MethodGet,
+			JSONOutputValue:          func() interface{} { return &TestInOutType{} },
+			JSONOutputCodes:          []int{http.StatusOK},
+			PreTranslatedDescription: "gets the new thing",
+		},
+	}
+	swagger := NewSwaggerGen(&SwaggerGenOptions{
+		Title:   "UnitTest",
+		Version: "1.0",
+		BaseURL: "http://localhost:12345/api/v1",
+	}).Generate(context.Background(), routes)
+	old := swagger.Paths.Value("/old").Get
+	assert.True(t, old.Deprecated)
+	assert.Equal(t, "gets the old thing\n\nDeprecated: use /new instead\n\nThis operation might be removed after 2025-01-31T00:00:00Z", old.Description)
+	current := swagger.Paths.Value("/new").Get
+	assert.False(t, current.Deprecated)
+	assert.Equal(t, "gets the new thing", current.Description)
+}
+
 func TestBaseURLVariables(t *testing.T) {
 	doc := NewSwaggerGen(&SwaggerGenOptions{
 		Title:   "UnitTest",
@@ -415,3 +452,46 @@ func TestCheckObjectDocumented(t *testing.T) {
 	}()
 	CheckObjectDocumented(&Undocumented{})
 }
+
+func TestTypedQueryParamsDoc(t *testing.T) {
+	routes := []*Route{
+		{
+			Name:   "op1",
+			Path:   "example1",
+			Method: http.MethodGet,
+			QueryParams: []*QueryParam{
+				{Name: "limit", Type: QueryParamTypeInteger, Default: "25", Description: ExampleDesc},
+				{Name: "sort", Enum: []string{"asc", "desc"}, Required: true, Description: ExampleDesc},
+				{Name: "ids", Type: QueryParamTypeInteger, IsArray: true, Description: ExampleDesc},
+				{Name: "plain", Default: "val1", Description: ExampleDesc},
+			},
+			JSONOutputValue: func() interface{} { return nil },
+			JSONOutputCodes: []int{http.StatusOK},
+		},
+	}
+	swagger := NewSwaggerGen(&SwaggerGenOptions{
+		Title:   "UnitTest",
+		Version: "1.0",
+		BaseURL: "http://localhost:12345/api/v1",
+	}).Generate(context.Background(), routes)
+	params := swagger.Paths.Value("/example1").Get.Parameters
+
+	limit := params.GetByInAndName("query", "limit")
+	assert.False(t, limit.Required)
+	assert.Equal(t, "integer", limit.Schema.Value.Type)
+	assert.Equal(t, int64(25), limit.Schema.Value.Default)
+
+	sort := params.GetByInAndName("query", "sort")
+	assert.True(t, sort.Required)
+	assert.Equal(t, "string", sort.Schema.Value.Type)
+	assert.Equal(t, []interface{}{"asc", "desc"}, sort.Schema.Value.Enum)
+
+	ids := params.GetByInAndName("query", "ids")
+	assert.Equal(t, "array", ids.Schema.Value.Type)
+	assert.Equal(t, "integer", ids.Schema.Value.Items.Value.Type)
+
+	plain := params.GetByInAndName("query", "plain")
+	assert.False(t, plain.Required)
+	assert.Equal(t, "string", plain.Schema.Value.Type)
+	assert.Equal(t, "val1", plain.Schema.Value.Default)
+}
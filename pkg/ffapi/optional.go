@@ -0,0 +1,94 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"encoding/json"
+)
+
+// Optional is a tri-state field for JSON input, such as the body of a PATCH, that distinguishes a field
+// that is absent from the input (leave it unchanged) from one that is explicitly null (clear it),
+// and from one with a value (set it). It is documented in the OpenAPI as a nullable T.
+//
+// Note that an absent field is marshaled as null, as omitempty does not apply to structs.
+type Optional[T any] struct {
+	value   T
+	present bool
+	null    bool
+}
+
+// optionalField allows validation and OpenAPI generation to see through an Optional
+type optionalField interface {
+	IsSet() bool
+	IsNull() bool
+	optionalValue() interface{}
+}
+
+// OptionalValue returns an Optional that is set to the supplied value
+func OptionalValue[T any](v T) Optional[T] {
+	return Optional[T]{value: v, present: true}
+}
+
+// OptionalNull returns an Optional that is explicitly set to null
+func OptionalNull[T any]() Optional[T] {
+	return Optional[T]{present: true, null: true}
+}
+
+// IsSet returns true if the field was present in the input, including if it was null
+func (o Optional[T]) IsSet() bool {
+	return o.present
+}
+
+// IsNull returns true if the field was present in the input as an explicit null
+func (o Optional[T]) IsNull() bool {
+	return o.present && o.null
+}
+
+// Get returns the value, and true only if the field was present with a non-null value
+func (o Optional[T]) Get() (T, bool) {
+	return o.value, o.present && !o.null
+}
+
+// Value returns the value, which is the zero value of T if the field was absent or null
+func (o Optional[T]) Value() T {
+	return o.value
+}
+
+func (o Optional[T]) optionalValue() interface{} {
+	return o.value
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	// only called when the field is present in the input
+	var v T
+	o.present = true
+	o.null = string(b) == "null"
+	if !o.null {
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+	}
+	o.value = v
+	return nil
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.present || o.null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.value)
+}
@@ -0,0 +1,122 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type utPatch struct {
+	Name    Optional[string]          `ffstruct:"utPatch" json:"name" ffvalidate:"maxlen=5"`
+	Created Optional[*fftypes.FFTime] `ffstruct:"utPatch" json:"created"`
+	Nested  Optional[*utNested]       `ffstruct:"utPatch" json:"nested"`
+}
+
+type utNested struct {
+	Key string `ffstruct:"utNested" json:"key" ffvalidate:"required"`
+}
+
+func TestOptionalUnmarshal(t *testing.T) {
+	var p utPatch
+	err := json.Unmarshal([]byte(`{"name":"abc","created":null}`), &p)
+	assert.NoError(t, err)
+
+	name, ok := p.Name.Get()
+	assert.True(t, ok)
+	assert.Equal(t, "abc", name)
+	assert.True(t, p.Name.IsSet())
+	assert.False(t, p.Name.IsNull())
+
+	assert.True(t, p.Created.IsSet())
+	assert.True(t, p.Created.IsNull())
+	_, ok = p.Created.Get()
+	assert.False(t, ok)
+	assert.Nil(t, p.Created.Value())
+
+	assert.False(t, p.Nested.IsSet())
+	assert.False(t, p.Nested.IsNull())
+
+	err = json.Unmarshal([]byte(`{"name":12345}`), &p)
+	assert.Error(t, err)
+}
+
+func TestOptionalMarshal(t *testing.T) {
+	b, err := json.Marshal(&utPatch{
+		Name:    OptionalValue("abc"),
+		Created: OptionalNull[*fftypes.FFTime](),
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"abc","created":null,"nested":null}`, string(b))
+}
+
+func TestOptionalValidate(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, ValidateInput(ctx, &utPatch{}))
+	assert.NoError(t, ValidateInput(ctx, &utPatch{Name: OptionalValue("abc")}))
+	assert.Regexp(t, "FF00135.*name", ValidateInput(ctx, &utPatch{Name: OptionalValue("abcdef")}))
+	assert.Regexp(t, "FF00112.*nested.key", ValidateInput(ctx, &utPatch{Nested: OptionalValue(&utNested{})}))
+
+	type utRequired struct {
+		Field Optional[string] `json:"field" ffvalidate:"required"`
+	}
+	assert.Regexp(t, "FF00112", ValidateInput(ctx, &utRequired{}))
+	assert.NoError(t, ValidateInput(ctx, &utRequired{Field: OptionalNull[string]()}))
+}
+
+func TestOptionalOpenAPI(t *testing.T) {
+	doc := NewSwaggerGen(&SwaggerGenOptions{
+		Title:   "UnitTest",
+		Version: "1.0",
+		BaseURL: "http://localhost:12345/api/v1",
+	}).Generate(context.Background(), []*Route{{
+		Name:            "patchThing",
+		Path:            "things",
+		Method:          http.MethodPatch,
+		JSONInputValue:  func() interface{} { return &utPatch{} },
+		JSONOutputValue: func() interface{} { return &utPatch{} },
+		JSONOutputCodes: []int{http.StatusOK},
+	}})
+	op := doc.Paths.Value("/things").Patch
+	for _, schema := range []*openapi3.SchemaRef{
+		op.RequestBody.Value.Content.Get("application/json").Schema,
+		op.Responses.Status(http.StatusOK).Value.Content.Get("application/json").Schema,
+	} {
+		name := schema.Value.Properties["name"].Value
+		assert.Equal(t, "string", name.Type)
+		assert.True(t, name.Nullable)
+		assert.Equal(t, "utPatch.name", name.Description)
+
+		created := schema.Value.Properties["created"].Value
+		assert.Equal(t, "string", created.Type)
+		assert.Equal(t, "date-time", created.Format)
+		assert.True(t, created.Nullable)
+
+		nested := schema.Value.Properties["nested"].Value
+		assert.Equal(t, "object", nested.Type)
+		assert.True(t, nested.Nullable)
+		assert.Equal(t, "utNested.key", nested.Properties["key"].Value.Description)
+	}
+	inputName := op.RequestBody.Value.Content.Get("application/json").Schema.Value.Properties["name"].Value
+	assert.Equal(t, uint64(5), *inputName.MaxLength)
+}
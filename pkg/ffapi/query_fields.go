@@ -376,6 +376,14 @@ func (f *JSONField) GetSerialization() FieldSerialization { return &jsonField{}
 func (f *JSONField) FilterAsString() bool                 { return true }
 func (f *JSONField) Description() string                  { return "JSON-blob" }
 
+// MapField is a JSON object of string keys to string values, such as a set of labels.
+// Filters address an individual key as "field.key", and only support equality matching.
+type MapField struct{}
+
+func (f *MapField) GetSerialization() FieldSerialization { return &stringField{} }
+func (f *MapField) FilterAsString() bool                 { return true }
+func (f *MapField) Description() string                  { return "Map" }
+
 type FFStringArrayField struct{}
 type ffNameArrayField struct{ na fftypes.FFStringArray }
 
@@ -0,0 +1,155 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// QueryParamType is the type a query parameter is parsed as, and documented as in the OpenAPI spec
+type QueryParamType string
+
+const (
+	QueryParamTypeString  QueryParamType = "string"
+	QueryParamTypeInteger QueryParamType = "integer"
+	QueryParamTypeNumber  QueryParamType = "number"
+	QueryParamTypeBoolean QueryParamType = "boolean"
+)
+
+func (qp *QueryParam) paramType() QueryParamType {
+	switch {
+	case qp.Type != "":
+		return qp.Type
+	case qp.IsBool:
+		return QueryParamTypeBoolean
+	default:
+		return QueryParamTypeString
+	}
+}
+
+// validated is true for params that declare a Type, Required or Enum. Others are bound leniently as they were
+// before these could be declared, so a bool param is false for any value other than true, rather than invalid.
+func (qp *QueryParam) validated() bool {
+	return qp.Type != "" || qp.Required || len(qp.Enum) > 0
+}
+
+// parseValue validates a single value of the parameter against its type and allowed values,
+// returning it as a string, int64, float64 or bool
+func (qp *QueryParam) parseValue(ctx context.Context, val string) (v interface{}, err error) {
+	if len(qp.Enum) > 0 && !containsString(qp.Enum, val) {
+		return nil, i18n.NewError(ctx, i18n.MsgInvalidQueryParam, val, qp.Name, "["+strings.Join(qp.Enum, ",")+"]")
+	}
+	switch qp.paramType() {
+	case QueryParamTypeInteger:
+		v, err = strconv.ParseInt(val, 10, 64)
+	case QueryParamTypeNumber:
+		v, err = strconv.ParseFloat(val, 64)
+	case QueryParamTypeBoolean:
+		v, err = strconv.ParseBool(val)
+	default:
+		v = val
+	}
+	if err != nil {
+		return nil, i18n.NewError(ctx, i18n.MsgInvalidQueryParam, val, qp.Name, qp.paramType())
+	}
+	return v, nil
+}
+
+func containsString(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
+
+// bindQueryParams parses the declared query parameters of the route, applying defaults, into a map of typed values.
+// Array parameters are bound as a slice of the type. Parameters that are not supplied, and have no default, are omitted.
+// Only parameters that declare a Type, Required or Enum are rejected if invalid.
+func bindQueryParams(ctx context.Context, route *Route, query map[string][]string) (map[string]interface{}, error) {
+	bound := make(map[string]interface{})
+	for _, qp := range route.QueryParams {
+		vals, exists := query[qp.Name]
+		if qp.IsBool && exists && (len(vals) == 0 || vals[0] == "") {
+			// a bool param can be supplied without a value, such as ?confirm
+			vals = []string{"true"}
+		}
+		if !exists || len(vals) == 0 {
+			if qp.Default == "" {
+				if qp.Required {
+					return nil, i18n.NewError(ctx, i18n.MsgMissingQueryParam, qp.Name)
+				}
+				continue
+			}
+			vals = []string{qp.Default}
+		}
+		if !qp.IsArray {
+			vals = vals[0:1]
+		}
+		values := make([]interface{}, len(vals))
+		for i, val := range vals {
+			if qp.IsBool && !qp.validated() {
+				values[i] = strings.EqualFold(val, "true")
+				continue
+			}
+			v, err := qp.parseValue(ctx, val)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		if qp.IsArray {
+			bound[qp.Name] = values
+		} else {
+			bound[qp.Name] = values[0]
+		}
+	}
+	return bound, nil
+}
+
+// BindQueryParams copies the typed values of the query parameters declared on the route into a struct,
+// matching the names of the parameters to the JSON names of its fields
+func (r *APIRequest) BindQueryParams(v interface{}) error {
+	b, _ := json.Marshal(r.QueryParams)
+	return json.Unmarshal(b, v)
+}
+
+// documentQueryParam adds the type, allowed values and required flag to the OpenAPI parameter generated for a
+// query parameter, if declared
+func documentQueryParam(qp *QueryParam, param *openapi3.Parameter) {
+	param.Required = qp.Required
+	schema := param.Schema.Value
+	if qp.IsArray {
+		schema = schema.Items.Value
+	}
+	if qp.Type != "" {
+		schema.Type = string(qp.Type)
+		if qp.Default != "" {
+			schema.Default, _ = qp.parseValue(context.Background(), qp.Default)
+		}
+	}
+	for _, e := range qp.Enum {
+		schema.Enum = append(schema.Enum, e)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// RateLimit defines a token bucket, that refills at RequestsPerSecond up to a maximum of Burst requests
+type RateLimit struct {
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// RateLimiter applies a token bucket per caller, keyed on the authenticated principal
+// where one was set by the auth plugin, or the remote IP address otherwise.
+// The number of buckets held in memory is bounded, with the least recently used evicted.
+type RateLimiter struct {
+	defaultLimit RateLimit
+	maxBuckets   int
+	mux          sync.Mutex
+	buckets      map[string]*list.Element
+	lru          *list.List
+}
+
+type rateLimitBucket struct {
+	key      string
+	limit    *RateLimit
+	tokens   float64
+	lastFill time.Time
+}
+
+func NewRateLimiter(defaultLimit RateLimit, maxBuckets int) *RateLimiter {
+	if maxBuckets <= 0 {
+		maxBuckets = 1
+	}
+	return &RateLimiter{
+		defaultLimit: defaultLimit,
+		maxBuckets:   maxBuckets,
+		buckets:      make(map[string]*list.Element),
+		lru:          list.New(),
+	}
+}
+
+// NewRateLimiterFromConfig returns nil if rate limiting is not enabled in the config, and none
+// of the supplied routes declares its own RateLimit
+func NewRateLimiterFromConfig(conf config.Section, routes ...*Route) *RateLimiter {
+	rps := conf.GetFloat64(ConfAPIRateLimitRequestsPerSecond)
+	if rps <= 0 && !hasRouteRateLimit(routes) {
+		return nil
+	}
+	return NewRateLimiter(RateLimit{
+		RequestsPerSecond: rps,
+		Burst:             conf.GetInt(ConfAPIRateLimitBurst),
+	}, conf.GetInt(ConfAPIRateLimitMaxClients))
+}
+
+func hasRouteRateLimit(routes []*Route) bool {
+	for _, route := range routes {
+		if route.RateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func rateLimitKey(req *http.Request) string {
+	if principal := auth.GetPrincipal(req.Context()); principal != "" {
+		return "principal:" + principal
+	}
+	if clientIP := httpserver.GetClientIP(req.Context()); clientIP != "" {
+		return "ip:" + clientIP
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Allow takes a token from the bucket for the caller of the request, returning false and
+// the duration until a token will be available if the limit has been exceeded.
+// Routes with a RateLimit override have their own buckets, separate from the default.
+func (rl *RateLimiter) Allow(req *http.Request, route *Route) (bool, time.Duration) {
+	key := rateLimitKey(req)
+	limit := &rl.defaultLimit
+	if route != nil && route.RateLimit != nil {
+		key = route.Name + "|" + key
+		limit = route.RateLimit
+	}
+	if limit.RequestsPerSecond <= 0 {
+		return true, 0
+	}
+
+	rl.mux.Lock()
+	defer rl.mux.Unlock()
+	now := time.Now()
+	b := rl.getBucket(key, limit, now)
+
+	b.tokens = math.Min(float64(b.burst()), b.tokens+now.Sub(b.lastFill).Seconds()*limit.RequestsPerSecond)
+	b.lastFill = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / limit.RequestsPerSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func (rl *RateLimiter) getBucket(key string, limit *RateLimit, now time.Time) *rateLimitBucket {
+	if e, ok := rl.buckets[key]; ok {
+		rl.lru.MoveToFront(e)
+		return e.Value.(*rateLimitBucket)
+	}
+	for rl.lru.Len() >= rl.maxBuckets {
+		oldest := rl.lru.Back()
+		rl.lru.Remove(oldest)
+		delete(rl.buckets, oldest.Value.(*rateLimitBucket).key)
+	}
+	b := &rateLimitBucket{key: key, limit: limit, lastFill: now}
+	b.tokens = float64(b.burst())
+	rl.buckets[key] = rl.lru.PushFront(b)
+	return b
+}
+
+func (b *rateLimitBucket) burst() int {
+	if b.limit.Burst > 0 {
+		return b.limit.Burst
+	}
+	return int(math.Max(1, math.Ceil(b.limit.RequestsPerSecond)))
+}
+
+func (rl *RateLimiter) checkRequest(res http.ResponseWriter, req *http.Request, route *Route) (int, error) {
+	allowed, retryAfter := rl.Allow(req, route)
+	if !allowed {
+		res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		return http.StatusTooManyRequests, i18n.NewError(req.Context(), i18n.MsgRateLimitExceeded)
+	}
+	return 0, nil
+}
@@ -0,0 +1,169 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/httpserver"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRateLimitTestRequest(remoteAddr, principal string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.RemoteAddr = remoteAddr
+	if principal != "" {
+		req = req.WithContext(context.WithValue(req.Context(), auth.CtxPrincipalKey{}, principal))
+	}
+	return req
+}
+
+func TestRateLimiterKeyedByPrincipalOrIP(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerSecond: 0.001, Burst: 1}, 10)
+
+	ok, _ := rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", "user1"), nil)
+	assert.True(t, ok)
+	ok, retryAfter := rl.Allow(newRateLimitTestRequest("10.0.0.2:1234", "user1"), nil)
+	assert.False(t, ok)
+	assert.Greater(t, retryAfter.Seconds(), float64(0))
+
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), nil)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:5678", ""), nil)
+	assert.False(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("bad-addr", ""), nil)
+	assert.True(t, ok)
+}
+
+func TestRateLimiterKeyedByClientIP(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerSecond: 0.001, Burst: 1}, 10)
+
+	// two clients behind the same proxy have separate limits
+	req := newRateLimitTestRequest("10.0.0.1:1234", "")
+	ok, _ := rl.Allow(req.WithContext(httpserver.WithClientIP(req.Context(), "192.0.2.1")), nil)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(req.WithContext(httpserver.WithClientIP(req.Context(), "192.0.2.2")), nil)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(req.WithContext(httpserver.WithClientIP(req.Context(), "192.0.2.1")), nil)
+	assert.False(t, ok)
+}
+
+func TestRateLimiterRouteOverride(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerSecond: 0.001, Burst: 1}, 10)
+	unlimited := &Route{Name: "unlimited", RateLimit: &RateLimit{}}
+	burst2 := &Route{Name: "burst2", RateLimit: &RateLimit{RequestsPerSecond: 1.5}}
+
+	for i := 0; i < 5; i++ {
+		ok, _ := rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), unlimited)
+		assert.True(t, ok)
+	}
+	ok, _ := rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), burst2)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), burst2)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), burst2)
+	assert.False(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), nil)
+	assert.True(t, ok)
+}
+
+func TestRateLimiterLRUEviction(t *testing.T) {
+	rl := NewRateLimiter(RateLimit{RequestsPerSecond: 0.001, Burst: 1}, 0)
+
+	ok, _ := rl.Allow(newRateLimitTestRequest("", "user1"), nil)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("", "user2"), nil)
+	assert.True(t, ok)
+	assert.Equal(t, 1, rl.lru.Len())
+	assert.Len(t, rl.buckets, 1)
+
+	// user1 was evicted, so gets a fresh bucket
+	ok, _ = rl.Allow(newRateLimitTestRequest("", "user1"), nil)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("", "user1"), nil)
+	assert.False(t, ok)
+}
+
+func TestRateLimiterFromConfig(t *testing.T) {
+	config.RootConfigReset()
+	apiConf := config.RootSection("ut.api")
+	InitAPIServerConfig(apiConf, config.RootSection("ut.metrics"), config.RootSection("ut.cors"))
+	rlConf := apiConf.SubSection("rateLimit")
+	assert.Nil(t, NewRateLimiterFromConfig(rlConf))
+
+	rlConf.Set(ConfAPIRateLimitRequestsPerSecond, 10)
+	rl := NewRateLimiterFromConfig(rlConf)
+	assert.Equal(t, float64(10), rl.defaultLimit.RequestsPerSecond)
+	assert.Equal(t, 10000, rl.maxBuckets)
+}
+
+func TestRateLimiterFromConfigRouteOnly(t *testing.T) {
+	config.RootConfigReset()
+	apiConf := config.RootSection("ut.api")
+	InitAPIServerConfig(apiConf, config.RootSection("ut.metrics"), config.RootSection("ut.cors"))
+	rlConf := apiConf.SubSection("rateLimit")
+	unlimited := &Route{Name: "unlimited"}
+	limited := &Route{Name: "limited", RateLimit: &RateLimit{RequestsPerSecond: 0.5, Burst: 1}}
+	assert.Nil(t, NewRateLimiterFromConfig(rlConf, unlimited))
+
+	// The per-route limit applies, even though there is no server-wide limit
+	rl := NewRateLimiterFromConfig(rlConf, unlimited, limited)
+	assert.NotNil(t, rl)
+	ok, _ := rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), limited)
+	assert.True(t, ok)
+	ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), limited)
+	assert.False(t, ok)
+
+	// Other routes are not limited
+	for i := 0; i < 5; i++ {
+		ok, _ = rl.Allow(newRateLimitTestRequest("10.0.0.1:1234", ""), unlimited)
+		assert.True(t, ok)
+	}
+}
+
+func TestRouteHandlerRateLimited(t *testing.T) {
+	hf := newTestHandlerFactory("", nil)
+	hf.RateLimiter = NewRateLimiter(RateLimit{RequestsPerSecond: 0.5, Burst: 1}, 10)
+	handler := hf.RouteHandler(&Route{
+		Name:   "testRoute",
+		Path:   "/test",
+		Method: http.MethodGet,
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			return map[string]interface{}{}, nil
+		},
+	})
+
+	res := httptest.NewRecorder()
+	handler(res, newRateLimitTestRequest("10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = httptest.NewRecorder()
+	handler(res, newRateLimitTestRequest("10.0.0.1:1234", ""))
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "2", res.Header().Get("Retry-After"))
+	var resErr fftypes.RESTError
+	err := json.NewDecoder(res.Body).Decode(&resErr)
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF00243", resErr.Error)
+}
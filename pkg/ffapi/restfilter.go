@@ -39,6 +39,19 @@ func (hs *HandlerFactory) getValues(values url.Values, key string) (results []st
 	return results
 }
 
+// mapFieldKeys finds the query parameters that filter on a key within a map field, as "field.key"
+func (hs *HandlerFactory) mapFieldKeys(values url.Values, mapFields []string) (results []string) {
+	for queryName := range values {
+		for _, f := range mapFields {
+			if len(queryName) > len(f)+1 && strings.EqualFold(queryName[0:len(f)+1], f+".") {
+				results = append(results, queryName)
+			}
+		}
+	}
+	sort.Strings(results)
+	return results
+}
+
 func ParseFilterParam(ctx context.Context, fb FilterBuilder, field string, values []string) (Filter, error) {
 	if len(values) == 1 {
 		_, cond, err := getCondition(ctx, fb, field, values[0])
@@ -86,6 +99,13 @@ func (hs *HandlerFactory) buildFilter(req *http.Request, ff QueryFactory) (AndFi
 			filter.Condition(f)
 		}
 	}
+	for _, field := range hs.mapFieldKeys(req.Form, fb.MapFields()) {
+		f, err := ParseFilterParam(ctx, fb, field, req.Form[field])
+		if err != nil {
+			return nil, err
+		}
+		filter.Condition(f)
+	}
 	skipVals := hs.getValues(req.Form, "skip")
 	if len(skipVals) > 0 {
 		s, _ := strconv.ParseUint(skipVals[0], 10, 64)
@@ -132,7 +152,9 @@ func (hs *HandlerFactory) buildFilter(req *http.Request, ff QueryFactory) (AndFi
 		filter.Ascending()
 	}
 	countVals := hs.getValues(req.Form, "count")
-	filter.Count(len(countVals) > 0 && (countVals[0] == "" || strings.EqualFold(countVals[0], "true")))
+	approximateCount := len(countVals) > 0 && strings.EqualFold(countVals[0], "approximate")
+	filter.Count(len(countVals) > 0 && (countVals[0] == "" || strings.EqualFold(countVals[0], "true") || approximateCount))
+	filter.ApproximateCount(approximateCount)
 	return filter, nil
 }
 
@@ -31,9 +31,10 @@ var allMods = []string{"not", "caseInsensitive"}
 var justCaseInsensitive = []string{"caseInsensitive"}
 
 type FilterResultsWithCount struct {
-	Count int64       `json:"count"`
-	Total *int64      `json:"total,omitempty"` // omitted if a count was not calculated (AlwaysPaginate enabled, and count not specified)
-	Items interface{} `json:"items"`
+	Count            int64       `json:"count"`
+	Total            *int64      `json:"total,omitempty"`            // omitted if a count was not calculated (AlwaysPaginate enabled, and count not specified)
+	TotalApproximate bool        `json:"totalApproximate,omitempty"` // set if the total is an estimate, which is only returned with count=approximate
+	Items            interface{} `json:"items"`
 }
 
 type filterModifiers struct {
@@ -125,17 +126,51 @@ func (jq *QueryJSON) BuildFilter(ctx context.Context, qf QueryFactory) (Filter,
 		fb = fb.Limit(*jq.Limit)
 	}
 	for _, s := range jq.Sort {
-		fb = fb.Sort(s)
+		sf, err := parseJSONSortField(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		fb = fb.SortFields(sf)
 	}
 	return jq.BuildSubFilter(ctx, fb, &jq.FilterJSON)
 }
 
+// parseJSONSortField accepts "field", "-field", or "field asc|ascending|desc|descending"
+func parseJSONSortField(ctx context.Context, s string) (*SortField, error) {
+	parts := strings.Fields(s)
+	if len(parts) == 0 || len(parts) > 2 {
+		return nil, i18n.NewError(ctx, i18n.MsgJSONQuerySortUnsupported, s)
+	}
+	sf := &SortField{Field: parts[0]}
+	if strings.HasPrefix(sf.Field, "-") {
+		sf.Field = strings.TrimPrefix(sf.Field, "-")
+		sf.Descending = true
+	}
+	if len(parts) == 2 {
+		switch strings.ToLower(parts[1]) {
+		case "asc", "ascending":
+			sf.Descending = false
+		case "desc", "descending":
+			sf.Descending = true
+		default:
+			return nil, i18n.NewError(ctx, i18n.MsgJSONQuerySortUnsupported, parts[1])
+		}
+	}
+	return sf, nil
+}
+
 func validateFilterField(ctx context.Context, fb FilterBuilder, fieldAnyCase string) (string, error) {
 	for _, f := range fb.Fields() {
 		if strings.EqualFold(fieldAnyCase, f) {
 			return f, nil
 		}
 	}
+	for _, f := range fb.MapFields() {
+		if len(fieldAnyCase) > len(f)+1 && strings.EqualFold(fieldAnyCase[0:len(f)+1], f+".") {
+			// Keys within a map are case sensitive
+			return f + fieldAnyCase[len(f):], nil
+		}
+	}
 	return "", i18n.NewError(ctx, i18n.MsgInvalidFilterField, fieldAnyCase)
 }
 
@@ -485,3 +485,80 @@ func TestBuildQueryJSONBadFields(t *testing.T) {
 func TestBuildQueryJSONDocumented(t *testing.T) {
 	CheckObjectDocumented(&QueryJSON{})
 }
+
+func TestBuildQueryJSONSortOrder(t *testing.T) {
+
+	var qf QueryJSON
+	err := json.Unmarshal([]byte(`{
+		"sort": [
+			"created asc",
+			"tag DESC",
+			"-sequence ascending"
+		]
+	}`), &qf)
+	assert.NoError(t, err)
+
+	filter, err := qf.BuildFilter(context.Background(), TestQueryFactory)
+	assert.NoError(t, err)
+
+	fi, err := filter.Finalize()
+	assert.NoError(t, err)
+	assert.Equal(t, []*SortField{
+		{Field: "created"},
+		{Field: "tag", Descending: true},
+		{Field: "sequence"},
+	}, fi.Sort)
+}
+
+func TestBuildQueryJSONSortBadOrder(t *testing.T) {
+
+	var qf QueryJSON
+	err := json.Unmarshal([]byte(`{"sort": ["created sideways"]}`), &qf)
+	assert.NoError(t, err)
+	_, err = qf.BuildFilter(context.Background(), TestQueryFactory)
+	assert.Regexp(t, "FF00242.*sideways", err)
+
+	err = json.Unmarshal([]byte(`{"sort": ["too many words"]}`), &qf)
+	assert.NoError(t, err)
+	_, err = qf.BuildFilter(context.Background(), TestQueryFactory)
+	assert.Regexp(t, "FF00242", err)
+}
+
+func TestBuildQueryJSONSortBadField(t *testing.T) {
+
+	var qf QueryJSON
+	err := json.Unmarshal([]byte(`{"sort": ["wrong"]}`), &qf)
+	assert.NoError(t, err)
+	filter, err := qf.BuildFilter(context.Background(), TestQueryFactory)
+	assert.NoError(t, err)
+	_, err = filter.Finalize()
+	assert.Regexp(t, "FF00244.*wrong", err)
+}
+
+func TestBuildQueryJSONMapField(t *testing.T) {
+
+	var qf QueryJSON
+	err := json.Unmarshal([]byte(`{
+		"equal": [
+			{
+				"field": "LABELS.Team",
+				"value": "payments"
+			}
+		],
+		"in": [
+			{
+				"field": "labels.env",
+				"values": ["dev","test"]
+			}
+		]
+	}`), &qf)
+	assert.NoError(t, err)
+
+	filter, err := qf.BuildFilter(context.Background(), TestQueryFactory)
+	assert.NoError(t, err)
+
+	fi, err := filter.Finalize()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "( labels.Team == 'payments' ) && ( labels.env IN ['dev','test'] )", fi.String())
+}
@@ -108,6 +108,13 @@ func testFailFilter(t *testing.T, queryString, errCode string) {
 	assert.Regexp(t, errCode, err)
 }
 
+func TestBuildFilterCount(t *testing.T) {
+	testIndividualFilter(t, "tag=cat&count", "( tag == 'cat' ) count=true")
+	testIndividualFilter(t, "tag=cat&count=true", "( tag == 'cat' ) count=true")
+	testIndividualFilter(t, "tag=cat&count=approximate", "( tag == 'cat' ) count=approximate")
+	testIndividualFilter(t, "tag=cat&count=false", "( tag == 'cat' )")
+}
+
 func TestCheckNoMods(t *testing.T) {
 	testFailFilter(t, "tag=!>=test", "FF00193")
 	testFailFilter(t, "tag=:>test", "FF00193")
@@ -164,3 +171,8 @@ func TestBuildFilterRequiredFields(t *testing.T) {
 
 	assert.Equal(t, "( created == 0 ) requiredFields=tag,sequence", fi.String())
 }
+
+func TestBuildFilterMapField(t *testing.T) {
+	testIndividualFilter(t, "labels.team=payments", "( labels.team == 'payments' )")
+	testIndividualFilter(t, "Labels.Team=!payments&labels.env=dev&labels.env=test", "( Labels.Team != 'payments' ) && ( ( labels.env == 'dev' ) || ( labels.env == 'test' ) )")
+}
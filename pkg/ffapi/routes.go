@@ -18,6 +18,7 @@ package ffapi
 
 import (
 	"context"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/hyperledger/firefly-common/pkg/config"
@@ -67,10 +68,26 @@ type Route struct {
 	JSONHandler func(r *APIRequest) (output interface{}, err error)
 	// FormUploadHandler takes a single file upload, and returns a JSON object
 	FormUploadHandler func(r *APIRequest) (output interface{}, err error)
-	// Deprecated whether this route is deprecated
+	// SSEHandler streams server-sent events to the client from the returned channel, until it is closed or the client disconnects.
+	// The source of the events must stop, without blocking on the channel, once the context of the request is done
+	SSEHandler func(r *APIRequest) (events <-chan *SSEEvent, err error)
+	// Deprecated whether this route is deprecated - adds a Deprecation header to responses
 	Deprecated bool
+	// DeprecationMessage is a note added to the description of a deprecated route, such as the route that replaces it
+	DeprecationMessage string
+	// Sunset is the time after which a deprecated route might be removed - adds a Sunset header to responses
+	Sunset *time.Time
+	// DisableCompression stops the responses of this route being compressed, where compression is enabled on the server
+	DisableCompression bool
+	// Links are templates for a "_links" object added to each resource in the JSON output, keyed by the relation such as "self".
+	// Each is a path relative to the base path of the server, with {field} placeholders filled from the fields of the resource, or the path params
+	Links map[string]string
 	// Tag a category identifier for this route in the generated OpenAPI spec
 	Tag string
+	// RateLimit overrides the server-wide rate limit for this route, with separate buckets per caller
+	RateLimit *RateLimit
+	// Permission is the permission or scope required to call this route, passed to the Authorizer of the server
+	Permission string
 	// Extensions allows extension of the route struct by individual microservices
 	Extensions interface{}
 }
@@ -107,6 +124,12 @@ type QueryParam struct {
 	Description i18n.MessageKey
 	// Deprecated whether this param is deprecated
 	Deprecated bool
+	// Type is the type the value must parse as, when bound into APIRequest.QueryParams - string if not set (bool for IsBool)
+	Type QueryParamType
+	// Required params return a 400 error if not supplied (a Default is used instead if set)
+	Required bool
+	// Enum is the list of allowed values, if restricted
+	Enum []string
 }
 
 // FormParam is a description of a multi-part form parameter
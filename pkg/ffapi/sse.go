@@ -0,0 +1,160 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// DefaultSSEKeepAlive is the interval of the keep-alive comments sent on an idle server-sent events response
+const DefaultSSEKeepAlive = 15 * time.Second
+
+// SSEEvent is a server-sent event, written to the client of a route with an SSEHandler
+type SSEEvent struct {
+	// ID is sent to the client, which passes the last one it received in the Last-Event-ID header when it reconnects (see APIRequest.LastEventID)
+	ID string
+	// Event is the type of the event, which is "message" if not set
+	Event string
+	// Data is sent as-is if it is a string or []byte, and otherwise as JSON
+	Data interface{}
+}
+
+// flushableWriter is passed on by middleware (such as the metrics middleware) that wraps the
+// response writer without support for flushing, which server-sent events require
+type flushableWriter struct {
+	http.ResponseWriter
+	inner http.ResponseWriter
+}
+
+func (w *flushableWriter) Flush() {
+	_ = http.NewResponseController(w.inner).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the other features of the writer, such as write deadlines
+func (w *flushableWriter) Unwrap() http.ResponseWriter {
+	return w.inner
+}
+
+func flushableMiddleware(middleware func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			middleware(http.HandlerFunc(func(wrapped http.ResponseWriter, req *http.Request) {
+				next.ServeHTTP(&flushableWriter{ResponseWriter: wrapped, inner: res}, req)
+			})).ServeHTTP(res, req)
+		})
+	}
+}
+
+func (e *SSEEvent) frame() ([]byte, error) {
+	var data []byte
+	switch d := e.Data.(type) {
+	case string:
+		data = []byte(d)
+	case []byte:
+		data = d
+	default:
+		var err error
+		if data, err = json.Marshal(d); err != nil {
+			return nil, err
+		}
+	}
+	var buf bytes.Buffer
+	// newlines are not allowed in the id or event type, as they end the field
+	if e.ID != "" {
+		buf.WriteString("id: " + strings.NewReplacer("\r", "", "\n", "").Replace(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + strings.NewReplacer("\r", "", "\n", "").Replace(e.Event) + "\n")
+	}
+	// each line of the data is a separate field, which the client joins with newlines
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// writeSSE writes the events from the channel to the response until it is closed, or the client disconnects.
+// The request context is cancelled when this returns, which must stop the source of the events.
+// Once the response has started errors cannot be returned to the client, so are only logged.
+func (hs *HandlerFactory) writeSSE(req *http.Request, res http.ResponseWriter, events <-chan *SSEEvent) (int, error) {
+	ctx := req.Context()
+	rc := http.NewResponseController(res)
+	// the write timeout of the server would end the response
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		log.L(ctx).Debugf("Unable to clear write deadline for server-sent events: %s", err)
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("Connection", "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no") // disable buffering in nginx
+	res.WriteHeader(http.StatusOK)
+
+	write := func(b []byte) bool {
+		if _, err := res.Write(b); err != nil {
+			log.L(ctx).Debugf("Server-sent events client disconnected: %s", err)
+			return false
+		}
+		if err := rc.Flush(); err != nil {
+			log.L(ctx).Errorf("Unable to flush server-sent events: %s", err)
+			return false
+		}
+		return true
+	}
+	if !write([]byte(": connected\n\n")) {
+		return http.StatusOK, nil
+	}
+
+	keepAlive := hs.SSEKeepAlive
+	if keepAlive <= 0 {
+		keepAlive = DefaultSSEKeepAlive
+	}
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.L(ctx).Debugf("Server-sent events ended by client")
+			return http.StatusOK, nil
+		case <-ticker.C:
+			if !write([]byte(": keep-alive\n\n")) {
+				return http.StatusOK, nil
+			}
+		case event, ok := <-events:
+			if !ok {
+				log.L(ctx).Debugf("Server-sent events complete")
+				return http.StatusOK, nil
+			}
+			b, err := event.frame()
+			if err != nil {
+				log.L(ctx).Errorf("Unable to serialize server-sent event: %s", err)
+				continue
+			}
+			if !write(b) {
+				return http.StatusOK, nil
+			}
+			ticker.Reset(keepAlive)
+		}
+	}
+}
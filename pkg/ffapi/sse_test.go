@@ -0,0 +1,199 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/metric"
+	"github.com/stretchr/testify/assert"
+)
+
+type sseTestSource struct {
+	count   int
+	stopped chan struct{}
+}
+
+func (s *sseTestSource) route() *Route {
+	return &Route{
+		Name:            "utSSE",
+		Path:            "ut/events",
+		Method:          http.MethodGet,
+		Description:     i18n.APISuccessResponse,
+		JSONOutputValue: func() interface{} { return &sampleOutput{} },
+		JSONOutputCodes: []int{http.StatusOK},
+		Extensions: &APIServerRouteExt[*utManager]{
+			SSEHandler: func(r *APIRequest, um *utManager) (<-chan *SSEEvent, error) {
+				if r.LastEventID == "bad" {
+					return nil, i18n.NewError(r.Req.Context(), i18n.Msg404NoResult)
+				}
+				from, _ := strconv.Atoi(r.LastEventID)
+				events := make(chan *SSEEvent)
+				go func() {
+					defer close(s.stopped)
+					defer close(events)
+					for i := from + 1; i <= from+s.count; i++ {
+						select {
+						case events <- &SSEEvent{ID: strconv.Itoa(i), Event: "thing", Data: &sampleOutput{Output1: fmt.Sprintf("value%d", i)}}:
+						case <-r.Req.Context().Done():
+							return
+						}
+					}
+					if s.count < 0 {
+						// keep running until the client disconnects
+						<-r.Req.Context().Done()
+					}
+				}()
+				return events, nil
+			},
+		},
+	}
+}
+
+func newTestSSEServer(t *testing.T, source *sseTestSource) (string, func()) {
+	apiConfig, metricsConfig, corsConfig := initUTConfig()
+	apiConfig.Set(ConfAPISSEKeepAlive, "10ms")
+	apiConfig.Set(ConfAPIRequestTimeout, "1ms") // does not apply to server-sent events
+	um := &utManager{t: t}
+	as := NewAPIServer(context.Background(), APIServerOptions[*utManager]{
+		MetricsRegistry: metric.NewPrometheusMetricsRegistry("ut"),
+		Routes:          []*Route{source.route()},
+		EnrichRequest:   func(r *APIRequest) (*utManager, error) { return um, nil },
+		Description:     "unit testing",
+		APIConfig:       apiConfig,
+		MetricsConfig:   metricsConfig,
+		CORSConfig:      corsConfig,
+	})
+	server := httptest.NewServer(as.MuxRouter(context.Background()))
+	return server.URL + "/api/v1/ut/events", server.Close
+}
+
+func TestSSEEventsAndResume(t *testing.T) {
+	source := &sseTestSource{count: 2, stopped: make(chan struct{})}
+	url, done := newTestSSEServer(t, source)
+	defer done()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Last-Event-ID", "5")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+
+	// The response ends when the channel is closed
+	var body strings.Builder
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if !strings.HasPrefix(scanner.Text(), ": keep-alive") {
+			body.WriteString(scanner.Text() + "\n")
+		}
+	}
+	assert.Equal(t, ": connected\n\n"+
+		"id: 6\nevent: thing\ndata: {\"output1\":\"value6\"}\n\n"+
+		"id: 7\nevent: thing\ndata: {\"output1\":\"value7\"}\n\n", body.String())
+	<-source.stopped
+}
+
+func TestSSEKeepAliveAndDisconnect(t *testing.T) {
+	source := &sseTestSource{count: -1, stopped: make(chan struct{})}
+	url, done := newTestSSEServer(t, source)
+	defer done()
+
+	res, err := http.Get(url)
+	assert.NoError(t, err)
+	scanner := bufio.NewScanner(res.Body)
+	keepAlives := 0
+	for keepAlives < 2 && scanner.Scan() {
+		if scanner.Text() == ": keep-alive" {
+			keepAlives++
+		}
+	}
+	assert.Equal(t, 2, keepAlives)
+
+	// Disconnecting stops the source
+	res.Body.Close()
+	select {
+	case <-source.stopped:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "source not stopped on disconnect")
+	}
+}
+
+func TestSSEHandlerError(t *testing.T) {
+	source := &sseTestSource{stopped: make(chan struct{})}
+	url, done := newTestSSEServer(t, source)
+	defer done()
+
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Last-Event-ID", "bad")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
+
+func TestSSEEventFrame(t *testing.T) {
+	b, err := (&SSEEvent{Data: "line1\r\nline2\nline3"}).frame()
+	assert.NoError(t, err)
+	assert.Equal(t, "data: line1\ndata: line2\ndata: line3\n\n", string(b))
+
+	b, err = (&SSEEvent{ID: "id\n1", Event: "type\r1", Data: []byte("raw")}).frame()
+	assert.NoError(t, err)
+	assert.Equal(t, "id: id1\nevent: type1\ndata: raw\n\n", string(b))
+
+	_, err = (&SSEEvent{Data: map[bool]bool{true: true}}).frame()
+	assert.Error(t, err)
+}
+
+func TestSSEMarshalErrorSkipped(t *testing.T) {
+	hf := &HandlerFactory{}
+	events := make(chan *SSEEvent, 2)
+	events <- &SSEEvent{Data: map[bool]bool{true: true}}
+	events <- &SSEEvent{Data: "ok"}
+	close(events)
+	res := httptest.NewRecorder()
+	status, err := hf.writeSSE(httptest.NewRequest(http.MethodGet, "/", nil), res, events)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, ": connected\n\ndata: ok\n\n", res.Body.String())
+}
+
+func TestSSEOpenAPI(t *testing.T) {
+	source := &sseTestSource{stopped: make(chan struct{})}
+	route := source.route()
+	route.SSEHandler = func(r *APIRequest) (<-chan *SSEEvent, error) { return nil, nil }
+	doc := NewSwaggerGen(&SwaggerGenOptions{
+		Title:   "UnitTest",
+		Version: "1.0",
+		BaseURL: "http://localhost:12345/api/v1",
+	}).Generate(context.Background(), []*Route{route})
+	op := doc.Paths.Find("/ut/events").Get
+	assert.NotNil(t, op.Responses.Value("200").Value.Content["text/event-stream"])
+	assert.Equal(t, "Last-Event-ID", op.Parameters[0].Value.Name)
+}
@@ -36,6 +36,7 @@ var TestQueryFactory = &QueryFields{
 	"topics":   &FFStringArrayField{},
 	"type":     &StringField{},
 	"address":  &StringFieldLower{},
+	"labels":   &MapField{},
 }
 
 func TestUpdateBuilderOK(t *testing.T) {
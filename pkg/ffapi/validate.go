@@ -0,0 +1,215 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// validationRule is a single parsed entry from an ffvalidate tag
+type validationRule struct {
+	name  string
+	value string
+}
+
+var validationPatterns sync.Map // cache of compiled pattern= regular expressions
+
+// parseValidationTag splits an ffvalidate tag into its rules. Because a regular expression
+// can contain commas, pattern= consumes the remainder of the tag so must be the last rule.
+func parseValidationTag(tag string) []validationRule {
+	var rules []validationRule
+	for tag != "" {
+		if strings.HasPrefix(tag, "pattern=") {
+			rules = append(rules, validationRule{name: "pattern", value: strings.TrimPrefix(tag, "pattern=")})
+			break
+		}
+		entry, remaining, _ := strings.Cut(tag, ",")
+		name, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if name != "" {
+			rules = append(rules, validationRule{name: name, value: value})
+		}
+		tag = remaining
+	}
+	return rules
+}
+
+func getValidationPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := validationPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	validationPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// ValidateInput enforces the ffvalidate struct tags on an input value, returning an error
+// naming the first offending field (using its JSON name). Nested structs, pointers and slices
+// are checked recursively. Supported rules are:
+//   - required: the field must be set to a non-zero value
+//   - minlen=N / maxlen=N: bounds on the length of a string, in bytes
+//   - ffname / ffnamenouuid / safechars: the standard FireFly name validations
+//   - pattern=REGEXP: the string must match the regular expression (must be the last rule)
+//
+// Rules other than required are only applied to strings that are set.
+func ValidateInput(ctx context.Context, input interface{}) error {
+	if input == nil {
+		return nil
+	}
+	return validateValue(ctx, reflect.ValueOf(input), "")
+}
+
+func validateValue(ctx context.Context, v reflect.Value, path string) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if o, ok := asOptional(v); ok {
+			return validateValue(ctx, reflect.ValueOf(o.optionalValue()), path)
+		}
+		return validateStruct(ctx, v, path)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(ctx, v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateStruct(ctx context.Context, v reflect.Value, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			// Exported fields of embedded structs are promoted in JSON, even if the struct type is not exported
+			continue
+		}
+		fieldPath := path
+		if !field.Anonymous {
+			jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if jsonName == "-" {
+				continue
+			}
+			if jsonName == "" {
+				jsonName = field.Name
+			}
+			if fieldPath != "" {
+				fieldPath += "."
+			}
+			fieldPath += jsonName
+		}
+		fv := v.Field(i)
+		if tag, ok := field.Tag.Lookup("ffvalidate"); ok {
+			if err := validateField(ctx, fv, fieldPath, parseValidationTag(tag)); err != nil {
+				return err
+			}
+		}
+		if err := validateValue(ctx, fv, fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func asOptional(v reflect.Value) (optionalField, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	o, ok := v.Interface().(optionalField)
+	return o, ok
+}
+
+func validateField(ctx context.Context, fv reflect.Value, fieldPath string, rules []validationRule) error {
+	isSet := !fv.IsZero()
+	if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Map {
+		isSet = fv.Len() > 0
+	}
+	if o, ok := asOptional(fv); ok {
+		// an Optional is set if it is present, including as null, and the rules apply to its value
+		isSet = o.IsSet()
+		fv = reflect.ValueOf(o.optionalValue())
+	}
+	for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+		fv = fv.Elem()
+	}
+	str, isString := "", fv.Kind() == reflect.String
+	if isString {
+		str = fv.String()
+	}
+	for _, rule := range rules {
+		var err error
+		switch rule.name {
+		case "required":
+			if !isSet {
+				err = i18n.NewError(ctx, i18n.MsgMissingRequiredField, fieldPath)
+			}
+		case "minlen", "maxlen":
+			limit, parseErr := strconv.Atoi(rule.value)
+			switch {
+			case parseErr != nil:
+				err = i18n.NewError(ctx, i18n.MsgInvalidValidationTag, rule.name, fieldPath)
+			case isString && str != "" && rule.name == "minlen" && len(str) < limit:
+				err = i18n.NewError(ctx, i18n.MsgFieldTooShort, fieldPath, limit)
+			case isString && rule.name == "maxlen":
+				err = fftypes.ValidateLength(ctx, str, fieldPath, limit)
+			}
+		case "pattern":
+			re, reErr := getValidationPattern(rule.value)
+			switch {
+			case reErr != nil:
+				err = i18n.NewError(ctx, i18n.MsgInvalidValidationTag, rule.name, fieldPath)
+			case isString && str != "" && !re.MatchString(str):
+				err = i18n.NewError(ctx, i18n.MsgFieldPatternMismatch, fieldPath, rule.value)
+			}
+		case "ffname":
+			if isString && str != "" {
+				err = fftypes.ValidateFFNameField(ctx, str, fieldPath)
+			}
+		case "ffnamenouuid":
+			if isString && str != "" {
+				err = fftypes.ValidateFFNameFieldNoUUID(ctx, str, fieldPath)
+			}
+		case "safechars":
+			if isString && str != "" {
+				err = fftypes.ValidateSafeCharsOnly(ctx, str, fieldPath)
+			}
+		default:
+			err = i18n.NewError(ctx, i18n.MsgInvalidValidationTag, rule.name, fieldPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type validateTestItem struct {
+	Key string `json:"key" ffvalidate:"required,safechars"`
+}
+
+type validateTestEmbedded struct {
+	Label string `json:"label,omitempty" ffvalidate:"minlen=2,maxlen=5"`
+}
+
+type validateTestInput struct {
+	validateTestEmbedded
+	Name     string              `json:"name" ffvalidate:"required,ffname"`
+	Alias    *string             `json:"alias,omitempty" ffvalidate:"ffnamenouuid"`
+	Code     string              `json:"code,omitempty" ffvalidate:"pattern=^[A-Z]{2,3}(,[A-Z]{2,3})*$"`
+	Items    []*validateTestItem `json:"items,omitempty"`
+	Child    *validateTestItem   `json:"child,omitempty"`
+	Tags     []string            `json:"tags" ffvalidate:"required"`
+	Ignored  string              `json:"-" ffvalidate:"required"`
+	NoJSON   string              `ffvalidate:"maxlen=1"`
+	internal string
+}
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateInputOk(t *testing.T) {
+	err := ValidateInput(context.Background(), &validateTestInput{
+		validateTestEmbedded: validateTestEmbedded{Label: "abc"},
+		Name:                 "good-name",
+		Alias:                strPtr("alias1"),
+		Code:                 "AB,CDE",
+		Items:                []*validateTestItem{{Key: "k1"}, nil},
+		Tags:                 []string{"t1"},
+		internal:             "unchecked",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, ValidateInput(context.Background(), nil))
+	assert.NoError(t, ValidateInput(context.Background(), map[string]interface{}{"any": "thing"}))
+}
+
+func TestValidateInputErrors(t *testing.T) {
+	valid := func() *validateTestInput {
+		return &validateTestInput{Name: "name1", Tags: []string{"t1"}}
+	}
+	for _, tc := range []struct {
+		modify func(v *validateTestInput)
+		errMsg string
+	}{
+		{func(v *validateTestInput) { v.Name = "" }, "FF00112.*'name'"},
+		{func(v *validateTestInput) { v.Name = "-bad" }, "FF00140.*'name'"},
+		{func(v *validateTestInput) { v.Tags = []string{} }, "FF00112.*'tags'"},
+		{func(v *validateTestInput) { v.Label = "a" }, "FF00246.*'label'"},
+		{func(v *validateTestInput) { v.Label = "abcdef" }, "FF00135.*'label'"},
+		{func(v *validateTestInput) { v.Alias = strPtr(fftypes.NewUUID().String()) }, "FF00141.*'alias'"},
+		{func(v *validateTestInput) { v.Code = "ab" }, "FF00247.*'code'"},
+		{func(v *validateTestInput) { v.Items = []*validateTestItem{{Key: "ok"}, {Key: ""}} }, "FF00112.*'items\\[1\\].key'"},
+		{func(v *validateTestInput) { v.Child = &validateTestItem{Key: "not safe"} }, "FF00139.*'child.key'"},
+		{func(v *validateTestInput) { v.NoJSON = "too long" }, "FF00135.*'NoJSON'"},
+	} {
+		v := valid()
+		tc.modify(v)
+		err := ValidateInput(context.Background(), v)
+		assert.Regexp(t, tc.errMsg, err)
+	}
+}
+
+func TestValidateInputBadTags(t *testing.T) {
+	ctx := context.Background()
+	err := ValidateInput(ctx, &struct {
+		Field string `json:"field" ffvalidate:"unknown"`
+	}{})
+	assert.Regexp(t, "FF00248.*unknown.*field", err)
+
+	err = ValidateInput(ctx, &struct {
+		Field string `json:"field" ffvalidate:"maxlen=lots"`
+	}{})
+	assert.Regexp(t, "FF00248.*maxlen", err)
+
+	err = ValidateInput(ctx, &struct {
+		Field string `json:"field" ffvalidate:"pattern=["`
+	}{})
+	assert.Regexp(t, "FF00248.*pattern", err)
+}
+
+func TestParseValidationTag(t *testing.T) {
+	assert.Equal(t, []validationRule{
+		{name: "required"},
+		{name: "maxlen", value: "64"},
+		{name: "pattern", value: "^a,b$"},
+	}, parseValidationTag("required, maxlen=64,,pattern=^a,b$"))
+	assert.Empty(t, parseValidationTag(""))
+}
+
+func TestAddValidationToSchema(t *testing.T) {
+	sg := &SwaggerGen{}
+	schema := &openapi3.Schema{}
+	sg.addValidationToSchema(`ffvalidate:"required,minlen=1,maxlen=64,pattern=^[a-z]+$"`, schema)
+	assert.Equal(t, uint64(1), schema.MinLength)
+	assert.Equal(t, uint64(64), *schema.MaxLength)
+	assert.Equal(t, "^[a-z]+$", schema.Pattern)
+}
+
+func TestJSONHTTPServeValidationFail(t *testing.T) {
+	s, _, done := newTestServer(t, []*Route{{
+		Name:            "testRoute",
+		Path:            "/test",
+		Method:          "POST",
+		JSONInputValue:  func() interface{} { return &validateTestInput{} },
+		JSONOutputValue: func() interface{} { return make(map[string]interface{}) },
+		JSONOutputCodes: []int{200},
+		JSONHandler: func(r *APIRequest) (output interface{}, err error) {
+			assert.Fail(t, "should not be called")
+			return nil, nil
+		},
+	}}, "", nil)
+	defer done()
+
+	b, _ := json.Marshal(map[string]interface{}{"name": "bad name", "tags": []string{"t1"}})
+	res, err := http.Post(fmt.Sprintf("http://%s/test", s.Addr()), "application/json", bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, res.StatusCode)
+	var resJSON map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&resJSON)
+	assert.Regexp(t, "FF00140.*'name'", resJSON["error"])
+}
@@ -0,0 +1,113 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// bulkheadTransport limits the number of in-flight requests to each host, so that a single slow
+// host cannot consume all the capacity of a client shared across many hosts.
+// A request holds its slot until the response body is closed, as the connection is in use until then.
+// Requests to a host that is at its limit wait up to the queue timeout for a slot, or fail
+// immediately if the queue timeout is zero.
+type bulkheadTransport struct {
+	base         http.RoundTripper
+	maxPerHost   int
+	queueTimeout time.Duration
+	mux          sync.Mutex
+	hosts        map[string]chan struct{}
+}
+
+func newBulkheadTransport(base http.RoundTripper, maxPerHost int, queueTimeout time.Duration) *bulkheadTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &bulkheadTransport{
+		base:         base,
+		maxPerHost:   maxPerHost,
+		queueTimeout: queueTimeout,
+		hosts:        make(map[string]chan struct{}),
+	}
+}
+
+func (t *bulkheadTransport) hostSlots(host string) chan struct{} {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	slots, ok := t.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, t.maxPerHost)
+		t.hosts[host] = slots
+	}
+	return slots
+}
+
+func (t *bulkheadTransport) acquire(req *http.Request, slots chan struct{}) error {
+	ctx := req.Context()
+	select {
+	case slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if t.queueTimeout > 0 {
+		log.L(ctx).Debugf("Waiting for one of %d request slots for host %s", t.maxPerHost, req.URL.Host)
+		timer := time.NewTimer(t.queueTimeout)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+			return nil
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return i18n.NewError(ctx, i18n.MsgRESTHostBusy, req.URL.Host, t.maxPerHost)
+}
+
+func (t *bulkheadTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := t.hostSlots(req.URL.Host)
+	if err := t.acquire(req, slots); err != nil {
+		return nil, err
+	}
+	release := func() { <-slots }
+	res, err := t.base.RoundTrip(req)
+	if err != nil || res.Body == nil {
+		release()
+		return res, err
+	}
+	res.Body = &releasingBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// releasingBody returns the slot of the request to the bulkhead once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
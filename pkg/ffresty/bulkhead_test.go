@@ -0,0 +1,167 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBulkheadTestServer() (*httptest.Server, chan struct{}, chan struct{}) {
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/slow" {
+			arrived <- struct{}{}
+			<-release
+		}
+		res.WriteHeader(http.StatusOK)
+	}))
+	return server, arrived, release
+}
+
+func TestBulkheadFailFast(t *testing.T) {
+	slowServer, arrived, release := newBulkheadTestServer()
+	defer slowServer.Close()
+	fastServer, _, _ := newBulkheadTestServer()
+	defer fastServer.Close()
+
+	c := NewWithConfig(context.Background(), Config{
+		HTTPConfig: HTTPConfig{
+			BulkheadMaxRequestsPerHost: 1,
+		},
+	})
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := c.R().Get(slowServer.URL + "/slow")
+		slowDone <- err
+	}()
+	<-arrived
+
+	// The slow host is at its limit
+	_, err := c.R().Get(slowServer.URL + "/slow")
+	assert.Regexp(t, "FF00300", err)
+
+	// Other hosts are unaffected
+	res, err := c.R().Get(fastServer.URL + "/fast")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+
+	// The slot is returned once the slow request completes
+	close(release)
+	assert.NoError(t, <-slowDone)
+	res, err = c.R().Get(slowServer.URL + "/fast")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	server, arrived, release := newBulkheadTestServer()
+	defer server.Close()
+
+	c := NewWithConfig(context.Background(), Config{
+		HTTPConfig: HTTPConfig{
+			BulkheadMaxRequestsPerHost: 1,
+			BulkheadQueueTimeout:       fftypes.FFDuration(10 * time.Second),
+		},
+	})
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.R().Get(server.URL + "/slow")
+			done <- err
+		}()
+	}
+	<-arrived
+
+	// The second request waits for the first to complete, rather than failing
+	select {
+	case <-arrived:
+		assert.Fail(t, "second request was not queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release <- struct{}{}
+	assert.NoError(t, <-done)
+	<-arrived
+	close(release)
+	assert.NoError(t, <-done)
+}
+
+func TestBulkheadQueueTimeout(t *testing.T) {
+	server, arrived, release := newBulkheadTestServer()
+	defer server.Close()
+	defer close(release)
+
+	c := NewWithConfig(context.Background(), Config{
+		HTTPConfig: HTTPConfig{
+			BulkheadMaxRequestsPerHost: 1,
+			BulkheadQueueTimeout:       fftypes.FFDuration(10 * time.Millisecond),
+		},
+	})
+
+	go func() {
+		_, _ = c.R().Get(server.URL + "/slow")
+	}()
+	<-arrived
+
+	_, err := c.R().Get(server.URL + "/slow")
+	assert.Regexp(t, "FF00300", err)
+
+	// A cancelled context stops the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bt := newBulkheadTransport(nil, 1, 10*time.Second)
+	req := httptest.NewRequest(http.MethodGet, server.URL, nil).WithContext(ctx)
+	bt.hostSlots(req.URL.Host) <- struct{}{}
+	_, err = bt.RoundTrip(req)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestBulkheadTransportError(t *testing.T) {
+	bt := newBulkheadTransport(nil, 1, 0)
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:1/", nil)
+	req.RequestURI = ""
+	_, err := bt.RoundTrip(req)
+	assert.Error(t, err)
+	// The slot is returned on error
+	assert.Empty(t, bt.hostSlots(req.URL.Host))
+}
+
+func TestBulkheadConfig(t *testing.T) {
+	resetConf()
+	utConf.Set(HTTPConfigURL, "http://localhost:12345")
+	utConf.Set(HTTPConfigBulkheadMaxRequestsPerHost, 5)
+	utConf.Set(HTTPConfigBulkheadQueueTimeout, "0")
+	conf, err := GenerateConfig(context.Background(), utConf)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, conf.BulkheadMaxRequestsPerHost)
+	assert.Zero(t, conf.BulkheadQueueTimeout)
+
+	resetConf()
+	conf, err = GenerateConfig(context.Background(), utConf)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultBulkheadMaxRequestsPerHost, conf.BulkheadMaxRequestsPerHost)
+	assert.Equal(t, 10*time.Second, time.Duration(conf.BulkheadQueueTimeout))
+}
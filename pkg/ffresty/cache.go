@@ -0,0 +1,296 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/karlseguin/ccache"
+)
+
+type cacheBypassKey struct{}
+
+// WithCacheBypass returns a context that, when set on a request, causes the response
+// cache to be skipped for that request - both for lookup, and for storing the response
+func WithCacheBypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheBypassKey{}, true)
+}
+
+// The request headers that can change the response for a given URL, so are included in the cache key.
+// Responses that vary on any other request header are not cached.
+var cacheKeyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization"}
+
+type cachedResponse struct {
+	statusCode int
+	status     string
+	proto      string
+	header     http.Header
+	body       []byte
+	noCache    bool // response must be revalidated before every use
+}
+
+// Size implements ccache.Sized, so the cache is bounded by the total size of the response bodies
+func (cr *cachedResponse) Size() int64 {
+	return int64(len(cr.body))
+}
+
+func (cr *cachedResponse) validator() (header, value string) {
+	if etag := cr.header.Get("ETag"); etag != "" {
+		return "If-None-Match", etag
+	}
+	if lastModified := cr.header.Get("Last-Modified"); lastModified != "" {
+		return "If-Modified-Since", lastModified
+	}
+	return "", ""
+}
+
+func (cr *cachedResponse) toResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        cr.status,
+		StatusCode:    cr.statusCode,
+		Proto:         cr.proto,
+		Header:        cr.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(cr.body)),
+		ContentLength: int64(len(cr.body)),
+		Request:       req,
+	}
+}
+
+// cachingTransport is an in-memory cache for successful GET responses.
+// The freshness of each response is taken from the Cache-Control max-age returned by the server,
+// falling back to the default TTL. Stale responses with an ETag or Last-Modified header are
+// conditionally revalidated with the server, rather than being fetched again in full.
+type cachingTransport struct {
+	base      http.RoundTripper
+	cache     *ccache.Cache
+	ttl       time.Duration
+	maxSize   int64
+	closeOnce sync.Once
+}
+
+func newCachingTransport(base http.RoundTripper, ttl time.Duration, maxSize int64) *cachingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cachingTransport{
+		base:    base,
+		cache:   ccache.New(ccache.Configure().MaxSize(maxSize).ItemsToPrune(10)),
+		ttl:     ttl,
+		maxSize: maxSize,
+	}
+}
+
+// close stops the goroutine that maintains the cache
+func (ct *cachingTransport) close() {
+	ct.closeOnce.Do(ct.cache.Stop)
+}
+
+// CloseClient releases the resources held by a client returned by New or NewWithConfig, such as the
+// goroutine maintaining its response cache. The client must not be used once it is closed.
+func CloseClient(client *resty.Client) {
+	if ct, ok := client.GetClient().Transport.(*cachingTransport); ok {
+		ct.close()
+	}
+}
+
+// varyCovered checks the response only varies on request headers that are part of the cache key
+func varyCovered(header http.Header) bool {
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			covered := false
+			for _, keyHeader := range cacheKeyHeaders {
+				if strings.EqualFold(name, keyHeader) {
+					covered = true
+				}
+			}
+			if name != "" && !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
+
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.URL.String()))
+	for _, header := range cacheKeyHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(req.Header.Values(header), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (ct *cachingTransport) cacheable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		// the caller is doing its own conditional request
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	if bypass, _ := req.Context().Value(cacheBypassKey{}).(bool); bypass {
+		return false
+	}
+	_, noStore := parseCacheControl(req.Header.Get("Cache-Control"))["no-store"]
+	return !noStore
+}
+
+// freshness returns how long the response can be used without revalidation, and whether it can be stored at all
+func (ct *cachingTransport) freshness(res *http.Response) (ttl time.Duration, noCache bool, store bool) {
+	if res.StatusCode != http.StatusOK || !varyCovered(res.Header) {
+		return 0, false, false
+	}
+	directives := parseCacheControl(res.Header.Get("Cache-Control"))
+	if _, noStore := directives["no-store"]; noStore {
+		return 0, false, false
+	}
+	ttl = ct.ttl
+	if maxAge, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.ParseInt(maxAge, 10, 64); err == nil {
+			ttl = time.Duration(seconds) * time.Second
+		}
+	}
+	_, noCache = directives["no-cache"]
+	return ttl, noCache || ttl <= 0, true
+}
+
+// readBody reads the response body if it fits in the cache, otherwise it restores the body
+// so the response can be returned to the caller without being stored
+func (ct *cachingTransport) readBody(res *http.Response) ([]byte, bool, error) {
+	if res.ContentLength > ct.maxSize {
+		return nil, false, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, ct.maxSize+1))
+	if err != nil {
+		_ = res.Body.Close()
+		return nil, false, err
+	}
+	if int64(len(body)) > ct.maxSize {
+		res.Body = &multiReadCloser{Reader: io.MultiReader(bytes.NewReader(body), res.Body), closer: res.Body}
+		return nil, false, nil
+	}
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
+
+type multiReadCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (mrc *multiReadCloser) Close() error {
+	return mrc.closer.Close()
+}
+
+func (ct *cachingTransport) store(key string, res *http.Response) (*http.Response, error) {
+	ttl, noCache, store := ct.freshness(res)
+	if !store {
+		return res, nil
+	}
+	body, fits, err := ct.readBody(res)
+	if err != nil || !fits {
+		return res, err
+	}
+	entry := &cachedResponse{
+		statusCode: res.StatusCode,
+		status:     res.Status,
+		proto:      res.Proto,
+		header:     res.Header.Clone(),
+		body:       body,
+		noCache:    noCache,
+	}
+	if noCache {
+		if h, _ := entry.validator(); h == "" {
+			// Nothing we could revalidate with, so no point storing
+			ct.cache.Delete(key)
+			return res, nil
+		}
+	}
+	ct.cache.Set(key, entry, ttl)
+	return res, nil
+}
+
+func (ct *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !ct.cacheable(req) {
+		return ct.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	_, requestNoCache := parseCacheControl(req.Header.Get("Cache-Control"))["no-cache"]
+	var entry *cachedResponse
+	if item := ct.cache.Get(key); item != nil {
+		entry = item.Value().(*cachedResponse)
+		if !item.Expired() && !entry.noCache && !requestNoCache {
+			return entry.toResponse(req), nil
+		}
+	}
+
+	// A RoundTripper must not modify the request it is passed
+	req = req.Clone(req.Context())
+	if entry != nil {
+		if h, v := entry.validator(); h != "" {
+			req.Header.Set(h, v)
+		} else {
+			entry = nil
+		}
+	}
+
+	res, err := ct.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && res.StatusCode == http.StatusNotModified {
+		_ = res.Body.Close()
+		// Refresh the stored entry with any updated headers from the server
+		updated := *entry
+		updated.header = entry.header.Clone()
+		for h, v := range res.Header {
+			if h != "Content-Length" {
+				updated.header[h] = v
+			}
+		}
+		cached := updated.toResponse(req)
+		if ttl, noCache, store := ct.freshness(cached); store {
+			updated.noCache = noCache
+			ct.cache.Set(key, &updated, ttl)
+		}
+		return cached, nil
+	}
+	return ct.store(key, res)
+}
@@ -0,0 +1,314 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCacheTestClient(t *testing.T, handler func(hits int64, res http.ResponseWriter, req *http.Request)) (*resty.Client, *atomic.Int64, func()) {
+	hits := &atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handler(hits.Add(1), res, req)
+	}))
+
+	resetConf()
+	utConf.Set(HTTPConfigURL, server.URL)
+	utConf.Set(HTTPConfigCacheEnabled, true)
+	utConf.Set(HTTPConfigCacheSize, "1Kb")
+	c, err := New(context.Background(), utConf)
+	assert.NoError(t, err)
+	return c, hits, server.Close
+}
+
+func TestCacheDefaultTTL(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+	defer CloseClient(c)
+
+	for i := 0; i < 3; i++ {
+		res, err := c.R().Get("/ref")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"hit":1}`, res.String())
+	}
+	assert.Equal(t, int64(1), hits.Load())
+
+	// Different URL, and different relevant header, are cached separately
+	res, err := c.R().Get("/ref?page=2")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":2}`, res.String())
+	res, err = c.R().SetHeader("Authorization", "Bearer other").Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":3}`, res.String())
+
+	// Bypass per request
+	res, err = c.R().SetContext(WithCacheBypass(context.Background())).Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":4}`, res.String())
+	res, err = c.R().Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":1}`, res.String())
+}
+
+func TestCacheDisabledByDefault(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	resetConf()
+	utConf.Set(HTTPConfigURL, server.URL)
+	c, err := New(context.Background(), utConf)
+	assert.NoError(t, err)
+	_, isCache := c.GetClient().Transport.(*cachingTransport)
+	assert.False(t, isCache)
+}
+
+func TestCacheSkipsNonGetAndErrors(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/error" {
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	for i := 1; i <= 2; i++ {
+		res, err := c.R().SetBody(`{}`).Post("/ref")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"hit":%d}`, i), res.String())
+	}
+	for i := 3; i <= 4; i++ {
+		res, err := c.R().Get("/error")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"hit":%d}`, i), res.String())
+	}
+	assert.Equal(t, int64(4), hits.Load())
+}
+
+func TestCacheControlMaxAgeAndNoStore(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/expired":
+			res.Header().Set("Cache-Control", "public, max-age=0")
+		case "/nostore":
+			res.Header().Set("Cache-Control", "no-store")
+		case "/vary":
+			res.Header().Set("Vary", "*")
+		case "/varyother":
+			res.Header().Set("Vary", "Accept-Encoding, X-Tenant")
+		default:
+			res.Header().Set("Cache-Control", `max-age="3600"`)
+		}
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	for _, path := range []string{"/expired", "/nostore", "/vary", "/varyother"} {
+		_, err := c.R().Get(path)
+		assert.NoError(t, err)
+		_, err = c.R().Get(path)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(8), hits.Load())
+
+	res, err := c.R().Get("/fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":9}`, res.String())
+	res, err = c.R().Get("/fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":9}`, res.String())
+
+	// The caller can ask for the response not to be stored
+	res, err = c.R().SetHeader("Cache-Control", "no-store").Get("/fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":10}`, res.String())
+}
+
+func TestCacheETagRevalidation(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("ETag", `"v1"`)
+		res.Header().Set("Cache-Control", "no-cache")
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			res.Header().Set("X-Revalidated", fmt.Sprintf("%d", hits))
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	res, err := c.R().Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":1}`, res.String())
+
+	res, err = c.R().Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Equal(t, `{"hit":1}`, res.String())
+	assert.Equal(t, "2", res.Header().Get("X-Revalidated"))
+	assert.Equal(t, int64(2), hits.Load())
+}
+
+func TestCacheLastModifiedRevalidationChanged(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	res, err := c.R().Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":1}`, res.String())
+
+	// Server ignores the If-Modified-Since and returns a new body, which replaces the cached one
+	res, err = c.R().SetHeader("Cache-Control", "no-cache").Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":2}`, res.String())
+	res, err = c.R().Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":2}`, res.String())
+	assert.Equal(t, int64(2), hits.Load())
+}
+
+func TestCacheNoCacheWithoutValidator(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Cache-Control", "no-cache")
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	for i := 1; i <= 2; i++ {
+		res, err := c.R().Get("/ref")
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"hit":%d}`, i), res.String())
+	}
+	assert.Equal(t, int64(2), hits.Load())
+}
+
+func TestCacheCallerConditionalRequest(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("ETag", `"v1"`)
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+
+	_, err := c.R().Get("/ref")
+	assert.NoError(t, err)
+	res, err := c.R().SetHeader("If-None-Match", `"v1"`).Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotModified, res.StatusCode())
+	assert.Equal(t, int64(2), hits.Load())
+}
+
+func TestCacheTooLarge(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/chunked" {
+			res.(http.Flusher).Flush() // forces chunked encoding with no content length
+		}
+		_, _ = res.Write([]byte(strings.Repeat("a", 2048)))
+	})
+	defer done()
+
+	for _, path := range []string{"/large", "/large", "/chunked", "/chunked"} {
+		res, err := c.R().Get(path)
+		assert.NoError(t, err)
+		assert.Len(t, res.Body(), 2048)
+	}
+	assert.Equal(t, int64(4), hits.Load())
+}
+
+func TestCacheVaryCovered(t *testing.T) {
+	c, hits, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {
+		res.Header().Add("Vary", "accept-encoding")
+		res.Header().Add("Vary", "Accept, Authorization")
+		_, _ = fmt.Fprintf(res, `{"hit":%d}`, hits)
+	})
+	defer done()
+	defer CloseClient(c)
+
+	for i := 0; i < 2; i++ {
+		res, err := c.R().Get("/ref")
+		assert.NoError(t, err)
+		assert.Equal(t, `{"hit":1}`, res.String())
+	}
+	res, err := c.R().SetHeader("Accept", "text/plain").Get("/ref")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hit":2}`, res.String())
+	assert.Equal(t, int64(2), hits.Load())
+}
+
+func TestCloseClient(t *testing.T) {
+	c, _, done := newCacheTestClient(t, func(hits int64, res http.ResponseWriter, req *http.Request) {})
+	defer done()
+	CloseClient(c)
+	CloseClient(c)
+
+	// Clients without a cache have nothing to release
+	CloseClient(resty.New())
+}
+
+func TestCacheTransportErrors(t *testing.T) {
+	ct := newCachingTransport(nil, time.Minute, 1024)
+	defer ct.close()
+	assert.Equal(t, http.DefaultTransport, ct.base)
+
+	ct.base = &mockRoundTripper{err: fmt.Errorf("pop")}
+	req := httptest.NewRequest(http.MethodGet, "http://localhost/ref", nil)
+	_, err := ct.RoundTrip(req)
+	assert.Regexp(t, "pop", err)
+
+	ct.base = &mockRoundTripper{res: &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(&errorReader{}),
+	}}
+	_, err = ct.RoundTrip(req)
+	assert.Regexp(t, "pop", err)
+}
+
+type mockRoundTripper struct {
+	res *http.Response
+	err error
+}
+
+func (m *mockRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
+	return m.res, m.err
+}
+
+type errorReader struct{}
+
+func (e *errorReader) Read([]byte) (int, error) {
+	return 0, fmt.Errorf("pop")
+}
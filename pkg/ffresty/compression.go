@@ -0,0 +1,198 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	CompressionGzip    = "gzip"
+	CompressionDeflate = "deflate"
+)
+
+// Content types that are already compressed, so are sent as-is
+var precompressedContentTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/x-compress":       true,
+}
+
+// compressionTransport compresses request bodies over a size threshold, and transparently
+// decompresses gzip/deflate encoded responses.
+// Resty rebuilds the request body from its own buffer on every attempt, so each retry
+// is compressed afresh from the original payload.
+type compressionTransport struct {
+	base      http.RoundTripper
+	encoding  string
+	threshold int64
+}
+
+func newCompressionTransport(base http.RoundTripper, encoding string, threshold int64) *compressionTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if encoding != CompressionDeflate {
+		encoding = CompressionGzip
+	}
+	return &compressionTransport{
+		base:      base,
+		encoding:  encoding,
+		threshold: threshold,
+	}
+}
+
+func isCompressibleContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case precompressedContentTypes[mediaType]:
+		return false
+	case strings.HasPrefix(mediaType, "image/"):
+		return mediaType == "image/svg+xml"
+	case strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/woff"):
+		return false
+	}
+	return true
+}
+
+func compressBytes(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == CompressionDeflate {
+		w = zlib.NewWriter(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (ct *compressionTransport) compressRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody ||
+		req.Header.Get("Content-Encoding") != "" ||
+		!isCompressibleContentType(req.Header.Get("Content-Type")) ||
+		(req.ContentLength > 0 && req.ContentLength < ct.threshold) {
+		return req, nil
+	}
+
+	data, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) >= ct.threshold {
+		if data, err = compressBytes(ct.encoding, data); err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Encoding", ct.encoding)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	return req, nil
+}
+
+func (ct *compressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request it is passed
+	req = req.Clone(req.Context())
+	req, err := ct.compressRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the caller did not ask for a specific encoding, we handle decompression ourselves
+	handleDecompression := req.Header.Get("Accept-Encoding") == ""
+	if handleDecompression {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	}
+	res, err := ct.base.RoundTrip(req)
+	if err != nil || !handleDecompression || req.Method == http.MethodHead || res.ContentLength == 0 {
+		return res, err
+	}
+
+	var newReader func(io.Reader) (io.ReadCloser, error)
+	switch strings.ToLower(res.Header.Get("Content-Encoding")) {
+	case CompressionGzip:
+		newReader = func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) }
+	case CompressionDeflate:
+		newReader = zlib.NewReader
+	default:
+		return res, nil
+	}
+	res.Body = &decompressingReader{body: res.Body, newReader: newReader}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return res, nil
+}
+
+// decompressingReader defers reading the compression header until the body is first read,
+// so empty bodies (such as on HEAD requests) do not cause errors
+type decompressingReader struct {
+	body      io.ReadCloser
+	newReader func(io.Reader) (io.ReadCloser, error)
+	zr        io.ReadCloser
+	err       error
+}
+
+func (dr *decompressingReader) Read(p []byte) (int, error) {
+	if dr.zr == nil {
+		if dr.err != nil {
+			return 0, dr.err
+		}
+		if dr.zr, dr.err = dr.newReader(dr.body); dr.err != nil {
+			dr.zr = nil
+			return 0, dr.err
+		}
+	}
+	return dr.zr.Read(p)
+}
+
+func (dr *decompressingReader) Close() error {
+	if dr.zr != nil {
+		_ = dr.zr.Close()
+	}
+	return dr.body.Close()
+}
@@ -0,0 +1,206 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type compressionTestRequest struct {
+	contentEncoding string
+	body            string
+}
+
+func newCompressionTestServer(t *testing.T, failFirst int, responseEncoding string) (*httptest.Server, *[]compressionTestRequest) {
+	received := []compressionTestRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var r io.Reader = req.Body
+		var err error
+		switch req.Header.Get("Content-Encoding") {
+		case "gzip":
+			r, err = gzip.NewReader(req.Body)
+		case "deflate":
+			r, err = zlib.NewReader(req.Body)
+		}
+		assert.NoError(t, err)
+		b, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		received = append(received, compressionTestRequest{
+			contentEncoding: req.Header.Get("Content-Encoding"),
+			body:            string(b),
+		})
+		if len(received) <= failFirst {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		res.Header().Set("Content-Type", "application/json")
+		reply := `{"some":"data"}`
+		if responseEncoding != "" && strings.Contains(req.Header.Get("Accept-Encoding"), responseEncoding) {
+			res.Header().Set("Content-Encoding", responseEncoding)
+			res.WriteHeader(http.StatusOK)
+			var w io.WriteCloser
+			if responseEncoding == "deflate" {
+				w = zlib.NewWriter(res)
+			} else {
+				w = gzip.NewWriter(res)
+			}
+			_, _ = w.Write([]byte(reply))
+			_ = w.Close()
+			return
+		}
+		res.WriteHeader(http.StatusOK)
+		_, _ = res.Write([]byte(reply))
+	}))
+	return server, &received
+}
+
+func TestCompressionGzipWithRetry(t *testing.T) {
+	server, received := newCompressionTestServer(t, 1, "gzip")
+	defer server.Close()
+
+	resetConf()
+	utConf.Set(HTTPConfigURL, server.URL)
+	utConf.Set(HTTPConfigCompressionEnabled, true)
+	utConf.Set(HTTPConfigCompressionThreshold, "10")
+	utConf.Set(HTTPConfigRetryEnabled, true)
+	utConf.Set(HTTPConfigRetryInitDelay, "1ms")
+	utConf.Set(HTTPConfigRetryMaxDelay, "1ms")
+
+	c, err := New(context.Background(), utConf)
+	assert.NoError(t, err)
+
+	largeBody := map[string]string{"data": strings.Repeat("a", 100)}
+	var result map[string]string
+	res, err := c.R().SetBody(largeBody).SetResult(&result).Post("/test")
+	assert.NoError(t, err)
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, "data", result["some"])
+
+	assert.Len(t, *received, 2)
+	for _, r := range *received {
+		assert.Equal(t, "gzip", r.contentEncoding)
+		assert.Equal(t, fmt.Sprintf(`{"data":"%s"}`, strings.Repeat("a", 100)), r.body)
+	}
+}
+
+func TestCompressionDeflateSkipsSmallAndPrecompressed(t *testing.T) {
+	server, received := newCompressionTestServer(t, 0, "deflate")
+	defer server.Close()
+
+	c := NewWithConfig(context.Background(), Config{
+		URL: server.URL,
+		HTTPConfig: HTTPConfig{
+			CompressionEnabled:   true,
+			CompressionType:      CompressionDeflate,
+			CompressionThreshold: 50,
+		},
+	})
+
+	var result map[string]string
+	res, err := c.R().SetBody(strings.Repeat("b", 100)).SetHeader("Content-Type", "text/plain").SetResult(&result).Post("/test")
+	assert.NoError(t, err)
+	assert.True(t, res.IsSuccess())
+	assert.Equal(t, "data", result["some"])
+
+	_, err = c.R().SetBody("small").SetHeader("Content-Type", "text/plain").Post("/test")
+	assert.NoError(t, err)
+
+	_, err = c.R().SetBody([]byte(strings.Repeat("c", 100))).SetHeader("Content-Type", "application/zip").Post("/test")
+	assert.NoError(t, err)
+
+	_, err = c.R().SetBody(strings.Repeat("d", 100)).SetHeader("Content-Type", "text/plain").SetHeader("Content-Encoding", "identity").Post("/test")
+	assert.NoError(t, err)
+
+	res, err = c.R().Head("/test")
+	assert.NoError(t, err)
+	assert.True(t, res.IsSuccess())
+
+	assert.Len(t, *received, 5)
+	assert.Equal(t, "deflate", (*received)[0].contentEncoding)
+	assert.Equal(t, strings.Repeat("b", 100), (*received)[0].body)
+	assert.Equal(t, "", (*received)[1].contentEncoding)
+	assert.Equal(t, "small", (*received)[1].body)
+	assert.Equal(t, "", (*received)[2].contentEncoding)
+	assert.Equal(t, strings.Repeat("c", 100), (*received)[2].body)
+	assert.Equal(t, "identity", (*received)[3].contentEncoding)
+}
+
+func TestCompressionDisabled(t *testing.T) {
+	server, received := newCompressionTestServer(t, 0, "")
+	defer server.Close()
+
+	resetConf()
+	utConf.Set(HTTPConfigURL, server.URL)
+	c, err := New(context.Background(), utConf)
+	assert.NoError(t, err)
+	_, isCompressing := c.GetClient().Transport.(*compressionTransport)
+	assert.False(t, isCompressing)
+
+	_, err = c.R().SetBody(strings.Repeat("a", 2048)).Post("/test")
+	assert.NoError(t, err)
+	assert.Len(t, *received, 1)
+	assert.Equal(t, "", (*received)[0].contentEncoding)
+}
+
+func TestCompressionInvalidType(t *testing.T) {
+	resetConf()
+	utConf.Set(HTTPConfigCompressionEnabled, true)
+	utConf.Set(HTTPConfigCompressionType, "brotli")
+	_, err := New(context.Background(), utConf)
+	assert.Regexp(t, "FF00245", err)
+}
+
+func TestCompressibleContentTypes(t *testing.T) {
+	assert.True(t, isCompressibleContentType(""))
+	assert.True(t, isCompressibleContentType("application/json; charset=utf-8"))
+	assert.True(t, isCompressibleContentType("image/svg+xml"))
+	assert.False(t, isCompressibleContentType("image/png"))
+	assert.False(t, isCompressibleContentType("video/mp4"))
+	assert.False(t, isCompressibleContentType("application/gzip"))
+	assert.False(t, isCompressibleContentType(";;bad"))
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, fmt.Errorf("pop") }
+
+func TestCompressionRequestReadError(t *testing.T) {
+	ct := newCompressionTransport(nil, "", 0)
+	req := httptest.NewRequest(http.MethodPost, "/", errReader{})
+	_, err := ct.RoundTrip(req)
+	assert.Regexp(t, "pop", err)
+}
+
+func TestDecompressingReaderBadData(t *testing.T) {
+	dr := &decompressingReader{
+		body:      io.NopCloser(strings.NewReader("not gzip")),
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	_, err := io.ReadAll(dr)
+	assert.Error(t, err)
+	assert.NoError(t, dr.Close())
+}
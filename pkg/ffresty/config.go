@@ -20,8 +20,10 @@ import (
 	"context"
 
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/ffapi"
 	"github.com/hyperledger/firefly-common/pkg/fftls"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 )
 
 const (
@@ -37,6 +39,14 @@ const (
 	defaultHTTPTLSHandshakeTimeout       = "10s" // match Go's default
 	defaultHTTPExpectContinueTimeout     = "1s"  // match Go's default
 	defaultHTTPPassthroughHeadersEnabled = false
+	defaultCompressionEnabled            = false
+	defaultCompressionType               = CompressionGzip
+	defaultCompressionThreshold          = "1Kb"
+	defaultCacheEnabled                  = false
+	defaultCacheTTL                      = "30s"
+	defaultCacheSize                     = "10Mb"
+	defaultBulkheadMaxRequestsPerHost    = 1000
+	defaultBulkheadQueueTimeout          = "10s"
 )
 
 const (
@@ -77,6 +87,27 @@ const (
 	HTTPExpectContinueTimeout = "expectContinueTimeout"
 	// HTTPPassthroughHeadersEnabled will pass through any HTTP headers found on the context
 	HTTPPassthroughHeadersEnabled = "passthroughHeadersEnabled"
+	// HTTPConfigRequestIDHeader the header used to pass the ID of the inbound request being processed (if any) on outbound requests
+	HTTPConfigRequestIDHeader = "requestIDHeader"
+
+	// HTTPConfigCompressionEnabled whether request bodies are compressed, and compressed responses accepted
+	HTTPConfigCompressionEnabled = "compression.enabled"
+	// HTTPConfigCompressionType the Content-Encoding to use for compressed request bodies - gzip or deflate
+	HTTPConfigCompressionType = "compression.type"
+	// HTTPConfigCompressionThreshold the minimum size of request body that will be compressed
+	HTTPConfigCompressionThreshold = "compression.threshold"
+
+	// HTTPConfigCacheEnabled whether successful GET responses are cached in memory
+	HTTPConfigCacheEnabled = "cache.enabled"
+	// HTTPConfigCacheTTL the time to cache a response for, when the server does not specify a Cache-Control max-age
+	HTTPConfigCacheTTL = "cache.ttl"
+	// HTTPConfigCacheSize the maximum total size of the response bodies held in the cache
+	HTTPConfigCacheSize = "cache.size"
+
+	// HTTPConfigBulkheadMaxRequestsPerHost the maximum number of in-flight requests to each host, so one slow host cannot starve requests to others
+	HTTPConfigBulkheadMaxRequestsPerHost = "bulkhead.maxRequestsPerHost"
+	// HTTPConfigBulkheadQueueTimeout how long a request to a host at its limit waits for a slot, before failing - zero fails immediately
+	HTTPConfigBulkheadQueueTimeout = "bulkhead.queueTimeout"
 
 	// HTTPCustomClient - unit test only - allows injection of a custom HTTP client to resty
 	HTTPCustomClient = "customClient"
@@ -101,7 +132,18 @@ func InitConfig(conf config.Section) {
 	conf.AddKnownKey(HTTPTLSHandshakeTimeout, defaultHTTPTLSHandshakeTimeout)
 	conf.AddKnownKey(HTTPExpectContinueTimeout, defaultHTTPExpectContinueTimeout)
 	conf.AddKnownKey(HTTPPassthroughHeadersEnabled, defaultHTTPPassthroughHeadersEnabled)
+	conf.AddKnownKey(HTTPConfigRequestIDHeader, ffapi.FFRequestIDHeader)
+	conf.AddKnownKey(HTTPConfigCompressionEnabled, defaultCompressionEnabled)
+	conf.AddKnownKey(HTTPConfigCompressionType, defaultCompressionType)
+	conf.AddKnownKey(HTTPConfigCompressionThreshold, defaultCompressionThreshold)
+	conf.AddKnownKey(HTTPConfigCacheEnabled, defaultCacheEnabled)
+	conf.AddKnownKey(HTTPConfigCacheTTL, defaultCacheTTL)
+	conf.AddKnownKey(HTTPConfigCacheSize, defaultCacheSize)
+	conf.AddKnownKey(HTTPConfigBulkheadMaxRequestsPerHost, defaultBulkheadMaxRequestsPerHost)
+	conf.AddKnownKey(HTTPConfigBulkheadQueueTimeout, defaultBulkheadQueueTimeout)
 	conf.AddKnownKey(HTTPCustomClient)
+	conf.MarkSensitive(HTTPConfigHeaders)
+	conf.MarkSensitive(HTTPConfigAuthPassword)
 
 	tlsConfig := conf.SubSection("tls")
 	fftls.InitTLSConfig(tlsConfig)
@@ -127,9 +169,21 @@ func GenerateConfig(ctx context.Context, conf config.Section) (*Config, error) {
 			HTTPTLSHandshakeTimeout:       fftypes.FFDuration(conf.GetDuration(HTTPTLSHandshakeTimeout)),
 			HTTPExpectContinueTimeout:     fftypes.FFDuration(conf.GetDuration(HTTPExpectContinueTimeout)),
 			HTTPPassthroughHeadersEnabled: conf.GetBool(HTTPPassthroughHeadersEnabled),
+			RequestIDHeader:               conf.GetString(HTTPConfigRequestIDHeader),
+			CompressionEnabled:            conf.GetBool(HTTPConfigCompressionEnabled),
+			CompressionType:               conf.GetString(HTTPConfigCompressionType),
+			CompressionThreshold:          conf.GetByteSize(HTTPConfigCompressionThreshold),
+			CacheEnabled:                  conf.GetBool(HTTPConfigCacheEnabled),
+			CacheTTL:                      fftypes.FFDuration(conf.GetDuration(HTTPConfigCacheTTL)),
+			CacheSize:                     conf.GetByteSize(HTTPConfigCacheSize),
+			BulkheadMaxRequestsPerHost:    conf.GetInt(HTTPConfigBulkheadMaxRequestsPerHost),
+			BulkheadQueueTimeout:          fftypes.FFDuration(conf.GetDuration(HTTPConfigBulkheadQueueTimeout)),
 			HTTPCustomClient:              conf.Get(HTTPCustomClient),
 		},
 	}
+	if ffrestyConfig.CompressionEnabled && ffrestyConfig.CompressionType != CompressionGzip && ffrestyConfig.CompressionType != CompressionDeflate {
+		return nil, i18n.NewError(ctx, i18n.MsgInvalidCompressionType, ffrestyConfig.CompressionType)
+	}
 	tlsSection := conf.SubSection("tls")
 	tlsClientConfig, err := fftls.ConstructTLSConfig(ctx, tlsSection, fftls.ClientType)
 	if err != nil {
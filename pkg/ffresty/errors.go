@@ -0,0 +1,95 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"encoding/json"
+	"regexp"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+var serverErrorCodeRegex = regexp.MustCompile(`^([A-Z]+[0-9]+):`)
+
+// ResponseError is returned by WrapRestErr for a response with a 4xx/5xx status code, so the caller
+// can check the status and the error reported by the server without parsing the body again.
+// It is an i18n.FFError for the message key passed to WrapRestErr, which includes the start of the body.
+type ResponseError struct {
+	i18n.FFError
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Body is the full response body, which is retained as text whether or not it is JSON
+	Body string
+	// ServerError is the "error" field of a JSON body, as returned by FireFly servers
+	ServerError string
+	// Problem contains the fields of an RFC 7807 problem+json body, if any are present
+	Problem *ProblemDetails
+}
+
+// ProblemDetails are the standard fields of an RFC 7807 problem+json body
+type ProblemDetails struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+	ProblemDetails
+}
+
+func newResponseError(ffErr error, statusCode int, body string) *ResponseError {
+	re := &ResponseError{
+		FFError:    ffErr.(i18n.FFError),
+		StatusCode: statusCode,
+		Body:       body,
+	}
+	var parsed errorBody
+	if err := json.Unmarshal([]byte(body), &parsed); err == nil {
+		re.ServerError = parsed.Error
+		if parsed.ProblemDetails != (ProblemDetails{}) {
+			re.Problem = &parsed.ProblemDetails
+		}
+	}
+	return re
+}
+
+func (re *ResponseError) Unwrap() error {
+	return re.FFError
+}
+
+// IsStatus returns true if the response had the given status code
+func (re *ResponseError) IsStatus(code int) bool {
+	return re.StatusCode == code
+}
+
+// ServerErrorCode returns the error code (such as FF00164) the server error message starts with,
+// from either the "error" field or the problem detail. Empty if there is no code.
+func (re *ResponseError) ServerErrorCode() string {
+	candidates := []string{re.ServerError}
+	if re.Problem != nil {
+		candidates = append(candidates, re.Problem.Detail, re.Problem.Title)
+	}
+	for _, msg := range candidates {
+		if match := serverErrorCodeRegex.FindStringSubmatch(msg); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ffresty
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapRestErrResponseError(t *testing.T) {
+	ctx := context.Background()
+	resetConf()
+	utConf.Set(HTTPConfigURL, "http://localhost:12345")
+
+	c, err := New(ctx, utConf)
+	assert.NoError(t, err)
+	httpmock.ActivateNonDefault(c.GetClient())
+	defer httpmock.DeactivateAndReset()
+
+	longBody := `{"error":"FF00164: Item not found","padding":"` + strings.Repeat("a", 300) + `"}`
+	httpmock.RegisterResponder("GET", "http://localhost:12345/fferror", httpmock.NewStringResponder(404, longBody))
+	httpmock.RegisterResponder("GET", "http://localhost:12345/problem", func(req *http.Request) (*http.Response, error) {
+		res := httpmock.NewStringResponse(400, `{"type":"https://example.com/invalid","title":"Invalid input","status":400,"detail":"FF00140: Field 'name' is invalid"}`)
+		res.Header.Set("Content-Type", "application/problem+json")
+		return res, nil
+	})
+	httpmock.RegisterResponder("GET", "http://localhost:12345/text", httpmock.NewStringResponder(502, "Bad gateway\n"))
+	httpmock.RegisterResponder("GET", "http://localhost:12345/ok", httpmock.NewStringResponder(200, `{}`))
+
+	// FireFly error body
+	res, err := c.R().Get("/fferror")
+	assert.NoError(t, err)
+	err = WrapRestErr(ctx, res, err, i18n.MsgWebhookErr)
+	var re *ResponseError
+	assert.True(t, errors.As(err, &re))
+	assert.True(t, re.IsStatus(404))
+	assert.False(t, re.IsStatus(500))
+	assert.Equal(t, longBody, re.Body)
+	assert.Equal(t, "FF00164: Item not found", re.ServerError)
+	assert.Equal(t, "FF00164", re.ServerErrorCode())
+	assert.Nil(t, re.Problem)
+	assert.Regexp(t, "FF00219.*FF00164.*\\.\\.\\.$", err)
+	var ffErr i18n.FFError
+	assert.True(t, errors.As(err, &ffErr))
+	assert.Equal(t, i18n.MsgWebhookErr, ffErr.MessageKey())
+
+	// Problem details
+	res, err = c.R().Get("/problem")
+	assert.NoError(t, err)
+	err = WrapRestErr(ctx, res, err, i18n.MsgWebhookErr)
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, &ProblemDetails{
+		Type:   "https://example.com/invalid",
+		Title:  "Invalid input",
+		Status: 400,
+		Detail: "FF00140: Field 'name' is invalid",
+	}, re.Problem)
+	assert.Empty(t, re.ServerError)
+	assert.Equal(t, "FF00140", re.ServerErrorCode())
+
+	// Text body is retained
+	res, err = c.SetDoNotParseResponse(true).R().Get("/text")
+	assert.NoError(t, err)
+	err = WrapRestErr(ctx, res, err, i18n.MsgWebhookErr)
+	assert.True(t, errors.As(err, &re))
+	assert.Equal(t, 502, re.StatusCode)
+	assert.Equal(t, "Bad gateway\n", re.Body)
+	assert.Empty(t, re.ServerErrorCode())
+	assert.Nil(t, re.Problem)
+
+	// Not an error status
+	res, err = c.SetDoNotParseResponse(false).R().Get("/ok")
+	assert.NoError(t, err)
+	err = WrapRestErr(ctx, res, err, i18n.MsgWebhookErr)
+	assert.False(t, errors.As(err, &re))
+	assert.Regexp(t, "FF00219", err)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/ffapi"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
@@ -70,7 +71,16 @@ type HTTPConfig struct {
 	HTTPMaxConnsPerHost           int                                       `ffstruct:"RESTConfig" json:"maxConnsPerHost,omitempty"`
 	HTTPPassthroughHeadersEnabled bool                                      `ffstruct:"RESTConfig" json:"httpPassthroughHeadersEnabled,omitempty"`
 	HTTPHeaders                   fftypes.JSONObject                        `ffstruct:"RESTConfig" json:"headers,omitempty"`
+	RequestIDHeader               string                                    `ffstruct:"RESTConfig" json:"requestIDHeader,omitempty"`
 	HTTPTLSHandshakeTimeout       fftypes.FFDuration                        `ffstruct:"RESTConfig" json:"tlsHandshakeTimeout,omitempty"`
+	CompressionEnabled            bool                                      `ffstruct:"RESTConfig" json:"compressionEnabled,omitempty"`
+	CompressionType               string                                    `ffstruct:"RESTConfig" json:"compressionType,omitempty"`
+	CompressionThreshold          int64                                     `ffstruct:"RESTConfig" json:"compressionThreshold,omitempty"`
+	CacheEnabled                  bool                                      `ffstruct:"RESTConfig" json:"cacheEnabled,omitempty"`
+	CacheTTL                      fftypes.FFDuration                        `ffstruct:"RESTConfig" json:"cacheTTL,omitempty"`
+	CacheSize                     int64                                     `ffstruct:"RESTConfig" json:"cacheSize,omitempty"`
+	BulkheadMaxRequestsPerHost    int                                       `ffstruct:"RESTConfig" json:"bulkheadMaxRequestsPerHost,omitempty"`
+	BulkheadQueueTimeout          fftypes.FFDuration                        `ffstruct:"RESTConfig" json:"bulkheadQueueTimeout,omitempty"`
 	HTTPCustomClient              interface{}                               `ffstruct:"RESTConfig" json:"httpCustomClient,omitempty"`
 	TLSClientConfig               *tls.Config                               `json:"-"` // should be built from separate TLSConfig using fftls utils
 	OnCheckRetry                  func(res *resty.Response, err error) bool `json:"-"` // response could be nil on err
@@ -160,6 +170,29 @@ func NewWithConfig(ctx context.Context, ffrestyConfig Config) (client *resty.Cli
 
 	client.SetTimeout(time.Duration(ffrestyConfig.HTTPRequestTimeout))
 
+	if ffrestyConfig.TLSClientConfig != nil && ffrestyConfig.TLSClientConfig.GetClientCertificate != nil {
+		// Allow fftls to select the client certificate for the host of each request
+		client.SetTransport(&serverNameTransport{base: client.GetClient().Transport})
+	}
+
+	if ffrestyConfig.BulkheadMaxRequestsPerHost > 0 {
+		client.SetTransport(newBulkheadTransport(client.GetClient().Transport, ffrestyConfig.BulkheadMaxRequestsPerHost, time.Duration(ffrestyConfig.BulkheadQueueTimeout)))
+	}
+
+	if ffrestyConfig.CompressionEnabled {
+		client.SetTransport(newCompressionTransport(client.GetClient().Transport, ffrestyConfig.CompressionType, ffrestyConfig.CompressionThreshold))
+	}
+
+	if ffrestyConfig.CacheEnabled && ffrestyConfig.CacheSize > 0 {
+		// Outermost, so cached bodies are already decompressed
+		client.SetTransport(newCachingTransport(client.GetClient().Transport, time.Duration(ffrestyConfig.CacheTTL), ffrestyConfig.CacheSize))
+	}
+
+	requestIDHeader := ffrestyConfig.RequestIDHeader
+	if requestIDHeader == "" {
+		requestIDHeader = ffapi.FFRequestIDHeader
+	}
+
 	client.OnBeforeRequest(func(c *resty.Client, req *resty.Request) error {
 		rCtx := req.Context()
 		rc := rCtx.Value(retryCtxKey{})
@@ -187,10 +220,10 @@ func NewWithConfig(ctx context.Context, ffrestyConfig Config) (client *resty.Cli
 			}
 		}
 
-		// If an X-FireFlyRequestID was set on the context, pass that header on this request too
+		// If a request ID was set on the context, pass that header on this request too
 		ffRequestID := rCtx.Value(ffapi.CtxFFRequestIDKey{})
 		if ffRequestID != nil {
-			req.Header.Set(ffapi.FFRequestIDHeader, ffRequestID.(string))
+			req.Header.Set(requestIDHeader, ffRequestID.(string))
 		}
 
 		if ffrestyConfig.OnBeforeRequest != nil {
@@ -255,24 +288,44 @@ func NewWithConfig(ctx context.Context, ffrestyConfig Config) (client *resty.Cli
 	return client
 }
 
+// WrapRestErr builds an error for the message key, including the start of the response body.
+// Where the response has a 4xx/5xx status code a *ResponseError is returned, with the full body
+// and the error reported by the server.
 func WrapRestErr(ctx context.Context, res *resty.Response, err error, key i18n.ErrorMessageKey) error {
-	var respData string
+	var body, respData string
 	if res != nil {
 		if res.RawBody() != nil {
 			defer func() { _ = res.RawBody().Close() }()
 			if r, err := io.ReadAll(res.RawBody()); err == nil {
-				respData = string(r)
+				body = string(r)
+				respData = body
 			}
 		}
-		if respData == "" {
+		if body == "" {
+			body = string(res.Body())
 			respData = res.String()
 		}
 		if len(respData) > 256 {
 			respData = respData[0:256] + "..."
 		}
 	}
+	var ffErr error
 	if err != nil {
-		return i18n.WrapError(ctx, err, key, respData)
+		ffErr = i18n.WrapError(ctx, err, key, respData)
+	} else {
+		ffErr = i18n.NewError(ctx, key, respData)
 	}
-	return i18n.NewError(ctx, key, respData)
+	if res != nil && res.IsError() {
+		return newResponseError(ffErr, res.StatusCode(), body)
+	}
+	return ffErr
+}
+
+// serverNameTransport passes the host of each request through to the TLS handshake of new connections
+type serverNameTransport struct {
+	base http.RoundTripper
+}
+
+func (t *serverNameTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(fftls.WithServerName(req.Context(), req.URL.Hostname())))
 }
@@ -377,6 +377,33 @@ func TestPassthroughHeaders(t *testing.T) {
 	assert.Equal(t, 1, httpmock.GetTotalCallCount())
 }
 
+func TestRequestIDHeaderConfigured(t *testing.T) {
+	ctx := context.WithValue(context.Background(), ffapi.CtxFFRequestIDKey{}, "customReqID")
+
+	customClient := &http.Client{}
+
+	resetConf()
+	utConf.Set(HTTPConfigURL, "http://localhost:12345")
+	utConf.Set(HTTPCustomClient, customClient)
+	utConf.Set(HTTPConfigRequestIDHeader, "X-Request-ID")
+
+	c, err := New(context.Background(), utConf)
+	assert.Nil(t, err)
+	httpmock.ActivateNonDefault(customClient)
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "http://localhost:12345/test",
+		func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "customReqID", req.Header.Get("X-Request-ID"))
+			assert.Empty(t, req.Header.Get(ffapi.FFRequestIDHeader))
+			return httpmock.NewStringResponder(200, `{}`)(req)
+		})
+
+	_, err = c.R().SetContext(ctx).Get("/test")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, httpmock.GetTotalCallCount())
+}
+
 func TestMissingCAFile(t *testing.T) {
 	resetConf()
 	utConf.Set(HTTPConfigURL, "https://localhost:12345")
@@ -510,5 +537,22 @@ func TestMTLSClientWithServer(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "world", resBody["hello"])
 	}
+
+	// The client certificate can also be selected by host, with no default
+	clientTLSSection.Set(fftls.HTTPConfTLSKeyFile, "")
+	clientTLSSection.Set(fftls.HTTPConfTLSCertFile, "")
+	clientTLSSection.Set(fftls.HTTPConfTLSClientCertificates, []interface{}{
+		map[string]interface{}{
+			"hosts":    []interface{}{"127.0.0.1"},
+			"certFile": publicKeyFile.Name(),
+			"keyFile":  privateKeyFile.Name(),
+		},
+	})
+	c, err = New(context.Background(), restyConfig)
+	assert.Nil(t, err)
+	res, err = c.R().Get(httpsAddr)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, res.StatusCode())
+
 	cancelCtx()
 }
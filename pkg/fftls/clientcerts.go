@@ -0,0 +1,105 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// ClientCertificateConfig maps a set of target hosts to the client certificate presented to them.
+// Hosts are matched case-insensitively, and a wildcard such as "*.example.com" matches any subdomain
+type ClientCertificateConfig struct {
+	Hosts    []string `ffstruct:"tlsclientcert" json:"hosts"`
+	CertFile string   `ffstruct:"tlsclientcert" json:"certFile"`
+	KeyFile  string   `ffstruct:"tlsclientcert" json:"keyFile"`
+}
+
+type ctxServerNameKey struct{}
+
+// WithServerName returns a context for a TLS handshake with the given server, which selects the client
+// certificate when the config has ClientCertificates. ffresty and wsclient set this for each connection.
+func WithServerName(ctx context.Context, serverName string) context.Context {
+	return context.WithValue(ctx, ctxServerNameKey{}, serverName)
+}
+
+type clientCertSelector struct {
+	ctx         context.Context
+	hosts       map[string]*tls.Certificate
+	wildcards   map[string]*tls.Certificate // keyed by the suffix, including the leading "."
+	defaultCert *tls.Certificate
+}
+
+func newClientCertSelector(ctx context.Context, mappings []*ClientCertificateConfig, defaultCert *tls.Certificate) (*clientCertSelector, error) {
+	s := &clientCertSelector{
+		ctx:         ctx,
+		hosts:       map[string]*tls.Certificate{},
+		wildcards:   map[string]*tls.Certificate{},
+		defaultCert: defaultCert,
+	}
+	for i, m := range mappings {
+		if m == nil || len(m.Hosts) == 0 || m.CertFile == "" || m.KeyFile == "" {
+			return nil, i18n.NewError(ctx, i18n.MsgInvalidClientCertMapping, i)
+		}
+		cert, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
+		if err != nil {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidKeyPairFiles)
+		}
+		for _, host := range m.Hosts {
+			host = strings.ToLower(host)
+			if strings.HasPrefix(host, "*.") {
+				s.wildcards[host[1:]] = &cert
+			} else {
+				s.hosts[host] = &cert
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *clientCertSelector) certificateFor(serverName string) *tls.Certificate {
+	serverName = strings.ToLower(serverName)
+	if cert, ok := s.hosts[serverName]; ok {
+		return cert
+	}
+	// The most specific wildcard wins
+	for name := serverName; ; name = name[1:] {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i:]
+		if cert, ok := s.wildcards[name]; ok {
+			return cert
+		}
+	}
+	return s.defaultCert
+}
+
+func (s *clientCertSelector) getClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	serverName, _ := info.Context().Value(ctxServerNameKey{}).(string)
+	if cert := s.certificateFor(serverName); cert != nil {
+		return cert, nil
+	}
+	log.L(s.ctx).Debugf("No client certificate configured for server '%s'", serverName)
+	// An empty certificate results in no certificate being sent
+	return &tls.Certificate{}, nil
+}
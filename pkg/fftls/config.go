@@ -31,23 +31,44 @@ const (
 	HTTPConfTLSEnabled = "enabled"
 	// HTTPConfTLSKeyFile the private key file for TLS on the server
 	HTTPConfTLSKeyFile = "keyFile"
+	// HTTPConfTLSPKCS12File a PKCS#12 (.p12/.pfx) file containing the certificate chain and private key, as an alternative to certFile and keyFile
+	HTTPConfTLSPKCS12File = "pkcs12File"
+	// HTTPConfTLSPKCS12Passphrase the passphrase of the PKCS#12 file
+	HTTPConfTLSPKCS12Passphrase = "pkcs12Passphrase"
 	// HTTPConfTLSInsecureSkipHostVerify disables host verification - insecure (for dev only)
 	HTTPConfTLSInsecureSkipHostVerify = "insecureSkipHostVerify"
 
+	// HTTPConfTLSOCSPStapling enables stapling of the OCSP response for the server certificate to TLS handshakes
+	HTTPConfTLSOCSPStapling = "ocspStapling"
+
+	// HTTPConfTLSClientCertificates maps target hosts to the client certificate to present to them, with certFile/keyFile used for other hosts
+	HTTPConfTLSClientCertificates = "clientCertificates"
+
 	// HTTPConfTLSRequiredDNAttributes provides a set of regular expressions, to match against the DN of the client. Requires HTTPConfTLSClientAuth
 	HTTPConfTLSRequiredDNAttributes = "requiredDNAttributes"
 
+	// HTTPConfTLSPinnedPublicKeys the SHA-256 hashes of the public keys a client accepts from a server, in addition to validation of the chain
+	HTTPConfTLSPinnedPublicKeys = "pinnedPublicKeys"
+	// HTTPConfTLSPinningOnly whether a client relies on the pinned public keys instead of validation of the chain
+	HTTPConfTLSPinningOnly = "pinningOnly"
+
 	defaultHTTPTLSEnabled = false
 )
 
 type Config struct {
-	Enabled                bool                   `ffstruct:"tlsconfig" json:"enabled"`
-	ClientAuth             bool                   `ffstruct:"tlsconfig" json:"clientAuth,omitempty"`
-	CAFile                 string                 `ffstruct:"tlsconfig" json:"caFile,omitempty"`
-	CertFile               string                 `ffstruct:"tlsconfig" json:"certFile,omitempty"`
-	KeyFile                string                 `ffstruct:"tlsconfig" json:"keyFile,omitempty"`
-	InsecureSkipHostVerify bool                   `ffstruct:"tlsconfig" json:"insecureSkipHostVerify"`
-	RequiredDNAttributes   map[string]interface{} `ffstruct:"tlsconfig" json:"requiredDNAttributes,omitempty"`
+	Enabled                bool                       `ffstruct:"tlsconfig" json:"enabled"`
+	ClientAuth             bool                       `ffstruct:"tlsconfig" json:"clientAuth,omitempty"`
+	CAFile                 string                     `ffstruct:"tlsconfig" json:"caFile,omitempty"`
+	CertFile               string                     `ffstruct:"tlsconfig" json:"certFile,omitempty"`
+	KeyFile                string                     `ffstruct:"tlsconfig" json:"keyFile,omitempty"`
+	PKCS12File             string                     `ffstruct:"tlsconfig" json:"pkcs12File,omitempty"`
+	PKCS12Passphrase       string                     `ffstruct:"tlsconfig" json:"pkcs12Passphrase,omitempty"`
+	InsecureSkipHostVerify bool                       `ffstruct:"tlsconfig" json:"insecureSkipHostVerify"`
+	RequiredDNAttributes   map[string]interface{}     `ffstruct:"tlsconfig" json:"requiredDNAttributes,omitempty"`
+	OCSPStapling           bool                       `ffstruct:"tlsconfig" json:"ocspStapling,omitempty"`
+	ClientCertificates     []*ClientCertificateConfig `ffstruct:"tlsconfig" json:"clientCertificates,omitempty"`
+	PinnedPublicKeys       []string                   `ffstruct:"tlsconfig" json:"pinnedPublicKeys,omitempty"`
+	PinningOnly            bool                       `ffstruct:"tlsconfig" json:"pinningOnly,omitempty"`
 }
 
 func InitTLSConfig(conf config.Section) {
@@ -56,8 +77,15 @@ func InitTLSConfig(conf config.Section) {
 	conf.AddKnownKey(HTTPConfTLSClientAuth)
 	conf.AddKnownKey(HTTPConfTLSCertFile)
 	conf.AddKnownKey(HTTPConfTLSKeyFile)
+	conf.AddKnownKey(HTTPConfTLSPKCS12File)
+	conf.AddKnownKey(HTTPConfTLSPKCS12Passphrase)
 	conf.AddKnownKey(HTTPConfTLSRequiredDNAttributes)
 	conf.AddKnownKey(HTTPConfTLSInsecureSkipHostVerify)
+	conf.AddKnownKey(HTTPConfTLSOCSPStapling)
+	conf.AddKnownKey(HTTPConfTLSClientCertificates)
+	conf.AddKnownKey(HTTPConfTLSPinnedPublicKeys)
+	conf.AddKnownKey(HTTPConfTLSPinningOnly)
+	conf.MarkSensitive(HTTPConfTLSPKCS12Passphrase)
 }
 
 func GenerateConfig(conf config.Section) *Config {
@@ -67,7 +95,25 @@ func GenerateConfig(conf config.Section) *Config {
 		CAFile:                 conf.GetString(HTTPConfTLSCAFile),
 		CertFile:               conf.GetString(HTTPConfTLSCertFile),
 		KeyFile:                conf.GetString(HTTPConfTLSKeyFile),
+		PKCS12File:             conf.GetString(HTTPConfTLSPKCS12File),
+		PKCS12Passphrase:       conf.GetString(HTTPConfTLSPKCS12Passphrase),
 		InsecureSkipHostVerify: conf.GetBool(HTTPConfTLSInsecureSkipHostVerify),
 		RequiredDNAttributes:   conf.GetObject(HTTPConfTLSRequiredDNAttributes),
+		OCSPStapling:           conf.GetBool(HTTPConfTLSOCSPStapling),
+		ClientCertificates:     generateClientCertificates(conf),
+		PinnedPublicKeys:       conf.GetStringSlice(HTTPConfTLSPinnedPublicKeys),
+		PinningOnly:            conf.GetBool(HTTPConfTLSPinningOnly),
+	}
+}
+
+func generateClientCertificates(conf config.Section) []*ClientCertificateConfig {
+	var clientCerts []*ClientCertificateConfig
+	for _, entry := range conf.GetObjectArray(HTTPConfTLSClientCertificates) {
+		clientCerts = append(clientCerts, &ClientCertificateConfig{
+			Hosts:    entry.GetStringArray("hosts"),
+			CertFile: entry.GetString("certFile"),
+			KeyFile:  entry.GetString("keyFile"),
+		})
 	}
+	return clientCerts
 }
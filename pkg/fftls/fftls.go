@@ -46,6 +46,82 @@ func NewTLSConfig(ctx context.Context, config *Config, tlsType TLSType) (*tls.Co
 		return nil, nil
 	}
 
+	// Support custom CA file
+	var rootCAs *x509.CertPool
+	var caBytes []byte
+	var err error
+	if config.CAFile != "" {
+		caBytes, err = os.ReadFile(config.CAFile)
+		if err == nil {
+			rootCAs, err = newCertPool(ctx, caBytes, i18n.MsgInvalidCAFile)
+		}
+	} else {
+		rootCAs, err = x509.SystemCertPool()
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgTLSConfigFailed)
+	}
+
+	// For mTLS we need both the cert and key, from a PKCS#12 file or a pair of PEM files
+	var cert *tls.Certificate
+	switch {
+	case config.PKCS12File != "":
+		if config.CertFile != "" || config.KeyFile != "" {
+			return nil, i18n.NewError(ctx, i18n.MsgTLSCertFilesAndPKCS12)
+		}
+		if cert, err = loadPKCS12KeyPair(ctx, config.PKCS12File, config.PKCS12Passphrase); err != nil {
+			return nil, err
+		}
+	case config.CertFile != "" && config.KeyFile != "":
+		// Read the key pair to create certificate
+		keyPair, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidKeyPairFiles)
+		}
+		cert = &keyPair
+	}
+
+	return buildTLSConfig(ctx, config, tlsType, rootCAs, caBytes, cert)
+}
+
+// NewTLSConfigFromBytes builds a TLS configuration from PEM encoded certificate material held in memory,
+// such as when it is retrieved from a secrets API and must not be written to disk.
+// The certificate and key are optional, but must be supplied together. If no CA is supplied the system CAs are used.
+func NewTLSConfigFromBytes(ctx context.Context, certPEM, keyPEM, caPEM []byte, clientAuth bool, tlsType TLSType) (*tls.Config, error) {
+	var rootCAs *x509.CertPool
+	var err error
+	if len(caPEM) > 0 {
+		rootCAs, err = newCertPool(ctx, caPEM, i18n.MsgInvalidCAPEM)
+	} else {
+		rootCAs, err = x509.SystemCertPool()
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgTLSConfigFailed)
+	}
+
+	var cert *tls.Certificate
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		keyPair, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidKeyPairPEM)
+		}
+		cert = &keyPair
+	}
+
+	return buildTLSConfig(ctx, &Config{Enabled: true, ClientAuth: clientAuth}, tlsType, rootCAs, caPEM, cert)
+}
+
+// newCertPool returns a pool of the CAs supplied, which must contain at least one certificate - so a CA that is
+// configured but empty is an error, rather than falling back to trusting the system CAs
+func newCertPool(ctx context.Context, caPEM []byte, invalidMsg i18n.ErrorMessageKey) (*x509.CertPool, error) {
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(caPEM) {
+		return nil, i18n.NewError(ctx, invalidMsg)
+	}
+	return rootCAs, nil
+}
+
+func buildTLSConfig(ctx context.Context, config *Config, tlsType TLSType, rootCAs *x509.CertPool, caBytes []byte, cert *tls.Certificate) (*tls.Config, error) {
 	tlsConfig := &tls.Config{
 		MinVersion: tls.VersionTLS12,
 		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
@@ -59,38 +135,32 @@ func NewTLSConfig(ctx context.Context, config *Config, tlsType TLSType) (*tls.Co
 		},
 	}
 
-	var err error
-	// Support custom CA file
-	var rootCAs *x509.CertPool
-	if config.CAFile != "" {
-		rootCAs = x509.NewCertPool()
-		var caBytes []byte
-		caBytes, err = os.ReadFile(config.CAFile)
-		if err == nil {
-			ok := rootCAs.AppendCertsFromPEM(caBytes)
-			if !ok {
-				err = i18n.NewError(ctx, i18n.MsgInvalidCAFile)
+	tlsConfig.RootCAs = rootCAs
+
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+
+		if tlsType == ServerType && config.OCSPStapling {
+			if stapler := newOCSPStapler(ctx, *cert, caBytes); stapler != nil {
+				// GetCertificate is only consulted when Certificates is empty, for clients that do not send SNI
+				tlsConfig.Certificates = nil
+				tlsConfig.GetCertificate = stapler.getCertificate
 			}
 		}
-	} else {
-		rootCAs, err = x509.SystemCertPool()
 	}
 
-	if err != nil {
-		return nil, i18n.WrapError(ctx, err, i18n.MsgTLSConfigFailed)
-	}
-
-	tlsConfig.RootCAs = rootCAs
-
-	// For mTLS we need both the cert and key
-	if config.CertFile != "" && config.KeyFile != "" {
-		// Read the key pair to create certificate
-		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	// Select the client certificate for each connection, based on the server name
+	if tlsType == ClientType && len(config.ClientCertificates) > 0 {
+		var defaultCert *tls.Certificate
+		if len(tlsConfig.Certificates) > 0 {
+			defaultCert = &tlsConfig.Certificates[0]
+		}
+		selector, err := newClientCertSelector(ctx, config.ClientCertificates, defaultCert)
 		if err != nil {
-			return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidKeyPairFiles)
+			return nil, err
 		}
-
-		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.Certificates = nil
+		tlsConfig.GetClientCertificate = selector.getClientCertificate
 	}
 
 	if tlsType == ServerType {
@@ -107,6 +177,7 @@ func NewTLSConfig(ctx context.Context, config *Config, tlsType TLSType) (*tls.Co
 	}
 
 	if len(config.RequiredDNAttributes) > 0 {
+		var err error
 		if tlsConfig.VerifyPeerCertificate, err = buildDNValidator(ctx, config.RequiredDNAttributes); err != nil {
 			return nil, err
 		}
@@ -114,6 +185,20 @@ func NewTLSConfig(ctx context.Context, config *Config, tlsType TLSType) (*tls.Co
 
 	tlsConfig.InsecureSkipVerify = config.InsecureSkipHostVerify
 
+	// Pinned public keys are checked by clients, in addition to validation of the chain unless configured to replace it
+	if tlsType == ClientType && (len(config.PinnedPublicKeys) > 0 || config.PinningOnly) {
+		if len(config.PinnedPublicKeys) == 0 {
+			return nil, i18n.NewError(ctx, i18n.MsgTLSPinningOnlyWithoutPins)
+		}
+		var err error
+		if tlsConfig.VerifyPeerCertificate, err = buildPinValidator(ctx, config.PinnedPublicKeys, tlsConfig.VerifyPeerCertificate); err != nil {
+			return nil, err
+		}
+		if config.PinningOnly {
+			tlsConfig.InsecureSkipVerify = true
+		}
+	}
+
 	return tlsConfig, nil
 
 }
@@ -24,9 +24,11 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io"
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -35,14 +37,21 @@ import (
 )
 
 func buildSelfSignedTLSKeyPair(t *testing.T, subject pkix.Name) (string, string) {
+	certPEM, keyPEM := buildSelfSignedTLSKeyPairPEM(t, subject)
+	tmpDir := t.TempDir()
+	privateKeyFile, _ := os.CreateTemp(tmpDir, "key.pem")
+	privateKeyFile.Write(keyPEM)
+	publicKeyFile, _ := os.CreateTemp(tmpDir, "cert.pem")
+	publicKeyFile.Write(certPEM)
+	return publicKeyFile.Name(), privateKeyFile.Name()
+}
+
+func buildSelfSignedTLSKeyPairPEM(t *testing.T, subject pkix.Name) ([]byte, []byte) {
 	// Create an X509 certificate pair
 	privatekey, _ := rsa.GenerateKey(rand.Reader, 2048)
 	publickey := &privatekey.PublicKey
 	var privateKeyBytes []byte = x509.MarshalPKCS1PrivateKey(privatekey)
-	tmpDir := t.TempDir()
-	privateKeyFile, _ := os.CreateTemp(tmpDir, "key.pem")
-	privateKeyBlock := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: privateKeyBytes}
-	pem.Encode(privateKeyFile, privateKeyBlock)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privateKeyBytes})
 	serialNumber, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
 	x509Template := &x509.Certificate{
 		SerialNumber:          serialNumber,
@@ -55,9 +64,8 @@ func buildSelfSignedTLSKeyPair(t *testing.T, subject pkix.Name) (string, string)
 	}
 	derBytes, err := x509.CreateCertificate(rand.Reader, x509Template, x509Template, publickey, privatekey)
 	assert.NoError(t, err)
-	publicKeyFile, _ := os.CreateTemp(tmpDir, "cert.pem")
-	pem.Encode(publicKeyFile, &pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	return publicKeyFile.Name(), privateKeyFile.Name()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+	return certPEM, keyPEM
 }
 
 func buildTLSListener(t *testing.T, conf config.Section, tlsType TLSType) (string, func()) {
@@ -143,6 +151,24 @@ func TestErrInvalidCAFile(t *testing.T) {
 
 }
 
+func TestErrEmptyCAFile(t *testing.T) {
+
+	config.RootConfigReset()
+	emptyCAFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(emptyCAFile, []byte{}, 0600)
+	assert.NoError(t, err)
+
+	conf := config.RootSection("fftls_server")
+	InitTLSConfig(conf)
+	conf.Set(HTTPConfTLSEnabled, true)
+	conf.Set(HTTPConfTLSCAFile, emptyCAFile)
+
+	// an empty CA file does not fall back to the system CAs
+	_, err = ConstructTLSConfig(context.Background(), conf, ClientType)
+	assert.Regexp(t, "FF00152", err)
+
+}
+
 func TestErrInvalidKeyPairFile(t *testing.T) {
 
 	config.RootConfigReset()
@@ -206,6 +232,66 @@ func TestMTLSOk(t *testing.T) {
 
 }
 
+func TestMTLSFromBytesOk(t *testing.T) {
+
+	serverCert, serverKey := buildSelfSignedTLSKeyPairPEM(t, pkix.Name{
+		CommonName: "server.example.com",
+	})
+	clientCert, clientKey := buildSelfSignedTLSKeyPairPEM(t, pkix.Name{
+		CommonName: "client.example.com",
+	})
+
+	serverTLSConfig, err := NewTLSConfigFromBytes(context.Background(), serverCert, serverKey, clientCert, true, ServerType)
+	assert.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, serverTLSConfig.ClientAuth)
+	server, err := tls.Listen("tcp4", "127.0.0.1:0", serverTLSConfig)
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		tlsConn, err := server.Accept()
+		if err == nil {
+			_, _ = io.Copy(tlsConn, tlsConn)
+			tlsConn.Close()
+		}
+	}()
+
+	tlsConfig, err := NewTLSConfigFromBytes(context.Background(), clientCert, clientKey, serverCert, false, ClientType)
+	assert.NoError(t, err)
+	conn, err := tls.Dial("tcp4", server.Addr().String(), tlsConfig)
+	assert.NoError(t, err)
+	_, err = conn.Write([]byte{42})
+	assert.NoError(t, err)
+	readBytes := []byte{0}
+	_, err = conn.Read(readBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{42}, readBytes)
+	_ = conn.Close()
+
+}
+
+func TestTLSFromBytesSystemCAs(t *testing.T) {
+
+	tlsConfig, err := NewTLSConfigFromBytes(context.Background(), nil, nil, nil, false, ClientType)
+	assert.NoError(t, err)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.Empty(t, tlsConfig.Certificates)
+
+}
+
+func TestTLSFromBytesErrors(t *testing.T) {
+
+	cert, key := buildSelfSignedTLSKeyPairPEM(t, pkix.Name{
+		CommonName: "server.example.com",
+	})
+
+	_, err := NewTLSConfigFromBytes(context.Background(), cert, key, key, false, ServerType)
+	assert.Regexp(t, "FF00153.*FF00277", err)
+
+	_, err = NewTLSConfigFromBytes(context.Background(), cert, nil, cert, false, ServerType)
+	assert.Regexp(t, "FF00278", err)
+
+}
+
 func TestMTLSMissingClientCert(t *testing.T) {
 
 	serverPublicKeyFile, serverKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
@@ -465,3 +551,103 @@ func TestConnectSkipVerification(t *testing.T) {
 	_ = conn.Close()
 
 }
+
+func TestMTLSClientCertificatePerHost(t *testing.T) {
+
+	serverPublicKeyFile, serverKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "server.example.com",
+	})
+	clientPublicKeyFile, clientKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "client.example.com",
+	})
+	otherPublicKeyFile, otherKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "other.example.com",
+	})
+
+	config.RootConfigReset()
+
+	serverConf := config.RootSection("fftls_server")
+	InitTLSConfig(serverConf)
+	serverConf.Set(HTTPConfTLSEnabled, true)
+	serverConf.Set(HTTPConfTLSCAFile, clientPublicKeyFile)
+	serverConf.Set(HTTPConfTLSCertFile, serverPublicKeyFile)
+	serverConf.Set(HTTPConfTLSKeyFile, serverKeyFile)
+	serverConf.Set(HTTPConfTLSClientAuth, true)
+
+	addr, done := buildTLSListener(t, serverConf, ServerType)
+	defer done()
+
+	// The default certificate is not trusted by the server
+	clientConf := config.RootSection("fftls_client")
+	InitTLSConfig(clientConf)
+	clientConf.Set(HTTPConfTLSEnabled, true)
+	clientConf.Set(HTTPConfTLSCAFile, serverPublicKeyFile)
+	clientConf.Set(HTTPConfTLSCertFile, otherPublicKeyFile)
+	clientConf.Set(HTTPConfTLSKeyFile, otherKeyFile)
+	clientConf.Set(HTTPConfTLSClientCertificates, []interface{}{
+		map[string]interface{}{
+			"hosts":    []interface{}{"server.example.com", "*.internal.example.com"},
+			"certFile": clientPublicKeyFile,
+			"keyFile":  clientKeyFile,
+		},
+	})
+
+	tlsConfig, err := ConstructTLSConfig(context.Background(), clientConf, ClientType)
+	assert.NoError(t, err)
+	assert.Empty(t, tlsConfig.Certificates)
+
+	roundTrip := func(serverName string) error {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err := dialer.DialContext(WithServerName(context.Background(), serverName), "tcp4", addr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, _ = conn.Write([]byte{42})
+		_, err = conn.Read([]byte{0})
+		return err
+	}
+	assert.NoError(t, roundTrip("server.example.com"))
+	assert.NoError(t, roundTrip("API.Internal.Example.com"))
+	assert.Error(t, roundTrip("unknown.example.com"))
+
+	// Without a default, no certificate is sent to other hosts
+	clientConf.Set(HTTPConfTLSCertFile, "")
+	clientConf.Set(HTTPConfTLSKeyFile, "")
+	tlsConfig, err = ConstructTLSConfig(context.Background(), clientConf, ClientType)
+	assert.NoError(t, err)
+	assert.NoError(t, roundTrip("server.example.com"))
+	assert.Regexp(t, "certificate required", roundTrip("unknown.example.com"))
+
+}
+
+func TestClientCertificateSelection(t *testing.T) {
+
+	certFile, keyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "client.example.com",
+	})
+	ctx := context.Background()
+	s, err := newClientCertSelector(ctx, []*ClientCertificateConfig{
+		{Hosts: []string{"a.example.com", "*.example.com"}, CertFile: certFile, KeyFile: keyFile},
+		{Hosts: []string{"*.b.example.com"}, CertFile: certFile, KeyFile: keyFile},
+	}, nil)
+	assert.NoError(t, err)
+
+	assert.Same(t, s.hosts["a.example.com"], s.certificateFor("A.example.com"))
+	assert.Same(t, s.wildcards[".example.com"], s.certificateFor("c.example.com"))
+	assert.Same(t, s.wildcards[".b.example.com"], s.certificateFor("x.b.example.com"))
+	assert.Nil(t, s.certificateFor("example.com"))
+	assert.Nil(t, s.certificateFor(""))
+
+	_, err = newClientCertSelector(ctx, []*ClientCertificateConfig{{CertFile: certFile, KeyFile: keyFile}}, nil)
+	assert.Regexp(t, "FF00269", err)
+	_, err = newClientCertSelector(ctx, []*ClientCertificateConfig{{Hosts: []string{"a"}, CertFile: keyFile, KeyFile: certFile}}, nil)
+	assert.Regexp(t, "FF00206", err)
+
+	_, err = NewTLSConfig(ctx, &Config{
+		Enabled:            true,
+		ClientCertificates: []*ClientCertificateConfig{nil},
+	}, ClientType)
+	assert.Regexp(t, "FF00269", err)
+
+}
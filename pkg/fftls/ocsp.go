@@ -0,0 +1,171 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/firefly-common/pkg/log"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ocspRequestTimeout  = 10 * time.Second
+	ocspRetryInterval   = 5 * time.Minute
+	ocspDefaultValidity = 1 * time.Hour
+	ocspMaxResponseSize = int64(1024 * 1024)
+)
+
+// ocspStapler supplies the server certificate to each handshake, with the latest OCSP
+// response from the responder named in the certificate stapled to it.
+// The first response is fetched in the background, so handshakes before it arrives are served
+// without a staple. The response is refreshed half way through its validity period. Failures are
+// soft - the certificate is served without a staple, and the fetch is retried later.
+type ocspStapler struct {
+	ctx        context.Context
+	cert       tls.Certificate
+	leaf       *x509.Certificate
+	issuer     *x509.Certificate
+	httpClient *http.Client
+	mux        sync.Mutex
+	current    *tls.Certificate
+	nextUpdate time.Time
+	refreshAt  time.Time
+	refreshing bool
+}
+
+func findIssuer(leaf *x509.Certificate, chain [][]byte, caBytes []byte) *x509.Certificate {
+	candidates := make([]*x509.Certificate, 0, len(chain))
+	for _, der := range chain {
+		if c, err := x509.ParseCertificate(der); err == nil {
+			candidates = append(candidates, c)
+		}
+	}
+	for block, rest := pem.Decode(caBytes); block != nil; block, rest = pem.Decode(rest) {
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			candidates = append(candidates, c)
+		}
+	}
+	for _, c := range candidates {
+		if leaf.CheckSignatureFrom(c) == nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// newOCSPStapler returns nil if stapling is not possible for the certificate
+func newOCSPStapler(ctx context.Context, cert tls.Certificate, caBytes []byte) *ocspStapler {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		log.L(ctx).Warnf("OCSP stapling disabled - unable to parse certificate: %s", err)
+		return nil
+	}
+	if len(leaf.OCSPServer) == 0 {
+		log.L(ctx).Warnf("OCSP stapling disabled - certificate '%s' does not specify an OCSP responder", leaf.Subject)
+		return nil
+	}
+	issuer := findIssuer(leaf, cert.Certificate[1:], caBytes)
+	if issuer == nil {
+		log.L(ctx).Warnf("OCSP stapling disabled - issuer of certificate '%s' not found in certificate chain or CA file", leaf.Subject)
+		return nil
+	}
+	s := &ocspStapler{
+		ctx:        ctx,
+		cert:       cert,
+		leaf:       leaf,
+		issuer:     issuer,
+		httpClient: &http.Client{Timeout: ocspRequestTimeout},
+		current:    &cert,
+		refreshing: true,
+	}
+	go s.refresh()
+	return s
+}
+
+func (s *ocspStapler) fetch() (*ocsp.Response, []byte, error) {
+	reqBytes, err := ocsp.CreateRequest(s.leaf, s.issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := s.httpClient.Post(s.leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(reqBytes))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("OCSP responder returned status %d", res.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(res.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+	ocspRes, err := ocsp.ParseResponseForCert(raw, s.leaf, s.issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ocspRes.Status != ocsp.Good {
+		return nil, nil, fmt.Errorf("OCSP status is not good (status=%d)", ocspRes.Status)
+	}
+	return ocspRes, raw, nil
+}
+
+func (s *ocspStapler) refresh() {
+	ocspRes, raw, err := s.fetch()
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.refreshing = false
+	now := time.Now()
+	if err != nil {
+		log.L(s.ctx).Warnf("Failed to fetch OCSP response for '%s' from %s: %s", s.leaf.Subject, s.leaf.OCSPServer[0], err)
+		s.refreshAt = now.Add(ocspRetryInterval)
+		if s.current.OCSPStaple != nil && now.After(s.nextUpdate) {
+			// Stop stapling a response that has expired
+			s.current = &s.cert
+		}
+		return
+	}
+	stapled := s.cert
+	stapled.OCSPStaple = raw
+	s.current = &stapled
+	s.nextUpdate = ocspRes.NextUpdate
+	if ocspRes.NextUpdate.IsZero() {
+		s.nextUpdate = now.Add(ocspDefaultValidity)
+	}
+	s.refreshAt = ocspRes.ThisUpdate.Add(s.nextUpdate.Sub(ocspRes.ThisUpdate) / 2)
+	log.L(s.ctx).Debugf("Stapling OCSP response for '%s' (nextUpdate=%s)", s.leaf.Subject, s.nextUpdate)
+}
+
+func (s *ocspStapler) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.refreshing && time.Now().After(s.refreshAt) {
+		s.refreshing = true
+		go s.refresh()
+	}
+	return s.current, nil
+}
@@ -0,0 +1,299 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+type testOCSPResponder struct {
+	server     *httptest.Server
+	caCert     *x509.Certificate
+	caKey      *rsa.PrivateKey
+	status     int
+	nextUpdate time.Duration
+	fail       bool
+	requests   int
+}
+
+func newTestOCSPResponder(t *testing.T) *testOCSPResponder {
+	caKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-1 * time.Minute),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	r := &testOCSPResponder{
+		caCert:     caCert,
+		caKey:      caKey,
+		status:     ocsp.Good,
+		nextUpdate: 1 * time.Hour,
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		r.requests++
+		if r.fail {
+			res.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		ocspReq, err := ocsp.ParseRequest(body)
+		assert.NoError(t, err)
+		template := ocsp.Response{
+			Status:       r.status,
+			SerialNumber: ocspReq.SerialNumber,
+			ThisUpdate:   time.Now(),
+		}
+		if r.nextUpdate > 0 {
+			template.NextUpdate = time.Now().Add(r.nextUpdate)
+		}
+		ocspRes, err := ocsp.CreateResponse(r.caCert, r.caCert, template, r.caKey)
+		assert.NoError(t, err)
+		_, _ = res.Write(ocspRes)
+	}))
+	t.Cleanup(r.server.Close)
+	return r
+}
+
+// writes the server cert/key, and the CA file, returning the file names
+func (r *testOCSPResponder) issueServerCert(t *testing.T, ocspServer string, includeCAInChain bool) (string, string, string) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "server"},
+		NotBefore:    time.Now().Add(-1 * time.Minute),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if ocspServer != "" {
+		template.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, r.caCert, &key.PublicKey, r.caKey)
+	assert.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.caCert.Raw})
+	if includeCAInChain {
+		certPEM = append(certPEM, caPEM...)
+	}
+	certFile := path.Join(tmpDir, "cert.pem")
+	keyFile := path.Join(tmpDir, "key.pem")
+	caFile := path.Join(tmpDir, "ca.pem")
+	assert.NoError(t, os.WriteFile(certFile, certPEM, 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	assert.NoError(t, os.WriteFile(caFile, caPEM, 0600))
+	return certFile, keyFile, caFile
+}
+
+func waitRefreshed(s *ocspStapler) {
+	for {
+		s.mux.Lock()
+		refreshing := s.refreshing
+		s.mux.Unlock()
+		if !refreshing {
+			return
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestOCSPStaplingHandshake(t *testing.T) {
+	r := newTestOCSPResponder(t)
+	certFile, keyFile, caFile := r.issueServerCert(t, r.server.URL, false)
+
+	tlsConfig, err := NewTLSConfig(context.Background(), &Config{
+		Enabled:      true,
+		CAFile:       caFile,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		OCSPStapling: true,
+	}, ServerType)
+	assert.NoError(t, err)
+	assert.Empty(t, tlsConfig.Certificates)
+	assert.NotNil(t, tlsConfig.GetCertificate)
+	for {
+		// The first response is fetched in the background
+		if c, _ := tlsConfig.GetCertificate(nil); c.OCSPStaple != nil {
+			break
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	server, err := tls.Listen("tcp4", "127.0.0.1:0", tlsConfig)
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		conn, err := server.Accept()
+		if err == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(r.caCert)
+	conn, err := tls.Dial("tcp4", server.Addr().String(), &tls.Config{RootCAs: rootCAs})
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	stapled := conn.ConnectionState().OCSPResponse
+	assert.NotEmpty(t, stapled)
+	ocspRes, err := ocsp.ParseResponse(stapled, r.caCert)
+	assert.NoError(t, err)
+	assert.Equal(t, ocsp.Good, ocspRes.Status)
+}
+
+func TestOCSPStaplingRefresh(t *testing.T) {
+	r := newTestOCSPResponder(t)
+	r.nextUpdate = 0
+	certFile, keyFile, _ := r.issueServerCert(t, r.server.URL, true)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+
+	s := newOCSPStapler(context.Background(), cert, nil)
+	assert.NotNil(t, s)
+	c, err := s.getCertificate(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, c.OCSPStaple)
+	waitRefreshed(s)
+	assert.Equal(t, 1, r.requests)
+	assert.WithinDuration(t, time.Now().Add(ocspDefaultValidity), s.nextUpdate, 1*time.Minute)
+	c, err = s.getCertificate(nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, c.OCSPStaple)
+
+	// Failure keeps the staple while it is still valid
+	r.fail = true
+	s.refresh()
+	c, _ = s.getCertificate(nil)
+	assert.NotEmpty(t, c.OCSPStaple)
+	assert.WithinDuration(t, time.Now().Add(ocspRetryInterval), s.refreshAt, 1*time.Minute)
+
+	// Once expired, the staple is dropped
+	s.nextUpdate = time.Now().Add(-1 * time.Second)
+	s.refresh()
+	c, _ = s.getCertificate(nil)
+	assert.Empty(t, c.OCSPStaple)
+
+	// Refresh is triggered by the handshake when due
+	r.fail = false
+	s.refreshAt = time.Now().Add(-1 * time.Second)
+	_, _ = s.getCertificate(nil)
+	waitRefreshed(s)
+	c, _ = s.getCertificate(nil)
+	assert.NotEmpty(t, c.OCSPStaple)
+}
+
+func TestOCSPStaplingFailSoft(t *testing.T) {
+	r := newTestOCSPResponder(t)
+	r.status = ocsp.Revoked
+	certFile, keyFile, caFile := r.issueServerCert(t, r.server.URL, false)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	caBytes, _ := os.ReadFile(caFile)
+
+	s := newOCSPStapler(context.Background(), cert, caBytes)
+	waitRefreshed(s)
+	c, _ := s.getCertificate(nil)
+	assert.Empty(t, c.OCSPStaple)
+
+	r.status = ocsp.Good
+	r.server.Close()
+	s.refresh()
+	c, _ = s.getCertificate(nil)
+	assert.Empty(t, c.OCSPStaple)
+
+	s.leaf.OCSPServer = []string{"!!!://bad"}
+	s.refresh()
+	c, _ = s.getCertificate(nil)
+	assert.Empty(t, c.OCSPStaple)
+}
+
+func TestOCSPStaplingBadResponses(t *testing.T) {
+	r := newTestOCSPResponder(t)
+	certFile, keyFile, _ := r.issueServerCert(t, r.server.URL, true)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	s := newOCSPStapler(context.Background(), cert, nil)
+	waitRefreshed(s)
+
+	badServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte("not an OCSP response"))
+	}))
+	defer badServer.Close()
+	s.leaf.OCSPServer = []string{badServer.URL}
+	_, _, err = s.fetch()
+	assert.Error(t, err)
+
+	s.issuer = &x509.Certificate{}
+	_, _, err = s.fetch()
+	assert.Error(t, err)
+}
+
+func TestOCSPStaplingDisabledForCert(t *testing.T) {
+	r := newTestOCSPResponder(t)
+
+	certFile, keyFile, caFile := r.issueServerCert(t, "", false)
+	tlsConfig, err := NewTLSConfig(context.Background(), &Config{
+		Enabled:      true,
+		CAFile:       caFile,
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		OCSPStapling: true,
+	}, ServerType)
+	assert.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Nil(t, tlsConfig.GetCertificate)
+
+	// Issuer not available
+	certFile, keyFile, _ = r.issueServerCert(t, r.server.URL, false)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+	assert.Nil(t, newOCSPStapler(context.Background(), cert, nil))
+
+	// Bad certificate
+	assert.Nil(t, newOCSPStapler(context.Background(), tls.Certificate{Certificate: [][]byte{[]byte("bad")}}, nil))
+	assert.Equal(t, 0, r.requests)
+}
@@ -0,0 +1,94 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+const pinPrefix = "sha256/"
+
+// PublicKeyPin returns the pin of the public key of a certificate, in the "sha256/<base64>" form accepted
+// in PinnedPublicKeys. This is the base64 SHA-256 hash of its DER encoded SubjectPublicKeyInfo, which can
+// also be calculated with:
+//
+//	openssl x509 -in cert.pem -pubkey -noout | openssl pkey -pubin -outform der | openssl dgst -sha256 -binary | base64
+func PublicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func parsePins(ctx context.Context, pinnedPublicKeys []string) (map[string]bool, error) {
+	pins := make(map[string]bool, len(pinnedPublicKeys))
+	for _, pin := range pinnedPublicKeys {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), pinPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, i18n.NewError(ctx, i18n.MsgInvalidTLSPinnedPublicKey, pin)
+		}
+		pins[pinPrefix+base64.StdEncoding.EncodeToString(hash)] = true
+	}
+	return pins, nil
+}
+
+// buildPinValidator returns a check that the peer has a pinned public key, which runs before the next check (if any).
+// When the chain has been verified, any certificate in a verified chain can be pinned - such as an intermediate CA.
+// Otherwise only the leaf certificate presented by the peer is checked, as the peer can present any other
+// certificates it likes alongside it, without proving it holds their private keys.
+func buildPinValidator(ctx context.Context, pinnedPublicKeys []string, next func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error) (func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error, error) {
+	pins, err := parsePins(ctx, pinnedPublicKeys)
+	if err != nil {
+		return nil, err
+	}
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		var candidates []*x509.Certificate
+		if len(verifiedChains) > 0 {
+			for _, chain := range verifiedChains {
+				candidates = append(candidates, chain...)
+			}
+		} else if len(rawCerts) > 0 {
+			if leaf, err := x509.ParseCertificate(rawCerts[0]); err == nil {
+				candidates = append(candidates, leaf)
+			}
+		}
+		seen := make([]string, 0, len(candidates))
+		matched := false
+		for _, cert := range candidates {
+			pin := PublicKeyPin(cert)
+			seen = append(seen, pin)
+			if pins[pin] {
+				log.L(ctx).Debugf("TLS public key pin matched for Subject=%s", cert.Subject)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			log.L(ctx).Errorf("Failed TLS public key pin check: expected one of %v, seen %v", pinnedPublicKeys, seen)
+			return i18n.NewError(ctx, i18n.MsgTLSPinnedPublicKeyMismatch, pinnedPublicKeys, seen)
+		}
+		if next != nil {
+			return next(rawCerts, verifiedChains)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,180 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func pinOfCertFile(t *testing.T, certFile string) string {
+	certPEM, err := os.ReadFile(certFile)
+	assert.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	return PublicKeyPin(cert)
+}
+
+func newPinningTestServer(t *testing.T) (string, string, func()) {
+	serverPublicKeyFile, serverKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "server.example.com",
+	})
+
+	config.RootConfigReset()
+	serverConf := config.RootSection("fftls_server")
+	InitTLSConfig(serverConf)
+	serverConf.Set(HTTPConfTLSEnabled, true)
+	serverConf.Set(HTTPConfTLSCertFile, serverPublicKeyFile)
+	serverConf.Set(HTTPConfTLSKeyFile, serverKeyFile)
+
+	addr, done := buildTLSListener(t, serverConf, ServerType)
+	return addr, serverPublicKeyFile, done
+}
+
+func dialPinned(t *testing.T, addr, caFile string, pins []string, pinningOnly bool) error {
+	clientConf := config.RootSection("fftls_client")
+	InitTLSConfig(clientConf)
+	clientConf.Set(HTTPConfTLSEnabled, true)
+	clientConf.Set(HTTPConfTLSCAFile, caFile)
+	clientConf.Set(HTTPConfTLSPinnedPublicKeys, pins)
+	clientConf.Set(HTTPConfTLSPinningOnly, pinningOnly)
+
+	tlsConfig, err := ConstructTLSConfig(context.Background(), clientConf, ClientType)
+	assert.NoError(t, err)
+	conn, err := tls.Dial("tcp4", addr, tlsConfig)
+	if err == nil {
+		_ = conn.Close()
+	}
+	return err
+}
+
+func TestPinnedPublicKeyMatch(t *testing.T) {
+	addr, serverCertFile, done := newPinningTestServer(t)
+	defer done()
+
+	pin := pinOfCertFile(t, serverCertFile)
+	err := dialPinned(t, addr, serverCertFile, []string{"sha256/" + strings.Repeat("A", 43) + "=", pin}, false)
+	assert.NoError(t, err)
+
+	// the prefix is optional
+	err = dialPinned(t, addr, serverCertFile, []string{strings.TrimPrefix(pin, "sha256/")}, false)
+	assert.NoError(t, err)
+}
+
+func TestPinnedPublicKeyMismatch(t *testing.T) {
+	addr, serverCertFile, done := newPinningTestServer(t)
+	defer done()
+
+	otherPin := "sha256/" + strings.Repeat("A", 43) + "="
+	err := dialPinned(t, addr, serverCertFile, []string{otherPin}, false)
+	assert.Regexp(t, "FF00290", err)
+	assert.Contains(t, err.Error(), otherPin)
+	assert.Contains(t, err.Error(), pinOfCertFile(t, serverCertFile))
+}
+
+func TestPinnedPublicKeyChainStillValidated(t *testing.T) {
+	addr, serverCertFile, done := newPinningTestServer(t)
+	defer done()
+
+	// The server is self-signed, so is not trusted by another CA even though the pin matches
+	otherCAFile, _ := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "ca.example.com"})
+	err := dialPinned(t, addr, otherCAFile, []string{pinOfCertFile(t, serverCertFile)}, false)
+	assert.Regexp(t, "certificate", err)
+}
+
+func TestPinningOnly(t *testing.T) {
+	addr, serverCertFile, done := newPinningTestServer(t)
+	defer done()
+
+	otherCAFile, _ := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "ca.example.com"})
+	err := dialPinned(t, addr, otherCAFile, []string{pinOfCertFile(t, serverCertFile)}, true)
+	assert.NoError(t, err)
+
+	err = dialPinned(t, addr, otherCAFile, []string{pinOfCertFile(t, otherCAFile)}, true)
+	assert.Regexp(t, "FF00290", err)
+}
+
+func TestPinningConfigErrors(t *testing.T) {
+	_, err := NewTLSConfig(context.Background(), &Config{
+		Enabled:          true,
+		PinnedPublicKeys: []string{"sha256/not-base64!"},
+	}, ClientType)
+	assert.Regexp(t, "FF00288", err)
+
+	_, err = NewTLSConfig(context.Background(), &Config{
+		Enabled:          true,
+		PinnedPublicKeys: []string{"c2hvcnQ="},
+	}, ClientType)
+	assert.Regexp(t, "FF00288", err)
+
+	_, err = NewTLSConfig(context.Background(), &Config{
+		Enabled:     true,
+		PinningOnly: true,
+	}, ClientType)
+	assert.Regexp(t, "FF00289", err)
+}
+
+func TestPinValidatorCallsNext(t *testing.T) {
+	certFile, _ := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "server.example.com"})
+	certPEM, _ := os.ReadFile(certFile)
+	block, _ := pem.Decode(certPEM)
+
+	nextCalled := false
+	validator, err := buildPinValidator(context.Background(), []string{pinOfCertFile(t, certFile)}, func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		nextCalled = true
+		return nil
+	})
+	assert.NoError(t, err)
+	err = validator([][]byte{block.Bytes, []byte("not a cert")}, nil)
+	assert.NoError(t, err)
+	assert.True(t, nextCalled)
+}
+
+func TestPinValidatorUnverifiedChecksLeafOnly(t *testing.T) {
+	leafFile, _ := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "server.example.com"})
+	leafPEM, _ := os.ReadFile(leafFile)
+	leafBlock, _ := pem.Decode(leafPEM)
+	pinnedFile, _ := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "ca.example.com"})
+	pinnedPEM, _ := os.ReadFile(pinnedFile)
+	pinnedBlock, _ := pem.Decode(pinnedPEM)
+
+	validator, err := buildPinValidator(context.Background(), []string{pinOfCertFile(t, pinnedFile)}, nil)
+	assert.NoError(t, err)
+
+	// a peer cannot satisfy the pin by presenting the pinned certificate after its own leaf
+	err = validator([][]byte{leafBlock.Bytes, pinnedBlock.Bytes}, nil)
+	assert.Regexp(t, "FF00290", err)
+
+	err = validator([][]byte{[]byte("not a cert"), pinnedBlock.Bytes}, nil)
+	assert.Regexp(t, "FF00290", err)
+
+	// but once the chain is verified, any certificate in it can be pinned
+	leaf, _ := x509.ParseCertificate(leafBlock.Bytes)
+	pinned, _ := x509.ParseCertificate(pinnedBlock.Bytes)
+	err = validator([][]byte{leafBlock.Bytes}, [][]*x509.Certificate{{leaf, pinned}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,59 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// loadPKCS12KeyPair reads the certificate chain and private key from a PKCS#12 file, checking the key
+// matches the certificate in the same way as for a pair of PEM files
+func loadPKCS12KeyPair(ctx context.Context, file, passphrase string) (*tls.Certificate, error) {
+	pfxData, err := os.ReadFile(file)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidPKCS12File, file)
+	}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(pfxData, passphrase)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, i18n.NewError(ctx, i18n.MsgPKCS12IncorrectPassphrase, file)
+	}
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidPKCS12File, file)
+	}
+
+	var certPEM []byte
+	for _, c := range append([]*x509.Certificate{leaf}, caCerts...) {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidPKCS12File, file)
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidPKCS12File, file)
+	}
+	return &cert, nil
+}
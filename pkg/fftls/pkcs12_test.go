@@ -0,0 +1,117 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func buildPKCS12File(t *testing.T, certFile, keyFile, passphrase string) string {
+	certPEM, err := os.ReadFile(certFile)
+	assert.NoError(t, err)
+	keyPEM, err := os.ReadFile(keyFile)
+	assert.NoError(t, err)
+	certBlock, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	assert.NoError(t, err)
+	keyBlock, _ := pem.Decode(keyPEM)
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	assert.NoError(t, err)
+	pfxData, err := pkcs12.Modern2023.Encode(key, cert, nil, passphrase)
+	assert.NoError(t, err)
+	pfxFile := filepath.Join(t.TempDir(), "client.p12")
+	assert.NoError(t, os.WriteFile(pfxFile, pfxData, 0600))
+	return pfxFile
+}
+
+func TestMTLSOkPKCS12(t *testing.T) {
+
+	serverPublicKeyFile, serverKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "server.example.com",
+	})
+	clientPublicKeyFile, clientKeyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{
+		CommonName: "client.example.com",
+	})
+	pfxFile := buildPKCS12File(t, clientPublicKeyFile, clientKeyFile, "s3cret")
+
+	config.RootConfigReset()
+
+	serverConf := config.RootSection("fftls_server")
+	InitTLSConfig(serverConf)
+	serverConf.Set(HTTPConfTLSEnabled, true)
+	serverConf.Set(HTTPConfTLSCAFile, clientPublicKeyFile)
+	serverConf.Set(HTTPConfTLSCertFile, serverPublicKeyFile)
+	serverConf.Set(HTTPConfTLSKeyFile, serverKeyFile)
+	serverConf.Set(HTTPConfTLSClientAuth, true)
+
+	addr, done := buildTLSListener(t, serverConf, ServerType)
+	defer done()
+
+	clientConf := config.RootSection("fftls_client")
+	InitTLSConfig(clientConf)
+	clientConf.Set(HTTPConfTLSEnabled, true)
+	clientConf.Set(HTTPConfTLSCAFile, serverPublicKeyFile)
+	clientConf.Set(HTTPConfTLSPKCS12File, pfxFile)
+	clientConf.Set(HTTPConfTLSPKCS12Passphrase, "s3cret")
+
+	tlsConfig, err := ConstructTLSConfig(context.Background(), clientConf, ClientType)
+	assert.NoError(t, err)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	conn, err := tls.Dial("tcp4", addr, tlsConfig)
+	assert.NoError(t, err)
+	written, err := conn.Write([]byte{42})
+	assert.NoError(t, err)
+	assert.Equal(t, written, 1)
+	readBytes := []byte{0}
+	readCount, err := conn.Read(readBytes)
+	assert.NoError(t, err)
+	assert.Equal(t, readCount, 1)
+	assert.Equal(t, []byte{42}, readBytes)
+	_ = conn.Close()
+
+}
+
+func TestPKCS12Errors(t *testing.T) {
+	ctx := context.Background()
+	certFile, keyFile := buildSelfSignedTLSKeyPair(t, pkix.Name{CommonName: "client.example.com"})
+	pfxFile := buildPKCS12File(t, certFile, keyFile, "s3cret")
+	corruptFile := filepath.Join(t.TempDir(), "corrupt.p12")
+	assert.NoError(t, os.WriteFile(corruptFile, []byte("not a p12"), 0600))
+
+	_, err := NewTLSConfig(ctx, &Config{Enabled: true, PKCS12File: pfxFile, PKCS12Passphrase: "wrong"}, ClientType)
+	assert.Regexp(t, "FF00272", err)
+
+	_, err = NewTLSConfig(ctx, &Config{Enabled: true, PKCS12File: corruptFile}, ClientType)
+	assert.Regexp(t, "FF00271.*corrupt.p12", err)
+
+	_, err = NewTLSConfig(ctx, &Config{Enabled: true, PKCS12File: filepath.Join(t.TempDir(), "missing.p12")}, ClientType)
+	assert.Regexp(t, "FF00271.*missing.p12", err)
+
+	_, err = NewTLSConfig(ctx, &Config{Enabled: true, PKCS12File: pfxFile, PKCS12Passphrase: "s3cret", CertFile: certFile, KeyFile: keyFile}, ClientType)
+	assert.Regexp(t, "FF00273", err)
+}
@@ -26,4 +26,6 @@ type AuthReq struct {
 	URL       *url.URL
 	Header    http.Header
 	Namespace string
+	// Principal can be set by an auth plugin on successful authorization, to identify the caller
+	Principal string
 }
@@ -59,6 +59,28 @@ func (ts *FFEnum) UnmarshalText(b []byte) error {
 	return nil
 }
 
+// Scan implements sql.Scanner
+func (ts *FFEnum) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*ts = ""
+		return nil
+	case string:
+		return ts.UnmarshalText([]byte(src))
+	case []byte:
+		return ts.UnmarshalText(src)
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, ts)
+	}
+}
+
+// Validate checks the value is one of the registered values for enum type t,
+// returning an error that lists the valid options if it is not
+func (ts FFEnum) Validate(ctx context.Context, t string) error {
+	_, err := FFEnumParseString(ctx, t, string(ts))
+	return err
+}
+
 func FFEnumValid(ctx context.Context, t string, val FFEnum) bool {
 	_, err := FFEnumParseString(ctx, t, string(val))
 	if err != nil {
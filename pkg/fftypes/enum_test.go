@@ -74,3 +74,33 @@ func TestFFEnumParseString(t *testing.T) {
 	assert.Regexp(t, "FF00172", err)
 	assert.Empty(t, v)
 }
+
+func TestFFEnumScan(t *testing.T) {
+	var e FFEnum
+	err := e.Scan("Test_Enum_VAL1")
+	assert.NoError(t, err)
+	assert.Equal(t, TestEnumVal1, e)
+
+	err = e.Scan([]byte("test_enum_val2"))
+	assert.NoError(t, err)
+	assert.Equal(t, TestEnumVal2, e)
+
+	err = e.Scan(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, e)
+
+	err = e.Scan(12345)
+	assert.Regexp(t, "FF00105", err)
+}
+
+func TestFFEnumValidate(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, TestEnumVal1.Validate(ctx, "ut"))
+	assert.NoError(t, FFEnum("TEST_ENUM_VAL2").Validate(ctx, "ut"))
+
+	err := FFEnum("foobar").Validate(ctx, "ut")
+	assert.Regexp(t, "FF00172.*test_enum_val1 test_enum_val2", err)
+
+	err = TestEnumVal1.Validate(ctx, "foobar")
+	assert.Regexp(t, "FF00171", err)
+}
@@ -102,14 +102,16 @@ type FFIParam struct {
 type FFIParams []*FFIParam
 
 type FFIGenerationRequest struct {
-	Namespace   string   `ffstruct:"FFIGenerationRequest" json:"namespace,omitempty"`
-	Name        string   `ffstruct:"FFIGenerationRequest" json:"name"`
-	Description string   `ffstruct:"FFIGenerationRequest" json:"description"`
-	Version     string   `ffstruct:"FFIGenerationRequest" json:"version"`
+	Namespace   string   `ffstruct:"FFIGenerationRequest" json:"namespace,omitempty" ffvalidate:"ffname"`
+	Name        string   `ffstruct:"FFIGenerationRequest" json:"name" ffvalidate:"ffname"`
+	Description string   `ffstruct:"FFIGenerationRequest" json:"description" ffvalidate:"maxlen=4096"`
+	Version     string   `ffstruct:"FFIGenerationRequest" json:"version" ffvalidate:"ffname"`
 	Input       *JSONAny `ffstruct:"FFIGenerationRequest" json:"input"`
 }
 
-func (f *FFI) Validate(ctx context.Context) (err error) {
+// Validate checks the names of the interface. The names of params are only checked if a mode other
+// than FFIParamNamesUnchecked is passed, and the normalize modes update the names in place.
+func (f *FFI) Validate(ctx context.Context, paramNames ...FFIParamNameMode) (err error) {
 	if err = ValidateFFNameField(ctx, f.Name, "name"); err != nil {
 		return err
 	}
@@ -121,6 +123,9 @@ func (f *FFI) Validate(ctx context.Context) (err error) {
 			return err
 		}
 	}
+	if len(paramNames) > 0 {
+		return f.validateParamNames(ctx, paramNames[0])
+	}
 	return nil
 }
 
@@ -132,6 +137,63 @@ func (f *FFI) SetBroadcastMessage(msgID *UUID) {
 	f.Message = msgID
 }
 
+// FFILookup indexes the methods, events and errors of an FFI, so they can be found without scanning.
+// It reflects the FFI at the point it was built - build a new one after changing the Methods, Events or Errors.
+type FFILookup struct {
+	methodsByName     map[string]*FFIMethod
+	eventsBySignature map[string]*FFIEvent
+	errorsBySignature map[string]*FFIError
+}
+
+// NewFFILookup builds the lookup maps of an FFI, which can be shared by concurrent callers
+func NewFFILookup(f *FFI) *FFILookup {
+	l := &FFILookup{
+		methodsByName:     make(map[string]*FFIMethod, len(f.Methods)),
+		eventsBySignature: make(map[string]*FFIEvent, len(f.Events)),
+		errorsBySignature: make(map[string]*FFIError, len(f.Errors)),
+	}
+	for _, m := range f.Methods {
+		if m == nil {
+			continue
+		}
+		if _, exists := l.methodsByName[m.Name]; !exists {
+			l.methodsByName[m.Name] = m
+		}
+	}
+	for _, e := range f.Events {
+		if e == nil {
+			continue
+		}
+		if _, exists := l.eventsBySignature[e.Signature]; !exists {
+			l.eventsBySignature[e.Signature] = e
+		}
+	}
+	for _, e := range f.Errors {
+		if e == nil {
+			continue
+		}
+		if _, exists := l.errorsBySignature[e.Signature]; !exists {
+			l.errorsBySignature[e.Signature] = e
+		}
+	}
+	return l
+}
+
+// MethodByName returns the first method with the supplied name, or nil if there is none
+func (l *FFILookup) MethodByName(name string) *FFIMethod {
+	return l.methodsByName[name]
+}
+
+// EventBySignature returns the first event with the supplied signature, or nil if there is none
+func (l *FFILookup) EventBySignature(sig string) *FFIEvent {
+	return l.eventsBySignature[sig]
+}
+
+// ErrorBySignature returns the first error with the supplied signature, or nil if there is none
+func (l *FFILookup) ErrorBySignature(sig string) *FFIError {
+	return l.errorsBySignature[sig]
+}
+
 // Scan implements sql.Scanner
 func (p *FFIParams) Scan(src interface{}) error {
 	switch src := src.(type) {
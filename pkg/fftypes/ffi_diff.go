@@ -0,0 +1,263 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+type FFIChangeType = FFEnum
+
+var (
+	// FFIChangeAdded is a method, event or error that is only in the new FFI
+	FFIChangeAdded = FFEnumValue("ffichangetype", "added")
+	// FFIChangeRemoved is a method, event or error that is only in the old FFI
+	FFIChangeRemoved = FFEnumValue("ffichangetype", "removed")
+	// FFIChangeChanged is a method, event or error that is in both, with differences
+	FFIChangeChanged = FFEnumValue("ffichangetype", "changed")
+)
+
+type FFIElementType = FFEnum
+
+var (
+	FFIElementMethod = FFEnumValue("ffielementtype", "method")
+	FFIElementEvent  = FFEnumValue("ffielementtype", "event")
+	FFIElementError  = FFEnumValue("ffielementtype", "error")
+)
+
+// FFIChangeReport is the result of comparing two versions of an FFI
+type FFIChangeReport struct {
+	OldVersion string       `ffstruct:"FFIChangeReport" json:"oldVersion"`
+	NewVersion string       `ffstruct:"FFIChangeReport" json:"newVersion"`
+	Breaking   bool         `ffstruct:"FFIChangeReport" json:"breaking"`
+	Changes    []*FFIChange `ffstruct:"FFIChangeReport" json:"changes"`
+}
+
+// FFIChange is an addition, removal or change to a single method, event or error. Overloaded names
+// are matched in the order they appear, with a numeric suffix on the second and subsequent use.
+type FFIChange struct {
+	Change   FFIChangeType  `ffstruct:"FFIChange" json:"change" ffenum:"ffichangetype"`
+	Element  FFIElementType `ffstruct:"FFIChange" json:"element" ffenum:"ffielementtype"`
+	Name     string         `ffstruct:"FFIChange" json:"name"`
+	Breaking bool           `ffstruct:"FFIChange" json:"breaking"`
+	Details  []string       `ffstruct:"FFIChange" json:"details,omitempty"`
+}
+
+// ffiDiffElement is the part of a method, event or error that is compared
+type ffiDiffElement struct {
+	name        string
+	description string
+	params      FFIParams
+	returns     FFIParams
+	details     JSONObject
+}
+
+type ffiDiffer struct {
+	ctx    context.Context
+	report *FFIChangeReport
+}
+
+// FFIDiff compares two versions of an interface, and reports each method, event and error that has been
+// added, removed or changed - classified as breaking or not for existing users of the interface:
+//   - Adding a method, event or error is not breaking
+//   - Removing one is breaking
+//   - Changing the name, order, number or schema of params or returns, or the details, is breaking
+//   - Changing only descriptions (including within a schema) is not breaking
+func FFIDiff(old, new *FFI) (*FFIChangeReport, error) {
+	ctx := context.Background()
+	if old == nil || new == nil {
+		return nil, i18n.NewError(ctx, i18n.MsgFFIDiffMissing)
+	}
+	d := &ffiDiffer{
+		ctx: ctx,
+		report: &FFIChangeReport{
+			OldVersion: old.Version,
+			NewVersion: new.Version,
+			Changes:    []*FFIChange{},
+		},
+	}
+	methodElements := func(methods []*FFIMethod) []*ffiDiffElement {
+		elements := make([]*ffiDiffElement, 0, len(methods))
+		for _, m := range methods {
+			elements = append(elements, &ffiDiffElement{name: m.Name, description: m.Description, params: m.Params, returns: m.Returns, details: m.Details})
+		}
+		return elements
+	}
+	eventElements := func(events []*FFIEvent) []*ffiDiffElement {
+		elements := make([]*ffiDiffElement, 0, len(events))
+		for _, e := range events {
+			elements = append(elements, &ffiDiffElement{name: e.Name, description: e.Description, params: e.Params, details: e.Details})
+		}
+		return elements
+	}
+	errorElements := func(errors []*FFIError) []*ffiDiffElement {
+		elements := make([]*ffiDiffElement, 0, len(errors))
+		for _, e := range errors {
+			elements = append(elements, &ffiDiffElement{name: e.Name, description: e.Description, params: e.Params})
+		}
+		return elements
+	}
+	if err := d.diffElements(FFIElementMethod, methodElements(old.Methods), methodElements(new.Methods)); err != nil {
+		return nil, err
+	}
+	if err := d.diffElements(FFIElementEvent, eventElements(old.Events), eventElements(new.Events)); err != nil {
+		return nil, err
+	}
+	if err := d.diffElements(FFIElementError, errorElements(old.Errors), errorElements(new.Errors)); err != nil {
+		return nil, err
+	}
+	return d.report, nil
+}
+
+func (d *ffiDiffer) addChange(change *FFIChange) {
+	d.report.Changes = append(d.report.Changes, change)
+	if change.Breaking {
+		d.report.Breaking = true
+	}
+}
+
+func (d *ffiDiffer) diffElements(elementType FFIElementType, oldElements, newElements []*ffiDiffElement) error {
+	oldByName := make(map[string]*ffiDiffElement, len(oldElements))
+	oldOrder := make([]string, 0, len(oldElements))
+	oldNames := make(uniqueNames)
+	for _, e := range oldElements {
+		name := oldNames.next(e.name)
+		oldByName[name] = e
+		oldOrder = append(oldOrder, name)
+	}
+	newNames := make(uniqueNames)
+	for _, newElement := range newElements {
+		name := newNames.next(newElement.name)
+		oldElement := oldByName[name]
+		if oldElement == nil {
+			d.addChange(&FFIChange{Change: FFIChangeAdded, Element: elementType, Name: name})
+			continue
+		}
+		delete(oldByName, name)
+		change := &FFIChange{Change: FFIChangeChanged, Element: elementType, Name: name}
+		if oldElement.description != newElement.description {
+			change.Details = append(change.Details, "description changed")
+		}
+		prefix := fmt.Sprintf("%ss.%s", elementType, name)
+		if err := d.diffParams(change, prefix+".params", "param", oldElement.params, newElement.params); err != nil {
+			return err
+		}
+		if err := d.diffParams(change, prefix+".returns", "return", oldElement.returns, newElement.returns); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(normalizeJSONObject(oldElement.details), normalizeJSONObject(newElement.details)) {
+			change.Details = append(change.Details, "details changed")
+			change.Breaking = true
+		}
+		if len(change.Details) > 0 {
+			d.addChange(change)
+		}
+	}
+	// anything left in the old FFI has been removed, reported in the order of the old FFI
+	for _, name := range oldOrder {
+		if oldByName[name] != nil {
+			d.addChange(&FFIChange{Change: FFIChangeRemoved, Element: elementType, Name: name, Breaking: true})
+		}
+	}
+	return nil
+}
+
+func (d *ffiDiffer) diffParams(change *FFIChange, prefix, paramType string, oldParams, newParams FFIParams) error {
+	if len(oldParams) != len(newParams) {
+		change.Details = append(change.Details, fmt.Sprintf("number of %ss changed from %d to %d", paramType, len(oldParams), len(newParams)))
+		change.Breaking = true
+	}
+	for i := 0; i < len(oldParams) && i < len(newParams); i++ {
+		oldParam, newParam := oldParams[i], newParams[i]
+		if oldParam.Name != newParam.Name {
+			change.Details = append(change.Details, fmt.Sprintf("%s %d renamed from '%s' to '%s'", paramType, i, oldParam.Name, newParam.Name))
+			change.Breaking = true
+		}
+		oldSchema, err := d.parseSchema(prefix, oldParam)
+		if err != nil {
+			return err
+		}
+		newSchema, err := d.parseSchema(prefix, newParam)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !reflect.DeepEqual(stripSchemaDescriptions(oldSchema, false), stripSchemaDescriptions(newSchema, false)):
+			change.Details = append(change.Details, fmt.Sprintf("%s '%s' schema changed", paramType, newParam.Name))
+			change.Breaking = true
+		case !reflect.DeepEqual(oldSchema, newSchema):
+			change.Details = append(change.Details, fmt.Sprintf("%s '%s' schema description changed", paramType, newParam.Name))
+		}
+	}
+	return nil
+}
+
+func (d *ffiDiffer) parseSchema(prefix string, p *FFIParam) (schema interface{}, err error) {
+	if p.Schema == nil || p.Schema.String() == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal(p.Schema.Bytes(), &schema); err != nil {
+		return nil, i18n.NewError(d.ctx, i18n.MsgFFIParamSchemaInvalid, p.Name, prefix, err)
+	}
+	return schema, nil
+}
+
+// normalizeJSONObject treats nil and empty as the same, and compares numbers by value
+func normalizeJSONObject(o JSONObject) interface{} {
+	if len(o) == 0 {
+		return nil
+	}
+	var normalized interface{}
+	b, _ := json.Marshal(o)
+	_ = json.Unmarshal(b, &normalized)
+	return normalized
+}
+
+// stripSchemaDescriptions returns a copy of a schema without the description keywords, which do not
+// affect what the schema accepts. Within a map of named schemas (such as properties) the keys are names,
+// so a property called "description" is retained.
+func stripSchemaDescriptions(schema interface{}, namedSchemas bool) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		stripped := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			switch {
+			case namedSchemas:
+				stripped[k] = stripSchemaDescriptions(val, false)
+			case k == "description":
+			case k == "properties" || k == "patternProperties" || k == "$defs" || k == "definitions":
+				stripped[k] = stripSchemaDescriptions(val, true)
+			default:
+				stripped[k] = stripSchemaDescriptions(val, false)
+			}
+		}
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, len(v))
+		for i, val := range v {
+			stripped[i] = stripSchemaDescriptions(val, false)
+		}
+		return stripped
+	default:
+		return v
+	}
+}
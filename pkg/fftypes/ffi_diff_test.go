@@ -0,0 +1,179 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDiffFFI(version string) *FFI {
+	return &FFI{
+		Name:    "token",
+		Version: version,
+		Methods: []*FFIMethod{
+			{
+				Name:        "transfer",
+				Description: "Transfer tokens",
+				Params: FFIParams{
+					{Name: "to", Schema: JSONAnyPtr(`{"type":"string","details":{"type":"address"}}`)},
+					{Name: "amount", Schema: JSONAnyPtr(`{"type":"integer","description":"The amount"}`)},
+				},
+				Returns: FFIParams{},
+				Details: JSONObject{"stateMutability": "nonpayable"},
+			},
+			{
+				Name:    "balanceOf",
+				Params:  FFIParams{{Name: "owner", Schema: JSONAnyPtr(`{"type":"string"}`)}},
+				Returns: FFIParams{{Name: "", Schema: JSONAnyPtr(`{"type":"integer"}`)}},
+			},
+		},
+		Events: []*FFIEvent{
+			{FFIEventDefinition: FFIEventDefinition{
+				Name:   "Transfer",
+				Params: FFIParams{{Name: "from", Schema: JSONAnyPtr(`{"type":"string"}`)}},
+			}},
+		},
+		Errors: []*FFIError{
+			{FFIErrorDefinition: FFIErrorDefinition{
+				Name:   "InsufficientBalance",
+				Params: FFIParams{{Name: "needed", Schema: JSONAnyPtr(`{"type":"integer"}`)}},
+			}},
+		},
+	}
+}
+
+func TestFFIDiffNoChanges(t *testing.T) {
+	report, err := FFIDiff(testDiffFFI("v1"), testDiffFFI("v2"))
+	assert.NoError(t, err)
+	assert.Equal(t, &FFIChangeReport{
+		OldVersion: "v1",
+		NewVersion: "v2",
+		Changes:    []*FFIChange{},
+	}, report)
+}
+
+func TestFFIDiffNonBreaking(t *testing.T) {
+	newFFI := testDiffFFI("v2")
+	newFFI.Methods[0].Description = "Transfer some tokens"
+	newFFI.Methods[0].Params[1].Schema = JSONAnyPtr(`{"description":"The amount to transfer","type":"integer"}`)
+	newFFI.Methods = append(newFFI.Methods, &FFIMethod{Name: "mint"})
+	newFFI.Events = append(newFFI.Events, &FFIEvent{FFIEventDefinition: FFIEventDefinition{Name: "Approval"}})
+	newFFI.Errors = append(newFFI.Errors, &FFIError{FFIErrorDefinition: FFIErrorDefinition{Name: "Paused"}})
+
+	report, err := FFIDiff(testDiffFFI("v1"), newFFI)
+	assert.NoError(t, err)
+	assert.False(t, report.Breaking)
+	assert.Equal(t, []*FFIChange{
+		{Change: FFIChangeChanged, Element: FFIElementMethod, Name: "transfer", Details: []string{
+			"description changed",
+			"param 'amount' schema description changed",
+		}},
+		{Change: FFIChangeAdded, Element: FFIElementMethod, Name: "mint"},
+		{Change: FFIChangeAdded, Element: FFIElementEvent, Name: "Approval"},
+		{Change: FFIChangeAdded, Element: FFIElementError, Name: "Paused"},
+	}, report.Changes)
+}
+
+func TestFFIDiffBreaking(t *testing.T) {
+	newFFI := testDiffFFI("v2")
+	newFFI.Methods[0].Params[0].Name = "recipient"
+	newFFI.Methods[0].Params[1].Schema = JSONAnyPtr(`{"type":"string"}`)
+	newFFI.Methods[0].Details = JSONObject{"stateMutability": "payable"}
+	newFFI.Methods[1].Returns = FFIParams{}
+	newFFI.Events[0].Params = append(newFFI.Events[0].Params, &FFIParam{Name: "to"})
+	newFFI.Errors = nil
+
+	report, err := FFIDiff(testDiffFFI("v1"), newFFI)
+	assert.NoError(t, err)
+	assert.True(t, report.Breaking)
+	assert.Equal(t, []*FFIChange{
+		{Change: FFIChangeChanged, Element: FFIElementMethod, Name: "transfer", Breaking: true, Details: []string{
+			"param 0 renamed from 'to' to 'recipient'",
+			"param 'amount' schema changed",
+			"details changed",
+		}},
+		{Change: FFIChangeChanged, Element: FFIElementMethod, Name: "balanceOf", Breaking: true, Details: []string{
+			"number of returns changed from 1 to 0",
+		}},
+		{Change: FFIChangeChanged, Element: FFIElementEvent, Name: "Transfer", Breaking: true, Details: []string{
+			"number of params changed from 1 to 2",
+		}},
+		{Change: FFIChangeRemoved, Element: FFIElementError, Name: "InsufficientBalance", Breaking: true},
+	}, report.Changes)
+
+	b, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"change":"removed","element":"error","name":"InsufficientBalance","breaking":true`)
+}
+
+func TestFFIDiffOverloads(t *testing.T) {
+	oldFFI := &FFI{Methods: []*FFIMethod{
+		{Name: "safeTransfer", Params: FFIParams{{Name: "to"}}},
+		{Name: "safeTransfer", Params: FFIParams{{Name: "to"}, {Name: "data"}}},
+	}}
+	newFFI := &FFI{Methods: []*FFIMethod{
+		{Name: "safeTransfer", Params: FFIParams{{Name: "to"}}},
+	}}
+	report, err := FFIDiff(oldFFI, newFFI)
+	assert.NoError(t, err)
+	assert.Equal(t, []*FFIChange{
+		{Change: FFIChangeRemoved, Element: FFIElementMethod, Name: "safeTransfer_2", Breaking: true},
+	}, report.Changes)
+}
+
+func TestFFIDiffPropertyNamedDescription(t *testing.T) {
+	oldFFI := &FFI{Methods: []*FFIMethod{{Name: "set", Params: FFIParams{
+		{Name: "item", Schema: JSONAnyPtr(`{"type":"object","properties":{"description":{"type":"string"}}}`)},
+	}}}}
+	newFFI := &FFI{Methods: []*FFIMethod{{Name: "set", Params: FFIParams{
+		{Name: "item", Schema: JSONAnyPtr(`{"type":"object","properties":{}}`)},
+	}}}}
+	report, err := FFIDiff(oldFFI, newFFI)
+	assert.NoError(t, err)
+	assert.True(t, report.Breaking)
+	assert.Equal(t, []string{"param 'item' schema changed"}, report.Changes[0].Details)
+}
+
+func TestFFIDiffErrors(t *testing.T) {
+	_, err := FFIDiff(nil, &FFI{})
+	assert.Regexp(t, "FF00286", err)
+
+	badFFI := &FFI{Methods: []*FFIMethod{{Name: "set", Params: FFIParams{{Name: "item", Schema: JSONAnyPtr(`{`)}}}}}
+	goodFFI := &FFI{Methods: []*FFIMethod{{Name: "set", Params: FFIParams{{Name: "item"}}}}}
+	_, err = FFIDiff(badFFI, goodFFI)
+	assert.Regexp(t, "FF00255.*methods.set.params", err)
+	_, err = FFIDiff(goodFFI, badFFI)
+	assert.Regexp(t, "FF00255", err)
+
+	badFFI = &FFI{Methods: []*FFIMethod{{Name: "get", Returns: FFIParams{{Name: "item", Schema: JSONAnyPtr(`{`)}}}}}
+	goodFFI = &FFI{Methods: []*FFIMethod{{Name: "get", Returns: FFIParams{{Name: "item"}}}}}
+	_, err = FFIDiff(goodFFI, badFFI)
+	assert.Regexp(t, "FF00255.*methods.get.returns", err)
+
+	badFFI = &FFI{Events: []*FFIEvent{{FFIEventDefinition: FFIEventDefinition{Name: "Changed", Params: FFIParams{{Name: "item", Schema: JSONAnyPtr(`{`)}}}}}}
+	goodFFI = &FFI{Events: []*FFIEvent{{FFIEventDefinition: FFIEventDefinition{Name: "Changed", Params: FFIParams{{Name: "item"}}}}}}
+	_, err = FFIDiff(goodFFI, badFFI)
+	assert.Regexp(t, "FF00255.*events.Changed.params", err)
+
+	badFFI = &FFI{Errors: []*FFIError{{FFIErrorDefinition: FFIErrorDefinition{Name: "Failed", Params: FFIParams{{Name: "item", Schema: JSONAnyPtr(`{`)}}}}}}
+	goodFFI = &FFI{Errors: []*FFIError{{FFIErrorDefinition: FFIErrorDefinition{Name: "Failed", Params: FFIParams{{Name: "item"}}}}}}
+	_, err = FFIDiff(goodFFI, badFFI)
+	assert.Regexp(t, "FF00255.*errors.Failed.params", err)
+}
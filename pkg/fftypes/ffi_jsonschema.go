@@ -0,0 +1,148 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+var jsonSchemaDefNameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// uniqueNames disambiguates names deterministically, in the order they are requested,
+// by appending a numeric suffix to the second and subsequent use of a name
+type uniqueNames map[string]bool
+
+func (u uniqueNames) next(name string) string {
+	unique := name
+	for i := 2; u[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	u[unique] = true
+	return unique
+}
+
+type ffiSchemaBuilder struct {
+	ctx  context.Context
+	defs map[string]interface{}
+	used uniqueNames
+}
+
+// addParams adds each parameter schema to the $defs, and returns an object schema referring to them
+func (sb *ffiSchemaBuilder) addParams(prefix string, params FFIParams) (map[string]interface{}, error) {
+	properties := make(map[string]interface{}, len(params))
+	required := make([]string, 0, len(params))
+	for _, p := range params {
+		var paramSchema interface{} = map[string]interface{}{}
+		if p.Schema != nil && p.Schema.String() != "" {
+			if err := json.Unmarshal(p.Schema.Bytes(), &paramSchema); err != nil {
+				return nil, i18n.NewError(sb.ctx, i18n.MsgFFIParamSchemaInvalid, p.Name, prefix, err)
+			}
+		}
+		defName := sb.used.next(jsonSchemaDefNameUnsafeChars.ReplaceAllString(fmt.Sprintf("%s.%s", prefix, p.Name), "_"))
+		sb.defs[defName] = paramSchema
+		properties[p.Name] = map[string]interface{}{"$ref": "#/$defs/" + defName}
+		required = append(required, p.Name)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, nil
+}
+
+// ExportJSONSchema builds a single self-contained JSON Schema document describing the params (and returns)
+// of every method, event and error in the interface. Each parameter schema is placed in the $defs section,
+// named by the method/event/error and parameter, with a numeric suffix added where names collide.
+func (f *FFI) ExportJSONSchema() (*JSONAny, error) {
+	ctx := context.Background()
+	v := &BaseFFIParamValidator{}
+	dialect := jsonschema.Draft2020.URL()
+	if metaSchema := v.GetMetaSchema(); metaSchema != nil && metaSchema.Draft != nil {
+		dialect = metaSchema.Draft.URL()
+	}
+	sb := &ffiSchemaBuilder{
+		ctx:  ctx,
+		defs: make(map[string]interface{}),
+		used: make(uniqueNames),
+	}
+
+	methodNames := make(uniqueNames)
+	methods := make(map[string]interface{}, len(f.Methods))
+	for _, m := range f.Methods {
+		name := methodNames.next(m.Name)
+		params, err := sb.addParams(fmt.Sprintf("methods.%s.params", name), m.Params)
+		if err != nil {
+			return nil, err
+		}
+		returns, err := sb.addParams(fmt.Sprintf("methods.%s.returns", name), m.Returns)
+		if err != nil {
+			return nil, err
+		}
+		methods[name] = map[string]interface{}{
+			"type":        "object",
+			"description": m.Description,
+			"properties": map[string]interface{}{
+				"params":  params,
+				"returns": returns,
+			},
+		}
+	}
+
+	eventNames := make(uniqueNames)
+	events := make(map[string]interface{}, len(f.Events))
+	for _, e := range f.Events {
+		name := eventNames.next(e.Name)
+		params, err := sb.addParams(fmt.Sprintf("events.%s.params", name), e.Params)
+		if err != nil {
+			return nil, err
+		}
+		params["description"] = e.Description
+		events[name] = params
+	}
+
+	errorNames := make(uniqueNames)
+	errors := make(map[string]interface{}, len(f.Errors))
+	for _, e := range f.Errors {
+		name := errorNames.next(e.Name)
+		params, err := sb.addParams(fmt.Sprintf("errors.%s.params", name), e.Params)
+		if err != nil {
+			return nil, err
+		}
+		params["description"] = e.Description
+		errors[name] = params
+	}
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"$schema":     dialect,
+		"title":       f.Name,
+		"description": f.Description,
+		"type":        "object",
+		"properties": map[string]interface{}{
+			"methods": map[string]interface{}{"type": "object", "properties": methods},
+			"events":  map[string]interface{}{"type": "object", "properties": events},
+			"errors":  map[string]interface{}{"type": "object", "properties": errors},
+		},
+		"$defs": sb.defs,
+	})
+	return JSONAnyPtrBytes(b), nil
+}
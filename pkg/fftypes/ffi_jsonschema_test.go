@@ -0,0 +1,109 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func testExportFFI() *FFI {
+	return &FFI{
+		Name:        "math",
+		Description: "Math operations",
+		Version:     "v1.0.0",
+		Methods: []*FFIMethod{
+			{
+				Name: "set",
+				Params: FFIParams{
+					{Name: "x", Schema: JSONAnyPtr(`{"type": "integer", "details": {"type": "uint256"}}`)},
+				},
+			},
+			{
+				// Overloaded method of the same name
+				Name: "set",
+				Params: FFIParams{
+					{Name: "x", Schema: JSONAnyPtr(`{"type": "string"}`)},
+					{Name: "any/thing"},
+				},
+				Returns: FFIParams{
+					{Name: "ok", Schema: JSONAnyPtr(`{"type": "boolean"}`)},
+				},
+			},
+		},
+		Events: []*FFIEvent{
+			{FFIEventDefinition: FFIEventDefinition{
+				Name: "Changed",
+				Params: FFIParams{
+					{Name: "x", Schema: JSONAnyPtr(`{"type": "integer"}`)},
+				},
+			}},
+		},
+		Errors: []*FFIError{
+			{FFIErrorDefinition: FFIErrorDefinition{
+				Name: "Overflow",
+				Params: FFIParams{
+					{Name: "x", Schema: JSONAnyPtr(`{"type": "integer"}`)},
+				},
+			}},
+		},
+	}
+}
+
+func TestFFIExportJSONSchema(t *testing.T) {
+	schema, err := testExportFFI().ExportJSONSchema()
+	assert.NoError(t, err)
+
+	jo := schema.JSONObject()
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", jo.GetString("$schema"))
+	defs := jo.GetObject("$defs")
+	assert.Equal(t, "integer", defs.GetObject("methods.set.params.x").GetString("type"))
+	assert.Equal(t, "string", defs.GetObject("methods.set_2.params.x").GetString("type"))
+	assert.Equal(t, JSONObject{}, defs.GetObject("methods.set_2.params.any_thing"))
+	assert.Equal(t, "boolean", defs.GetObject("methods.set_2.returns.ok").GetString("type"))
+	assert.Equal(t, "integer", defs.GetObject("events.Changed.params.x").GetString("type"))
+	assert.Equal(t, "integer", defs.GetObject("errors.Overflow.params.x").GetString("type"))
+
+	// Must be deterministic
+	schema2, err := testExportFFI().ExportJSONSchema()
+	assert.NoError(t, err)
+	assert.Equal(t, schema.String(), schema2.String())
+
+	// Must compile, and validate instances against the referenced param schemas
+	c := jsonschema.NewCompiler()
+	err = c.AddResource("ffi.json", strings.NewReader(schema.String()))
+	assert.NoError(t, err)
+	compiled, err := c.Compile("ffi.json")
+	assert.NoError(t, err)
+
+	var valid, invalid interface{}
+	_ = json.Unmarshal([]byte(`{"methods":{"set":{"params":{"x":1}},"set_2":{"params":{"x":"1","any/thing":[]}}}}`), &valid)
+	_ = json.Unmarshal([]byte(`{"methods":{"set":{"params":{"x":"1"}}}}`), &invalid)
+	assert.NoError(t, compiled.Validate(valid))
+	assert.Error(t, compiled.Validate(invalid))
+}
+
+func TestFFIExportJSONSchemaBadParam(t *testing.T) {
+	ffi := testExportFFI()
+	ffi.Errors[0].Params[0].Schema = JSONAnyPtr(`!json`)
+	_, err := ffi.ExportJSONSchema()
+	assert.Regexp(t, "FF00255.*errors.Overflow.params", err)
+}
@@ -0,0 +1,146 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// FFIParamNameMode selects how FFI.Validate checks the names of the params of methods, events and errors
+type FFIParamNameMode int
+
+const (
+	// FFIParamNamesUnchecked does not check param names, which is the default for compatibility
+	FFIParamNamesUnchecked FFIParamNameMode = iota
+	// FFIParamNamesStrict requires every param name to already be a valid identifier, without changing it
+	FFIParamNamesStrict
+	// FFIParamNamesNormalize trims the whitespace around param names in place, before validating them
+	FFIParamNamesNormalize
+	// FFIParamNamesNormalizeCase also canonicalizes the names to lowerCamelCase, such as "Amount" to "amount"
+	FFIParamNamesNormalizeCase
+)
+
+// Params can be unnamed, such as the return values of many methods, so an empty name is valid
+var ffiParamNameValidator = regexp.MustCompile(`^([a-zA-Z_$][a-zA-Z0-9_$]*)?$`)
+
+// ValidateParamName checks a param name is a valid identifier, as used in generated signatures and code:
+// a letter, '_' or '$', followed by any number of letters, digits, '_' or '$'
+func ValidateParamName(ctx context.Context, name string) error {
+	if !ffiParamNameValidator.MatchString(name) {
+		return i18n.NewError(ctx, i18n.MsgFFIInvalidParamName, name)
+	}
+	return nil
+}
+
+// NormalizeParamName trims the whitespace around a param name, optionally converts it to lowerCamelCase,
+// and validates the result - returning an error if it cannot be made into a valid identifier
+func NormalizeParamName(ctx context.Context, name string, canonicalCase bool) (string, error) {
+	normalized := strings.TrimSpace(name)
+	if canonicalCase {
+		normalized = lowerCamelCase(normalized)
+	}
+	if err := ValidateParamName(ctx, normalized); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// lowerCamelCase lower-cases the leading capitals of a name, other than the last one where it starts
+// the next word - so "Amount" is "amount", "ID" is "id", and "URLValue" is "urlValue"
+func lowerCamelCase(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper++
+	}
+	if upper > 1 && upper < len(runes) && unicode.IsLower(runes[upper]) {
+		upper--
+	}
+	for i := 0; i < upper; i++ {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// validateParamNames checks (and in the normalize modes updates) the names in a list of params,
+// which must also be unique within the list once normalized
+func (p FFIParams) validateParamNames(ctx context.Context, mode FFIParamNameMode, location string) error {
+	seen := make(map[string]bool, len(p))
+	for i, param := range p {
+		if param == nil {
+			continue
+		}
+		name := param.Name
+		var err error
+		if mode == FFIParamNamesStrict {
+			err = ValidateParamName(ctx, name)
+		} else {
+			name, err = NormalizeParamName(ctx, name, mode == FFIParamNamesNormalizeCase)
+		}
+		if err != nil {
+			return i18n.WrapError(ctx, err, i18n.MsgFFIParamInvalid, i, location)
+		}
+		if name != "" {
+			if seen[name] {
+				return i18n.NewError(ctx, i18n.MsgFFIDuplicateParamName, name, location)
+			}
+			seen[name] = true
+		}
+		param.Name = name
+	}
+	return nil
+}
+
+func (f *FFI) validateParamNames(ctx context.Context, mode FFIParamNameMode) error {
+	if mode == FFIParamNamesUnchecked {
+		return nil
+	}
+	for _, m := range f.Methods {
+		if m == nil {
+			continue
+		}
+		if err := m.Params.validateParamNames(ctx, mode, fmt.Sprintf("method '%s' params", m.Name)); err != nil {
+			return err
+		}
+		if err := m.Returns.validateParamNames(ctx, mode, fmt.Sprintf("method '%s' returns", m.Name)); err != nil {
+			return err
+		}
+	}
+	for _, e := range f.Events {
+		if e == nil {
+			continue
+		}
+		if err := e.Params.validateParamNames(ctx, mode, fmt.Sprintf("event '%s' params", e.Name)); err != nil {
+			return err
+		}
+	}
+	for _, e := range f.Errors {
+		if e == nil {
+			continue
+		}
+		if err := e.Params.validateParamNames(ctx, mode, fmt.Sprintf("error '%s' params", e.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeParamName(t *testing.T) {
+	ctx := context.Background()
+	for input, expected := range map[string][2]string{
+		// input: {trimmed, lowerCamelCase}
+		"amount":       {"amount", "amount"},
+		"  amount\t":   {"amount", "amount"},
+		"Amount":       {"Amount", "amount"},
+		"ID":           {"ID", "id"},
+		"URLValue":     {"URLValue", "urlValue"},
+		"ABC1":         {"ABC1", "abc1"},
+		"_value":       {"_value", "_value"},
+		"$ref":         {"$ref", "$ref"},
+		"tokenID":      {"tokenID", "tokenID"},
+		"":             {"", ""},
+		"   ":          {"", ""},
+		"x":            {"x", "x"},
+		"X":            {"X", "x"},
+		"from_address": {"from_address", "from_address"},
+	} {
+		name, err := NormalizeParamName(ctx, input, false)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected[0], name, input)
+		name, err = NormalizeParamName(ctx, input, true)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected[1], name, input)
+	}
+	for _, input := range []string{"1st", "to address", "a-b", "a.b", "naïve"} {
+		_, err := NormalizeParamName(ctx, input, true)
+		assert.Regexp(t, "FF00297", err, input)
+	}
+}
+
+func TestValidateParamName(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, ValidateParamName(ctx, "amount"))
+	assert.NoError(t, ValidateParamName(ctx, ""))
+	assert.Regexp(t, "FF00297", ValidateParamName(ctx, " amount"))
+}
+
+func newParamNamesTestFFI() *FFI {
+	return &FFI{
+		Name:    "math",
+		Version: "v1.0.0",
+		Methods: []*FFIMethod{
+			nil,
+			{
+				Name:    "sum",
+				Params:  FFIParams{{Name: " X "}, nil, {Name: "Y"}},
+				Returns: FFIParams{{Name: ""}, {Name: ""}},
+			},
+		},
+		Events: []*FFIEvent{nil, {FFIEventDefinition: FFIEventDefinition{
+			Name:   "Summed",
+			Params: FFIParams{{Name: "Result"}},
+		}}},
+		Errors: []*FFIError{nil, {FFIErrorDefinition: FFIErrorDefinition{
+			Name:   "Overflow",
+			Params: FFIParams{{Name: "LimitID"}},
+		}}},
+	}
+}
+
+func TestValidateFFIParamNameModes(t *testing.T) {
+	ctx := context.Background()
+
+	// Unchecked by default, and in the explicit mode
+	ffi := newParamNamesTestFFI()
+	assert.NoError(t, ffi.Validate(ctx))
+	assert.NoError(t, ffi.Validate(ctx, FFIParamNamesUnchecked))
+	assert.Equal(t, " X ", ffi.Methods[1].Params[0].Name)
+
+	// Strict does not change anything
+	err := ffi.Validate(ctx, FFIParamNamesStrict)
+	assert.Regexp(t, "FF00298.*0.*method 'sum' params.*FF00297", err)
+	assert.Equal(t, " X ", ffi.Methods[1].Params[0].Name)
+
+	ffi.Methods[1].Params[0].Name = "x"
+	assert.NoError(t, ffi.Validate(ctx, FFIParamNamesStrict))
+
+	// Normalize trims
+	ffi = newParamNamesTestFFI()
+	assert.NoError(t, ffi.Validate(ctx, FFIParamNamesNormalize))
+	assert.Equal(t, "X", ffi.Methods[1].Params[0].Name)
+	assert.Equal(t, "Y", ffi.Methods[1].Params[2].Name)
+	assert.Equal(t, "Result", ffi.Events[1].Params[0].Name)
+
+	// Normalize case also canonicalizes the casing
+	ffi = newParamNamesTestFFI()
+	assert.NoError(t, ffi.Validate(ctx, FFIParamNamesNormalizeCase))
+	assert.Equal(t, "x", ffi.Methods[1].Params[0].Name)
+	assert.Equal(t, "y", ffi.Methods[1].Params[2].Name)
+	assert.Equal(t, "", ffi.Methods[1].Returns[0].Name)
+	assert.Equal(t, "result", ffi.Events[1].Params[0].Name)
+	assert.Equal(t, "limitID", ffi.Errors[1].Params[0].Name)
+}
+
+func TestValidateFFIParamNameErrors(t *testing.T) {
+	ctx := context.Background()
+
+	ffi := newParamNamesTestFFI()
+	ffi.Methods[1].Params[2].Name = "x"
+	err := ffi.Validate(ctx, FFIParamNamesNormalizeCase)
+	assert.Regexp(t, "FF00299.*'x'.*method 'sum' params", err)
+
+	ffi = newParamNamesTestFFI()
+	ffi.Methods[1].Returns[1].Name = "bad name"
+	err = ffi.Validate(ctx, FFIParamNamesNormalize)
+	assert.Regexp(t, "FF00298.*1.*method 'sum' returns", err)
+
+	ffi = newParamNamesTestFFI()
+	ffi.Events[1].Params[0].Name = "1"
+	err = ffi.Validate(ctx, FFIParamNamesNormalize)
+	assert.Regexp(t, "FF00298.*event 'Summed' params", err)
+
+	ffi = newParamNamesTestFFI()
+	ffi.Errors[1].Params[0].Name = "-"
+	err = ffi.Validate(ctx, FFIParamNamesNormalize)
+	assert.Regexp(t, "FF00298.*error 'Overflow' params", err)
+
+	// The other names of the interface are checked first
+	ffi.Name = ""
+	err = ffi.Validate(ctx, FFIParamNamesNormalize)
+	assert.Regexp(t, "FF00140", err)
+}
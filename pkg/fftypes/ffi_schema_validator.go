@@ -0,0 +1,176 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// DefaultFFISchemaCacheSize is the number of compiled schemas kept by NewFFISchemaValidator
+const DefaultFFISchemaCacheSize = 100
+
+// FFISchemaValidator compiles parameter schemas with the extensions of a set of FFIParamValidators,
+// caching each compiled schema by the hash of its content so it is only compiled once.
+// The number of compiled schemas held in memory is bounded, with the least recently used evicted.
+type FFISchemaValidator struct {
+	validators  []FFIParamValidator
+	maxCompiled int
+	mux         sync.Mutex
+	compiled    map[Bytes32]*list.Element
+	lru         *list.List
+}
+
+// FFICompiledSchema is a schema compiled by an FFISchemaValidator, that can be used to validate many values
+type FFICompiledSchema struct {
+	hash   Bytes32
+	schema *jsonschema.Schema
+}
+
+// SchemaValidationError is a single failure of a value to match a schema, at a JSON pointer within the value
+type SchemaValidationError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaValidationErrors is returned when a value does not match a schema, with every failure found
+type SchemaValidationErrors []*SchemaValidationError
+
+func (sve SchemaValidationErrors) Error() string {
+	failures := make([]string, len(sve))
+	for i, e := range sve {
+		path := e.Path
+		if path == "" {
+			path = "/" // the root of the value
+		}
+		failures[i] = path + ": " + e.Message
+	}
+	return i18n.NewError(context.Background(), i18n.MsgSchemaValidationFailed, strings.Join(failures, "; ")).Error()
+}
+
+// NewFFISchemaValidator returns a validator that compiles with the extensions of the supplied
+// FFIParamValidators, or those of the BaseFFIParamValidator if none are supplied
+func NewFFISchemaValidator(validators ...FFIParamValidator) *FFISchemaValidator {
+	return NewFFISchemaValidatorWithCacheSize(DefaultFFISchemaCacheSize, validators...)
+}
+
+// NewFFISchemaValidatorWithCacheSize returns a validator that keeps up to maxCompiled compiled schemas
+func NewFFISchemaValidatorWithCacheSize(maxCompiled int, validators ...FFIParamValidator) *FFISchemaValidator {
+	if len(validators) == 0 {
+		validators = []FFIParamValidator{&BaseFFIParamValidator{}}
+	}
+	if maxCompiled <= 0 {
+		maxCompiled = 1
+	}
+	return &FFISchemaValidator{
+		validators:  validators,
+		maxCompiled: maxCompiled,
+		compiled:    make(map[Bytes32]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+// Compile returns the compiled schema, compiling it on first use
+func (sv *FFISchemaValidator) Compile(ctx context.Context, schema *JSONAny) (*FFICompiledSchema, error) {
+	if schema.IsNil() {
+		return nil, i18n.NewError(ctx, i18n.MsgSchemaCompileFailed, "empty schema")
+	}
+	hash := *schema.Hash()
+	if cs := sv.getCompiled(hash); cs != nil {
+		return cs, nil
+	}
+
+	// Compiled without holding the lock, so a slow schema does not hold up validation against others.
+	// Where the same schema is compiled concurrently, the first one cached is kept.
+	c := jsonschema.NewCompiler()
+	c.Draft = jsonschema.Draft2020
+	for _, v := range sv.validators {
+		c.RegisterExtension(v.GetExtensionName(), v.GetMetaSchema(), v)
+	}
+	const resourceName = "schema.json"
+	if err := c.AddResource(resourceName, strings.NewReader(schema.String())); err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgSchemaCompileFailed, err)
+	}
+	compiled, err := c.Compile(resourceName)
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgSchemaCompileFailed, err)
+	}
+	return sv.putCompiled(&FFICompiledSchema{hash: hash, schema: compiled}), nil
+}
+
+func (sv *FFISchemaValidator) getCompiled(hash Bytes32) *FFICompiledSchema {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	if e, ok := sv.compiled[hash]; ok {
+		sv.lru.MoveToFront(e)
+		return e.Value.(*FFICompiledSchema)
+	}
+	return nil
+}
+
+func (sv *FFISchemaValidator) putCompiled(cs *FFICompiledSchema) *FFICompiledSchema {
+	sv.mux.Lock()
+	defer sv.mux.Unlock()
+	if e, ok := sv.compiled[cs.hash]; ok {
+		sv.lru.MoveToFront(e)
+		return e.Value.(*FFICompiledSchema)
+	}
+	for sv.lru.Len() >= sv.maxCompiled {
+		oldest := sv.lru.Back()
+		sv.lru.Remove(oldest)
+		delete(sv.compiled, oldest.Value.(*FFICompiledSchema).hash)
+	}
+	sv.compiled[cs.hash] = sv.lru.PushFront(cs)
+	return cs
+}
+
+// Validate checks the value against the schema, returning SchemaValidationErrors listing every failure
+// if it does not match
+func (cs *FFICompiledSchema) Validate(value *JSONAny) error {
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(value.String()))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return SchemaValidationErrors{{Path: "", Message: err.Error()}}
+	}
+	err := cs.schema.Validate(v)
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+	var sve SchemaValidationErrors
+	collectValidationErrors(ve, &sve)
+	return sve
+}
+
+// collectValidationErrors flattens the tree of errors into the failures at its leaves
+func collectValidationErrors(ve *jsonschema.ValidationError, sve *SchemaValidationErrors) {
+	if len(ve.Causes) == 0 {
+		*sve = append(*sve, &SchemaValidationError{Path: ve.InstanceLocation, Message: ve.Message})
+		return
+	}
+	for _, cause := range ve.Causes {
+		collectValidationErrors(cause, sve)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFFISchemaValidator(t *testing.T) {
+	ctx := context.Background()
+	sv := NewFFISchemaValidator()
+
+	schema := JSONAnyPtr(`{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "details": {"type": "string"}},
+			"amount": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		},
+		"required": ["name"]
+	}`)
+	cs, err := sv.Compile(ctx, schema)
+	assert.NoError(t, err)
+
+	// The compiled schema is cached by its content
+	cs2, err := sv.Compile(ctx, JSONAnyPtr(schema.String()))
+	assert.NoError(t, err)
+	assert.Same(t, cs, cs2)
+
+	assert.NoError(t, cs.Validate(JSONAnyPtr(`{"name":"bob","amount":123456789012345678901234567890}`)))
+
+	// Every failure is reported with its location in the value
+	err = cs.Validate(JSONAnyPtr(`{"amount":-1,"tags":["a",2]}`))
+	var sve SchemaValidationErrors
+	assert.ErrorAs(t, err, &sve)
+	assert.Len(t, sve, 3)
+	paths := map[string]string{}
+	for _, e := range sve {
+		paths[e.Path] = e.Message
+	}
+	assert.Contains(t, paths, "")
+	assert.Contains(t, paths, "/amount")
+	assert.Contains(t, paths, "/tags/1")
+	assert.Regexp(t, "FF00316.*/: missing properties.*/amount: must be >= 0", err)
+	b, _ := json.Marshal(sve)
+	assert.Contains(t, string(b), `"path":"/tags/1"`)
+
+	err = cs.Validate(JSONAnyPtr(`!not json`))
+	assert.Regexp(t, "FF00316", err)
+}
+
+func TestFFISchemaValidatorCompileFail(t *testing.T) {
+	ctx := context.Background()
+	sv := NewFFISchemaValidator(&BaseFFIParamValidator{})
+
+	_, err := sv.Compile(ctx, nil)
+	assert.Regexp(t, "FF00315", err)
+	_, err = sv.Compile(ctx, JSONAnyPtr(`!not json`))
+	assert.Regexp(t, "FF00315", err)
+	_, err = sv.Compile(ctx, JSONAnyPtr(`{"type":"wrong"}`))
+	assert.Regexp(t, "FF00315", err)
+	assert.Empty(t, sv.compiled)
+}
+
+func TestFFISchemaValidatorEviction(t *testing.T) {
+	ctx := context.Background()
+	sv := NewFFISchemaValidatorWithCacheSize(0)
+	assert.Equal(t, 1, sv.maxCompiled)
+	sv = NewFFISchemaValidatorWithCacheSize(2)
+
+	cs1, err := sv.Compile(ctx, JSONAnyPtr(`{"type":"string"}`))
+	assert.NoError(t, err)
+	cs2, err := sv.Compile(ctx, JSONAnyPtr(`{"type":"integer"}`))
+	assert.NoError(t, err)
+	// Use the first, so the second is the least recently used
+	cs, err := sv.Compile(ctx, JSONAnyPtr(`{"type":"string"}`))
+	assert.NoError(t, err)
+	assert.Same(t, cs1, cs)
+	_, err = sv.Compile(ctx, JSONAnyPtr(`{"type":"boolean"}`))
+	assert.NoError(t, err)
+	assert.Len(t, sv.compiled, 2)
+
+	cs, err = sv.Compile(ctx, JSONAnyPtr(`{"type":"string"}`))
+	assert.NoError(t, err)
+	assert.Same(t, cs1, cs)
+	cs, err = sv.Compile(ctx, JSONAnyPtr(`{"type":"integer"}`))
+	assert.NoError(t, err)
+	assert.NotSame(t, cs2, cs)
+
+	// A schema compiled concurrently with the same one already cached is discarded
+	dup := &FFICompiledSchema{hash: cs.hash}
+	assert.Same(t, cs, sv.putCompiled(dup))
+}
@@ -162,3 +162,36 @@ func TestFFISetBroadCastMessage(t *testing.T) {
 	ffi.SetBroadcastMessage(msgID)
 	assert.Equal(t, ffi.Message, msgID)
 }
+
+func TestFFILookups(t *testing.T) {
+	ffi := &FFI{
+		Methods: []*FFIMethod{
+			nil,
+			{Name: "set", Pathname: "set"},
+			{Name: "get", Pathname: "get"},
+			{Name: "set", Pathname: "set_1"},
+		},
+		Events: []*FFIEvent{
+			nil,
+			{Signature: "Changed(uint256)", FFIEventDefinition: FFIEventDefinition{Name: "Changed"}},
+		},
+		Errors: []*FFIError{
+			nil,
+			{Signature: "Invalid(string)", FFIErrorDefinition: FFIErrorDefinition{Name: "Invalid"}},
+		},
+	}
+
+	l := NewFFILookup(ffi)
+	assert.Equal(t, "set", l.MethodByName("set").Pathname)
+	assert.Equal(t, "get", l.MethodByName("get").Pathname)
+	assert.Nil(t, l.MethodByName("missing"))
+	assert.Equal(t, "Changed", l.EventBySignature("Changed(uint256)").Name)
+	assert.Nil(t, l.EventBySignature("Changed"))
+	assert.Equal(t, "Invalid", l.ErrorBySignature("Invalid(string)").Name)
+	assert.Nil(t, l.ErrorBySignature("Invalid"))
+
+	// The lookup reflects the FFI when it was built
+	ffi.Methods = append(ffi.Methods, &FFIMethod{Name: "reset"})
+	assert.Nil(t, l.MethodByName("reset"))
+	assert.NotNil(t, NewFFILookup(ffi).MethodByName("reset"))
+}
@@ -0,0 +1,160 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/hex"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+// HexBytes is a variable length byte array, such as a signature, that is serialized as 0x prefixed hex
+// in JSON. The 0x prefix is optional on input. It is stored in the DB as raw bytes - see HexBytesText
+// for a type that is stored as hex text instead.
+type HexBytes []byte
+
+// HexBytesText is the same as HexBytes, except that it is stored in the DB as 0x prefixed hex text,
+// for columns that need to be readable, or compared with existing string values.
+type HexBytesText []byte
+
+// ParseHexBytes parses a hex string, with or without a 0x prefix, rejecting odd-length or non-hex input
+func ParseHexBytes(ctx context.Context, hexStr string) (HexBytes, error) {
+	b, err := hex.DecodeString(strings.TrimPrefix(hexStr, "0x"))
+	if err != nil {
+		return nil, i18n.WrapError(ctx, err, i18n.MsgInvalidHexBytes, hexStr, err)
+	}
+	return b, nil
+}
+
+func MustParseHexBytes(hexStr string) HexBytes {
+	b, err := ParseHexBytes(context.Background(), hexStr)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (hb HexBytes) String() string {
+	return "0x" + hex.EncodeToString(hb)
+}
+
+// ValidateLength checks the value is exactly the given number of bytes, such as 32 for a hash
+func (hb HexBytes) ValidateLength(ctx context.Context, length int) error {
+	if len(hb) != length {
+		return i18n.NewError(ctx, i18n.MsgInvalidHexBytesLength, length, length*2, len(hb))
+	}
+	return nil
+}
+
+func (hb HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hb.String()), nil
+}
+
+// MarshalJSON serializes nil as null, rather than an empty 0x string
+func (hb HexBytes) MarshalJSON() ([]byte, error) {
+	if hb == nil {
+		return []byte(NullString), nil
+	}
+	return []byte(`"` + hb.String() + `"`), nil
+}
+
+func (hb *HexBytes) UnmarshalText(b []byte) error {
+	parsed, err := ParseHexBytes(context.Background(), string(b))
+	if err != nil {
+		return err
+	}
+	*hb = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner, accepting raw bytes or hex text
+func (hb *HexBytes) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*hb = nil
+		return nil
+	case string:
+		return hb.UnmarshalText([]byte(src))
+	case []byte:
+		*hb = append(HexBytes{}, src...)
+		return nil
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, hb)
+	}
+}
+
+// Value implements sql.Valuer, storing the raw bytes
+func (hb HexBytes) Value() (driver.Value, error) {
+	if hb == nil {
+		return nil, nil
+	}
+	return []byte(hb), nil
+}
+
+func (hb HexBytes) Equals(hb2 HexBytes) bool {
+	return string(hb) == string(hb2)
+}
+
+func (ht HexBytesText) String() string {
+	return HexBytes(ht).String()
+}
+
+func (ht HexBytesText) ValidateLength(ctx context.Context, length int) error {
+	return HexBytes(ht).ValidateLength(ctx, length)
+}
+
+func (ht HexBytesText) MarshalText() ([]byte, error) {
+	return HexBytes(ht).MarshalText()
+}
+
+func (ht HexBytesText) MarshalJSON() ([]byte, error) {
+	return HexBytes(ht).MarshalJSON()
+}
+
+func (ht *HexBytesText) UnmarshalText(b []byte) error {
+	return (*HexBytes)(ht).UnmarshalText(b)
+}
+
+// Scan implements sql.Scanner, parsing the hex text (some drivers return text columns as bytes)
+func (ht *HexBytesText) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*ht = nil
+		return nil
+	case string:
+		return ht.UnmarshalText([]byte(src))
+	case []byte:
+		return ht.UnmarshalText(src)
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, ht)
+	}
+}
+
+// Value implements sql.Valuer, storing 0x prefixed hex text
+func (ht HexBytesText) Value() (driver.Value, error) {
+	if ht == nil {
+		return nil, nil
+	}
+	return ht.String(), nil
+}
+
+func (ht HexBytesText) Equals(ht2 HexBytesText) bool {
+	return string(ht) == string(ht2)
+}
@@ -0,0 +1,121 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHexBytesJSON(t *testing.T) {
+	type testStruct struct {
+		Prefixed HexBytes     `json:"prefixed"`
+		Bare     HexBytes     `json:"bare"`
+		Text     HexBytesText `json:"text"`
+		Missing  HexBytes     `json:"missing"`
+		Null     HexBytes     `json:"null"`
+		Empty    HexBytes     `json:"empty"`
+	}
+	var s testStruct
+	err := json.Unmarshal([]byte(`{"prefixed":"0xfeedBEEF","bare":"0102","text":"0xab","null":null,"empty":"0x"}`), &s)
+	assert.NoError(t, err)
+	assert.Equal(t, HexBytes{0xfe, 0xed, 0xbe, 0xef}, s.Prefixed)
+	assert.Equal(t, HexBytes{0x01, 0x02}, s.Bare)
+	assert.Equal(t, HexBytesText{0xab}, s.Text)
+	assert.Nil(t, s.Missing)
+	assert.Nil(t, s.Null)
+	assert.NotNil(t, s.Empty)
+	assert.Empty(t, s.Empty)
+
+	b, err := json.Marshal(&s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prefixed":"0xfeedbeef","bare":"0x0102","text":"0xab","missing":null,"null":null,"empty":"0x"}`, string(b))
+
+	err = json.Unmarshal([]byte(`{"prefixed":"0x123"}`), &s)
+	assert.Regexp(t, "FF00305.*odd length", err)
+	err = json.Unmarshal([]byte(`{"text":"0xzz"}`), &s)
+	assert.Regexp(t, "FF00305.*invalid byte", err)
+}
+
+func TestParseHexBytes(t *testing.T) {
+	ctx := context.Background()
+
+	hb, err := ParseHexBytes(ctx, "0x00ff")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x00ff", hb.String())
+	assert.NoError(t, hb.ValidateLength(ctx, 2))
+	assert.Regexp(t, "FF00306.*32 \\(64 hex characters\\) but was 2", hb.ValidateLength(ctx, 32))
+	assert.True(t, hb.Equals(MustParseHexBytes("00FF")))
+	assert.False(t, hb.Equals(nil))
+
+	_, err = ParseHexBytes(ctx, "0xf")
+	assert.Regexp(t, "FF00305", err)
+	assert.Panics(t, func() { MustParseHexBytes("wrong") })
+
+	ht := HexBytesText(hb)
+	assert.Equal(t, "0x00ff", ht.String())
+	assert.Regexp(t, "FF00306", ht.ValidateLength(ctx, 1))
+	assert.True(t, ht.Equals(HexBytesText{0x00, 0xff}))
+	text, err := ht.MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "0x00ff", string(text))
+}
+
+func TestHexBytesDB(t *testing.T) {
+	var hb HexBytes
+	v, err := hb.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	raw := []byte{0x01, 0x02}
+	assert.NoError(t, hb.Scan(raw))
+	raw[0] = 0xff // scanned bytes are copied, as the driver may reuse them
+	assert.Equal(t, HexBytes{0x01, 0x02}, hb)
+	v, err = hb.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, v)
+
+	assert.NoError(t, hb.Scan("0x0304"))
+	assert.Equal(t, HexBytes{0x03, 0x04}, hb)
+	assert.Regexp(t, "FF00305", hb.Scan("0x030"))
+	assert.NoError(t, hb.Scan(nil))
+	assert.Nil(t, hb)
+	assert.Regexp(t, "FF00105", hb.Scan(12345))
+}
+
+func TestHexBytesTextDB(t *testing.T) {
+	var ht HexBytesText
+	v, err := ht.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	assert.NoError(t, ht.Scan([]byte("0x0102")))
+	assert.Equal(t, HexBytesText{0x01, 0x02}, ht)
+	v, err = ht.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "0x0102", v)
+
+	assert.NoError(t, ht.Scan("0304"))
+	assert.Equal(t, HexBytesText{0x03, 0x04}, ht)
+	assert.Regexp(t, "FF00305", ht.Scan([]byte{0x01}))
+	assert.NoError(t, ht.Scan(nil))
+	assert.Nil(t, ht)
+	assert.Regexp(t, "FF00105", ht.Scan(12345))
+}
@@ -21,6 +21,7 @@ import (
 	"crypto/sha256"
 	"database/sql/driver"
 	"encoding/json"
+	"strings"
 
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
@@ -177,6 +178,37 @@ func (h *JSONAny) JSONObjectArray() JSONObjectArray {
 	return joa
 }
 
+// MergeInto returns a deep merge of this value over the base value, as described for JSONObject.MergeInto.
+// If either value is not an object, this value wins - unless it is nil or null, in which case the base is returned.
+// Numbers are preserved exactly, but the merged object has its keys in sorted order.
+func (h *JSONAny) MergeInto(base *JSONAny, concatArrays ...bool) *JSONAny {
+	if h.IsNil() {
+		return base
+	}
+	override, ok := h.jsonObjectPreserveNumbers()
+	if !ok {
+		return h
+	}
+	baseObj, ok := base.jsonObjectPreserveNumbers()
+	if !ok {
+		return h
+	}
+	return JSONAnyPtr(override.MergeInto(baseObj, concatArrays...).String())
+}
+
+func (h *JSONAny) jsonObjectPreserveNumbers() (JSONObject, bool) {
+	if h.IsNil() {
+		return nil, false
+	}
+	var jo JSONObject
+	d := json.NewDecoder(strings.NewReader(string(*h)))
+	d.UseNumber()
+	if err := d.Decode(&jo); err != nil || jo == nil {
+		return nil, false
+	}
+	return jo, true
+}
+
 // Value ensures we write null to the DB for null values
 func (h *JSONAny) Value() (driver.Value, error) {
 	if h.IsNil() {
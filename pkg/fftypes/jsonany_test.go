@@ -192,3 +192,21 @@ func TestASString(t *testing.T) {
 	nj := (*JSONAny)(nil)
 	assert.Equal(t, "null", nj.AsString())
 }
+
+func TestJSONAnyMergeInto(t *testing.T) {
+	base := JSONAnyPtr(`{"b":{"x":1,"y":[1,2]},"big":123456789012345678901234567890,"a":"base"}`)
+	override := JSONAnyPtr(`{"a":"override","b":{"y":[3],"z":null}}`)
+
+	assert.Equal(t, `{"a":"override","b":{"x":1,"y":[3],"z":null},"big":123456789012345678901234567890}`, override.MergeInto(base).String())
+	assert.Equal(t, `{"a":"override","b":{"x":1,"y":[1,2,3],"z":null},"big":123456789012345678901234567890}`, override.MergeInto(base, true).String())
+
+	// Null or missing overrides keep the base
+	assert.Equal(t, base, (*JSONAny)(nil).MergeInto(base))
+	assert.Equal(t, base, JSONAnyPtr("null").MergeInto(base))
+
+	// Values that are not objects are replaced
+	assert.Equal(t, `[1]`, JSONAnyPtr(`[1]`).MergeInto(base).String())
+	assert.Equal(t, `"str"`, JSONAnyPtr(`"str"`).MergeInto(base).String())
+	assert.Equal(t, override, override.MergeInto(JSONAnyPtr(`[1]`)))
+	assert.Equal(t, override, override.MergeInto(nil))
+}
@@ -76,6 +76,20 @@ func (jd JSONObject) GetInt64(key string) int64 {
 	return jd.GetInteger(key).Int64()
 }
 
+// GetInt64Ok returns the value as an int64, converting from a JSON number or numeric string.
+// Returns false if the value is missing, or cannot be represented as an int64
+func (jd JSONObject) GetInt64Ok(key string) (int64, bool) {
+	s, ok := jd.GetStringOk(key)
+	if !ok || s == "" {
+		return 0, false
+	}
+	i, ok := big.NewInt(0).SetString(s, 0)
+	if !ok || !i.IsInt64() {
+		return 0, false
+	}
+	return i.Int64(), true
+}
+
 func (jd JSONObject) GetBool(key string) bool {
 	vInterface := jd[key]
 	switch vt := vInterface.(type) {
@@ -88,6 +102,24 @@ func (jd JSONObject) GetBool(key string) bool {
 	}
 }
 
+// GetBoolOk returns the value as a bool, converting from the strings "true" and "false" (case insensitive).
+// Returns false if the value is missing, or is not a boolean
+func (jd JSONObject) GetBoolOk(key string) (bool, bool) {
+	vInterface := jd[key]
+	switch vt := vInterface.(type) {
+	case string:
+		switch {
+		case strings.EqualFold(vt, "true"):
+			return true, true
+		case strings.EqualFold(vt, "false"):
+			return false, true
+		}
+	case bool:
+		return vt, true
+	}
+	return false, false
+}
+
 func (jd JSONObject) GetStringOk(key string) (string, bool) {
 	vInterface := jd[key]
 	switch vt := vInterface.(type) {
@@ -209,6 +241,51 @@ func (jd JSONObject) GetStringArrayOk(key string) ([]string, bool) {
 	return []string{}, false // Ensures a non-nil return
 }
 
+// The Require functions return an error if the key is missing, or the value cannot be converted to the type
+
+func (jd JSONObject) requireError(ctx context.Context, key, typeName string) error {
+	v, ok := jd[key]
+	if !ok || v == nil {
+		return i18n.NewError(ctx, i18n.MsgJSONObjectMissingKey, key)
+	}
+	return i18n.NewError(ctx, i18n.MsgJSONObjectInvalidType, key, typeName, v)
+}
+
+func (jd JSONObject) RequireString(ctx context.Context, key string) (string, error) {
+	if s, ok := jd.GetStringOk(key); ok {
+		return s, nil
+	}
+	return "", jd.requireError(ctx, key, "string")
+}
+
+func (jd JSONObject) RequireInt64(ctx context.Context, key string) (int64, error) {
+	if i, ok := jd.GetInt64Ok(key); ok {
+		return i, nil
+	}
+	return 0, jd.requireError(ctx, key, "int64")
+}
+
+func (jd JSONObject) RequireBool(ctx context.Context, key string) (bool, error) {
+	if b, ok := jd.GetBoolOk(key); ok {
+		return b, nil
+	}
+	return false, jd.requireError(ctx, key, "bool")
+}
+
+func (jd JSONObject) RequireObject(ctx context.Context, key string) (JSONObject, error) {
+	if ob, ok := jd.GetObjectOk(key); ok {
+		return ob, nil
+	}
+	return nil, jd.requireError(ctx, key, "object")
+}
+
+func (jd JSONObject) RequireStringArray(ctx context.Context, key string) ([]string, error) {
+	if sa, ok := jd.GetStringArrayOk(key); ok {
+		return sa, nil
+	}
+	return nil, jd.requireError(ctx, key, "string array")
+}
+
 // Value implements sql.Valuer
 func (jd JSONObject) Value() (driver.Value, error) {
 	if jd == nil {
@@ -234,3 +311,84 @@ func (jd JSONObject) Hash(jsonDesc string) (*Bytes32, error) {
 	var b32 Bytes32 = sha256.Sum256(b)
 	return &b32, nil
 }
+
+// MergeInto returns a deep merge of this object over the base object, without modifying either.
+// Objects are merged recursively, and on any other conflict the value in this object wins -
+// including an explicit null. Arrays are replaced, unless concatArrays is true in which case
+// the arrays in this object are appended to those in the base.
+func (jd JSONObject) MergeInto(base JSONObject, concatArrays ...bool) JSONObject {
+	concat := len(concatArrays) > 0 && concatArrays[0]
+	merged := make(JSONObject, len(base)+len(jd))
+	for k, v := range base {
+		merged[k] = jsonDeepCopy(v)
+	}
+	for k, v := range jd {
+		merged[k] = jsonMergeValue(merged[k], v, concat)
+	}
+	return merged
+}
+
+func jsonMergeValue(base, override interface{}, concat bool) interface{} {
+	if baseObj, ok := toJSONObject(base); ok {
+		if overrideObj, ok := toJSONObject(override); ok {
+			return overrideObj.MergeInto(baseObj, concat)
+		}
+	}
+	if concat {
+		if baseArr, ok := toJSONArray(base); ok {
+			if overrideArr, ok := toJSONArray(override); ok {
+				merged := make([]interface{}, 0, len(baseArr)+len(overrideArr))
+				merged = append(merged, baseArr...) // base is already a copy
+				for _, v := range overrideArr {
+					merged = append(merged, jsonDeepCopy(v))
+				}
+				return merged
+			}
+		}
+	}
+	return jsonDeepCopy(override)
+}
+
+func toJSONObject(v interface{}) (JSONObject, bool) {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		return JSONObject(vt), true
+	case JSONObject:
+		return vt, vt != nil
+	default:
+		return nil, false
+	}
+}
+
+func toJSONArray(v interface{}) ([]interface{}, bool) {
+	switch vt := v.(type) {
+	case []interface{}:
+		return vt, true
+	case JSONObjectArray:
+		arr := make([]interface{}, len(vt))
+		for i, jo := range vt {
+			arr[i] = jo
+		}
+		return arr, true
+	default:
+		return nil, false
+	}
+}
+
+func jsonDeepCopy(v interface{}) interface{} {
+	if obj, ok := toJSONObject(v); ok {
+		cp := make(JSONObject, len(obj))
+		for k, cv := range obj {
+			cp[k] = jsonDeepCopy(cv)
+		}
+		return cp
+	}
+	if arr, ok := toJSONArray(v); ok {
+		cp := make([]interface{}, len(arr))
+		for i, cv := range arr {
+			cp[i] = jsonDeepCopy(cv)
+		}
+		return cp
+	}
+	return v
+}
@@ -17,6 +17,7 @@
 package fftypes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -109,6 +110,86 @@ func TestGetInt64NumberTypes(t *testing.T) {
 	assert.Equal(t, int64(123), numberVals.GetInt64("v9"))
 }
 
+func TestGetOkCoercion(t *testing.T) {
+	var jo JSONObject
+	err := json.Unmarshal([]byte(`{
+		"num": 12345,
+		"numStr": "0x10",
+		"float": 1.5,
+		"big": "18446744073709551616",
+		"boolStr": "FALSE",
+		"bool": true,
+		"notBool": "yes",
+		"null": null
+	}`), &jo)
+	assert.NoError(t, err)
+
+	i, ok := jo.GetInt64Ok("num")
+	assert.True(t, ok)
+	assert.Equal(t, int64(12345), i)
+	i, ok = jo.GetInt64Ok("numStr")
+	assert.True(t, ok)
+	assert.Equal(t, int64(16), i)
+	_, ok = jo.GetInt64Ok("float")
+	assert.False(t, ok)
+	_, ok = jo.GetInt64Ok("big")
+	assert.False(t, ok)
+	_, ok = jo.GetInt64Ok("missing")
+	assert.False(t, ok)
+
+	b, ok := jo.GetBoolOk("boolStr")
+	assert.True(t, ok)
+	assert.False(t, b)
+	b, ok = jo.GetBoolOk("bool")
+	assert.True(t, ok)
+	assert.True(t, b)
+	_, ok = jo.GetBoolOk("notBool")
+	assert.False(t, ok)
+	_, ok = jo.GetBoolOk("num")
+	assert.False(t, ok)
+}
+
+func TestRequire(t *testing.T) {
+	ctx := context.Background()
+	jo := JSONObject{
+		"str":  "value",
+		"num":  float64(42),
+		"bool": "true",
+		"obj":  map[string]interface{}{"a": "b"},
+		"arr":  []interface{}{"x", "y"},
+		"null": nil,
+	}
+
+	s, err := jo.RequireString(ctx, "num")
+	assert.NoError(t, err)
+	assert.Equal(t, "42", s)
+	i, err := jo.RequireInt64(ctx, "num")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), i)
+	b, err := jo.RequireBool(ctx, "bool")
+	assert.NoError(t, err)
+	assert.True(t, b)
+	ob, err := jo.RequireObject(ctx, "obj")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", ob.GetString("a"))
+	sa, err := jo.RequireStringArray(ctx, "arr")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "y"}, sa)
+
+	_, err = jo.RequireString(ctx, "null")
+	assert.Regexp(t, "FF00259.*null", err)
+	_, err = jo.RequireString(ctx, "obj")
+	assert.Regexp(t, "FF00260.*obj.*string", err)
+	_, err = jo.RequireInt64(ctx, "str")
+	assert.Regexp(t, "FF00260.*str.*int64", err)
+	_, err = jo.RequireBool(ctx, "missing")
+	assert.Regexp(t, "FF00259.*missing", err)
+	_, err = jo.RequireObject(ctx, "str")
+	assert.Regexp(t, "FF00260.*str.*object", err)
+	_, err = jo.RequireStringArray(ctx, "obj")
+	assert.Regexp(t, "FF00260.*obj.*string array", err)
+}
+
 func TestGetStringFloatNumberTypes(t *testing.T) {
 	var numberVals JSONObject = map[string]interface{}{
 		"v0": float32(123.4),
@@ -254,3 +335,57 @@ func TestJSONNestedSafeGet(t *testing.T) {
 	)
 
 }
+
+func TestJSONObjectMergeInto(t *testing.T) {
+	base := JSONObject{
+		"name":    "base",
+		"keep":    true,
+		"tags":    []interface{}{"a", "b"},
+		"removed": "value",
+		"nested": map[string]interface{}{
+			"level": 1,
+			"deep": JSONObject{
+				"x": "base-x",
+				"y": "base-y",
+			},
+			"items": JSONObjectArray{{"id": "1"}},
+		},
+		"replaced": map[string]interface{}{"a": 1},
+	}
+	override := JSONObject{
+		"name":    "override",
+		"tags":    []interface{}{"c"},
+		"removed": nil,
+		"nested": JSONObject{
+			"deep": map[string]interface{}{
+				"y": "override-y",
+				"z": "override-z",
+			},
+			"items": []interface{}{map[string]interface{}{"id": "2"}},
+		},
+		"replaced": "scalar",
+		"added":    12345,
+	}
+
+	merged := override.MergeInto(base)
+	assert.Equal(t, `{"added":12345,"keep":true,"name":"override","nested":{"deep":{"x":"base-x","y":"override-y","z":"override-z"},"items":[{"id":"2"}],"level":1},"removed":null,"replaced":"scalar","tags":["c"]}`, merged.String())
+
+	merged = override.MergeInto(base, true)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, merged["tags"])
+	assert.Equal(t, []interface{}{JSONObject{"id": "1"}, JSONObject{"id": "2"}}, merged.GetObject("nested")["items"])
+
+	// Neither input is modified, and the result does not share nested values with them
+	merged.GetObject("nested").GetObject("deep")["x"] = "changed"
+	merged["tags"].([]interface{})[0] = "changed"
+	assert.Equal(t, "base-x", base.GetObject("nested").GetObject("deep")["x"])
+	assert.Equal(t, []interface{}{"a", "b"}, base["tags"])
+	assert.Equal(t, []interface{}{"c"}, override["tags"])
+	assert.Nil(t, override.GetObject("nested").GetObject("deep")["x"])
+
+	// Nil handling
+	assert.Equal(t, JSONObject{}, JSONObject(nil).MergeInto(nil))
+	assert.Equal(t, `{"keep":true}`, JSONObject(nil).MergeInto(JSONObject{"keep": true}).String())
+	assert.Equal(t, `{"keep":true}`, JSONObject{"keep": true}.MergeInto(nil).String())
+	assert.Equal(t, `{"o":{"a":1}}`, JSONObject{"o": map[string]interface{}{"a": 1}}.MergeInto(JSONObject{"o": JSONObject(nil)}).String())
+	assert.Equal(t, `{"o":null}`, JSONObject{"o": nil}.MergeInto(JSONObject{"o": JSONObject{"a": 1}}).String())
+}
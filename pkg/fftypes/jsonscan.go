@@ -17,9 +17,11 @@
 package fftypes
 
 import (
+	"bytes"
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"strings"
 
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 )
@@ -43,3 +45,44 @@ func JSONValue(target interface{}) (driver.Value, error) {
 	}
 	return json.Marshal(target)
 }
+
+// JSONGenericDocument returns the generic document model (maps, slices and scalars) of the JSON of a value,
+// so it can be serialized in another encoding with the same structure (field names, custom marshaling etc.).
+// Numbers are int64 where they fit, or floating point otherwise. Integers too large for an int64
+// (such as uint256 values) are left as strings to avoid losing precision.
+func JSONGenericDocument(v interface{}) (interface{}, error) {
+	jsonBytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBytes))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return normalizeJSONNumbers(doc), nil
+}
+
+func normalizeJSONNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeJSONNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeJSONNumbers(e)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if !strings.ContainsAny(v.String(), ".eE") {
+			return v.String()
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
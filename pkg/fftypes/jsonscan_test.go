@@ -17,6 +17,7 @@
 package fftypes
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -65,3 +66,27 @@ func TestJSONValue(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, v)
 }
+
+func TestJSONGenericDocument(t *testing.T) {
+	type TS struct {
+		Val1 string `json:"val1"`
+	}
+	doc, err := JSONGenericDocument(map[string]interface{}{
+		"int":    json.Number("42"),
+		"float":  1.5,
+		"big":    json.Number("123456789012345678901234567890"),
+		"array":  []interface{}{json.Number("1"), "two"},
+		"object": &TS{Val1: "a"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"int":    int64(42),
+		"float":  1.5,
+		"big":    "123456789012345678901234567890",
+		"array":  []interface{}{int64(1), "two"},
+		"object": map[string]interface{}{"val1": "a"},
+	}, doc)
+
+	_, err = JSONGenericDocument(map[bool]bool{true: false})
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+)
+
+const maskedValue = "***"
+
+// MaskedString holds a secret such as a password or API key. It is rendered as "***" whenever
+// it is formatted or marshaled to JSON, so the value cannot leak into logs or API responses.
+// The real value is only available via Unmask(), and is stored and read by the DB Scan/Value
+// functions. As the JSON is masked, it must not be used in structures persisted as a JSON blob.
+type MaskedString string
+
+// Unmask returns the real value
+func (ms MaskedString) Unmask() string {
+	return string(ms)
+}
+
+func (ms MaskedString) String() string {
+	return maskedValue
+}
+
+func (ms MaskedString) GoString() string {
+	return maskedValue
+}
+
+// Format masks the value for every verb, including %v, %s, %q and %x
+func (ms MaskedString) Format(f fmt.State, _ rune) {
+	_, _ = f.Write([]byte(maskedValue))
+}
+
+func (ms MaskedString) MarshalJSON() ([]byte, error) {
+	return json.Marshal(maskedValue)
+}
+
+func (ms *MaskedString) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*ms = MaskedString(s)
+	return nil
+}
+
+// Scan implements sql.Scanner
+func (ms *MaskedString) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*ms = ""
+		return nil
+	case string:
+		*ms = MaskedString(src)
+		return nil
+	case []byte:
+		*ms = MaskedString(src)
+		return nil
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, ms)
+	}
+}
+
+// Value implements sql.Valuer
+func (ms MaskedString) Value() (driver.Value, error) {
+	return string(ms), nil
+}
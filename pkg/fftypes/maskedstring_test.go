@@ -0,0 +1,76 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fftypes
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type maskedTestStruct struct {
+	User     string        `json:"user"`
+	Password MaskedString  `json:"password"`
+	APIKey   *MaskedString `json:"apiKey,omitempty"`
+}
+
+func TestMaskedStringFormatting(t *testing.T) {
+	ms := MaskedString("s3cret")
+	assert.Equal(t, "s3cret", ms.Unmask())
+	assert.Equal(t, "***", ms.String())
+	for _, format := range []string{"%v", "%s", "%q", "%x", "%#v", "%+v", "%d"} {
+		assert.Equal(t, "***", fmt.Sprintf(format, ms), format)
+	}
+
+	s := &maskedTestStruct{User: "user1", Password: "s3cret", APIKey: &ms}
+	assert.Contains(t, fmt.Sprintf("%+v", *s), "Password:***")
+	assert.NotContains(t, fmt.Sprintf("%+v %#v %v", *s, *s, *s.APIKey), "s3cret")
+}
+
+func TestMaskedStringJSON(t *testing.T) {
+	var s maskedTestStruct
+	err := json.Unmarshal([]byte(`{"user":"user1","password":"s3cret","apiKey":"k3y"}`), &s)
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", s.Password.Unmask())
+	assert.Equal(t, "k3y", s.APIKey.Unmask())
+
+	b, err := json.Marshal(&s)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"user":"user1","password":"***","apiKey":"***"}`, string(b))
+
+	err = json.Unmarshal([]byte(`{"password":false}`), &s)
+	assert.Error(t, err)
+}
+
+func TestMaskedStringDB(t *testing.T) {
+	var ms MaskedString
+	assert.NoError(t, ms.Scan("s3cret"))
+	assert.Equal(t, "s3cret", ms.Unmask())
+	v, err := ms.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+
+	assert.NoError(t, ms.Scan([]byte("bytes")))
+	assert.Equal(t, "bytes", ms.Unmask())
+
+	assert.NoError(t, ms.Scan(nil))
+	assert.Equal(t, "", ms.Unmask())
+
+	assert.Regexp(t, "FF00105", ms.Scan(12345))
+}
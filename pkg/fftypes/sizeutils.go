@@ -1,4 +1,4 @@
-// Copyright © 2022 Kaleido, Inc.
+// Copyright © 2024 Kaleido, Inc.
 //
 // SPDX-License-Identifier: Apache-2.0
 //
@@ -18,8 +18,11 @@ package fftypes
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 
 	"github.com/docker/go-units"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 )
 
@@ -35,3 +38,82 @@ func ParseToByteSize(byteString string) int64 {
 	}
 	return bytes
 }
+
+// ByteSize is a number of bytes, serialized to JSON as a number.
+// It can be unmarshalled from a number, or a string.
+// - If it is a string in a human readable format such as "1Mb" or "512kb", that will be used
+// - If it is a string that can be parsed as an int64, that will be used in bytes
+// - If it is a number, that will be used in bytes
+type ByteSize int64
+
+// ParseByteSizeString parses a human readable byte size, returning an error if it is invalid
+func ParseByteSizeString(byteString string) (ByteSize, error) {
+	if byteString == "" {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(byteString)
+	if err != nil {
+		return 0, i18n.NewError(context.Background(), i18n.MsgByteSizeParseFail, byteString)
+	}
+	return ByteSize(bytes), nil
+}
+
+func (bs ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int64(bs))
+}
+
+func (bs *ByteSize) UnmarshalJSON(b []byte) error {
+	var stringVal string
+	err := json.Unmarshal(b, &stringVal)
+	if err != nil {
+		var intVal int64
+		err = json.Unmarshal(b, &intVal)
+		if err != nil {
+			return err
+		}
+		*bs = ByteSize(intVal)
+		return nil
+	}
+	size, err := ParseByteSizeString(stringVal)
+	if err != nil {
+		return err
+	}
+	*bs = size
+	return nil
+}
+
+// Scan implements sql.Scanner
+func (bs *ByteSize) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*bs = 0
+		return nil
+
+	case string:
+		size, err := ParseByteSizeString(src)
+		if err != nil {
+			return err
+		}
+		*bs = size
+		return nil
+
+	case []byte:
+		return bs.Scan(string(src))
+
+	case int:
+		*bs = ByteSize(src)
+		return nil
+
+	case int64:
+		*bs = ByteSize(src)
+		return nil
+
+	default:
+		return i18n.NewError(context.Background(), i18n.MsgTypeRestoreFailed, src, bs)
+	}
+}
+
+// Value implements sql.Valuer
+func (bs ByteSize) Value() (driver.Value, error) {
+	return int64(bs), nil
+}
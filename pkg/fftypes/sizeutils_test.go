@@ -17,6 +17,7 @@
 package fftypes
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,3 +28,55 @@ func TestByteSize(t *testing.T) {
 	assert.Equal(t, int64(0), ParseToByteSize("Wrong!"))
 	assert.Equal(t, int64(1024*1024), ParseToByteSize("1Mb"))
 }
+
+func TestByteSizeJSON(t *testing.T) {
+	var bs ByteSize
+	err := json.Unmarshal([]byte(`"1Mb"`), &bs)
+	assert.NoError(t, err)
+	assert.Equal(t, ByteSize(1024*1024), bs)
+
+	err = json.Unmarshal([]byte(`"2048"`), &bs)
+	assert.NoError(t, err)
+	assert.Equal(t, ByteSize(2048), bs)
+
+	err = json.Unmarshal([]byte(`4096`), &bs)
+	assert.NoError(t, err)
+	assert.Equal(t, ByteSize(4096), bs)
+
+	err = json.Unmarshal([]byte(`""`), &bs)
+	assert.NoError(t, err)
+	assert.Equal(t, ByteSize(0), bs)
+
+	err = json.Unmarshal([]byte(`"Wrong!"`), &bs)
+	assert.Regexp(t, "FF00256", err)
+
+	err = json.Unmarshal([]byte(`{}`), &bs)
+	assert.Error(t, err)
+
+	size := ByteSize(1024)
+	b, err := json.Marshal(struct {
+		Size *ByteSize `json:"size"`
+	}{Size: &size})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"size":1024}`, string(b))
+}
+
+func TestByteSizeDatabase(t *testing.T) {
+	var bs ByteSize
+	assert.NoError(t, bs.Scan(int64(100)))
+	assert.Equal(t, ByteSize(100), bs)
+	assert.NoError(t, bs.Scan(200))
+	assert.Equal(t, ByteSize(200), bs)
+	assert.NoError(t, bs.Scan("1kb"))
+	assert.Equal(t, ByteSize(1024), bs)
+	assert.NoError(t, bs.Scan([]byte("2kb")))
+	assert.Equal(t, ByteSize(2048), bs)
+	assert.NoError(t, bs.Scan(nil))
+	assert.Equal(t, ByteSize(0), bs)
+	assert.Regexp(t, "FF00256", bs.Scan("Wrong!"))
+	assert.Regexp(t, "FF00105", bs.Scan(false))
+
+	v, err := ByteSize(1024).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1024), v)
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/i18n"
@@ -187,6 +189,29 @@ func ParseDurationString(durationString string, def time.Duration) (FFDuration,
 	return FFDuration(duration), nil
 }
 
+// ParseDurationWithUnit parses either a duration string with units such as "1m30s", or a bare number in
+// the given unit - so "30" is 30 seconds for a unit of time.Second. Negative durations are rejected, as are
+// strings that mix the two forms such as "1m30", rather than guessing the unit of the unqualified part.
+func ParseDurationWithUnit(ctx context.Context, durationString string, unit time.Duration) (time.Duration, error) {
+	durationString = strings.TrimSpace(durationString)
+	if durationString == "" {
+		return 0, nil
+	}
+	var duration time.Duration
+	if number, err := strconv.ParseFloat(durationString, 64); err == nil {
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			return 0, i18n.NewError(ctx, i18n.MsgDurationInvalid, durationString, unit)
+		}
+		duration = time.Duration(number * float64(unit))
+	} else if duration, err = time.ParseDuration(durationString); err != nil {
+		return 0, i18n.NewError(ctx, i18n.MsgDurationInvalid, durationString, unit)
+	}
+	if duration < 0 {
+		return 0, i18n.NewError(ctx, i18n.MsgDurationNegative, durationString)
+	}
+	return duration, nil
+}
+
 func (fd *FFDuration) MarshalJSON() ([]byte, error) {
 	return json.Marshal(time.Duration(*fd).String())
 }
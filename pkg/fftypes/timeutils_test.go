@@ -17,6 +17,7 @@
 package fftypes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
@@ -272,6 +273,40 @@ func TestFFDurationParseValue(t *testing.T) {
 
 }
 
+func TestParseDurationWithUnit(t *testing.T) {
+	ctx := context.Background()
+	for input, expected := range map[string]time.Duration{
+		"":       0,
+		"30":     30 * time.Second,
+		" 30 ":   30 * time.Second,
+		"1.5":    1500 * time.Millisecond,
+		"30s":    30 * time.Second,
+		"1m30s":  90 * time.Second,
+		"250ms":  250 * time.Millisecond,
+		"0":      0,
+		"0s":     0,
+		"1e1":    10 * time.Second,
+		"0.0001": 100 * time.Microsecond,
+	} {
+		d, err := ParseDurationWithUnit(ctx, input, time.Second)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, d, input)
+	}
+	for input, code := range map[string]string{
+		"-30":      "FF00292",
+		"-1m":      "FF00292",
+		"1m30":     "FF00291",
+		"30 s":     "FF00291",
+		"NaN":      "FF00291",
+		"Inf":      "FF00291",
+		"thirty":   "FF00291",
+		"30s:more": "FF00291",
+	} {
+		_, err := ParseDurationWithUnit(ctx, input, time.Second)
+		assert.Regexp(t, code, err, input)
+	}
+}
+
 func TestDurationParsing(t *testing.T) {
 	assert.Zero(t, ParseToDuration("!a duration"))
 	assert.Zero(t, ParseToDuration(""))
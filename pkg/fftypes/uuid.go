@@ -29,6 +29,14 @@ import (
 // UUID is a wrapper on a UUID implementation, ensuring Value handles nil
 type UUID uuid.UUID
 
+// The name space IDs defined in RFC 4122, for use with NewDeterministicUUID
+var (
+	UUIDNamespaceDNS  = UUID(uuid.NameSpaceDNS)
+	UUIDNamespaceURL  = UUID(uuid.NameSpaceURL)
+	UUIDNamespaceOID  = UUID(uuid.NameSpaceOID)
+	UUIDNamespaceX500 = UUID(uuid.NameSpaceX500)
+)
+
 func NewNamespacedUUIDString(_ context.Context, namespace string, uuid *UUID) string {
 	return namespace + ":" + uuid.String()
 }
@@ -66,6 +74,14 @@ func NewUUID() *UUID {
 	return &u
 }
 
+// NewDeterministicUUID returns the version 5 (SHA-1 name based) UUID of the name within the namespace,
+// so the same name always results in the same ID - such as when re-importing the same definition.
+// The namespace is any UUID chosen to scope the names, such as one of the RFC 4122 name spaces.
+func NewDeterministicUUID(namespace UUID, name string) *UUID {
+	u := UUID(uuid.NewSHA1(uuid.UUID(namespace), []byte(name)))
+	return &u
+}
+
 func (u *UUID) String() string {
 	if u == nil {
 		return ""
@@ -26,6 +26,20 @@ func TestNewUUID(t *testing.T) {
 	assert.NotNil(t, NewUUID())
 }
 
+func TestNewDeterministicUUID(t *testing.T) {
+	// Test vectors, matching other RFC 4122 implementations
+	assert.Equal(t, "886313e1-3b8a-5372-9b90-0c9aee199e5d", NewDeterministicUUID(UUIDNamespaceDNS, "python.org").String())
+	assert.Equal(t, "2ed6657d-e927-568b-95e1-2665a8aea6a2", NewDeterministicUUID(UUIDNamespaceDNS, "www.example.com").String())
+	assert.Equal(t, "fcde3c85-2270-590f-9e7c-ee003d65e0e2", NewDeterministicUUID(UUIDNamespaceURL, "http://www.example.com/").String())
+
+	ns := *NewUUID()
+	u1 := NewDeterministicUUID(ns, "ns1/ffi1/v1.0.0")
+	assert.Equal(t, u1, NewDeterministicUUID(ns, "ns1/ffi1/v1.0.0"))
+	assert.NotEqual(t, u1, NewDeterministicUUID(ns, "ns1/ffi1/v1.0.1"))
+	assert.NotEqual(t, u1, NewDeterministicUUID(*NewUUID(), "ns1/ffi1/v1.0.0"))
+	assert.Equal(t, "5", u1.String()[14:15]) // version 5
+}
+
 func TestDatabaseSerialization(t *testing.T) {
 
 	var u *UUID
@@ -0,0 +1,67 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// ClientCertPrincipal returns the identity of a client certificate for use as a principal.
+// This is the subject DN, or the first subject alternative name if the subject is empty.
+func ClientCertPrincipal(cert *x509.Certificate) string {
+	if subject := cert.Subject.String(); subject != "" {
+		return subject
+	}
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.IPAddresses) > 0:
+		return cert.IPAddresses[0].String()
+	}
+	return ""
+}
+
+// WrapClientCertPrincipalIfEnabled sets the principal on the request context (see auth.GetPrincipal) from the
+// verified client certificate, when TLS client auth is enabled. The principal is also added to the log context.
+// It is absent for requests without a verified certificate, and can be replaced by an auth plugin that sets its own.
+func WrapClientCertPrincipalIfEnabled(ctx context.Context, tlsConf config.Section, chain http.Handler) http.Handler {
+	if !tlsConf.GetBool(fftls.HTTPConfTLSEnabled) || !tlsConf.GetBool(fftls.HTTPConfTLSClientAuth) {
+		return chain
+	}
+	log.L(ctx).Debugf("Client certificate principals enabled")
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.VerifiedChains[0]) > 0 {
+			if principal := ClientCertPrincipal(req.TLS.VerifiedChains[0][0]); principal != "" {
+				reqCtx := context.WithValue(req.Context(), auth.CtxPrincipalKey{}, principal)
+				reqCtx = log.WithLogField(reqCtx, "principal", principal)
+				req = req.WithContext(reqCtx)
+			}
+		}
+		chain.ServeHTTP(res, req)
+	})
+}
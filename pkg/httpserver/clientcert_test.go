@@ -0,0 +1,90 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/auth"
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientCertTestHandler(t *testing.T, enabled, clientAuth bool) (http.Handler, *string) {
+	config.RootConfigReset()
+	section := config.RootSection("http")
+	InitHTTPConfig(section, 0)
+	tlsSection := section.SubSection("tls")
+	tlsSection.Set(fftls.HTTPConfTLSEnabled, enabled)
+	tlsSection.Set(fftls.HTTPConfTLSClientAuth, clientAuth)
+	var seen string
+	return WrapClientCertPrincipalIfEnabled(context.Background(), tlsSection, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		seen = auth.GetPrincipal(req.Context())
+	})), &seen
+}
+
+func requestWithClientCert(cert *x509.Certificate) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	if cert != nil {
+		req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return req
+}
+
+func TestClientCertPrincipal(t *testing.T) {
+	handler, seen := newClientCertTestHandler(t, true, true)
+	handler.ServeHTTP(httptest.NewRecorder(), requestWithClientCert(&x509.Certificate{
+		Subject:  pkix.Name{CommonName: "client1", Organization: []string{"org1"}},
+		DNSNames: []string{"client1.example.com"},
+	}))
+	assert.Equal(t, "CN=client1,O=org1", *seen)
+
+	// No certificate presented
+	handler.ServeHTTP(httptest.NewRecorder(), requestWithClientCert(nil))
+	assert.Empty(t, *seen)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, *seen)
+}
+
+func TestClientCertPrincipalDisabled(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		handler, seen := newClientCertTestHandler(t, enabled, !enabled)
+		handler.ServeHTTP(httptest.NewRecorder(), requestWithClientCert(&x509.Certificate{
+			Subject: pkix.Name{CommonName: "client1"},
+		}))
+		assert.Empty(t, *seen)
+	}
+}
+
+func TestClientCertPrincipalSAN(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.com/client1")
+	assert.Equal(t, "client1.example.com", ClientCertPrincipal(&x509.Certificate{DNSNames: []string{"client1.example.com"}}))
+	assert.Equal(t, "client1@example.com", ClientCertPrincipal(&x509.Certificate{EmailAddresses: []string{"client1@example.com"}}))
+	assert.Equal(t, "spiffe://example.com/client1", ClientCertPrincipal(&x509.Certificate{URIs: []*url.URL{spiffe}}))
+	assert.Equal(t, "127.0.0.1", ClientCertPrincipal(&x509.Certificate{IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}}))
+	assert.Empty(t, ClientCertPrincipal(&x509.Certificate{}))
+}
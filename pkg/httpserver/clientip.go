@@ -0,0 +1,174 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// CtxClientIPKey is the context key for the IP address of the client that made the request
+type CtxClientIPKey struct{}
+
+// WithClientIP returns a context containing the client IP
+func WithClientIP(ctx context.Context, clientIP string) context.Context {
+	return context.WithValue(ctx, CtxClientIPKey{}, clientIP)
+}
+
+// GetClientIP returns the client IP from the context, or an empty string if there is none
+func GetClientIP(ctx context.Context) string {
+	clientIP, _ := ctx.Value(CtxClientIPKey{}).(string)
+	return clientIP
+}
+
+// TrustedProxies is a set of networks whose peers are trusted to report the client IP
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a list of CIDRs, or single IP addresses
+func ParseTrustedProxies(ctx context.Context, proxies []string) (TrustedProxies, error) {
+	tp := make(TrustedProxies, 0, len(proxies))
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			switch ip := net.ParseIP(p); {
+			case ip == nil:
+			case ip.To4() != nil:
+				p += "/32"
+			default:
+				p += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, i18n.NewError(ctx, i18n.MsgInvalidTrustedProxy, p)
+		}
+		tp = append(tp, ipNet)
+	}
+	return tp, nil
+}
+
+func (tp TrustedProxies) trusted(ip net.IP) bool {
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the IP of the client that made a request. The header reported by a proxy is only used
+// when the direct peer is trusted, and is walked from right to left (the order in which the proxies appended
+// to it) skipping trusted hops, so that an untrusted party cannot spoof the IP. Only the named header is used,
+// which is either "Forwarded" or a comma separated list of IPs such as X-Forwarded-For - as the proxies pass
+// any other header through from the client unchanged.
+func (tp TrustedProxies) ClientIP(req *http.Request, header string) string {
+	peer := parseHopIP(req.RemoteAddr)
+	if peer == nil {
+		return req.RemoteAddr
+	}
+	if !tp.trusted(peer) {
+		return peer.String()
+	}
+	var hops []string
+	if strings.EqualFold(header, "Forwarded") {
+		hops = forwardedHops(req.Header.Values("Forwarded"))
+	} else {
+		hops = xForwardedForHops(req.Header.Values(header))
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseHopIP(hops[i])
+		if ip == nil {
+			// the hop cannot be identified, so the last proxy we trust is the best we know
+			break
+		}
+		client = ip
+		if !tp.trusted(ip) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func xForwardedForHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+func forwardedHops(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			// an element without a "for" parameter is still a hop, that cannot be identified
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(k, "for") {
+					hop = strings.Trim(v, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseHopIP parses an IP address, with an optional port, where IPv6 addresses with a port are in brackets.
+// Obfuscated identifiers and "unknown" (as allowed in a Forwarded header) return nil.
+func parseHopIP(hop string) net.IP {
+	hop = strings.TrimSpace(hop)
+	if ip := net.ParseIP(hop); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+}
+
+// WrapClientIP stores the IP of the client that made each request on the context (see GetClientIP).
+// When trusted proxies are configured, the IP is resolved from the header they report it in, and added to the logger.
+// Otherwise it is the address of the peer.
+func WrapClientIP(ctx context.Context, conf config.Section, chain http.Handler) (http.Handler, error) {
+	tp, err := ParseTrustedProxies(ctx, conf.GetStringSlice(HTTPConfTrustedProxies))
+	if err != nil {
+		return nil, err
+	}
+	header := conf.GetString(HTTPConfTrustedProxyHeader)
+	if len(tp) > 0 {
+		log.L(ctx).Debugf("Client IPs resolved through %s of trusted proxies %v", header, conf.GetStringSlice(HTTPConfTrustedProxies))
+	}
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		clientIP := tp.ClientIP(req, header)
+		reqCtx := WithClientIP(req.Context(), clientIP)
+		if len(tp) > 0 {
+			reqCtx = log.WithLogField(reqCtx, "client", clientIP)
+		}
+		chain.ServeHTTP(res, req.WithContext(reqCtx))
+	}), nil
+}
@@ -0,0 +1,133 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientIPTestHandler(t *testing.T, trustedProxies []string, header ...string) (http.Handler, *string) {
+	config.RootConfigReset()
+	section := config.RootSection("http")
+	InitHTTPConfig(section, 0)
+	section.Set(HTTPConfTrustedProxies, trustedProxies)
+	if len(header) > 0 {
+		section.Set(HTTPConfTrustedProxyHeader, header[0])
+	}
+	var seen string
+	handler, err := WrapClientIP(context.Background(), section, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		seen = GetClientIP(req.Context())
+	}))
+	assert.NoError(t, err)
+	return handler, &seen
+}
+
+func clientIPTestRequest(handler http.Handler, seen *string, remoteAddr string, headers map[string][]string) string {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return *seen
+}
+
+func TestClientIPNoTrustedProxies(t *testing.T) {
+	handler, seen := newClientIPTestHandler(t, nil)
+	assert.Equal(t, "10.0.0.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"X-Forwarded-For": {"192.0.2.1"},
+	}))
+	assert.Equal(t, "::1", clientIPTestRequest(handler, seen, "[::1]:1234", nil))
+	assert.Equal(t, "bad-addr", clientIPTestRequest(handler, seen, "bad-addr", nil))
+}
+
+func TestClientIPUntrustedPeerCannotSpoof(t *testing.T) {
+	handler, seen := newClientIPTestHandler(t, []string{"10.0.0.0/8"})
+	assert.Equal(t, "192.0.2.9", clientIPTestRequest(handler, seen, "192.0.2.9:1234", map[string][]string{
+		"X-Forwarded-For": {"192.0.2.1"},
+		"Forwarded":       {"for=192.0.2.1"},
+	}))
+}
+
+func TestClientIPXForwardedFor(t *testing.T) {
+	handler, seen := newClientIPTestHandler(t, []string{"10.0.0.0/8", "172.16.0.1"})
+	// the left-most entries are supplied by the client, so cannot be trusted
+	assert.Equal(t, "192.0.2.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"X-Forwarded-For": {"198.51.100.1, 192.0.2.1", "172.16.0.1, 10.0.0.2"},
+	}))
+	// all hops trusted
+	assert.Equal(t, "10.0.0.3", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"},
+	}))
+	// stops at an invalid hop
+	assert.Equal(t, "10.0.0.2", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"X-Forwarded-For": {"192.0.2.1, garbage, 10.0.0.2"},
+	}))
+	// no header
+	assert.Equal(t, "10.0.0.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", nil))
+	// a Forwarded header is passed through from the client by a proxy that sets X-Forwarded-For, so is ignored
+	assert.Equal(t, "192.0.2.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"Forwarded":       {"for=198.51.100.1"},
+		"X-Forwarded-For": {"192.0.2.1"},
+	}))
+}
+
+func TestClientIPCustomHeader(t *testing.T) {
+	handler, seen := newClientIPTestHandler(t, []string{"10.0.0.0/8"}, "X-Real-IP")
+	assert.Equal(t, "192.0.2.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"X-Real-Ip":       {"192.0.2.1"},
+		"X-Forwarded-For": {"198.51.100.1"},
+	}))
+}
+
+func TestClientIPForwarded(t *testing.T) {
+	handler, seen := newClientIPTestHandler(t, []string{"10.0.0.0/8", "2001:db8::/32"}, "Forwarded")
+	// the X-Forwarded-For header is passed through from the client by a proxy that sets Forwarded, so is ignored
+	assert.Equal(t, "2001:db9::17", clientIPTestRequest(handler, seen, "[2001:db8::1]:443", map[string][]string{
+		"Forwarded":       {`for="[2001:db9::17]:4711";proto=https, for=10.0.0.2;by=10.0.0.1`},
+		"X-Forwarded-For": {"192.0.2.1"},
+	}))
+	assert.Equal(t, "192.0.2.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"Forwarded": {"For=192.0.2.1:80"},
+	}))
+	assert.Equal(t, "10.0.0.2", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"Forwarded": {"for=192.0.2.1, for=unknown, for=10.0.0.2"},
+	}))
+	assert.Equal(t, "10.0.0.1", clientIPTestRequest(handler, seen, "10.0.0.1:1234", map[string][]string{
+		"Forwarded": {"proto=https"},
+	}))
+}
+
+func TestClientIPBadTrustedProxy(t *testing.T) {
+	config.RootConfigReset()
+	section := config.RootSection("http")
+	InitHTTPConfig(section, 0)
+	section.Set(HTTPConfTrustedProxies, []string{"10.0.0.0/8", "not-an-ip"})
+	_, err := WrapClientIP(context.Background(), section, http.NotFoundHandler())
+	assert.Regexp(t, "FF00287.*not-an-ip", err)
+}
+
+func TestGetClientIPUnset(t *testing.T) {
+	assert.Empty(t, GetClientIP(context.Background()))
+	assert.Equal(t, "10.0.0.1", GetClientIP(WithClientIP(context.Background(), "10.0.0.1")))
+}
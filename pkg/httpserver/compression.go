@@ -0,0 +1,237 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"compress/gzip"
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+type ctxCompressionKey struct{}
+
+var gzipWriters = sync.Pool{
+	New: func() interface{} { return gzip.NewWriter(nil) },
+}
+
+type compressor struct {
+	minSize      int
+	contentTypes []string
+}
+
+// WrapCompressionIfEnabled gzips responses for clients that accept it, where the content type is in the
+// configured list and the body reaches the minimum size. The body is buffered up to the minimum size
+// before deciding, so responses that are flushed before reaching it (such as streams) are sent as-is.
+// Server-sent events and WebSocket upgrades are never compressed.
+func WrapCompressionIfEnabled(ctx context.Context, conf config.Section, chain http.Handler) http.Handler {
+	if !conf.GetBool(HTTPConfCompressionEnabled) {
+		return chain
+	}
+	c := &compressor{
+		minSize:      int(conf.GetByteSize(HTTPConfCompressionMinSize)),
+		contentTypes: conf.GetStringSlice(HTTPConfCompressionContentTypes),
+	}
+	log.L(ctx).Debugf("Response compression enabled minSize=%d contentTypes=%v", c.minSize, c.contentTypes)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "" {
+			chain.ServeHTTP(res, req)
+			return
+		}
+		cw := &compressingWriter{
+			ResponseWriter: res,
+			c:              c,
+			accepted:       req.Method != http.MethodHead && acceptsGzip(req.Header.Get("Accept-Encoding")),
+		}
+		defer cw.close()
+		chain.ServeHTTP(cw, req.WithContext(context.WithValue(req.Context(), ctxCompressionKey{}, cw)))
+	})
+}
+
+// DisableCompression stops the response to the request with the given context being compressed,
+// such as for a route that streams its output. It must be called before the response is written.
+func DisableCompression(ctx context.Context) {
+	if cw, ok := ctx.Value(ctxCompressionKey{}).(*compressingWriter); ok {
+		cw.disabled = true
+	}
+}
+
+// acceptsGzip checks whether gzip is acceptable to the client, directly or via a wildcard, with a non-zero quality
+func acceptsGzip(acceptEncoding string) bool {
+	gzipQ, wildcardQ := -1.0, -1.0
+	for _, entry := range strings.Split(acceptEncoding, ",") {
+		parts := strings.Split(entry, ";")
+		q := 1.0
+		for _, param := range parts[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case "gzip":
+			gzipQ = q
+		case "*":
+			wildcardQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return wildcardQ > 0
+}
+
+func (c *compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	for _, ct := range c.contentTypes {
+		ct = strings.ToLower(ct)
+		if prefix, ok := strings.CutSuffix(ct, "*"); ok {
+			if strings.HasPrefix(mediaType, prefix) {
+				return true
+			}
+		} else if mediaType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+// compressingWriter holds back the headers and the start of the body, until it knows enough
+// to decide whether to compress the response
+type compressingWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	accepted bool
+	disabled bool
+	status   int
+	decided  bool
+	buf      []byte
+	gz       *gzip.Writer
+}
+
+func (cw *compressingWriter) WriteHeader(status int) {
+	if status < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(status) // informational responses are passed straight through
+		return
+	}
+	if cw.status != 0 {
+		return
+	}
+	cw.status = status
+	// Where we already know the response will not be compressed, there is no need to buffer it
+	contentType := cw.Header().Get("Content-Type")
+	if cw.disabled || !cw.allowsBody() || cw.Header().Get("Content-Encoding") != "" ||
+		(contentType != "" && !cw.c.compressible(contentType)) {
+		cw.decide()
+	}
+}
+
+func (cw *compressingWriter) allowsBody() bool {
+	return cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+}
+
+func (cw *compressingWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.c.minSize {
+			return len(b), nil
+		}
+		return len(b), cw.decide()
+	}
+	if cw.gz != nil {
+		return cw.gz.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// decide writes the headers, compressing the response if it is eligible, then writes anything buffered
+func (cw *compressingWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" && len(cw.buf) > 0 {
+		contentType = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", contentType)
+	}
+	eligible := !cw.disabled && cw.allowsBody() && h.Get("Content-Encoding") == "" && cw.c.compressible(contentType)
+	if eligible && !strings.Contains(strings.Join(h.Values("Vary"), ","), "Accept-Encoding") {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if eligible && cw.accepted && len(cw.buf) >= cw.c.minSize {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		cw.gz = gzipWriters.Get().(*gzip.Writer)
+		cw.gz.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.gz != nil {
+		_, err = cw.gz.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what has been written so far, so a response flushed before the minimum size is not compressed
+func (cw *compressingWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		_ = cw.decide()
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the other features of the writer, such as write deadlines
+func (cw *compressingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressingWriter) close() {
+	if !cw.decided && cw.status != 0 {
+		_ = cw.decide()
+	}
+	if cw.gz != nil {
+		_ = cw.gz.Close()
+		cw.gz.Reset(nil)
+		gzipWriters.Put(cw.gz)
+		cw.gz = nil
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCompressionTestHandler(enabled bool, handler http.HandlerFunc) http.Handler {
+	config.RootConfigReset()
+	section := config.RootSection("http")
+	InitHTTPConfig(section, 0)
+	section.Set(HTTPConfCompressionEnabled, enabled)
+	section.Set(HTTPConfCompressionMinSize, "16")
+	return WrapCompressionIfEnabled(context.Background(), section, handler)
+}
+
+func compressionTestRequest(handler http.Handler, method, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func gunzip(t *testing.T, res *httptest.ResponseRecorder) string {
+	gz, err := gzip.NewReader(res.Body)
+	assert.NoError(t, err)
+	b, err := io.ReadAll(gz)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestCompressionDisabled(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	handler := newCompressionTestHandler(false, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte(body))
+	})
+	res := compressionTestRequest(handler, http.MethodGet, "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Empty(t, res.Header().Get("Vary"))
+	assert.Equal(t, body, res.Body.String())
+}
+
+func TestCompressionGzip(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("a", 100) + `"}`
+	handler := newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json; charset=utf-8")
+		res.Header().Set("Content-Length", "110")
+		res.WriteHeader(http.StatusCreated)
+		// written in pieces smaller than the minimum size
+		for i := 0; i < len(body); i += 10 {
+			_, _ = res.Write([]byte(body[i:min(i+10, len(body))]))
+		}
+	})
+	res := compressionTestRequest(handler, http.MethodGet, "deflate, gzip;q=0.5")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	assert.Empty(t, res.Header().Get("Content-Length"))
+	assert.Equal(t, body, gunzip(t, res))
+
+	// The pooled writer is reused
+	res = compressionTestRequest(handler, http.MethodGet, "*")
+	assert.Equal(t, body, gunzip(t, res))
+}
+
+func TestCompressionNotAccepted(t *testing.T) {
+	body := strings.Repeat("a", 100)
+	handler := newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(body)) // sniffed as text/plain
+	})
+	for _, acceptEncoding := range []string{"", "deflate", "gzip;q=0", "*;q=0", "gzip;q=0, *"} {
+		res := compressionTestRequest(handler, http.MethodGet, acceptEncoding)
+		assert.Empty(t, res.Header().Get("Content-Encoding"), acceptEncoding)
+		assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+		assert.Equal(t, body, res.Body.String())
+	}
+	res := compressionTestRequest(handler, http.MethodHead, "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+}
+
+func TestCompressionNotEligible(t *testing.T) {
+	largeBody := strings.Repeat("a", 100)
+	for name, h := range map[string]http.HandlerFunc{
+		"content type": func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "image/png")
+			_, _ = res.Write([]byte(largeBody))
+		},
+		"bad content type": func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", ";;")
+			_, _ = res.Write([]byte(largeBody))
+		},
+		"already encoded": func(res http.ResponseWriter, req *http.Request) {
+			res.Header().Set("Content-Type", "text/plain")
+			res.Header().Set("Content-Encoding", "br")
+			_, _ = res.Write([]byte(largeBody))
+		},
+		"disabled": func(res http.ResponseWriter, req *http.Request) {
+			DisableCompression(req.Context())
+			res.Header().Set("Content-Type", "text/plain")
+			_, _ = res.Write([]byte(largeBody))
+		},
+	} {
+		res := compressionTestRequest(newCompressionTestHandler(true, h), http.MethodGet, "gzip")
+		assert.Empty(t, res.Header().Get("Vary"), name)
+		assert.NotEqual(t, "gzip", res.Header().Get("Content-Encoding"), name)
+	}
+
+	// Small responses of a compressible type might be compressed if they were larger, so still vary
+	res := compressionTestRequest(newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		_, _ = res.Write([]byte("{}"))
+	}), http.MethodGet, "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	assert.Equal(t, "{}", res.Body.String())
+
+	res = compressionTestRequest(newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusNoContent)
+	}), http.MethodGet, "gzip")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+
+	res = compressionTestRequest(newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {}), http.MethodGet, "gzip")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Body.String())
+}
+
+func TestCompressionStreaming(t *testing.T) {
+	handler := newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.WriteHeader(http.StatusEarlyHints)
+		_, _ = res.Write([]byte("data: 1\n\n"))
+		assert.NoError(t, http.NewResponseController(res).Flush())
+		_, _ = res.Write([]byte(strings.Repeat("data: 2\n\n", 10)))
+	})
+	res := compressionTestRequest(handler, http.MethodGet, "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Empty(t, res.Header().Get("Vary"))
+	assert.True(t, res.Flushed)
+	assert.True(t, strings.HasPrefix(res.Body.String(), "data: 1\n\n"))
+
+	// A compressible stream flushed before the minimum size is sent uncompressed
+	handler = newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain")
+		_, _ = res.Write([]byte("line1\n"))
+		res.(http.Flusher).Flush()
+		_, _ = res.Write([]byte(strings.Repeat("line2\n", 10)))
+	})
+	res = compressionTestRequest(handler, http.MethodGet, "gzip")
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", res.Header().Get("Vary"))
+	assert.Equal(t, "line1\n"+strings.Repeat("line2\n", 10), res.Body.String())
+
+	// Once compressing, a flush sends what has been compressed so far
+	handler = newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Content-Type", "text/plain")
+		_, _ = res.Write([]byte(strings.Repeat("line1\n", 10)))
+		res.(http.Flusher).Flush()
+		_, _ = res.Write([]byte("line2\n"))
+	})
+	res = compressionTestRequest(handler, http.MethodGet, "gzip")
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("line1\n", 10)+"line2\n", gunzip(t, res))
+}
+
+func TestCompressionSkipsUpgrade(t *testing.T) {
+	handler := newCompressionTestHandler(true, func(res http.ResponseWriter, req *http.Request) {
+		_, ok := res.(*compressingWriter)
+		assert.False(t, ok)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Upgrade", "websocket")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -18,6 +18,7 @@ package httpserver
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/auth/authfactory"
 	"github.com/hyperledger/firefly-common/pkg/config"
@@ -60,14 +61,42 @@ const (
 	HTTPConfPublicURL = "publicURL"
 	// HTTPConfPort the local port to listen on for HTTP/Websocket connections
 	HTTPConfPort = "port"
-	// HTTPConfReadTimeout the write timeout for the HTTP server
+	// HTTPConfReadTimeout the read timeout for the HTTP server
 	HTTPConfReadTimeout = "readTimeout"
+	// HTTPConfReadHeaderTimeout the time allowed to read the request line and headers, before the read timeout applies to the body
+	HTTPConfReadHeaderTimeout = "readHeaderTimeout"
 	// HTTPConfWriteTimeout the write timeout for the HTTP server
 	HTTPConfWriteTimeout = "writeTimeout"
+	// HTTPConfIdleTimeout the time a keep-alive connection is held open waiting for the next request
+	HTTPConfIdleTimeout = "idleTimeout"
 	// HTTPConfShutdownTimeout The maximum amount of time to wait for any open HTTP requests to finish before shutting down the HTTP server
 	HTTPConfShutdownTimeout = "shutdownTimeout"
 	// HTTPAuthType the auth plugin to use for the HTTP server
 	HTTPAuthType = "auth.type"
+	// HTTPConfRequestIDEnabled whether to assign an ID to each request, that is added to logs and returned in the response
+	HTTPConfRequestIDEnabled = "requestID.enabled"
+	// HTTPConfRequestIDHeader the header an inbound request ID is read from, and the response header it is returned in
+	HTTPConfRequestIDHeader = "requestID.header"
+	// HTTPConfMaxHeaderBytes the maximum total size of the request line and headers of a request, above which the server responds 431 (zero for the Go default of 1MB)
+	HTTPConfMaxHeaderBytes = "maxHeaderBytes"
+	// HTTPConfMaxHeaderCount the maximum number of header values on a request, above which the server responds 431 (zero for no limit)
+	HTTPConfMaxHeaderCount = "maxHeaderCount"
+	// HTTPConfMaxConcurrentRequests the maximum number of requests processed concurrently, above which requests queue then are rejected 503 (zero for no limit)
+	HTTPConfMaxConcurrentRequests = "maxConcurrentRequests"
+	// HTTPConfQueueTimeout how long a request waits for a slot when the maximum concurrent requests are being processed
+	HTTPConfQueueTimeout = "queueTimeout"
+	// HTTPConfConcurrencyExemptPaths path prefixes (such as health checks), matched on a path segment boundary, that are not subject to the maximum concurrent requests
+	HTTPConfConcurrencyExemptPaths = "concurrencyExemptPaths"
+	// HTTPConfTrustedProxies the CIDRs (or IPs) of proxies trusted to report the client IP in X-Forwarded-For or Forwarded headers
+	HTTPConfTrustedProxies = "trustedProxies"
+	// HTTPConfTrustedProxyHeader the header the trusted proxies report the client IP in - "Forwarded", or a comma separated list such as X-Forwarded-For
+	HTTPConfTrustedProxyHeader = "trustedProxyHeader"
+	// HTTPConfCompressionEnabled whether to gzip responses for clients that accept it
+	HTTPConfCompressionEnabled = "compression.enabled"
+	// HTTPConfCompressionMinSize the minimum size of a response body to compress
+	HTTPConfCompressionMinSize = "compression.minSize"
+	// HTTPConfCompressionContentTypes the content types to compress, where a trailing * matches any suffix
+	HTTPConfCompressionContentTypes = "compression.contentTypes"
 )
 
 func InitHTTPConfig(conf config.Section, defaultPort int) {
@@ -75,9 +104,27 @@ func InitHTTPConfig(conf config.Section, defaultPort int) {
 	conf.AddKnownKey(HTTPConfPublicURL)
 	conf.AddKnownKey(HTTPConfPort, defaultPort)
 	conf.AddKnownKey(HTTPConfReadTimeout, "15s")
+	conf.AddKnownKey(HTTPConfReadHeaderTimeout, "5s")
 	conf.AddKnownKey(HTTPConfWriteTimeout, "15s")
+	conf.AddKnownKey(HTTPConfIdleTimeout, "60s")
 	conf.AddKnownKey(HTTPConfShutdownTimeout, "10s")
 	conf.AddKnownKey(HTTPAuthType)
+	conf.AddKnownKey(HTTPConfRequestIDEnabled, false)
+	conf.AddKnownKey(HTTPConfRequestIDHeader, DefaultRequestIDHeader)
+	conf.AddKnownKey(HTTPConfMaxHeaderBytes, 0)
+	conf.AddKnownKey(HTTPConfMaxHeaderCount, 0)
+	conf.AddKnownKey(HTTPConfTrustedProxies)
+	conf.AddKnownKey(HTTPConfTrustedProxyHeader, "X-Forwarded-For")
+	conf.AddKnownKey(HTTPConfMaxConcurrentRequests, 0)
+	conf.AddKnownKey(HTTPConfQueueTimeout, "1s")
+	conf.AddKnownKey(HTTPConfConcurrencyExemptPaths)
+	conf.AddKnownKey(HTTPConfCompressionEnabled, false)
+	conf.AddKnownKey(HTTPConfCompressionMinSize, "1Kb")
+	conf.AddKnownKey(HTTPConfCompressionContentTypes, []string{"application/json", "application/x-yaml", "text/*"})
+	// A bare number is seconds for the timeouts, such as "shutdownTimeout: 30"
+	for _, key := range []string{HTTPConfReadTimeout, HTTPConfReadHeaderTimeout, HTTPConfWriteTimeout, HTTPConfIdleTimeout, HTTPConfShutdownTimeout, HTTPConfQueueTimeout} {
+		conf.SetDurationUnit(key, time.Second)
+	}
 
 	ac := conf.SubSection("auth")
 	authfactory.InitConfig(ac)
@@ -18,14 +18,17 @@ package httpserver
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 )
 
@@ -61,3 +64,31 @@ func RunDebugServer(ctx context.Context, debugServerConf config.Section, capture
 		_ = debugServer.Close()
 	}
 }
+
+// mountDebugHandlers adds the pprof and expvar handlers to the router of a server under the debug path,
+// which must not already be served by one of its routes
+func mountDebugHandlers(ctx context.Context, name string, r *mux.Router, debugPath string) error {
+	prefix := strings.TrimSuffix(debugPath, "/")
+	if !strings.HasPrefix(prefix, "/") {
+		return i18n.NewError(ctx, i18n.MsgDebugPathConflict, debugPath, name)
+	}
+	for _, path := range []string{prefix + "/pprof/", prefix + "/vars"} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
+		var match mux.RouteMatch
+		if r.Match(req, &match) && match.MatchErr == nil {
+			return i18n.NewError(ctx, i18n.MsgDebugPathConflict, debugPath, name)
+		}
+	}
+	log.L(ctx).Warnf("Debug endpoints enabled on server %s under %s", name, prefix)
+	r.HandleFunc(prefix+"/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc(prefix+"/pprof/profile", pprof.Profile)
+	r.HandleFunc(prefix+"/pprof/symbol", pprof.Symbol)
+	r.HandleFunc(prefix+"/pprof/trace", pprof.Trace)
+	// pprof.Index only serves named profiles under /debug/pprof/, so they are routed here for other paths
+	r.HandleFunc(prefix+"/pprof/{profile}", func(res http.ResponseWriter, req *http.Request) {
+		pprof.Handler(mux.Vars(req)["profile"]).ServeHTTP(res, req)
+	})
+	r.HandleFunc(prefix+"/pprof/", pprof.Index)
+	r.Handle(prefix+"/vars", expvar.Handler())
+	return nil
+}
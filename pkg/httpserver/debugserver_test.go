@@ -21,10 +21,13 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"strings"
 	"testing"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/firefly-common/pkg/auth/basic"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/stretchr/testify/assert"
 )
@@ -99,3 +102,62 @@ func TestDebugServerBadConfig(t *testing.T) {
 	<-done
 
 }
+
+func newDebugEndpointsTestServer(t *testing.T, authType string, r *mux.Router, debugPath string) (HTTPServer, error) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cp.Set(HTTPAuthType, authType)
+	cp.SubSection("auth").SubSection("basic").Set(basic.PasswordFile, "../../test/data/test_users")
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	return NewHTTPServer(context.Background(), "ut", r, make(chan error), cp, cc, &ServerOptions{DebugPath: debugPath})
+}
+
+func TestDebugEndpointsRequireAuth(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/api/test", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+	})
+	hs, err := newDebugEndpointsTestServer(t, "basic", r, "/debug/")
+	assert.NoError(t, err)
+	go hs.ServeHTTP(context.Background())
+
+	url := fmt.Sprintf("http://%s", hs.Addr())
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/pprof/cmdline", "/debug/vars"} {
+		res, err := resty.New().R().Get(url + path)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, res.StatusCode(), path)
+		assert.Regexp(t, "FF00169", res.String())
+	}
+
+	res, err := resty.New().R().SetBasicAuth("firefly", "awesome").Get(url + "/debug/pprof/goroutine?debug=2")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Regexp(t, "TestDebugEndpointsRequireAuth", res.String())
+
+	res, err = resty.New().R().SetBasicAuth("firefly", "awesome").Get(url + "/debug/vars")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Regexp(t, "memstats", res.String())
+
+	res, err = resty.New().R().SetBasicAuth("firefly", "awesome").Get(url + "/debug/pprof/")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode())
+	assert.Regexp(t, "goroutine", res.String())
+}
+
+func TestDebugEndpointsNoAuth(t *testing.T) {
+	_, err := newDebugEndpointsTestServer(t, "", mux.NewRouter(), "/debug")
+	assert.Regexp(t, "FF00308", err)
+}
+
+func TestDebugEndpointsPathConflict(t *testing.T) {
+	_, err := newDebugEndpointsTestServer(t, "basic", mux.NewRouter(), "debug")
+	assert.Regexp(t, "FF00309", err)
+
+	r := mux.NewRouter()
+	r.PathPrefix("/").HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+	_, err = newDebugEndpointsTestServer(t, "basic", r, "/debug")
+	assert.Regexp(t, "FF00309", err)
+}
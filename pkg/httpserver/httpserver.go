@@ -18,9 +18,12 @@ package httpserver
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -34,6 +37,9 @@ import (
 type HTTPServer interface {
 	ServeHTTP(ctx context.Context)
 	Addr() net.Addr
+	// RouterHandler is the router of the server wrapped in its auth plugin (if any), for requests that are
+	// dispatched in-process and must be authorized exactly as if they had been received over HTTP
+	RouterHandler() http.Handler
 }
 
 type GoHTTPServer interface {
@@ -50,43 +56,81 @@ type httpServer struct {
 	conf            config.Section
 	corsConf        config.Section
 	options         ServerOptions
+	routerHandler   http.Handler
 	onClose         chan error
 	tlsEnabled      bool
 	tlsCertFile     string
 	tlsKeyFile      string
 	shutdownTimeout time.Duration
+	draining        atomic.Bool
 }
 
 // ServerOptions are config parameters that are not set from the config, but rather the context
 // in which the HTTP server is being used
 type ServerOptions struct {
 	MaximumRequestTimeout time.Duration
+	// DrainPeriod is how long to keep the listener open once shutdown starts, responding 503 with
+	// "Connection: close" to new requests while in-flight ones finish. This gives load balancers
+	// time to deregister the server. Zero (the default) shuts down immediately
+	DrainPeriod time.Duration
+	// MaxHeaderBytes overrides the maxHeaderBytes config when non-zero. Go's server allows some slack
+	// for buffering above this limit before responding 431, and the limit does not include the body
+	MaxHeaderBytes int
+	// MaxHeaderCount overrides the maxHeaderCount config when non-zero
+	MaxHeaderCount int
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout override the config of the
+	// same name when non-zero. The read and write timeouts are still extended beyond any
+	// MaximumRequestTimeout, and the read header timeout is limited to the read timeout
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// DebugPath mounts the net/http/pprof handlers under DebugPath/pprof/, and the expvar handler at
+	// DebugPath/vars, on the router of the server when set (such as "/debug"). These expose the internals
+	// of the process, so the server fails to start if no auth plugin is configured to protect them, or if
+	// the path is served by another route. Empty (the default) does not mount them
+	DebugPath string
+	// ListenerWrapper is called with the TCP listener before the server starts, and the listener it returns
+	// is served in its place - beneath TLS when enabled. This allows PROXY protocol support, by returning a
+	// listener that reads the PROXY header of each connection and reports the original client as the
+	// RemoteAddr of the connection, which is then used for logging and rate limiting. Nil (the default)
+	// serves the TCP listener directly
+	ListenerWrapper func(net.Listener) net.Listener
 }
 
 func NewHTTPServer(ctx context.Context, name string, r *mux.Router, onClose chan error, conf config.Section, corsConf config.Section, opts ...*ServerOptions) (is HTTPServer, err error) {
 	tlsSubSection := conf.SubSection("tls")
 
 	hs := &httpServer{
-		name:            name,
-		onClose:         onClose,
-		conf:            conf,
-		corsConf:        corsConf,
-		tlsEnabled:      tlsSubSection.GetBool(fftls.HTTPConfTLSEnabled),
-		tlsCertFile:     tlsSubSection.GetString(fftls.HTTPConfTLSCertFile),
-		tlsKeyFile:      tlsSubSection.GetString(fftls.HTTPConfTLSKeyFile),
-		shutdownTimeout: conf.GetDuration(HTTPConfShutdownTimeout),
+		name:        name,
+		onClose:     onClose,
+		conf:        conf,
+		corsConf:    corsConf,
+		tlsEnabled:  tlsSubSection.GetBool(fftls.HTTPConfTLSEnabled),
+		tlsCertFile: tlsSubSection.GetString(fftls.HTTPConfTLSCertFile),
+		tlsKeyFile:  tlsSubSection.GetString(fftls.HTTPConfTLSKeyFile),
+	}
+	if hs.shutdownTimeout, err = conf.ParseDuration(HTTPConfShutdownTimeout); err != nil {
+		return nil, err
 	}
 
 	for _, o := range opts {
 		hs.options = *o
 	}
 	hs.l, err = createListener(ctx, hs.name, hs.conf)
+	if err == nil && hs.options.ListenerWrapper != nil {
+		hs.l = hs.options.ListenerWrapper(hs.l)
+	}
 	if err == nil {
 		hs.s, err = hs.createServer(ctx, r)
 	}
 	return hs, err
 }
 
+func (hs *httpServer) RouterHandler() http.Handler {
+	return hs.routerHandler
+}
+
 func (hs *httpServer) Addr() net.Addr {
 	return hs.l.Addr()
 }
@@ -109,30 +153,77 @@ func (hs *httpServer) createServer(ctx context.Context, r *mux.Router) (srv *htt
 
 	authConfig := hs.conf.SubSection("auth")
 	authPluginName := hs.conf.GetString(HTTPAuthType)
+	if hs.options.DebugPath != "" {
+		if authPluginName == "" {
+			return nil, i18n.NewError(ctx, i18n.MsgDebugEndpointsRequireAuth, hs.name)
+		}
+		if err := mountDebugHandlers(ctx, hs.name, r, hs.options.DebugPath); err != nil {
+			return nil, err
+		}
+	}
 	handler, err := wrapAuthIfEnabled(ctx, authConfig, authPluginName, r)
 	if err != nil {
 		return nil, err
 	}
+	hs.routerHandler = handler
+	handler = WrapCompressionIfEnabled(ctx, hs.conf, handler)
 	handler = WrapCorsIfEnabled(ctx, hs.corsConf, handler)
+	handler = WrapRequestIDIfEnabled(ctx, hs.conf, handler)
+	handler = WrapClientCertPrincipalIfEnabled(ctx, hs.conf.SubSection("tls"), handler)
+	handler, err = WrapClientIP(ctx, hs.conf, handler)
+	if err != nil {
+		return nil, err
+	}
+	handler = hs.wrapHeaderCount(ctx, handler)
+	handler, err = hs.wrapConcurrencyLimit(ctx, handler)
+	if err != nil {
+		return nil, err
+	}
+	handler = hs.wrapDrain(handler)
 
 	// Where a maximum request timeout is set, it does not make sense for either the
 	// read timeout (time to read full body), or the write timeout (time to write the
 	// response after processing the request) to be less than that
-	readTimeout := hs.conf.GetDuration(HTTPConfReadTimeout)
+	var readTimeout, writeTimeout, readHeaderTimeout, idleTimeout time.Duration
+	if readTimeout, err = hs.timeout(HTTPConfReadTimeout, hs.options.ReadTimeout); err != nil {
+		return nil, err
+	}
 	if readTimeout < hs.options.MaximumRequestTimeout {
 		readTimeout = hs.options.MaximumRequestTimeout + 1*time.Second
 	}
-	writeTimeout := hs.conf.GetDuration(HTTPConfWriteTimeout)
+	if writeTimeout, err = hs.timeout(HTTPConfWriteTimeout, hs.options.WriteTimeout); err != nil {
+		return nil, err
+	}
 	if writeTimeout < hs.options.MaximumRequestTimeout {
 		writeTimeout = hs.options.MaximumRequestTimeout + 1*time.Second
 	}
+	// The headers are read before the handler runs, so the request timeout does not apply. A client
+	// trickling bytes can only hold the connection for this long, without sending a full request
+	if readHeaderTimeout, err = hs.timeout(HTTPConfReadHeaderTimeout, hs.options.ReadHeaderTimeout); err != nil {
+		return nil, err
+	}
+	if readTimeout > 0 && readHeaderTimeout > readTimeout {
+		readHeaderTimeout = readTimeout
+	}
+	if idleTimeout, err = hs.timeout(HTTPConfIdleTimeout, hs.options.IdleTimeout); err != nil {
+		return nil, err
+	}
 
-	log.L(ctx).Debugf("HTTP Server Timeouts (%s): read=%s write=%s request=%s", hs.l.Addr(), readTimeout, writeTimeout, hs.options.MaximumRequestTimeout)
+	// The header limit is enforced by Go while reading the request, before any handler runs,
+	// so applies independently of any limit applied to the size of the body by the routes
+	maxHeaderBytes := int(hs.conf.GetByteSize(HTTPConfMaxHeaderBytes))
+	if hs.options.MaxHeaderBytes > 0 {
+		maxHeaderBytes = hs.options.MaxHeaderBytes
+	}
+
+	log.L(ctx).Debugf("HTTP Server Timeouts (%s): readHeader=%s read=%s write=%s idle=%s request=%s", hs.l.Addr(), readHeaderTimeout, readTimeout, writeTimeout, idleTimeout, hs.options.MaximumRequestTimeout)
 	srv = &http.Server{
 		Handler:           handler,
 		WriteTimeout:      writeTimeout,
 		ReadTimeout:       readTimeout,
-		ReadHeaderTimeout: hs.conf.GetDuration(HTTPConfReadTimeout), // safe for this to always be the read timeout - should be short
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
 		TLSConfig:         tlsConfig,
 		ConnContext: func(newCtx context.Context, c net.Conn) context.Context {
 			l := log.L(ctx).WithField("req", fftypes.ShortID())
@@ -144,12 +235,139 @@ func (hs *httpServer) createServer(ctx context.Context, r *mux.Router) (srv *htt
 	return srv, nil
 }
 
+// timeout is the option if set, otherwise the config
+func (hs *httpServer) timeout(key string, option time.Duration) (time.Duration, error) {
+	if option > 0 {
+		return option, nil
+	}
+	return hs.conf.ParseDuration(key)
+}
+
+func (hs *httpServer) wrapDrain(chain http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if hs.draining.Load() {
+			res.Header().Set("Connection", "close")
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(res).Encode(&fftypes.RESTError{
+				Error: i18n.NewError(req.Context(), i18n.MsgServerDraining, hs.name).Error(),
+			})
+			return
+		}
+		chain.ServeHTTP(res, req)
+	})
+}
+
+func (hs *httpServer) wrapHeaderCount(ctx context.Context, chain http.Handler) http.Handler {
+	maxHeaderCount := hs.conf.GetInt(HTTPConfMaxHeaderCount)
+	if hs.options.MaxHeaderCount > 0 {
+		maxHeaderCount = hs.options.MaxHeaderCount
+	}
+	if maxHeaderCount <= 0 {
+		return chain
+	}
+	log.L(ctx).Debugf("HTTP Server maximum header count: %d", maxHeaderCount)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		count := 0
+		for _, values := range req.Header {
+			count += len(values)
+		}
+		if count > maxHeaderCount {
+			res.Header().Set("Content-Type", "application/json")
+			res.WriteHeader(http.StatusRequestHeaderFieldsTooLarge)
+			_ = json.NewEncoder(res).Encode(&fftypes.RESTError{
+				Error: i18n.NewError(req.Context(), i18n.MsgTooManyRequestHeaders, count, maxHeaderCount).Error(),
+			})
+			return
+		}
+		chain.ServeHTTP(res, req)
+	})
+}
+
+// wrapConcurrencyLimit limits the number of requests processed at once, other than those with an exempt path.
+// Requests beyond the limit wait up to the queue timeout for a slot, then are rejected 503.
+// Note that long-lived requests, such as server-sent events, hold a slot until they end.
+func (hs *httpServer) wrapConcurrencyLimit(ctx context.Context, chain http.Handler) (http.Handler, error) {
+	limit := hs.conf.GetInt(HTTPConfMaxConcurrentRequests)
+	if limit <= 0 {
+		return chain, nil
+	}
+	queueTimeout, err := hs.conf.ParseDuration(HTTPConfQueueTimeout)
+	if err != nil {
+		return nil, err
+	}
+	exemptPaths := hs.conf.GetStringSlice(HTTPConfConcurrencyExemptPaths)
+	log.L(ctx).Debugf("HTTP Server maximum concurrent requests: %d (queueTimeout=%s exempt=%v)", limit, queueTimeout, exemptPaths)
+	slots := make(chan struct{}, limit)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		for _, path := range exemptPaths {
+			if pathHasPrefix(req.URL.Path, path) {
+				chain.ServeHTTP(res, req)
+				return
+			}
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			if !hs.waitForSlot(req, slots, queueTimeout) {
+				log.L(req.Context()).Warnf("Rejecting request as %d concurrent requests are being processed", limit)
+				res.Header().Set("Content-Type", "application/json")
+				res.WriteHeader(http.StatusServiceUnavailable)
+				_ = json.NewEncoder(res).Encode(&fftypes.RESTError{
+					Error: i18n.NewError(req.Context(), i18n.MsgServerBusy, hs.name, limit).Error(),
+				})
+				return
+			}
+		}
+		defer func() { <-slots }()
+		chain.ServeHTTP(res, req)
+	}), nil
+}
+
+// pathHasPrefix matches the prefix on a path segment boundary, so "/health" matches "/health" and
+// "/health/ready" but not "/healthz"
+func pathHasPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// waitForSlot returns true if a slot was acquired within the timeout
+func (hs *httpServer) waitForSlot(req *http.Request, slots chan struct{}, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-req.Context().Done():
+		// the client has gone, so the response will not be read
+		return false
+	}
+}
+
+func (hs *httpServer) drain(ctx context.Context) {
+	if hs.options.DrainPeriod <= 0 {
+		return
+	}
+	log.L(ctx).Infof("%s draining for %s before shutdown", hs.name, hs.options.DrainPeriod)
+	hs.draining.Store(true)
+	if ka, ok := hs.s.(interface{ SetKeepAlivesEnabled(bool) }); ok {
+		ka.SetKeepAlivesEnabled(false)
+	}
+	time.Sleep(hs.options.DrainPeriod)
+}
+
 func (hs *httpServer) ServeHTTP(ctx context.Context) {
 	serverEnded := make(chan struct{})
 	go func() {
 		select {
 		case <-ctx.Done():
 			log.L(ctx).Infof("API server context canceled - shutting down")
+			hs.drain(ctx)
 			shutdownContext, cancel := context.WithTimeout(context.Background(), hs.shutdownTimeout)
 			defer cancel()
 			if err := hs.s.Shutdown(shutdownContext); err != nil {
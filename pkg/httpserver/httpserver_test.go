@@ -27,15 +27,19 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hyperledger/firefly-common/mocks/httpservermocks"
+	"github.com/hyperledger/firefly-common/pkg/auth"
 	"github.com/hyperledger/firefly-common/pkg/auth/basic"
 	"github.com/hyperledger/firefly-common/pkg/config"
 	"github.com/hyperledger/firefly-common/pkg/fftls"
@@ -115,6 +119,287 @@ func TestShutdownError(t *testing.T) {
 	testDone <- struct{}{}
 }
 
+func TestShutdownDrain(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	errChan := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	r := mux.NewRouter()
+	r.Path("/test").HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		close(inFlight)
+		<-release
+		res.WriteHeader(200)
+	})
+	s, err := NewHTTPServer(ctx, "ut", r, errChan, cp, cc, &ServerOptions{
+		DrainPeriod: 500 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	go s.ServeHTTP(ctx)
+	url := fmt.Sprintf("http://%s/test", s.Addr())
+
+	inFlightRes := make(chan *http.Response)
+	go func() {
+		res, err := http.Get(url)
+		assert.NoError(t, err)
+		inFlightRes <- res
+	}()
+	<-inFlight
+
+	cancel()
+	for !s.(*httpServer).draining.Load() {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	res, err := client.Get(url)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.True(t, res.Close)
+	var resBody map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF00254", resBody["error"])
+
+	close(release)
+	res = <-inFlightRes
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	err = <-errChan
+	assert.NoError(t, err)
+}
+
+func TestServeHeaderLimits(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cp.Set(HTTPConfMaxHeaderBytes, "1Kb")
+	cp.Set(HTTPConfMaxHeaderCount, 5)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	errChan := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := mux.NewRouter()
+	r.Path("/test").HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(200)
+	})
+	s, err := NewHTTPServer(ctx, "ut", r, errChan, cp, cc)
+	assert.NoError(t, err)
+	assert.Equal(t, 1024, s.(*httpServer).s.(*http.Server).MaxHeaderBytes)
+	go s.ServeHTTP(ctx)
+	url := fmt.Sprintf("http://%s/test", s.Addr())
+
+	send := func(headers map[string]string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		assert.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		return res
+	}
+
+	res := send(map[string]string{"X-Small": "ok"})
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Go allows some slack for buffering above the configured limit
+	res = send(map[string]string{"X-Huge": strings.Repeat("a", 32768)})
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, res.StatusCode)
+
+	res = send(map[string]string{"X-1": "a", "X-2": "b", "X-3": "c", "X-4": "d", "X-5": "e"})
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, res.StatusCode)
+	var resBody map[string]interface{}
+	err = json.NewDecoder(res.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF00270", resBody["error"])
+
+	cancel()
+	err = <-errChan
+	assert.NoError(t, err)
+}
+
+func TestServeHeaderLimitsOptions(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	s, err := NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc, &ServerOptions{
+		MaxHeaderBytes: 2048,
+		MaxHeaderCount: 10,
+	})
+	assert.NoError(t, err)
+	defer s.(*httpServer).l.Close()
+	assert.Equal(t, 2048, s.(*httpServer).s.(*http.Server).MaxHeaderBytes)
+
+	// Defaults
+	s, err = NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc)
+	assert.NoError(t, err)
+	defer s.(*httpServer).l.Close()
+	assert.Zero(t, s.(*httpServer).s.(*http.Server).MaxHeaderBytes)
+}
+
+type proxiedListener struct {
+	net.Listener
+	clientAddr net.Addr
+}
+
+type proxiedConn struct {
+	net.Conn
+	clientAddr net.Addr
+}
+
+func (pl *proxiedListener) Accept() (net.Conn, error) {
+	c, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxiedConn{Conn: c, clientAddr: pl.clientAddr}, nil
+}
+
+func (pc *proxiedConn) RemoteAddr() net.Addr {
+	return pc.clientAddr
+}
+
+func TestServeListenerWrapper(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	errChan := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	r := mux.NewRouter()
+	r.Path("/test").HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte(req.RemoteAddr))
+	})
+	clientAddr := &net.TCPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 51234}
+	s, err := NewHTTPServer(ctx, "ut", r, errChan, cp, cc, &ServerOptions{
+		ListenerWrapper: func(l net.Listener) net.Listener {
+			return &proxiedListener{Listener: l, clientAddr: clientAddr}
+		},
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, &proxiedListener{}, s.(*httpServer).l)
+	go s.ServeHTTP(ctx)
+
+	res, err := http.Get(fmt.Sprintf("http://%s/test", s.Addr()))
+	assert.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "203.0.113.7:51234", string(body))
+
+	cancel()
+	err = <-errChan
+	assert.NoError(t, err)
+}
+
+func TestServeTimeouts(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	newServer := func(options *ServerOptions) *http.Server {
+		s, err := NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc, options)
+		assert.NoError(t, err)
+		s.(*httpServer).l.Close()
+		return s.(*httpServer).s.(*http.Server)
+	}
+
+	// Defaults
+	srv := newServer(&ServerOptions{})
+	assert.Equal(t, 5*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 15*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 15*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 60*time.Second, srv.IdleTimeout)
+
+	// Options override config, with the read header timeout unaffected by the request timeout
+	srv = newServer(&ServerOptions{
+		MaximumRequestTimeout: 1 * time.Minute,
+		ReadHeaderTimeout:     2 * time.Second,
+		ReadTimeout:           3 * time.Second,
+		WriteTimeout:          4 * time.Second,
+		IdleTimeout:           5 * time.Second,
+	})
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 61*time.Second, srv.ReadTimeout)
+	assert.Equal(t, 61*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 5*time.Second, srv.IdleTimeout)
+
+	// The read header timeout is limited to the read timeout
+	cp.Set(HTTPConfReadHeaderTimeout, "30s")
+	cp.Set(HTTPConfReadTimeout, "10s")
+	srv = newServer(&ServerOptions{})
+	assert.Equal(t, 10*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 10*time.Second, srv.ReadTimeout)
+}
+
+func TestServeTimeoutsSecondsOrDurations(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+
+	// A bare number is seconds, and can be mixed with durations
+	cp.Set(HTTPConfShutdownTimeout, 30)
+	cp.Set(HTTPConfReadTimeout, "20")
+	cp.Set(HTTPConfWriteTimeout, "1m")
+	s, err := NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc)
+	assert.NoError(t, err)
+	s.(*httpServer).l.Close()
+	assert.Equal(t, 30*time.Second, s.(*httpServer).shutdownTimeout)
+	assert.Equal(t, 20*time.Second, s.(*httpServer).s.(*http.Server).ReadTimeout)
+	assert.Equal(t, 1*time.Minute, s.(*httpServer).s.(*http.Server).WriteTimeout)
+
+	cp.Set(HTTPConfIdleTimeout, "-5")
+	_, err = NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc)
+	assert.Regexp(t, "FF00293.*ut.idleTimeout.*FF00292", err)
+
+	cp.Set(HTTPConfShutdownTimeout, "30 seconds")
+	_, err = NewHTTPServer(context.Background(), "ut", mux.NewRouter(), make(chan error), cp, cc)
+	assert.Regexp(t, "FF00293.*ut.shutdownTimeout.*FF00291", err)
+}
+
+func TestServeReadHeaderTimeout(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	errChan := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s, err := NewHTTPServer(ctx, "ut", mux.NewRouter(), errChan, cp, cc, &ServerOptions{
+		ReadHeaderTimeout: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	go s.ServeHTTP(ctx)
+
+	// A client that never completes its headers is disconnected
+	conn, err := net.Dial("tcp", s.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /test HTTP/1.1\r\nHost: localhost\r\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err)
+
+	cancel()
+	err = <-errChan
+	assert.NoError(t, err)
+}
+
 func TestMissingCAFile(t *testing.T) {
 	cp := config.RootSection("ut")
 	InitHTTPConfig(cp, 0)
@@ -185,7 +470,7 @@ func TestTLSServerSelfSignedWithClientAuth(t *testing.T) {
 	r := mux.NewRouter()
 	r.HandleFunc("/test", func(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(200)
-		json.NewEncoder(res).Encode(map[string]interface{}{"hello": "world"})
+		json.NewEncoder(res).Encode(map[string]interface{}{"hello": "world", "principal": auth.GetPrincipal(req.Context())})
 	})
 	errChan := make(chan error)
 	hs, err := NewHTTPServer(context.Background(), "ut", r, errChan, cp, cc)
@@ -216,6 +501,7 @@ func TestTLSServerSelfSignedWithClientAuth(t *testing.T) {
 		var resBody map[string]interface{}
 		json.NewDecoder(res.Body).Decode(&resBody)
 		assert.Equal(t, "world", resBody["hello"])
+		assert.Equal(t, "O=Unit Tests", resBody["principal"])
 	}
 
 	// Close down the server and wait for it to complete
@@ -293,3 +579,116 @@ func TestServeAuthorizationBadPluginName(t *testing.T) {
 	_, err := NewHTTPServer(context.Background(), "ut", r, errChan, cp, cc)
 	assert.Regexp(t, "FF00168", err)
 }
+
+func newConcurrencyLimitTestHandler(t *testing.T, limit int, queueTimeout string) (http.Handler, chan struct{}, chan struct{}) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	cp.Set(HTTPConfMaxConcurrentRequests, limit)
+	cp.Set(HTTPConfQueueTimeout, queueTimeout)
+	cp.Set(HTTPConfConcurrencyExemptPaths, []string{"/health"})
+	inFlight := make(chan struct{}, 10)
+	release := make(chan struct{})
+	hs := &httpServer{name: "ut", conf: cp}
+	handler, err := hs.wrapConcurrencyLimit(context.Background(), http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		inFlight <- struct{}{}
+		if !strings.HasPrefix(req.URL.Path, "/health") {
+			<-release
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}))
+	assert.NoError(t, err)
+	return handler, inFlight, release
+}
+
+func TestConcurrencyLimitQueueAndReject(t *testing.T) {
+	handler, inFlight, release := newConcurrencyLimitTestHandler(t, 1, "100ms")
+
+	serve := func(path string) chan *httptest.ResponseRecorder {
+		done := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+			done <- res
+		}()
+		return done
+	}
+
+	// The first request holds the only slot
+	res1 := serve("/test")
+	<-inFlight
+
+	// Exempt paths are not limited
+	res := <-serve("/health/ready")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	<-inFlight
+	res = <-serve("/health")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	<-inFlight
+
+	// Only on a path segment boundary
+	res = <-serve("/healthz-admin")
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	// A request that cannot get a slot within the queue timeout is rejected
+	res = <-serve("/test")
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+	var resBody map[string]interface{}
+	err := json.NewDecoder(res.Body).Decode(&resBody)
+	assert.NoError(t, err)
+	assert.Regexp(t, "FF00296.*ut.*1", resBody["error"])
+
+	// A queued request proceeds once the slot is released
+	res2 := serve("/test")
+	time.Sleep(10 * time.Millisecond)
+	release <- struct{}{}
+	assert.Equal(t, http.StatusNoContent, (<-res1).Code)
+	<-inFlight
+	release <- struct{}{}
+	assert.Equal(t, http.StatusNoContent, (<-res2).Code)
+}
+
+func TestConcurrencyLimitNoQueue(t *testing.T) {
+	handler, inFlight, release := newConcurrencyLimitTestHandler(t, 1, "0")
+	defer close(release)
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+	<-inFlight
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/test", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
+
+func TestConcurrencyLimitClientGone(t *testing.T) {
+	handler, inFlight, release := newConcurrencyLimitTestHandler(t, 1, "1m")
+	defer close(release)
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+	<-inFlight
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+}
+
+func TestConcurrencyLimitDisabledOrInvalid(t *testing.T) {
+	config.RootConfigReset()
+	cp := config.RootSection("ut")
+	InitHTTPConfig(cp, 0)
+	hs := &httpServer{name: "ut", conf: cp}
+	r := mux.NewRouter()
+	handler, err := hs.wrapConcurrencyLimit(context.Background(), r)
+	assert.NoError(t, err)
+	assert.Equal(t, r, handler)
+
+	cp.Set(HTTPConfMaxConcurrentRequests, 10)
+	cp.Set(HTTPConfQueueTimeout, "-1")
+	cc := config.RootSection("utCors")
+	InitCORSConfig(cc)
+	_, err = NewHTTPServer(context.Background(), "ut", r, make(chan error), cp, cc)
+	assert.Regexp(t, "FF00293.*queueTimeout", err)
+}
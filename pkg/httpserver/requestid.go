@@ -0,0 +1,72 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// DefaultRequestIDHeader is the header used to pass the request ID, unless configured otherwise
+const DefaultRequestIDHeader = "X-FireFly-Request-ID"
+
+// CtxRequestIDKey is the context key for the ID of the request being processed,
+// which is propagated on outbound requests by ffresty
+type CtxRequestIDKey struct{}
+
+// Inbound request IDs are only accepted if they are safe to include in logs and response headers
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._:+/=-]{1,128}$`)
+
+// WithRequestID returns a context containing the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, CtxRequestIDKey{}, requestID)
+}
+
+// GetRequestID returns the request ID from the context, or an empty string if there is none
+func GetRequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(CtxRequestIDKey{}).(string)
+	return requestID
+}
+
+// WrapRequestIDIfEnabled assigns an ID to each request, reusing a valid ID passed in the configured header,
+// or otherwise generating a new UUID. The ID is stored on the context, added to the logger, and returned
+// in the same header on the response.
+func WrapRequestIDIfEnabled(ctx context.Context, conf config.Section, chain http.Handler) http.Handler {
+	if !conf.GetBool(HTTPConfRequestIDEnabled) {
+		return chain
+	}
+	header := conf.GetString(HTTPConfRequestIDHeader)
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	log.L(ctx).Debugf("Request IDs enabled using header '%s'", header)
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requestID := req.Header.Get(header)
+		if !validRequestID.MatchString(requestID) {
+			requestID = fftypes.NewUUID().String()
+		}
+		reqCtx := WithRequestID(req.Context(), requestID)
+		reqCtx = log.WithLogField(reqCtx, "httpreq", requestID)
+		res.Header().Set(header, requestID)
+		chain.ServeHTTP(res, req.WithContext(reqCtx))
+	})
+}
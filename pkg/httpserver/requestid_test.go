@@ -0,0 +1,77 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/firefly-common/pkg/config"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequestIDTestHandler(t *testing.T, enabled bool, header string) (http.Handler, *string) {
+	config.RootConfigReset()
+	section := config.RootSection("http")
+	InitHTTPConfig(section, 0)
+	section.Set(HTTPConfRequestIDEnabled, enabled)
+	section.Set(HTTPConfRequestIDHeader, header)
+	var seen string
+	return WrapRequestIDIfEnabled(context.Background(), section, http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		seen = GetRequestID(req.Context())
+	})), &seen
+}
+
+func TestRequestIDDisabled(t *testing.T) {
+	handler, seen := newRequestIDTestHandler(t, false, "")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, *seen)
+	assert.Empty(t, res.Header().Get(DefaultRequestIDHeader))
+}
+
+func TestRequestIDReuseInbound(t *testing.T) {
+	handler, seen := newRequestIDTestHandler(t, true, "X-Request-ID")
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123.def")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, "abc-123.def", *seen)
+	assert.Equal(t, "abc-123.def", res.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	handler, seen := newRequestIDTestHandler(t, true, "")
+	for _, inbound := range []string{"", "bad value\r\n", strings.Repeat("a", 129)} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(DefaultRequestIDHeader, inbound)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+		_, err := fftypes.ParseUUID(context.Background(), *seen)
+		assert.NoError(t, err)
+		assert.Equal(t, *seen, res.Header().Get(DefaultRequestIDHeader))
+	}
+}
+
+func TestGetRequestIDUnset(t *testing.T) {
+	assert.Empty(t, GetRequestID(context.Background()))
+	assert.Equal(t, "id1", GetRequestID(WithRequestID(context.Background(), "id1")))
+}
@@ -0,0 +1,130 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
+)
+
+// StaticOptions control how files are served by MountStaticFS
+type StaticOptions struct {
+	// IndexFile is served for directory paths, and as the SPA fallback. Defaults to "index.html"
+	IndexFile string
+	// SPA enables single-page-app behavior, where unknown paths under the prefix return the index file
+	SPA bool
+	// MaxAge sets a public Cache-Control max-age on assets. The index file is always served with no-cache
+	MaxAge time.Duration
+}
+
+type staticHandler struct {
+	prefix  string
+	fsys    fs.FS
+	options StaticOptions
+}
+
+// MountStaticFS serves the files in fsys under the path prefix on the router, such as "/ui" - or "/" to serve
+// them from the root. Register any API routes before calling this, as routes are matched in the order they are added.
+// Conditional and range requests are handled by http.ServeContent, and text assets are compressed by the
+// compression configuration of the HTTP server.
+func MountStaticFS(ctx context.Context, r *mux.Router, prefix string, fsys fs.FS, options *StaticOptions) error {
+	if prefix == "" {
+		return i18n.NewError(ctx, i18n.MsgStaticPathPrefixRequired)
+	}
+	sh := &staticHandler{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		fsys:   fsys,
+	}
+	if options != nil {
+		sh.options = *options
+	}
+	if sh.options.IndexFile == "" {
+		sh.options.IndexFile = "index.html"
+	}
+	r.PathPrefix(sh.prefix+"/").Methods(http.MethodGet, http.MethodHead).Handler(sh)
+	if sh.prefix != "" {
+		r.Path(sh.prefix).Methods(http.MethodGet, http.MethodHead).Handler(sh)
+	}
+	return nil
+}
+
+func (sh *staticHandler) resolve(reqPath string) (string, bool) {
+	filePath := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(reqPath, sh.prefix)), "/")
+	if filePath == "" {
+		filePath = "."
+	}
+	stat, err := fs.Stat(sh.fsys, filePath)
+	if err == nil && stat.IsDir() {
+		filePath = path.Join(filePath, sh.options.IndexFile)
+		stat, err = fs.Stat(sh.fsys, filePath)
+	}
+	if err == nil && !stat.IsDir() {
+		return filePath, true
+	}
+	if sh.options.SPA {
+		return sh.options.IndexFile, true
+	}
+	return "", false
+}
+
+func (sh *staticHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	filePath, ok := sh.resolve(req.URL.Path)
+	var f fs.File
+	var stat fs.FileInfo
+	var err error
+	if ok {
+		if f, err = sh.fsys.Open(filePath); err == nil {
+			defer f.Close()
+			stat, err = f.Stat()
+		}
+	}
+	if !ok || err != nil {
+		log.L(req.Context()).Debugf("Static file not found for '%s': %v", req.URL.Path, err)
+		http.NotFound(res, req)
+		return
+	}
+
+	// files that cannot seek are read into memory, as http.ServeContent seeks to find the size and serve ranges
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			log.L(req.Context()).Errorf("Failed to read static file '%s': %s", filePath, err)
+			http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	if path.Base(filePath) == path.Base(sh.options.IndexFile) || sh.options.MaxAge <= 0 {
+		res.Header().Set("Cache-Control", "no-cache")
+	} else {
+		res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(sh.options.MaxAge.Seconds())))
+	}
+	http.ServeContent(res, req, filePath, stat.ModTime(), content)
+}
@@ -0,0 +1,211 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+var testStaticModTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+var testStaticFS = fstest.MapFS{
+	"index.html":        {Data: []byte("<html>index</html>")},
+	"assets/app.css":    {Data: []byte("body { color: black; }"), ModTime: testStaticModTime},
+	"assets/app.js":     {Data: []byte("console.log('hello')")},
+	"assets/logo.png":   {Data: []byte("\x89PNG\r\n\x1a\n")},
+	"assets/noext":      {Data: []byte("just some text")},
+	"docs/index.html":   {Data: []byte("<html>docs</html>")},
+	"empty/placeholder": {Data: []byte{}},
+}
+
+func newTestStaticRouter(options *StaticOptions) *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/ui/api/status", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusTeapot)
+	})
+	_ = MountStaticFS(context.Background(), r, "/ui/", testStaticFS, options)
+	return r
+}
+
+func doStaticRequest(r http.Handler, method, path string, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, req)
+	return res
+}
+
+func TestStaticServeFiles(t *testing.T) {
+	r := newTestStaticRouter(&StaticOptions{MaxAge: 1 * time.Hour})
+
+	res := doStaticRequest(r, http.MethodGet, "/ui/assets/app.js")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Regexp(t, "javascript", res.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=3600", res.Header().Get("Cache-Control"))
+	assert.Equal(t, "console.log('hello')", res.Body.String())
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/assets/noext")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Regexp(t, "text/plain", res.Header().Get("Content-Type"))
+
+	res = doStaticRequest(r, http.MethodGet, "/ui")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "no-cache", res.Header().Get("Cache-Control"))
+	assert.Equal(t, "<html>index</html>", res.Body.String())
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/docs/")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "<html>docs</html>", res.Body.String())
+
+	res = doStaticRequest(r, http.MethodHead, "/ui/assets/logo.png")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "image/png", res.Header().Get("Content-Type"))
+	assert.Equal(t, "8", res.Header().Get("Content-Length"))
+	assert.Empty(t, res.Body.String())
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/api/status")
+	assert.Equal(t, http.StatusTeapot, res.Code)
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/missing")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/empty")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = doStaticRequest(r, http.MethodPost, "/ui/assets/app.js")
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+}
+
+func TestStaticServeSPAFallback(t *testing.T) {
+	r := newTestStaticRouter(&StaticOptions{SPA: true})
+
+	res := doStaticRequest(r, http.MethodGet, "/ui/some/client/route")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Regexp(t, "text/html", res.Header().Get("Content-Type"))
+	assert.Equal(t, "<html>index</html>", res.Body.String())
+
+	sh := &staticHandler{prefix: "/ui", fsys: testStaticFS, options: StaticOptions{IndexFile: "index.html"}}
+	filePath, ok := sh.resolve("/ui/../../etc/passwd")
+	assert.False(t, ok)
+	assert.Empty(t, filePath)
+
+	res = doStaticRequest(r, http.MethodGet, "/other")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestStaticServeConditionalAndRange(t *testing.T) {
+	r := newTestStaticRouter(nil)
+
+	res := doStaticRequest(r, http.MethodGet, "/ui/assets/app.css")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, testStaticModTime.Format(http.TimeFormat), res.Header().Get("Last-Modified"))
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/assets/app.css", "If-Modified-Since", testStaticModTime.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	res = doStaticRequest(r, http.MethodGet, "/ui/assets/app.css", "Range", "bytes=0-3")
+	assert.Equal(t, http.StatusPartialContent, res.Code)
+	assert.Equal(t, "body", res.Body.String())
+}
+
+func TestStaticServeCompressed(t *testing.T) {
+	r := newTestStaticRouter(nil)
+	handler := newCompressionTestHandler(true, r.ServeHTTP)
+
+	req := httptest.NewRequest(http.MethodGet, "/ui/assets/app.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "gzip", res.Header().Get("Content-Encoding"))
+	assert.Empty(t, res.Header().Get("Content-Length"))
+	assert.Equal(t, "body { color: black; }", gunzip(t, res))
+
+	req = httptest.NewRequest(http.MethodGet, "/ui/assets/logo.png", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	res = httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	assert.Empty(t, res.Header().Get("Content-Encoding"))
+}
+
+// testNoSeekFS returns files that cannot seek, and optionally fail to read
+type testNoSeekFS struct {
+	readErr error
+}
+
+type testNoSeekFile struct {
+	fs.File
+	readErr error
+}
+
+func (f *testNoSeekFile) Read(b []byte) (int, error) {
+	if f.readErr != nil {
+		return 0, f.readErr
+	}
+	return f.File.Read(b)
+}
+
+func (nfs *testNoSeekFS) Open(name string) (fs.File, error) {
+	f, err := testStaticFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &testNoSeekFile{File: f, readErr: nfs.readErr}, nil
+}
+
+func TestStaticServeNoSeek(t *testing.T) {
+	r := mux.NewRouter()
+	err := MountStaticFS(context.Background(), r, "/", &testNoSeekFS{}, nil)
+	assert.NoError(t, err)
+	res := doStaticRequest(r, http.MethodGet, "/assets/app.js")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "console.log('hello')", res.Body.String())
+
+	r = mux.NewRouter()
+	err = MountStaticFS(context.Background(), r, "/", &testNoSeekFS{readErr: fmt.Errorf("pop")}, nil)
+	assert.NoError(t, err)
+	res = doStaticRequest(r, http.MethodGet, "/assets/app.js")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
+
+func TestStaticServeRootPrefix(t *testing.T) {
+	r := mux.NewRouter()
+	err := MountStaticFS(context.Background(), r, "/", testStaticFS, nil)
+	assert.NoError(t, err)
+
+	res := doStaticRequest(r, http.MethodGet, "/")
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "<html>index</html>", res.Body.String())
+}
+
+func TestStaticEmptyPrefix(t *testing.T) {
+	err := MountStaticFS(context.Background(), mux.NewRouter(), "", testStaticFS, nil)
+	assert.Regexp(t, "FF00322", err)
+}
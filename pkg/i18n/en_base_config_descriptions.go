@@ -30,6 +30,7 @@ var IntType = "`int`"
 var BooleanType = "`boolean`"
 var FloatType = "`float32`"
 var MapStringStringType = "`map[string]string`"
+var ObjectArrayType = "`[]object`"
 var IgnoredType = "IGNORE"
 
 var ffc = func(key, translation, fieldType string) ConfigMessageKey {
@@ -46,6 +47,7 @@ var (
 	ConfigGlobalRetryInitDelay       = ffc("config.global.retry.initDelay", "The initial retry delay", TimeDurationType)
 	ConfigGlobalRetryInitialDelay    = ffc("config.global.retry.initialDelay", "The initial retry delay", TimeDurationType)
 	ConfigGlobalRetryMaxDelay        = ffc("config.global.retry.maxDelay", "The maximum retry delay", TimeDurationType)
+	ConfigGlobalRetryJitter          = ffc("config.global.retry.jitter", "Randomize each retry delay between the initial delay and three times the previous delay, in place of the factor", BooleanType)
 	ConfigGlobalRetryMaxAttempts     = ffc("config.global.retry.maxAttempts", "The maximum number attempts", IntType)
 	ConfigGlobalRetryCount           = ffc("config.global.retry.count", "The maximum number of times to retry", IntType)
 	ConfigGlobalInitWaitTime         = ffc("config.global.retry.initWaitTime", "The initial retry delay", TimeDurationType)
@@ -56,14 +58,20 @@ var (
 	ConfigGlobalPassword = ffc("config.global.auth.password", "Password", StringType)
 	ConfigGlobalProxyURL = ffc("config.global.proxy.url", "Optional HTTP proxy server to connect through", StringType)
 
-	ConfigGlobalSize = ffc("config.global.cache.size", "The size of the cache", ByteSizeType)
-	ConfigGlobalTTL  = ffc("config.global.cache.ttl", "The time to live (TTL) for the cache", TimeDurationType)
+	ConfigGlobalSize         = ffc("config.global.cache.size", "The size of the cache", ByteSizeType)
+	ConfigGlobalTTL          = ffc("config.global.cache.ttl", "The time to live (TTL) for the cache", TimeDurationType)
+	ConfigGlobalCacheEnabled = ffc("config.global.cache.enabled", "Cache successful GET responses in memory, honoring any Cache-Control max-age returned by the server", BooleanType)
+
+	ConfigGlobalBulkheadMaxRequestsPerHost = ffc("config.global.bulkhead.maxRequestsPerHost", "The maximum number of in-flight requests to each host, so that one slow host cannot starve requests to other hosts. Zero means no limit", IntType)
+	ConfigGlobalBulkheadQueueTimeout       = ffc("config.global.bulkhead.queueTimeout", "How long a request to a host that is at its limit waits for a slot, before failing. Zero fails the request immediately", TimeDurationType)
 
 	ConfigGlobalWsConnectionTimeout      = ffc("config.global.ws.connectionTimeout", "The amount of time to wait while establishing a connection (or auto-reconnection)", TimeDurationType)
 	ConfigGlobalWsHeartbeatInterval      = ffc("config.global.ws.heartbeatInterval", "The amount of time to wait between heartbeat signals on the WebSocket connection", TimeDurationType)
 	ConfigGlobalWsInitialConnectAttempts = ffc("config.global.ws.initialConnectAttempts", "The number of attempts FireFly will make to connect to the WebSocket when starting up, before failing", IntType)
 	ConfigGlobalWsPath                   = ffc("config.global.ws.path", "The WebSocket sever URL to which FireFly should connect", "WebSocket URL "+StringType)
 	ConfigGlobalWsReadBufferSize         = ffc("config.global.ws.readBufferSize", "The size in bytes of the read buffer for the WebSocket connection", ByteSizeType)
+	ConfigGlobalWsReceiveBufferSize      = ffc("config.global.ws.receiveBufferSize", "The number of received messages to queue for the consumer. The default of 0 hands each message directly to the consumer", IntType)
+	ConfigGlobalWsReceiveOverflowPolicy  = ffc("config.global.ws.receiveOverflowPolicy", "What to do when the receive buffer is full: 'block' reading from the WebSocket, 'dropOldest' or 'dropNewest'", StringType)
 	ConfigGlobalWsWriteBufferSize        = ffc("config.global.ws.writeBufferSize", "The size in bytes of the write buffer for the WebSocket connection", ByteSizeType)
 	ConfigGlobalWsURL                    = ffc("config.global.ws.url", "URL to use for WebSocket - overrides url one level up (in the HTTP config)", StringType)
 
@@ -72,7 +80,13 @@ var (
 	ConfigGlobalTLSClientAuth             = ffc("config.global.tls.clientAuth", "Enables or disables client auth for TLS on this API", StringType)
 	ConfigGlobalTLSEnabled                = ffc("config.global.tls.enabled", "Enables or disables TLS on this API", BooleanType)
 	ConfigGlobalTLSKeyFile                = ffc("config.global.tls.keyFile", "The path to the private key file for TLS on this API", StringType)
+	ConfigGlobalTLSPKCS12File             = ffc("config.global.tls.pkcs12File", "The path to a PKCS#12 (.p12/.pfx) file containing the certificate chain and private key for TLS on this API, as an alternative to certFile and keyFile", StringType)
+	ConfigGlobalTLSPKCS12Passphrase       = ffc("config.global.tls.pkcs12Passphrase", "The passphrase of the PKCS#12 file", StringType)
 	ConfigGlobalTLSRequiredDNAttributes   = ffc("config.global.tls.requiredDNAttributes", "A set of required subject DN attributes. Each entry is a regular expression, and the subject certificate must have a matching attribute of the specified type (CN, C, O, OU, ST, L, STREET, POSTALCODE, SERIALNUMBER are valid attributes)", MapStringStringType)
+	ConfigGlobalTLSClientCertificates     = ffc("config.global.tls.clientCertificates", "For client TLS, a list of entries with 'hosts', 'certFile' and 'keyFile' that select the client certificate presented to each server. Hosts can be wildcards such as '*.example.com'. Other servers are presented the certFile/keyFile, or no certificate if not set", ObjectArrayType)
+	ConfigGlobalTLSOCSPStapling           = ffc("config.global.tls.ocspStapling", "For server TLS, fetch the OCSP response for the certificate from the responder it specifies, and staple it to each TLS handshake. If the responder is unavailable, the certificate is served without a staple", BooleanType)
+	ConfigGlobalTLSPinnedPublicKeys       = ffc("config.global.tls.pinnedPublicKeys", "For client TLS, the base64 SHA-256 hashes of the public keys (SPKI) the server is pinned to, optionally prefixed with 'sha256/'. A connection is only accepted if a certificate in the validated chain of the server matches one of them", ArrayStringType)
+	ConfigGlobalTLSPinningOnly            = ffc("config.global.tls.pinningOnly", "For client TLS with pinnedPublicKeys, accept a server whose leaf certificate matches a pin without validating its certificate chain against the CAs", BooleanType)
 	ConfigGlobalTLSInsecureSkipHostVerify = ffc("config.global.tls.insecureSkipHostVerify", "When to true in unit test development environments to disable TLS verification. Use with extreme caution", BooleanType)
 	ConfigGlobalTLSHandshakeTimeout       = ffc("config.global.tlsHandshakeTimeout", "The maximum amount of time to wait for a successful TLS handshake", TimeDurationType)
 
@@ -86,6 +100,12 @@ var (
 	ConfigGlobalMethod                    = ffc("config.global.method", "The HTTP method to use when making requests to the Address Resolver", StringType)
 	ConfigGlobalAuthType                  = ffc("config.global.auth.type", "The auth plugin to use for server side authentication of requests", StringType)
 	ConfigGlobalPassthroughHeadersEnabled = ffc("config.global.passthroughHeadersEnabled", "Enable passing through the set of allowed HTTP request headers", BooleanType)
+	ConfigGlobalRequestIDHeader           = ffc("config.global.requestIDHeader", "The HTTP header used to pass the ID of the request being processed on outbound requests", StringType)
+	ConfigGlobalRequestIDEnabled          = ffc("config.global.requestID.enabled", "Assign an ID to each inbound request, reusing a valid ID passed in the request ID header or generating a new one, that is added to logs and returned in the response", BooleanType)
+	ConfigGlobalRequestIDHeaderName       = ffc("config.global.requestID.header", "The HTTP header an inbound request ID is read from, and returned in", StringType)
+	ConfigGlobalCompressionEnabled        = ffc("config.global.compression.enabled", "For HTTP clients, compress request bodies over the threshold size, and transparently decompress gzip/deflate responses. For HTTP servers, gzip responses for clients that accept it", BooleanType)
+	ConfigGlobalCompressionType           = ffc("config.global.compression.type", "The Content-Encoding to use for compressed request bodies - gzip or deflate", StringType)
+	ConfigGlobalCompressionThreshold      = ffc("config.global.compression.threshold", "The minimum size of request body to compress", ByteSizeType)
 
 	ConfigLang                  = ffc("config.lang", "Default language for translation (API calls may support language override using headers)", StringType)
 	ConfigLogCompress           = ffc("config.log.compress", "Determines if the rotated log files should be compressed using gzip", BooleanType)
@@ -118,11 +138,26 @@ var (
 
 	ConfigGlobalDebugEnabled = ffc("config.debug.enabled", "Whether the debug HTTP endpoint is enabled", BooleanType)
 
-	ConfigGlobalPort              = ffc("config.global.port", "Listener port", IntType)
-	ConfigGlobalAddress           = ffc("config.global.address", "Listener address", IntType)
-	ConfigGlobalPublicURL         = ffc("config.global.publicURL", "Externally available URL for the HTTP endpoint", StringType)
-	ConfigGlobalReadTimeout       = ffc("config.global.readTimeout", "HTTP server read timeout", TimeDurationType)
-	ConfigGlobalWriteTimeout      = ffc("config.global.writeTimeout", "HTTP server write timeout", TimeDurationType)
-	ConfigGlobalShutdownTimeout   = ffc("config.global.shutdownTimeout", "HTTP server shutdown timeout", TimeDurationType)
-	ConfigDynamicPublicURLHeaders = ffc("config.global.dynamicPublicURLHeader", "Dynamic header that informs the backend the base public URL for the request, in order to build URL links in OpenAPI/SwaggerUI", StringType)
+	ConfigGlobalPort                       = ffc("config.global.port", "Listener port", IntType)
+	ConfigGlobalAddress                    = ffc("config.global.address", "Listener address", IntType)
+	ConfigGlobalPublicURL                  = ffc("config.global.publicURL", "Externally available URL for the HTTP endpoint", StringType)
+	ConfigGlobalReadTimeout                = ffc("config.global.readTimeout", "HTTP server read timeout", TimeDurationType)
+	ConfigGlobalReadHeaderTimeout          = ffc("config.global.readHeaderTimeout", "HTTP server timeout for reading the request line and headers, which protects against clients that send them slowly. Limited to the read timeout", TimeDurationType)
+	ConfigGlobalWriteTimeout               = ffc("config.global.writeTimeout", "HTTP server write timeout", TimeDurationType)
+	ConfigGlobalShutdownTimeout            = ffc("config.global.shutdownTimeout", "HTTP server shutdown timeout", TimeDurationType)
+	ConfigGlobalMaxHeaderBytes             = ffc("config.global.maxHeaderBytes", "The maximum size of the request line and headers the HTTP server reads, before responding 431. The request body is not included. Zero uses the Go default of 1MB", ByteSizeType)
+	ConfigGlobalMaxHeaderCount             = ffc("config.global.maxHeaderCount", "The maximum number of request header values the HTTP server accepts, before responding 431. Zero means no limit", IntType)
+	ConfigGlobalMaxConcurrentRequests      = ffc("config.global.maxConcurrentRequests", "The maximum number of requests the HTTP server processes concurrently. Further requests wait up to the queueTimeout for a slot, then the server responds 503. Zero means no limit", IntType)
+	ConfigGlobalQueueTimeout               = ffc("config.global.queueTimeout", "How long a request waits for a slot when the HTTP server is processing maxConcurrentRequests, before the server responds 503. Zero rejects immediately", TimeDurationType)
+	ConfigGlobalConcurrencyExemptPaths     = ffc("config.global.concurrencyExemptPaths", "Path prefixes, such as those of health checks, that are not subject to maxConcurrentRequests. Each is matched on a path segment boundary", ArrayStringType)
+	ConfigGlobalTrustedProxies             = ffc("config.global.trustedProxies", "The CIDRs or IP addresses of proxies trusted to report the client IP in the trustedProxyHeader. The headers of other peers are ignored, and the client IP is the address of the peer", ArrayStringType)
+	ConfigGlobalTrustedProxyHeader         = ffc("config.global.trustedProxyHeader", "The header the trustedProxies report the client IP in - 'Forwarded', or a header with a comma separated list of IPs such as 'X-Forwarded-For'. Only this header is used, as the proxies pass any other header through from the client", StringType)
+	ConfigGlobalCompressionMinSize         = ffc("config.global.compression.minSize", "The minimum size of a response body to compress. Smaller responses, and streamed responses flushed before reaching this size, are sent uncompressed", ByteSizeType)
+	ConfigGlobalCompressionContentTypes    = ffc("config.global.compression.contentTypes", "The content types of responses to compress. An entry ending in * matches all content types with that prefix, such as text/*. Server-sent events are never compressed", ArrayStringType)
+	ConfigGlobalRateLimitRequestsPerSecond = ffc("config.global.rateLimit.requestsPerSecond", "The rate at which each caller (authenticated principal, or remote IP) can make API requests. Zero disables rate limiting", FloatType)
+	ConfigGlobalRateLimitBurst             = ffc("config.global.rateLimit.burst", "The number of requests a caller can burst above the configured rate. Zero means the rate rounded up to a whole number", IntType)
+	ConfigGlobalRateLimitMaxClients        = ffc("config.global.rateLimit.maxClients", "The maximum number of callers to track rate limits for, with the least recently seen evicted", IntType)
+	ConfigGlobalMaxBatchRequests           = ffc("config.global.maxBatchRequests", "The maximum number of requests in a single call to the batch endpoint, if enabled on the API server", IntType)
+	ConfigGlobalSSEKeepAlive               = ffc("config.global.sseKeepAlive", "The interval of the keep-alive comments sent on idle server-sent events responses, which stop proxies closing the connection", TimeDurationType)
+	ConfigDynamicPublicURLHeaders          = ffc("config.global.dynamicPublicURLHeader", "Dynamic header that informs the backend the base public URL for the request, in order to build URL links in OpenAPI/SwaggerUI", StringType)
 )
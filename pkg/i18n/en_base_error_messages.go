@@ -178,4 +178,87 @@ var (
 	MsgJSONQueryOpUnsupportedMod                   = ffe("FF00240", "Operation '%s' does not support modifiers: %v", 400)
 	MsgJSONQueryValueUnsupported                   = ffe("FF00241", "Field value not supported (must be string, number, or boolean): %s", 400)
 	MsgJSONQuerySortUnsupported                    = ffe("FF00242", "Invalid 'order' for sort (must be 'asc', 'ascending', 'desc' or 'descending'): %s", 400)
+	MsgRateLimitExceeded                           = ffe("FF00243", "Rate limit exceeded", http.StatusTooManyRequests)
+	MsgInvalidSortField                            = ffe("FF00244", "Invalid sort field(s): %s", 400)
+	MsgInvalidCompressionType                      = ffe("FF00245", "Invalid compression type '%s' (must be 'gzip' or 'deflate')")
+	MsgFieldTooShort                               = ffe("FF00246", "Field '%s' minimum length is %d", 400)
+	MsgFieldPatternMismatch                        = ffe("FF00247", "Field '%s' does not match the required pattern '%s'", 400)
+	MsgInvalidValidationTag                        = ffe("FF00248", "Invalid ffvalidate rule '%s' on field '%s'", 500)
+	MsgESInitialTimestampUnsupported               = ffe("FF00249", "Event streams of this type do not support 'initialTimestamp'", http.StatusBadRequest)
+	MsgESInitialTimestampAndSequence               = ffe("FF00250", "Only one of 'initialSequenceID' and 'initialTimestamp' can be set", http.StatusBadRequest)
+	MsgWSInvalidOverflowPolicy                     = ffe("FF00251", "Invalid WebSocket receive overflow policy '%s' (must be 'block', 'dropOldest' or 'dropNewest')")
+	MsgWSDropPolicyNeedsBuffer                     = ffe("FF00252", "WebSocket receive overflow policy '%s' requires a receive buffer size greater than zero")
+	MsgFilterMapFieldOpUnsupported                 = ffe("FF00253", "Filter operation '%s' is not supported for map field '%s'", http.StatusBadRequest)
+	MsgServerDraining                              = ffe("FF00254", "The %s server is shutting down", http.StatusServiceUnavailable)
+	MsgFFIParamSchemaInvalid                       = ffe("FF00255", "Invalid schema for parameter '%s' in '%s': %s", http.StatusBadRequest)
+	MsgByteSizeParseFail                           = ffe("FF00256", "Unable to parse '%s' as byte size string, or number of bytes", http.StatusBadRequest)
+	MsgConfigSecretProviderUnknown                 = ffe("FF00257", "Unknown secret provider '%s' referenced by configuration key '%s'")
+	MsgConfigSecretUnresolved                      = ffe("FF00258", "Failed to resolve secret '%s:%s' referenced by configuration key '%s': %s")
+	MsgJSONObjectMissingKey                        = ffe("FF00259", "Missing required field '%s'", http.StatusBadRequest)
+	MsgJSONObjectInvalidType                       = ffe("FF00260", "Field '%s' cannot be converted to %s: %+v", http.StatusBadRequest)
+	MsgESInvalidScheduleTimezone                   = ffe("FF00261", "Invalid timezone '%s' for event stream active schedule: %s", http.StatusBadRequest)
+	MsgESInvalidScheduleWindow                     = ffe("FF00262", "Invalid event stream active schedule window '%s': %s", http.StatusBadRequest)
+	MsgESScheduleNoWindows                         = ffe("FF00263", "Event stream active schedule must contain at least one window", http.StatusBadRequest)
+	MsgDBInvalidGroupColumn                        = ffe("FF00264", "Cannot group by '%s' in collection '%s'", http.StatusBadRequest)
+	MsgESNotInProcessStream                        = ffe("FF00265", "Event stream '%s' is not of type 'inprocess'", http.StatusBadRequest)
+	MsgESAlreadySubscribed                         = ffe("FF00266", "Event stream '%s' already has an in-process subscriber", http.StatusConflict)
+	MsgESInProcessInterrupted                      = ffe("FF00267", "Interrupted waiting for in-process subscriber")
+	MsgESSubscriberDetached                        = ffe("FF00268", "In-process subscriber detached before acknowledging batch %d")
+	MsgInvalidClientCertMapping                    = ffe("FF00269", "TLS client certificate mapping %d must have hosts, a certFile and a keyFile")
+	MsgTooManyRequestHeaders                       = ffe("FF00270", "Request has %d header values, which exceeds the maximum of %d", http.StatusRequestHeaderFieldsTooLarge)
+	MsgInvalidPKCS12File                           = ffe("FF00271", "Invalid PKCS#12 file '%s'")
+	MsgPKCS12IncorrectPassphrase                   = ffe("FF00272", "Incorrect passphrase for PKCS#12 file '%s'")
+	MsgTLSCertFilesAndPKCS12                       = ffe("FF00273", "TLS configuration cannot have both a PKCS#12 file and a certificate/key file pair")
+	MsgWebSocketAckTimeout                         = ffe("FF00274", "Timed out after %s waiting for WebSocket acknowledgment of batch %d")
+	MsgESSourceRunExited                           = ffe("FF00275", "Event stream source exited without the stream being stopped")
+	MsgConfigArrayEntryInvalid                     = ffe("FF00276", "Invalid configuration in '%s'")
+	MsgInvalidCAPEM                                = ffe("FF00277", "Invalid CA certificates PEM")
+	MsgInvalidKeyPairPEM                           = ffe("FF00278", "Invalid certificate and key pair PEM")
+	MsgDBInvalidInt64ID                            = ffe("FF00279", "Invalid ID '%s' - must be an integer", http.StatusBadRequest)
+	MsgESSharedSourceUnsupported                   = ffe("FF00280", "The event stream runtime does not support shared sources", http.StatusBadRequest)
+	MsgESReplayUnsupported                         = ffe("FF00281", "The event stream runtime does not support replaying events", http.StatusBadRequest)
+	MsgESInvalidReplayRange                        = ffe("FF00282", "Invalid replay range from '%s' to '%s' - the end must be after the start", http.StatusBadRequest)
+	MsgBatchRequestCount                           = ffe("FF00283", "A batch must contain between 1 and %d requests, but contained %d", http.StatusBadRequest)
+	MsgBatchRequestInvalid                         = ffe("FF00284", "Invalid method '%s' or path '%s' for a request in a batch", http.StatusBadRequest)
+	MsgBatchRequestSkipped                         = ffe("FF00285", "Not attempted, as an earlier request in the sequential batch failed", http.StatusFailedDependency)
+	MsgFFIDiffMissing                              = ffe("FF00286", "Both the old and the new FFI are required for a comparison", http.StatusBadRequest)
+	MsgInvalidTrustedProxy                         = ffe("FF00287", "Invalid trusted proxy '%s' - must be an IP address or CIDR")
+	MsgInvalidTLSPinnedPublicKey                   = ffe("FF00288", "Invalid pinned public key '%s' - must be a base64 encoded SHA-256 hash, optionally prefixed with 'sha256/'")
+	MsgTLSPinningOnlyWithoutPins                   = ffe("FF00289", "TLS pinningOnly requires at least one pinned public key")
+	MsgTLSPinnedPublicKeyMismatch                  = ffe("FF00290", "No certificate presented matches a pinned public key: expected one of %v, seen %v")
+	MsgDurationInvalid                             = ffe("FF00291", "Invalid duration '%s' - must be a duration with units such as '30s' or '1m30s', or a number of units of %s", 400)
+	MsgDurationNegative                            = ffe("FF00292", "Invalid duration '%s' - must not be negative", 400)
+	MsgInvalidConfigValue                          = ffe("FF00293", "Invalid value for config key '%s'")
+	MsgESTailUnsupported                           = ffe("FF00294", "The event stream runtime does not support tailing events", http.StatusBadRequest)
+	MsgESInvalidTailCount                          = ffe("FF00295", "Invalid number of events to tail %d - must be between 1 and %d", http.StatusBadRequest)
+	MsgServerBusy                                  = ffe("FF00296", "The %s server is already processing the maximum of %d concurrent requests", http.StatusServiceUnavailable)
+	MsgFFIInvalidParamName                         = ffe("FF00297", "Invalid param name '%s' - must be a letter, '_' or '$', followed by letters, digits, '_' or '$'", http.StatusBadRequest)
+	MsgFFIParamInvalid                             = ffe("FF00298", "Invalid param %d of %s", http.StatusBadRequest)
+	MsgFFIDuplicateParamName                       = ffe("FF00299", "Duplicate param name '%s' in %s", http.StatusBadRequest)
+	MsgRESTHostBusy                                = ffe("FF00300", "Too many concurrent requests to host '%s' (limit=%d)", http.StatusServiceUnavailable)
+	MsgDBTimestampsUnsupported                     = ffe("FF00301", "Database timestamps for collection '%s' are not supported by the '%s' database provider")
+	MsgESResumeUnsupported                         = ffe("FF00302", "Resuming WebSocket consumers from an offset is not supported by this event stream runtime", http.StatusBadRequest)
+	MsgESResumeNotAllowed                          = ffe("FF00303", "Event stream '%s' does not allow consumers to resume from an offset")
+	MsgESResumeBehindCheckpoint                    = ffe("FF00304", "Resume offset '%s' is behind the committed checkpoint '%s' of event stream '%s'")
+	MsgInvalidHexBytes                             = ffe("FF00305", "Invalid hex value '%s': %s", http.StatusBadRequest)
+	MsgInvalidHexBytesLength                       = ffe("FF00306", "Byte length must be %d (%d hex characters) but was %d", http.StatusBadRequest)
+	MsgESDuplicateWSTopic                          = ffe("FF00307", "WebSocket topic '%s' is already used by event stream '%s'", http.StatusConflict)
+	MsgDebugEndpointsRequireAuth                   = ffe("FF00308", "Debug endpoints cannot be enabled on server '%s' without an auth plugin")
+	MsgDebugPathConflict                           = ffe("FF00309", "Debug path '%s' on server '%s' must be a non-root path that is not served by another route")
+	MsgESExclusiveSourceConflict                   = ffe("FF00310", "Event stream '%s' is already started on exclusive source '%s'", http.StatusConflict)
+	MsgInvalidQueryParam                           = ffe("FF00311", "Invalid value '%s' for query parameter '%s' (expected %s)", http.StatusBadRequest)
+	MsgMissingQueryParam                           = ffe("FF00312", "Missing required query parameter '%s'", http.StatusBadRequest)
+	MsgDBMissingContextScope                       = ffe("FF00313", "No scope found in the context for collection '%s'")
+	MsgDBContextScopeColumn                        = ffe("FF00314", "Scope column '%s' is not a column of collection '%s'")
+	MsgSchemaCompileFailed                         = ffe("FF00315", "Failed to compile schema: %s", http.StatusBadRequest)
+	MsgSchemaValidationFailed                      = ffe("FF00316", "Value does not match schema: %s", http.StatusBadRequest)
+	MsgDBNotifyFailed                              = ffe("FF00317", "Database change notification failed")
+	MsgESMaxInFlightUnsupported                    = ffe("FF00318", "maxInFlightBatches cannot be more than 1 for a websocket event stream, as consumers acknowledge one batch at a time", http.StatusBadRequest)
+	MsgESCatchupOnlyUnsupported                    = ffe("FF00319", "The event stream runtime does not support catchupOnly streams", http.StatusBadRequest)
+	MsgESCatchupOnlySharedSource                   = ffe("FF00320", "A catchupOnly event stream cannot use a sharedSource", http.StatusBadRequest)
+	MsgESCompleted                                 = ffe("FF00321", "Event stream has completed, and cannot be started", http.StatusConflict)
+	MsgStaticPathPrefixRequired                    = ffe("FF00322", "A path prefix is required to serve static files, such as '/' to serve them from the root")
+	MsgESImportInvalidRecord                       = ffe("FF00323", "Event stream record %d cannot be imported, as the stream must have an ID and any checkpoint the same ID", http.StatusBadRequest)
+	MsgWSDropPolicyReceiveExt                      = ffe("FF00324", "WebSocket receive overflow policy '%s' cannot be used with ReceiveExt, as payloads are streamed to the consumer in turn")
+	MsgESReplayExclusiveSource                     = ffe("FF00325", "Events cannot be replayed from exclusive source '%s', as it only allows one reader", http.StatusBadRequest)
 )
@@ -39,7 +39,17 @@ var (
 	FilterJSONNIn                = ffm("FilterJSON.nin", "Shortcut for in with all conditions negated (the not property of all children is overridden)")
 	FilterJSONLimit              = ffm("FilterJSON.limit", "Limit on the results to return")
 	FilterJSONSkip               = ffm("FilterJSON.skip", "Number of results to skip before returning entries, for skip+limit based pagination")
-	FilterJSONSort               = ffm("FilterJSON.sort", "Array of fields to sort by. A '-' prefix on a field requests that field is sorted in descending order")
+	FilterJSONSort               = ffm("FilterJSON.sort", "Array of fields to sort by, in priority order. A '-' prefix, or a ' desc' suffix, on a field requests that field is sorted in descending order")
 	FilterJSONCount              = ffm("FilterJSON.count", "If true, the total number of entries that could be returned from the database will be calculated and returned as a 'total' (has a performance cost)")
 	FilterJSONOr                 = ffm("FilterJSON.or", "Array of sub-queries where any sub-query can match to return results (OR combined). Note that within each sub-query all filters must match (AND combined)")
+
+	BatchRequestSequential = ffm("BatchRequest.sequential", "If true, the requests are made in order, and any after the first to fail are not attempted. Otherwise the requests are made in parallel, and each succeeds or fails independently")
+	BatchRequestRequests   = ffm("BatchRequest.requests", "The requests to make")
+	BatchSubRequestMethod  = ffm("BatchSubRequest.method", "The HTTP method of the request")
+	BatchSubRequestPath    = ffm("BatchSubRequest.path", "The path of the request, relative to the base path of the API, including any query string")
+	BatchSubRequestHeaders = ffm("BatchSubRequest.headers", "HTTP headers for the request, in addition to those of the batch request")
+	BatchSubRequestBody    = ffm("BatchSubRequest.body", "The JSON body of the request")
+	BatchResponseResponses = ffm("BatchResponse.responses", "The response to each request, in the same order as the requests")
+	BatchSubResponseStatus = ffm("BatchSubResponse.status", "The HTTP status code of the response")
+	BatchSubResponseBody   = ffm("BatchSubResponse.body", "The body of the response, including the error for a failed request")
 )
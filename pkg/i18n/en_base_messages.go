@@ -27,14 +27,19 @@ var ffm = func(key, translation string) MessageKey {
 var (
 	APISuccessResponse      = ffm("api.success", "Success")
 	APIRequestTimeoutDesc   = ffm("api.requestTimeout", "Server-side request timeout (milliseconds, or set a custom suffix like 10s)")
+	APILastEventIDDesc      = ffm("api.lastEventID", "The ID of the last event received, to resume the stream of server-sent events after it")
 	APIFilterParamDesc      = ffm("api.filterParam", "Data filter field. Prefixes supported: > >= < <= @ ^ ! !@ !^")
 	APIFilterSortDesc       = ffm("api.filterSort", "Sort field. For multi-field sort use comma separated values (or multiple query values) with '-' prefix for descending")
 	APIFilterAscendingDesc  = ffm("api.filterAscending", "Ascending sort order (overrides all fields in a multi-field sort)")
 	APIFilterDescendingDesc = ffm("api.filterDescending", "Descending sort order (overrides all fields in a multi-field sort)")
 	APIFilterSkipDesc       = ffm("api.filterSkip", "The number of records to skip (max: %d). Unsuitable for bulk operations")
 	APIFilterLimitDesc      = ffm("api.filterLimit", "The maximum number of records to return (max: %d)")
-	APIFilterCountDesc      = ffm("api.filterCount", "Return a total count as well as items (adds extra database processing)")
+	APIFilterCountDesc      = ffm("api.filterCount", "Return a total count as well as items (adds extra database processing). Set to 'approximate' to accept an estimate, where the database supports one")
 	APIFilterFieldsDesc     = ffm("api.filterFields", "Comma separated list of fields to return")
+	APIDeprecatedDesc       = ffm("api.deprecated", "Deprecated: %s")
+	APISunsetDesc           = ffm("api.sunset", "This operation might be removed after %s")
+	APIBatchDesc            = ffm("api.batch", "Calls multiple operations of this API in a single request, returning the status and body of each")
+	APILinksDesc            = ffm("api.links", "Links to this resource and related resources, keyed by the relation of each link")
 
 	ResourceBaseID      = ffm("ResourceBase.id", "The UUID of the service")
 	ResourceBaseCreated = ffm("ResourceBase.created", "The time the resource was created")
@@ -0,0 +1,109 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrorCodeInfo is the metadata registered against an error code, that is used to
+// consistently handle errors with that code regardless of where they are raised
+type ErrorCodeInfo struct {
+	// HTTPStatus is the status returned by the API server for errors with this code
+	HTTPStatus int
+	// Retryable is true if the failure is transient, so the same request might succeed if retried
+	Retryable bool
+}
+
+var errorCodes = map[string]ErrorCodeInfo{}
+var errorCodesMux sync.RWMutex
+
+var errorCodeExtractor = regexp.MustCompile(`^([A-Z][A-Z]\d+):`)
+
+// By default, errors are retryable if the status is one that indicates a transient failure
+func defaultRetryable(httpStatus int) bool {
+	switch httpStatus {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func setErrorCode(key string, httpStatus int, retryable bool) {
+	errorCodesMux.Lock()
+	defer errorCodesMux.Unlock()
+	errorCodes[key] = ErrorCodeInfo{
+		HTTPStatus: httpStatus,
+		Retryable:  retryable,
+	}
+}
+
+// RegisterErrorCode allows applications to register the HTTP status, and whether errors are retryable,
+// for error codes they have defined with FFE.
+// Codes using the `FF00` prefix belong to this package, and have their status set where they are defined.
+//
+// This should be called during initialization, before any errors with the code are handled.
+func RegisterErrorCode(key ErrorMessageKey, httpStatus int, retryable bool) {
+	if strings.HasPrefix(string(key), "FF00") {
+		panic(fmt.Sprintf("cannot register reserved error code %q", key))
+	}
+	if httpStatus < 400 || httpStatus > 599 {
+		panic(fmt.Sprintf("invalid HTTP status %d for error code %q", httpStatus, key))
+	}
+	setErrorCode(string(key), httpStatus, retryable)
+}
+
+// GetErrorCodeInfo returns the information registered for an error code
+func GetErrorCodeInfo(code string) (ErrorCodeInfo, bool) {
+	errorCodesMux.RLock()
+	defer errorCodesMux.RUnlock()
+	info, ok := errorCodes[code]
+	return info, ok
+}
+
+// ErrorCode returns the error code of an error, either from the message key of an FFError
+// in the chain, or from the code prefixing the error message
+func ErrorCode(err error) (string, bool) {
+	var ffe FFError
+	if errors.As(err, &ffe) {
+		return string(ffe.MessageKey()), true
+	}
+	if err != nil {
+		if match := errorCodeExtractor.FindStringSubmatch(err.Error()); match != nil {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// IsRetryable returns true if the error has a code that is registered as retryable
+func IsRetryable(err error) bool {
+	if code, ok := ErrorCode(err); ok {
+		info, _ := GetErrorCodeInfo(code)
+		return info.Retryable
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+var (
+	TestAppError1 = func() ErrorMessageKey {
+		RegisterPrefix("TE01", "Test error codes")
+		return FFE(language.AmericanEnglish, "TE01001", "Test app error 1")
+	}()
+	TestAppError2 = FFE(language.AmericanEnglish, "TE01002", "Test app error 2", http.StatusConflict)
+)
+
+func TestErrorCodeInfoDefaults(t *testing.T) {
+	info, ok := GetErrorCodeInfo(string(MsgServerDraining))
+	assert.True(t, ok)
+	assert.Equal(t, ErrorCodeInfo{HTTPStatus: http.StatusServiceUnavailable, Retryable: true}, info)
+
+	info, ok = GetErrorCodeInfo(string(MsgUnknownFieldValue))
+	assert.True(t, ok)
+	assert.Equal(t, ErrorCodeInfo{HTTPStatus: http.StatusBadRequest, Retryable: false}, info)
+
+	_, ok = GetErrorCodeInfo(string(MsgDBQueryFailed))
+	assert.False(t, ok)
+}
+
+func TestRegisterErrorCode(t *testing.T) {
+	err := NewError(context.Background(), TestAppError1)
+	assert.Equal(t, http.StatusInternalServerError, err.(FFError).HTTPStatus())
+	assert.False(t, IsRetryable(err))
+
+	// Registration applies to errors already created
+	RegisterErrorCode(TestAppError1, http.StatusServiceUnavailable, false)
+	assert.Equal(t, http.StatusServiceUnavailable, err.(FFError).HTTPStatus())
+	assert.False(t, IsRetryable(err))
+
+	RegisterErrorCode(TestAppError2, http.StatusConflict, true)
+	err = NewError(context.Background(), TestAppError2)
+	assert.Equal(t, http.StatusConflict, err.(FFError).HTTPStatus())
+	assert.True(t, IsRetryable(err))
+	assert.True(t, IsRetryable(fmt.Errorf("TE01002: raised outside of i18n")))
+
+	assert.Panics(t, func() {
+		RegisterErrorCode(MsgConfigFailed, http.StatusBadRequest, false)
+	})
+
+	// Codes of other FireFly components can be registered
+	RegisterErrorCode("FF10999", http.StatusConflict, false)
+	info, ok := GetErrorCodeInfo("FF10999")
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusConflict, info.HTTPStatus)
+	assert.Panics(t, func() {
+		RegisterErrorCode(TestAppError2, http.StatusOK, false)
+	})
+}
+
+func TestErrorCode(t *testing.T) {
+	code, ok := ErrorCode(NewError(context.Background(), MsgConfigFailed))
+	assert.True(t, ok)
+	assert.Equal(t, string(MsgConfigFailed), code)
+
+	code, ok = ErrorCode(fmt.Errorf("wrapped: %w", NewError(context.Background(), MsgServerDraining, "api")))
+	assert.True(t, ok)
+	assert.Equal(t, string(MsgServerDraining), code)
+
+	code, ok = ErrorCode(fmt.Errorf("FF00165: from the message"))
+	assert.True(t, ok)
+	assert.Equal(t, "FF00165", code)
+
+	_, ok = ErrorCode(fmt.Errorf("pop"))
+	assert.False(t, ok)
+	_, ok = ErrorCode(nil)
+	assert.False(t, ok)
+	assert.False(t, IsRetryable(fmt.Errorf("pop")))
+}
@@ -18,13 +18,24 @@ package i18n
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 )
 
+var stackCaptureDisabled atomic.Bool
+
+// SetStackCapture enables or disables capturing the call stack where each error is created (enabled by default).
+// Only the program counters are captured, and they are resolved to functions and lines if the stack trace is
+// requested - but applications creating errors on hot paths, that do not log the stack, can disable it.
+func SetStackCapture(enabled bool) {
+	stackCaptureDisabled.Store(!enabled)
+}
+
 func truncate(s string, limit int) string {
 	if len(s) > limit {
 		return s[0:limit-3] + "..."
@@ -43,20 +54,30 @@ type stackTracer interface {
 	StackTrace() errors.StackTrace
 }
 
+// ffError is the message of the error, wrapping the cause if there is one, and the stack if captured.
+// It unwraps to the cause, so errors.Is and errors.As work through the layers of wrapped errors.
 type ffError struct {
 	error
 	msgKey ErrorMessageKey
-	status int
+}
+
+func (ffe *ffError) Unwrap() error {
+	return ffe.error
 }
 
 func (ffe *ffError) MessageKey() ErrorMessageKey {
 	return ffe.msgKey
 }
 
+// HTTPStatus returns the status registered for the error code, or 500 if none is registered
 func (ffe *ffError) HTTPStatus() int {
-	return ffe.status
+	if status, ok := GetStatusHint(string(ffe.msgKey)); ok {
+		return status
+	}
+	return http.StatusInternalServerError
 }
 
+// StackTrace returns the stack where the error was created, or an empty string if stack capture was disabled
 func (ffe *ffError) StackTrace() string {
 	if st, ok := interface{}(ffe.error).(stackTracer); ok {
 		buff := new(strings.Builder)
@@ -69,26 +90,29 @@ func (ffe *ffError) StackTrace() string {
 }
 
 func ffWrap(err error, msgKey ErrorMessageKey) error {
-	status, ok := statusHints[string(msgKey)]
-	if !ok {
-		status = http.StatusInternalServerError
-	}
 	return &ffError{
 		error:  err,
 		msgKey: msgKey,
-		status: status,
 	}
 }
 
 // NewError creates a new error
 func NewError(ctx context.Context, msg ErrorMessageKey, inserts ...interface{}) error {
-	return ffWrap(errors.Errorf(truncate(ExpandWithCode(ctx, MessageKey(msg), inserts...), 2048)), msg)
+	err := stderrors.New(truncate(ExpandWithCode(ctx, MessageKey(msg), inserts...), 2048))
+	if !stackCaptureDisabled.Load() {
+		err = errors.WithStack(err)
+	}
+	return ffWrap(err, msg)
 }
 
-// WrapError wraps an error
+// WrapError wraps an error, which is appended to the message and returned by errors.Unwrap
 func WrapError(ctx context.Context, err error, msg ErrorMessageKey, inserts ...interface{}) error {
 	if err == nil {
 		return NewError(ctx, msg, inserts...)
 	}
-	return ffWrap(errors.Wrap(err, truncate(ExpandWithCode(ctx, MessageKey(msg), inserts...), 2048)), msg)
+	err = errors.WithMessage(err, truncate(ExpandWithCode(ctx, MessageKey(msg), inserts...), 2048))
+	if !stackCaptureDisabled.Load() {
+		err = errors.WithStack(err)
+	}
+	return ffWrap(err, msg)
 }
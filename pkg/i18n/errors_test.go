@@ -18,6 +18,7 @@ package i18n
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -65,3 +66,50 @@ func TestStackWithDebug(t *testing.T) {
 	err := WrapError(context.Background(), nil, MsgConfigFailed)
 	assert.Error(t, err)
 }
+
+type testCauseError struct{ detail string }
+
+func (e *testCauseError) Error() string { return e.detail }
+
+func TestWrapErrorUnwrap(t *testing.T) {
+	ctx := context.Background()
+	cause := &testCauseError{detail: "some error"}
+	inner := WrapError(ctx, cause, MsgConfigFailed)
+	outer := WrapError(ctx, inner, MsgUnknownFieldValue, "field", "value")
+	assert.Equal(t, "FF00111: Unknown field 'value': FF00101: Failed to read config: some error", outer.Error())
+
+	assert.True(t, errors.Is(outer, cause))
+	assert.True(t, errors.Is(outer, inner))
+	var ce *testCauseError
+	assert.True(t, errors.As(outer, &ce))
+	assert.Equal(t, "some error", ce.detail)
+
+	// The outermost FFError is found first, and the inner one by unwrapping it
+	var ffe FFError
+	assert.True(t, errors.As(outer, &ffe))
+	assert.Equal(t, MsgUnknownFieldValue, ffe.MessageKey())
+	assert.True(t, errors.As(errors.Unwrap(outer), &ffe))
+	assert.Equal(t, MsgConfigFailed, ffe.MessageKey())
+
+	assert.False(t, errors.Is(NewError(ctx, MsgConfigFailed), cause))
+}
+
+func TestStackCaptureDisabled(t *testing.T) {
+	ctx := context.Background()
+	SetStackCapture(false)
+	defer SetStackCapture(true)
+
+	err := NewError(ctx, MsgConfigFailed)
+	assert.Empty(t, err.(FFError).StackTrace())
+	assert.Equal(t, "FF00101: Failed to read config", err.Error())
+
+	cause := fmt.Errorf("some error")
+	err = WrapError(ctx, cause, MsgConfigFailed)
+	assert.Empty(t, err.(FFError).StackTrace())
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "FF00101: Failed to read config: some error", err.Error())
+
+	SetStackCapture(true)
+	err = NewError(ctx, MsgConfigFailed)
+	assert.Contains(t, err.(FFError).StackTrace(), "TestStackCaptureDisabled")
+}
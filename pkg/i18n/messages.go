@@ -64,7 +64,6 @@ type (
 	ctxLangKey struct{}
 )
 
-var statusHints = map[string]int{}
 var fieldTypes = map[string]string{}
 var msgIDUniq = map[string]bool{}
 
@@ -106,7 +105,7 @@ func FFE(language language.Tag, key, translation string, statusHint ...int) Erro
 	}
 	msgID := FFM(language, key, translation)
 	if len(statusHint) > 0 {
-		statusHints[key] = statusHint[0]
+		setErrorCode(key, statusHint[0], defaultRetryable(statusHint[0]))
 	}
 	return ErrorMessageKey(msgID)
 }
@@ -154,8 +153,8 @@ func SetLang(lang string) {
 }
 
 func GetStatusHint(code string) (int, bool) {
-	i, ok := statusHints[code]
-	return i, ok
+	info, ok := GetErrorCodeInfo(code)
+	return info.HTTPStatus, ok
 }
 
 func GetFieldType(code string) (string, bool) {
@@ -0,0 +1,104 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultLatencyBuckets are the upper bounds in seconds used for latency histograms without explicit buckets,
+// covering fast local operations through to slow remote deliveries
+var DefaultLatencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// ExponentialBuckets returns count buckets, where the lowest is start and each is factor times the previous.
+// Panics if count is less than 1, start is not positive, or factor is not greater than 1.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	return prometheus.ExponentialBuckets(start, factor, count)
+}
+
+// ExponentialBucketsRange returns count buckets spread exponentially from minBucket to maxBucket.
+// Panics if count is less than 2, or minBucket is not positive.
+func ExponentialBucketsRange(minBucket, maxBucket float64, count int) []float64 {
+	return prometheus.ExponentialBucketsRange(minBucket, maxBucket, count)
+}
+
+// LinearBuckets returns count buckets, where the lowest is start and each is width larger than the previous.
+// Panics if count is less than 1.
+func LinearBuckets(start, width float64, count int) []float64 {
+	return prometheus.LinearBuckets(start, width, count)
+}
+
+// LatencyHistogramOptions configure a histogram created with NewLatencyHistogramMetric
+type LatencyHistogramOptions struct {
+	// Buckets are the upper bounds in seconds, with DefaultLatencyBuckets used if nil
+	Buckets []float64
+	// NativeHistogramBucketFactor additionally exposes a Prometheus native histogram (to scrapes that
+	// use the protobuf format) when greater than 1. Lower values give a higher resolution, such as 1.1
+	NativeHistogramBucketFactor float64
+}
+
+// LatencyTimer observes durations in seconds on a histogram. A LatencyTimer for a metric that
+// failed to register (which is logged) does nothing, so it is always safe to use.
+type LatencyTimer struct {
+	histogram  *prometheus.HistogramVec
+	labelNames []string
+}
+
+// ObserveSince records the time since start, for a histogram without labels
+func (lt *LatencyTimer) ObserveSince(start time.Time) {
+	lt.ObserveSinceWithLabels(context.Background(), start, map[string]string{}, nil)
+}
+
+// ObserveSinceWithLabels records the time since start with the supplied labels
+func (lt *LatencyTimer) ObserveSinceWithLabels(ctx context.Context, start time.Time, labels map[string]string, defaultLabels *FireflyDefaultLabels) {
+	if lt == nil || lt.histogram == nil {
+		return
+	}
+	lt.histogram.With(checkAndUpdateLabels(ctx, lt.labelNames, labels, defaultLabels)).Observe(time.Since(start).Seconds())
+}
+
+func (pmm *prometheusMetricsManager) NewLatencyHistogramMetric(ctx context.Context, metricName string, helpText string, opts LatencyHistogramOptions, withDefaultLabels bool) *LatencyTimer {
+	return pmm.NewLatencyHistogramMetricWithLabels(ctx, metricName, helpText, opts, []string{}, withDefaultLabels)
+}
+
+func (pmm *prometheusMetricsManager) NewLatencyHistogramMetricWithLabels(ctx context.Context, metricName string, helpText string, opts LatencyHistogramOptions, labelNames []string, withDefaultLabels bool) *LatencyTimer {
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets = DefaultLatencyBuckets
+	}
+	if _, exists := pmm.metricsMap[metricName+"_histogramVec"]; !exists {
+		pmm.registerMetrics(ctx, regInfo{
+			Type:                        "histogramVec",
+			Name:                        metricName,
+			HelpText:                    helpText,
+			Buckets:                     buckets,
+			NativeHistogramBucketFactor: opts.NativeHistogramBucketFactor,
+			LabelNames:                  checkAndUpdateLabelNames(ctx, labelNames, withDefaultLabels),
+		})
+	}
+	m, ok := pmm.metricsMap[metricName+"_histogramVec"]
+	if !ok {
+		return &LatencyTimer{}
+	}
+	return &LatencyTimer{
+		histogram:  m.Metric.(*prometheus.HistogramVec),
+		labelNames: m.LabelNames,
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHistogram(t *testing.T, registry *prometheus.Registry, name string) *dto.Histogram {
+	mfs, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return mf.Metric[0].GetHistogram()
+		}
+	}
+	return nil
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	mr := NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry})
+	mm, err := mr.NewMetricsManagerForSubsystem(ctx, "tm")
+	assert.NoError(t, err)
+
+	timer := mm.NewLatencyHistogramMetric(ctx, "tx_seconds", "Duration of transactions", LatencyHistogramOptions{}, false)
+	timer.ObserveSince(time.Now().Add(-2 * time.Second))
+	h := getHistogram(t, registry, "ff_tm_tx_seconds")
+	assert.Equal(t, uint64(1), h.GetSampleCount())
+	assert.Len(t, h.Bucket, len(DefaultLatencyBuckets))
+	assert.GreaterOrEqual(t, h.GetSampleSum(), 2.0)
+
+	timer = mm.NewLatencyHistogramMetricWithLabels(ctx, "stage_seconds", "Duration of stages", LatencyHistogramOptions{
+		Buckets:                     ExponentialBuckets(0.01, 10, 3),
+		NativeHistogramBucketFactor: 1.1,
+	}, []string{"stage"}, true)
+	timer.ObserveSinceWithLabels(ctx, time.Now(), map[string]string{"stage": "submit"}, &FireflyDefaultLabels{Namespace: "ns1"})
+	h = getHistogram(t, registry, "ff_tm_stage_seconds")
+	assert.Equal(t, uint64(1), h.GetSampleCount())
+	assert.Len(t, h.Bucket, 3)
+	assert.Equal(t, 0.01, h.Bucket[0].GetUpperBound())
+	assert.NotZero(t, h.GetSchema()) // native histogram
+
+	// Redefining returns a timer for the existing metric
+	timer = mm.NewLatencyHistogramMetricWithLabels(ctx, "stage_seconds", "Duration of stages", LatencyHistogramOptions{}, []string{"stage"}, true)
+	timer.ObserveSinceWithLabels(ctx, time.Now(), map[string]string{"stage": "submit"}, &FireflyDefaultLabels{Namespace: "ns1"})
+	assert.Equal(t, uint64(2), getHistogram(t, registry, "ff_tm_stage_seconds").GetSampleCount())
+
+	// Metrics that fail to register are no-ops
+	timer = mm.NewLatencyHistogramMetric(ctx, "!bad", "Invalid name", LatencyHistogramOptions{}, false)
+	timer.ObserveSince(time.Now())
+	var nilTimer *LatencyTimer
+	nilTimer.ObserveSince(time.Now())
+}
+
+func TestBucketHelpers(t *testing.T) {
+	assert.Equal(t, []float64{1, 2, 4}, ExponentialBuckets(1, 2, 3))
+	assert.Equal(t, []float64{1, 10, 100}, ExponentialBucketsRange(1, 100, 3))
+	assert.Equal(t, []float64{1, 3, 5}, LinearBuckets(1, 2, 3))
+}
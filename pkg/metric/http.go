@@ -0,0 +1,163 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	httpLabelCode   = "code"
+	httpLabelMethod = "method"
+	httpLabelHost   = "host"
+	httpLabelRoute  = "route"
+)
+
+var httpLabelNames = []string{httpLabelCode, httpLabelMethod, httpLabelHost, httpLabelRoute}
+
+// httpInstrumentation records the predefined HTTP metrics of a subsystem, with the request duration
+// observed by a LatencyTimer
+type httpInstrumentation struct {
+	useRouteTemplate bool
+	reqTotal         *prometheus.CounterVec
+	reqSizeBytes     *prometheus.SummaryVec
+	reqDuration      *LatencyTimer
+	resSizeBytes     *prometheus.SummaryVec
+}
+
+func newHTTPInstrumentation(useRouteTemplate bool, namespace, subsystem string, reqDurationBuckets []float64, labels map[string]string, registerer prometheus.Registerer) *httpInstrumentation {
+	hi := &httpInstrumentation{
+		useRouteTemplate: useRouteTemplate,
+		reqTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "requests_total",
+			Help:      "The total number of requests received",
+		}, httpLabelNames),
+		reqSizeBytes: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "request_size_bytes",
+			Help:      "Summary of request bytes received",
+		}, httpLabelNames),
+		reqDuration: &LatencyTimer{
+			histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "request_duration_seconds",
+				Help:      "Histogram of the request duration",
+				Buckets:   reqDurationBuckets,
+			}, httpLabelNames),
+			labelNames: httpLabelNames,
+		},
+		resSizeBytes: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "response_size_bytes",
+			Help:      "Summary of response bytes sent",
+		}, httpLabelNames),
+	}
+	prometheus.WrapRegistererWith(labels, registerer).MustRegister(
+		hi.reqTotal,
+		hi.reqSizeBytes,
+		hi.reqDuration.histogram,
+		hi.resSizeBytes,
+	)
+	return hi
+}
+
+func (hi *httpInstrumentation) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := &statusResponseWriter{ResponseWriter: res}
+		next.ServeHTTP(sw, req)
+
+		labels := map[string]string{
+			httpLabelCode:   strconv.Itoa(sw.status),
+			httpLabelMethod: req.Method,
+			httpLabelHost:   req.Host,
+			httpLabelRoute:  hi.route(req),
+		}
+		hi.reqTotal.With(labels).Inc()
+		hi.reqSizeBytes.With(labels).Observe(float64(estimateRequestSize(req)))
+		hi.resSizeBytes.With(labels).Observe(float64(sw.size))
+		hi.reqDuration.ObserveSinceWithLabels(req.Context(), start, labels, nil)
+	})
+}
+
+func (hi *httpInstrumentation) route(req *http.Request) string {
+	if hi.useRouteTemplate {
+		if route := mux.CurrentRoute(req); route != nil {
+			template, _ := route.GetPathTemplate()
+			return template
+		}
+		return ""
+	}
+	return req.RequestURI
+}
+
+func estimateRequestSize(req *http.Request) int64 {
+	// the request line, with two spaces and a CRLF
+	size := int64(len(req.Method) + len(req.URL.Path) + len(req.Proto) + 4)
+	for name, values := range req.Header {
+		size += int64(len(name))
+		for _, v := range values {
+			size += int64(len(v))
+		}
+		size += 2
+	}
+	if req.ContentLength > 0 {
+		size += req.ContentLength
+	}
+	return size
+}
+
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (sw *statusResponseWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusResponseWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(b)
+	sw.size += n
+	return n, err
+}
+
+func (sw *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+	return h.Hijack()
+}
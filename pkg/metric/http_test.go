@@ -0,0 +1,129 @@
+// Copyright © 2024 Kaleido, Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metric
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func gatherHTTPMetrics(t *testing.T, registry *prometheus.Registry) map[string]*dto.MetricFamily {
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	byName := map[string]*dto.MetricFamily{}
+	for _, f := range families {
+		byName[f.GetName()] = f
+	}
+	return byName
+}
+
+func TestHTTPInstrumentationMiddleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ctx := context.Background()
+	mr := NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry})
+	err := mr.NewHTTPMetricsInstrumentationsForSubsystem(ctx, "api", true, ExponentialBuckets(0.01, 10, 3), map[string]string{"app": "ut"})
+	assert.NoError(t, err)
+	middleware, err := mr.GetHTTPMetricsInstrumentationsMiddlewareForSubsystem(ctx, "api")
+	assert.NoError(t, err)
+
+	r := mux.NewRouter()
+	r.Use(middleware)
+	r.HandleFunc("/things/{id}", func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte("thing"))
+	})
+	r.HandleFunc("/missing", func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusNotFound)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/things/1", strings.NewReader("body"))
+	req.Header.Set("Accept", "text/plain")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/2", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	families := gatherHTTPMetrics(t, registry)
+	requests := families["ff_api_requests_total"].GetMetric()
+	assert.Len(t, requests, 2)
+	labels := map[string]string{}
+	for _, l := range requests[0].GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	assert.Equal(t, map[string]string{
+		"app":          "ut",
+		"ff_component": "test",
+		"code":         "200",
+		"host":         "example.com",
+		"method":       "GET",
+		"route":        "/things/{id}",
+	}, labels)
+	assert.Equal(t, float64(2), requests[0].GetCounter().GetValue())
+
+	duration := families["ff_api_request_duration_seconds"].GetMetric()[0].GetHistogram()
+	assert.Equal(t, uint64(2), duration.GetSampleCount())
+	assert.Len(t, duration.GetBucket(), 3)
+	assert.Equal(t, float64(10), families["ff_api_response_size_bytes"].GetMetric()[0].GetSummary().GetSampleSum())
+	assert.Equal(t, float64(1), families["ff_api_requests_total"].GetMetric()[1].GetCounter().GetValue())
+}
+
+func TestHTTPInstrumentationRequestURI(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	hi := newHTTPInstrumentation(false, "ff", "api", nil, nil, registry)
+	handler := hi.middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _, err := res.(http.Hijacker).Hijack()
+		assert.Regexp(t, "hijack not supported", err)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/1?q=1", nil))
+	// outside of a mux router there is no route template
+	assert.Empty(t, (&httpInstrumentation{useRouteTemplate: true}).route(httptest.NewRequest(http.MethodGet, "/", nil)))
+
+	families := gatherHTTPMetrics(t, registry)
+	for _, l := range families["ff_api_requests_total"].GetMetric()[0].GetLabel() {
+		if l.GetName() == "route" {
+			assert.Equal(t, "/things/1?q=1", l.GetValue())
+		}
+	}
+}
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (hr *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hr.hijacked = true
+	return nil, nil, nil
+}
+
+func TestHTTPInstrumentationHijack(t *testing.T) {
+	hi := newHTTPInstrumentation(true, "ff", "api", nil, nil, prometheus.NewRegistry())
+	handler := hi.middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _, err := res.(http.Hijacker).Hijack()
+		assert.NoError(t, err)
+	}))
+	res := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.True(t, res.hijacked)
+}
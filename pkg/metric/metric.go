@@ -23,10 +23,10 @@ import (
 	"sync"
 
 	"github.com/hyperledger/firefly-common/pkg/i18n"
+	"github.com/hyperledger/firefly-common/pkg/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	muxprom "gitlab.com/hfuss/mux-prometheus/pkg/middleware"
 )
 
 var allowedNameStringRegex = `^[a-zA-Z]+[a-zA-Z0-9_]*[a-zA-Z0-9]$`
@@ -76,6 +76,9 @@ type MetricsManager interface {
 	NewHistogramMetricWithLabels(ctx context.Context, metricName string, helpText string, buckets []float64, labelNames []string, withDefaultLabels bool)
 	NewSummaryMetric(ctx context.Context, metricName string, helpText string, withDefaultLabels bool)
 	NewSummaryMetricWithLabels(ctx context.Context, metricName string, helpText string, labelNames []string, withDefaultLabels bool)
+	// NewLatencyHistogramMetric defines a histogram of durations in seconds, and returns a timer to observe it
+	NewLatencyHistogramMetric(ctx context.Context, metricName string, helpText string, opts LatencyHistogramOptions, withDefaultLabels bool) *LatencyTimer
+	NewLatencyHistogramMetricWithLabels(ctx context.Context, metricName string, helpText string, opts LatencyHistogramOptions, labelNames []string, withDefaultLabels bool) *LatencyTimer
 
 	// functions for emitting metrics
 	SetGaugeMetric(ctx context.Context, metricName string, number float64, defaultLabels *FireflyDefaultLabels)
@@ -86,22 +89,52 @@ type MetricsManager interface {
 	ObserveHistogramMetricWithLabels(ctx context.Context, metricName string, number float64, labels map[string]string, defaultLabels *FireflyDefaultLabels)
 	ObserveSummaryMetric(ctx context.Context, metricName string, number float64, defaultLabels *FireflyDefaultLabels)
 	ObserveSummaryMetricWithLabels(ctx context.Context, metricName string, number float64, labels map[string]string, defaultLabels *FireflyDefaultLabels)
+
+	// DeleteMetricsWithLabels removes the series of every metric in the subsystem that has all of the labels,
+	// such as when the resource they are labelled with is deleted - so the series are not exported forever
+	DeleteMetricsWithLabels(ctx context.Context, labels map[string]string)
+}
+
+// PrometheusRegistryOptions customize the registry created by NewPrometheusMetricsRegistryWithOptions
+type PrometheusRegistryOptions struct {
+	// Registry is an existing registry to add the metrics to. A new registry is created if nil
+	Registry *prometheus.Registry
+	// RuntimeCollectors registers the standard Go runtime (GC, goroutines, memory) and process (CPU, FDs) collectors
+	RuntimeCollectors bool
 }
 
 func NewPrometheusMetricsRegistry(fireflyComponentName string /*component name will be added to all metrics as a label*/) MetricsRegistry {
-	registry := prometheus.NewRegistry()
+	// register default cpu & go metrics by default
+	return NewPrometheusMetricsRegistryWithOptions(fireflyComponentName, PrometheusRegistryOptions{
+		RuntimeCollectors: true,
+	})
+}
+
+func NewPrometheusMetricsRegistryWithOptions(fireflyComponentName string, options PrometheusRegistryOptions) MetricsRegistry {
+	registry := options.Registry
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
 	registerer := prometheus.WrapRegistererWith(prometheus.Labels{compulsoryComponentLabel: fireflyComponentName}, registry)
 
-	// register default cpu & go metrics by default
-	registerer.MustRegister(collectors.NewGoCollector())
-	registerer.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if options.RuntimeCollectors {
+		// A registry supplied by the caller might already have its own runtime collectors
+		for _, c := range []prometheus.Collector{
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		} {
+			if err := registerer.Register(c); err != nil {
+				log.L(context.Background()).Warnf("Failed to register runtime metrics collector: %s", err)
+			}
+		}
+	}
 
 	return &prometheusMetricsRegistry{
 		namespace:                      ffMetricsPrefix,
 		registry:                       registry,
 		registerer:                     registerer,
 		managerMap:                     make(map[string]MetricsManager),
-		httpMetricsInstrumentationsMap: make(map[string]*muxprom.Instrumentation),
+		httpMetricsInstrumentationsMap: make(map[string]*httpInstrumentation),
 	}
 }
 
@@ -111,7 +144,7 @@ type prometheusMetricsRegistry struct {
 	registerer                     prometheus.Registerer
 	namespace                      string
 	managerMap                     map[string]MetricsManager
-	httpMetricsInstrumentationsMap map[string]*muxprom.Instrumentation
+	httpMetricsInstrumentationsMap map[string]*httpInstrumentation
 }
 
 // Custom prometheus metrics manager
@@ -159,15 +192,7 @@ func (pmr *prometheusMetricsRegistry) NewHTTPMetricsInstrumentationsForSubsystem
 	if _, ok := pmr.httpMetricsInstrumentationsMap[subsystem]; ok {
 		return i18n.NewError(ctx, i18n.MsgMetricsDuplicateSubsystemName, subsystem)
 	}
-	httpInstrumentation := muxprom.NewCustomInstrumentation(
-		useRouteTemplate,
-		pmr.namespace,
-		subsystem,
-		reqDurationBuckets,
-		labels,
-		pmr.registerer,
-	)
-	pmr.httpMetricsInstrumentationsMap[subsystem] = httpInstrumentation
+	pmr.httpMetricsInstrumentationsMap[subsystem] = newHTTPInstrumentation(useRouteTemplate, pmr.namespace, subsystem, reqDurationBuckets, labels, pmr.registerer)
 	return nil
 }
 
@@ -183,5 +208,5 @@ func (pmr *prometheusMetricsRegistry) GetHTTPMetricsInstrumentationsMiddlewareFo
 	if !ok {
 		return nil, i18n.NewError(ctx, i18n.MsgMetricsSubsystemHTTPInstrumentationNotFound)
 	}
-	return httpInstrumentation.Middleware, nil
+	return httpInstrumentation.middleware, nil
 }
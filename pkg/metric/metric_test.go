@@ -20,7 +20,9 @@ import (
 	"context"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -104,6 +106,35 @@ func TestMetricsManagerWithDefaultLabels(t *testing.T) {
 
 }
 
+func TestDeleteMetricsWithLabels(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mm, err := NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry}).
+		NewMetricsManagerForSubsystem(ctx, "tm")
+	assert.NoError(t, err)
+
+	mm.NewGaugeMetricWithLabels(ctx, "tx_inflight", "Transactions that are in flight", []string{"stage"}, false)
+	mm.NewHistogramMetricWithLabels(ctx, "tx_stage_seconds", "Duration of each transaction stage", []float64{}, []string{"stage"}, false)
+	mm.NewCounterMetric(ctx, "tx_request", "Transactions requests handled", false)
+	mm.SetGaugeMetricWithLabels(ctx, "tx_inflight", 2, map[string]string{"stage": "one"}, nil)
+	mm.SetGaugeMetricWithLabels(ctx, "tx_inflight", 2, map[string]string{"stage": "two"}, nil)
+	mm.ObserveHistogramMetricWithLabels(ctx, "tx_stage_seconds", 2000, map[string]string{"stage": "one"}, nil)
+	mm.IncCounterMetric(ctx, "tx_request", nil)
+
+	mm.DeleteMetricsWithLabels(ctx, map[string]string{"stage": "one"})
+	series := map[string]int{}
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, f := range families {
+		series[f.GetName()] = len(f.GetMetric())
+	}
+	assert.Equal(t, map[string]int{
+		"ff_tm_tx_inflight": 1,
+		"ff_tm_tx_request":  1,
+	}, series)
+}
+
 func TestMetricsManagerErrors(t *testing.T) {
 	mr := NewPrometheusMetricsRegistry("")
 	ctx, cancel := context.WithCancel(context.Background())
@@ -168,3 +199,29 @@ func TestHTTPMetricsInstrumentations(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, httpMiddleware)
 }
+
+func TestMetricsRegistryRuntimeCollectors(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry, RuntimeCollectors: true})
+	mfs, err := registry.Gather()
+	assert.NoError(t, err)
+	assert.True(t, hasMetricFamily(mfs, "go_goroutines"))
+
+	// Registering twice on the same registry logs rather than panics
+	NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry, RuntimeCollectors: true})
+
+	registry = prometheus.NewRegistry()
+	NewPrometheusMetricsRegistryWithOptions("test", PrometheusRegistryOptions{Registry: registry})
+	mfs, err = registry.Gather()
+	assert.NoError(t, err)
+	assert.False(t, hasMetricFamily(mfs, "go_goroutines"))
+}
+
+func hasMetricFamily(mfs []*dto.MetricFamily, name string) bool {
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
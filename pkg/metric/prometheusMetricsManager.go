@@ -140,11 +140,12 @@ func (pmm *prometheusMetricsManager) NewSummaryMetricWithLabels(ctx context.Cont
 }
 
 type regInfo struct {
-	Type       string
-	Name       string
-	HelpText   string
-	LabelNames []string  // should only be provided for metrics types with vectors
-	Buckets    []float64 // only applicable for histogram
+	Type                        string
+	Name                        string
+	HelpText                    string
+	LabelNames                  []string  // should only be provided for metrics types with vectors
+	Buckets                     []float64 // only applicable for histogram
+	NativeHistogramBucketFactor float64   // only applicable for histogram, enabling a native histogram when greater than 1
 }
 
 func (pmm *prometheusMetricsManager) registerMetrics(ctx context.Context, mr regInfo) {
@@ -200,6 +201,8 @@ func (pmm *prometheusMetricsManager) registerMetrics(ctx context.Context, mr reg
 				Name:      mr.Name,
 				Help:      mr.HelpText,
 				Buckets:   mr.Buckets,
+
+				NativeHistogramBucketFactor: mr.NativeHistogramBucketFactor,
 			}, mr.LabelNames),
 			LabelNames: mr.LabelNames,
 		}
@@ -275,3 +278,13 @@ func (pmm *prometheusMetricsManager) ObserveSummaryMetricWithLabels(ctx context.
 		collector.(*prometheus.SummaryVec).With(checkAndUpdateLabels(ctx, m.LabelNames, labels, defaultLabels)).Observe(number)
 	}
 }
+
+func (pmm *prometheusMetricsManager) DeleteMetricsWithLabels(ctx context.Context, labels map[string]string) {
+	deleted := 0
+	for _, m := range pmm.metricsMap {
+		if vec, ok := m.Metric.(interface{ DeletePartialMatch(prometheus.Labels) int }); ok {
+			deleted += vec.DeletePartialMatch(labels)
+		}
+	}
+	log.L(ctx).Debugf("Deleted %d metric series with labels %v", deleted, labels)
+}
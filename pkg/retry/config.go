@@ -24,12 +24,14 @@ const (
 	ConfigInitialDelay = "initialDelay"
 	ConfigMaximumDelay = "maxDelay"
 	ConfigFactor       = "factor"
+	ConfigJitter       = "jitter"
 )
 
 func InitConfig(conf config.Section) {
 	conf.AddKnownKey(ConfigInitialDelay, "250ms")
 	conf.AddKnownKey(ConfigMaximumDelay, "30s")
 	conf.AddKnownKey(ConfigFactor, 2)
+	conf.AddKnownKey(ConfigJitter, false)
 }
 
 func NewFromConfig(conf config.Section) *Retry {
@@ -37,5 +39,6 @@ func NewFromConfig(conf config.Section) *Retry {
 		InitialDelay: conf.GetDuration(ConfigInitialDelay),
 		MaximumDelay: conf.GetDuration(ConfigMaximumDelay),
 		Factor:       conf.GetFloat64(ConfigFactor),
+		Jitter:       conf.GetBool(ConfigJitter),
 	}
 }
@@ -33,4 +33,5 @@ func TestGenerateConfig(t *testing.T) {
 	assert.Equal(t, 250*time.Millisecond, c.InitialDelay)
 	assert.Equal(t, 30*time.Second, c.MaximumDelay)
 	assert.Equal(t, 2.0, c.Factor)
+	assert.Equal(t, false, c.Jitter)
 }
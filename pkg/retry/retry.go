@@ -18,6 +18,7 @@ package retry
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	"github.com/hyperledger/firefly-common/pkg/i18n"
@@ -31,10 +32,13 @@ const (
 // Retry is a concurrency safe retry structure that configures a simple backoff retry mechanism.
 // Can be loaded directly from JSON/YAML config
 type Retry struct {
-	InitialDelay time.Duration   `ffstruct:"RetryConfig" json:"initialDelay,omitempty"`
-	MaximumDelay time.Duration   `ffstruct:"RetryConfig" json:"maximumDelay,omitempty"`
-	Factor       float64         `ffstruct:"RetryConfig" json:"factor,omitempty"`
-	ErrCallback  func(err error) `json:"-"`
+	InitialDelay time.Duration `ffstruct:"RetryConfig" json:"initialDelay,omitempty"`
+	MaximumDelay time.Duration `ffstruct:"RetryConfig" json:"maximumDelay,omitempty"`
+	Factor       float64       `ffstruct:"RetryConfig" json:"factor,omitempty"`
+	// Jitter uses decorrelated jitter in place of the factor - each delay is random between the initial
+	// delay and three times the last, so many callers that fail together do not retry in lockstep
+	Jitter      bool            `ffstruct:"RetryConfig" json:"jitter,omitempty"`
+	ErrCallback func(err error) `json:"-"`
 }
 
 // DoCustomLog disables the automatic attempt logging, so the caller should do logging for each attempt
@@ -73,6 +77,9 @@ func (r *Retry) Do(ctx context.Context, logDescription string, f func(attempt in
 		}
 
 		// Limit the delay based on the context deadline and maximum delay
+		if r.Jitter {
+			delay = decorrelatedJitter(r.InitialDelay, delay)
+		}
 		deadline, dok := ctx.Deadline()
 		now := time.Now()
 		if delay > r.MaximumDelay {
@@ -87,6 +94,17 @@ func (r *Retry) Do(ctx context.Context, logDescription string, f func(attempt in
 
 		// Sleep and set the delay for next time
 		time.Sleep(delay)
-		delay = time.Duration(float64(delay) * factor)
+		if !r.Jitter {
+			delay = time.Duration(float64(delay) * factor)
+		}
+	}
+}
+
+// decorrelatedJitter returns a random delay between the base and three times the last delay
+func decorrelatedJitter(base, last time.Duration) time.Duration {
+	span := int64(last*3 - base)
+	if span <= 0 {
+		return base
 	}
+	return base + time.Duration(rand.Int63n(span)) // #nosec G404 - does not need to be secure
 }
@@ -65,3 +65,36 @@ func TestRetryContextCanceled(t *testing.T) {
 	})
 	assert.Regexp(t, "FF00154", err)
 }
+
+func TestRetryJitterSpread(t *testing.T) {
+	var delays []time.Duration
+	last := time.Now()
+	r := Retry{
+		InitialDelay: 1 * time.Millisecond,
+		MaximumDelay: 20 * time.Millisecond,
+		Jitter:       true,
+	}
+	err := r.Do(context.Background(), "unit test", func(i int) (retry bool, err error) {
+		now := time.Now()
+		if i > 1 {
+			delays = append(delays, now.Sub(last))
+		}
+		last = now
+		return i < 6, fmt.Errorf("pop")
+	})
+	assert.Regexp(t, "pop", err)
+	for _, d := range delays {
+		assert.GreaterOrEqual(t, d, 1*time.Millisecond)
+	}
+
+	// Many callers that fail together retry at different times
+	firstDelays := map[time.Duration]bool{}
+	for i := 0; i < 100; i++ {
+		d := decorrelatedJitter(100*time.Millisecond, 100*time.Millisecond)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.Less(t, d, 300*time.Millisecond)
+		firstDelays[d] = true
+	}
+	assert.Greater(t, len(firstDelays), 1)
+	assert.Equal(t, 5*time.Millisecond, decorrelatedJitter(5*time.Millisecond, 0))
+}
@@ -26,9 +26,11 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-common/pkg/fftls"
 	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
@@ -51,10 +53,27 @@ type WSConfig struct {
 	HeartbeatInterval      time.Duration      `json:"heartbeatInterval,omitempty"`
 	TLSClientConfig        *tls.Config        `json:"tlsClientConfig,omitempty"`
 	ConnectionTimeout      time.Duration      `json:"connectionTimeout,omitempty"`
-	// This one cannot be set in JSON - must be configured on the code interface
-	ReceiveExt bool
+	ReceiveBufferSize      int                `json:"receiveBufferSize,omitempty"`
+	ReceiveOverflowPolicy  OverflowPolicy     `json:"receiveOverflowPolicy,omitempty"`
+	// These cannot be set in JSON - must be configured on the code interface
+	ReceiveExt    bool
+	OnReceiveDrop WSReceiveDropHandler
 }
 
+// OverflowPolicy defines what happens when a message is read while the receive buffer is full.
+// The buffer and policy only apply to Receive(), as ReceiveExt() streams each payload in turn, so the
+// drop policies are rejected when ReceiveExt is set.
+type OverflowPolicy string
+
+const (
+	// OverflowPolicyBlock stops reading from the WebSocket until the consumer catches up
+	OverflowPolicyBlock OverflowPolicy = "block"
+	// OverflowPolicyDropOldest discards the oldest queued message to make room
+	OverflowPolicyDropOldest OverflowPolicy = "dropOldest"
+	// OverflowPolicyDropNewest discards the message that was just read
+	OverflowPolicyDropNewest OverflowPolicy = "dropNewest"
+)
+
 // WSPayload allows API consumers of this package to stream data, and inspect the message
 // type, rather than just being passed the bytes directly.
 type WSPayload struct {
@@ -97,6 +116,9 @@ type wsClient struct {
 	retry                retry.Retry
 	closed               bool
 	useReceiveExt        bool
+	overflowPolicy       OverflowPolicy
+	onReceiveDrop        WSReceiveDropHandler
+	receiveDropped       atomic.Int64
 	receive              chan []byte
 	receiveExt           chan *WSPayload
 	send                 chan []byte
@@ -114,6 +136,9 @@ type wsClient struct {
 // WSPreConnectHandler will be called before every connect/reconnect. Any error returned will prevent the websocket from connecting.
 type WSPreConnectHandler func(ctx context.Context, w WSClient) error
 
+// WSReceiveDropHandler will be called each time a message is discarded due to the receive overflow policy, with the total dropped so far. Must not block.
+type WSReceiveDropHandler func(ctx context.Context, message []byte, totalDropped int64)
+
 // WSPostConnectHandler will be called after every connect/reconnect. Can send data over ws, but must not block listening for data on the ws.
 type WSPostConnectHandler func(ctx context.Context, w WSClient) error
 
@@ -145,12 +170,28 @@ func New(ctx context.Context, config *WSConfig, beforeConnect WSPreConnectHandle
 		afterConnect:         afterConnect,
 		heartbeatInterval:    config.HeartbeatInterval,
 		useReceiveExt:        config.ReceiveExt,
+		overflowPolicy:       config.ReceiveOverflowPolicy,
+		onReceiveDrop:        config.OnReceiveDrop,
 		disableReconnect:     config.DisableReconnect,
 	}
+	switch w.overflowPolicy {
+	case "":
+		w.overflowPolicy = OverflowPolicyBlock
+	case OverflowPolicyBlock:
+	case OverflowPolicyDropOldest, OverflowPolicyDropNewest:
+		if w.useReceiveExt {
+			return nil, i18n.NewError(ctx, i18n.MsgWSDropPolicyReceiveExt, w.overflowPolicy)
+		}
+		if config.ReceiveBufferSize <= 0 {
+			return nil, i18n.NewError(ctx, i18n.MsgWSDropPolicyNeedsBuffer, w.overflowPolicy)
+		}
+	default:
+		return nil, i18n.NewError(ctx, i18n.MsgWSInvalidOverflowPolicy, w.overflowPolicy)
+	}
 	if w.useReceiveExt {
 		w.receiveExt = make(chan *WSPayload)
 	} else {
-		w.receive = make(chan []byte)
+		w.receive = make(chan []byte, config.ReceiveBufferSize)
 	}
 	for k, v := range config.HTTPHeaders {
 		if vs, ok := v.(string); ok {
@@ -276,6 +317,15 @@ func buildWSUrl(ctx context.Context, config *WSConfig) (string, error) {
 	return u.String(), nil
 }
 
+// dialContext passes the host through to the TLS handshake, so fftls can select the client certificate
+func (w *wsClient) dialContext() context.Context {
+	ctx := context.Background()
+	if u, err := url.Parse(w.url); err == nil {
+		ctx = fftls.WithServerName(ctx, u.Hostname())
+	}
+	return ctx
+}
+
 func (w *wsClient) connect(initial bool) error {
 	l := log.L(w.ctx)
 	return w.retry.DoCustomLog(w.ctx, func(attempt int) (retry bool, err error) {
@@ -292,7 +342,7 @@ func (w *wsClient) connect(initial bool) error {
 		}
 
 		var res *http.Response
-		w.wsconn, res, err = w.wsdialer.Dial(w.url, w.headers)
+		w.wsconn, res, err = w.wsdialer.DialContext(w.dialContext(), w.url, w.headers)
 		if err != nil {
 			var b []byte
 			var status = -1
@@ -324,6 +374,10 @@ func (w *wsClient) readLoop() {
 
 		// Pass the message to the consumer
 		l.Tracef("WS %s read (mt=%d): %s", w.url, mt, message)
+		if w.overflowPolicy == OverflowPolicyDropOldest || w.overflowPolicy == OverflowPolicyDropNewest {
+			w.queueMessage(message)
+			continue
+		}
 		select {
 		case <-w.sendDone:
 			l.Debugf("WS %s closing reader after send error", w.url)
@@ -333,6 +387,35 @@ func (w *wsClient) readLoop() {
 	}
 }
 
+// queueMessage adds a message to the receive buffer without blocking, applying the drop policy if it is full.
+// The read loop is the only sender, so a full buffer always has room after one message is removed.
+func (w *wsClient) queueMessage(message []byte) {
+	for {
+		select {
+		case w.receive <- message:
+			return
+		default:
+		}
+		if w.overflowPolicy == OverflowPolicyDropNewest {
+			w.dropMessage(message)
+			return
+		}
+		select {
+		case oldest := <-w.receive:
+			w.dropMessage(oldest)
+		default:
+		}
+	}
+}
+
+func (w *wsClient) dropMessage(message []byte) {
+	total := w.receiveDropped.Add(1)
+	log.L(w.ctx).Debugf("WS %s receive buffer full (policy=%s) - dropped message (total=%d)", w.url, w.overflowPolicy, total)
+	if w.onReceiveDrop != nil {
+		w.onReceiveDrop(w.ctx, message, total)
+	}
+}
+
 func (w *wsClient) readLoopExt() {
 	l := log.L(w.ctx)
 	for {
@@ -659,3 +659,99 @@ func TestWSClientContextClosed(t *testing.T) {
 	err = wsc.Send(context.Background(), []byte{})
 	assert.Regexp(t, "FF00147", err)
 }
+
+func TestWSReceiveOverflowDropOldest(t *testing.T) {
+	var dropped [][]byte
+	wsc, err := New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveBufferSize:     2,
+		ReceiveOverflowPolicy: OverflowPolicyDropOldest,
+		OnReceiveDrop: func(ctx context.Context, message []byte, totalDropped int64) {
+			dropped = append(dropped, message)
+			assert.Equal(t, int64(len(dropped)), totalDropped)
+		},
+	}, nil, nil)
+	assert.NoError(t, err)
+	w := wsc.(*wsClient)
+
+	for _, m := range []string{"1", "2", "3", "4"} {
+		w.queueMessage([]byte(m))
+	}
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2")}, dropped)
+	assert.Equal(t, "3", string(<-w.Receive()))
+	assert.Equal(t, "4", string(<-w.Receive()))
+}
+
+func TestWSReceiveOverflowDropNewest(t *testing.T) {
+	wsc, err := New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveBufferSize:     2,
+		ReceiveOverflowPolicy: OverflowPolicyDropNewest,
+	}, nil, nil)
+	assert.NoError(t, err)
+	w := wsc.(*wsClient)
+
+	for _, m := range []string{"1", "2", "3", "4"} {
+		w.queueMessage([]byte(m))
+	}
+	assert.Equal(t, int64(2), w.receiveDropped.Load())
+	assert.Equal(t, "1", string(<-w.Receive()))
+	assert.Equal(t, "2", string(<-w.Receive()))
+}
+
+func TestWSReceiveOverflowE2E(t *testing.T) {
+	toServer, fromServer, url, close := NewTestWSServer(nil)
+	defer close()
+
+	dropped := make(chan []byte, 1)
+	wsc, err := New(context.Background(), &WSConfig{
+		HTTPURL:               url,
+		ReceiveBufferSize:     1,
+		ReceiveOverflowPolicy: OverflowPolicyDropNewest,
+		OnReceiveDrop: func(ctx context.Context, message []byte, totalDropped int64) {
+			dropped <- message
+		},
+	}, nil, func(ctx context.Context, w WSClient) error {
+		return w.Send(ctx, []byte(`connected`))
+	})
+	assert.NoError(t, err)
+	defer wsc.Close()
+	err = wsc.Connect()
+	assert.NoError(t, err)
+	<-toServer
+
+	fromServer <- `message1`
+	fromServer <- `message2`
+	assert.Equal(t, `message2`, string(<-dropped))
+	assert.Equal(t, `message1`, string(<-wsc.Receive()))
+}
+
+func TestWSReceiveOverflowPolicyValidation(t *testing.T) {
+	_, err := New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveOverflowPolicy: "wrong",
+	}, nil, nil)
+	assert.Regexp(t, "FF00251", err)
+
+	_, err = New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveOverflowPolicy: OverflowPolicyDropOldest,
+	}, nil, nil)
+	assert.Regexp(t, "FF00252", err)
+
+	_, err = New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveExt:            true,
+		ReceiveBufferSize:     10,
+		ReceiveOverflowPolicy: OverflowPolicyDropNewest,
+	}, nil, nil)
+	assert.Regexp(t, "FF00324", err)
+
+	wsc, err := New(context.Background(), &WSConfig{
+		WebSocketURL:          "ws://localhost",
+		ReceiveBufferSize:     10,
+		ReceiveOverflowPolicy: OverflowPolicyBlock,
+	}, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, cap(wsc.(*wsClient).receive))
+}
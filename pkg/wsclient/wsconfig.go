@@ -49,6 +49,10 @@ const (
 	WSConfigKeyHeartbeatInterval = "ws.heartbeatInterval"
 	// WSConnectionTimeout is the amount of time to wait while attempting to establish a connection (or automatic reconnection)
 	WSConfigKeyConnectionTimeout = "ws.connectionTimeout"
+	// WSConfigKeyReceiveBufferSize is the number of received messages that can be queued for the consumer
+	WSConfigKeyReceiveBufferSize = "ws.receiveBufferSize"
+	// WSConfigKeyReceiveOverflowPolicy is what to do when the receive buffer is full - block, dropOldest or dropNewest
+	WSConfigKeyReceiveOverflowPolicy = "ws.receiveOverflowPolicy"
 )
 
 // InitConfig ensures the config is initialized for HTTP too, as WS and HTTP
@@ -62,6 +66,8 @@ func InitConfig(conf config.Section) {
 	conf.AddKnownKey(WSConfigURL)
 	conf.AddKnownKey(WSConfigKeyHeartbeatInterval, defaultHeartbeatInterval)
 	conf.AddKnownKey(WSConfigKeyConnectionTimeout, defaultConnectionTimeout)
+	conf.AddKnownKey(WSConfigKeyReceiveBufferSize, 0)
+	conf.AddKnownKey(WSConfigKeyReceiveOverflowPolicy, string(OverflowPolicyBlock))
 }
 
 func GenerateConfig(ctx context.Context, conf config.Section) (*WSConfig, error) {
@@ -79,6 +85,8 @@ func GenerateConfig(ctx context.Context, conf config.Section) (*WSConfig, error)
 		AuthPassword:           conf.GetString(ffresty.HTTPConfigAuthPassword),
 		HeartbeatInterval:      conf.GetDuration(WSConfigKeyHeartbeatInterval),
 		ConnectionTimeout:      conf.GetDuration(WSConfigKeyConnectionTimeout),
+		ReceiveBufferSize:      conf.GetInt(WSConfigKeyReceiveBufferSize),
+		ReceiveOverflowPolicy:  OverflowPolicy(conf.GetString(WSConfigKeyReceiveOverflowPolicy)),
 	}
 	tlsSection := conf.SubSection("tls")
 	tlsClientConfig, err := fftls.ConstructTLSConfig(ctx, tlsSection, fftls.ClientType)
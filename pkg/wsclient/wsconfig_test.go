@@ -33,6 +33,8 @@ func TestWSConfigGeneration(t *testing.T) {
 	utConf.Set(WSConfigKeyWriteBufferSize, 1024)
 	utConf.Set(WSConfigKeyInitialConnectAttempts, 1)
 	utConf.Set(WSConfigKeyPath, "/websocket")
+	utConf.Set(WSConfigKeyReceiveBufferSize, 100)
+	utConf.Set(WSConfigKeyReceiveOverflowPolicy, "dropOldest")
 
 	ctx := context.Background()
 	wsConfig, err := GenerateConfig(ctx, utConf)
@@ -48,6 +50,8 @@ func TestWSConfigGeneration(t *testing.T) {
 	assert.Equal(t, "custom value", wsConfig.HTTPHeaders.GetString("custom-header"))
 	assert.Equal(t, 1024, wsConfig.ReadBufferSize)
 	assert.Equal(t, 1024, wsConfig.WriteBufferSize)
+	assert.Equal(t, 100, wsConfig.ReceiveBufferSize)
+	assert.Equal(t, OverflowPolicyDropOldest, wsConfig.ReceiveOverflowPolicy)
 }
 
 func TestWSConfigTLSGenerationFail(t *testing.T) {
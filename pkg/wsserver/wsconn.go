@@ -39,6 +39,16 @@ type webSocketConnection struct {
 	broadcast chan interface{}
 	newStream chan bool
 	closing   chan struct{}
+
+	// the number of events the consumer can accept now on each stream, where it advertises it. A change is
+	// signalled to the sender without blocking, and changes made while it is busy are coalesced into one.
+	credits       map[string]int
+	creditChanged chan struct{}
+
+	// reported by StreamConsumers
+	remoteAddr   string
+	connectedAt  *fftypes.FFTime
+	streamStarts map[string]*fftypes.FFTime
 }
 
 type WebSocketCommandMessageOrError struct {
@@ -51,6 +61,15 @@ type WebSocketCommandMessage struct {
 	Stream      string `json:"stream,omitempty"` // name of the event stream
 	Message     string `json:"message,omitempty"`
 	BatchNumber int64  `json:"batchNumber,omitempty"`
+	ResumeFrom  string `json:"resumeFrom,omitempty"` // on start, the last event the consumer has already processed
+	Credit      *int   `json:"credit,omitempty"`     // on start, ack, nack or credit, the number of events the consumer can accept now
+}
+
+// WebSocketEncodedMessage can be sent on a stream channel to write bytes that have already
+// been serialized, rather than marshaling the value to JSON. Binary data is sent in a binary frame.
+type WebSocketEncodedMessage struct {
+	Binary bool
+	Data   []byte
 }
 
 func newConnection(bgCtx context.Context, server *webSocketServer, conn *ws.Conn) *webSocketConnection {
@@ -64,6 +83,12 @@ func newConnection(bgCtx context.Context, server *webSocketServer, conn *ws.Conn
 		streams:   make(map[string]*webSocketStream),
 		broadcast: make(chan interface{}),
 		closing:   make(chan struct{}),
+
+		credits:       make(map[string]int),
+		creditChanged: make(chan struct{}, 1),
+
+		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: fftypes.Now(),
 	}
 	go wsc.listen()
 	go wsc.sender()
@@ -89,19 +114,28 @@ func (c *webSocketConnection) close() {
 
 func (c *webSocketConnection) sender() {
 	defer c.close()
+	var streams []*webSocketStream
 	buildCases := func() []reflect.SelectCase {
 		c.mux.Lock()
 		defer c.mux.Unlock()
-		cases := make([]reflect.SelectCase, len(c.streams)+3)
+		cases := make([]reflect.SelectCase, len(c.streams)+4)
+		streams = make([]*webSocketStream, len(c.streams))
 		i := 0
 		for _, t := range c.streams {
-			cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(t.senderChannel)}
+			cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv}
+			if credit, advertised := c.credits[t.streamName]; !advertised || credit > 0 {
+				// a case with no channel is ignored, so the consumer is not offered messages it has no credit for
+				cases[i].Chan = reflect.ValueOf(t.senderChannel)
+			}
+			streams[i] = t
 			i++
 		}
 		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.broadcast)}
 		i++
 		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.closing)}
 		i++
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.creditChanged)}
+		i++
 		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.newStream)}
 		return cases
 	}
@@ -113,19 +147,99 @@ func (c *webSocketConnection) sender() {
 			return
 		}
 
-		if chosen == len(cases)-1 {
-			// Addition of a new stream
+		if chosen >= len(cases)-2 {
+			// Addition of a new stream, or a change in the credit of the consumer
 			cases = buildCases()
 		} else {
-			// Message from one of the existing streams
-			_ = c.conn.WriteJSON(value.Interface())
+			// Message from one of the existing streams, which might be built for this consumer
+			var t *webSocketStream
+			if chosen < len(streams) {
+				t = streams[chosen]
+			}
+			msg := value.Interface()
+			if cm, ok := msg.(ConsumerMessage); ok {
+				var credit *int
+				if t != nil {
+					credit = c.creditFor(t.streamName)
+				}
+				var events int
+				if msg, events = cm.MessageFor(c.id, credit); msg == nil {
+					continue
+				}
+				if t != nil && c.consumeCredit(t.streamName, events) {
+					cases = buildCases()
+				}
+			}
+			if t != nil {
+				c.server.messageSent(c, t)
+			}
+			switch msg := msg.(type) {
+			case *WebSocketEncodedMessage:
+				messageType := ws.TextMessage
+				if msg.Binary {
+					messageType = ws.BinaryMessage
+				}
+				_ = c.conn.WriteMessage(messageType, msg.Data)
+			default:
+				_ = c.conn.WriteJSON(msg)
+			}
 		}
 	}
 }
 
+func (c *webSocketConnection) creditFor(stream string) *int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.creditForLocked(stream)
+}
+
+// creditForLocked returns the credit the consumer advertises on the stream, or nil if it does not
+func (c *webSocketConnection) creditForLocked(stream string) *int {
+	if credit, advertised := c.credits[stream]; advertised {
+		return &credit
+	}
+	return nil
+}
+
+// setCredit records the credit the consumer advertises on the stream, replacing any it has left.
+// A start without credit clears it, so the consumer can be sent any number of events.
+func (c *webSocketConnection) setCredit(t *webSocketStream, credit *int) {
+	log.L(c.ctx).Debugf("Received WebSocket credit %v on stream '%s'", credit, t.streamName)
+	c.mux.Lock()
+	if credit == nil {
+		delete(c.credits, t.streamName)
+	} else {
+		c.credits[t.streamName] = *credit
+	}
+	c.mux.Unlock()
+	select {
+	case c.creditChanged <- struct{}{}:
+	default:
+		// the sender has yet to pick up an earlier change, and reads the latest credit when it does
+	}
+}
+
+// consumeCredit reduces the credit on the stream by the events sent, returning true if it is used up
+func (c *webSocketConnection) consumeCredit(stream string, events int) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	credit, advertised := c.credits[stream]
+	if !advertised {
+		return false
+	}
+	c.credits[stream] = credit - events
+	return credit-events <= 0
+}
+
 func (c *webSocketConnection) startStream(t *webSocketStream) {
 	c.mux.Lock()
 	c.streams[t.streamName] = t
+	if c.streamStarts == nil {
+		c.streamStarts = make(map[string]*fftypes.FFTime)
+	}
+	if _, started := c.streamStarts[t.streamName]; !started {
+		c.streamStarts[t.streamName] = fftypes.Now()
+	}
 	c.server.StreamStarted(c, t.streamName)
 	c.mux.Unlock()
 	select {
@@ -134,6 +248,29 @@ func (c *webSocketConnection) startStream(t *webSocketStream) {
 	}
 }
 
+// resumeStream passes the offset supplied by the consumer to the owner of the stream, before the
+// stream is started, so that it is honored for all messages sent to this consumer
+func (c *webSocketConnection) resumeStream(t *webSocketStream, resumeFrom string) error {
+	if resumeFrom == "" {
+		return nil
+	}
+	handler := c.server.getResumeHandler(t.streamName)
+	if handler == nil {
+		log.L(c.ctx).Warnf("Ignoring resumeFrom '%s' on stream '%s', as it does not support resuming", resumeFrom, t.streamName)
+		return nil
+	}
+	log.L(c.ctx).Infof("Resuming stream '%s' from '%s'", t.streamName, resumeFrom)
+	return handler(c.ctx, c.id, resumeFrom)
+}
+
+func (c *webSocketConnection) sendError(t *webSocketStream, err error) {
+	log.L(c.ctx).Errorf("Rejected start of stream '%s': %s", t.streamName, err)
+	select {
+	case c.broadcast <- &WebSocketCommandMessage{Type: "error", Stream: t.streamName, Message: err.Error()}:
+	case <-c.closing:
+	}
+}
+
 func (c *webSocketConnection) listen() {
 	defer c.close()
 	log.L(c.ctx).Infof("Connected")
@@ -149,12 +286,27 @@ func (c *webSocketConnection) listen() {
 		t := c.server.getStream(msg.Stream)
 		switch strings.ToLower(msg.Type) {
 		case "start":
+			if err := c.resumeStream(t, msg.ResumeFrom); err != nil {
+				c.sendError(t, err)
+				continue
+			}
+			c.setCredit(t, msg.Credit)
 			c.startStream(t)
+		case "credit":
+			if msg.Credit != nil {
+				c.setCredit(t, msg.Credit)
+			}
 		case "ack":
+			if msg.Credit != nil {
+				c.setCredit(t, msg.Credit)
+			}
 			if !c.dispatchAckOrError(t, &msg, nil) {
 				return
 			}
 		case "error", "nack":
+			if msg.Credit != nil {
+				c.setCredit(t, msg.Credit)
+			}
 			if !c.dispatchAckOrError(t, &msg, i18n.NewError(c.ctx, i18n.MsgWSErrorFromClient, msg.Message)) {
 				return
 			}
@@ -20,10 +20,12 @@ import (
 	"context"
 	"net/http"
 	"reflect"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/hyperledger/firefly-common/pkg/fftypes"
 	"github.com/hyperledger/firefly-common/pkg/i18n"
 	"github.com/hyperledger/firefly-common/pkg/log"
 )
@@ -34,6 +36,53 @@ type WebSocketChannels interface {
 	GetChannels(streamName string) (senderChannel chan<- interface{}, broadcastChannel chan<- interface{}, receiverChannel <-chan *WebSocketCommandMessageOrError)
 }
 
+// StreamConsumerDisconnector is implemented by the WebSocketServer, to close the connection that
+// last received a message sent on a stream's sender channel - such as a consumer that has not
+// acknowledged it in time. It returns false if there is no such connection.
+type StreamConsumerDisconnector interface {
+	DisconnectStreamConsumer(streamName string) bool
+}
+
+// StreamConsumerLister is implemented by the WebSocketServer, to report the connections that have
+// started listening on a stream - so whether anyone is consuming it, and since when.
+type StreamConsumerLister interface {
+	StreamConsumers(streamName string) []*StreamConsumer
+}
+
+// StreamConsumer is a connection that has started listening on a stream
+type StreamConsumer struct {
+	ID          string          `json:"id"`
+	RemoteAddr  string          `json:"remoteAddr"`
+	Subprotocol string          `json:"subprotocol,omitempty"` // only set if negotiated in the upgrade
+	ConnectedAt *fftypes.FFTime `json:"connectedAt"`
+	StartedAt   *fftypes.FFTime `json:"startedAt"`        // when the connection sent the start for this stream
+	Credit      *int            `json:"credit,omitempty"` // the number of events the connection can accept now, if it advertises it
+}
+
+// StreamResumeHandler is called when a consumer starts listening on a stream with a resumeFrom offset,
+// before any message on the stream can be sent to that consumer. The consumer ID is the ID of its connection,
+// as passed to ConsumerMessage. Returning an error rejects the start, and the error is sent back to the consumer.
+type StreamResumeHandler func(ctx context.Context, consumerID, resumeFrom string) error
+
+// ConsumerMessage can be sent on the channels of a stream in place of a message, to build the message for each
+// connection that takes it - such as to leave out what that consumer has already processed. MessageFor is called
+// with the ID of the connection before the message is written to it, and a nil message is not written.
+//
+// A connection that advertises credit on a stream is only offered messages from the sender channel of that stream
+// while it has credit left, and MessageFor is passed the credit so the message can be limited to fit. The credit
+// is reduced by the number of events MessageFor reports the message uses, until the consumer advertises it again.
+// The credit is nil for connections that do not advertise it, and for broadcasts.
+type ConsumerMessage interface {
+	MessageFor(consumerID string, credit *int) (msg interface{}, events int)
+}
+
+// StreamResumeRegistrar is implemented by the WebSocketServer, to allow the owner of a stream to honor
+// the offset a consumer supplies when it starts listening - such as the last event it has processed.
+// Registering a nil handler removes it, and the offsets of consumers of that stream are ignored.
+type StreamResumeRegistrar interface {
+	SetStreamResumeHandler(streamName string, handler StreamResumeHandler)
+}
+
 // WebSocketServer is the full server interface with the init call
 type WebSocketServer interface {
 	WebSocketChannels
@@ -51,6 +100,7 @@ type webSocketServer struct {
 	replyChannel      chan interface{}
 	upgrader          *websocket.Upgrader
 	connections       map[string]*webSocketConnection
+	resumeHandlers    map[string]StreamResumeHandler
 }
 
 type webSocketStream struct {
@@ -58,6 +108,7 @@ type webSocketStream struct {
 	senderChannel    chan interface{}
 	broadcastChannel chan interface{}
 	receiverChannel  chan *WebSocketCommandMessageOrError
+	lastConsumer     *webSocketConnection
 }
 
 // NewWebSocketServer create a new server with a simplified interface
@@ -65,6 +116,7 @@ func NewWebSocketServer(bgCtx context.Context) WebSocketServer {
 	s := &webSocketServer{
 		ctx:               bgCtx,
 		connections:       make(map[string]*webSocketConnection),
+		resumeHandlers:    make(map[string]StreamResumeHandler),
 		streams:           make(map[string]*webSocketStream),
 		streamMap:         make(map[string]map[string]*webSocketConnection),
 		newStream:         make(chan bool),
@@ -109,6 +161,9 @@ func (s *webSocketServer) connectionClosed(c *webSocketConnection) {
 	delete(s.connections, c.id)
 	for _, stream := range c.streams {
 		delete(s.streamMap[stream.streamName], c.id)
+		if stream.lastConsumer == c {
+			stream.lastConsumer = nil
+		}
 	}
 }
 
@@ -144,8 +199,72 @@ func (s *webSocketServer) GetChannels(stream string) (chan<- interface{}, chan<-
 	return t.senderChannel, t.broadcastChannel, t.receiverChannel
 }
 
+func (s *webSocketServer) messageSent(c *webSocketConnection, t *webSocketStream) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	t.lastConsumer = c
+}
+
+func (s *webSocketServer) DisconnectStreamConsumer(stream string) bool {
+	s.mux.Lock()
+	var c *webSocketConnection
+	if t, exists := s.streams[stream]; exists {
+		c = t.lastConsumer
+		t.lastConsumer = nil
+	}
+	s.mux.Unlock()
+	if c == nil {
+		return false
+	}
+	log.L(c.ctx).Infof("Disconnecting consumer of stream '%s'", stream)
+	c.close()
+	return true
+}
+
+func (s *webSocketServer) StreamConsumers(stream string) []*StreamConsumer {
+	s.mux.Lock()
+	wsconns := getConnListFromMap(s.streamMap[stream])
+	s.mux.Unlock()
+	consumers := make([]*StreamConsumer, 0, len(wsconns))
+	for _, c := range wsconns {
+		c.mux.Lock()
+		consumers = append(consumers, &StreamConsumer{
+			ID:          c.id,
+			RemoteAddr:  c.remoteAddr,
+			Subprotocol: c.conn.Subprotocol(),
+			ConnectedAt: c.connectedAt,
+			StartedAt:   c.streamStarts[stream],
+			Credit:      c.creditForLocked(stream),
+		})
+		c.mux.Unlock()
+	}
+	// oldest first, so the first consumer is the one that has been connected the longest
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].StartedAt.UnixNano() < consumers[j].StartedAt.UnixNano()
+	})
+	return consumers
+}
+
+func (s *webSocketServer) SetStreamResumeHandler(stream string, handler StreamResumeHandler) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if handler == nil {
+		delete(s.resumeHandlers, stream)
+	} else {
+		s.resumeHandlers[stream] = handler
+	}
+}
+
+func (s *webSocketServer) getResumeHandler(stream string) StreamResumeHandler {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.resumeHandlers[stream]
+}
+
 func (s *webSocketServer) StreamStarted(c *webSocketConnection, stream string) {
 	// Track that this connection is interested in this stream
+	s.mux.Lock()
+	defer s.mux.Unlock()
 	s.streamMap[stream][c.id] = c
 }
 
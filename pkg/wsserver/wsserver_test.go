@@ -18,6 +18,7 @@ package wsserver
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -393,3 +394,343 @@ func TestBroadcastClosing(t *testing.T) {
 	// Check this doesn't block
 	c.server.broadcastToConnections([]*webSocketConnection{c}, "anything")
 }
+
+func TestSendEncodedMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type: "start",
+	})
+
+	s, _, _ := w.GetChannels("")
+
+	s <- &WebSocketEncodedMessage{Binary: true, Data: []byte{0x01, 0x02}}
+	messageType, data, err := c.ReadMessage()
+	assert.NoError(err)
+	assert.Equal(ws.BinaryMessage, messageType)
+	assert.Equal([]byte{0x01, 0x02}, data)
+
+	s <- &WebSocketEncodedMessage{Data: []byte(`{"some":"text"}`)}
+	messageType, data, err = c.ReadMessage()
+	assert.NoError(err)
+	assert.Equal(ws.TextMessage, messageType)
+	assert.Equal(`{"some":"text"}`, string(data))
+
+	w.Close()
+}
+
+func TestDisconnectStreamConsumer(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	assert.False(w.DisconnectStreamConsumer("unknown"))
+
+	u, err := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:   "start",
+		Stream: "stream1",
+	})
+	s, _, r := w.GetChannels("stream1")
+	assert.False(w.DisconnectStreamConsumer("stream1"))
+
+	s <- "Hello World"
+	var val string
+	c.ReadJSON(&val)
+	assert.Equal("Hello World", val)
+
+	// The connection that received the message is closed, waking the receiver
+	assert.True(w.DisconnectStreamConsumer("stream1"))
+	msgOrErr := <-r
+	assert.Regexp("FF00228", msgOrErr.Err)
+	_, _, err = c.ReadMessage()
+	assert.Error(err)
+	assert.False(w.DisconnectStreamConsumer("stream1"))
+
+	w.Close()
+}
+
+func TestStreamConsumers(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	assert.Empty(w.StreamConsumers("stream1"))
+
+	u, err := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c1, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	c1.WriteJSON(&WebSocketCommandMessage{
+		Type:   "start",
+		Stream: "stream1",
+	})
+	assert.Eventually(func() bool { return len(w.StreamConsumers("stream1")) == 1 }, 5*time.Second, 1*time.Millisecond)
+
+	c2, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	c2.WriteJSON(&WebSocketCommandMessage{
+		Type:   "start",
+		Stream: "stream1",
+	})
+	assert.Eventually(func() bool { return len(w.StreamConsumers("stream1")) == 2 }, 5*time.Second, 1*time.Millisecond)
+
+	// The longest running consumer is first
+	consumers := w.StreamConsumers("stream1")
+	assert.Equal(c1.LocalAddr().String(), consumers[0].RemoteAddr)
+	assert.Equal(c2.LocalAddr().String(), consumers[1].RemoteAddr)
+	assert.NotNil(consumers[0].ConnectedAt)
+	assert.False(consumers[1].StartedAt.Time().Before(*consumers[0].StartedAt.Time()))
+	assert.Empty(w.StreamConsumers("stream2"))
+
+	// Consumers are removed when they disconnect
+	c1.Close()
+	assert.Eventually(func() bool { return len(w.StreamConsumers("stream1")) == 1 }, 5*time.Second, 1*time.Millisecond)
+	assert.Equal(c2.LocalAddr().String(), w.StreamConsumers("stream1")[0].RemoteAddr)
+
+	w.Close()
+}
+
+func TestStreamResume(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	resumed := make(chan string, 1)
+	w.SetStreamResumeHandler("stream1", func(ctx context.Context, consumerID, resumeFrom string) error {
+		assert.NotEmpty(consumerID)
+		if resumeFrom == "bad" {
+			return fmt.Errorf("pop")
+		}
+		resumed <- resumeFrom
+		return nil
+	})
+
+	u, err := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+
+	// A rejected offset is reported to the consumer, and the stream is not started
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:       "start",
+		Stream:     "stream1",
+		ResumeFrom: "bad",
+	})
+	var reply WebSocketCommandMessage
+	assert.NoError(c.ReadJSON(&reply))
+	assert.Equal("error", reply.Type)
+	assert.Equal("stream1", reply.Stream)
+	assert.Equal("pop", reply.Message)
+	assert.Empty(w.StreamConsumers("stream1"))
+
+	// The handler is called before the stream is started
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:       "start",
+		Stream:     "stream1",
+		ResumeFrom: "12345",
+	})
+	assert.Equal("12345", <-resumed)
+	s, _, _ := w.GetChannels("stream1")
+	s <- "Hello World"
+	var val string
+	c.ReadJSON(&val)
+	assert.Equal("Hello World", val)
+
+	// Offsets are ignored once the handler is removed
+	w.SetStreamResumeHandler("stream1", nil)
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:       "start",
+		Stream:     "stream1",
+		ResumeFrom: "bad",
+	})
+	s <- "Hello Again"
+	c.ReadJSON(&val)
+	assert.Equal("Hello Again", val)
+	assert.Empty(resumed)
+
+	w.Close()
+}
+
+type testConsumerMessage struct {
+	skip string
+}
+
+func (m *testConsumerMessage) MessageFor(consumerID string, credit *int) (interface{}, int) {
+	if consumerID == m.skip {
+		return nil, 0
+	}
+	if credit != nil {
+		return fmt.Sprintf("Hello %s with credit %d", consumerID, *credit), 1
+	}
+	return "Hello " + consumerID, 1
+}
+
+func TestConsumerMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c1, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	c2, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	for _, c := range []*ws.Conn{c1, c2} {
+		c.WriteJSON(&WebSocketCommandMessage{Type: "start", Stream: "stream1"})
+	}
+	assert.Eventually(func() bool { return len(w.StreamConsumers("stream1")) == 2 }, 5*time.Second, 1*time.Millisecond)
+	consumers := w.StreamConsumers("stream1")
+	ids := map[string]string{
+		c1.LocalAddr().String(): "",
+		c2.LocalAddr().String(): "",
+	}
+	for _, consumer := range consumers {
+		ids[consumer.RemoteAddr] = consumer.ID
+	}
+	id1, id2 := ids[c1.LocalAddr().String()], ids[c2.LocalAddr().String()]
+
+	// Each consumer is sent the message built for it, and a nil message is not sent
+	_, b, _ := w.GetChannels("stream1")
+	b <- &testConsumerMessage{skip: id1}
+	var val string
+	assert.NoError(c2.ReadJSON(&val))
+	assert.Equal("Hello "+id2, val)
+	b <- &testConsumerMessage{}
+	assert.NoError(c1.ReadJSON(&val))
+	assert.Equal("Hello "+id1, val)
+	assert.NoError(c2.ReadJSON(&val))
+	assert.Equal("Hello "+id2, val)
+
+	w.Close()
+}
+
+func TestStreamCredit(t *testing.T) {
+	assert := assert.New(t)
+
+	w, ts := newTestWebSocketServer()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	u.Scheme = "ws"
+	u.Path = "/ws"
+	c, _, err := ws.DefaultDialer.Dial(u.String(), nil)
+	assert.NoError(err)
+	consumerCredit := func() *int {
+		consumers := w.StreamConsumers("stream1")
+		if len(consumers) == 0 {
+			return nil
+		}
+		return consumers[0].Credit
+	}
+	send := func(msg interface{}) bool {
+		s, _, _ := w.GetChannels("stream1")
+		select {
+		case s <- msg:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	// Credit on start is passed to each message built for the consumer, and reduced by the events it uses
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:   "start",
+		Stream: "stream1",
+		Credit: ptrTo(2),
+	})
+	assert.Eventually(func() bool { return consumerCredit() != nil }, 5*time.Second, 1*time.Millisecond)
+	id := w.StreamConsumers("stream1")[0].ID
+	var val string
+	for _, expected := range []int{2, 1} {
+		assert.True(send(&testConsumerMessage{}))
+		assert.NoError(c.ReadJSON(&val))
+		assert.Equal(fmt.Sprintf("Hello %s with credit %d", id, expected), val)
+	}
+	assert.Equal(0, *consumerCredit())
+
+	// The consumer is not offered messages once it has used up its credit, until it advertises more
+	assert.False(send(&testConsumerMessage{}))
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:   "CREDIT",
+		Stream: "stream1",
+		Credit: ptrTo(3),
+	})
+	assert.Eventually(func() bool { return send(&testConsumerMessage{}) }, 5*time.Second, 1*time.Millisecond)
+	assert.NoError(c.ReadJSON(&val))
+	assert.Equal(fmt.Sprintf("Hello %s with credit 3", id), val)
+
+	// Credit is never dropped, however much is sent, and the latest replaces the rest
+	for i := 0; i < 15; i++ {
+		c.WriteJSON(&WebSocketCommandMessage{
+			Type:   "credit",
+			Stream: "stream1",
+			Credit: ptrTo(i),
+		})
+	}
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:        "ack",
+		Stream:      "stream1",
+		BatchNumber: 1,
+		Credit:      ptrTo(20),
+	})
+	_, _, r := w.GetChannels("stream1")
+	msg := <-r
+	assert.Equal(int64(1), msg.Msg.BatchNumber)
+	assert.Equal(20, *consumerCredit())
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:   "credit",
+		Stream: "stream1",
+	})
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:        "nack",
+		Stream:      "stream1",
+		BatchNumber: 2,
+		Credit:      ptrTo(21),
+	})
+	msg = <-r
+	assert.Regexp("FF00227", msg.Err)
+	assert.Equal(21, *consumerCredit())
+
+	// Messages that are not built for the consumer do not use credit, and a start without credit clears it
+	assert.True(send("Hello World"))
+	assert.NoError(c.ReadJSON(&val))
+	assert.Equal("Hello World", val)
+	assert.Equal(21, *consumerCredit())
+	c.WriteJSON(&WebSocketCommandMessage{
+		Type:   "start",
+		Stream: "stream1",
+	})
+	assert.Eventually(func() bool { return consumerCredit() == nil }, 5*time.Second, 1*time.Millisecond)
+	assert.True(send(&testConsumerMessage{}))
+	assert.NoError(c.ReadJSON(&val))
+	assert.Equal("Hello "+id, val)
+
+	w.Close()
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1 @@
+ALTER TABLE es_checkpoints DROP COLUMN sub_sources;
@@ -0,0 +1 @@
+ALTER TABLE es_checkpoints ADD COLUMN sub_sources TEXT;
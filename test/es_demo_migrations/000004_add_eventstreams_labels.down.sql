@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN labels;
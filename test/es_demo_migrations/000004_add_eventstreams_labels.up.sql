@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN labels TEXT;
@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN max_batch_size_bytes;
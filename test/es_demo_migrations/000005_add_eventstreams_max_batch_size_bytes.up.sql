@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN max_batch_size_bytes BIGINT;
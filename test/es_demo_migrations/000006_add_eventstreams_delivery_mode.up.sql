@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN delivery_mode VARCHAR(64);
@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN active_schedule TEXT;
@@ -0,0 +1,2 @@
+DROP INDEX eventstreams_idempotency_key;
+ALTER TABLE eventstreams DROP COLUMN idempotency_key;
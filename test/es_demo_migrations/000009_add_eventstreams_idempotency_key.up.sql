@@ -0,0 +1,2 @@
+ALTER TABLE eventstreams ADD COLUMN idempotency_key VARCHAR(256);
+CREATE UNIQUE INDEX eventstreams_idempotency_key ON eventstreams(idempotency_key);
@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN catchup_batch_size;
@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN catchup_batch_size INT;
@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN shared_source;
@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN shared_source VARCHAR(64);
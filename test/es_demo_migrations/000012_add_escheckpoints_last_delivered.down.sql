@@ -0,0 +1 @@
+ALTER TABLE es_checkpoints DROP COLUMN last_delivered;
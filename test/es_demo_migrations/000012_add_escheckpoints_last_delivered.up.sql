@@ -0,0 +1 @@
+ALTER TABLE es_checkpoints ADD COLUMN last_delivered TEXT;
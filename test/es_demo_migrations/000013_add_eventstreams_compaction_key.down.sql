@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN compaction_key;
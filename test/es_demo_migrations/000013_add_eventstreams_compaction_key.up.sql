@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN compaction_key VARCHAR(256);
@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN stopped_reason TEXT;
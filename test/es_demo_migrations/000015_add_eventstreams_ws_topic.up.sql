@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN ws_topic TEXT;
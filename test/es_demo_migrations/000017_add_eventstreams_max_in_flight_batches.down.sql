@@ -0,0 +1 @@
+ALTER TABLE eventstreams DROP COLUMN max_in_flight_batches;
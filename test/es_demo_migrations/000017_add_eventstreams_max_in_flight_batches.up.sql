@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN max_in_flight_batches INT;
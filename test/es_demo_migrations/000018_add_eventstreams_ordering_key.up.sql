@@ -0,0 +1 @@
+ALTER TABLE eventstreams ADD COLUMN ordering_key VARCHAR(256);
@@ -0,0 +1,2 @@
+ALTER TABLE eventstreams DROP COLUMN catchup_tip;
+ALTER TABLE eventstreams DROP COLUMN catchup_only;
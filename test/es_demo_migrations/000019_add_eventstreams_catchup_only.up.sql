@@ -0,0 +1,2 @@
+ALTER TABLE eventstreams ADD COLUMN catchup_only BOOLEAN;
+ALTER TABLE eventstreams ADD COLUMN catchup_tip TEXT;
@@ -0,0 +1 @@
+DROP INDEX eventstreams_ws_topic;
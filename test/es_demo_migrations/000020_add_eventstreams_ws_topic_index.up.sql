@@ -0,0 +1 @@
+CREATE UNIQUE INDEX eventstreams_ws_topic ON eventstreams(ws_topic);